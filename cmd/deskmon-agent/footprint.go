@@ -0,0 +1,19 @@
+//go:build !embedded
+
+package main
+
+import (
+	"github.com/neur0map/deskmon-agent/internal/events"
+	"github.com/neur0map/deskmon-agent/internal/history"
+)
+
+// In-memory buffer sizes. The embedded build (footprint_embedded.go) uses
+// smaller ones.
+const (
+	logBufferLines         = 2000
+	eventCapacity          = events.DefaultCapacity
+	historyRawRetention    = history.DefaultRawRetention
+	historyMinuteRetention = history.DefaultMinuteRetention
+)
+
+func tuneRuntime() {}
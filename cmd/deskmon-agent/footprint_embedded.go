@@ -0,0 +1,31 @@
+//go:build embedded
+
+package main
+
+import (
+	"os"
+	"runtime/debug"
+	"time"
+)
+
+// Buffer sizes for routers and small boards with a few tens of MB of RAM:
+// ten minutes of one-second history and a day of one-minute averages
+// instead of an hour and a week.
+const (
+	logBufferLines         = 200
+	eventCapacity          = 200
+	historyRawRetention    = 10 * time.Minute
+	historyMinuteRetention = 24 * time.Hour
+)
+
+// tuneRuntime trades a little CPU for memory: the GC runs twice as often
+// and tries to keep the heap under 24 MiB. GOGC and GOMEMLIMIT in the
+// environment take precedence.
+func tuneRuntime() {
+	if os.Getenv("GOGC") == "" {
+		debug.SetGCPercent(50)
+	}
+	if os.Getenv("GOMEMLIMIT") == "" {
+		debug.SetMemoryLimit(24 << 20)
+	}
+}
@@ -3,14 +3,25 @@ package main
 import (
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 
+	"github.com/neur0map/deskmon-agent/internal/alerts"
 	"github.com/neur0map/deskmon-agent/internal/api"
 	"github.com/neur0map/deskmon-agent/internal/collector"
+	"github.com/neur0map/deskmon-agent/internal/collector/services"
 	"github.com/neur0map/deskmon-agent/internal/config"
+	"github.com/neur0map/deskmon-agent/internal/custom"
+	"github.com/neur0map/deskmon-agent/internal/events"
+	"github.com/neur0map/deskmon-agent/internal/history"
+	"github.com/neur0map/deskmon-agent/internal/logbuf"
+	"github.com/neur0map/deskmon-agent/internal/memguard"
+	"github.com/neur0map/deskmon-agent/internal/notify"
+	"github.com/neur0map/deskmon-agent/internal/updater"
 )
 
 var Version = "dev"
@@ -25,6 +36,11 @@ func main() {
 		os.Exit(0)
 	}
 
+	tuneRuntime()
+
+	// Keep recent log lines for GET /debug/bundle.
+	logBuffer := logbuf.New(logBufferLines)
+	log.SetOutput(io.MultiWriter(os.Stderr, logBuffer))
 	log.SetFlags(log.LstdFlags | log.Lshortfile)
 	log.Printf("deskmon-agent %s starting", Version)
 
@@ -32,20 +48,189 @@ func main() {
 	if err != nil {
 		log.Fatalf("failed to load config: %v", err)
 	}
+	if cfg.NeedsEncryption() {
+		if changed, err := cfg.EncryptFile(*configPath); err != nil {
+			log.Printf("failed to encrypt secrets in %s: %v", *configPath, err)
+		} else if changed {
+			log.Printf("encrypted plaintext secrets in %s", *configPath)
+		}
+	}
 
 	// Initialize collectors
+	dockerCollector := collector.NewDockerCollector(cfg.DockerHost)
+	switch {
+	case !cfg.Collectors.DockerEnabled():
+		dockerCollector.Disable()
+	case cfg.TrivyServer != "":
+		dockerCollector.EnableImageScanning(cfg.TrivyServer, cfg.TrivyInterval)
+	}
+	dockerCollector.Start()
+	defer dockerCollector.Stop()
+
 	systemCollector := collector.NewSystemCollector()
+	systemCollector.SetProcessFilter(cfg.Processes.ExcludeSelf, cfg.Processes.Exclude)
+	systemCollector.SetDocker(dockerCollector)
+	if !cfg.Collectors.ProcessesEnabled() {
+		systemCollector.DisableProcesses()
+	}
+	if !cfg.Collectors.TemperatureEnabled() {
+		systemCollector.DisableTemperature()
+	}
+	if cfg.PerCoreCPU {
+		systemCollector.EnablePerCore()
+	}
 	systemCollector.Start()
 	defer systemCollector.Stop()
 
-	dockerCollector := collector.NewDockerCollector(config.DefaultDockerSock)
-	dockerCollector.Start()
-	defer dockerCollector.Stop()
+	cgroupCollector := collector.NewCgroupCollector()
+	cgroupCollector.Start()
+	defer cgroupCollector.Stop()
+
+	gpuCollector := collector.NewGPUCollector(dockerCollector)
+	gpuCollector.Start()
+	defer gpuCollector.Stop()
+
+	zfsCollector := collector.NewZFSCollector()
+	zfsCollector.Start()
+	defer zfsCollector.Stop()
+
+	certCollector := collector.NewCertificateCollector(dockerCollector, cfg.CertificatePaths)
+	certCollector.Start()
+	defer certCollector.Stop()
+
+	dnsChecker := collector.NewDNSChecker(cfg.DNS)
+	dnsChecker.Start()
+	defer dnsChecker.Stop()
+
+	serviceDetector := services.NewServiceDetector(cfg.DockerHost)
+	for pluginID, values := range cfg.Services {
+		for key, value := range values {
+			serviceDetector.SetServiceConfig(pluginID, key, value)
+		}
+	}
+	serviceDetector.SetDetection(cfg.Detection)
+	services.SetHTTPOptions(cfg.ServiceHTTP)
+	if !cfg.Collectors.DockerEnabled() {
+		serviceDetector.DisableDocker()
+	}
+	if cfg.Collectors.ServicesEnabled() {
+		serviceDetector.Start()
+	}
+	defer serviceDetector.Stop()
+
+	rawRetention, minuteRetention := historyRawRetention, historyMinuteRetention
+	if cfg.MaxMemoryMB > 0 {
+		// History is allocated up front; give it at most a twentieth of
+		// the budget.
+		rawRetention, minuteRetention = history.FitRetention(uint64(cfg.MaxMemoryMB)<<20/20, rawRetention, minuteRetention)
+	}
+	historyStore := history.NewStoreWithRetention(rawRetention, minuteRetention)
+	historyStore.WatchSystem(systemCollector.Broadcast)
+	defer historyStore.Stop()
+
+	var autoUpdater *updater.Updater
+	switch {
+	case cfg.AutoUpdate.Enabled && cfg.ReadOnly:
+		log.Printf("auto-update: disabled because read_only is set")
+	case cfg.AutoUpdate.Enabled && !updater.Supported:
+		log.Printf("auto-update: disabled, agent built without Docker support")
+	case cfg.AutoUpdate.Enabled && !cfg.Collectors.DockerEnabled():
+		log.Printf("auto-update: disabled because the Docker collector is off")
+	case cfg.AutoUpdate.Enabled:
+		autoUpdater = updater.New(cfg.DockerHost, cfg.AutoUpdate)
+		autoUpdater.Start()
+		defer autoUpdater.Stop()
+	}
+
+	customMetrics := custom.NewStore()
+	customMetrics.Start()
+	defer customMetrics.Stop()
+
+	if cfg.TextfileDir != "" {
+		textfiles := custom.NewTextfileCollector(cfg.TextfileDir, customMetrics)
+		textfiles.Start()
+		defer textfiles.Stop()
+	}
+
+	timeline := events.NewTimeline(eventCapacity)
+	timeline.Add(events.Event{
+		Category: events.CategoryAgent,
+		Type:     "agent.started",
+		Source:   "agent",
+		Message:  "deskmon-agent " + Version + " started",
+	})
+	timeline.WatchContainers(dockerCollector.Broadcast)
+	timeline.WatchDockerEvents(dockerCollector.EventBroadcast)
+	timeline.WatchServices(serviceDetector.Broadcast)
+	if autoUpdater != nil {
+		timeline.WatchUpdates(autoUpdater.Broadcast)
+	}
+	defer timeline.Stop()
+
+	alertManager := alerts.NewManager()
+	alertManager.SetRules(cfg.Alerts.Rules)
+	alertManager.WatchContainers(dockerCollector.Broadcast)
+	alertManager.WatchDockerEvents(dockerCollector.EventBroadcast)
+	alertManager.WatchSystem(systemCollector.Broadcast)
+	alertManager.WatchCustomMetrics(customMetrics.Broadcast)
+	alertManager.WatchEvents(timeline.Broadcast)
+	alertManager.WatchServices(serviceDetector.Broadcast)
+	alertManager.WatchCertificates(certCollector.Broadcast)
+	alertManager.WatchDNS(dnsChecker.Broadcast)
+	alertManager.RecordTo(timeline)
+	defer alertManager.Stop()
+
+	if hooks := cfg.Notifications.Webhooks; len(hooks) > 0 {
+		notifier := notify.NewDispatcher(hooks)
+		notifier.WatchAlerts(alertManager.Broadcast)
+		notifier.WatchContainers(dockerCollector.Broadcast)
+		notifier.Start()
+		defer notifier.Stop()
+		log.Printf("notify: sending to %d webhook(s)", len(hooks))
+	}
+
+	var guard *memguard.Guard
+	if cfg.MaxMemoryMB > 0 {
+		guard = newMemoryGuard(cfg.MaxMemoryMB, serviceDetector, gpuCollector, cgroupCollector, historyStore)
+		guard.Start()
+		defer guard.Stop()
+	}
+
+	if off := cfg.Collectors.Disabled(); len(off) > 0 {
+		log.Printf("collectors disabled in config: %s", strings.Join(off, ", "))
+	}
 
-	log.Printf("listening on %s:%d", cfg.Bind, cfg.Port)
+	scheme := "http"
+	if cfg.TLSCert != "" {
+		scheme = "https"
+	}
+	log.Printf("listening on %s://%s:%d", scheme, cfg.Bind, cfg.Port)
 
 	// Start HTTP server
-	srv := api.NewServer(cfg, systemCollector, dockerCollector, Version, *configPath)
+	srv := api.NewServer(cfg, systemCollector, dockerCollector, serviceDetector, Version, *configPath)
+	srv.SetAlerts(alertManager)
+	srv.SetGPU(gpuCollector)
+	srv.SetZFS(zfsCollector)
+	srv.SetCertificates(certCollector)
+	srv.SetDNS(dnsChecker)
+	srv.SetCgroups(cgroupCollector)
+	srv.SetHistory(historyStore)
+	srv.SetLogBuffer(logBuffer)
+	srv.SetCustomMetrics(customMetrics)
+	srv.SetEvents(timeline)
+	if autoUpdater != nil {
+		srv.SetUpdater(autoUpdater)
+	}
+	if guard != nil {
+		srv.SetMemoryGuard(guard)
+	}
+
+	// Fans set through the API go back to their previous mode on exit.
+	defer func() {
+		if err := collector.RestoreFans(); err != nil {
+			log.Printf("fans: restoring original modes: %v", err)
+		}
+	}()
 
 	// Graceful shutdown
 	sigCh := make(chan os.Signal, 1)
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"github.com/neur0map/deskmon-agent/internal/collector"
+	"github.com/neur0map/deskmon-agent/internal/collector/services"
+	"github.com/neur0map/deskmon-agent/internal/history"
+	"github.com/neur0map/deskmon-agent/internal/memguard"
+)
+
+// newMemoryGuard sets up max_memory_mb. Under pressure it first stops the
+// service plugins (HTTP calls and JSON decoding every 10s), then GPU and
+// cgroup sampling, and last cuts history to a quarter of its retention.
+// Their last samples stay available, marked stale.
+func newMemoryGuard(limitMB int, svc *services.ServiceDetector, gpu *collector.GPUCollector, cgroups *collector.CgroupCollector, hist *history.Store) *memguard.Guard {
+	g := memguard.New(limitMB)
+	pause := func(name string, p interface{ SetPaused(bool) }) {
+		g.Add(memguard.Action{
+			Name:    name,
+			Shed:    func() { p.SetPaused(true) },
+			Restore: func() { p.SetPaused(false) },
+		})
+	}
+	pause("services", svc)
+	pause("gpu", gpu)
+	pause("cgroups", cgroups)
+
+	raw, minutes := hist.Retention()
+	g.Add(memguard.Action{
+		Name:    "history",
+		Shed:    func() { hist.SetRetention(raw/4, minutes/4) },
+		Restore: func() { hist.SetRetention(raw, minutes) },
+	})
+	return g
+}
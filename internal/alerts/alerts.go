@@ -0,0 +1,126 @@
+package alerts
+
+import (
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/neur0map/deskmon-agent/internal/collector"
+	"github.com/neur0map/deskmon-agent/internal/config"
+)
+
+// Severity levels, lowest to highest.
+const (
+	SeverityInfo     = "info"
+	SeverityWarning  = "warning"
+	SeverityCritical = "critical"
+)
+
+// Alert is a condition the agent wants the user to know about. ID is stable
+// for the lifetime of the condition so re-firing updates the existing alert
+// instead of creating a duplicate.
+type Alert struct {
+	ID         string     `json:"id"`
+	Type       string     `json:"type"`
+	Severity   string     `json:"severity"`
+	Source     string     `json:"source"`
+	Message    string     `json:"message"`
+	StartedAt  time.Time  `json:"startedAt"`
+	UpdatedAt  time.Time  `json:"updatedAt"`
+	ResolvedAt *time.Time `json:"resolvedAt,omitempty"`
+}
+
+// Manager tracks active alerts and broadcasts every fire/resolve so SSE
+// clients see changes as they happen.
+type Manager struct {
+	mu     sync.Mutex
+	active map[string]*Alert
+	rules  []config.AlertRule
+	stopCh chan struct{}
+
+	thermal     map[string]*thermalEpisode // by alert ID, while the condition holds
+	eventExpiry map[string]time.Time       // event alert ID -> auto-resolve time
+	limitsFired map[string]time.Time       // kernel_limits alert ID -> last fired, while over the limit
+	raidFired   map[string]time.Time       // raid alert ID -> last fired, while the array is degraded
+	certsFired  map[string]bool            // certificate_expiry alert IDs currently firing
+	dnsFired    map[string]bool            // dns alert IDs currently firing
+
+	Broadcast *collector.Broadcaster[Alert]
+}
+
+func NewManager() *Manager {
+	return &Manager{
+		active:      make(map[string]*Alert),
+		rules:       DefaultRules,
+		thermal:     make(map[string]*thermalEpisode),
+		eventExpiry: make(map[string]time.Time),
+		limitsFired: make(map[string]time.Time),
+		raidFired:   make(map[string]time.Time),
+		certsFired:  make(map[string]bool),
+		dnsFired:    make(map[string]bool),
+		stopCh:      make(chan struct{}),
+		Broadcast:   collector.NewBroadcaster[Alert](),
+	}
+}
+
+// Stop ends rule evaluation started by the Watch* methods.
+func (m *Manager) Stop() {
+	close(m.stopCh)
+}
+
+// Fire raises an alert, or refreshes it if one with the same ID is active.
+func (m *Manager) Fire(a Alert) {
+	now := time.Now()
+
+	m.mu.Lock()
+	existing, ok := m.active[a.ID]
+	if ok {
+		existing.Severity = a.Severity
+		existing.Message = a.Message
+		existing.UpdatedAt = now
+		a = *existing
+	} else {
+		a.StartedAt = now
+		a.UpdatedAt = now
+		m.active[a.ID] = &a
+		log.Printf("alert: %s [%s] %s", a.ID, a.Severity, a.Message)
+	}
+	m.mu.Unlock()
+
+	m.Broadcast.Send(a)
+}
+
+// Resolve clears an active alert. A no-op when id is not active.
+func (m *Manager) Resolve(id string) {
+	m.mu.Lock()
+	a, ok := m.active[id]
+	if !ok {
+		m.mu.Unlock()
+		return
+	}
+	delete(m.active, id)
+	now := time.Now()
+	a.ResolvedAt = &now
+	a.UpdatedAt = now
+	resolved := *a
+	m.mu.Unlock()
+
+	log.Printf("alert: %s resolved", id)
+	m.Broadcast.Send(resolved)
+}
+
+// Active returns a snapshot of active alerts, oldest first.
+func (m *Manager) Active() []Alert {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	result := make([]Alert, 0, len(m.active))
+	for _, a := range m.active {
+		result = append(result, *a)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].StartedAt.Before(result[j].StartedAt)
+	})
+	return result
+}
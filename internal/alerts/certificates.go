@@ -0,0 +1,104 @@
+package alerts
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/neur0map/deskmon-agent/internal/collector"
+	"github.com/neur0map/deskmon-agent/internal/config"
+)
+
+const defaultCertExpiryDays = 14
+
+// WatchCertificates evaluates certificate_expiry rules after every scan of
+// the certificate stores, until Stop is called.
+func (m *Manager) WatchCertificates(b *collector.Broadcaster[[]collector.Certificate]) {
+	ch, cleanup := b.Subscribe(2)
+	go func() {
+		defer cleanup()
+		for {
+			select {
+			case certs := <-ch:
+				m.EvaluateCertificates(certs)
+			case <-m.stopCh:
+				return
+			}
+		}
+	}()
+}
+
+// EvaluateCertificates fires an alert for each stored certificate that
+// expires within the rule's threshold in days (default 14), critical once
+// expired, and resolves alerts for certificates that were renewed or
+// removed. A domain kept in several places of one store alerts once, for
+// the copy that expires first.
+func (m *Manager) EvaluateCertificates(certs []collector.Certificate) {
+	m.mu.Lock()
+	rules := m.rules
+	m.mu.Unlock()
+
+	var rule *config.AlertRule
+	for i := range rules {
+		if rules[i].Type == RuleCertificateExpiry {
+			rule = &rules[i]
+			break
+		}
+	}
+	threshold := defaultCertExpiryDays
+	if rule != nil && rule.Threshold > 0 {
+		threshold = rule.Threshold
+	}
+
+	firing := make(map[string]bool)
+	if rule != nil {
+		for _, c := range certs {
+			if c.DaysRemaining >= threshold || len(c.Domains) == 0 {
+				continue
+			}
+			id := RuleCertificateExpiry + ":" + c.Source + ":" + c.Domains[0]
+			if firing[id] {
+				continue
+			}
+			firing[id] = true
+			m.Fire(certificateAlert(*rule, id, c))
+		}
+	}
+
+	m.mu.Lock()
+	var cleared []string
+	for id := range m.certsFired {
+		if !firing[id] {
+			delete(m.certsFired, id)
+			cleared = append(cleared, id)
+		}
+	}
+	for id := range firing {
+		m.certsFired[id] = true
+	}
+	m.mu.Unlock()
+	for _, id := range cleared {
+		m.Resolve(id)
+	}
+}
+
+func certificateAlert(rule config.AlertRule, id string, c collector.Certificate) Alert {
+	severity := rule.Severity
+	if severity == "" {
+		severity = SeverityWarning
+	}
+	domains := strings.Join(c.Domains, ", ")
+	var msg string
+	if c.Status == collector.CertExpired {
+		severity = SeverityCritical
+		msg = fmt.Sprintf("Certificate for %s expired on %s (%s)", domains, c.NotAfter.Format("2006-01-02"), c.Path)
+	} else {
+		msg = fmt.Sprintf("Certificate for %s expires in %d days, on %s (%s)", domains, c.DaysRemaining, c.NotAfter.Format("2006-01-02"), c.Path)
+	}
+	return Alert{
+		ID:       id,
+		Type:     RuleCertificateExpiry,
+		Severity: severity,
+		Source:   "host",
+		Message:  msg,
+	}
+}
@@ -0,0 +1,81 @@
+package alerts
+
+import (
+	"fmt"
+
+	"github.com/neur0map/deskmon-agent/internal/collector"
+	"github.com/neur0map/deskmon-agent/internal/config"
+	"github.com/neur0map/deskmon-agent/internal/custom"
+)
+
+// WatchCustomMetrics evaluates custom_metric rules whenever the set of
+// custom metrics changes, until Stop is called.
+func (m *Manager) WatchCustomMetrics(b *collector.Broadcaster[[]custom.Metric]) {
+	ch, cleanup := b.Subscribe(2)
+	go func() {
+		defer cleanup()
+		for {
+			select {
+			case metrics := <-ch:
+				m.EvaluateCustomMetrics(metrics)
+			case <-m.stopCh:
+				return
+			}
+		}
+	}()
+}
+
+// EvaluateCustomMetrics fires an alert for each metric series outside its
+// rule's bounds and resolves custom_metric alerts that are back in bounds
+// or whose metric expired.
+func (m *Manager) EvaluateCustomMetrics(metrics []custom.Metric) {
+	m.mu.Lock()
+	rules := m.rules
+	m.mu.Unlock()
+
+	firing := make(map[string]bool)
+	for _, rule := range rules {
+		if rule.Type != RuleCustomMetric {
+			continue
+		}
+		for _, metric := range metrics {
+			if metric.Name != rule.Metric {
+				continue
+			}
+			msg, ok := customMetricBreach(rule, metric)
+			if !ok {
+				continue
+			}
+			severity := rule.Severity
+			if severity == "" {
+				severity = SeverityWarning
+			}
+			id := RuleCustomMetric + ":" + metric.Key()
+			firing[id] = true
+			m.Fire(Alert{
+				ID:       id,
+				Type:     RuleCustomMetric,
+				Severity: severity,
+				Source:   "custom:" + metric.Name,
+				Message:  msg,
+			})
+		}
+	}
+
+	for _, a := range m.Active() {
+		if a.Type == RuleCustomMetric && !firing[a.ID] {
+			m.Resolve(a.ID)
+		}
+	}
+}
+
+func customMetricBreach(rule config.AlertRule, metric custom.Metric) (string, bool) {
+	series := metric.Key()
+	switch {
+	case rule.Above != nil && metric.Value > *rule.Above:
+		return fmt.Sprintf("%s is %g, above %g", series, metric.Value, *rule.Above), true
+	case rule.Below != nil && metric.Value < *rule.Below:
+		return fmt.Sprintf("%s is %g, below %g", series, metric.Value, *rule.Below), true
+	}
+	return "", false
+}
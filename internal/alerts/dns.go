@@ -0,0 +1,85 @@
+package alerts
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/neur0map/deskmon-agent/internal/collector"
+)
+
+// WatchDNS evaluates dns rules after every DNS record check, until Stop is
+// called.
+func (m *Manager) WatchDNS(b *collector.Broadcaster[collector.DNSReport]) {
+	ch, cleanup := b.Subscribe(2)
+	go func() {
+		defer cleanup()
+		for {
+			select {
+			case report := <-ch:
+				m.EvaluateDNS(report)
+			case <-m.stopCh:
+				return
+			}
+		}
+	}()
+}
+
+// EvaluateDNS fires an alert for each configured record that resolves to
+// something other than expected or doesn't exist, and resolves it once the
+// record is right again. Failed lookups and an unknown public address
+// leave alerts as they are.
+func (m *Manager) EvaluateDNS(report collector.DNSReport) {
+	m.mu.Lock()
+	rules := m.rules
+	m.mu.Unlock()
+
+	severity := ""
+	for _, rule := range rules {
+		if rule.Type == RuleDNS {
+			severity = rule.Severity
+			if severity == "" {
+				severity = SeverityWarning
+			}
+			break
+		}
+	}
+
+	var fire []Alert
+	var cleared []string
+	m.mu.Lock()
+	for _, r := range report.Records {
+		id := RuleDNS + ":" + r.Name + ":" + r.Type
+		switch {
+		case severity != "" && (r.Status == collector.DNSMismatch || r.Status == collector.DNSMissing):
+			m.dnsFired[id] = true
+			fire = append(fire, Alert{
+				ID:       id,
+				Type:     RuleDNS,
+				Severity: severity,
+				Source:   "host",
+				Message:  dnsMessage(r),
+			})
+		case severity == "" || r.Status == collector.DNSOK:
+			if m.dnsFired[id] {
+				delete(m.dnsFired, id)
+				cleared = append(cleared, id)
+			}
+		}
+	}
+	m.mu.Unlock()
+
+	for _, a := range fire {
+		m.Fire(a)
+	}
+	for _, id := range cleared {
+		m.Resolve(id)
+	}
+}
+
+func dnsMessage(r collector.DNSRecordResult) string {
+	want := strings.Join(r.Expected, ", ")
+	if r.Status == collector.DNSMissing {
+		return fmt.Sprintf("%s %s record not found, expected %s", r.Name, r.Type, want)
+	}
+	return fmt.Sprintf("%s %s record is %s, expected %s", r.Name, r.Type, strings.Join(r.Actual, ", "), want)
+}
@@ -0,0 +1,147 @@
+package alerts
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/neur0map/deskmon-agent/internal/collector"
+	"github.com/neur0map/deskmon-agent/internal/config"
+	"github.com/neur0map/deskmon-agent/internal/events"
+)
+
+const defaultEventAlertDuration = time.Hour
+
+// WatchEvents evaluates event rules against every ingested event and
+// resolves event alerts once their duration has passed, until Stop is
+// called.
+func (m *Manager) WatchEvents(b *collector.Broadcaster[events.Event]) {
+	ch, cleanup := b.Subscribe(16)
+	go func() {
+		defer cleanup()
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+		for {
+			select {
+			case ev := <-ch:
+				m.EvaluateEvent(ev)
+			case now := <-ticker.C:
+				m.expireEventAlerts(now)
+			case <-m.stopCh:
+				return
+			}
+		}
+	}()
+}
+
+// EvaluateEvent fires an alert for each event rule the event matches and
+// resolves alerts from the same source whose rule lists it in Resolve.
+func (m *Manager) EvaluateEvent(ev events.Event) {
+	if ev.Category != events.CategoryExternal {
+		return
+	}
+
+	m.mu.Lock()
+	rules := m.rules
+	m.mu.Unlock()
+
+	for _, rule := range rules {
+		if rule.Type != RuleEvent || !matchContainer(rule.Source, ev.Source) {
+			continue
+		}
+		id := fmt.Sprintf("%s:%s:%s", RuleEvent, ev.Source, rule.Event)
+		if rule.Resolve != "" && matchContainer(rule.Resolve, ev.Type) {
+			m.mu.Lock()
+			delete(m.eventExpiry, id)
+			m.mu.Unlock()
+			m.Resolve(id)
+			continue
+		}
+		if !matchContainer(rule.Event, ev.Type) {
+			continue
+		}
+
+		duration := rule.Duration
+		if duration <= 0 {
+			duration = defaultEventAlertDuration
+		}
+		m.mu.Lock()
+		m.eventExpiry[id] = time.Now().Add(duration)
+		m.mu.Unlock()
+
+		msg := ev.Message
+		if msg == "" {
+			msg = fmt.Sprintf("%s reported %s", ev.Source, ev.Type)
+		}
+		m.Fire(Alert{
+			ID:       id,
+			Type:     RuleEvent,
+			Severity: eventAlertSeverity(rule, ev),
+			Source:   "event:" + ev.Source,
+			Message:  msg,
+		})
+	}
+}
+
+// eventAlertSeverity uses the rule's severity, else the event's own when it
+// is above info.
+func eventAlertSeverity(rule config.AlertRule, ev events.Event) string {
+	switch {
+	case rule.Severity != "":
+		return rule.Severity
+	case ev.Severity == SeverityCritical:
+		return SeverityCritical
+	default:
+		return SeverityWarning
+	}
+}
+
+func (m *Manager) expireEventAlerts(now time.Time) {
+	var expired []string
+	m.mu.Lock()
+	for id, until := range m.eventExpiry {
+		if now.After(until) {
+			expired = append(expired, id)
+			delete(m.eventExpiry, id)
+		}
+	}
+	m.mu.Unlock()
+
+	for _, id := range expired {
+		m.Resolve(id)
+	}
+}
+
+// RecordTo adds an entry to the timeline whenever an alert is first raised
+// or resolved, until Stop is called. Refreshes of an active alert are not
+// recorded.
+func (m *Manager) RecordTo(t *events.Timeline) {
+	ch, cleanup := m.Broadcast.Subscribe(16)
+	go func() {
+		defer cleanup()
+		for {
+			select {
+			case a := <-ch:
+				ev := events.Event{
+					Category: events.CategoryAlert,
+					Source:   a.Source,
+					Severity: a.Severity,
+					Message:  a.Message,
+				}
+				switch {
+				case a.ResolvedAt != nil:
+					ev.Type = "alert.resolved"
+					ev.Severity = events.SeverityInfo
+				case a.StartedAt.Equal(a.UpdatedAt):
+					ev.Type = "alert.fired"
+				default:
+					continue
+				}
+				ev.Data, _ = json.Marshal(map[string]string{"alertId": a.ID, "alertType": a.Type})
+				t.Add(ev)
+			case <-m.stopCh:
+				return
+			}
+		}
+	}()
+}
@@ -0,0 +1,101 @@
+package alerts
+
+import (
+	"fmt"
+
+	"github.com/neur0map/deskmon-agent/internal/collector"
+	"github.com/neur0map/deskmon-agent/internal/collector/services"
+)
+
+const defaultIntrusionThreshold = 10 // bans within 15 minutes
+
+// WatchServices evaluates intrusion rules against every service
+// collection, until Stop is called.
+func (m *Manager) WatchServices(b *collector.Broadcaster[[]services.ServiceStats]) {
+	ch, cleanup := b.Subscribe(2)
+	go func() {
+		defer cleanup()
+		for {
+			select {
+			case list := <-ch:
+				m.EvaluateServices(list)
+			case <-m.stopCh:
+				return
+			}
+		}
+	}()
+}
+
+// EvaluateServices fires intrusion alerts while the security plugin
+// (CrowdSec or fail2ban) reports a burst of bans or a CrowdSec bouncer that
+// stopped pulling decisions, and resolves them once that clears or the
+// plugin is no longer detected.
+func (m *Manager) EvaluateServices(list []services.ServiceStats) {
+	m.mu.Lock()
+	rules := m.rules
+	m.mu.Unlock()
+
+	var security *services.ServiceStats
+	for i := range list {
+		if list[i].PluginID == "security" {
+			security = &list[i]
+		}
+	}
+	if security != nil && (security.Status == "error" || security.Status == "unreachable") {
+		return // keep alerts as they are until the next good collection
+	}
+
+	firing := make(map[string]bool)
+	for _, rule := range rules {
+		if rule.Type != RuleIntrusion || security == nil {
+			continue
+		}
+		severity := rule.Severity
+		if severity == "" {
+			severity = SeverityWarning
+		}
+		threshold := rule.Threshold
+		if threshold <= 0 {
+			threshold = defaultIntrusionThreshold
+		}
+
+		if bans, _ := security.Stats["recentBans"].(int); bans >= threshold {
+			id := RuleIntrusion + ":bans"
+			firing[id] = true
+			m.Fire(Alert{
+				ID:       id,
+				Type:     RuleIntrusion,
+				Severity: severity,
+				Source:   "service:security",
+				Message:  fmt.Sprintf("%s banned %d addresses in the last 15 minutes", security.Name, bans),
+			})
+		}
+
+		bouncers, _ := security.Stats["bouncers"].([]map[string]interface{})
+		for _, b := range bouncers {
+			if healthy, _ := b["healthy"].(bool); healthy {
+				continue
+			}
+			name, _ := b["name"].(string)
+			id := RuleIntrusion + ":bouncer:" + name
+			firing[id] = true
+			msg := fmt.Sprintf("CrowdSec bouncer %s has not pulled decisions recently", name)
+			if revoked, _ := b["revoked"].(bool); revoked {
+				msg = fmt.Sprintf("CrowdSec bouncer %s is revoked", name)
+			}
+			m.Fire(Alert{
+				ID:       id,
+				Type:     RuleIntrusion,
+				Severity: severity,
+				Source:   "service:security",
+				Message:  msg,
+			})
+		}
+	}
+
+	for _, a := range m.Active() {
+		if a.Type == RuleIntrusion && !firing[a.ID] {
+			m.Resolve(a.ID)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package alerts
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/neur0map/deskmon-agent/internal/collector"
+	"github.com/neur0map/deskmon-agent/internal/config"
+)
+
+const (
+	defaultLimitsThreshold = 90          // percent of the kernel limit
+	limitsRefireInterval   = time.Minute // how often an active alert's usage is updated
+)
+
+// evaluateLimits fires a kernel_limits alert for open files and threads
+// while either is at or above the rule's percentage of its kernel limit,
+// and resolves it once usage drops back below.
+func (m *Manager) evaluateLimits(now time.Time, rule config.AlertRule, limits collector.KernelLimits) {
+	threshold := float64(rule.Threshold)
+	if threshold <= 0 {
+		threshold = defaultLimitsThreshold
+	}
+
+	checks := []struct {
+		kind        string
+		used, limit uint64
+		percent     float64
+		what        string
+	}{
+		{"files", limits.OpenFiles, limits.MaxFiles, limits.FilesPercent(), "open files"},
+		{"threads", limits.Threads, limits.MaxThreads, limits.ThreadsPercent(), "threads"},
+	}
+	for _, c := range checks {
+		id := RuleKernelLimits + ":" + c.kind
+		if c.limit == 0 || c.percent < threshold {
+			m.mu.Lock()
+			_, tracked := m.limitsFired[id]
+			delete(m.limitsFired, id)
+			m.mu.Unlock()
+			if tracked {
+				m.Resolve(id)
+			}
+			continue
+		}
+
+		m.mu.Lock()
+		due := now.Sub(m.limitsFired[id]) >= limitsRefireInterval
+		if due {
+			m.limitsFired[id] = now
+		}
+		m.mu.Unlock()
+		if !due {
+			continue
+		}
+
+		severity := rule.Severity
+		if severity == "" {
+			severity = SeverityWarning
+		}
+		m.Fire(Alert{
+			ID:       id,
+			Type:     RuleKernelLimits,
+			Severity: severity,
+			Source:   "host",
+			Message:  fmt.Sprintf("%d of %d %s in use (%.0f%% of the kernel limit)", c.used, c.limit, c.what, c.percent),
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package alerts
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/neur0map/deskmon-agent/internal/collector"
+	"github.com/neur0map/deskmon-agent/internal/config"
+)
+
+const raidRefireInterval = time.Minute // how often an active alert's rebuild progress is updated
+
+// evaluateRAID fires a raid alert for each md array that is degraded,
+// rebuilding or inactive, updates it while a rebuild progresses, and
+// resolves it once the array is back in sync or gone.
+func (m *Manager) evaluateRAID(now time.Time, rule config.AlertRule, arrays []collector.RAIDArray) {
+	degraded := make(map[string]bool)
+	for _, a := range arrays {
+		if !a.Degraded {
+			continue
+		}
+		id := RuleRAID + ":" + a.Name
+		degraded[id] = true
+
+		m.mu.Lock()
+		due := now.Sub(m.raidFired[id]) >= raidRefireInterval
+		if due {
+			m.raidFired[id] = now
+		}
+		m.mu.Unlock()
+		if !due {
+			continue
+		}
+
+		// One more failed member can lose data, so this is critical
+		// unless the rule says otherwise.
+		severity := rule.Severity
+		if severity == "" {
+			severity = SeverityCritical
+		}
+		m.Fire(Alert{
+			ID:       id,
+			Type:     RuleRAID,
+			Severity: severity,
+			Source:   "host",
+			Message:  raidMessage(a),
+		})
+	}
+
+	m.mu.Lock()
+	var cleared []string
+	for id := range m.raidFired {
+		if !degraded[id] {
+			delete(m.raidFired, id)
+			cleared = append(cleared, id)
+		}
+	}
+	m.mu.Unlock()
+	for _, id := range cleared {
+		m.Resolve(id)
+	}
+}
+
+func raidMessage(a collector.RAIDArray) string {
+	if a.State == collector.RAIDInactive {
+		return fmt.Sprintf("RAID array %s is inactive", a.Name)
+	}
+	msg := fmt.Sprintf("RAID array %s (%s) %s: %d of %d devices in sync", a.Name, a.Level, a.State, a.Active, a.Devices)
+	var failed []string
+	for _, d := range a.Members {
+		if d.Role == "failed" {
+			failed = append(failed, d.Device)
+		}
+	}
+	if len(failed) > 0 {
+		msg += ", failed: " + strings.Join(failed, ", ")
+	}
+	if s := a.Sync; s != nil && !s.Pending {
+		msg += fmt.Sprintf(", %s %.1f%% done, %s left", s.Action, s.ProgressPercent, (time.Duration(s.FinishSeconds) * time.Second).String())
+	}
+	return msg
+}
@@ -0,0 +1,230 @@
+package alerts
+
+import (
+	"fmt"
+	"log"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/neur0map/deskmon-agent/internal/collector"
+	"github.com/neur0map/deskmon-agent/internal/config"
+)
+
+// Rule types.
+const (
+	RuleContainerFlapping = "container_flapping"
+	RuleContainerOOM      = "container_oom"
+	RuleThermal           = "thermal"
+	RuleCustomMetric      = "custom_metric"
+	RuleEvent             = "event"
+	RuleKernelLimits      = "kernel_limits"
+	RuleIntrusion         = "intrusion"
+	RuleRAID              = "raid"
+	RuleCertificateExpiry = "certificate_expiry"
+	RuleDNS               = "dns"
+)
+
+// DefaultRules apply when the config has no alerts.rules.
+var DefaultRules = []config.AlertRule{
+	{Type: RuleContainerFlapping},
+	{Type: RuleContainerOOM},
+	{Type: RuleThermal},
+	{Type: RuleKernelLimits},
+	{Type: RuleIntrusion},
+	{Type: RuleRAID},
+	{Type: RuleCertificateExpiry},
+	{Type: RuleDNS},
+}
+
+// containerRuleTypes are evaluated against each Docker refresh. OOM kills
+// come from Docker's oom events instead: the inspect OOMKilled flag is
+// cleared by a restart and stays set while a killed container is down.
+var containerRuleTypes = map[string]bool{
+	RuleContainerFlapping: true,
+}
+
+// knownRuleTypes are the rule types SetRules accepts.
+var knownRuleTypes = map[string]bool{
+	RuleContainerFlapping: true,
+	RuleContainerOOM:      true,
+	RuleThermal:           true,
+	RuleCustomMetric:      true,
+	RuleEvent:             true,
+	RuleKernelLimits:      true,
+	RuleIntrusion:         true,
+	RuleRAID:              true,
+	RuleCertificateExpiry: true,
+	RuleDNS:               true,
+}
+
+// SetRules replaces the active rules, dropping (and logging) unknown types.
+func (m *Manager) SetRules(rules []config.AlertRule) {
+	if len(rules) == 0 {
+		rules = DefaultRules
+	}
+	valid := make([]config.AlertRule, 0, len(rules))
+	for _, rule := range rules {
+		if !knownRuleTypes[rule.Type] {
+			log.Printf("alerts: ignoring rule with unknown type %q", rule.Type)
+			continue
+		}
+		if rule.Type == RuleCustomMetric && (rule.Metric == "" || rule.Above == nil && rule.Below == nil) {
+			log.Printf("alerts: ignoring custom_metric rule without metric and above/below")
+			continue
+		}
+		if rule.Type == RuleEvent && rule.Event == "" {
+			log.Printf("alerts: ignoring event rule without event")
+			continue
+		}
+		valid = append(valid, rule)
+	}
+
+	m.mu.Lock()
+	m.rules = valid
+	m.mu.Unlock()
+}
+
+// WatchContainers evaluates container rules on every Docker refresh until
+// Stop is called.
+func (m *Manager) WatchContainers(b *collector.Broadcaster[[]collector.ContainerStats]) {
+	ch, cleanup := b.Subscribe(2)
+	go func() {
+		defer cleanup()
+		for {
+			select {
+			case containers := <-ch:
+				m.EvaluateContainers(containers)
+			case <-m.stopCh:
+				return
+			}
+		}
+	}()
+}
+
+// EvaluateContainers fires alerts for containers matching a rule and
+// resolves container alerts whose condition has cleared.
+func (m *Manager) EvaluateContainers(containers []collector.ContainerStats) {
+	m.mu.Lock()
+	rules := m.rules
+	m.mu.Unlock()
+
+	firing := make(map[string]bool)
+	for _, rule := range rules {
+		for _, c := range containers {
+			if !matchContainer(rule.Container, c.Name) {
+				continue
+			}
+			alert, ok := evaluateContainerRule(rule, c)
+			if !ok {
+				continue
+			}
+			firing[alert.ID] = true
+			m.Fire(alert)
+		}
+	}
+
+	for _, a := range m.Active() {
+		if containerRuleTypes[a.Type] && !firing[a.ID] {
+			m.Resolve(a.ID)
+		}
+	}
+}
+
+func evaluateContainerRule(rule config.AlertRule, c collector.ContainerStats) (Alert, bool) {
+	severity := rule.Severity
+	if severity == "" {
+		severity = SeverityWarning
+	}
+	alert := Alert{
+		ID:       rule.Type + ":" + c.Name,
+		Type:     rule.Type,
+		Severity: severity,
+		Source:   "container:" + c.Name,
+	}
+
+	switch rule.Type {
+	case RuleContainerFlapping:
+		flapping := c.Flapping
+		if rule.Threshold > 0 {
+			flapping = c.RecentRestarts >= rule.Threshold
+		}
+		if !flapping {
+			return alert, false
+		}
+		alert.Message = fmt.Sprintf("%s is in a restart loop (%d restarts in the last 10 minutes)", c.Name, c.RecentRestarts)
+	default:
+		return alert, false
+	}
+	return alert, true
+}
+
+// WatchDockerEvents raises a container_oom alert for each Docker oom event
+// and resolves it once its duration has passed, until Stop is called.
+func (m *Manager) WatchDockerEvents(b *collector.Broadcaster[collector.DockerEvent]) {
+	ch, cleanup := b.Subscribe(16)
+	go func() {
+		defer cleanup()
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+		for {
+			select {
+			case ev := <-ch:
+				m.EvaluateDockerEvent(ev)
+			case now := <-ticker.C:
+				m.expireEventAlerts(now)
+			case <-m.stopCh:
+				return
+			}
+		}
+	}()
+}
+
+// EvaluateDockerEvent fires one container_oom alert per oom event, for
+// each rule whose container glob matches. The alert ID carries the event
+// time, so a second kill is a second alert.
+func (m *Manager) EvaluateDockerEvent(ev collector.DockerEvent) {
+	if ev.Action != "oom" {
+		return
+	}
+
+	m.mu.Lock()
+	rules := m.rules
+	m.mu.Unlock()
+
+	for _, rule := range rules {
+		if rule.Type != RuleContainerOOM || !matchContainer(rule.Container, ev.Name) {
+			continue
+		}
+		severity := rule.Severity
+		if severity == "" {
+			severity = SeverityWarning
+		}
+		duration := rule.Duration
+		if duration <= 0 {
+			duration = defaultEventAlertDuration
+		}
+		id := fmt.Sprintf("%s:%s:%d", RuleContainerOOM, ev.Name, ev.Time.UnixNano())
+		m.mu.Lock()
+		m.eventExpiry[id] = time.Now().Add(duration)
+		m.mu.Unlock()
+
+		m.Fire(Alert{
+			ID:       id,
+			Type:     RuleContainerOOM,
+			Severity: severity,
+			Source:   "container:" + ev.Name,
+			Message:  fmt.Sprintf("%s was killed by the OOM killer", ev.Name),
+		})
+	}
+}
+
+// matchContainer matches a container name against a rule glob; empty
+// matches everything.
+func matchContainer(pattern, name string) bool {
+	if pattern == "" || pattern == "*" {
+		return true
+	}
+	ok, err := path.Match(pattern, name)
+	return (err == nil && ok) || strings.EqualFold(pattern, name)
+}
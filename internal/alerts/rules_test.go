@@ -0,0 +1,178 @@
+package alerts
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/neur0map/deskmon-agent/internal/collector"
+	"github.com/neur0map/deskmon-agent/internal/config"
+	"github.com/neur0map/deskmon-agent/internal/custom"
+)
+
+func TestContainerOOMFromDockerEvents(t *testing.T) {
+	m := NewManager()
+	m.SetRules([]config.AlertRule{{Type: RuleContainerOOM, Container: "db*"}})
+
+	t0 := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	m.EvaluateDockerEvent(collector.DockerEvent{Time: t0, Action: "oom", Name: "db"})
+	m.EvaluateDockerEvent(collector.DockerEvent{Time: t0.Add(time.Minute), Action: "oom", Name: "db"})
+	m.EvaluateDockerEvent(collector.DockerEvent{Time: t0, Action: "die", Name: "db"})
+	m.EvaluateDockerEvent(collector.DockerEvent{Time: t0, Action: "oom", Name: "web"})
+	if n := len(m.Active()); n != 2 {
+		t.Fatalf("%d active alerts, want one per oom event on db", n)
+	}
+
+	// A refresh where Docker still reports OOMKilled, or no longer does after
+	// a restart, neither fires nor resolves anything.
+	m.EvaluateContainers([]collector.ContainerStats{{Name: "db", OOMKilled: true}})
+	if n := len(m.Active()); n != 2 {
+		t.Fatalf("%d active alerts after a refresh, want 2", n)
+	}
+
+	m.expireEventAlerts(time.Now().Add(2 * defaultEventAlertDuration))
+	if n := len(m.Active()); n != 0 {
+		t.Errorf("%d active alerts after their duration, want 0", n)
+	}
+}
+
+func TestSetRules(t *testing.T) {
+	above := 1.0
+	tests := []struct {
+		name  string
+		rules []config.AlertRule
+		want  []string // rule types kept, in order
+	}{
+		{"none uses defaults", nil, ruleTypes(DefaultRules)},
+		{"configured rules replace defaults", []config.AlertRule{{Type: RuleThermal, Threshold: 85}}, []string{RuleThermal}},
+		{"unknown type dropped", []config.AlertRule{{Type: "disk_full"}, {Type: RuleRAID}}, []string{RuleRAID}},
+		{"custom_metric without bound dropped", []config.AlertRule{{Type: RuleCustomMetric, Metric: "x"}, {Type: RuleCustomMetric, Metric: "x", Above: &above}}, []string{RuleCustomMetric}},
+		{"event without pattern dropped", []config.AlertRule{{Type: RuleEvent}, {Type: RuleEvent, Event: "backup.*"}}, []string{RuleEvent}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewManager()
+			m.SetRules(tt.rules)
+			if got := ruleTypes(m.rules); !slices.Equal(got, tt.want) {
+				t.Errorf("rules = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func ruleTypes(rules []config.AlertRule) []string {
+	types := make([]string, len(rules))
+	for i, r := range rules {
+		types[i] = r.Type
+	}
+	return types
+}
+
+func TestContainerFlappingRule(t *testing.T) {
+	tests := []struct {
+		name         string
+		rule         config.AlertRule
+		container    collector.ContainerStats
+		wantSeverity string // empty when the rule shouldn't fire
+	}{
+		{"collector flag", config.AlertRule{Type: RuleContainerFlapping}, collector.ContainerStats{Name: "web", Flapping: true, RecentRestarts: 3}, SeverityWarning},
+		{"not flapping", config.AlertRule{Type: RuleContainerFlapping}, collector.ContainerStats{Name: "web", RecentRestarts: 2}, ""},
+		{"threshold reached", config.AlertRule{Type: RuleContainerFlapping, Threshold: 5}, collector.ContainerStats{Name: "web", RecentRestarts: 5}, SeverityWarning},
+		{"threshold overrides flag", config.AlertRule{Type: RuleContainerFlapping, Threshold: 5}, collector.ContainerStats{Name: "web", Flapping: true, RecentRestarts: 4}, ""},
+		{"severity", config.AlertRule{Type: RuleContainerFlapping, Severity: SeverityCritical}, collector.ContainerStats{Name: "web", Flapping: true}, SeverityCritical},
+		{"glob matches", config.AlertRule{Type: RuleContainerFlapping, Container: "web*"}, collector.ContainerStats{Name: "web-1", Flapping: true}, SeverityWarning},
+		{"glob excludes", config.AlertRule{Type: RuleContainerFlapping, Container: "db*"}, collector.ContainerStats{Name: "web", Flapping: true}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewManager()
+			m.SetRules([]config.AlertRule{tt.rule})
+			m.EvaluateContainers([]collector.ContainerStats{tt.container})
+			active := m.Active()
+			switch {
+			case tt.wantSeverity == "" && len(active) != 0:
+				t.Errorf("fired %+v, want nothing", active)
+			case tt.wantSeverity != "" && (len(active) != 1 || active[0].Severity != tt.wantSeverity):
+				t.Errorf("active = %+v, want one %s alert", active, tt.wantSeverity)
+			}
+
+			// The alert resolves once the container settles.
+			m.EvaluateContainers([]collector.ContainerStats{{Name: tt.container.Name}})
+			if n := len(m.Active()); n != 0 {
+				t.Errorf("%d alerts still active after the container settled", n)
+			}
+		})
+	}
+}
+
+func TestKernelLimitsThresholdAndRefire(t *testing.T) {
+	tests := []struct {
+		name      string
+		threshold int
+		openFiles uint64 // of 1000
+		want      bool
+	}{
+		{"default below", 0, 899, false},
+		{"default at", 0, 900, true},
+		{"custom below", 80, 799, false},
+		{"custom at", 80, 800, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewManager()
+			m.SetRules([]config.AlertRule{{Type: RuleKernelLimits, Threshold: tt.threshold}})
+			m.EvaluateSystem(time.Now(), collector.SystemStats{Limits: collector.KernelLimits{OpenFiles: tt.openFiles, MaxFiles: 1000}})
+			if got := len(m.Active()) == 1; got != tt.want {
+				t.Errorf("fired = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// While over the limit the message is refreshed at most once a minute.
+	m := NewManager()
+	m.SetRules([]config.AlertRule{{Type: RuleKernelLimits}})
+	limits := func(open uint64) collector.SystemStats {
+		return collector.SystemStats{Limits: collector.KernelLimits{OpenFiles: open, MaxFiles: 1000}}
+	}
+	t0 := time.Now()
+	m.EvaluateSystem(t0, limits(950))
+	first := m.Active()[0].Message
+	m.EvaluateSystem(t0.Add(30*time.Second), limits(960))
+	if got := m.Active()[0].Message; got != first {
+		t.Errorf("refired within the interval: %q", got)
+	}
+	m.EvaluateSystem(t0.Add(limitsRefireInterval), limits(970))
+	if got := m.Active()[0].Message; got == first {
+		t.Error("not refired after the interval")
+	}
+	m.EvaluateSystem(t0.Add(2*limitsRefireInterval), limits(100))
+	if n := len(m.Active()); n != 0 {
+		t.Errorf("%d alerts active below the threshold, want 0", n)
+	}
+}
+
+func TestCustomMetricBreach(t *testing.T) {
+	lo, hi := 10.0, 90.0
+	tests := []struct {
+		name  string
+		above *float64
+		below *float64
+		value float64
+		want  bool
+	}{
+		{"above bound", &hi, nil, 91, true},
+		{"at upper bound", &hi, nil, 90, false},
+		{"below bound", nil, &lo, 9, true},
+		{"at lower bound", nil, &lo, 10, false},
+		{"inside band", &hi, &lo, 50, false},
+		{"outside band", &hi, &lo, 5, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule := config.AlertRule{Type: RuleCustomMetric, Metric: "ups_load", Above: tt.above, Below: tt.below}
+			if _, got := customMetricBreach(rule, custom.Metric{Name: "ups_load", Value: tt.value}); got != tt.want {
+				t.Errorf("breach = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package alerts
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/neur0map/deskmon-agent/internal/collector"
+	"github.com/neur0map/deskmon-agent/internal/config"
+)
+
+const (
+	defaultThermalDuration = time.Minute
+	thermalRefireInterval  = time.Minute // how often an active alert's duration is updated
+)
+
+// thermalEpisode is one continuous period in which a thermal rule's
+// condition held.
+type thermalEpisode struct {
+	since     time.Time
+	lastFired time.Time
+}
+
+// WatchSystem evaluates thermal, kernel_limits and raid rules on every
+// system sample until Stop is called.
+func (m *Manager) WatchSystem(b *collector.Broadcaster[collector.SystemEvent]) {
+	ch, cleanup := b.Subscribe(2)
+	go func() {
+		defer cleanup()
+		for {
+			select {
+			case ev := <-ch:
+				m.EvaluateSystem(time.Now(), ev.System)
+			case <-m.stopCh:
+				return
+			}
+		}
+	}()
+}
+
+// EvaluateSystem checks kernel_limits and raid rules (see evaluateLimits
+// and evaluateRAID) and fires a thermal alert once a rule's condition
+// (temperature at or above the rule's threshold, or CPU throttling when
+// the rule watches it) has held
+// for its duration, updates it with the running duration, and resolves it
+// when the condition clears.
+func (m *Manager) EvaluateSystem(now time.Time, sys collector.SystemStats) {
+	m.mu.Lock()
+	rules := m.rules
+	m.mu.Unlock()
+
+	for _, rule := range rules {
+		if rule.Type == RuleKernelLimits {
+			m.evaluateLimits(now, rule, sys.Limits)
+			continue
+		}
+		if rule.Type == RuleRAID {
+			m.evaluateRAID(now, rule, sys.RAID)
+			continue
+		}
+		if rule.Type != RuleThermal {
+			continue
+		}
+		id := thermalAlertID(rule)
+		if !thermalCondition(rule, sys.CPU) {
+			m.mu.Lock()
+			_, tracked := m.thermal[id]
+			delete(m.thermal, id)
+			m.mu.Unlock()
+			if tracked {
+				m.Resolve(id)
+			}
+			continue
+		}
+
+		m.mu.Lock()
+		ep, ok := m.thermal[id]
+		if !ok {
+			ep = &thermalEpisode{since: now}
+			m.thermal[id] = ep
+		}
+		sustained := now.Sub(ep.since)
+		due := sustained >= thermalDuration(rule) && now.Sub(ep.lastFired) >= thermalRefireInterval
+		if due {
+			ep.lastFired = now
+		}
+		m.mu.Unlock()
+
+		if due {
+			m.Fire(thermalAlert(rule, id, sys.CPU, sustained))
+		}
+	}
+}
+
+func thermalAlertID(rule config.AlertRule) string {
+	if rule.Threshold > 0 {
+		return fmt.Sprintf("%s:%dC", RuleThermal, rule.Threshold)
+	}
+	return RuleThermal + ":throttling"
+}
+
+func thermalDuration(rule config.AlertRule) time.Duration {
+	if rule.Duration > 0 {
+		return rule.Duration
+	}
+	return defaultThermalDuration
+}
+
+// watchesThrottling reports whether rule fires on CPU throttling: rules
+// without a threshold, and threshold rules that set throttling.
+func watchesThrottling(rule config.AlertRule) bool {
+	return rule.Threshold <= 0 || rule.Throttling
+}
+
+func thermalCondition(rule config.AlertRule, cpu collector.CPUStats) bool {
+	if cpu.Throttled && watchesThrottling(rule) {
+		return true
+	}
+	return rule.Threshold > 0 && cpu.TemperatureAvailable && cpu.Temperature >= float64(rule.Threshold)
+}
+
+func thermalAlert(rule config.AlertRule, id string, cpu collector.CPUStats, sustained time.Duration) Alert {
+	severity := rule.Severity
+	if severity == "" {
+		severity = SeverityWarning
+	}
+
+	var msg string
+	if cpu.Throttled && watchesThrottling(rule) {
+		msg = fmt.Sprintf("CPU throttled (%s) for %s", cpu.ThrottleReason, sustained.Round(time.Second))
+	} else {
+		msg = fmt.Sprintf("CPU at or above %d°C for %s", rule.Threshold, sustained.Round(time.Second))
+	}
+	if cpu.TemperatureAvailable {
+		msg += fmt.Sprintf(", currently %.1f°C", cpu.Temperature)
+	}
+
+	return Alert{
+		ID:       id,
+		Type:     RuleThermal,
+		Severity: severity,
+		Source:   "host",
+		Message:  msg,
+	}
+}
@@ -0,0 +1,39 @@
+package alerts
+
+import (
+	"testing"
+	"time"
+
+	"github.com/neur0map/deskmon-agent/internal/collector"
+	"github.com/neur0map/deskmon-agent/internal/config"
+)
+
+func TestThermalRuleFiresOnThrottlingOnlyWhenAsked(t *testing.T) {
+	throttled := collector.CPUStats{Throttled: true, ThrottleReason: "thermal_throttle", Temperature: 60, TemperatureAvailable: true}
+	hot := collector.CPUStats{Temperature: 90, TemperatureAvailable: true}
+
+	tests := []struct {
+		name string
+		rule config.AlertRule
+		cpu  collector.CPUStats
+		want bool
+	}{
+		{"no threshold, throttled", config.AlertRule{Type: RuleThermal}, throttled, true},
+		{"threshold, throttled", config.AlertRule{Type: RuleThermal, Threshold: 85}, throttled, false},
+		{"threshold and throttling, throttled", config.AlertRule{Type: RuleThermal, Threshold: 85, Throttling: true}, throttled, true},
+		{"threshold, hot", config.AlertRule{Type: RuleThermal, Threshold: 85}, hot, true},
+		{"no threshold, under voltage", config.AlertRule{Type: RuleThermal}, collector.CPUStats{UnderVoltage: true}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewManager()
+			m.SetRules([]config.AlertRule{tt.rule})
+			t0 := time.Now()
+			m.EvaluateSystem(t0, collector.SystemStats{CPU: tt.cpu})
+			m.EvaluateSystem(t0.Add(2*time.Minute), collector.SystemStats{CPU: tt.cpu})
+			if got := len(m.Active()) == 1; got != tt.want {
+				t.Errorf("fired = %v, want %v (active %+v)", got, tt.want, m.Active())
+			}
+		})
+	}
+}
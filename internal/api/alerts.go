@@ -0,0 +1,7 @@
+package api
+
+import "net/http"
+
+func (s *Server) handleAlerts(w http.ResponseWriter, r *http.Request) {
+	writeData(w, r, map[string]interface{}{"alerts": s.alerts.Active()})
+}
@@ -0,0 +1,206 @@
+package api
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/neur0map/deskmon-agent/internal/config"
+	"github.com/neur0map/deskmon-agent/internal/events"
+)
+
+// bearerToken extracts the token from an "Authorization: Bearer" header.
+func bearerToken(r *http.Request) string {
+	auth := r.Header.Get("Authorization")
+	if len(auth) > 7 && strings.EqualFold(auth[:7], "bearer ") {
+		return strings.TrimSpace(auth[7:])
+	}
+	return ""
+}
+
+// validToken reports whether the request carries a configured token.
+// Always false when no token is configured.
+func (s *Server) validToken(r *http.Request) bool {
+	_, scope, _ := s.requestIdentity(r)
+	return scope != ""
+}
+
+// requestIdentity authenticates r by its bearer token or, on the stream
+// endpoints where clients can't set headers (SSE, long-poll, WebSocket), a
+// session token in the access_token query parameter. Configured tokens are
+// never accepted from the URL.
+func (s *Server) requestIdentity(r *http.Request) (name, scope string, policy []config.PolicyRule) {
+	if token := bearerToken(r); token != "" {
+		return s.lookupToken(token)
+	}
+	if r.Method != http.MethodGet || !isStreamPath(r.URL.Path) {
+		return "", "", nil
+	}
+	if token := r.URL.Query().Get("access_token"); token != "" {
+		return s.lookupSession(token)
+	}
+	return "", "", nil
+}
+
+// tokenScope looks a presented token up among auth_token, which is an admin
+// token named "default", tokens and sessions issued from them. It returns
+// the token's name and scope, or empty strings when nothing matches.
+func (s *Server) tokenScope(token string) (name, scope string) {
+	name, scope, _ = s.lookupToken(token)
+	return name, scope
+}
+
+// lookupToken is tokenScope that also returns the token's policy.
+func (s *Server) lookupToken(token string) (name, scope string, policy []config.PolicyRule) {
+	if name, scope, policy = s.lookupSession(token); scope != "" {
+		return name, scope, policy
+	}
+	index, ok := s.matchToken(token)
+	switch {
+	case !ok:
+		return "", "", nil
+	case index == -1:
+		return "default", config.ScopeAdmin, nil
+	}
+	t := s.cfg.Tokens[index]
+	return tokenName(t, index), t.Scope, t.Policy
+}
+
+// matchToken finds a configured token: -1 for auth_token, i for tokens[i].
+// Every configured token is compared in constant time, so the timing
+// doesn't tell which one came close.
+func (s *Server) matchToken(token string) (index int, ok bool) {
+	if token == "" {
+		return 0, false
+	}
+	if s.cfg.AuthToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(s.cfg.AuthToken)) == 1 {
+		index, ok = -1, true
+	}
+	for i, t := range s.cfg.Tokens {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(t.Token)) == 1 {
+			index, ok = i, true
+		}
+	}
+	return index, ok
+}
+
+// tokenName is how tokens[i] appears in logs: its name, or "tokens[i]".
+func tokenName(t config.TokenConfig, i int) string {
+	if t.Name != "" {
+		return t.Name
+	}
+	return fmt.Sprintf("tokens[%d]", i)
+}
+
+// routeActions names the policy action of each route a policy can allow or
+// deny; see config.PolicyActions.
+var routeActions = map[string]string{
+	"POST /agent/restart":                 "agent.restart",
+	"POST /agent/stop":                    "agent.stop",
+	"POST /containers/{id}/start":         "container.start",
+	"POST /containers/{id}/stop":          "container.stop",
+	"POST /containers/{id}/restart":       "container.restart",
+	"POST /processes/{pid}/kill":          "process.kill",
+	"POST /services/{pluginId}/configure": "service.configure",
+	"POST /services/{pluginId}/action":    "service.action",
+	"POST /fans/{id}":                     "fan.set",
+	"PUT /layout":                         "layout.save",
+	"POST /custom-metrics":                "metrics.push",
+	"GET /debug/bundle":                   "debug.bundle",
+	"GET /logs/journal":                   "logs.journal",
+}
+
+// policyAllows applies a token's policy to action. containerID is the
+// container a container action targets; its name and labels come from the
+// last Docker refresh.
+func (s *Server) policyAllows(policy []config.PolicyRule, action, containerID string) bool {
+	if len(policy) == 0 {
+		return true
+	}
+	var container string
+	var labels map[string]string
+	if strings.HasPrefix(action, "container.") {
+		container, labels, _ = s.docker.ContainerLabels(containerID)
+	}
+	return config.PolicyAllows(policy, action, container, labels)
+}
+
+// routeAction returns the policy action of the route serving r, and the
+// container ID for container routes. The action is empty for routes
+// policies don't cover.
+func (s *Server) routeAction(r *http.Request) (action, containerID string) {
+	if s.mux == nil {
+		return "", ""
+	}
+	_, pattern := s.mux.Handler(r)
+	action = routeActions[pattern]
+	if strings.HasPrefix(action, "container.") {
+		// /containers/{id}/<verb>; path values aren't set before routing.
+		if parts := strings.Split(r.URL.Path, "/"); len(parts) == 4 {
+			containerID = parts[2]
+		}
+	}
+	return action, containerID
+}
+
+// routeScope is the token scope the route serving r needs: the one it was
+// registered with via handleScoped, read-only otherwise.
+func (s *Server) routeScope(r *http.Request) string {
+	if s.mux != nil {
+		if _, pattern := s.mux.Handler(r); s.routeScopes[pattern] != "" {
+			return s.routeScopes[pattern]
+		}
+	}
+	return config.ScopeReadOnly
+}
+
+// authMiddleware enforces auth_token and tokens when configured, including
+// each route's scope and the token's policy. /health stays open so clients can detect the agent
+// before they have credentials. Repeated failures ban the IP with
+// exponential backoff; banned IPs get 429 even for correct tokens until the
+// ban expires. A valid token without the route's scope, or whose policy
+// denies the action, gets 403 and doesn't count as a failure.
+func (s *Server) authMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// /events/ingest authenticates senders by HMAC signature instead.
+		if !s.cfg.AuthEnabled() || r.URL.Path == "/health" || r.URL.Path == "/events/ingest" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ip := clientIP(r)
+		if remaining := s.lockout.banned(ip); remaining > 0 {
+			s.rejectRateLimited(w, r, ip, remaining)
+			return
+		}
+
+		name, scope, policy := s.requestIdentity(r)
+		if scope == "" {
+			s.recordAuthFailure(r, ip)
+			logf(r, "auth failed for %s on %s %s", ip, r.Method, r.URL.Path)
+			w.Header().Set("WWW-Authenticate", `Bearer realm="deskmon"`)
+			writeError(w, r, http.StatusUnauthorized, codeUnauthorized, "unauthorized")
+			return
+		}
+
+		s.lockout.succeed(ip)
+		if s.logins.seen(ip, time.Now()) {
+			s.recordEvent(events.CategoryAuth, "auth.login", "client:"+ip, events.SeverityInfo, fmt.Sprintf("%s authenticated", ip))
+		}
+
+		if required := s.routeScope(r); !config.ScopeAllows(scope, required) {
+			logf(r, "token %s (%s) from %s may not call %s %s", name, scope, ip, r.Method, r.URL.Path)
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="deskmon", error="insufficient_scope", scope=%q`, required))
+			writeError(w, r, http.StatusForbidden, codeInsufficientScope, fmt.Sprintf("this endpoint needs a %s token", required))
+			return
+		}
+		if action, containerID := s.routeAction(r); action != "" && !s.policyAllows(policy, action, containerID) {
+			logf(r, "token %s from %s: policy denies %s %s", name, ip, action, containerID)
+			writeError(w, r, http.StatusForbidden, codePolicyDenied, fmt.Sprintf("this token's policy doesn't allow %s", action))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,95 @@
+package api
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"runtime"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/neur0map/deskmon-agent/internal/collector"
+)
+
+type bundleVersion struct {
+	Version       string    `json:"version"`
+	GoVersion     string    `json:"goVersion"`
+	OS            string    `json:"os"`
+	Arch          string    `json:"arch"`
+	StartedAt     time.Time `json:"startedAt"`
+	UptimeSeconds int64     `json:"uptimeSeconds"`
+	GeneratedAt   time.Time `json:"generatedAt"`
+}
+
+// handleDebugBundle returns a zip with everything a bug report needs:
+// version, current stats, service detection debug info, Docker status,
+// active alerts, recent agent logs and the effective config with
+// credentials redacted.
+func (s *Server) handleDebugBundle(w http.ResponseWriter, r *http.Request) {
+	now := time.Now()
+	logf(r, "debug bundle requested from %s", clientIP(r))
+
+	config, err := yaml.Marshal(s.cfg.Redacted())
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, codeInternal, "failed to encode config")
+		return
+	}
+
+	var logs []string
+	if s.logs != nil {
+		logs = s.logs.Lines()
+	}
+
+	files := []struct {
+		name string
+		data any
+	}{
+		{"version.json", bundleVersion{
+			Version:       s.version,
+			GoVersion:     runtime.Version(),
+			OS:            runtime.GOOS,
+			Arch:          runtime.GOARCH,
+			StartedAt:     s.started,
+			UptimeSeconds: int64(now.Sub(s.started).Seconds()),
+			GeneratedAt:   now,
+		}},
+		{"environment.json", collector.HostEnvironment()},
+		{"stats.json", s.statsSnapshot()},
+		{"services-debug.json", s.services.DebugInfo()},
+		{"docker-status.json", s.docker.Status()},
+		{"docker-capabilities.json", s.docker.Capabilities()},
+		{"alerts.json", s.alerts.Active()},
+		{"config.yaml", config},
+		{"agent.log", []byte(strings.Join(logs, "\n") + "\n")},
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="deskmon-bundle-%s.zip"`, now.UTC().Format("20060102-150405")))
+
+	zw := zip.NewWriter(w)
+	for _, f := range files {
+		fw, err := zw.CreateHeader(&zip.FileHeader{Name: f.name, Method: zip.Deflate, Modified: now})
+		if err != nil {
+			logf(r, "debug bundle: %v", err)
+			return
+		}
+		switch data := f.data.(type) {
+		case []byte:
+			_, err = fw.Write(data)
+		default:
+			enc := json.NewEncoder(fw)
+			enc.SetIndent("", "  ")
+			err = enc.Encode(data)
+		}
+		if err != nil {
+			logf(r, "debug bundle: writing %s: %v", f.name, err)
+			return
+		}
+	}
+	if err := zw.Close(); err != nil {
+		logf(r, "debug bundle: %v", err)
+	}
+}
@@ -0,0 +1,113 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	confirmTTL    = 30 * time.Second
+	confirmHeader = "X-Deskmon-Confirm"
+)
+
+// confirmation is the token a destructive request must be repeated with.
+type confirmation struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+type pendingConfirmation struct {
+	route   string // method and path, e.g. "POST /containers/abc/stop"
+	client  string // token name, or IP without auth
+	expires time.Time
+}
+
+// confirmations holds the outstanding tokens of confirm_destructive. Each
+// is good for one repeat of the same request by the same client.
+type confirmations struct {
+	mu      sync.Mutex
+	pending map[string]pendingConfirmation
+}
+
+func newConfirmations() *confirmations {
+	return &confirmations{pending: make(map[string]pendingConfirmation)}
+}
+
+func (c *confirmations) issue(route, client string, now time.Time) confirmation {
+	b := make([]byte, 16)
+	rand.Read(b)
+	conf := confirmation{Token: hex.EncodeToString(b), ExpiresAt: now.Add(confirmTTL).UTC()}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for token, p := range c.pending {
+		if now.After(p.expires) {
+			delete(c.pending, token)
+		}
+	}
+	c.pending[conf.Token] = pendingConfirmation{route: route, client: client, expires: conf.ExpiresAt}
+	return conf
+}
+
+// redeem consumes token if it was issued for this request and hasn't
+// expired.
+func (c *confirmations) redeem(token, route, client string, now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	p, ok := c.pending[token]
+	if !ok {
+		return false
+	}
+	delete(c.pending, token)
+	return p.route == route && p.client == client && !now.After(p.expires)
+}
+
+// confirmGuard makes a destructive endpoint answer 428 with a confirmation
+// token when confirm_destructive is set. The action runs when the client
+// repeats the request with the token in X-Deskmon-Confirm within 30
+// seconds, so a stray tap in an app can't stop or kill anything by itself.
+func (s *Server) confirmGuard(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !s.cfg.ConfirmDestructive || s.confirmed(w, r, r.Method+" "+r.URL.Path) {
+			next(w, r)
+		}
+	}
+}
+
+// confirmed reports whether r carries a confirmation token issued for
+// route. Otherwise it answers 428 with a fresh one and returns false.
+func (s *Server) confirmed(w http.ResponseWriter, r *http.Request, route string) bool {
+	client, _, _ := s.requestIdentity(r)
+	if client == "" {
+		client = clientIP(r)
+	}
+	now := time.Now()
+	token := r.Header.Get(confirmHeader)
+	if token != "" && s.confirms.redeem(token, route, client, now) {
+		return true
+	}
+
+	msg := fmt.Sprintf("confirm by repeating the request with %s within %s", confirmHeader, confirmTTL)
+	if token != "" {
+		msg = "confirmation token expired or not issued for this request; " + msg
+	}
+	writeConfirmationRequired(w, r, s.confirms.issue(route, client, now), msg)
+	return false
+}
+
+// writeConfirmationRequired is writeError for 428 confirmation_required,
+// with the token alongside the error.
+func writeConfirmationRequired(w http.ResponseWriter, r *http.Request, conf confirmation, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusPreconditionRequired)
+	if wantsEnvelope(r) {
+		json.NewEncoder(w).Encode(envelopeResponse{Error: &apiError{Code: codeConfirmationRequired, Message: message, RequestID: requestID(r), Confirm: &conf}})
+		return
+	}
+	json.NewEncoder(w).Encode(legacyErrorResponse{Error: message, Code: codeConfirmationRequired, RequestID: requestID(r), Confirm: &conf})
+}
@@ -1,122 +1,96 @@
+//go:build !nodocker
+
 package api
 
 import (
 	"context"
-	"encoding/json"
-	"log"
+	"errors"
 	"net/http"
 	"time"
 
+	cerrdefs "github.com/containerd/errdefs"
 	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/client"
+
+	"github.com/neur0map/deskmon-agent/internal/collector"
 )
 
-func (s *Server) handleContainerStart(w http.ResponseWriter, r *http.Request) {
-	id := r.PathValue("id")
-	if id == "" {
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{"error": "missing container id"})
-		return
+// containerAction starts, stops or restarts a container. Actions the Docker
+// endpoint is known to refuse fail up front with docker_denied instead of a
+// raw proxy error.
+func (s *Server) containerAction(ctx context.Context, action, id string) error {
+	if _, ok := containerActionMessages[action]; !ok {
+		return &containerActionError{http.StatusBadRequest, codeBadRequest, "unknown container action " + action}
 	}
-
-	log.Printf("container start requested for %s", id)
-
-	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
-	defer cancel()
-
-	cli, err := client.NewClientWithOpts(
-		client.WithHost("unix://"+s.dockerSocket),
-		client.WithAPIVersionNegotiation(),
-	)
-	if err != nil {
-		log.Printf("container start %s: docker client error: %v", id, err)
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
-		return
+	if id == "" {
+		return &containerActionError{http.StatusBadRequest, codeBadRequest, "missing container id"}
 	}
-	defer cli.Close()
-
-	if err := cli.ContainerStart(ctx, id, container.StartOptions{}); err != nil {
-		log.Printf("container start %s: error: %v", id, err)
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
-		return
+	if !s.cfg.Collectors.DockerEnabled() {
+		return &containerActionError{http.StatusServiceUnavailable, codeDockerUnavail, errDockerOff}
 	}
+	denied := &containerActionError{http.StatusForbidden, codeDockerDenied, "container " + action + " not permitted by the Docker endpoint"}
 
-	log.Printf("container start %s: success", id)
-	writeJSON(w, controlResponse{Message: "started"})
-}
-
-func (s *Server) handleContainerStop(w http.ResponseWriter, r *http.Request) {
-	id := r.PathValue("id")
-	if id == "" {
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{"error": "missing container id"})
-		return
+	caps := s.docker.Capabilities()
+	if ok, probed := caps.Actions[action]; probed && !ok {
+		return denied
 	}
 
-	log.Printf("container stop requested for %s", id)
-
-	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
 	defer cancel()
 
-	cli, err := client.NewClientWithOpts(
-		client.WithHost("unix://"+s.dockerSocket),
-		client.WithAPIVersionNegotiation(),
-	)
+	cli, err := collector.NewDockerClient(s.dockerSocket)
 	if err != nil {
-		log.Printf("container stop %s: docker client error: %v", id, err)
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
-		return
+		return &containerActionError{http.StatusInternalServerError, codeDockerUnavail, err.Error()}
 	}
 	defer cli.Close()
 
 	timeout := 10
-	if err := cli.ContainerStop(ctx, id, container.StopOptions{Timeout: &timeout}); err != nil {
-		log.Printf("container stop %s: error: %v", id, err)
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
-		return
+	switch action {
+	case "start":
+		err = cli.ContainerStart(ctx, id, container.StartOptions{})
+	case "stop":
+		err = cli.ContainerStop(ctx, id, container.StopOptions{Timeout: &timeout})
+	case "restart":
+		err = cli.ContainerRestart(ctx, id, container.StopOptions{Timeout: &timeout})
 	}
-
-	log.Printf("container stop %s: success", id)
-	writeJSON(w, controlResponse{Message: "stopped"})
-}
-
-func (s *Server) handleContainerRestart(w http.ResponseWriter, r *http.Request) {
-	id := r.PathValue("id")
-	if id == "" {
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{"error": "missing container id"})
-		return
+	switch {
+	case err == nil:
+		return nil
+	case cerrdefs.IsPermissionDenied(err):
+		s.docker.MarkActionBlocked(action)
+		return denied
+	case cerrdefs.IsNotFound(err):
+		return &containerActionError{http.StatusNotFound, codeNotFound, "container " + id + " not found"}
+	default:
+		return &containerActionError{http.StatusInternalServerError, codeDockerError, err.Error()}
 	}
+}
 
-	log.Printf("container restart requested for %s", id)
+func (s *Server) handleContainerStart(w http.ResponseWriter, r *http.Request) {
+	s.handleContainerAction(w, r, "start")
+}
 
-	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
-	defer cancel()
+func (s *Server) handleContainerStop(w http.ResponseWriter, r *http.Request) {
+	s.handleContainerAction(w, r, "stop")
+}
 
-	cli, err := client.NewClientWithOpts(
-		client.WithHost("unix://"+s.dockerSocket),
-		client.WithAPIVersionNegotiation(),
-	)
-	if err != nil {
-		log.Printf("container restart %s: docker client error: %v", id, err)
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
-		return
-	}
-	defer cli.Close()
+func (s *Server) handleContainerRestart(w http.ResponseWriter, r *http.Request) {
+	s.handleContainerAction(w, r, "restart")
+}
 
-	timeout := 10
-	if err := cli.ContainerRestart(ctx, id, container.StopOptions{Timeout: &timeout}); err != nil {
-		log.Printf("container restart %s: error: %v", id, err)
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+func (s *Server) handleContainerAction(w http.ResponseWriter, r *http.Request, action string) {
+	id := r.PathValue("id")
+	logf(r, "container %s requested for %s", action, id)
+
+	if err := s.containerAction(r.Context(), action, id); err != nil {
+		logf(r, "container %s %s: error: %v", action, id, err)
+		var ae *containerActionError
+		if !errors.As(err, &ae) {
+			ae = &containerActionError{http.StatusInternalServerError, codeInternal, err.Error()}
+		}
+		writeError(w, r, ae.status, ae.code, ae.msg)
 		return
 	}
 
-	log.Printf("container restart %s: success", id)
-	writeJSON(w, controlResponse{Message: "restarted"})
+	logf(r, "container %s %s: success", action, id)
+	writeData(w, r, controlResponse{Message: containerActionMessages[action]})
 }
@@ -0,0 +1,43 @@
+//go:build nodocker
+
+package api
+
+import (
+	"context"
+	"net/http"
+)
+
+// Builds with the nodocker tag keep the container routes registered so
+// clients get a clear error instead of a 404.
+
+func (s *Server) handleDockerDisabled(w http.ResponseWriter, r *http.Request) {
+	writeError(w, r, http.StatusNotImplemented, codeDockerUnavail, "agent built without Docker support")
+}
+
+func (s *Server) handleContainerStart(w http.ResponseWriter, r *http.Request) {
+	s.handleDockerDisabled(w, r)
+}
+
+func (s *Server) handleContainerStop(w http.ResponseWriter, r *http.Request) {
+	s.handleDockerDisabled(w, r)
+}
+
+func (s *Server) handleContainerRestart(w http.ResponseWriter, r *http.Request) {
+	s.handleDockerDisabled(w, r)
+}
+
+func (s *Server) handleContainerDetail(w http.ResponseWriter, r *http.Request) {
+	s.handleDockerDisabled(w, r)
+}
+
+func (s *Server) handleContainerHealth(w http.ResponseWriter, r *http.Request) {
+	s.handleDockerDisabled(w, r)
+}
+
+func (s *Server) handleTopology(w http.ResponseWriter, r *http.Request) {
+	s.handleDockerDisabled(w, r)
+}
+
+func (s *Server) containerAction(ctx context.Context, action, id string) error {
+	return &containerActionError{http.StatusNotImplemented, codeDockerUnavail, "agent built without Docker support"}
+}
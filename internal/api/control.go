@@ -5,29 +5,54 @@ import (
 	"net/http"
 	"strings"
 
+	"github.com/neur0map/deskmon-agent/internal/collector"
+	"github.com/neur0map/deskmon-agent/internal/events"
+	"github.com/neur0map/deskmon-agent/internal/memguard"
 	"github.com/neur0map/deskmon-agent/internal/systemctl"
 )
 
 type agentStatusResponse struct {
-	Version string `json:"version"`
-	Status  string `json:"status"`
+	Version            string                              `json:"version"`
+	Status             string                              `json:"status"`
+	ReadOnly           bool                                `json:"readOnly"`
+	ConfirmDestructive bool                                `json:"confirmDestructive"`
+	Broadcasts         map[string]collector.BroadcastStats `json:"broadcasts"`
+	Memory             *memguard.Status                    `json:"memory,omitempty"` // only with max_memory_mb
 }
 
 type controlResponse struct {
 	Message string `json:"message"`
 }
 
+// containerActionError is a failed container action with the API error it
+// maps to, shared by the HTTP handlers and gRPC.
+type containerActionError struct {
+	status int
+	code   string
+	msg    string
+}
+
+func (e *containerActionError) Error() string { return e.msg }
+
+// containerActionMessages are the success messages per action.
+var containerActionMessages = map[string]string{
+	"start":   "started",
+	"stop":    "stopped",
+	"restart": "restarted",
+}
+
 func (s *Server) handleAgentRestart(w http.ResponseWriter, r *http.Request) {
 	if err := systemctl.Restart(); err != nil {
 		if errors.Is(err, systemctl.ErrDockerMode) {
-			w.WriteHeader(http.StatusBadRequest)
-			writeJSON(w, map[string]string{"error": err.Error()})
+			writeError(w, r, http.StatusBadRequest, codeNotSupported, err.Error())
 			return
 		}
 	}
 
+	s.recordEvent(events.CategoryAgent, "agent.restart", "client:"+clientIP(r), events.SeverityInfo, "agent restart requested")
+
 	// Respond before restarting so the client gets a response
-	writeJSON(w, controlResponse{Message: "restarting"})
+	writeData(w, r, controlResponse{Message: "restarting"})
 
 	if f, ok := w.(http.Flusher); ok {
 		f.Flush()
@@ -37,14 +62,15 @@ func (s *Server) handleAgentRestart(w http.ResponseWriter, r *http.Request) {
 func (s *Server) handleAgentStop(w http.ResponseWriter, r *http.Request) {
 	if err := systemctl.Stop(); err != nil {
 		if errors.Is(err, systemctl.ErrDockerMode) {
-			w.WriteHeader(http.StatusBadRequest)
-			writeJSON(w, map[string]string{"error": err.Error()})
+			writeError(w, r, http.StatusBadRequest, codeNotSupported, err.Error())
 			return
 		}
 	}
 
+	s.recordEvent(events.CategoryAgent, "agent.stop", "client:"+clientIP(r), events.SeverityInfo, "agent stop requested")
+
 	// Respond before stopping so the client gets a response
-	writeJSON(w, controlResponse{Message: "stopping"})
+	writeData(w, r, controlResponse{Message: "stopping"})
 
 	if f, ok := w.(http.Flusher); ok {
 		f.Flush()
@@ -53,8 +79,39 @@ func (s *Server) handleAgentStop(w http.ResponseWriter, r *http.Request) {
 
 func (s *Server) handleAgentStatus(w http.ResponseWriter, r *http.Request) {
 	status, _ := systemctl.Status()
-	writeJSON(w, agentStatusResponse{
-		Version: s.version,
-		Status:  strings.TrimSpace(status),
+	writeData(w, r, agentStatusResponse{
+		Version:            s.version,
+		Status:             strings.TrimSpace(status),
+		ReadOnly:           s.cfg.ReadOnly,
+		ConfirmDestructive: s.cfg.ConfirmDestructive,
+		Broadcasts:         s.broadcastStats(),
+		Memory:             s.memoryStatus(),
 	})
 }
+
+func (s *Server) memoryStatus() *memguard.Status {
+	if s.memory == nil {
+		return nil
+	}
+	st := s.memory.Status()
+	return &st
+}
+
+// broadcastStats reports subscribers and drops per live stream, keyed by
+// SSE event name. Each open /stats/stream holds one subscriber on each.
+func (s *Server) broadcastStats() map[string]collector.BroadcastStats {
+	stats := map[string]collector.BroadcastStats{
+		"system":        s.system.Broadcast.Stats(),
+		"docker":        s.docker.Broadcast.Stats(),
+		"dockerStatus":  s.docker.StatusBroadcast.Stats(),
+		"docker-events": s.docker.EventBroadcast.Stats(),
+		"services":      s.services.Broadcast.Stats(),
+		"alert":         s.alerts.Broadcast.Stats(),
+		"customMetrics": s.custom.Broadcast.Stats(),
+		"event":         s.events.Broadcast.Stats(),
+	}
+	if s.updater != nil {
+		stats["update"] = s.updater.Broadcast.Stats()
+	}
+	return stats
+}
@@ -0,0 +1,89 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	defaultCORSMethods = []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodOptions}
+	defaultCORSHeaders = []string{"Authorization", "Content-Type", "If-Match", "X-Deskmon-Confirm"}
+)
+
+const defaultCORSMaxAge = 10 * time.Minute
+
+// corsOrigin returns the value for Access-Control-Allow-Origin, or "" when
+// origin is not allowed.
+func (s *Server) corsOrigin(origin string) string {
+	for _, allowed := range s.cfg.CORS.AllowedOrigins {
+		if allowed == "*" {
+			// Config validation rejects "*" with allow_credentials.
+			return "*"
+		}
+		if strings.EqualFold(strings.TrimRight(allowed, "/"), origin) {
+			return origin
+		}
+	}
+	return ""
+}
+
+// corsMiddleware adds CORS headers for allowed origins and answers
+// preflight requests directly. A no-op while cors.allowed_origins is empty.
+func (s *Server) corsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" || len(s.cfg.CORS.AllowedOrigins) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		cc := s.cfg.CORS
+		w.Header().Add("Vary", "Origin")
+		allowOrigin := s.corsOrigin(origin)
+
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+		if allowOrigin == "" {
+			if preflight {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("Access-Control-Allow-Origin", allowOrigin)
+		if cc.AllowCredentials {
+			w.Header().Set("Access-Control-Allow-Credentials", "true")
+		}
+
+		if !preflight {
+			if len(cc.ExposedHeaders) > 0 {
+				w.Header().Set("Access-Control-Expose-Headers", strings.Join(cc.ExposedHeaders, ", "))
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		methods := cc.AllowedMethods
+		if len(methods) == 0 {
+			methods = defaultCORSMethods
+		}
+		headers := cc.AllowedHeaders
+		if len(headers) == 0 {
+			headers = defaultCORSHeaders
+		}
+		maxAge := cc.MaxAge
+		if maxAge <= 0 {
+			maxAge = defaultCORSMaxAge
+		}
+
+		w.Header().Add("Vary", "Access-Control-Request-Method")
+		w.Header().Add("Vary", "Access-Control-Request-Headers")
+		w.Header().Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+		w.Header().Set("Access-Control-Allow-Headers", strings.Join(headers, ", "))
+		w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(maxAge.Seconds())))
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
@@ -0,0 +1,70 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/neur0map/deskmon-agent/internal/custom"
+)
+
+const maxCustomMetricsBody = 64 << 10
+
+// customMetricsRequest is either a batch ({"metrics": [...]}) or a single
+// metric at the top level. TTL is a Go duration, default 10m.
+type customMetricsRequest struct {
+	TTL     string          `json:"ttl,omitempty"`
+	Metrics []custom.Metric `json:"metrics,omitempty"`
+	custom.Metric
+}
+
+func (s *Server) handleCustomMetrics(w http.ResponseWriter, r *http.Request) {
+	writeData(w, r, map[string]interface{}{"metrics": s.custom.List()})
+}
+
+// handlePushCustomMetrics stores gauges/counters pushed by local scripts.
+// They then appear in /stats, the SSE stream, /metrics and alert rules.
+func (s *Server) handlePushCustomMetrics(w http.ResponseWriter, r *http.Request) {
+	var req customMetricsRequest
+	if !decodeBody(w, r, &req, false) {
+		return
+	}
+	metrics := req.Metrics
+	single := len(metrics) == 0 && req.Name != ""
+	if single {
+		metrics = []custom.Metric{req.Metric}
+	}
+	if len(metrics) == 0 {
+		writeFieldErrors(w, r, codeValidationFailed, []fieldError{{Field: "metrics", Message: "is required (or a single metric's name and value)"}})
+		return
+	}
+
+	var errs []fieldError
+	ttl := custom.DefaultTTL
+	if req.TTL != "" {
+		d, err := time.ParseDuration(req.TTL)
+		if err != nil || d <= 0 || d > custom.MaxTTL {
+			errs = append(errs, fieldError{Field: "ttl", Message: fmt.Sprintf("must be a duration up to %s, not %q", custom.MaxTTL, req.TTL)})
+		}
+		ttl = d
+	}
+	for i := range metrics {
+		if err := metrics[i].Validate(); err != nil {
+			field := fmt.Sprintf("metrics[%d]", i)
+			if single {
+				field = ""
+			}
+			errs = append(errs, fieldError{Field: field, Message: err.Error()})
+		}
+	}
+	if len(errs) > 0 {
+		writeFieldErrors(w, r, codeValidationFailed, errs)
+		return
+	}
+
+	if err := s.custom.Push("push", ttl, metrics); err != nil {
+		writeError(w, r, http.StatusBadRequest, codeBadRequest, err.Error())
+		return
+	}
+	writeData(w, r, controlResponse{Message: fmt.Sprintf("stored %d metrics", len(metrics))})
+}
@@ -0,0 +1,83 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/neur0map/deskmon-agent/internal/cbor"
+)
+
+// writeJSONCached writes data with an ETag derived from its encoding and
+// answers 304 Not Modified when the client already holds that version.
+// Snapshot endpoints use this: collectors refresh on fixed intervals, so
+// frequent pollers often re-request identical data (e.g. /stats/docker
+// between 5s refreshes).
+func writeJSONCached(w http.ResponseWriter, r *http.Request, data interface{}) {
+	enc, err := encodeSnapshot(r, data)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, codeInternal, "failed to encode response")
+		return
+	}
+	writeEncoded(w, r, enc)
+}
+
+// encodedResponse is a snapshot response body in the encoding the client
+// asked for, with its ETag.
+type encodedResponse struct {
+	body        []byte
+	etag        string
+	contentType string
+}
+
+func encodeSnapshot(r *http.Request, data interface{}) (*encodedResponse, error) {
+	enc := &encodedResponse{contentType: "application/json"}
+	var err error
+	if wantsCBOR(r) {
+		enc.contentType = cbor.ContentType
+		enc.body, err = cbor.Marshal(wrapData(r, data))
+	} else {
+		enc.body, err = json.Marshal(wrapData(r, data))
+		enc.body = append(enc.body, '\n') // match json.Encoder output
+	}
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(enc.body)
+	enc.etag = `"` + hex.EncodeToString(sum[:12]) + `"`
+	return enc, nil
+}
+
+func writeEncoded(w http.ResponseWriter, r *http.Request, enc *encodedResponse) {
+	if wantsCBOR(r) {
+		w.Header().Add("Vary", "Accept")
+	}
+	w.Header().Set("ETag", enc.etag)
+	// Revalidate every time rather than no-store, so clients may keep the
+	// body and send If-None-Match.
+	w.Header().Set("Cache-Control", "no-cache")
+
+	if etagMatches(r.Header.Get("If-None-Match"), enc.etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", enc.contentType)
+	w.Write(enc.body)
+}
+
+// etagMatches implements the If-None-Match weak comparison.
+func etagMatches(header, etag string) bool {
+	if header == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,291 @@
+package api
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/neur0map/deskmon-agent/internal/collector"
+	"github.com/neur0map/deskmon-agent/internal/events"
+)
+
+const (
+	maxEventIngestBody = 64 << 10
+	maxEventMessage    = 1024
+	defaultEventLimit  = 100
+)
+
+type eventsResponse struct {
+	Events   []events.Event `json:"events"`
+	LatestID uint64         `json:"latestId"` // pass as since= to poll for newer events
+}
+
+// handleEvents returns the activity timeline:
+// GET /events?since=<id or RFC 3339 time>&category=container,alert&limit=100
+//
+// At most limit events are returned, the most recent ones, oldest first.
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	var sinceID uint64
+	var sinceTime time.Time
+	if raw := q.Get("since"); raw != "" {
+		if id, err := strconv.ParseUint(raw, 10, 64); err == nil {
+			sinceID = id
+		} else if t, err := time.Parse(time.RFC3339, raw); err == nil {
+			sinceTime = t
+		} else {
+			writeError(w, r, http.StatusBadRequest, codeBadRequest, fmt.Sprintf("invalid since %q (event ID or RFC 3339 time)", raw))
+			return
+		}
+	}
+
+	limit := defaultEventLimit
+	if raw := q.Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > events.DefaultCapacity {
+			writeError(w, r, http.StatusBadRequest, codeBadRequest, fmt.Sprintf("invalid limit %q (1-%d)", raw, events.DefaultCapacity))
+			return
+		}
+		limit = n
+	}
+
+	var categories []string
+	if raw := q.Get("category"); raw != "" {
+		categories = strings.Split(raw, ",")
+	}
+
+	latest := s.events.LatestID()
+	list := s.events.Since(sinceID)
+	filtered := list[:0]
+	for _, ev := range list {
+		if ev.At.Before(sinceTime) || len(categories) > 0 && !slices.Contains(categories, ev.Category) {
+			continue
+		}
+		filtered = append(filtered, ev)
+	}
+	if len(filtered) > limit {
+		filtered = filtered[len(filtered)-limit:]
+	}
+	writeData(w, r, eventsResponse{Events: filtered, LatestID: latest})
+}
+
+type dockerEventsResponse struct {
+	Events []collector.DockerEvent `json:"events"`
+}
+
+// handleDockerEvents returns the container lifecycle events kept from the
+// Docker events API, oldest first; ?limit keeps only the most recent ones.
+func (s *Server) handleDockerEvents(w http.ResponseWriter, r *http.Request) {
+	list := s.docker.DockerEvents()
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 {
+			writeError(w, r, http.StatusBadRequest, codeBadRequest, fmt.Sprintf("invalid limit %q", raw))
+			return
+		}
+		if len(list) > n {
+			list = list[len(list)-n:]
+		}
+	}
+	writeData(w, r, dockerEventsResponse{Events: list})
+}
+
+// An ingested event is signed as "sha256=<hex HMAC of timestamp.body>" in
+// signatureHeader, with the Unix time in seconds in timestampHeader.
+const (
+	signatureHeader = "X-Deskmon-Signature"
+	timestampHeader = "X-Deskmon-Timestamp"
+)
+
+// ingestMaxSkew is how far a signed timestamp may be from the agent's
+// clock. Within it, each signature is accepted once.
+const ingestMaxSkew = 5 * time.Minute
+
+type eventIngestRequest struct {
+	Source   string          `json:"source" validate:"required"`
+	Type     string          `json:"type" validate:"required"`
+	Severity string          `json:"severity,omitempty" validate:"oneof=info warning critical"`
+	Message  string          `json:"message,omitempty"`
+	Time     *time.Time      `json:"time,omitempty"`
+	Data     json.RawMessage `json:"data,omitempty"`
+}
+
+// handleEventIngest stores a signed event pushed by another system (backup
+// software, CI, a router) in the timeline. The HMAC signature replaces the
+// bearer token, so senders only need the shared secret. The signed
+// timestamp and the replay guard stop a captured request being resent.
+func (s *Server) handleEventIngest(w http.ResponseWriter, r *http.Request) {
+	secret := s.cfg.Events.IngestSecret
+	if secret == "" {
+		writeError(w, r, http.StatusNotFound, codeNotFound, "event ingestion is disabled (set events.ingest_secret)")
+		return
+	}
+
+	// Bad signatures count toward the same lockout as bad tokens.
+	ip := clientIP(r)
+	if remaining := s.lockout.banned(ip); remaining > 0 {
+		s.rejectRateLimited(w, r, ip, remaining)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, r, http.StatusRequestEntityTooLarge, codeBadRequest, "request body too large")
+		return
+	}
+	sig, ok := validSignature(r, secret, body)
+	if !ok {
+		s.recordAuthFailure(r, ip)
+		logf(r, "event ingest: bad signature from %s", ip)
+		writeError(w, r, http.StatusUnauthorized, codeUnauthorized, "missing or invalid signature")
+		return
+	}
+	s.lockout.succeed(ip)
+	now := time.Now()
+	ts, _ := strconv.ParseInt(r.Header.Get(timestampHeader), 10, 64)
+	if skew := now.Sub(time.Unix(ts, 0)).Abs(); skew > ingestMaxSkew {
+		logf(r, "event ingest: timestamp from %s is %s off", ip, skew.Round(time.Second))
+		writeError(w, r, http.StatusUnauthorized, codeUnauthorized,
+			timestampHeader+" is missing or more than 5 minutes from the agent's clock")
+		return
+	}
+	if !s.ingestSeen.first(sig, now) {
+		logf(r, "event ingest: replayed signature from %s", ip)
+		writeError(w, r, http.StatusUnauthorized, codeUnauthorized, "request already received")
+		return
+	}
+
+	var req eventIngestRequest
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	if !decodeBody(w, r, &req, false) {
+		return
+	}
+	if req.Severity == "" {
+		req.Severity = events.SeverityInfo
+	}
+	req.Message = truncateUTF8(req.Message, maxEventMessage)
+
+	ev := events.Event{
+		Category: events.CategoryExternal,
+		Type:     req.Type,
+		Source:   req.Source,
+		Severity: req.Severity,
+		Message:  req.Message,
+		Data:     req.Data,
+	}
+	if req.Time != nil {
+		ev.At = *req.Time
+	}
+	ev = s.events.Add(ev)
+	writeData(w, r, ev)
+}
+
+// recordEvent adds an event raised by the API itself to the timeline.
+func (s *Server) recordEvent(category, typ, source, severity, msg string) {
+	s.events.Add(events.Event{
+		Category: category,
+		Type:     typ,
+		Source:   source,
+		Severity: severity,
+		Message:  msg,
+	})
+}
+
+// loginGap is how long a client must be idle before its next authenticated
+// request counts as a new login.
+const loginGap = time.Hour
+
+type loginTracker struct {
+	mu       sync.Mutex
+	lastSeen map[string]time.Time
+}
+
+// seen records activity from ip and reports whether it starts a new login.
+func (lt *loginTracker) seen(ip string, now time.Time) bool {
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+
+	if lt.lastSeen == nil {
+		lt.lastSeen = make(map[string]time.Time)
+	}
+	last, ok := lt.lastSeen[ip]
+	lt.lastSeen[ip] = now
+	if len(lt.lastSeen) > 1024 {
+		for k, t := range lt.lastSeen {
+			if now.Sub(t) > loginGap {
+				delete(lt.lastSeen, k)
+			}
+		}
+	}
+	return !ok || now.Sub(last) > loginGap
+}
+
+// validSignature checks the HMAC of the timestamp header, a dot and the
+// body, and returns the signature's hex.
+func validSignature(r *http.Request, secret string, body []byte) (string, bool) {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(r.Header.Get(timestampHeader) + "."))
+	mac.Write(body)
+
+	sig, ok := strings.CutPrefix(r.Header.Get(signatureHeader), "sha256=")
+	if !ok {
+		return "", false
+	}
+	got, err := hex.DecodeString(sig)
+	if err != nil || !hmac.Equal(got, mac.Sum(nil)) {
+		return "", false
+	}
+	return hex.EncodeToString(got), true
+}
+
+// replayGuard remembers accepted ingest signatures until their timestamp
+// leaves the ingestMaxSkew window.
+type replayGuard struct {
+	mu   sync.Mutex
+	seen map[string]time.Time // signature → when it can be forgotten
+}
+
+// first records sig and reports whether it had not been seen.
+func (g *replayGuard) first(sig string, now time.Time) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.seen == nil {
+		g.seen = make(map[string]time.Time)
+	}
+	if until, ok := g.seen[sig]; ok && now.Before(until) {
+		return false
+	}
+	g.seen[sig] = now.Add(2 * ingestMaxSkew)
+	if len(g.seen) > 1024 {
+		for k, until := range g.seen {
+			if now.After(until) {
+				delete(g.seen, k)
+			}
+		}
+	}
+	return true
+}
+
+// truncateUTF8 cuts s to at most n bytes without splitting a character.
+func truncateUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
@@ -0,0 +1,122 @@
+package api
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const exportFlushEvery = 500 // rows per chunk
+
+// handleExport streams stored samples for offline analysis:
+// GET /stats/export?from=&to=&format=csv|jsonl&metrics=cpu,memory
+//
+// Rows are written and flushed in chunks (chunked transfer encoding), one
+// metric at a time, so only one metric's samples are held in memory.
+func (s *Server) handleExport(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	format := q.Get("format")
+	if format == "" {
+		format = "csv"
+	}
+	if format != "csv" && format != "jsonl" {
+		writeError(w, r, http.StatusBadRequest, codeBadRequest, fmt.Sprintf("invalid format %q (csv or jsonl)", format))
+		return
+	}
+
+	to := time.Now()
+	from := to.Add(-defaultHistoryWindow)
+	for name, dst := range map[string]*time.Time{"from": &from, "to": &to} {
+		if raw := q.Get(name); raw != "" {
+			t, err := parseExportTime(raw)
+			if err != nil {
+				writeError(w, r, http.StatusBadRequest, codeBadRequest, fmt.Sprintf("invalid %s %q (RFC 3339 or unix seconds)", name, raw))
+				return
+			}
+			*dst = t
+		}
+	}
+	if !from.Before(to) {
+		writeError(w, r, http.StatusBadRequest, codeBadRequest, "from must be before to")
+		return
+	}
+
+	available := s.history.Metrics()
+	metrics := available
+	if raw := q.Get("metrics"); raw != "" {
+		metrics = strings.Split(raw, ",")
+		for _, m := range metrics {
+			if !slices.Contains(available, m) {
+				writeError(w, r, http.StatusNotFound, codeNotFound, fmt.Sprintf("no history for metric %q", m))
+				return
+			}
+		}
+	}
+
+	filename := fmt.Sprintf("deskmon-%s.%s", to.UTC().Format("20060102-150405"), format)
+	if format == "csv" {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	} else {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	w.WriteHeader(http.StatusOK)
+
+	flusher, _ := w.(http.Flusher)
+	flush := func() {
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+
+	var cw *csv.Writer
+	if format == "csv" {
+		cw = csv.NewWriter(w)
+		cw.Write([]string{"timestamp", "metric", "value"})
+	}
+	enc := json.NewEncoder(w)
+
+	rows := 0
+	for _, metric := range metrics {
+		for _, sample := range s.history.Query(metric, from, to) {
+			if r.Context().Err() != nil {
+				return // client went away
+			}
+			ts := sample.At.UTC().Format(time.RFC3339)
+			if cw != nil {
+				cw.Write([]string{ts, metric, strconv.FormatFloat(sample.Value, 'f', -1, 64)})
+			} else {
+				enc.Encode(struct {
+					T      string  `json:"t"`
+					Metric string  `json:"metric"`
+					V      float64 `json:"v"`
+				}{ts, metric, sample.Value})
+			}
+			if rows++; rows%exportFlushEvery == 0 {
+				if cw != nil {
+					cw.Flush()
+				}
+				flush()
+			}
+		}
+	}
+	if cw != nil {
+		cw.Flush()
+	}
+	flush()
+	logf(r, "export: %d rows (%s, %s to %s) to %s", rows, format, from.Format(time.RFC3339), to.Format(time.RFC3339), clientIP(r))
+}
+
+// parseExportTime accepts RFC 3339 timestamps or unix seconds.
+func parseExportTime(raw string) (time.Time, error) {
+	if secs, err := strconv.ParseInt(raw, 10, 64); err == nil {
+		return time.Unix(secs, 0), nil
+	}
+	return time.Parse(time.RFC3339, raw)
+}
@@ -0,0 +1,86 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"syscall"
+
+	"github.com/neur0map/deskmon-agent/internal/collector"
+)
+
+const defaultMinFanPWM = 64 // 25%, keeps fans from stalling
+
+type fansResponse struct {
+	ControlEnabled bool                `json:"controlEnabled"`
+	MinPWM         int                 `json:"minPwm"`
+	Fans           []collector.FanInfo `json:"fans"`
+}
+
+// fanRequest sets either a manual duty cycle or a mode.
+type fanRequest struct {
+	PWM  *int   `json:"pwm,omitempty" validate:"min=0,max=255"`
+	Mode string `json:"mode,omitempty" validate:"oneof=auto full"`
+}
+
+func (s *Server) minFanPWM() int {
+	if s.cfg.FanControl.MinPWM > 0 {
+		return s.cfg.FanControl.MinPWM
+	}
+	return defaultMinFanPWM
+}
+
+func (s *Server) handleFans(w http.ResponseWriter, r *http.Request) {
+	writeData(w, r, fansResponse{
+		ControlEnabled: s.cfg.FanControl.Enabled && !s.cfg.ReadOnly,
+		MinPWM:         s.minFanPWM(),
+		Fans:           collector.ListFans(),
+	})
+}
+
+func (s *Server) handleFanSet(w http.ResponseWriter, r *http.Request) {
+	if !s.cfg.FanControl.Enabled {
+		writeError(w, r, http.StatusForbidden, codeForbidden, "fan control is disabled (set fan_control.enabled)")
+		return
+	}
+	id := r.PathValue("id")
+
+	var req fanRequest
+	if !decodeBody(w, r, &req, false) {
+		return
+	}
+	if (req.PWM == nil) == (req.Mode == "") {
+		writeFieldErrors(w, r, codeValidationFailed, []fieldError{{Message: `expected {"pwm": 0-255} or {"mode": "auto"|"full"}`}})
+		return
+	}
+
+	var (
+		fan collector.FanInfo
+		err error
+	)
+	if req.PWM != nil {
+		if *req.PWM < s.minFanPWM() {
+			writeFieldErrors(w, r, codeValidationFailed, []fieldError{{Field: "pwm", Message: fmt.Sprintf("must be at least the configured minimum of %d", s.minFanPWM())}})
+			return
+		}
+		logf(r, "fans: %s set to pwm %d by %s", id, *req.PWM, clientIP(r))
+		fan, err = collector.SetFanPWM(id, *req.PWM)
+	} else {
+		logf(r, "fans: %s set to %s mode by %s", id, req.Mode, clientIP(r))
+		fan, err = collector.SetFanMode(id, req.Mode)
+	}
+
+	switch {
+	case errors.Is(err, collector.ErrFanNotFound):
+		writeError(w, r, http.StatusNotFound, codeNotFound, "fan not found")
+	case errors.Is(err, os.ErrPermission), errors.Is(err, syscall.EROFS):
+		logf(r, "fans: %s: %v", id, err)
+		writeError(w, r, http.StatusForbidden, codeForbidden, "no write access to hwmon (is /sys mounted read-only?)")
+	case err != nil:
+		logf(r, "fans: %s: %v", id, err)
+		writeError(w, r, http.StatusBadRequest, codeActionFailed, err.Error())
+	default:
+		writeData(w, r, fan)
+	}
+}
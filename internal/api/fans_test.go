@@ -0,0 +1,49 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestFanSetRejects covers the requests handleFanSet refuses before it
+// touches hwmon.
+func TestFanSetRejects(t *testing.T) {
+	srv := newTestServer()
+	mux := http.NewServeMux()
+	srv.handleMutating(mux, "POST /fans/{id}", srv.handleFanSet)
+
+	tests := []struct {
+		name     string
+		enabled  bool
+		readOnly bool
+		body     string
+		status   int
+		code     string
+	}{
+		{"control disabled", false, false, `{"mode":"auto"}`, http.StatusForbidden, codeForbidden},
+		{"read-only", true, true, `{"mode":"auto"}`, http.StatusForbidden, codeReadOnly},
+		{"above 255", true, false, `{"pwm":256}`, http.StatusBadRequest, codeValidationFailed},
+		{"below minimum", true, false, `{"pwm":10}`, http.StatusBadRequest, codeValidationFailed},
+		{"unknown mode", true, false, `{"mode":"turbo"}`, http.StatusBadRequest, codeValidationFailed},
+		{"pwm and mode", true, false, `{"pwm":128,"mode":"auto"}`, http.StatusBadRequest, codeValidationFailed},
+		{"neither", true, false, `{}`, http.StatusBadRequest, codeValidationFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv.cfg.FanControl.Enabled = tt.enabled
+			srv.cfg.ReadOnly = tt.readOnly
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/fans/hwmon0-pwm1", strings.NewReader(tt.body)))
+			var resp struct {
+				Code string `json:"code"`
+			}
+			json.Unmarshal(w.Body.Bytes(), &resp)
+			if w.Code != tt.status || resp.Code != tt.code {
+				t.Errorf("got %d %q, want %d %q: %s", w.Code, resp.Code, tt.status, tt.code, w.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,453 @@
+//go:build !nogrpc
+
+package api
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/neur0map/deskmon-agent/internal/alerts"
+	"github.com/neur0map/deskmon-agent/internal/collector"
+	"github.com/neur0map/deskmon-agent/internal/collector/services"
+	"github.com/neur0map/deskmon-agent/internal/config"
+	pb "github.com/neur0map/deskmon-agent/internal/deskmonpb"
+	"github.com/neur0map/deskmon-agent/internal/systemctl"
+)
+
+// The gRPC API mirrors the core of the HTTP one (stats, the live stream,
+// container actions, agent status) for typed clients generated from
+// internal/deskmonpb/deskmon.proto. It listens on grpc_port and shares the
+// HTTP server's token, lockout and read-only settings.
+
+// deskmonServer is the handler type checked by grpc.RegisterService.
+type deskmonServer interface {
+	GetStats(context.Context, *pb.StatsRequest) (*pb.Stats, error)
+	StreamStats(*pb.StreamRequest, grpc.ServerStream) error
+	ContainerAction(context.Context, *pb.ContainerActionRequest) (*pb.ContainerActionResponse, error)
+	GetAgentStatus(context.Context, *pb.AgentStatusRequest) (*pb.AgentStatus, error)
+}
+
+type grpcService struct {
+	s *Server
+}
+
+var deskmonServiceDesc = grpc.ServiceDesc{
+	ServiceName: pb.ServiceName,
+	HandlerType: (*deskmonServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{MethodName: "GetStats", Handler: unaryHandler("GetStats", deskmonServer.GetStats)},
+		{MethodName: "ContainerAction", Handler: unaryHandler("ContainerAction", deskmonServer.ContainerAction)},
+		{MethodName: "GetAgentStatus", Handler: unaryHandler("GetAgentStatus", deskmonServer.GetAgentStatus)},
+	},
+	Streams: []grpc.StreamDesc{{
+		StreamName:    "StreamStats",
+		ServerStreams: true,
+		Handler: func(srv any, stream grpc.ServerStream) error {
+			req := new(pb.StreamRequest)
+			if err := stream.RecvMsg(req); err != nil {
+				return err
+			}
+			return srv.(deskmonServer).StreamStats(req, stream)
+		},
+	}},
+	Metadata: "deskmon.proto",
+}
+
+// unaryHandler adapts a typed method to grpc.MethodDesc's handler, the way
+// generated code does. The interceptor sees the call as /<service>/name.
+func unaryHandler[Req, Resp any](name string, method func(deskmonServer, context.Context, *Req) (*Resp, error)) func(any, context.Context, func(any) error, grpc.UnaryServerInterceptor) (any, error) {
+	return func(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+		req := new(Req)
+		if err := dec(req); err != nil {
+			return nil, err
+		}
+		call := func(ctx context.Context, req any) (any, error) {
+			return method(srv.(deskmonServer), ctx, req.(*Req))
+		}
+		if interceptor == nil {
+			return call(ctx, req)
+		}
+		return interceptor(ctx, req, &grpc.UnaryServerInfo{Server: srv, FullMethod: "/" + pb.ServiceName + "/" + name}, call)
+	}
+}
+
+// startGRPC listens on grpc_port and serves in the background until
+// Shutdown.
+func (s *Server) startGRPC() error {
+	addr := net.JoinHostPort(s.cfg.Bind, fmt.Sprint(s.cfg.GRPCPort))
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("grpc listen: %w", err)
+	}
+	srv := s.newGRPCServer()
+	s.grpcStop = srv.Stop
+	log.Printf("gRPC API listening on %s", addr)
+	go func() {
+		if err := srv.Serve(lis); err != nil && !errors.Is(err, grpc.ErrServerStopped) {
+			log.Printf("grpc: %v", err)
+		}
+	}()
+	return nil
+}
+
+func (s *Server) newGRPCServer() *grpc.Server {
+	opts := []grpc.ServerOption{
+		grpc.ForceServerCodec(pb.Codec{}),
+		grpc.UnaryInterceptor(func(ctx context.Context, req any, info *grpc.UnaryServerInfo, next grpc.UnaryHandler) (any, error) {
+			name, err := s.grpcAuth(ctx, info.FullMethod, req)
+			if err != nil {
+				return nil, err
+			}
+			if err := s.grpcRateLimit(ctx, info.FullMethod, name); err != nil {
+				return nil, err
+			}
+			return next(ctx, req)
+		}),
+		grpc.StreamInterceptor(func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, next grpc.StreamHandler) error {
+			if _, err := s.grpcAuth(ss.Context(), info.FullMethod, nil); err != nil {
+				return err
+			}
+			return next(srv, ss)
+		}),
+	}
+	if s.tlsConfig != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(s.tlsConfig)))
+	}
+	srv := grpc.NewServer(opts...)
+	srv.RegisterService(&deskmonServiceDesc, &grpcService{s: s})
+	return srv
+}
+
+// grpcScopes lists the methods that need a token scope beyond read-only.
+var grpcScopes = map[string]string{
+	"/" + pb.ServiceName + "/ContainerAction": config.ScopeControl,
+}
+
+// grpcMutating lists the methods that count toward the mutating rate limit.
+var grpcMutating = map[string]bool{
+	"/" + pb.ServiceName + "/ContainerAction": true,
+}
+
+// grpcPeerIP returns the caller's IP address, or "" when unknown.
+func grpcPeerIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+	ip := p.Addr.String()
+	if host, _, err := net.SplitHostPort(ip); err == nil {
+		ip = host
+	}
+	return ip
+}
+
+// grpcRateLimit applies the mutating rate limit to the methods in
+// grpcMutating, sharing the HTTP API's buckets: per token when the call
+// was authenticated as name, per IP otherwise.
+func (s *Server) grpcRateLimit(ctx context.Context, method, name string) error {
+	if !grpcMutating[method] {
+		return nil
+	}
+	ip := grpcPeerIP(ctx)
+	key := ip
+	if name != "" {
+		key = "token:" + name
+	}
+	if !s.rateMutating.allow(key) {
+		log.Printf("grpc: rate limit exceeded for %s on %s", ip, method)
+		return status.Errorf(codes.ResourceExhausted, "rate limit exceeded, retry in %s", s.rateMutating.period)
+	}
+	return nil
+}
+
+// grpcAuth applies auth_token, tokens, their scopes and policies, and the
+// failed-attempt lockout to a call, reading the token from
+// "authorization: Bearer" metadata. req is nil for streams. It returns the
+// name of the token the call was made with, "" without auth.
+func (s *Server) grpcAuth(ctx context.Context, method string, req any) (string, error) {
+	if !s.cfg.AuthEnabled() {
+		return "", nil
+	}
+	ip := grpcPeerIP(ctx)
+	if remaining := s.lockout.banned(ip); remaining > 0 {
+		return "", status.Errorf(codes.ResourceExhausted, "too many failed auth attempts, retry in %s", remaining.Round(1e9))
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, auth := range md.Get("authorization") {
+		if len(auth) <= 7 || !strings.EqualFold(auth[:7], "bearer ") {
+			continue
+		}
+		name, scope, policy := s.lookupToken(strings.TrimSpace(auth[7:]))
+		if scope == "" {
+			continue
+		}
+		s.lockout.succeed(ip)
+		required := cmp.Or(grpcScopes[method], config.ScopeReadOnly)
+		if !config.ScopeAllows(scope, required) {
+			log.Printf("grpc: token %s (%s) from %s may not call %s", name, scope, ip, method)
+			return "", status.Errorf(codes.PermissionDenied, "%s needs a %s token", method, required)
+		}
+		if ar, ok := req.(*pb.ContainerActionRequest); ok {
+			action := "container." + ar.Action.String()
+			if !s.policyAllows(policy, action, ar.ID) {
+				log.Printf("grpc: token %s from %s: policy denies %s %s", name, ip, action, ar.ID)
+				return "", status.Errorf(codes.PermissionDenied, "this token's policy doesn't allow %s", action)
+			}
+		}
+		return name, nil
+	}
+	s.recordAuthFailure(nil, ip)
+	log.Printf("grpc: auth failed for %s", ip)
+	return "", status.Error(codes.Unauthenticated, "unauthorized")
+}
+
+func (g *grpcService) GetStats(ctx context.Context, _ *pb.StatsRequest) (*pb.Stats, error) {
+	s := g.s
+	out := &pb.Stats{
+		System:     toPBSystem(s.system.Collect()),
+		Containers: toPBContainers(s.docker.Collect()),
+		Services:   toPBServices(s.services.Collect()),
+	}
+	for _, a := range s.alerts.Active() {
+		out.Alerts = append(out.Alerts, toPBAlert(a))
+	}
+	return out, nil
+}
+
+func (g *grpcService) StreamStats(req *pb.StreamRequest, stream grpc.ServerStream) error {
+	s := g.s
+	want := func(event string) bool {
+		if len(req.Events) == 0 {
+			return true
+		}
+		for _, e := range req.Events {
+			if e == event {
+				return true
+			}
+		}
+		return false
+	}
+	for _, e := range req.Events {
+		switch e {
+		case "system", "containers", "services", "alert":
+		default:
+			return status.Errorf(codes.InvalidArgument, "unknown event %q", e)
+		}
+	}
+
+	// gRPC applies flow control, so a slow client would back up into the
+	// buffers; keep only the newest snapshot. Alerts are discrete and
+	// keep their order.
+	sysSub := s.system.Broadcast.SubscribeMode(1, collector.KeepLatest)
+	defer sysSub.Close()
+	dockerSub := s.docker.Broadcast.SubscribeMode(1, collector.KeepLatest)
+	defer dockerSub.Close()
+	servicesSub := s.services.Broadcast.SubscribeMode(1, collector.KeepLatest)
+	defer servicesSub.Close()
+	alertSub := s.alerts.Broadcast.SubscribeMode(8, collector.DropNewest)
+	defer alertSub.Close()
+
+	send := func(event string, ev *pb.StatsEvent) error {
+		if !want(event) {
+			return nil
+		}
+		return stream.SendMsg(ev)
+	}
+
+	// Start from the current snapshot so clients don't wait a full
+	// interval for their first values.
+	if err := send("system", &pb.StatsEvent{System: toPBSystem(s.system.Collect())}); err != nil {
+		return err
+	}
+	if err := send("containers", &pb.StatsEvent{Containers: &pb.ContainerList{Containers: toPBContainers(s.docker.Collect())}}); err != nil {
+		return err
+	}
+	if err := send("services", &pb.StatsEvent{Services: &pb.ServiceList{Services: toPBServices(s.services.Collect())}}); err != nil {
+		return err
+	}
+
+	ctx := stream.Context()
+	for {
+		var err error
+		select {
+		case ev := <-sysSub.C:
+			err = send("system", &pb.StatsEvent{System: toPBSystem(ev.System)})
+		case cs := <-dockerSub.C:
+			err = send("containers", &pb.StatsEvent{Containers: &pb.ContainerList{Containers: toPBContainers(cs)}})
+		case ss := <-servicesSub.C:
+			err = send("services", &pb.StatsEvent{Services: &pb.ServiceList{Services: toPBServices(ss)}})
+		case a := <-alertSub.C:
+			err = send("alert", &pb.StatsEvent{Alert: toPBAlert(a)})
+		case <-ctx.Done():
+			return nil
+		case <-s.stopCh:
+			return status.Error(codes.Unavailable, "agent shutting down")
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (g *grpcService) ContainerAction(ctx context.Context, req *pb.ContainerActionRequest) (*pb.ContainerActionResponse, error) {
+	s := g.s
+	if s.cfg.ReadOnly {
+		log.Printf("read-only mode: rejected gRPC ContainerAction %s %s", req.Action, req.ID)
+		return nil, status.Error(codes.PermissionDenied, "agent is in read-only mode")
+	}
+	action := req.Action.String()
+	if action == "" {
+		return nil, status.Error(codes.InvalidArgument, "action must be START, STOP or RESTART")
+	}
+
+	// There's no confirmation round trip over gRPC, so with
+	// confirm_destructive set stop and restart are HTTP-only.
+	if s.cfg.ConfirmDestructive && action != "start" {
+		log.Printf("confirm_destructive: rejected gRPC ContainerAction %s %s", action, req.ID)
+		return nil, status.Errorf(codes.FailedPrecondition, "confirm_destructive is set: %s needs confirming over HTTP (POST /containers/{id}/%s)", action, action)
+	}
+
+	log.Printf("container %s requested for %s over gRPC", action, req.ID)
+	if err := s.containerAction(ctx, action, req.ID); err != nil {
+		log.Printf("container %s %s: error: %v", action, req.ID, err)
+		return nil, grpcContainerError(err)
+	}
+	log.Printf("container %s %s: success", action, req.ID)
+	return &pb.ContainerActionResponse{Message: containerActionMessages[action]}, nil
+}
+
+// grpcContainerError maps a container action failure to its gRPC status.
+func grpcContainerError(err error) error {
+	var ae *containerActionError
+	if !errors.As(err, &ae) {
+		return status.Error(codes.Internal, err.Error())
+	}
+	code := codes.Internal
+	switch ae.code {
+	case codeBadRequest:
+		code = codes.InvalidArgument
+	case codeDockerDenied:
+		code = codes.PermissionDenied
+	case codeNotFound:
+		code = codes.NotFound
+	case codeDockerUnavail:
+		code = codes.Unavailable
+	}
+	return status.Error(code, ae.msg)
+}
+
+func (g *grpcService) GetAgentStatus(ctx context.Context, _ *pb.AgentStatusRequest) (*pb.AgentStatus, error) {
+	st, _ := systemctl.Status()
+	return &pb.AgentStatus{
+		Version:  g.s.version,
+		Status:   strings.TrimSpace(st),
+		ReadOnly: g.s.cfg.ReadOnly,
+	}, nil
+}
+
+func toPBSystem(st collector.SystemStats) *pb.System {
+	out := &pb.System{
+		CPUPercent:           st.CPU.UsagePercent,
+		CoreCount:            int32(st.CPU.CoreCount),
+		Temperature:          st.CPU.Temperature,
+		TemperatureAvailable: st.CPU.TemperatureAvailable,
+		MemoryUsedBytes:      st.Memory.UsedBytes,
+		MemoryTotalBytes:     st.Memory.TotalBytes,
+		DownloadBytesPerSec:  st.Network.Physical.DownloadBytesPerSec,
+		UploadBytesPerSec:    st.Network.Physical.UploadBytesPerSec,
+		UptimeSeconds:        st.Uptime,
+		Load1:                st.Load.Load1,
+		Load5:                st.Load.Load5,
+		Load15:               st.Load.Load15,
+		SwapUsedBytes:        st.Memory.SwapUsedBytes,
+		SwapTotalBytes:       st.Memory.SwapTotalBytes,
+	}
+	for _, d := range st.Disks {
+		out.Disks = append(out.Disks, &pb.Disk{
+			MountPoint: d.MountPoint,
+			Device:     d.Device,
+			FsType:     d.FsType,
+			UsedBytes:  d.UsedBytes,
+			TotalBytes: d.TotalBytes,
+		})
+	}
+	return out
+}
+
+func toPBContainers(cs []collector.ContainerStats) []*pb.Container {
+	out := make([]*pb.Container, 0, len(cs))
+	for _, c := range cs {
+		out = append(out, &pb.Container{
+			ID:             c.ID,
+			Name:           c.Name,
+			Image:          c.Image,
+			Status:         c.Status,
+			CPUPercent:     c.CPUPercent,
+			MemoryUsageMB:  c.MemoryUsageMB,
+			MemoryLimitMB:  c.MemoryLimitMB,
+			NetworkRxBytes: c.NetworkRxBytes,
+			NetworkTxBytes: c.NetworkTxBytes,
+			HealthStatus:   c.HealthStatus,
+			RestartCount:   int32(c.RestartCount),
+			StartedAt:      c.StartedAt,
+		})
+	}
+	return out
+}
+
+func toPBServices(ss []services.ServiceStats) []*pb.Service {
+	out := make([]*pb.Service, 0, len(ss))
+	for _, svc := range ss {
+		p := &pb.Service{
+			PluginID: svc.PluginID,
+			Name:     svc.Name,
+			Icon:     svc.Icon,
+			Status:   svc.Status,
+			Error:    svc.Error,
+			URL:      svc.URL,
+		}
+		if svc.StatusReason != nil {
+			p.StatusReasonCode, p.StatusReason = svc.StatusReason.Code, svc.StatusReason.Message
+		}
+		for _, item := range svc.Summary {
+			p.Summary = append(p.Summary, &pb.StatItem{Label: item.Label, Value: item.Value, Type: item.Type})
+		}
+		if len(svc.Stats) > 0 {
+			if b, err := json.Marshal(svc.Stats); err == nil {
+				p.StatsJSON = string(b)
+			}
+		}
+		out = append(out, p)
+	}
+	return out
+}
+
+func toPBAlert(a alerts.Alert) *pb.Alert {
+	out := &pb.Alert{
+		ID:            a.ID,
+		Type:          a.Type,
+		Severity:      a.Severity,
+		Source:        a.Source,
+		Message:       a.Message,
+		StartedAtUnix: a.StartedAt.Unix(),
+		UpdatedAtUnix: a.UpdatedAt.Unix(),
+	}
+	if a.ResolvedAt != nil {
+		out.ResolvedAtUnix = a.ResolvedAt.Unix()
+	}
+	return out
+}
@@ -0,0 +1,11 @@
+//go:build nogrpc
+
+package api
+
+import "log"
+
+// startGRPC leaves grpc_port unserved in builds without gRPC support.
+func (s *Server) startGRPC() error {
+	log.Printf("grpc_port is set but the agent was built without gRPC support (nogrpc); ignoring")
+	return nil
+}
@@ -0,0 +1,107 @@
+//go:build !nogrpc
+
+package api
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/neur0map/deskmon-agent/internal/config"
+	pb "github.com/neur0map/deskmon-agent/internal/deskmonpb"
+)
+
+// dialGRPC serves s's gRPC API over an in-memory listener for the rest of
+// the test and returns a client connection to it.
+func dialGRPC(t *testing.T, s *Server) *grpc.ClientConn {
+	t.Helper()
+	lis := bufconn.Listen(1 << 20)
+	srv := s.newGRPCServer()
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultCallOptions(grpc.ForceCodec(pb.Codec{})),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestGRPCAuthAndReadOnly(t *testing.T) {
+	s := newTestServer()
+	s.cfg.AuthToken = "secret"
+	s.cfg.Tokens = []config.TokenConfig{{Name: "dashboard", Token: "viewer", Scope: config.ScopeReadOnly}}
+	s.cfg.ReadOnly = true
+
+	conn := dialGRPC(t, s)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	method := "/" + pb.ServiceName + "/"
+
+	err := conn.Invoke(ctx, method+"GetAgentStatus", &pb.AgentStatusRequest{}, &pb.AgentStatus{})
+	if status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("without token: got %v, want Unauthenticated", err)
+	}
+
+	viewer := metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer viewer")
+	req := &pb.ContainerActionRequest{ID: "abc", Action: pb.ContainerActionRestart}
+	err = conn.Invoke(viewer, method+"ContainerAction", req, &pb.ContainerActionResponse{})
+	if st := status.Convert(err); st.Code() != codes.PermissionDenied || !strings.Contains(st.Message(), "needs a control token") {
+		t.Fatalf("ContainerAction with a read-only token: got %v, want PermissionDenied for its scope", err)
+	}
+
+	authed := metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer secret")
+	var st pb.AgentStatus
+	if err := conn.Invoke(authed, method+"GetAgentStatus", &pb.AgentStatusRequest{}, &st); err != nil {
+		t.Fatalf("GetAgentStatus: %v", err)
+	}
+	if st.Version != "test" || !st.ReadOnly {
+		t.Errorf("status = %+v, want version test and readOnly", st)
+	}
+
+	err = conn.Invoke(authed, method+"ContainerAction", req, &pb.ContainerActionResponse{})
+	if status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("ContainerAction in read-only mode: got %v, want PermissionDenied", err)
+	}
+}
+
+func TestGRPCContainerActionConfirmAndRateLimit(t *testing.T) {
+	s := newTestServer()
+	s.cfg.ConfirmDestructive = true
+	s.cfg.RateLimit.Mutating = 2
+	s.newRateLimiters()
+	conn := dialGRPC(t, s)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	method := "/" + pb.ServiceName + "/ContainerAction"
+
+	err := conn.Invoke(ctx, method, &pb.ContainerActionRequest{ID: "abc", Action: pb.ContainerActionStop}, &pb.ContainerActionResponse{})
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("STOP with confirm_destructive: got %v, want FailedPrecondition", err)
+	}
+	// The rejected STOP counted toward the mutating limit of 2.
+	err = conn.Invoke(ctx, method, &pb.ContainerActionRequest{ID: "abc", Action: pb.ContainerActionStart}, &pb.ContainerActionResponse{})
+	if code := status.Code(err); code == codes.FailedPrecondition || code == codes.ResourceExhausted {
+		t.Fatalf("START: got %v, want it to reach Docker", err)
+	}
+	err = conn.Invoke(ctx, method, &pb.ContainerActionRequest{ID: "abc", Action: pb.ContainerActionStart}, &pb.ContainerActionResponse{})
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("third action in a minute: got %v, want ResourceExhausted", err)
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"net/http"
 
 	"github.com/neur0map/deskmon-agent/internal/collector"
+	"github.com/neur0map/deskmon-agent/internal/collector/services"
+	"github.com/neur0map/deskmon-agent/internal/custom"
 )
 
 type healthResponse struct {
@@ -13,33 +15,133 @@ type healthResponse struct {
 type statsResponse struct {
 	System     collector.SystemStats     `json:"system"`
 	Containers []collector.ContainerStats `json:"containers"`
+	Docker     collector.DockerStatus     `json:"docker"`
 	Processes  []collector.ProcessInfo    `json:"processes"`
+	Services   []services.ServiceStats    `json:"services"`
+	GPUs       []collector.GPUStats       `json:"gpus,omitempty"`
+	ZFS        []collector.ZFSPool        `json:"zfs,omitempty"`
+	Custom     []custom.Metric            `json:"customMetrics,omitempty"`
+	Meta       statsMeta                  `json:"meta"`
+}
+
+// statsMeta carries per-section freshness so clients can grey out stale data.
+type statsMeta struct {
+	System     collector.SampleInfo `json:"system"`
+	Containers collector.SampleInfo `json:"containers"`
+	Processes  collector.SampleInfo `json:"processes"`
+	Services   collector.SampleInfo `json:"services"`
 }
 
 func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
-	writeJSON(w, healthResponse{Status: "ok"})
+	writeData(w, r, healthResponse{Status: "ok"})
 }
 
 func (s *Server) handleStats(w http.ResponseWriter, r *http.Request) {
+	s.writeSnapshot(w, r, "stats", func() interface{} { return s.statsSnapshot() })
+}
+
+// statsSnapshot assembles the full /stats response.
+func (s *Server) statsSnapshot() statsResponse {
 	system := s.system.Collect()
 	containers := s.docker.Collect()
 	processes := s.system.CollectTopProcesses(10)
 
-	writeJSON(w, statsResponse{
+	return statsResponse{
 		System:     system,
 		Containers: containers,
+		Docker:     s.docker.Status(),
 		Processes:  processes,
-	})
+		Services:   s.services.Collect(),
+		GPUs:       s.gpu.Collect(),
+		ZFS:        s.zfs.Collect(),
+		Custom:     s.custom.List(),
+		Meta: statsMeta{
+			System:     s.system.SampleInfo(),
+			Containers: s.docker.SampleInfo(),
+			Processes:  s.system.SampleInfo(),
+			Services:   s.services.SampleInfo(),
+		},
+	}
+}
+
+// handleGPUStats returns per-GPU utilization with the processes and
+// containers using each card. Empty on hosts without nvidia-smi.
+func (s *Server) handleGPUStats(w http.ResponseWriter, r *http.Request) {
+	writeJSONCached(w, r, s.gpu.Collect())
+}
+
+// handleZFSStats returns each ZFS pool's health, capacity and last scrub.
+// Empty on hosts without ZFS.
+func (s *Server) handleZFSStats(w http.ResponseWriter, r *http.Request) {
+	writeJSONCached(w, r, s.zfs.Collect())
+}
+
+// handleCertificateStats returns the certificates found in Let's Encrypt
+// stores on disk, soonest expiry first.
+func (s *Server) handleCertificateStats(w http.ResponseWriter, r *http.Request) {
+	writeJSONCached(w, r, s.certs.Collect())
 }
 
+// handleDNSStats returns the last check of the DNS records in the dns
+// config.
+func (s *Server) handleDNSStats(w http.ResponseWriter, r *http.Request) {
+	writeJSONCached(w, r, s.dns.Collect())
+}
+
+// handleCgroupStats returns CPU/memory/IO per top-level cgroup v2 slice.
+func (s *Server) handleCgroupStats(w http.ResponseWriter, r *http.Request) {
+	writeJSONCached(w, r, s.cgroups.Collect())
+}
+
+// handleSystemStats returns host stats; ?perCore=true adds per-core CPU
+// usage when per_core_cpu doesn't already.
 func (s *Server) handleSystemStats(w http.ResponseWriter, r *http.Request) {
-	writeJSON(w, s.system.Collect())
+	if r.URL.Query().Get("perCore") == "true" {
+		s.writeSnapshot(w, r, "system|perCore", func() interface{} {
+			st := s.system.Collect()
+			if st.CPU.PerCore == nil {
+				st.CPU.PerCore = s.system.PerCoreUsage()
+			}
+			return st
+		})
+		return
+	}
+	s.writeSnapshot(w, r, "system", func() interface{} { return s.system.Collect() })
 }
 
 func (s *Server) handleDockerStats(w http.ResponseWriter, r *http.Request) {
-	writeJSON(w, s.docker.Collect())
+	s.writeSnapshot(w, r, "docker", func() interface{} { return s.docker.Collect() })
+}
+
+type dockerCapabilitiesResponse struct {
+	Host        string          `json:"host"`
+	Probed      bool            `json:"probed"`
+	ReadOnly    bool            `json:"readOnly"`
+	Actions     map[string]bool `json:"actions"`
+	Unavailable []string        `json:"unavailable"`
+}
+
+// handleDockerCapabilities reports which container actions the configured
+// Docker endpoint permits (e.g. a docker-socket-proxy with POST=0).
+func (s *Server) handleDockerCapabilities(w http.ResponseWriter, r *http.Request) {
+	caps := s.docker.Capabilities()
+	unavailable := caps.Unavailable()
+	if unavailable == nil {
+		unavailable = []string{}
+	}
+	writeData(w, r, dockerCapabilitiesResponse{
+		Host:        caps.Host,
+		Probed:      caps.Probed,
+		ReadOnly:    caps.ReadOnly(),
+		Actions:     caps.Actions,
+		Unavailable: unavailable,
+	})
 }
 
 func (s *Server) handleProcessStats(w http.ResponseWriter, r *http.Request) {
-	writeJSON(w, s.system.CollectTopProcesses(10))
+	writeJSONCached(w, r, s.system.CollectTopProcesses(10))
+}
+
+func (s *Server) handleUserStats(w http.ResponseWriter, r *http.Request) {
+	writeJSONCached(w, r, s.system.CollectUserUsage())
 }
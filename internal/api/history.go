@@ -0,0 +1,119 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/neur0map/deskmon-agent/internal/history"
+)
+
+const (
+	defaultHistoryWindow = time.Hour
+	maxHistoryWindow     = 7 * 24 * time.Hour
+	defaultSummaryPoints = 300
+	maxSummaryBuckets    = 2000
+)
+
+type historyResponse struct {
+	Metric  string           `json:"metric"`
+	From    time.Time        `json:"from"`
+	To      time.Time        `json:"to"`
+	Samples []history.Sample `json:"samples"`
+}
+
+type historySummaryResponse struct {
+	Metric     string           `json:"metric"`
+	From       time.Time        `json:"from"`
+	To         time.Time        `json:"to"`
+	Resolution string           `json:"resolution"`
+	Buckets    []history.Bucket `json:"buckets"`
+}
+
+// handleHistory returns recorded samples for one metric:
+// GET /stats/history?metric=temperature&window=1h
+func (s *Server) handleHistory(w http.ResponseWriter, r *http.Request) {
+	metric, ok := s.historyMetric(w, r)
+	if !ok {
+		return
+	}
+	window, ok := parseWindow(w, r, defaultHistoryWindow)
+	if !ok {
+		return
+	}
+
+	to := time.Now()
+	from := to.Add(-window)
+	samples := s.history.Query(metric, from, to)
+	if samples == nil {
+		samples = []history.Sample{}
+	}
+	writeData(w, r, historyResponse{Metric: metric, From: from, To: to, Samples: samples})
+}
+
+// handleHistorySummary returns min/max/avg/p95 per bucket:
+// GET /stats/history/summary?metric=cpu&window=24h&resolution=5m
+func (s *Server) handleHistorySummary(w http.ResponseWriter, r *http.Request) {
+	metric, ok := s.historyMetric(w, r)
+	if !ok {
+		return
+	}
+	window, ok := parseWindow(w, r, defaultHistoryWindow)
+	if !ok {
+		return
+	}
+
+	resolution := (window / defaultSummaryPoints).Round(time.Second)
+	if raw := r.URL.Query().Get("resolution"); raw != "" {
+		d, err := time.ParseDuration(raw)
+		if err != nil || d < time.Second {
+			writeError(w, r, http.StatusBadRequest, codeBadRequest, fmt.Sprintf("invalid resolution %q (min 1s)", raw))
+			return
+		}
+		resolution = d
+	}
+	resolution = max(resolution, time.Second)
+	if window/resolution > maxSummaryBuckets {
+		writeError(w, r, http.StatusBadRequest, codeBadRequest, fmt.Sprintf("window/resolution exceeds %d buckets", maxSummaryBuckets))
+		return
+	}
+
+	to := time.Now()
+	from := to.Add(-window)
+	writeData(w, r, historySummaryResponse{
+		Metric:     metric,
+		From:       from,
+		To:         to,
+		Resolution: resolution.String(),
+		Buckets:    s.history.Summary(metric, from, to, resolution),
+	})
+}
+
+// historyMetric reads ?metric=, writing an error unless it has samples.
+func (s *Server) historyMetric(w http.ResponseWriter, r *http.Request) (string, bool) {
+	metric := r.URL.Query().Get("metric")
+	if metric == "" {
+		writeError(w, r, http.StatusBadRequest, codeBadRequest, "missing metric")
+		return "", false
+	}
+	if !slices.Contains(s.history.Metrics(), metric) {
+		writeError(w, r, http.StatusNotFound, codeNotFound, fmt.Sprintf("no history for metric %q", metric))
+		return "", false
+	}
+	return metric, true
+}
+
+// parseWindow reads the ?window= duration, writing a 400 when it is invalid.
+func parseWindow(w http.ResponseWriter, r *http.Request, def time.Duration) (time.Duration, bool) {
+	raw := r.URL.Query().Get("window")
+	if raw == "" {
+		return def, true
+	}
+	window, err := time.ParseDuration(raw)
+	if err != nil || window <= 0 || window > maxHistoryWindow {
+		writeError(w, r, http.StatusBadRequest, codeBadRequest, fmt.Sprintf("invalid window %q (max %s)", raw, maxHistoryWindow))
+		return 0, false
+	}
+	return window, true
+}
@@ -0,0 +1,29 @@
+package api
+
+import (
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/neur0map/deskmon-agent/internal/collector"
+)
+
+type infoResponse struct {
+	Version     string                `json:"version"`
+	Hostname    string                `json:"hostname"`
+	StartedAt   time.Time             `json:"startedAt"`
+	Environment collector.Environment `json:"environment"`
+}
+
+// handleInfo describes the agent and the environment it runs in, so
+// clients can explain values that differ from bare metal (a VM without
+// temperature, container-scoped memory under lxcfs, ...).
+func (s *Server) handleInfo(w http.ResponseWriter, r *http.Request) {
+	hostname, _ := os.Hostname()
+	writeData(w, r, infoResponse{
+		Version:     s.version,
+		Hostname:    hostname,
+		StartedAt:   s.started,
+		Environment: collector.HostEnvironment(),
+	})
+}
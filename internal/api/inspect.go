@@ -0,0 +1,341 @@
+//go:build !nodocker
+
+package api
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	cerrdefs "github.com/containerd/errdefs"
+	"github.com/docker/docker/api/types/container"
+
+	"github.com/neur0map/deskmon-agent/internal/collector"
+)
+
+// maxHealthOutput caps each healthcheck output snippet.
+const maxHealthOutput = 512
+
+type healthcheckRun struct {
+	Start      time.Time `json:"start"`
+	End        time.Time `json:"end"`
+	DurationMs int64     `json:"durationMs"`
+	ExitCode   int       `json:"exitCode"`
+	Output     string    `json:"output"`
+}
+
+type healthcheckConfig struct {
+	Test        []string `json:"test"`
+	Interval    string   `json:"interval,omitempty"`
+	Timeout     string   `json:"timeout,omitempty"`
+	StartPeriod string   `json:"startPeriod,omitempty"`
+	Retries     int      `json:"retries,omitempty"`
+}
+
+type containerHealthResponse struct {
+	ID            string             `json:"id"`
+	Name          string             `json:"name"`
+	Status        string             `json:"status"` // healthy, unhealthy, starting, none
+	FailingStreak int                `json:"failingStreak"`
+	Healthcheck   *healthcheckConfig `json:"healthcheck,omitempty"`
+	Log           []healthcheckRun   `json:"log"` // oldest first, as kept by Docker (last 5)
+}
+
+// inspectContainer fetches inspect data for the {id} path value, writing
+// the error response itself when it fails.
+func (s *Server) inspectContainer(w http.ResponseWriter, r *http.Request) (container.InspectResponse, bool) {
+	id := r.PathValue("id")
+	if id == "" {
+		writeError(w, r, http.StatusBadRequest, codeBadRequest, "missing container id")
+		return container.InspectResponse{}, false
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	cli, err := collector.NewDockerClient(s.dockerSocket)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, codeDockerUnavail, err.Error())
+		return container.InspectResponse{}, false
+	}
+	defer cli.Close()
+
+	info, err := cli.ContainerInspect(ctx, id)
+	if err != nil {
+		switch {
+		case cerrdefs.IsNotFound(err):
+			writeError(w, r, http.StatusNotFound, codeNotFound, "container "+id+" not found")
+		case cerrdefs.IsPermissionDenied(err):
+			writeError(w, r, http.StatusForbidden, codeDockerDenied, "container inspect not permitted by the Docker endpoint")
+		default:
+			logf(r, "container inspect %s: error: %v", id, err)
+			writeError(w, r, http.StatusInternalServerError, codeDockerError, err.Error())
+		}
+		return container.InspectResponse{}, false
+	}
+	return info, true
+}
+
+// handleContainerHealth returns the healthcheck definition and the recent
+// probe results Docker keeps, to show why a container flaps between
+// healthy and unhealthy.
+func (s *Server) handleContainerHealth(w http.ResponseWriter, r *http.Request) {
+	info, ok := s.inspectContainer(w, r)
+	if !ok {
+		return
+	}
+
+	resp := containerHealthResponse{
+		ID:     shortID(info.ID),
+		Name:   strings.TrimPrefix(info.Name, "/"),
+		Status: "none",
+		Log:    []healthcheckRun{},
+	}
+
+	if info.Config != nil && info.Config.Healthcheck != nil {
+		hc := info.Config.Healthcheck
+		resp.Healthcheck = &healthcheckConfig{
+			Test:        hc.Test,
+			Interval:    durationString(hc.Interval),
+			Timeout:     durationString(hc.Timeout),
+			StartPeriod: durationString(hc.StartPeriod),
+			Retries:     hc.Retries,
+		}
+	}
+
+	if info.State != nil && info.State.Health != nil {
+		health := info.State.Health
+		resp.Status = string(health.Status)
+		resp.FailingStreak = health.FailingStreak
+		for _, run := range health.Log {
+			if run == nil {
+				continue
+			}
+			resp.Log = append(resp.Log, healthcheckRun{
+				Start:      run.Start,
+				End:        run.End,
+				DurationMs: run.End.Sub(run.Start).Milliseconds(),
+				ExitCode:   run.ExitCode,
+				Output:     truncateOutput(strings.TrimSpace(run.Output), maxHealthOutput),
+			})
+		}
+	}
+
+	writeData(w, r, resp)
+}
+
+func shortID(id string) string {
+	if len(id) > 12 {
+		return id[:12]
+	}
+	return id
+}
+
+func durationString(d time.Duration) string {
+	if d <= 0 {
+		return ""
+	}
+	return d.String()
+}
+
+func truncateOutput(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	return strings.ToValidUTF8(s[:max], "") + "…"
+}
+
+type containerMount struct {
+	Type        string `json:"type"` // bind, volume, tmpfs, ...
+	Name        string `json:"name,omitempty"`
+	Source      string `json:"source,omitempty"`
+	Destination string `json:"destination"`
+	ReadOnly    bool   `json:"readOnly"`
+}
+
+type containerNetwork struct {
+	Name      string   `json:"name"`
+	IPAddress string   `json:"ipAddress,omitempty"`
+	Gateway   string   `json:"gateway,omitempty"`
+	Aliases   []string `json:"aliases,omitempty"`
+}
+
+type containerEnvVar struct {
+	Key      string `json:"key"`
+	Value    string `json:"value"`
+	Redacted bool   `json:"redacted,omitempty"`
+}
+
+type containerDetailResponse struct {
+	ID            string             `json:"id"`
+	Name          string             `json:"name"`
+	Image         string             `json:"image"`
+	ImageID       string             `json:"imageId"`
+	ImageDigest   string             `json:"imageDigest,omitempty"`
+	Created       string             `json:"created"`
+	Status        string             `json:"status"`
+	RestartPolicy string             `json:"restartPolicy"`
+	MaxRetries    int                `json:"maxRetries,omitempty"`
+	Mounts        []containerMount   `json:"mounts"`
+	Networks      []containerNetwork `json:"networks"`
+	Labels        map[string]string  `json:"labels"`
+	Env           []containerEnvVar  `json:"env"`
+}
+
+// sensitiveMarkers flag env vars and labels whose values are withheld.
+var sensitiveMarkers = []string{
+	"password", "passwd", "pass", "secret", "token", "key", "credential",
+	"auth", "private", "cert", "dsn", "cookie", "session", "salt",
+}
+
+func isSensitiveName(name string) bool {
+	lower := strings.ToLower(name)
+	for _, marker := range sensitiveMarkers {
+		if strings.Contains(lower, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// secretValuePatterns match values that carry a credential whatever the
+// variable is called: URL userinfo (postgres://user:pw@host), connection
+// string passwords, private keys, JWTs and well-known API token formats.
+var secretValuePatterns = []*regexp.Regexp{
+	regexp.MustCompile(`[a-zA-Z][a-zA-Z0-9+.-]*://[^/@\s]*@`),
+	regexp.MustCompile(`(?i)(^|[;&?\s])(password|passwd|pwd|secret|token|api_?key)=`),
+	regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----`),
+	regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{8,}\.[A-Za-z0-9_-]{8,}\.`),
+	regexp.MustCompile(`\b(gh[pousr]_[A-Za-z0-9]{20,}|github_pat_[A-Za-z0-9_]{20,}|glpat-[A-Za-z0-9_-]{20,}|xox[abposr]-[A-Za-z0-9-]{10,}|sk-[A-Za-z0-9_-]{20,}|AKIA[0-9A-Z]{16})`),
+}
+
+// minOpaqueSecret is the shortest unbroken run of letters and digits,
+// mixing cases or letters and digits, taken to be a generated secret.
+const minOpaqueSecret = 32
+
+func isSensitiveValue(value string) bool {
+	for _, re := range secretValuePatterns {
+		if re.MatchString(value) {
+			return true
+		}
+	}
+	return looksOpaque(value)
+}
+
+// looksOpaque reports a long base64- or hex-like value with no spaces or
+// path separators, such as a generated key or password.
+func looksOpaque(value string) bool {
+	if len(value) < minOpaqueSecret {
+		return false
+	}
+	var lower, upper, digit bool
+	for _, r := range value {
+		switch {
+		case r >= 'a' && r <= 'z':
+			lower = true
+		case r >= 'A' && r <= 'Z':
+			upper = true
+		case r >= '0' && r <= '9':
+			digit = true
+		case r == '+' || r == '=' || r == '_' || r == '-':
+		default:
+			return false
+		}
+	}
+	return digit && (lower || upper) || lower && upper
+}
+
+// handleContainerDetail returns sanitized inspect data for a detail view.
+// Env values and labels are redacted when the name looks like a credential
+// or the value carries one; nothing here is enough to reconstruct a secret.
+func (s *Server) handleContainerDetail(w http.ResponseWriter, r *http.Request) {
+	info, ok := s.inspectContainer(w, r)
+	if !ok {
+		return
+	}
+
+	resp := containerDetailResponse{
+		ID:       shortID(info.ID),
+		Name:     strings.TrimPrefix(info.Name, "/"),
+		ImageID:  info.Image,
+		Created:  info.Created,
+		Mounts:   []containerMount{},
+		Networks: []containerNetwork{},
+		Labels:   map[string]string{},
+		Env:      []containerEnvVar{},
+	}
+	if info.State != nil {
+		resp.Status = info.State.Status
+	}
+	if info.HostConfig != nil {
+		resp.RestartPolicy = string(info.HostConfig.RestartPolicy.Name)
+		resp.MaxRetries = info.HostConfig.RestartPolicy.MaximumRetryCount
+	}
+
+	if info.Config != nil {
+		resp.Image = info.Config.Image
+		for k, v := range info.Config.Labels {
+			if isSensitiveName(k) || isSensitiveValue(v) {
+				v = "<redacted>"
+			}
+			resp.Labels[k] = v
+		}
+		for _, kv := range info.Config.Env {
+			key, value, _ := strings.Cut(kv, "=")
+			ev := containerEnvVar{Key: key, Value: value}
+			if isSensitiveName(key) || isSensitiveValue(value) {
+				ev.Value = ""
+				ev.Redacted = true
+			}
+			resp.Env = append(resp.Env, ev)
+		}
+	}
+
+	for _, m := range info.Mounts {
+		resp.Mounts = append(resp.Mounts, containerMount{
+			Type:        string(m.Type),
+			Name:        m.Name,
+			Source:      m.Source,
+			Destination: m.Destination,
+			ReadOnly:    !m.RW,
+		})
+	}
+
+	if info.NetworkSettings != nil {
+		for name, ep := range info.NetworkSettings.Networks {
+			if ep == nil {
+				continue
+			}
+			resp.Networks = append(resp.Networks, containerNetwork{
+				Name:      name,
+				IPAddress: ep.IPAddress,
+				Gateway:   ep.Gateway,
+				Aliases:   ep.Aliases,
+			})
+		}
+	}
+
+	resp.ImageDigest = s.imageDigest(r.Context(), info.Image)
+	writeData(w, r, resp)
+}
+
+// imageDigest returns the first repo digest of imageID, or "" for locally
+// built images or when the lookup fails.
+func (s *Server) imageDigest(ctx context.Context, imageID string) string {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	cli, err := collector.NewDockerClient(s.dockerSocket)
+	if err != nil {
+		return ""
+	}
+	defer cli.Close()
+
+	img, err := cli.ImageInspect(ctx, imageID)
+	if err != nil || len(img.RepoDigests) == 0 {
+		return ""
+	}
+	return img.RepoDigests[0]
+}
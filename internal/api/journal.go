@@ -0,0 +1,231 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/neur0map/deskmon-agent/internal/hostfs"
+)
+
+const (
+	defaultJournalTail = 100
+	maxJournalTail     = 1000
+	journalTimeout     = 15 * time.Second
+)
+
+// journalPriorities are syslog priority names in journalctl's order, so a
+// name's index is its number.
+var journalPriorities = []string{"emerg", "alert", "crit", "err", "warning", "notice", "info", "debug"}
+
+// journalUnitRe matches systemd unit names and globs; anything else could
+// be read by journalctl as an option or a match expression.
+var journalUnitRe = regexp.MustCompile(`^[A-Za-z0-9@:._\\*?\[\]-]+$`)
+
+// JournalEntry is one journald record.
+type JournalEntry struct {
+	Time       time.Time `json:"time"`
+	Unit       string    `json:"unit,omitempty"`
+	Identifier string    `json:"identifier,omitempty"` // SYSLOG_IDENTIFIER, e.g. sshd
+	PID        int       `json:"pid,omitempty"`
+	Priority   int       `json:"priority"`
+	Level      string    `json:"level"` // priority name: emerg … debug
+	Message    string    `json:"message"`
+	Cursor     string    `json:"cursor"`
+}
+
+type journalResponse struct {
+	Entries []JournalEntry `json:"entries"`
+}
+
+// journalQuery is a validated GET /logs/journal query.
+type journalQuery struct {
+	unit     string
+	priority string // highest priority number to include, as text
+	tail     int
+	follow   bool
+}
+
+func parseJournalQuery(r *http.Request) (journalQuery, error) {
+	q := r.URL.Query()
+	jq := journalQuery{unit: q.Get("unit"), tail: defaultJournalTail, follow: q.Get("follow") == "true"}
+	if jq.unit != "" && !journalUnitRe.MatchString(jq.unit) {
+		return jq, fmt.Errorf("invalid unit %q", jq.unit)
+	}
+	if raw := q.Get("priority"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			n = -1
+			for i, name := range journalPriorities {
+				if strings.EqualFold(raw, name) {
+					n = i
+				}
+			}
+		}
+		if n < 0 || n >= len(journalPriorities) {
+			return jq, fmt.Errorf("invalid priority %q (0-7 or emerg, alert, crit, err, warning, notice, info, debug)", raw)
+		}
+		jq.priority = strconv.Itoa(n)
+	}
+	if raw := q.Get("tail"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > maxJournalTail {
+			return jq, fmt.Errorf("invalid tail %q (1-%d)", raw, maxJournalTail)
+		}
+		jq.tail = n
+	}
+	return jq, nil
+}
+
+// args builds the journalctl command line. In Docker mode the host's
+// journal is read through --root.
+func (jq journalQuery) args() []string {
+	args := []string{"--output=json", "--no-pager", "--lines=" + strconv.Itoa(jq.tail)}
+	if hostfs.Containerized() {
+		args = append(args, "--root="+hostfs.Path("/"))
+	}
+	if jq.unit != "" {
+		args = append(args, "--unit="+jq.unit)
+	}
+	if jq.priority != "" {
+		args = append(args, "--priority="+jq.priority)
+	}
+	if jq.follow {
+		args = append(args, "--follow")
+	}
+	return args
+}
+
+// handleJournal returns the host's recent journald entries, oldest first:
+// GET /logs/journal?unit=nginx.service&priority=err&tail=100
+//
+// With follow=true it streams them as SSE "entry" events instead, starting
+// with the last tail entries, until the client disconnects.
+func (s *Server) handleJournal(w http.ResponseWriter, r *http.Request) {
+	jq, err := parseJournalQuery(r)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, codeBadRequest, err.Error())
+		return
+	}
+	if _, err := exec.LookPath("journalctl"); err != nil {
+		writeError(w, r, http.StatusNotImplemented, codeNotSupported, "journalctl not found; the journal can't be read on this host")
+		return
+	}
+	if jq.follow {
+		s.streamJournal(w, r, jq)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), journalTimeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, "journalctl", jq.args()...).Output()
+	if err != nil {
+		msg := err.Error()
+		if exitErr, ok := err.(*exec.ExitError); ok && len(exitErr.Stderr) > 0 {
+			msg = strings.TrimSpace(string(exitErr.Stderr))
+		}
+		writeError(w, r, http.StatusInternalServerError, codeInternal, "journalctl: "+msg)
+		return
+	}
+	entries := []JournalEntry{}
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	scanner.Buffer(make([]byte, 64<<10), 1<<20)
+	for scanner.Scan() {
+		if e, ok := parseJournalEntry(scanner.Bytes()); ok {
+			entries = append(entries, e)
+		}
+	}
+	writeData(w, r, journalResponse{Entries: entries})
+}
+
+func (s *Server) streamJournal(w http.ResponseWriter, r *http.Request, jq journalQuery) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, r, http.StatusInternalServerError, codeStreamingFailed, "streaming not supported")
+		return
+	}
+	cmd := exec.CommandContext(r.Context(), "journalctl", jq.args()...)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, codeInternal, err.Error())
+		return
+	}
+	if err := cmd.Start(); err != nil {
+		writeError(w, r, http.StatusInternalServerError, codeInternal, "journalctl: "+err.Error())
+		return
+	}
+	defer cmd.Wait()
+
+	rc := http.NewResponseController(w)
+	rc.SetWriteDeadline(time.Time{})
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	fmt.Fprintf(w, ": connected\n\n")
+	flusher.Flush()
+
+	// journalctl runs until the request context is canceled, which kills it
+	// and ends the scan.
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 64<<10), 1<<20)
+	for scanner.Scan() {
+		e, ok := parseJournalEntry(scanner.Bytes())
+		if !ok {
+			continue
+		}
+		body, _ := json.Marshal(e)
+		if _, err := fmt.Fprintf(w, "event: entry\ndata: %s\n\n", body); err != nil {
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+// parseJournalEntry reads one line of journalctl --output=json. Fields
+// that aren't valid UTF-8 come as arrays of bytes instead of strings.
+func parseJournalEntry(line []byte) (JournalEntry, bool) {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(line, &raw); err != nil {
+		return JournalEntry{}, false
+	}
+	field := func(name string) string {
+		var s string
+		if json.Unmarshal(raw[name], &s) == nil {
+			return s
+		}
+		var b []byte
+		var ints []int
+		if json.Unmarshal(raw[name], &ints) == nil {
+			for _, c := range ints {
+				b = append(b, byte(c))
+			}
+		}
+		return strings.ToValidUTF8(string(b), "�")
+	}
+
+	e := JournalEntry{
+		Unit:       field("_SYSTEMD_UNIT"),
+		Identifier: field("SYSLOG_IDENTIFIER"),
+		Message:    field("MESSAGE"),
+		Cursor:     field("__CURSOR"),
+		Priority:   6, // info, journald's default
+	}
+	if us, err := strconv.ParseInt(field("__REALTIME_TIMESTAMP"), 10, 64); err == nil {
+		e.Time = time.UnixMicro(us).UTC()
+	}
+	e.PID, _ = strconv.Atoi(field("_PID"))
+	if p, err := strconv.Atoi(field("PRIORITY")); err == nil && p >= 0 && p < len(journalPriorities) {
+		e.Priority = p
+	}
+	e.Level = journalPriorities[e.Priority]
+	return e, true
+}
@@ -0,0 +1,98 @@
+package api
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// patchOp is one RFC 6902 JSON Patch operation: add, remove or replace.
+type patchOp struct {
+	Op    string
+	Path  string
+	Value any
+}
+
+// diffJSON appends the operations that turn a into b. Both are decoded
+// JSON (maps, slices, float64, string, bool, nil). Arrays of equal length
+// are diffed element by element; otherwise the common prefix is, and the
+// tail is added or removed from the end.
+func diffJSON(a, b any, path string, ops []patchOp) []patchOp {
+	switch av := a.(type) {
+	case map[string]any:
+		bv, ok := b.(map[string]any)
+		if !ok {
+			return append(ops, patchOp{Op: "replace", Path: path, Value: b})
+		}
+		keys := make([]string, 0, len(av)+len(bv))
+		for k := range av {
+			keys = append(keys, k)
+		}
+		for k := range bv {
+			if _, ok := av[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			p := path + "/" + escapePointer(k)
+			old, inA := av[k]
+			val, inB := bv[k]
+			switch {
+			case !inB:
+				ops = append(ops, patchOp{Op: "remove", Path: p})
+			case !inA:
+				ops = append(ops, patchOp{Op: "add", Path: p, Value: val})
+			default:
+				ops = diffJSON(old, val, p, ops)
+			}
+		}
+		return ops
+
+	case []any:
+		bv, ok := b.([]any)
+		if !ok {
+			return append(ops, patchOp{Op: "replace", Path: path, Value: b})
+		}
+		common := min(len(av), len(bv))
+		for i := 0; i < common; i++ {
+			ops = diffJSON(av[i], bv[i], path+"/"+strconv.Itoa(i), ops)
+		}
+		for i := len(av) - 1; i >= common; i-- {
+			ops = append(ops, patchOp{Op: "remove", Path: path + "/" + strconv.Itoa(i)})
+		}
+		for i := common; i < len(bv); i++ {
+			ops = append(ops, patchOp{Op: "add", Path: path + "/" + strconv.Itoa(i), Value: bv[i]})
+		}
+		return ops
+
+	default:
+		if !reflect.DeepEqual(a, b) {
+			ops = append(ops, patchOp{Op: "replace", Path: path, Value: b})
+		}
+		return ops
+	}
+}
+
+// escapePointer escapes a key for use in a JSON Pointer (RFC 6901).
+func escapePointer(key string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(key, "~", "~0"), "/", "~1")
+}
+
+// MarshalJSON leaves "value" out of remove and keeps it on add and
+// replace even when it is null.
+func (op patchOp) MarshalJSON() ([]byte, error) {
+	if op.Op == "remove" {
+		return json.Marshal(struct {
+			Op   string `json:"op"`
+			Path string `json:"path"`
+		}{op.Op, op.Path})
+	}
+	return json.Marshal(struct {
+		Op    string `json:"op"`
+		Path  string `json:"path"`
+		Value any    `json:"value"`
+	}{op.Op, op.Path, op.Value})
+}
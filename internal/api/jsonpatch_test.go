@@ -0,0 +1,156 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestDiffJSONAppliesCleanly(t *testing.T) {
+	tests := []struct {
+		name, a, b string
+	}{
+		{"equal", `{"a":1,"b":[1,2]}`, `{"a":1,"b":[1,2]}`},
+		{"scalar", `{"a":1,"b":"x"}`, `{"a":2,"b":"y"}`},
+		{"add and remove keys", `{"a":1,"b":2}`, `{"b":2,"c":3}`},
+		{"nested maps", `{"cpu":{"cores":{"0":1,"1":2},"temp":50}}`, `{"cpu":{"cores":{"0":3,"2":4},"load":[1]}}`},
+		{"array grows", `{"a":[1,2]}`, `{"a":[1,5,3,4]}`},
+		{"array shrinks", `{"a":[1,2,3,4]}`, `{"a":[9,2]}`},
+		{"array emptied", `{"a":[1,2,3]}`, `{"a":[]}`},
+		{"array of maps", `[{"id":1,"v":"a"},{"id":2}]`, `[{"id":1,"v":"b"},{"id":2,"w":null},{"id":3}]`},
+		{"nested arrays", `[[1,2],[3]]`, `[[1],[3,4,5],[]]`},
+		{"to null", `{"a":{"b":1},"c":[1],"d":2}`, `{"a":null,"c":null,"d":null}`},
+		{"from null", `{"a":null,"c":null}`, `{"a":{"b":1},"c":[1,null]}`},
+		{"added null", `{}`, `{"a":null}`},
+		{"type change", `{"a":[1],"b":{"c":1},"d":"s"}`, `{"a":{"0":1},"b":[1],"d":{"e":1}}`},
+		{"root replaced", `[1,2]`, `{"a":1}`},
+		{"escaped keys", `{"a/b":1,"c~d":{"e/~f":2},"~1":3,"":4}`, `{"a/b":2,"c~d":{"e/~f":3,"/":5},"~0":6,"":7}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, b := decodeJSON(t, tt.a), decodeJSON(t, tt.b)
+			ops := diffJSON(a, b, "", []patchOp{})
+			if tt.a == tt.b && len(ops) != 0 {
+				t.Errorf("equal documents gave %d ops", len(ops))
+			}
+
+			// Apply the patch as a client would receive it, on the wire.
+			wire, err := json.Marshal(ops)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var patch []map[string]any
+			if err := json.Unmarshal(wire, &patch); err != nil {
+				t.Fatal(err)
+			}
+			got, err := applyPatch(decodeJSON(t, tt.a), patch)
+			if err != nil {
+				t.Fatalf("applying %s: %v", wire, err)
+			}
+			if !reflect.DeepEqual(got, b) {
+				g, _ := json.Marshal(got)
+				t.Errorf("patch %s gives %s, want %s", wire, g, tt.b)
+			}
+		})
+	}
+}
+
+func TestDiffJSONEscapesKeys(t *testing.T) {
+	ops := diffJSON(map[string]any{}, map[string]any{"a/b~c": 1.0}, "", nil)
+	if len(ops) != 1 || ops[0].Path != "/a~1b~0c" {
+		t.Fatalf("ops = %+v, want one add at /a~1b~0c", ops)
+	}
+}
+
+func decodeJSON(t *testing.T, s string) any {
+	t.Helper()
+	var v any
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+// applyPatch applies the add, remove and replace operations of an RFC 6902
+// patch to doc.
+func applyPatch(doc any, patch []map[string]any) (any, error) {
+	for _, op := range patch {
+		name, _ := op["op"].(string)
+		path, _ := op["path"].(string)
+		value, hasValue := op["value"]
+		if name != "remove" && !hasValue {
+			return nil, fmt.Errorf("%s %q has no value", name, path)
+		}
+		if path == "" {
+			if name != "replace" {
+				return nil, fmt.Errorf("%s of the whole document", name)
+			}
+			doc = value
+			continue
+		}
+		tokens := strings.Split(path, "/")
+		if tokens[0] != "" {
+			return nil, fmt.Errorf("path %q does not start with /", path)
+		}
+		for i := range tokens {
+			tokens[i] = strings.ReplaceAll(strings.ReplaceAll(tokens[i], "~1", "/"), "~0", "~")
+		}
+		var err error
+		if doc, err = applyOp(doc, tokens[1:], name, value); err != nil {
+			return nil, fmt.Errorf("%s %q: %w", name, path, err)
+		}
+	}
+	return doc, nil
+}
+
+// applyOp applies one operation at tokens below node and returns the
+// updated node.
+func applyOp(node any, tokens []string, name string, value any) (any, error) {
+	key, last := tokens[0], len(tokens) == 1
+	switch n := node.(type) {
+	case map[string]any:
+		child, ok := n[key]
+		if !last {
+			if !ok {
+				return nil, fmt.Errorf("no key %q", key)
+			}
+			updated, err := applyOp(child, tokens[1:], name, value)
+			n[key] = updated
+			return n, err
+		}
+		switch {
+		case name == "add":
+			n[key] = value
+		case !ok:
+			return nil, fmt.Errorf("no key %q", key)
+		case name == "remove":
+			delete(n, key)
+		case name == "replace":
+			n[key] = value
+		}
+		return n, nil
+
+	case []any:
+		i, err := strconv.Atoi(key)
+		if err != nil || i < 0 || i > len(n) || (i == len(n) && !(last && name == "add")) {
+			return nil, fmt.Errorf("bad index %q for length %d", key, len(n))
+		}
+		if !last {
+			n[i], err = applyOp(n[i], tokens[1:], name, value)
+			return n, err
+		}
+		switch name {
+		case "add":
+			n = append(n[:i], append([]any{value}, n[i:]...)...)
+		case "remove":
+			n = append(n[:i], n[i+1:]...)
+		case "replace":
+			n[i] = value
+		}
+		return n, nil
+	}
+	return nil, fmt.Errorf("cannot index %T with %q", node, key)
+}
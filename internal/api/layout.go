@@ -0,0 +1,191 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/neur0map/deskmon-agent/internal/events"
+)
+
+const (
+	maxLayoutBody  = 64 << 10 // PUT /layout, larger than the default body limit
+	maxLayoutItems = 500
+	maxLayoutID    = 128
+)
+
+// Layout is the dashboard arrangement shared by every client: service card
+// order and visibility, pinned containers and the summary metrics shown.
+// Revision increments on each save and doubles as the ETag.
+type Layout struct {
+	Services         []LayoutCard `json:"services"`
+	PinnedContainers []string     `json:"pinnedContainers"`
+	SummaryMetrics   []string     `json:"summaryMetrics"`
+	Revision         int          `json:"revision"`
+	UpdatedAt        *time.Time   `json:"updatedAt,omitempty"`
+}
+
+// LayoutCard is one service card, in display order.
+type LayoutCard struct {
+	ID     string `json:"id"` // service plugin ID
+	Hidden bool   `json:"hidden,omitempty"`
+}
+
+// layoutStore persists the layout as layout.json next to the config file.
+// With no config path (tests) it is kept in memory only.
+type layoutStore struct {
+	mu     sync.Mutex
+	path   string
+	layout Layout
+}
+
+func newLayoutStore(configPath string) *layoutStore {
+	ls := &layoutStore{layout: emptyLayout()}
+	if configPath == "" {
+		return ls
+	}
+	ls.path = filepath.Join(filepath.Dir(configPath), "layout.json")
+	data, err := os.ReadFile(ls.path)
+	if err != nil {
+		return ls
+	}
+	var l Layout
+	if err := json.Unmarshal(data, &l); err != nil {
+		return ls
+	}
+	ls.layout = l
+	return ls
+}
+
+func emptyLayout() Layout {
+	return Layout{Services: []LayoutCard{}, PinnedContainers: []string{}, SummaryMetrics: []string{}}
+}
+
+func (ls *layoutStore) get() Layout {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	return ls.layout
+}
+
+var errLayoutConflict = errors.New("layout was changed by another client")
+
+// put saves l if revision still matches (-1 skips the check).
+func (ls *layoutStore) put(l Layout, revision int) (Layout, error) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	if revision >= 0 && revision != ls.layout.Revision {
+		return ls.layout, errLayoutConflict
+	}
+	now := time.Now().UTC()
+	l.Revision = ls.layout.Revision + 1
+	l.UpdatedAt = &now
+
+	if ls.path != "" {
+		data, err := json.MarshalIndent(l, "", "  ")
+		if err != nil {
+			return ls.layout, err
+		}
+		if err := os.WriteFile(ls.path, data, 0600); err != nil {
+			return ls.layout, err
+		}
+	}
+	ls.layout = l
+	return l, nil
+}
+
+func layoutETag(revision int) string {
+	return `"layout-` + strconv.Itoa(revision) + `"`
+}
+
+func (s *Server) handleGetLayout(w http.ResponseWriter, r *http.Request) {
+	l := s.layout.get()
+	etag := layoutETag(l.Revision)
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "no-cache")
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	writeData(w, r, l)
+}
+
+// handlePutLayout replaces the layout. Clients should send the ETag from
+// GET /layout as If-Match so concurrent edits from two devices don't
+// silently overwrite each other; a stale If-Match gets 412.
+func (s *Server) handlePutLayout(w http.ResponseWriter, r *http.Request) {
+	var l Layout
+	if !decodeBody(w, r, &l, false) {
+		return
+	}
+	if errs := validateLayout(&l); len(errs) > 0 {
+		writeFieldErrors(w, r, codeValidationFailed, errs)
+		return
+	}
+
+	revision := -1
+	if match := r.Header.Get("If-Match"); match != "" && match != "*" {
+		var current int
+		if _, err := fmt.Sscanf(match, `"layout-%d"`, &current); err != nil {
+			writeError(w, r, http.StatusPreconditionFailed, codePreconditionFailed, "If-Match does not match the current layout")
+			return
+		}
+		revision = current
+	}
+
+	saved, err := s.layout.put(l, revision)
+	switch {
+	case errors.Is(err, errLayoutConflict):
+		w.Header().Set("ETag", layoutETag(saved.Revision))
+		writeError(w, r, http.StatusPreconditionFailed, codePreconditionFailed, err.Error())
+		return
+	case err != nil:
+		logf(r, "layout: save failed: %v", err)
+		writeError(w, r, http.StatusInternalServerError, codeInternal, "failed to save layout")
+		return
+	}
+
+	logf(r, "layout: revision %d saved by %s", saved.Revision, clientIP(r))
+	s.recordEvent(events.CategoryConfig, "config.layout", "client:"+clientIP(r), events.SeverityInfo, fmt.Sprintf("dashboard layout saved (revision %d)", saved.Revision))
+	w.Header().Set("ETag", layoutETag(saved.Revision))
+	writeData(w, r, saved)
+}
+
+func validateLayout(l *Layout) []fieldError {
+	if l.Services == nil {
+		l.Services = []LayoutCard{}
+	}
+	if l.PinnedContainers == nil {
+		l.PinnedContainers = []string{}
+	}
+	if l.SummaryMetrics == nil {
+		l.SummaryMetrics = []string{}
+	}
+	var errs []fieldError
+	// entry is the path of the ID at index i of the list at field.
+	check := func(field, entry string, ids []string) {
+		if len(ids) > maxLayoutItems {
+			errs = append(errs, fieldError{Field: field, Message: fmt.Sprintf("must be at most %d items", maxLayoutItems)})
+			return
+		}
+		for i, id := range ids {
+			if id == "" || len(id) > maxLayoutID {
+				errs = append(errs, fieldError{Field: fmt.Sprintf(entry, field, i), Message: fmt.Sprintf("must be 1-%d characters", maxLayoutID)})
+			}
+		}
+	}
+	cards := make([]string, len(l.Services))
+	for i, c := range l.Services {
+		cards[i] = c.ID
+	}
+	check("services", "%s[%d].id", cards)
+	check("pinnedContainers", "%s[%d]", l.PinnedContainers)
+	check("summaryMetrics", "%s[%d]", l.SummaryMetrics)
+	return errs
+}
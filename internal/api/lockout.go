@@ -0,0 +1,170 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/neur0map/deskmon-agent/internal/alerts"
+	"github.com/neur0map/deskmon-agent/internal/events"
+)
+
+const defaultMaxBan = time.Hour
+
+type lockoutEntry struct {
+	failures    int // consecutive failures since the last ban or success
+	bans        int // bans so far; each one doubles the next
+	lastFailure time.Time
+	bannedUntil time.Time
+}
+
+// authLockout bans IPs after repeated failed auth attempts. Ban length
+// starts at baseBan and doubles with every subsequent ban, capped at maxBan.
+type authLockout struct {
+	mu        sync.Mutex
+	threshold int
+	baseBan   time.Duration
+	maxBan    time.Duration
+	entries   map[string]*lockoutEntry
+}
+
+func newAuthLockout(threshold int, baseBan, maxBan time.Duration) *authLockout {
+	return &authLockout{
+		threshold: threshold,
+		baseBan:   baseBan,
+		maxBan:    maxBan,
+		entries:   make(map[string]*lockoutEntry),
+	}
+}
+
+// banned returns the remaining ban time for ip, or 0 if it isn't banned.
+func (l *authLockout) banned(ip string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if e, ok := l.entries[ip]; ok {
+		if remaining := time.Until(e.bannedUntil); remaining > 0 {
+			return remaining
+		}
+	}
+	return 0
+}
+
+// fail records a failed attempt. It returns the ban length and ban count
+// when this failure triggered a new ban, or 0 otherwise.
+func (l *authLockout) fail(ip string) (time.Duration, int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	e, ok := l.entries[ip]
+	if !ok {
+		e = &lockoutEntry{}
+		l.entries[ip] = e
+	}
+	e.failures++
+	e.lastFailure = time.Now()
+	if e.failures < l.threshold {
+		return 0, e.bans
+	}
+
+	ban := l.baseBan << e.bans
+	if ban > l.maxBan || ban <= 0 {
+		ban = l.maxBan
+	}
+	e.bans++
+	e.failures = 0
+	e.bannedUntil = time.Now().Add(ban)
+	return ban, e.bans
+}
+
+// succeed clears the failure streak for ip. The ban count is kept so an
+// attacker who guesses one valid token between bursts still escalates.
+func (l *authLockout) succeed(ip string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if e, ok := l.entries[ip]; ok {
+		e.failures = 0
+	}
+}
+
+type authBan struct {
+	IP                string    `json:"ip"`
+	Bans              int       `json:"bans"`
+	BannedUntil       time.Time `json:"bannedUntil"`
+	RetryAfterSeconds int       `json:"retryAfterSeconds"`
+}
+
+// list returns currently banned IPs, longest remaining ban first.
+func (l *authLockout) list() []authBan {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	bans := make([]authBan, 0)
+	for ip, e := range l.entries {
+		remaining := time.Until(e.bannedUntil)
+		if remaining <= 0 {
+			continue
+		}
+		bans = append(bans, authBan{
+			IP:                ip,
+			Bans:              e.bans,
+			BannedUntil:       e.bannedUntil,
+			RetryAfterSeconds: int(remaining.Seconds()) + 1,
+		})
+	}
+	sort.Slice(bans, func(i, j int) bool { return bans[i].BannedUntil.After(bans[j].BannedUntil) })
+	return bans
+}
+
+// sweep forgets IPs that have been quiet for longer than maxBan and returns
+// those whose ban has expired, so their alerts can be resolved.
+func (l *authLockout) sweep() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var expired []string
+	now := time.Now()
+	for ip, e := range l.entries {
+		if !e.bannedUntil.IsZero() && now.After(e.bannedUntil) {
+			expired = append(expired, ip)
+		}
+		if now.Sub(e.lastFailure) > l.maxBan && now.After(e.bannedUntil) {
+			delete(l.entries, ip)
+		}
+	}
+	return expired
+}
+
+// recordAuthFailure counts a failed attempt and raises a brute-force alert
+// when it results in a ban.
+func (s *Server) recordAuthFailure(r *http.Request, ip string) {
+	ban, count := s.lockout.fail(ip)
+	if ban == 0 {
+		return
+	}
+	logf(r, "auth: banned %s for %s after repeated failures (ban #%d)", ip, ban, count)
+	s.recordEvent(events.CategoryAuth, "auth.banned", "client:"+ip, events.SeverityWarning, fmt.Sprintf("%s banned for %s after repeated failed auth attempts", ip, ban))
+
+	severity := alerts.SeverityWarning
+	if count >= 3 {
+		severity = alerts.SeverityCritical
+	}
+	s.alerts.Fire(alerts.Alert{
+		ID:       "auth-bruteforce:" + ip,
+		Type:     "auth_bruteforce",
+		Severity: severity,
+		Source:   "agent",
+		Message:  fmt.Sprintf("Repeated failed auth attempts from %s; banned for %s (ban #%d)", ip, ban, count),
+	})
+}
+
+func (s *Server) sweepLockout() {
+	for _, ip := range s.lockout.sweep() {
+		s.alerts.Resolve("auth-bruteforce:" + ip)
+	}
+}
+
+func (s *Server) handleAuthBans(w http.ResponseWriter, r *http.Request) {
+	writeData(w, r, map[string]interface{}{"bans": s.lockout.list()})
+}
@@ -0,0 +1,161 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/neur0map/deskmon-agent/internal/collector"
+)
+
+// Long-polling: GET /stats/poll carries the same events as the SSE stream
+// for clients behind middleboxes that break both SSE and WebSockets. Events
+// are numbered and kept in a short log, so a client resumes by passing the
+// last ID it saw.
+
+const (
+	pollLogSize        = 256
+	pollDefaultTimeout = 30 * time.Second
+	pollMaxTimeout     = 60 * time.Second
+)
+
+type pollEvent struct {
+	ID    uint64          `json:"id"`
+	Event string          `json:"event"`
+	At    time.Time       `json:"at"`
+	Data  json.RawMessage `json:"data"`
+}
+
+type pollResponse struct {
+	Events []pollEvent `json:"events"`
+	Next   uint64      `json:"next"`  // pass as ?since= on the next request
+	Reset  bool        `json:"reset"` // events were missed; refetch GET /stats
+}
+
+// streamLog keeps the most recent stream events. It starts on the first
+// poll, so agents without long-poll clients never encode events for it.
+type streamLog struct {
+	mu     sync.Mutex
+	events []pollEvent // oldest first
+	lastID uint64
+	wake   chan struct{} // closed and replaced on every append
+}
+
+func newStreamLog() *streamLog {
+	return &streamLog{wake: make(chan struct{})}
+}
+
+func (l *streamLog) append(event string, data any) {
+	body, err := json.Marshal(data)
+	if err != nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.lastID++
+	l.events = append(l.events, pollEvent{ID: l.lastID, Event: event, At: time.Now().UTC(), Data: body})
+	if len(l.events) > pollLogSize {
+		l.events = append(l.events[:0], l.events[len(l.events)-pollLogSize:]...)
+	}
+	close(l.wake)
+	l.wake = make(chan struct{})
+}
+
+// after returns the events newer than since, whether the client must start
+// over (events in between were evicted, or since is from before an agent
+// restart), the newest ID, and a channel closed on the next append.
+func (l *streamLog) after(since uint64) ([]pollEvent, bool, uint64, <-chan struct{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var out []pollEvent
+	for _, ev := range l.events {
+		if ev.ID > since {
+			out = append(out, ev)
+		}
+	}
+	reset := since > l.lastID || (since > 0 && len(l.events) > 0 && l.events[0].ID > since+1)
+	return out, reset, l.lastID, l.wake
+}
+
+// pollLog returns the stream log, starting it on first use.
+func (s *Server) pollLog() *streamLog {
+	s.pollOnce.Do(func() {
+		s.polls = newStreamLog()
+		watchStream(s, s.system.Broadcast, "system", s.polls)
+		watchStream(s, s.docker.Broadcast, "docker", s.polls)
+		watchStream(s, s.docker.StatusBroadcast, "dockerStatus", s.polls)
+		watchStream(s, s.docker.EventBroadcast, "docker-events", s.polls)
+		watchStream(s, s.services.Broadcast, "services", s.polls)
+		watchStream(s, s.alerts.Broadcast, "alert", s.polls)
+		watchStream(s, s.custom.Broadcast, "customMetrics", s.polls)
+		watchStream(s, s.events.Broadcast, "event", s.polls)
+		if s.updater != nil {
+			watchStream(s, s.updater.Broadcast, "update", s.polls)
+		}
+	})
+	return s.polls
+}
+
+func watchStream[T any](s *Server, b *collector.Broadcaster[T], event string, l *streamLog) {
+	ch, cleanup := b.Subscribe(8)
+	go func() {
+		defer cleanup()
+		for {
+			select {
+			case v := <-ch:
+				l.append(event, v)
+			case <-s.stopCh:
+				return
+			}
+		}
+	}()
+}
+
+// handleStatsPoll returns the stream events after ?since=, waiting up to
+// ?timeout= (default 30s) for the next one when there are none yet.
+// Without since, only events from now on are returned.
+func (s *Server) handleStatsPoll(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	timeout := pollDefaultTimeout
+	if v := q.Get("timeout"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			writeError(w, r, http.StatusBadRequest, codeBadRequest, "timeout must be a duration like 30s")
+			return
+		}
+		timeout = min(d, pollMaxTimeout)
+	}
+
+	stream := s.pollLog()
+	var since uint64
+	if v := q.Get("since"); v != "" {
+		n, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, codeBadRequest, "since must be an event ID")
+			return
+		}
+		since = n
+	} else {
+		_, _, since, _ = stream.after(0)
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		events, reset, last, wake := stream.after(since)
+		if len(events) > 0 || reset {
+			writeData(w, r, pollResponse{Events: events, Next: last, Reset: reset})
+			return
+		}
+		select {
+		case <-wake:
+		case <-timer.C:
+			writeData(w, r, pollResponse{Events: []pollEvent{}, Next: last})
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
@@ -1,8 +1,8 @@
 package api
 
 import (
+	"errors"
 	"fmt"
-	"log"
 	"net/http"
 	"strconv"
 	"syscall"
@@ -11,28 +11,32 @@ import (
 func (s *Server) handleProcessKill(w http.ResponseWriter, r *http.Request) {
 	pidStr := r.PathValue("pid")
 	if pidStr == "" {
-		w.WriteHeader(http.StatusBadRequest)
-		writeJSON(w, map[string]string{"error": "missing pid"})
+		writeError(w, r, http.StatusBadRequest, codeBadRequest, "missing pid")
 		return
 	}
 
 	pid, err := strconv.Atoi(pidStr)
 	if err != nil || pid <= 0 {
-		w.WriteHeader(http.StatusBadRequest)
-		writeJSON(w, map[string]string{"error": fmt.Sprintf("invalid pid: %s", pidStr)})
+		writeError(w, r, http.StatusBadRequest, codeBadRequest, fmt.Sprintf("invalid pid: %s", pidStr))
 		return
 	}
 
 	ip := clientIP(r)
-	log.Printf("process kill requested for pid %d from %s", pid, ip)
+	logf(r, "process kill requested for pid %d from %s", pid, ip)
 
 	if err := syscall.Kill(pid, syscall.SIGTERM); err != nil {
-		log.Printf("process kill pid %d: error: %v", pid, err)
-		w.WriteHeader(http.StatusInternalServerError)
-		writeJSON(w, map[string]string{"error": err.Error()})
+		logf(r, "process kill pid %d: error: %v", pid, err)
+		switch {
+		case errors.Is(err, syscall.ESRCH):
+			writeError(w, r, http.StatusNotFound, codeNotFound, fmt.Sprintf("no process with pid %d", pid))
+		case errors.Is(err, syscall.EPERM):
+			writeError(w, r, http.StatusForbidden, codeForbidden, err.Error())
+		default:
+			writeError(w, r, http.StatusInternalServerError, codeInternal, err.Error())
+		}
 		return
 	}
 
-	log.Printf("process kill pid %d: success (from %s)", pid, ip)
-	writeJSON(w, controlResponse{Message: "killed"})
+	logf(r, "process kill pid %d: success (from %s)", pid, ip)
+	writeData(w, r, controlResponse{Message: "killed"})
 }
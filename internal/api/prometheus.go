@@ -0,0 +1,145 @@
+package api
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/neur0map/deskmon-agent/internal/custom"
+)
+
+// handlePrometheus serves core host/container gauges and custom metrics in
+// the Prometheus text exposition format.
+func (s *Server) handlePrometheus(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+
+	sys := s.system.Collect()
+	gauge(w, "deskmon_cpu_usage_percent", "Overall CPU usage.", nil, sys.CPU.UsagePercent)
+	if sys.CPU.TemperatureAvailable {
+		gauge(w, "deskmon_cpu_temperature_celsius", "Highest thermal zone temperature.", nil, sys.CPU.Temperature)
+	}
+	gauge(w, "deskmon_memory_used_bytes", "Used memory.", nil, float64(sys.Memory.UsedBytes))
+	gauge(w, "deskmon_memory_total_bytes", "Total memory.", nil, float64(sys.Memory.TotalBytes))
+	gauge(w, "deskmon_swap_used_bytes", "Used swap.", nil, float64(sys.Memory.SwapUsedBytes))
+	gauge(w, "deskmon_swap_total_bytes", "Total swap.", nil, float64(sys.Memory.SwapTotalBytes))
+	gauge(w, "deskmon_load1", "1-minute load average.", nil, sys.Load.Load1)
+	gauge(w, "deskmon_load5", "5-minute load average.", nil, sys.Load.Load5)
+	gauge(w, "deskmon_load15", "15-minute load average.", nil, sys.Load.Load15)
+	gauge(w, "deskmon_network_receive_bytes_per_second", "Physical interface download rate.", nil, sys.Network.Physical.DownloadBytesPerSec)
+	gauge(w, "deskmon_network_transmit_bytes_per_second", "Physical interface upload rate.", nil, sys.Network.Physical.UploadBytesPerSec)
+	gauge(w, "deskmon_uptime_seconds", "Host uptime.", nil, float64(sys.Uptime))
+	gauge(w, "deskmon_processes_zombie", "Zombie processes.", nil, float64(sys.ProcessStates.Zombie))
+	gauge(w, "deskmon_processes_uninterruptible", "Processes in uninterruptible sleep (D state).", nil, float64(sys.ProcessStates.Uninterruptible))
+	gauge(w, "deskmon_open_files", "Open file handles system-wide.", nil, float64(sys.Limits.OpenFiles))
+	if sys.Limits.MaxFiles > 0 {
+		gauge(w, "deskmon_open_files_limit", "System-wide open file limit.", nil, float64(sys.Limits.MaxFiles))
+	}
+	if sys.Limits.MaxThreads > 0 {
+		gauge(w, "deskmon_threads", "Threads system-wide.", nil, float64(sys.Limits.Threads))
+		gauge(w, "deskmon_threads_limit", "System-wide thread limit.", nil, float64(sys.Limits.MaxThreads))
+	}
+	if k := sys.Kernel; k != nil {
+		gauge(w, "deskmon_dirty_bytes", "Page cache waiting to be written back.", nil, float64(k.DirtyBytes))
+		writeHelp(w, "deskmon_oom_kills_total", "counter", "OOM-killer invocations since boot.")
+		sample(w, "deskmon_oom_kills_total", nil, float64(k.OOMKills))
+	}
+	if len(sys.RAID) > 0 {
+		writeHelp(w, "deskmon_raid_degraded", "gauge", "Software RAID array degraded, rebuilding or inactive.")
+		for _, a := range sys.RAID {
+			degraded := 0.0
+			if a.Degraded {
+				degraded = 1
+			}
+			sample(w, "deskmon_raid_degraded", map[string]string{"array": a.Name, "level": a.Level}, degraded)
+		}
+	}
+
+	containers := s.docker.Collect()
+	writeHelp(w, "deskmon_container_cpu_percent", "gauge", "Container CPU usage.")
+	for _, c := range containers {
+		sample(w, "deskmon_container_cpu_percent", map[string]string{"name": c.Name}, c.CPUPercent)
+	}
+	writeHelp(w, "deskmon_container_memory_bytes", "gauge", "Container memory usage.")
+	for _, c := range containers {
+		sample(w, "deskmon_container_memory_bytes", map[string]string{"name": c.Name}, c.MemoryUsageMB*1024*1024)
+	}
+
+	// Service plugin calls; errors include panics and timeouts.
+	pluginMetrics := s.services.PluginMetrics()
+	ids := slices.Sorted(maps.Keys(pluginMetrics))
+	writeHelp(w, "deskmon_service_plugin_calls_total", "counter", "Service plugin Detect and Collect calls.")
+	for _, id := range ids {
+		m := pluginMetrics[id]
+		sample(w, "deskmon_service_plugin_calls_total", map[string]string{"plugin": id, "phase": "detect"}, float64(m.DetectCalls))
+		sample(w, "deskmon_service_plugin_calls_total", map[string]string{"plugin": id, "phase": "collect"}, float64(m.CollectCalls))
+	}
+	writeHelp(w, "deskmon_service_plugin_failures_total", "counter", "Service plugin calls that returned an error, panicked or timed out.")
+	for _, id := range ids {
+		m := pluginMetrics[id]
+		for _, f := range []struct {
+			phase, kind string
+			n           uint64
+		}{
+			{"detect", "panic", m.DetectPanics},
+			{"detect", "timeout", m.DetectTimeouts},
+			{"collect", "error", m.CollectErrors - m.CollectPanics - m.CollectTimeouts},
+			{"collect", "panic", m.CollectPanics},
+			{"collect", "timeout", m.CollectTimeouts},
+		} {
+			sample(w, "deskmon_service_plugin_failures_total", map[string]string{"plugin": id, "phase": f.phase, "kind": f.kind}, float64(f.n))
+		}
+	}
+
+	// Custom metrics, grouped so each name gets one HELP/TYPE header.
+	var last string
+	for _, m := range s.custom.List() {
+		if m.Name != last {
+			help := m.Help
+			if help == "" {
+				help = "Custom metric (" + m.Source + ")."
+			}
+			writeHelp(w, m.Name, promType(m), help)
+			last = m.Name
+		}
+		sample(w, m.Name, m.Labels, m.Value)
+	}
+}
+
+func promType(m custom.Metric) string {
+	if m.Type == custom.TypeCounter {
+		return "counter"
+	}
+	return "gauge"
+}
+
+func gauge(w io.Writer, name, help string, labels map[string]string, v float64) {
+	writeHelp(w, name, "gauge", help)
+	sample(w, name, labels, v)
+}
+
+func writeHelp(w io.Writer, name, typ, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, helpEscaper.Replace(help), name, typ)
+}
+
+// The text format escapes only these; Go's %q escapes (\t, \x.., \u....)
+// are parse errors.
+var (
+	helpEscaper       = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+)
+
+func sample(w io.Writer, name string, labels map[string]string, v float64) {
+	if len(labels) == 0 {
+		fmt.Fprintf(w, "%s %s\n", name, strconv.FormatFloat(v, 'g', -1, 64))
+		return
+	}
+	pairs := make([]string, 0, len(labels))
+	for _, k := range slices.Sorted(maps.Keys(labels)) {
+		pairs = append(pairs, k+`="`+labelValueEscaper.Replace(labels[k])+`"`)
+	}
+	fmt.Fprintf(w, "%s{%s} %s\n", name, strings.Join(pairs, ","), strconv.FormatFloat(v, 'g', -1, 64))
+}
@@ -0,0 +1,19 @@
+package api
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPrometheusEscaping(t *testing.T) {
+	var b strings.Builder
+	writeHelp(&b, "backup_ok", "gauge", "Line one\nC:\\backups")
+	sample(&b, "backup_ok", map[string]string{"path": "C:\\backups\\\"nas\"", "note": "tab\there\nnext", "host": "naïve"}, 1)
+
+	want := "# HELP backup_ok Line one\\nC:\\\\backups\n" +
+		"# TYPE backup_ok gauge\n" +
+		"backup_ok{host=\"naïve\",note=\"tab\there\\nnext\",path=\"C:\\\\backups\\\\\\\"nas\\\"\"} 1\n"
+	if got := b.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
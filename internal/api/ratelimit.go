@@ -0,0 +1,193 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type rateBucket struct {
+	tokens    int
+	lastReset time.Time
+}
+
+// rateLimiter is a fixed-window limiter with one bucket per key
+// (client IP, token, or IP+path for per-endpoint limits).
+type rateLimiter struct {
+	mu      sync.Mutex
+	limit   int
+	period  time.Duration
+	buckets map[string]*rateBucket
+}
+
+func newRateLimiter(limit int, period time.Duration) *rateLimiter {
+	return &rateLimiter{
+		limit:   limit,
+		period:  period,
+		buckets: make(map[string]*rateBucket),
+	}
+}
+
+// allow consumes one token from key's bucket and reports whether the
+// request may proceed.
+func (rl *rateLimiter) allow(key string) bool {
+	return rl.allowN(key, rl.limit)
+}
+
+// allowN is allow with an explicit bucket size (per-endpoint overrides).
+func (rl *rateLimiter) allowN(key string, limit int) bool {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	bucket, exists := rl.buckets[key]
+	if !exists {
+		bucket = &rateBucket{tokens: limit, lastReset: time.Now()}
+		rl.buckets[key] = bucket
+	}
+
+	// Reset bucket if period has elapsed
+	if time.Since(bucket.lastReset) > rl.period {
+		bucket.tokens = limit
+		bucket.lastReset = time.Now()
+	}
+
+	if bucket.tokens <= 0 {
+		return false
+	}
+	bucket.tokens--
+	return true
+}
+
+// exhausted reports whether key has no tokens left, without consuming one.
+func (rl *rateLimiter) exhausted(key string) bool {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	bucket, exists := rl.buckets[key]
+	if !exists || time.Since(bucket.lastReset) > rl.period {
+		return false
+	}
+	return bucket.tokens <= 0
+}
+
+// sweep drops buckets idle for more than two periods.
+func (rl *rateLimiter) sweep() {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	cutoff := 2 * rl.period
+	for key, bucket := range rl.buckets {
+		if time.Since(bucket.lastReset) > cutoff {
+			delete(rl.buckets, key)
+		}
+	}
+}
+
+// newRateLimiters builds the general and mutating limiters and the auth
+// lockout from config, falling back to the built-in defaults for zero values.
+func (s *Server) newRateLimiters() {
+	rc := s.cfg.RateLimit
+	period := rc.Period
+	if period <= 0 {
+		period = ratePeriod
+	}
+	requests := rc.Requests
+	if requests <= 0 {
+		requests = rateLimit
+	}
+	mutating := rc.Mutating
+	if mutating <= 0 {
+		mutating = mutatingRateLimit
+	}
+	authFailures := rc.AuthFailures
+	if authFailures <= 0 {
+		authFailures = authFailureLimit
+	}
+	maxBan := rc.MaxBan
+	if maxBan <= 0 {
+		maxBan = defaultMaxBan
+	}
+
+	s.rateGeneral = newRateLimiter(requests, period)
+	s.rateMutating = newRateLimiter(mutating, period)
+	s.lockout = newAuthLockout(authFailures, period, maxBan)
+}
+
+// isMutating reports whether the request can change agent or host state.
+func isMutating(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return false
+	}
+	return true
+}
+
+// isStreamPath reports whether path is a live update transport.
+func isStreamPath(path string) bool {
+	return path == "/stats/stream" || path == "/stats/poll" || path == "/ws"
+}
+
+// rateLimitMiddleware applies the general per-IP bucket (or a per-endpoint
+// override) plus a stricter bucket for mutating requests. The SSE stream, the
+// long-poll endpoint, the WebSocket and requests carrying a valid token skip
+// the general bucket — a 1-second poller would otherwise exhaust it — but still count
+// against the mutating one.
+func (s *Server) rateLimitMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := clientIP(r)
+		name, _, _ := s.requestIdentity(r)
+		authenticated := name != ""
+
+		key := ip
+		if authenticated {
+			key = "token:" + name
+		}
+
+		if !isStreamPath(r.URL.Path) && !authenticated {
+			allowed := true
+			if limit, ok := s.cfg.RateLimit.Endpoints[r.URL.Path]; ok && limit > 0 {
+				allowed = s.rateGeneral.allowN(ip+" "+r.URL.Path, limit)
+			} else {
+				allowed = s.rateGeneral.allow(ip)
+			}
+			if !allowed {
+				s.rejectRateLimited(w, r, ip, s.rateGeneral.period)
+				return
+			}
+		}
+
+		if isMutating(r) && !s.rateMutating.allow(key) {
+			s.rejectRateLimited(w, r, ip, s.rateMutating.period)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) rejectRateLimited(w http.ResponseWriter, r *http.Request, ip string, period time.Duration) {
+	logf(r, "rate limit exceeded for %s on %s %s", ip, r.Method, r.URL.Path)
+	w.Header().Set("Retry-After", strconv.Itoa(int(period.Seconds())))
+	writeError(w, r, http.StatusTooManyRequests, codeRateLimited, "rate limit exceeded")
+}
+
+func (s *Server) sweepRateBuckets() {
+	s.rateGeneral.sweep()
+	s.rateMutating.sweep()
+	s.sweepLockout()
+}
+
+func (s *Server) startRateCleanup() {
+	go func() {
+		ticker := time.NewTicker(5 * time.Minute)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				s.sweepRateBuckets()
+			case <-s.stopCh:
+				return
+			}
+		}
+	}()
+}
@@ -0,0 +1,96 @@
+package api
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+type clientIPKey struct{}
+
+// parseTrustedProxies parses IPs and CIDRs from config. Invalid entries are
+// logged and skipped rather than failing startup.
+func parseTrustedProxies(entries []string) []netip.Prefix {
+	var prefixes []netip.Prefix
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if strings.Contains(entry, "/") {
+			prefix, err := netip.ParsePrefix(entry)
+			if err != nil {
+				log.Printf("trusted_proxies: ignoring invalid CIDR %q: %v", entry, err)
+				continue
+			}
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(entry)
+		if err != nil {
+			log.Printf("trusted_proxies: ignoring invalid IP %q: %v", entry, err)
+			continue
+		}
+		prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+	}
+	return prefixes
+}
+
+func (s *Server) isTrustedProxy(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range s.trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// realIPMiddleware resolves the client IP once per request so rate limiting
+// and logs see the real client behind a trusted reverse proxy. Forwarding
+// headers from untrusted peers are ignored — anyone can set them.
+func (s *Server) realIPMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := s.resolveClientIP(r)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), clientIPKey{}, ip)))
+	})
+}
+
+func (s *Server) resolveClientIP(r *http.Request) string {
+	peer := remoteIP(r)
+	if len(s.trusted) == 0 || !s.isTrustedProxy(peer) {
+		return peer
+	}
+
+	// X-Forwarded-For: client, proxy1, proxy2. Walk right to left and take
+	// the first hop that isn't one of our proxies. When every hop is ours
+	// or one is malformed, the peer is the best address we know; X-Real-IP
+	// may have come from the client and been passed along untouched.
+	if xff := r.Header.Values("X-Forwarded-For"); len(xff) > 0 {
+		hops := strings.Split(strings.Join(xff, ","), ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop := strings.TrimSpace(hops[i])
+			if _, err := netip.ParseAddr(hop); err != nil {
+				break
+			}
+			if !s.isTrustedProxy(hop) {
+				return hop
+			}
+		}
+		return peer
+	}
+
+	if real := strings.TrimSpace(r.Header.Get("X-Real-IP")); real != "" {
+		if _, err := netip.ParseAddr(real); err == nil {
+			return real
+		}
+	}
+
+	return peer
+}
@@ -0,0 +1,130 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+type requestIDKey struct{}
+
+const maxRequestIDLen = 64
+
+// requestID returns the ID assigned by requestLogMiddleware, or "".
+func requestID(r *http.Request) string {
+	if r == nil {
+		return ""
+	}
+	id, _ := r.Context().Value(requestIDKey{}).(string)
+	return id
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
+
+// validRequestID accepts client-supplied IDs made of safe characters only,
+// so they can't inject anything into log lines.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLen {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-', c == '_', c == '.':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// logf logs with the request ID prefixed, keeping the caller's file:line.
+func logf(r *http.Request, format string, args ...interface{}) {
+	if id := requestID(r); id != "" {
+		format = "[" + id + "] " + format
+	}
+	log.Output(2, fmt.Sprintf(format, args...))
+}
+
+// statusRecorder captures the status and body size for the access log.
+// Unwrap keeps http.ResponseController (used by SSE) working.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (rec *statusRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *statusRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	n, err := rec.ResponseWriter.Write(b)
+	rec.bytes += int64(n)
+	return n, err
+}
+
+func (rec *statusRecorder) Flush() {
+	if f, ok := rec.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (rec *statusRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// requestLogMiddleware assigns every request an ID (honoring a valid
+// incoming X-Request-ID), echoes it in the response, and writes an access
+// log line when access_log is enabled.
+func (s *Server) requestLogMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set("X-Request-ID", id)
+		r = r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id))
+
+		if !s.cfg.AccessLog {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+
+		status := rec.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		log.Printf("access: id=%s ip=%s method=%s path=%q status=%d duration=%s bytes=%d token=%s",
+			id, clientIP(r), r.Method, r.URL.Path, status,
+			time.Since(start).Round(time.Microsecond), rec.bytes, s.tokenName(r))
+	})
+}
+
+// tokenName identifies which credential authenticated the request for the
+// access log: "-" when none.
+func (s *Server) tokenName(r *http.Request) string {
+	if name, _, _ := s.requestIdentity(r); name != "" {
+		return name
+	}
+	return "-"
+}
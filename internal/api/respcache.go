@@ -0,0 +1,81 @@
+package api
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// snapshotCacheTTL is how long an encoded snapshot response is reused.
+// Short enough that clients polling at the 1s sample interval still see
+// every sample, long enough that a burst of pollers shares one encode.
+const snapshotCacheTTL = 500 * time.Millisecond
+
+// responseCache keeps recently encoded snapshot responses so dozens of
+// simultaneous pollers reuse one Collect and marshal instead of repeating
+// them per request. Concurrent misses for the same key wait for the first
+// one's result.
+type responseCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]*cacheEntry
+}
+
+type cacheEntry struct {
+	ready   chan struct{} // closed once enc and err are set
+	enc     *encodedResponse
+	err     error
+	expires time.Time
+}
+
+func newResponseCache(ttl time.Duration) *responseCache {
+	return &responseCache{ttl: ttl, entries: make(map[string]*cacheEntry)}
+}
+
+// get returns the cached response for key, calling build when there is
+// none or it has expired.
+func (c *responseCache) get(key string, build func() (*encodedResponse, error)) (*encodedResponse, error) {
+	c.mu.Lock()
+	e, ok := c.entries[key]
+	if ok && (e.expires.IsZero() || time.Now().Before(e.expires)) {
+		c.mu.Unlock()
+		<-e.ready
+		return e.enc, e.err
+	}
+	e = &cacheEntry{ready: make(chan struct{})}
+	c.entries[key] = e
+	c.mu.Unlock()
+
+	e.enc, e.err = build()
+	c.mu.Lock()
+	if e.err != nil {
+		delete(c.entries, key) // don't cache failures
+	} else {
+		e.expires = time.Now().Add(c.ttl)
+	}
+	c.mu.Unlock()
+	close(e.ready)
+	return e.enc, e.err
+}
+
+// writeSnapshot is writeJSONCached for the hot snapshot endpoints, with
+// the encoded response shared between requests for snapshotCacheTTL.
+// The key covers everything that changes the bytes: the endpoint, the
+// encoding and the envelope.
+func (s *Server) writeSnapshot(w http.ResponseWriter, r *http.Request, name string, collect func() interface{}) {
+	key := name
+	if wantsCBOR(r) {
+		key += "|cbor"
+	}
+	if wantsEnvelope(r) {
+		key += "|envelope"
+	}
+	enc, err := s.snapshots.get(key, func() (*encodedResponse, error) {
+		return encodeSnapshot(r, collect())
+	})
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, codeInternal, "failed to encode response")
+		return
+	}
+	writeEncoded(w, r, enc)
+}
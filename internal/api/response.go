@@ -0,0 +1,121 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/neur0map/deskmon-agent/internal/cbor"
+)
+
+// Machine-readable error codes. Clients should branch on these rather than
+// on messages, which are for humans and may change.
+const (
+	codeBadRequest         = "bad_request"
+	codeInvalidJSON        = "invalid_json"
+	codeUnauthorized       = "unauthorized"
+	codeForbidden          = "forbidden"
+	codeReadOnly           = "read_only"
+	codeInsufficientScope  = "insufficient_scope"
+	codePolicyDenied       = "policy_denied"
+	codeNotFound           = "not_found"
+	codeRateLimited        = "rate_limited"
+	codeNotSupported       = "not_supported"
+	codeDockerDenied       = "docker_denied"
+	codeDockerError        = "docker_error"
+	codeDockerUnavail      = "docker_unavailable"
+	codeActionFailed       = "action_failed"
+	codeInternal           = "internal"
+	codeStreamingFailed    = "streaming_unsupported"
+	codePreconditionFailed = "precondition_failed"
+
+	codeConfirmationRequired = "confirmation_required"
+	codeValidationFailed     = "validation_failed"
+)
+
+type apiError struct {
+	Code      string        `json:"code"`
+	Message   string        `json:"message"`
+	RequestID string        `json:"requestId,omitempty"`
+	Confirm   *confirmation `json:"confirm,omitempty"` // with confirmation_required
+	Fields    []fieldError  `json:"fields,omitempty"`  // with invalid_json and validation_failed
+}
+
+// envelopeResponse is the opt-in response shape: exactly one of Data or
+// Error is set.
+type envelopeResponse struct {
+	Data  interface{} `json:"data,omitempty"`
+	Error *apiError   `json:"error,omitempty"`
+}
+
+// legacyErrorResponse keeps the original {"error": "..."} shape, with the
+// code added alongside so existing clients keep working.
+type legacyErrorResponse struct {
+	Error     string        `json:"error"`
+	Code      string        `json:"code"`
+	RequestID string        `json:"requestId,omitempty"`
+	Confirm   *confirmation `json:"confirm,omitempty"` // with confirmation_required
+	Fields    []fieldError  `json:"fields,omitempty"`  // with invalid_json and validation_failed
+}
+
+// wantsEnvelope reports whether the client opted into the envelope with
+// ?envelope=1. Without it responses keep the bare shapes the macOS app
+// has always parsed.
+func wantsEnvelope(r *http.Request) bool {
+	return r != nil && r.URL.Query().Get("envelope") == "1"
+}
+
+// writeData writes a success response, enveloped as {"data": ...} when
+// the client asked for it.
+func writeData(w http.ResponseWriter, r *http.Request, data interface{}) {
+	if wantsCBOR(r) {
+		body, err := cbor.Marshal(wrapData(r, data))
+		if err != nil {
+			writeError(w, r, http.StatusInternalServerError, codeInternal, "failed to encode response")
+			return
+		}
+		w.Header().Set("Content-Type", cbor.ContentType)
+		w.Header().Add("Vary", "Accept")
+		w.Write(body)
+		return
+	}
+	writeJSON(w, wrapData(r, data))
+}
+
+// cborSeqContentType is the stream's media type for CBOR clients: one CBOR
+// item per event, back to back (RFC 8742).
+const cborSeqContentType = "application/cbor-seq"
+
+// wantsCBOR reports whether the client listed application/cbor (or, for
+// the stream, application/cbor-seq) in Accept. Errors stay JSON.
+func wantsCBOR(r *http.Request) bool {
+	if r == nil {
+		return false
+	}
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, _ := strings.Cut(part, ";")
+		switch strings.TrimSpace(mediaType) {
+		case cbor.ContentType, cborSeqContentType:
+			return true
+		}
+	}
+	return false
+}
+
+func wrapData(r *http.Request, data interface{}) interface{} {
+	if wantsEnvelope(r) {
+		return envelopeResponse{Data: data}
+	}
+	return data
+}
+
+// writeError writes an error response with a machine-readable code.
+func writeError(w http.ResponseWriter, r *http.Request, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if wantsEnvelope(r) {
+		json.NewEncoder(w).Encode(envelopeResponse{Error: &apiError{Code: code, Message: message, RequestID: requestID(r)}})
+		return
+	}
+	json.NewEncoder(w).Encode(legacyErrorResponse{Error: message, Code: code, RequestID: requestID(r)})
+}
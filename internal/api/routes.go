@@ -0,0 +1,198 @@
+package api
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/neur0map/deskmon-agent/internal/collector/services"
+	"github.com/neur0map/deskmon-agent/internal/hostfs"
+)
+
+const (
+	routeCertTimeout     = 3 * time.Second
+	routeCertConcurrency = 8
+	routeCertExpiringIn  = 14 * 24 * time.Hour
+)
+
+// routeEntry is one proxy route with what the agent could tell about its
+// exposure.
+type routeEntry struct {
+	services.Route
+	Proxy        string             `json:"proxy"`
+	Public       bool               `json:"public"` // has a host outside local-only names and private addresses
+	Certificates []routeCertificate `json:"certificates,omitempty"`
+}
+
+// routeCertificate is the certificate the proxy serves for a host, as seen
+// over a TLS handshake on port 443 of this machine.
+type routeCertificate struct {
+	Host          string `json:"host"`
+	Status        string `json:"status"` // valid, expiring, expired, untrusted, mismatch or unreachable
+	Issuer        string `json:"issuer,omitempty"`
+	NotAfter      string `json:"notAfter,omitempty"`
+	DaysRemaining int    `json:"daysRemaining,omitempty"`
+	Error         string `json:"error,omitempty"`
+}
+
+type routeProxy struct {
+	Proxy  string `json:"proxy"`
+	Name   string `json:"name"`
+	Routes int    `json:"routes"`
+	Error  string `json:"error,omitempty"`
+}
+
+type routesResponse struct {
+	Routes  []routeEntry `json:"routes"`
+	Proxies []routeProxy `json:"proxies"`
+}
+
+// handleRoutes lists the routes configured on every detected reverse proxy
+// in one shape, with TLS status and the served certificate for each host.
+func (s *Server) handleRoutes(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 15*time.Second)
+	defer cancel()
+
+	resp := routesResponse{Routes: []routeEntry{}, Proxies: []routeProxy{}}
+	if s.services == nil {
+		writeData(w, r, resp)
+		return
+	}
+
+	for _, proxy := range s.services.Routes(ctx) {
+		resp.Proxies = append(resp.Proxies, routeProxy{
+			Proxy:  proxy.Proxy,
+			Name:   proxy.Name,
+			Routes: len(proxy.Routes),
+			Error:  proxy.Error,
+		})
+		for _, route := range proxy.Routes {
+			entry := routeEntry{Route: route, Proxy: proxy.Proxy}
+			for _, h := range route.Hosts {
+				if isPublicHost(h) {
+					entry.Public = true
+				}
+			}
+			resp.Routes = append(resp.Routes, entry)
+		}
+	}
+
+	// One handshake per distinct host, shared by routes that serve it.
+	certs := make(map[string]*routeCertificate)
+	for _, e := range resp.Routes {
+		if !e.TLS {
+			continue
+		}
+		for _, h := range e.Hosts {
+			if h != "" && !strings.ContainsAny(h, "*~^$") {
+				certs[h] = nil
+			}
+		}
+	}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, routeCertConcurrency)
+	for host := range certs {
+		wg.Add(1)
+		go func(host string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			c := probeRouteCertificate(ctx, host)
+			mu.Lock()
+			certs[host] = &c
+			mu.Unlock()
+		}(host)
+	}
+	wg.Wait()
+	for i := range resp.Routes {
+		for _, h := range resp.Routes[i].Hosts {
+			if c := certs[h]; c != nil {
+				resp.Routes[i].Certificates = append(resp.Routes[i].Certificates, *c)
+			}
+		}
+	}
+
+	writeData(w, r, resp)
+}
+
+// probeRouteCertificate connects to the local HTTPS port with the host as
+// SNI and checks the certificate chain and name itself, so an untrusted or
+// mismatched certificate is still reported rather than just failing.
+func probeRouteCertificate(ctx context.Context, host string) routeCertificate {
+	cert := routeCertificate{Host: host}
+	ctx, cancel := context.WithTimeout(ctx, routeCertTimeout)
+	defer cancel()
+
+	raw, err := hostfs.DialContext(ctx, "tcp", "127.0.0.1:443")
+	if err != nil {
+		cert.Status, cert.Error = "unreachable", err.Error()
+		return cert
+	}
+	defer raw.Close()
+	conn := tls.Client(raw, &tls.Config{ServerName: host, InsecureSkipVerify: true})
+	if err := conn.HandshakeContext(ctx); err != nil {
+		cert.Status, cert.Error = "unreachable", err.Error()
+		return cert
+	}
+	chain := conn.ConnectionState().PeerCertificates
+	if len(chain) == 0 {
+		cert.Status = "unreachable"
+		return cert
+	}
+
+	leaf := chain[0]
+	cert.Issuer = leaf.Issuer.CommonName
+	if cert.Issuer == "" && len(leaf.Issuer.Organization) > 0 {
+		cert.Issuer = leaf.Issuer.Organization[0]
+	}
+	cert.NotAfter = leaf.NotAfter.UTC().Format(time.RFC3339)
+	remaining := time.Until(leaf.NotAfter)
+	cert.DaysRemaining = int(remaining.Hours() / 24)
+
+	intermediates := x509.NewCertPool()
+	for _, c := range chain[1:] {
+		intermediates.AddCert(c)
+	}
+	switch {
+	case remaining <= 0:
+		cert.Status = "expired"
+	case leaf.VerifyHostname(host) != nil:
+		cert.Status = "mismatch"
+	default:
+		if _, err := leaf.Verify(x509.VerifyOptions{DNSName: host, Intermediates: intermediates}); err != nil {
+			cert.Status, cert.Error = "untrusted", err.Error()
+		} else if remaining < routeCertExpiringIn {
+			cert.Status = "expiring"
+		} else {
+			cert.Status = "valid"
+		}
+	}
+	return cert
+}
+
+// isPublicHost reports whether a route host could be reachable from the
+// internet: not a local-only name and not a private or loopback address.
+func isPublicHost(host string) bool {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if ip := net.ParseIP(strings.Trim(host, "[]")); ip != nil {
+		return !(ip.IsPrivate() || ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsUnspecified())
+	}
+	if host == "localhost" || !strings.Contains(host, ".") {
+		return false
+	}
+	for _, suffix := range []string{".local", ".lan", ".internal", ".home.arpa", ".localhost", ".localdomain"} {
+		if strings.HasSuffix(host, suffix) {
+			return false
+		}
+	}
+	return true
+}
@@ -1,81 +1,181 @@
 package api
 
 import (
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
-	"log"
 	"net"
 	"net/http"
+	"net/netip"
 	"sync"
 	"time"
 
+	"github.com/neur0map/deskmon-agent/internal/alerts"
 	"github.com/neur0map/deskmon-agent/internal/collector"
+	"github.com/neur0map/deskmon-agent/internal/collector/services"
 	"github.com/neur0map/deskmon-agent/internal/config"
+	"github.com/neur0map/deskmon-agent/internal/custom"
+	"github.com/neur0map/deskmon-agent/internal/events"
+	"github.com/neur0map/deskmon-agent/internal/history"
+	"github.com/neur0map/deskmon-agent/internal/logbuf"
+	"github.com/neur0map/deskmon-agent/internal/memguard"
+	"github.com/neur0map/deskmon-agent/internal/updater"
 )
 
 type Server struct {
 	cfg          *config.Config
+	cfgMu        sync.Mutex // guards cfg writes from configure endpoints
 	configPath   string
 	system       *collector.SystemCollector
 	docker       *collector.DockerCollector
+	gpu          *collector.GPUCollector
+	cgroups      *collector.CgroupCollector
+	zfs          *collector.ZFSCollector
+	certs        *collector.CertificateCollector
+	dns          *collector.DNSChecker
+	history      *history.Store
+	logs         *logbuf.Buffer // recent log lines for /debug/bundle, may be nil
+	layout       *layoutStore
+	custom       *custom.Store
+	events       *events.Timeline
+	started      time.Time
+	services     *services.ServiceDetector
 	version      string
 	httpSrv      *http.Server
 	dockerSocket string
-	rateMu       sync.Mutex
-	rateMap      map[string]*rateBucket
+	rateGeneral  *rateLimiter
+	rateMutating *rateLimiter
+	lockout      *authLockout
+	logins       loginTracker
+	ingestSeen   replayGuard // signatures accepted by POST /events/ingest
+	alerts       *alerts.Manager
+	updater      *updater.Updater // nil unless auto_update is enabled
+	memory       *memguard.Guard  // nil unless max_memory_mb is set
+	trusted      []netip.Prefix   // trusted_proxies, parsed
 	stopCh       chan struct{}
+	pollOnce     sync.Once
+	polls        *streamLog // started by the first GET /stats/poll
+	grpcStop     func()     // stops the gRPC server, nil unless grpc_port is set
+	snapshots    *responseCache
+	tlsConfig    *tls.Config // nil unless tls_cert and tls_key are set
+	mux          *http.ServeMux
+	routeScopes  map[string]string // route pattern → token scope needed beyond read-only
+	confirms     *confirmations    // outstanding confirm_destructive tokens
+	sessionKey   []byte            // signs session tokens; new on every start
 }
 
-type rateBucket struct {
-	tokens    int
-	lastReset time.Time
-}
-
+// Defaults for config.RateLimitConfig zero values.
 const (
-	rateLimit    = 60 // requests per minute
-	ratePeriod   = time.Minute
-	maxBodySize  = 1024 // 1KB
+	rateLimit         = 60 // requests per minute
+	ratePeriod        = time.Minute
+	mutatingRateLimit = 10   // mutating requests per minute
+	authFailureLimit  = 5    // consecutive failed auth attempts before a ban
+	maxBodySize       = 1024 // 1KB
 )
 
-func NewServer(cfg *config.Config, system *collector.SystemCollector, docker *collector.DockerCollector, version, configPath string) *Server {
-	return &Server{
+// bodyLimits raises maxBodySize for endpoints that accept larger documents.
+var bodyLimits = map[string]int64{
+	"/layout":         maxLayoutBody,
+	"/custom-metrics": maxCustomMetricsBody,
+	"/events/ingest":  maxEventIngestBody,
+}
+
+func NewServer(cfg *config.Config, system *collector.SystemCollector, docker *collector.DockerCollector, svc *services.ServiceDetector, version, configPath string) *Server {
+	s := &Server{
 		cfg:          cfg,
 		configPath:   configPath,
 		system:       system,
 		docker:       docker,
+		services:     svc,
 		version:      version,
-		dockerSocket: config.DefaultDockerSock,
-		rateMap:      make(map[string]*rateBucket),
+		dockerSocket: cfg.DockerHost,
+		gpu:          collector.NewGPUCollector(nil),
+		cgroups:      collector.NewCgroupCollector(),
+		zfs:          collector.NewZFSCollector(),
+		certs:        collector.NewCertificateCollector(nil, nil),
+		dns:          collector.NewDNSChecker(config.DNSConfig{}),
+		history:      history.NewStore(),
+		started:      time.Now(),
+		layout:       newLayoutStore(configPath),
+		custom:       custom.NewStore(),
+		events:       events.NewTimeline(events.DefaultCapacity),
+		alerts:       alerts.NewManager(),
 		stopCh:       make(chan struct{}),
+		snapshots:    newResponseCache(snapshotCacheTTL),
+		routeScopes:  make(map[string]string),
+		confirms:     newConfirmations(),
+		sessionKey:   newSessionKey(),
 	}
+	s.newRateLimiters()
+	s.trusted = parseTrustedProxies(cfg.TrustedProxies)
+	return s
 }
 
 func (s *Server) Start() error {
 	mux := http.NewServeMux()
+	s.mux = mux
 
-	// All endpoints — no auth needed (SSH handles authentication,
-	// agent binds to localhost only)
+	// Read endpoints. Auth is optional (auth_token, tokens); by default SSH handles
+	// authentication and the agent binds to localhost only.
 	mux.HandleFunc("GET /health", s.handleHealth)
 	mux.HandleFunc("GET /stats", s.handleStats)
 	mux.HandleFunc("GET /stats/system", s.handleSystemStats)
 	mux.HandleFunc("GET /stats/docker", s.handleDockerStats)
 	mux.HandleFunc("GET /stats/processes", s.handleProcessStats)
+	mux.HandleFunc("GET /stats/users", s.handleUserStats)
+	mux.HandleFunc("GET /stats/services", s.handleServiceStats)
+	mux.HandleFunc("GET /stats/gpu", s.handleGPUStats)
+	mux.HandleFunc("GET /stats/zfs", s.handleZFSStats)
+	mux.HandleFunc("GET /stats/certificates", s.handleCertificateStats)
+	mux.HandleFunc("GET /stats/dns", s.handleDNSStats)
+	mux.HandleFunc("GET /stats/cgroups", s.handleCgroupStats)
+	mux.HandleFunc("GET /stats/history", s.handleHistory)
+	mux.HandleFunc("GET /stats/history/summary", s.handleHistorySummary)
+	mux.HandleFunc("GET /stats/export", s.handleExport)
 	mux.HandleFunc("GET /stats/stream", s.handleStatsStream)
+	mux.HandleFunc("GET /stats/poll", s.handleStatsPoll)
+	mux.HandleFunc("GET /ws", s.handleWebSocket)
+	mux.HandleFunc("GET /metrics", s.handlePrometheus)
+	mux.HandleFunc("GET /custom-metrics", s.handleCustomMetrics)
 
-	// Agent control endpoints
-	mux.HandleFunc("POST /agent/restart", s.handleAgentRestart)
-	mux.HandleFunc("POST /agent/stop", s.handleAgentStop)
+	// Status and diagnostics
 	mux.HandleFunc("GET /agent/status", s.handleAgentStatus)
+	mux.HandleFunc("GET /info", s.handleInfo)
+	mux.HandleFunc("GET /docker/capabilities", s.handleDockerCapabilities)
+	mux.HandleFunc("GET /containers/{id}", s.dockerGuard(s.handleContainerDetail))
+	mux.HandleFunc("GET /containers/{id}/health", s.dockerGuard(s.handleContainerHealth))
+	mux.HandleFunc("GET /topology", s.dockerGuard(s.handleTopology))
+	mux.HandleFunc("GET /routes", s.handleRoutes)
+	mux.HandleFunc("GET /debug/services", s.handleServicesDebug)
+	s.handleScoped(mux, "GET /debug/bundle", config.ScopeAdmin, s.handleDebugBundle)
+	s.handleScoped(mux, "GET /logs/journal", config.ScopeAdmin, s.handleJournal) // logs can hold secrets
+	mux.HandleFunc("GET /alerts", s.handleAlerts)
+	mux.HandleFunc("GET /events", s.handleEvents)
+	mux.HandleFunc("GET /events/docker", s.dockerGuard(s.handleDockerEvents))
+	mux.HandleFunc("GET /auth/bans", s.handleAuthBans)
+	mux.HandleFunc("POST /auth/session", s.handleSession)
+	mux.HandleFunc("GET /fans", s.handleFans)
+	mux.HandleFunc("GET /layout", s.handleGetLayout)
 
-	// Container action endpoints
-	mux.HandleFunc("POST /containers/{id}/start", s.handleContainerStart)
-	mux.HandleFunc("POST /containers/{id}/stop", s.handleContainerStop)
-	mux.HandleFunc("POST /containers/{id}/restart", s.handleContainerRestart)
-
-	// Process action endpoints
-	mux.HandleFunc("POST /processes/{pid}/kill", s.handleProcessKill)
+	// Mutating endpoints — rejected with 403 when read_only is set. They
+	// need a control token, agent control and configuration an admin one.
+	// Destructive ones also go through confirmGuard (confirm_destructive);
+	// handleServiceAction confirms the actions plugins mark destructive.
+	s.handleScoped(mux, "POST /agent/restart", config.ScopeAdmin, s.readOnlyGuard(s.confirmGuard(s.handleAgentRestart)))
+	s.handleScoped(mux, "POST /agent/stop", config.ScopeAdmin, s.readOnlyGuard(s.confirmGuard(s.handleAgentStop)))
+	s.handleMutating(mux, "POST /containers/{id}/start", s.dockerGuard(s.handleContainerStart))
+	s.handleMutating(mux, "POST /containers/{id}/stop", s.dockerGuard(s.confirmGuard(s.handleContainerStop)))
+	s.handleMutating(mux, "POST /containers/{id}/restart", s.dockerGuard(s.confirmGuard(s.handleContainerRestart)))
+	s.handleMutating(mux, "POST /processes/{pid}/kill", s.confirmGuard(s.handleProcessKill))
+	s.handleScoped(mux, "POST /services/{pluginId}/configure", config.ScopeAdmin, s.readOnlyGuard(s.handleServiceConfigure))
+	s.handleMutating(mux, "POST /services/{pluginId}/action", s.handleServiceAction)
+	s.handleMutating(mux, "POST /fans/{id}", s.handleFanSet)
+	s.handleMutating(mux, "PUT /layout", s.handlePutLayout)
+	s.handleMutating(mux, "POST /custom-metrics", s.handlePushCustomMetrics)
+	s.handleMutating(mux, "POST /events/ingest", s.handleEventIngest)
 
-	handler := s.rateLimitMiddleware(s.securityHeaders(mux))
+	// CORS sits before auth: browsers send preflights without credentials.
+	handler := s.realIPMiddleware(s.requestLogMiddleware(s.corsMiddleware(s.rateLimitMiddleware(s.authMiddleware(s.securityHeaders(mux))))))
 
 	addr := fmt.Sprintf("%s:%d", s.cfg.Bind, s.cfg.Port)
 	s.httpSrv = &http.Server{
@@ -87,68 +187,166 @@ func (s *Server) Start() error {
 		MaxHeaderBytes: 1 << 13, // 8KB
 	}
 
+	if s.cfg.TLSCert != "" {
+		cfg, err := s.serverTLSConfig()
+		if err != nil {
+			return err
+		}
+		s.tlsConfig = cfg
+		s.httpSrv.TLSConfig = cfg
+	}
+
 	s.startRateCleanup()
 
+	if s.cfg.GRPCPort != 0 {
+		if err := s.startGRPC(); err != nil {
+			return err
+		}
+	}
+
+	if s.tlsConfig != nil {
+		return s.httpSrv.ListenAndServeTLS("", "")
+	}
 	return s.httpSrv.ListenAndServe()
 }
 
 func (s *Server) Shutdown() error {
 	close(s.stopCh)
+	if s.grpcStop != nil {
+		s.grpcStop()
+	}
 	if s.httpSrv != nil {
 		return s.httpSrv.Close()
 	}
 	return nil
 }
 
-func (s *Server) securityHeaders(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Limit request body size
-		r.Body = http.MaxBytesReader(w, r.Body, maxBodySize)
+// SetAlerts replaces the server's alert manager with one shared with the
+// collectors' rule evaluation.
+func (s *Server) SetAlerts(m *alerts.Manager) {
+	s.alerts = m
+}
 
-		// SSE streams set their own headers; skip JSON/no-store defaults
-		// that interfere with streaming (Content-Type conflict, cache policy).
-		if r.URL.Path != "/stats/stream" {
-			w.Header().Set("Content-Type", "application/json")
-			w.Header().Set("Cache-Control", "no-store")
-		}
+// SetGPU attaches the GPU collector. Without it /stats/gpu returns an empty
+// list.
+func (s *Server) SetGPU(gc *collector.GPUCollector) {
+	s.gpu = gc
+}
 
-		w.Header().Set("X-Content-Type-Options", "nosniff")
-		w.Header().Set("X-Frame-Options", "DENY")
+// SetZFS attaches the running ZFS collector. Without it /stats/zfs
+// returns an empty list.
+func (s *Server) SetZFS(zc *collector.ZFSCollector) {
+	s.zfs = zc
+}
 
-		next.ServeHTTP(w, r)
-	})
+// SetCertificates attaches the running certificate store scanner.
+// Without it /stats/certificates returns an empty list.
+func (s *Server) SetCertificates(cc *collector.CertificateCollector) {
+	s.certs = cc
 }
 
-func (s *Server) rateLimitMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		ip, _, _ := net.SplitHostPort(r.RemoteAddr)
-		if ip == "" {
-			ip = r.RemoteAddr
+// SetDNS attaches the running DNS record checker. Without it /stats/dns
+// reports no records.
+func (s *Server) SetDNS(dc *collector.DNSChecker) {
+	s.dns = dc
+}
+
+// SetCgroups attaches the running cgroup collector.
+func (s *Server) SetCgroups(cc *collector.CgroupCollector) {
+	s.cgroups = cc
+}
+
+// SetHistory attaches the metric history store fed by the collectors.
+func (s *Server) SetHistory(h *history.Store) {
+	s.history = h
+}
+
+// SetLogBuffer attaches the buffer capturing the agent's log output.
+func (s *Server) SetLogBuffer(b *logbuf.Buffer) {
+	s.logs = b
+}
+
+// SetCustomMetrics replaces the custom metric store with the one shared
+// with alert rule evaluation.
+func (s *Server) SetCustomMetrics(cs *custom.Store) {
+	s.custom = cs
+}
+
+// SetEvents replaces the event timeline with the one shared with the
+// collectors and alert rules.
+func (s *Server) SetEvents(t *events.Timeline) {
+	s.events = t
+}
+
+// SetUpdater attaches the auto-updater so its results are streamed to SSE
+// clients.
+func (s *Server) SetUpdater(u *updater.Updater) {
+	s.updater = u
+}
+
+// SetMemoryGuard attaches the max_memory_mb guard so its state shows in
+// /agent/status.
+func (s *Server) SetMemoryGuard(g *memguard.Guard) {
+	s.memory = g
+}
+
+// handleMutating registers a state-changing route. In read-only mode the
+// route stays registered but answers 403, so clients get a clear reason
+// instead of a 404 or 405.
+func (s *Server) handleMutating(mux *http.ServeMux, pattern string, handler http.HandlerFunc) {
+	s.handleScoped(mux, pattern, config.ScopeControl, s.readOnlyGuard(handler))
+}
+
+// handleScoped registers a route that needs a token scope beyond
+// read-only; authMiddleware enforces it.
+func (s *Server) handleScoped(mux *http.ServeMux, pattern, scope string, handler http.HandlerFunc) {
+	s.routeScopes[pattern] = scope
+	mux.HandleFunc(pattern, handler)
+}
+
+func (s *Server) readOnlyGuard(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.cfg.ReadOnly {
+			logf(r, "read-only mode: rejected %s %s from %s", r.Method, r.URL.Path, clientIP(r))
+			writeError(w, r, http.StatusForbidden, codeReadOnly, "agent is in read-only mode")
+			return
 		}
+		next(w, r)
+	}
+}
+
+const errDockerOff = "Docker collector disabled in config"
 
-		s.rateMu.Lock()
-		bucket, exists := s.rateMap[ip]
-		if !exists {
-			bucket = &rateBucket{tokens: rateLimit, lastReset: time.Now()}
-			s.rateMap[ip] = bucket
+// dockerGuard answers 503 on endpoints that talk to Docker while the Docker
+// collector is switched off in config.
+func (s *Server) dockerGuard(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !s.cfg.Collectors.DockerEnabled() {
+			writeError(w, r, http.StatusServiceUnavailable, codeDockerUnavail, errDockerOff)
+			return
 		}
+		next(w, r)
+	}
+}
 
-		// Reset bucket if period has elapsed
-		if time.Since(bucket.lastReset) > ratePeriod {
-			bucket.tokens = rateLimit
-			bucket.lastReset = time.Now()
+func (s *Server) securityHeaders(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Limit request body size
+		limit := int64(maxBodySize)
+		if l, ok := bodyLimits[r.URL.Path]; ok {
+			limit = l
 		}
+		r.Body = http.MaxBytesReader(w, r.Body, limit)
 
-		if bucket.tokens <= 0 {
-			s.rateMu.Unlock()
-			log.Printf("rate limit exceeded for %s on %s %s", ip, r.Method, r.URL.Path)
-			w.Header().Set("Retry-After", "60")
-			http.Error(w, "", http.StatusTooManyRequests)
-			return
+		// SSE streams set their own headers; skip JSON/no-store defaults
+		// that interfere with streaming (Content-Type conflict, cache policy).
+		if r.URL.Path != "/stats/stream" {
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Cache-Control", "no-store")
 		}
 
-		bucket.tokens--
-		s.rateMu.Unlock()
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.Header().Set("X-Frame-Options", "DENY")
 
 		next.ServeHTTP(w, r)
 	})
@@ -161,36 +359,19 @@ func writeJSON(w http.ResponseWriter, data interface{}) {
 	}
 }
 
+// clientIP returns the client address resolved by realIPMiddleware, or the
+// connection's remote address when the middleware didn't run.
 func clientIP(r *http.Request) string {
+	if ip, ok := r.Context().Value(clientIPKey{}).(string); ok {
+		return ip
+	}
+	return remoteIP(r)
+}
+
+func remoteIP(r *http.Request) string {
 	ip, _, err := net.SplitHostPort(r.RemoteAddr)
 	if err != nil {
 		return r.RemoteAddr
 	}
 	return ip
 }
-
-func (s *Server) sweepRateBuckets() {
-	s.rateMu.Lock()
-	defer s.rateMu.Unlock()
-	cutoff := 2 * ratePeriod
-	for ip, bucket := range s.rateMap {
-		if time.Since(bucket.lastReset) > cutoff {
-			delete(s.rateMap, ip)
-		}
-	}
-}
-
-func (s *Server) startRateCleanup() {
-	go func() {
-		ticker := time.NewTicker(5 * time.Minute)
-		defer ticker.Stop()
-		for {
-			select {
-			case <-ticker.C:
-				s.sweepRateBuckets()
-			case <-s.stopCh:
-				return
-			}
-		}
-	}()
-}
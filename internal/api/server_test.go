@@ -1,13 +1,35 @@
 package api
 
 import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/hex"
 	"encoding/json"
+	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
+	"unicode/utf8"
 
 	"github.com/neur0map/deskmon-agent/internal/collector"
+	"github.com/neur0map/deskmon-agent/internal/collector/services"
 	"github.com/neur0map/deskmon-agent/internal/config"
+	"github.com/neur0map/deskmon-agent/internal/events"
+	"github.com/neur0map/deskmon-agent/internal/history"
 )
 
 func newTestServer() *Server {
@@ -17,7 +39,8 @@ func newTestServer() *Server {
 	}
 	sys := collector.NewSystemCollector()
 	docker := collector.NewDockerCollector("/var/run/docker.sock")
-	return NewServer(cfg, sys, docker, "test", "")
+	svc := services.NewServiceDetector("/var/run/docker.sock")
+	return NewServer(cfg, sys, docker, svc, "test", "")
 }
 
 func TestHealthEndpoint(t *testing.T) {
@@ -96,3 +119,997 @@ func TestAgentStatus(t *testing.T) {
 		t.Errorf("expected version 'test', got '%s'", resp.Version)
 	}
 }
+
+func TestInfo(t *testing.T) {
+	srv := newTestServer()
+
+	req := httptest.NewRequest(http.MethodGet, "/info", nil)
+	w := httptest.NewRecorder()
+	srv.handleInfo(w, req)
+
+	var resp infoResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	env := resp.Environment
+	if env.OS != runtime.GOOS || env.Arch != runtime.GOARCH {
+		t.Errorf("expected %s/%s, got %s/%s", runtime.GOOS, runtime.GOARCH, env.OS, env.Arch)
+	}
+	switch env.Virtualization {
+	case collector.VirtNone, collector.VirtVM, collector.VirtContainer, collector.VirtWSL:
+	default:
+		t.Errorf("unexpected virtualization %q", env.Virtualization)
+	}
+	if env.Quirks == nil {
+		t.Error("quirks should be an empty list, not null")
+	}
+}
+
+func TestReadOnlyRejectsMutatingRoutes(t *testing.T) {
+	srv := newTestServer()
+	srv.cfg.ReadOnly = true
+
+	called := false
+	mux := http.NewServeMux()
+	srv.handleMutating(mux, "POST /processes/{pid}/kill", func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/processes/1/kill", nil)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+
+	if w.Code != http.StatusForbidden {
+		t.Errorf("expected 403, got %d", w.Code)
+	}
+	if called {
+		t.Error("handler should not run in read-only mode")
+	}
+
+	srv.cfg.ReadOnly = false
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/processes/1/kill", nil))
+	if !called {
+		t.Error("handler should run when read-only mode is off")
+	}
+}
+
+func TestRateLimitTokenAndMutatingBuckets(t *testing.T) {
+	srv := newTestServer()
+	srv.cfg.AuthToken = "secret"
+
+	handler := srv.rateLimitMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	// Authenticated pollers are not subject to the per-IP cap
+	for i := 0; i < rateLimit*2; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/stats", nil)
+		req.RemoteAddr = "192.168.1.1:1234"
+		req.Header.Set("Authorization", "Bearer secret")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("authenticated request %d should succeed, got %d", i, w.Code)
+		}
+	}
+
+	// Mutating requests have their own, stricter bucket
+	for i := 0; i < mutatingRateLimit; i++ {
+		req := httptest.NewRequest(http.MethodPost, "/processes/1/kill", nil)
+		req.RemoteAddr = "192.168.1.3:1234"
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("mutating request %d should succeed, got %d", i, w.Code)
+		}
+	}
+	req := httptest.NewRequest(http.MethodPost, "/processes/1/kill", nil)
+	req.RemoteAddr = "192.168.1.3:1234"
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusTooManyRequests {
+		t.Errorf("expected 429 after %d mutating requests, got %d", mutatingRateLimit, w.Code)
+	}
+}
+
+func TestTrustedProxyClientIP(t *testing.T) {
+	srv := newTestServer()
+	srv.trusted = parseTrustedProxies([]string{"10.0.0.0/8", "127.0.0.1"})
+
+	tests := []struct {
+		remote string
+		xff    string
+		realIP string
+		want   string
+	}{
+		{"10.0.0.5:1234", "203.0.113.7", "", "203.0.113.7"},
+		{"10.0.0.5:1234", "203.0.113.7, 10.0.0.9", "", "203.0.113.7"},
+		{"127.0.0.1:1234", "", "198.51.100.2", "198.51.100.2"},
+		{"192.168.1.50:1234", "203.0.113.7", "", "192.168.1.50"}, // untrusted peer: header ignored
+		{"10.0.0.5:1234", "", "", "10.0.0.5"},
+		{"10.0.0.5:1234", "10.0.0.8, 10.0.0.9", "198.51.100.2", "10.0.0.5"}, // all hops trusted: X-Real-IP ignored
+		{"10.0.0.5:1234", "bogus, 10.0.0.9", "198.51.100.2", "10.0.0.5"},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/stats", nil)
+		req.RemoteAddr = tt.remote
+		if tt.xff != "" {
+			req.Header.Set("X-Forwarded-For", tt.xff)
+		}
+		if tt.realIP != "" {
+			req.Header.Set("X-Real-IP", tt.realIP)
+		}
+		if got := srv.resolveClientIP(req); got != tt.want {
+			t.Errorf("remote=%s xff=%q real=%q: got %s, want %s", tt.remote, tt.xff, tt.realIP, got, tt.want)
+		}
+	}
+}
+
+func TestCORSPreflight(t *testing.T) {
+	srv := newTestServer()
+	srv.cfg.CORS.AllowedOrigins = []string{"https://dash.example.com"}
+
+	handler := srv.corsMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	req := httptest.NewRequest(http.MethodOptions, "/stats", nil)
+	req.Header.Set("Origin", "https://dash.example.com")
+	req.Header.Set("Access-Control-Request-Method", "GET")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNoContent {
+		t.Errorf("expected 204 for preflight, got %d", w.Code)
+	}
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "https://dash.example.com" {
+		t.Errorf("unexpected Allow-Origin %q", got)
+	}
+
+	// Disallowed origin gets no CORS headers
+	req = httptest.NewRequest(http.MethodGet, "/stats", nil)
+	req.Header.Set("Origin", "https://evil.example.com")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "" {
+		t.Errorf("expected no Allow-Origin for disallowed origin, got %q", got)
+	}
+}
+
+func TestAuthLockoutBansAndAlerts(t *testing.T) {
+	srv := newTestServer()
+	srv.cfg.AuthToken = "secret"
+
+	handler := srv.authMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	send := func(token string) int {
+		req := httptest.NewRequest(http.MethodGet, "/stats", nil)
+		req.RemoteAddr = "192.168.1.9:1234"
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	for i := 0; i < authFailureLimit; i++ {
+		if code := send("wrong"); code != http.StatusUnauthorized {
+			t.Fatalf("attempt %d: expected 401, got %d", i, code)
+		}
+	}
+
+	// Banned now, even with the correct token
+	if code := send("secret"); code != http.StatusTooManyRequests {
+		t.Errorf("expected 429 while banned, got %d", code)
+	}
+
+	bans := srv.lockout.list()
+	if len(bans) != 1 || bans[0].IP != "192.168.1.9" {
+		t.Fatalf("unexpected ban list: %+v", bans)
+	}
+
+	active := srv.alerts.Active()
+	if len(active) != 1 || active[0].Type != "auth_bruteforce" {
+		t.Errorf("expected one auth_bruteforce alert, got %+v", active)
+	}
+}
+
+func TestTokenScopes(t *testing.T) {
+	srv := newTestServer()
+	srv.cfg.AuthToken = "admin"
+	srv.cfg.Tokens = []config.TokenConfig{
+		{Name: "dashboard", Token: "viewer", Scope: config.ScopeReadOnly},
+		{Name: "operator", Token: "operator", Scope: config.ScopeControl},
+	}
+
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+	srv.mux = http.NewServeMux()
+	srv.mux.HandleFunc("GET /stats", ok)
+	srv.handleMutating(srv.mux, "POST /containers/{id}/restart", ok)
+	srv.handleScoped(srv.mux, "POST /agent/restart", config.ScopeAdmin, ok)
+	handler := srv.authMiddleware(srv.mux)
+
+	cases := []struct {
+		token, method, path string
+		want                int
+	}{
+		{"viewer", http.MethodGet, "/stats", http.StatusOK},
+		{"viewer", http.MethodPost, "/containers/abc/restart", http.StatusForbidden},
+		{"operator", http.MethodPost, "/containers/abc/restart", http.StatusOK},
+		{"operator", http.MethodPost, "/agent/restart", http.StatusForbidden},
+		{"admin", http.MethodPost, "/agent/restart", http.StatusOK},
+		{"nobody", http.MethodGet, "/stats", http.StatusUnauthorized},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest(c.method, c.path, nil)
+		req.Header.Set("Authorization", "Bearer "+c.token)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code != c.want {
+			t.Errorf("%s %s with %s: expected %d, got %d", c.method, c.path, c.token, c.want, w.Code)
+		}
+		if w.Code == http.StatusForbidden && !strings.Contains(w.Body.String(), codeInsufficientScope) {
+			t.Errorf("%s %s with %s: expected %s, got %s", c.method, c.path, c.token, codeInsufficientScope, w.Body.String())
+		}
+	}
+}
+
+func TestTokenPolicy(t *testing.T) {
+	srv := newTestServer()
+	srv.cfg.Tokens = []config.TokenConfig{
+		{Name: "family", Token: "family", Scope: config.ScopeControl, Policy: []config.PolicyRule{
+			{Effect: "deny", Actions: []string{"process.kill"}},
+		}},
+		{Name: "media", Token: "media", Scope: config.ScopeControl, Policy: []config.PolicyRule{
+			{Effect: "allow", Actions: []string{"container.restart"}, Containers: []string{"plex"}},
+		}},
+	}
+
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+	srv.mux = http.NewServeMux()
+	srv.handleMutating(srv.mux, "POST /containers/{id}/restart", ok)
+	srv.handleMutating(srv.mux, "POST /processes/{pid}/kill", ok)
+	srv.handleMutating(srv.mux, "PUT /layout", ok)
+	handler := srv.authMiddleware(srv.mux)
+
+	cases := []struct {
+		token, method, path string
+		want                int
+	}{
+		{"family", http.MethodPost, "/processes/123/kill", http.StatusForbidden},
+		{"family", http.MethodPut, "/layout", http.StatusOK},
+		{"media", http.MethodPut, "/layout", http.StatusForbidden},
+		// Docker isn't running in tests, so no container is known and a
+		// container-limited allow can't match.
+		{"media", http.MethodPost, "/containers/plex/restart", http.StatusForbidden},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest(c.method, c.path, nil)
+		req.Header.Set("Authorization", "Bearer "+c.token)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code != c.want {
+			t.Errorf("%s %s with %s: expected %d, got %d", c.method, c.path, c.token, c.want, w.Code)
+		}
+		if w.Code == http.StatusForbidden && !strings.Contains(w.Body.String(), codePolicyDenied) {
+			t.Errorf("%s %s with %s: expected %s, got %s", c.method, c.path, c.token, codePolicyDenied, w.Body.String())
+		}
+	}
+}
+
+func TestSnapshotETag(t *testing.T) {
+	srv := newTestServer()
+
+	req := httptest.NewRequest(http.MethodGet, "/stats/docker", nil)
+	w := httptest.NewRecorder()
+	srv.handleDockerStats(w, req)
+
+	etag := w.Header().Get("ETag")
+	if w.Code != http.StatusOK || etag == "" {
+		t.Fatalf("expected 200 with ETag, got %d (ETag %q)", w.Code, etag)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/stats/docker", nil)
+	req.Header.Set("If-None-Match", etag)
+	w = httptest.NewRecorder()
+	srv.handleDockerStats(w, req)
+
+	if w.Code != http.StatusNotModified {
+		t.Errorf("expected 304 for matching ETag, got %d", w.Code)
+	}
+	if w.Body.Len() != 0 {
+		t.Errorf("expected empty body on 304, got %q", w.Body.String())
+	}
+}
+
+func TestErrorEnvelope(t *testing.T) {
+	srv := newTestServer()
+	srv.cfg.ReadOnly = true
+	handler := srv.readOnlyGuard(func(w http.ResponseWriter, r *http.Request) {})
+
+	// Legacy shape: error string plus code
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodPost, "/agent/stop", nil))
+	var legacy map[string]string
+	if err := json.NewDecoder(w.Body).Decode(&legacy); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if legacy["error"] == "" || legacy["code"] != codeReadOnly {
+		t.Errorf("unexpected legacy error body: %v", legacy)
+	}
+
+	// Envelope shape when requested
+	w = httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodPost, "/agent/stop?envelope=1", nil))
+	var env struct {
+		Error struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&env); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if env.Error.Code != codeReadOnly || env.Error.Message == "" {
+		t.Errorf("unexpected envelope error: %+v", env.Error)
+	}
+
+	w = httptest.NewRecorder()
+	srv.handleHealth(w, httptest.NewRequest(http.MethodGet, "/health?envelope=1", nil))
+	if body := w.Body.String(); body != "{\"data\":{\"status\":\"ok\"}}\n" {
+		t.Errorf("unexpected envelope data: %q", body)
+	}
+}
+
+func TestRequestIDPropagation(t *testing.T) {
+	srv := newTestServer()
+	srv.cfg.ReadOnly = true
+	handler := srv.requestLogMiddleware(srv.readOnlyGuard(func(w http.ResponseWriter, r *http.Request) {}))
+
+	req := httptest.NewRequest(http.MethodPost, "/agent/stop", nil)
+	req.Header.Set("X-Request-ID", "client-abc-123")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if got := w.Header().Get("X-Request-ID"); got != "client-abc-123" {
+		t.Errorf("expected incoming request ID to be echoed, got %q", got)
+	}
+	var body map[string]string
+	if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if body["requestId"] != "client-abc-123" {
+		t.Errorf("expected requestId in error body, got %v", body)
+	}
+
+	// Unsafe IDs are replaced
+	req = httptest.NewRequest(http.MethodPost, "/agent/stop", nil)
+	req.Header.Set("X-Request-ID", "bad id\nforged log line")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if got := w.Header().Get("X-Request-ID"); got == "" || got == "bad id\nforged log line" {
+		t.Errorf("expected a generated request ID, got %q", got)
+	}
+}
+
+func TestHistoryEndpoint(t *testing.T) {
+	srv := newTestServer()
+	now := time.Now()
+	for i := 10; i > 0; i-- {
+		srv.history.Record(history.MetricTemperature, now.Add(-time.Duration(i)*time.Second), float64(40+i))
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/stats/history?metric=temperature&window=5500ms", nil)
+	w := httptest.NewRecorder()
+	srv.handleHistory(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body)
+	}
+	var resp historyResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if len(resp.Samples) != 5 {
+		t.Errorf("expected 5 samples in a 5.5s window, got %d", len(resp.Samples))
+	}
+
+	for _, query := range []string{"metric=cpu", "metric=temperature&window=bogus", ""} {
+		req := httptest.NewRequest(http.MethodGet, "/stats/history?"+query, nil)
+		w := httptest.NewRecorder()
+		srv.handleHistory(w, req)
+		if w.Code == http.StatusOK {
+			t.Errorf("%q: expected an error status, got 200", query)
+		}
+	}
+}
+
+func TestHistorySummary(t *testing.T) {
+	srv := newTestServer()
+	now := time.Now().Truncate(time.Minute)
+	for i := 0; i < 120; i++ {
+		srv.history.Record(history.MetricCPU, now.Add(-2*time.Minute+time.Duration(i)*time.Second), float64(i%60))
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/stats/history/summary?metric=cpu&window=10m&resolution=1m", nil)
+	w := httptest.NewRecorder()
+	srv.handleHistorySummary(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body)
+	}
+	var resp historySummaryResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if len(resp.Buckets) != 2 {
+		t.Fatalf("expected 2 one-minute buckets, got %d", len(resp.Buckets))
+	}
+	b := resp.Buckets[0]
+	if b.Min != 0 || b.Max != 59 || b.Avg != 29.5 || b.P95 != 56 || b.Count != 60 {
+		t.Errorf("unexpected bucket %+v", b)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/stats/history/summary?metric=cpu&window=168h&resolution=1s", nil)
+	w = httptest.NewRecorder()
+	srv.handleHistorySummary(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for too many buckets, got %d", w.Code)
+	}
+}
+
+func TestLayoutIfMatch(t *testing.T) {
+	srv := newTestServer()
+
+	put := func(body, ifMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, "/layout", strings.NewReader(body))
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+		w := httptest.NewRecorder()
+		srv.handlePutLayout(w, req)
+		return w
+	}
+
+	w := put(`{"services":[{"id":"pihole"},{"id":"traefik","hidden":true}],"pinnedContainers":["plex"]}`, `"layout-0"`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("first save: expected 200, got %d: %s", w.Code, w.Body)
+	}
+	if etag := w.Header().Get("ETag"); etag != `"layout-1"` {
+		t.Errorf("expected ETag \"layout-1\", got %s", etag)
+	}
+
+	// A second client still holding revision 0 must not overwrite it.
+	if w := put(`{"services":[]}`, `"layout-0"`); w.Code != http.StatusPreconditionFailed {
+		t.Errorf("stale If-Match: expected 412, got %d", w.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/layout", nil)
+	w = httptest.NewRecorder()
+	srv.handleGetLayout(w, req)
+	var l Layout
+	if err := json.Unmarshal(w.Body.Bytes(), &l); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if l.Revision != 1 || len(l.Services) != 2 || !l.Services[1].Hidden || l.SummaryMetrics == nil {
+		t.Errorf("unexpected layout %+v", l)
+	}
+}
+
+func TestEventIngestSignature(t *testing.T) {
+	srv := newTestServer()
+	srv.cfg.Events.IngestSecret = "hook-secret"
+
+	body := `{"source":"restic","type":"backup.failed","severity":"critical","message":"repository locked"}`
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	// Each sender gets its own address so failures don't add up to a ban.
+	ingest := func(addr, timestamp, signature string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/events/ingest", strings.NewReader(body))
+		req.RemoteAddr = addr + ":1234"
+		if timestamp != "" {
+			req.Header.Set("X-Deskmon-Timestamp", timestamp)
+		}
+		if signature != "" {
+			req.Header.Set("X-Deskmon-Signature", signature)
+		}
+		w := httptest.NewRecorder()
+		srv.handleEventIngest(w, req)
+		return w
+	}
+
+	stale := strconv.FormatInt(time.Now().Add(-10*time.Minute).Unix(), 10)
+	tests := []struct {
+		name, timestamp, signature string
+	}{
+		{"no signature", now, ""},
+		{"bad signature", now, "sha256=00"},
+		{"body only signed", now, signIngest("hook-secret", "", body)},
+		{"other secret", now, signIngest("other", now, body)},
+		{"timestamp not signed", now, signIngest("hook-secret", stale, body)},
+		{"no timestamp", "", signIngest("hook-secret", "", body)},
+		{"stale timestamp", stale, signIngest("hook-secret", stale, body)},
+	}
+	for i, tt := range tests {
+		if w := ingest("192.0.2."+strconv.Itoa(10+i), tt.timestamp, tt.signature); w.Code != http.StatusUnauthorized {
+			t.Errorf("%s: expected 401, got %d", tt.name, w.Code)
+		}
+	}
+
+	signature := signIngest("hook-secret", now, body)
+	if w := ingest("192.0.2.1", now, signature); w.Code != http.StatusOK {
+		t.Fatalf("valid signature: expected 200, got %d: %s", w.Code, w.Body)
+	}
+	if w := ingest("192.0.2.2", now, signature); w.Code != http.StatusUnauthorized {
+		t.Errorf("replayed request: expected 401, got %d", w.Code)
+	}
+
+	srv.recordEvent(events.CategoryConfig, "config.layout", "client:127.0.0.1", events.SeverityInfo, "layout saved")
+
+	req := httptest.NewRequest(http.MethodGet, "/events?since=0&category=external", nil)
+	w := httptest.NewRecorder()
+	srv.handleEvents(w, req)
+	var resp eventsResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if len(resp.Events) != 1 || resp.Events[0].Type != "backup.failed" || resp.LatestID != 2 {
+		t.Errorf("unexpected timeline %+v", resp)
+	}
+}
+
+func TestEventIngestLimits(t *testing.T) {
+	srv := newTestServer()
+	srv.cfg.Events.IngestSecret = "hook-secret"
+	handler := srv.securityHeaders(http.HandlerFunc(srv.handleEventIngest))
+	ingest := func(body string) *httptest.ResponseRecorder {
+		now := strconv.FormatInt(time.Now().Unix(), 10)
+		req := httptest.NewRequest(http.MethodPost, "/events/ingest", strings.NewReader(body))
+		req.Header.Set("X-Deskmon-Timestamp", now)
+		req.Header.Set("X-Deskmon-Signature", signIngest("hook-secret", now, body))
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	big := `{"source":"x","type":"y","message":"` + strings.Repeat("a", maxEventIngestBody) + `"}`
+	if w := ingest(big); w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("oversized body: expected 413, got %d", w.Code)
+	}
+
+	// A two-byte character straddles the limit and must not be cut in half.
+	msg := strings.Repeat("a", maxEventMessage-1) + "é"
+	if w := ingest(`{"source":"x","type":"y","message":"` + msg + `"}`); w.Code != http.StatusOK {
+		t.Fatalf("long message: expected 200, got %d: %s", w.Code, w.Body)
+	}
+	got := srv.events.Since(0)[0].Message
+	if len(got) != maxEventMessage-1 || !utf8.ValidString(got) {
+		t.Errorf("message truncated to %d bytes (valid UTF-8 %v), want %d", len(got), utf8.ValidString(got), maxEventMessage-1)
+	}
+}
+
+// signIngest signs body the way an ingest sender does.
+func signIngest(secret, timestamp, body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "." + body))
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestStatsPollResumesFromEventID(t *testing.T) {
+	srv := newTestServer()
+	defer close(srv.stopCh)
+
+	done := make(chan pollResponse)
+	go func() {
+		w := httptest.NewRecorder()
+		srv.handleStatsPoll(w, httptest.NewRequest(http.MethodGet, "/stats/poll?since=0&timeout=5s", nil))
+		var resp pollResponse
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		done <- resp
+	}()
+
+	// The log subscribes on the first poll; send until it has picked one up.
+	var resp pollResponse
+	for received := false; !received; {
+		srv.events.Broadcast.Send(events.Event{Type: "test.event"})
+		select {
+		case resp = <-done:
+			received = true
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	if len(resp.Events) == 0 || resp.Events[0].Event != "event" || resp.Next != resp.Events[len(resp.Events)-1].ID {
+		t.Fatalf("unexpected first poll: %+v", resp)
+	}
+
+	w := httptest.NewRecorder()
+	srv.handleStatsPoll(w, httptest.NewRequest(http.MethodGet, "/stats/poll?timeout=0s&since="+strconv.FormatUint(resp.Next, 10), nil))
+	var empty pollResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &empty); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if len(empty.Events) != 0 || empty.Next != resp.Next || empty.Reset {
+		t.Errorf("poll after the latest ID should time out empty, got %+v", empty)
+	}
+
+	w = httptest.NewRecorder()
+	srv.handleStatsPoll(w, httptest.NewRequest(http.MethodGet, "/stats/poll?timeout=0s&since=999999", nil))
+	var reset pollResponse
+	json.Unmarshal(w.Body.Bytes(), &reset)
+	if !reset.Reset {
+		t.Errorf("since beyond the newest ID should reset, got %+v", reset)
+	}
+}
+
+func TestStatsCBORNegotiation(t *testing.T) {
+	srv := newTestServer()
+
+	req := httptest.NewRequest(http.MethodGet, "/stats/system", nil)
+	req.Header.Set("Accept", "application/cbor")
+	w := httptest.NewRecorder()
+	srv.handleSystemStats(w, req)
+
+	if ct := w.Header().Get("Content-Type"); ct != "application/cbor" {
+		t.Fatalf("Content-Type = %q, want application/cbor", ct)
+	}
+	body := w.Body.Bytes()
+	if len(body) == 0 || body[0]>>5 != 5 {
+		t.Fatalf("body does not start with a CBOR map: % x", body[:min(len(body), 8)])
+	}
+
+	// The ETag follows the encoding, so a JSON ETag doesn't match CBOR.
+	jsonReq := httptest.NewRequest(http.MethodGet, "/stats/system", nil)
+	jw := httptest.NewRecorder()
+	srv.handleSystemStats(jw, jsonReq)
+	if jw.Header().Get("ETag") == w.Header().Get("ETag") {
+		t.Error("JSON and CBOR responses share an ETag")
+	}
+}
+
+func TestWebSocketStream(t *testing.T) {
+	srv := newTestServer()
+	defer close(srv.stopCh)
+	ts := httptest.NewServer(http.HandlerFunc(srv.handleWebSocket))
+	defer ts.Close()
+
+	conn, err := net.Dial("tcp", ts.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	const key = "dGhlIHNhbXBsZSBub25jZQ=="
+	io.WriteString(conn, "GET /ws HTTP/1.1\r\nHost: "+ts.Listener.Addr().String()+
+		"\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Key: "+key+
+		"\r\nSec-WebSocket-Version: 13\r\n\r\n")
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols || resp.Header.Get("Sec-WebSocket-Accept") != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("handshake: %d, accept %q", resp.StatusCode, resp.Header.Get("Sec-WebSocket-Accept"))
+	}
+
+	// Server frames are small and unmasked here.
+	readFrame := func() (byte, []byte) {
+		var head [2]byte
+		if _, err := io.ReadFull(br, head[:]); err != nil {
+			t.Fatal(err)
+		}
+		n := int(head[1] & 0x7F)
+		if n == 126 {
+			var ext [2]byte
+			io.ReadFull(br, ext[:])
+			n = int(binary.BigEndian.Uint16(ext[:]))
+		}
+		payload := make([]byte, n)
+		if _, err := io.ReadFull(br, payload); err != nil {
+			t.Fatal(err)
+		}
+		return head[0] & 0x0F, payload
+	}
+
+	// A masked client ping comes back as a pong with the same payload.
+	mask := []byte{1, 2, 3, 4}
+	ping := []byte{0x80 | wsOpPing, 0x80 | 2}
+	ping = append(ping, mask...)
+	ping = append(ping, 'h'^mask[0], 'i'^mask[1])
+	conn.Write(ping)
+
+	var gotPong, gotEvent bool
+	for !gotPong || !gotEvent {
+		srv.events.Broadcast.Send(events.Event{Type: "test.event"})
+		op, payload := readFrame()
+		switch op {
+		case wsOpPong:
+			if string(payload) != "hi" {
+				t.Errorf("pong payload = %q, want hi", payload)
+			}
+			gotPong = true
+		case wsOpText:
+			var msg struct {
+				Event string          `json:"event"`
+				Data  json.RawMessage `json:"data"`
+			}
+			if err := json.Unmarshal(payload, &msg); err != nil {
+				t.Fatalf("invalid message %q: %v", payload, err)
+			}
+			if msg.Event == "event" && strings.Contains(string(msg.Data), "test.event") {
+				gotEvent = true
+			}
+		}
+	}
+}
+
+func TestSelfSignedCertificateOnFirstStart(t *testing.T) {
+	dir := t.TempDir()
+	srv := newTestServer()
+	srv.cfg.TLSCert = filepath.Join(dir, "tls", "cert.pem")
+	srv.cfg.TLSKey = filepath.Join(dir, "tls", "key.pem")
+
+	first, err := srv.serverTLSConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := os.Stat(srv.cfg.TLSKey); err != nil || fi.Mode().Perm() != 0o600 {
+		t.Fatalf("key file: %v, mode %v", err, fi.Mode())
+	}
+	leaf, err := x509.ParseCertificate(first.Certificates[0].Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := leaf.VerifyHostname("localhost"); err != nil {
+		t.Errorf("certificate not valid for localhost: %v", err)
+	}
+	if err := leaf.VerifyHostname("127.0.0.1"); err != nil {
+		t.Errorf("certificate not valid for 127.0.0.1: %v", err)
+	}
+
+	// The next start reuses the pair instead of generating a new one.
+	second, err := srv.serverTLSConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(first.Certificates[0].Certificate[0], second.Certificates[0].Certificate[0]) {
+		t.Error("certificate was regenerated on the second start")
+	}
+}
+
+func TestSnapshotCacheSharesEncode(t *testing.T) {
+	c := newResponseCache(time.Hour)
+	var builds atomic.Int32
+	release := make(chan struct{})
+	build := func() (*encodedResponse, error) {
+		builds.Add(1)
+		<-release
+		return &encodedResponse{body: []byte("{}"), etag: `"x"`}, nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if enc, err := c.get("stats", build); err != nil || string(enc.body) != "{}" {
+				t.Errorf("get = %v, %v", enc, err)
+			}
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if n := builds.Load(); n != 1 {
+		t.Errorf("built %d times for concurrent requests, want 1", n)
+	}
+
+	if _, err := c.get("stats|cbor", build); err != nil {
+		t.Fatal(err)
+	}
+	if n := builds.Load(); n != 2 {
+		t.Errorf("a different key reused the cached entry")
+	}
+}
+
+func BenchmarkStatsSnapshot(b *testing.B) {
+	srv := newTestServer()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		srv.statsSnapshot()
+	}
+}
+
+func BenchmarkStatsEncodeJSON(b *testing.B) {
+	srv := newTestServer()
+	snap := srv.statsSnapshot()
+	req := httptest.NewRequest(http.MethodGet, "/stats", nil)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := encodeSnapshot(req, snap); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkStatsEncodeCBOR(b *testing.B) {
+	srv := newTestServer()
+	snap := srv.statsSnapshot()
+	req := httptest.NewRequest(http.MethodGet, "/stats", nil)
+	req.Header.Set("Accept", "application/cbor")
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := encodeSnapshot(req, snap); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkStatsHandlerParallel measures many pollers hitting /stats at
+// once, which the snapshot cache turns into mostly copies of one body.
+func BenchmarkStatsHandlerParallel(b *testing.B) {
+	srv := newTestServer()
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			w := httptest.NewRecorder()
+			srv.handleStats(w, httptest.NewRequest(http.MethodGet, "/stats", nil))
+		}
+	})
+}
+
+func TestJournalRejectsBadQuery(t *testing.T) {
+	srv := newTestServer()
+	for _, query := range []string{"unit=--since=today", "priority=loud", "priority=8", "tail=0", "tail=5000"} {
+		req := httptest.NewRequest(http.MethodGet, "/logs/journal?"+query, nil)
+		w := httptest.NewRecorder()
+		srv.handleJournal(w, req)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%q: expected 400, got %d", query, w.Code)
+		}
+	}
+}
+
+func TestConfirmDestructive(t *testing.T) {
+	srv := newTestServer()
+	srv.cfg.ConfirmDestructive = true
+	calls := 0
+	handler := srv.confirmGuard(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusOK)
+	})
+
+	do := func(path, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, nil)
+		if token != "" {
+			req.Header.Set(confirmHeader, token)
+		}
+		w := httptest.NewRecorder()
+		handler(w, req)
+		return w
+	}
+	confirmToken := func(w *httptest.ResponseRecorder) string {
+		var resp legacyErrorResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.Confirm == nil {
+			t.Fatalf("expected a confirmation token, got %s", w.Body)
+		}
+		return resp.Confirm.Token
+	}
+
+	w := do("/containers/abc/stop", "")
+	if w.Code != http.StatusPreconditionRequired || calls != 0 {
+		t.Fatalf("expected 428 without running the action, got %d (%d calls)", w.Code, calls)
+	}
+	token := confirmToken(w)
+
+	if w := do("/containers/other/stop", token); w.Code != http.StatusPreconditionRequired || calls != 0 {
+		t.Errorf("token for another request: expected 428, got %d (%d calls)", w.Code, calls)
+	}
+	// The mismatched attempt used the token up.
+	if w := do("/containers/abc/stop", token); w.Code != http.StatusPreconditionRequired {
+		t.Errorf("reused token: expected 428, got %d", w.Code)
+	}
+
+	token = confirmToken(do("/containers/abc/stop", ""))
+	if w := do("/containers/abc/stop", token); w.Code != http.StatusOK || calls != 1 {
+		t.Errorf("confirmed request: expected 200 and one call, got %d (%d calls)", w.Code, calls)
+	}
+}
+
+func TestSessionTokens(t *testing.T) {
+	srv := newTestServer()
+	srv.cfg.Tokens = []config.TokenConfig{{Name: "app", Token: "app-token", Scope: config.ScopeControl}}
+
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+	srv.mux = http.NewServeMux()
+	srv.mux.HandleFunc("GET /stats/stream", ok)
+	srv.mux.HandleFunc("POST /auth/session", srv.handleSession)
+	srv.handleMutating(srv.mux, "POST /containers/{id}/restart", ok)
+	handler := srv.authMiddleware(srv.mux)
+
+	do := func(method, path, bearer, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if bearer != "" {
+			req.Header.Set("Authorization", "Bearer "+bearer)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do(http.MethodPost, "/auth/session", "app-token", `{"scope": "read-only"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body)
+	}
+	var resp sessionResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if resp.Scope != config.ScopeReadOnly || time.Until(resp.ExpiresAt) > defaultSessionTTL {
+		t.Errorf("expected a read-only session of at most %s, got %+v", defaultSessionTTL, resp)
+	}
+
+	if w := do(http.MethodGet, "/stats/stream?access_token="+resp.Token, "", ""); w.Code != http.StatusOK {
+		t.Errorf("session in access_token: expected 200, got %d", w.Code)
+	}
+	if w := do(http.MethodGet, "/stats/stream?access_token=app-token", "", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("configured token in access_token: expected 401, got %d", w.Code)
+	}
+	if w := do(http.MethodPost, "/containers/abc/restart?access_token="+resp.Token, "", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("session in access_token on a POST: expected 401, got %d", w.Code)
+	}
+	if w := do(http.MethodPost, "/containers/abc/restart", resp.Token, ""); w.Code != http.StatusForbidden {
+		t.Errorf("read-only session on a control route: expected 403, got %d", w.Code)
+	}
+	if w := do(http.MethodPost, "/auth/session", resp.Token, ""); w.Code != http.StatusForbidden {
+		t.Errorf("session exchanged for a session: expected 403, got %d", w.Code)
+	}
+
+	srv.cfg.Tokens[0].Name = "renamed"
+	if w := do(http.MethodGet, "/stats/stream?access_token="+resp.Token, "", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("session of a renamed token: expected 401, got %d", w.Code)
+	}
+}
+
+func TestBodyValidation(t *testing.T) {
+	srv := newTestServer()
+	srv.cfg.FanControl.Enabled = true
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		body    string
+		code    string
+		fields  []string
+	}{
+		{"syntax", srv.handleServiceAction, `{"action": }`, codeInvalidJSON, []string{""}},
+		{"empty", srv.handleServiceAction, ``, codeInvalidJSON, []string{""}},
+		{"required", srv.handleServiceAction, `{"params": {}}`, codeValidationFailed, []string{"action"}},
+		{"unknown field", srv.handleServiceAction, `{"acton": "restart"}`, codeValidationFailed, []string{"acton"}},
+		{"wrong type", srv.handleFanSet, `{"pwm": "high"}`, codeValidationFailed, []string{"pwm"}},
+		{"out of range", srv.handleFanSet, `{"pwm": 300}`, codeValidationFailed, []string{"pwm"}},
+		{"oneof", srv.handleFanSet, `{"mode": "turbo"}`, codeValidationFailed, []string{"mode"}},
+		{"several", srv.handlePushCustomMetrics, `{"ttl": "forever", "metrics": [{"name": "ok", "value": 1}, {"name": "bad name", "value": 1}]}`, codeValidationFailed, []string{"ttl", "metrics[1]"}},
+		{"nested", srv.handlePutLayout, `{"services": [{"id": "pihole"}, {"id": ""}]}`, codeValidationFailed, []string{"services[1].id"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			tt.handler(w, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body)))
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("expected 400, got %d: %s", w.Code, w.Body)
+			}
+			var resp legacyErrorResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("invalid JSON: %v", err)
+			}
+			var fields []string
+			for _, f := range resp.Fields {
+				fields = append(fields, f.Field)
+			}
+			if resp.Code != tt.code || !slices.Equal(fields, tt.fields) || resp.Error == "" {
+				t.Errorf("expected %s on %v, got %s on %v: %s", tt.code, tt.fields, resp.Code, fields, resp.Error)
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/neur0map/deskmon-agent/internal/events"
+)
+
+type serviceActionRequest struct {
+	Action string                 `json:"action" validate:"required"`
+	Params map[string]interface{} `json:"params"`
+}
+
+type serviceActionResponse struct {
+	Message string `json:"message"`
+	Result  string `json:"result"`
+}
+
+func (s *Server) handleServiceStats(w http.ResponseWriter, r *http.Request) {
+	s.writeSnapshot(w, r, "services", func() interface{} { return s.services.Collect() })
+}
+
+func (s *Server) handleServicesDebug(w http.ResponseWriter, r *http.Request) {
+	writeData(w, r, s.services.DebugInfo())
+}
+
+// handleServiceConfigure stores plugin settings (e.g. {"password": "..."})
+// and persists them to the config file so they survive restarts.
+func (s *Server) handleServiceConfigure(w http.ResponseWriter, r *http.Request) {
+	pluginID := r.PathValue("pluginId")
+
+	var values map[string]string
+	if !decodeBody(w, r, &values, false) {
+		return
+	}
+	if len(values) == 0 {
+		writeFieldErrors(w, r, codeValidationFailed, []fieldError{{Message: `no settings given, e.g. {"password": "..."}`}})
+		return
+	}
+
+	for key, value := range values {
+		s.services.SetServiceConfig(pluginID, key, value)
+	}
+
+	s.cfgMu.Lock()
+	if s.cfg.Services == nil {
+		s.cfg.Services = make(map[string]map[string]string)
+	}
+	if s.cfg.Services[pluginID] == nil {
+		s.cfg.Services[pluginID] = make(map[string]string)
+	}
+	for key, value := range values {
+		s.cfg.Services[pluginID][key] = value
+	}
+	var saveErr error
+	if s.configPath != "" {
+		saveErr = s.cfg.Save(s.configPath)
+	}
+	s.cfgMu.Unlock()
+
+	if saveErr != nil {
+		logf(r, "services: failed to persist config for %s: %v", pluginID, saveErr)
+		writeError(w, r, http.StatusInternalServerError, codeInternal, "failed to save config")
+		return
+	}
+
+	keys := slices.Sorted(maps.Keys(values))
+	s.recordEvent(events.CategoryConfig, "config.service", "service:"+pluginID, events.SeverityInfo, fmt.Sprintf("%s settings changed (%s)", pluginID, strings.Join(keys, ", ")))
+	writeData(w, r, controlResponse{Message: "configured"})
+}
+
+func (s *Server) handleServiceAction(w http.ResponseWriter, r *http.Request) {
+	pluginID := r.PathValue("pluginId")
+
+	var req serviceActionRequest
+	if !decodeBody(w, r, &req, false) {
+		return
+	}
+
+	// Only the actions a plugin marks destructive need confirming, so the
+	// token is tied to the action as well as the path.
+	if s.cfg.ConfirmDestructive && s.services.IsDestructiveAction(pluginID, req.Action, req.Params) &&
+		!s.confirmed(w, r, r.Method+" "+r.URL.Path+" "+req.Action) {
+		return
+	}
+
+	ip := clientIP(r)
+	logf(r, "service action %s/%s requested from %s", pluginID, req.Action, ip)
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	result, err := s.services.PerformAction(ctx, pluginID, req.Action, req.Params)
+	if err != nil {
+		logf(r, "service action %s/%s: error: %v", pluginID, req.Action, err)
+		writeError(w, r, http.StatusInternalServerError, codeActionFailed, err.Error())
+		return
+	}
+
+	logf(r, "service action %s/%s: success (from %s)", pluginID, req.Action, ip)
+	writeData(w, r, serviceActionResponse{Message: "ok", Result: result})
+}
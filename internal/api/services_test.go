@@ -0,0 +1,51 @@
+//go:build !noplugins
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestServiceActionConfirmDestructive(t *testing.T) {
+	srv := newTestServer()
+	srv.cfg.ConfirmDestructive = true
+
+	do := func(body, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/services/proxmox/action", strings.NewReader(body))
+		req.SetPathValue("pluginId", "proxmox")
+		if token != "" {
+			req.Header.Set(confirmHeader, token)
+		}
+		w := httptest.NewRecorder()
+		srv.handleServiceAction(w, req)
+		return w
+	}
+
+	// Proxmox isn't detected here, so an action that gets past the
+	// confirmation fails with 500.
+	if w := do(`{"action":"startVM","params":{"vmid":100}}`, ""); w.Code != http.StatusInternalServerError {
+		t.Errorf("startVM: expected it to run without confirmation, got %d", w.Code)
+	}
+	w := do(`{"action":"stopVM","params":{"vmid":100}}`, "")
+	if w.Code != http.StatusPreconditionRequired {
+		t.Fatalf("stopVM: expected 428, got %d", w.Code)
+	}
+	var resp legacyErrorResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.Confirm == nil {
+		t.Fatalf("expected a confirmation token, got %s", w.Body)
+	}
+	if w := do(`{"action":"rebootVM","params":{"vmid":100}}`, resp.Confirm.Token); w.Code != http.StatusPreconditionRequired {
+		t.Errorf("stopVM's token for rebootVM: expected 428, got %d", w.Code)
+	}
+
+	w = do(`{"action":"stopVM","params":{"vmid":100}}`, "")
+	resp = legacyErrorResponse{}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if w := do(`{"action":"stopVM","params":{"vmid":100}}`, resp.Confirm.Token); w.Code != http.StatusInternalServerError {
+		t.Errorf("confirmed stopVM: expected it to run, got %d", w.Code)
+	}
+}
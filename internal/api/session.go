@@ -0,0 +1,166 @@
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/neur0map/deskmon-agent/internal/config"
+)
+
+const defaultSessionTTL = 15 * time.Minute
+
+// sessionHeader is the fixed JOSE header of session tokens.
+var sessionHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+// sessionClaims are the claims of a session token. Index is the token it
+// was issued from: -1 for auth_token, i for tokens[i].
+type sessionClaims struct {
+	Subject   string `json:"sub"` // token name
+	Scope     string `json:"scope"`
+	Index     int    `json:"tid"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+type sessionRequest struct {
+	Scope string `json:"scope,omitempty" validate:"oneof=read-only control admin"` // narrower than the token's own
+}
+
+type sessionResponse struct {
+	Token     string    `json:"token"`
+	TokenType string    `json:"tokenType"`
+	Scope     string    `json:"scope"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+func newSessionKey() []byte {
+	key := make([]byte, 32)
+	rand.Read(key)
+	return key
+}
+
+// signSession returns the HS256 JWT for claims.
+func (s *Server) signSession(c sessionClaims) string {
+	payload, _ := json.Marshal(c)
+	unsigned := sessionHeader + "." + base64.RawURLEncoding.EncodeToString(payload)
+	mac := hmac.New(sha256.New, s.sessionKey)
+	mac.Write([]byte(unsigned))
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// verifySession checks a session token's signature and expiry.
+func (s *Server) verifySession(token string, now time.Time) (sessionClaims, error) {
+	var c sessionClaims
+	header, rest, ok := strings.Cut(token, ".")
+	if !ok || header != sessionHeader {
+		return c, errors.New("not a session token")
+	}
+	payload, sig, ok := strings.Cut(rest, ".")
+	if !ok {
+		return c, errors.New("not a session token")
+	}
+	got, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil {
+		return c, errors.New("bad signature")
+	}
+	mac := hmac.New(sha256.New, s.sessionKey)
+	mac.Write([]byte(header + "." + payload))
+	if !hmac.Equal(got, mac.Sum(nil)) {
+		return c, errors.New("bad signature")
+	}
+	data, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil || json.Unmarshal(data, &c) != nil {
+		return c, errors.New("bad claims")
+	}
+	if now.Unix() >= c.ExpiresAt {
+		return c, errors.New("expired")
+	}
+	return c, nil
+}
+
+// lookupSession resolves a session token to the token it was issued from.
+// It is void once that token is removed or renamed; its scope is the
+// narrower of the one it carries and the token's current one, and the
+// token's current policy applies.
+func (s *Server) lookupSession(token string) (name, scope string, policy []config.PolicyRule) {
+	c, err := s.verifySession(token, time.Now())
+	if err != nil {
+		return "", "", nil
+	}
+	current := ""
+	switch {
+	case c.Index == -1 && c.Subject == "default" && s.cfg.AuthToken != "":
+		current = config.ScopeAdmin
+	case c.Index >= 0 && c.Index < len(s.cfg.Tokens):
+		t := s.cfg.Tokens[c.Index]
+		if tokenName(t, c.Index) != c.Subject {
+			return "", "", nil
+		}
+		current, policy = t.Scope, t.Policy
+	default:
+		return "", "", nil
+	}
+	scope = c.Scope
+	if !config.ScopeAllows(current, scope) {
+		scope = current
+	}
+	return c.Subject, scope, policy
+}
+
+// handleSession exchanges the long-lived bearer token for a session token
+// that expires after session_ttl (default 15 minutes), for the places a
+// client can only put credentials in the URL: ?access_token= on the SSE
+// stream, the long-poll endpoint and the WebSocket. Session tokens can't
+// be exchanged again.
+func (s *Server) handleSession(w http.ResponseWriter, r *http.Request) {
+	if !s.cfg.AuthEnabled() {
+		writeError(w, r, http.StatusNotFound, codeNotFound, "sessions need auth_token or tokens in the config")
+		return
+	}
+	index, ok := s.matchToken(bearerToken(r))
+	if !ok {
+		writeError(w, r, http.StatusForbidden, codeForbidden, "a session must be requested with a configured token, not a session")
+		return
+	}
+
+	var req sessionRequest
+	if !decodeBody(w, r, &req, true) {
+		return
+	}
+
+	name, scope := "default", config.ScopeAdmin
+	if index >= 0 {
+		name, scope = tokenName(s.cfg.Tokens[index], index), s.cfg.Tokens[index].Scope
+	}
+	if req.Scope != "" {
+		if !config.ScopeAllows(scope, req.Scope) {
+			writeFieldErrors(w, r, codeValidationFailed, []fieldError{{Field: "scope", Message: fmt.Sprintf("%q isn't within the token's %s scope", req.Scope, scope)}})
+			return
+		}
+		scope = req.Scope
+	}
+
+	ttl := s.cfg.SessionTTL
+	if ttl <= 0 {
+		ttl = defaultSessionTTL
+	}
+	now := time.Now()
+	exp := now.Add(ttl).Truncate(time.Second)
+	session := s.signSession(sessionClaims{
+		Subject:   name,
+		Scope:     scope,
+		Index:     index,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: exp.Unix(),
+	})
+	logf(r, "session issued to %s (%s) until %s", name, scope, exp.Format(time.RFC3339))
+	writeData(w, r, sessionResponse{Token: session, TokenType: "Bearer", Scope: scope, ExpiresAt: exp.UTC()})
+}
@@ -0,0 +1,62 @@
+//go:build !nodocker
+
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/neur0map/deskmon-agent/internal/collector"
+	"github.com/neur0map/deskmon-agent/internal/collector/services"
+	"github.com/neur0map/deskmon-agent/internal/config"
+	"github.com/neur0map/deskmon-agent/internal/fakehost"
+)
+
+// TestStatsETagStableBetweenSamples checks that /stats with sampled data
+// keeps its ETag until the data changes, so pollers get 304s.
+func TestStatsETagStableBetweenSamples(t *testing.T) {
+	d := fakehost.NewDocker(fakehost.DockerOptions{}, fakehost.Container{Name: "web", Image: "nginx:1.27"})
+	defer d.Close()
+
+	docker := collector.NewDockerCollector(d.Host)
+	docker.Start()
+	deadline := time.Now().Add(5 * time.Second)
+	for docker.SampleInfo().SampledAt.IsZero() {
+		if time.Now().After(deadline) {
+			t.Fatal("docker collector never refreshed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	docker.Stop()
+
+	srv := NewServer(&config.Config{Port: 7654, Bind: "127.0.0.1"}, collector.NewSystemCollector(), docker,
+		services.NewServiceDetector(d.Host), "test", "")
+	srv.snapshots = newResponseCache(0) // encode every request afresh
+
+	// Disk usage is read live from the test machine and can move between
+	// two requests, so allow a few tries. A per-request field such as an
+	// age in milliseconds would make every try differ.
+	for try := 0; ; try++ {
+		w := httptest.NewRecorder()
+		srv.handleStats(w, httptest.NewRequest(http.MethodGet, "/stats", nil))
+		etag := w.Header().Get("ETag")
+		if w.Code != http.StatusOK || etag == "" {
+			t.Fatalf("expected 200 with ETag, got %d (ETag %q)", w.Code, etag)
+		}
+
+		time.Sleep(5 * time.Millisecond)
+		req := httptest.NewRequest(http.MethodGet, "/stats", nil)
+		req.Header.Set("If-None-Match", etag)
+		w = httptest.NewRecorder()
+		srv.handleStats(w, req)
+		if w.Code == http.StatusNotModified {
+			return
+		}
+		if try == 4 {
+			t.Fatalf("ETag changed between requests with no new sample: %q, then %q (status %d)",
+				etag, w.Header().Get("ETag"), w.Code)
+		}
+	}
+}
@@ -3,46 +3,128 @@ package api
 import (
 	"encoding/json"
 	"fmt"
-	"log"
 	"net/http"
 	"time"
+
+	"github.com/neur0map/deskmon-agent/internal/cbor"
+	"github.com/neur0map/deskmon-agent/internal/collector"
+	"github.com/neur0map/deskmon-agent/internal/updater"
 )
 
 // handleStatsStream serves an SSE stream of live stats updates.
-// Events: "system" (1s), "docker" (5s), keepalive (15s).
+// Events: "system" (1s), "docker" (5s), "services" (10s), "dockerStatus",
+// "alert" and "customMetrics" (on change), "event" (each timeline entry),
+// "docker-events" (each container lifecycle event),
+// "update" (after each auto-update), keepalive (15s), and "meta" when the
+// client has fallen behind and events were dropped. ?coalesce=true makes
+// snapshot events skip to the latest value instead. ?delta=true sends
+// snapshot events as JSON Patch deltas with periodic keyframes. Clients
+// sending Accept: application/cbor get a CBOR sequence instead of SSE.
 func (s *Server) handleStatsStream(w http.ResponseWriter, r *http.Request) {
 	flusher, ok := w.(http.Flusher)
 	if !ok {
-		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		writeError(w, r, http.StatusInternalServerError, codeStreamingFailed, "streaming not supported")
 		return
 	}
 
 	ip := clientIP(r)
-	log.Printf("SSE stream opened from %s", ip)
+	logf(r, "SSE stream opened from %s", ip)
 
 	// Ensure no write deadline for this long-lived connection
 	rc := http.NewResponseController(w)
 	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
-		log.Printf("SSE: SetWriteDeadline failed (non-fatal): %v", err)
+		logf(r, "SSE: SetWriteDeadline failed (non-fatal): %v", err)
 	}
 
-	// Set SSE headers
-	w.Header().Set("Content-Type", "text/event-stream")
+	// Set SSE headers, or CBOR sequence ones for binary clients
+	binaryStream := wantsCBOR(r)
+	if binaryStream {
+		w.Header().Set("Content-Type", cborSeqContentType)
+	} else {
+		w.Header().Set("Content-Type", "text/event-stream")
+	}
 	w.Header().Set("Cache-Control", "no-cache")
 	w.Header().Set("Connection", "keep-alive")
 	w.Header().Set("X-Accel-Buffering", "no") // Disable nginx/proxy buffering
 	flusher.Flush()
 
-	// Send initial comment to bust through client-side buffers and confirm connection
-	fmt.Fprintf(w, ": connected\n\n")
+	// Send an initial comment (or keepalive item) to bust through
+	// client-side buffers and confirm the connection
+	if binaryStream {
+		item, _ := cbor.Marshal(streamItem{Event: "connected"})
+		w.Write(item)
+	} else {
+		fmt.Fprintf(w, ": connected\n\n")
+	}
 	flusher.Flush()
 
+	// Snapshot streams can coalesce: a lagging client gets the newest
+	// snapshot instead of whatever happened to fit in its buffer. Alerts,
+	// events and updates are discrete and always keep their order.
+	snapshotMode := collector.DropNewest
+	coalesce := r.URL.Query().Get("coalesce") == "true"
+	if coalesce {
+		snapshotMode = collector.KeepLatest
+	}
+
 	// Subscribe to all broadcasters
-	sysCh, sysCleanup := s.system.Broadcast.Subscribe(2)
-	defer sysCleanup()
+	sysSub := s.system.Broadcast.SubscribeMode(2, snapshotMode)
+	defer sysSub.Close()
+
+	dockerSub := s.docker.Broadcast.SubscribeMode(2, snapshotMode)
+	defer dockerSub.Close()
+
+	dockerStatusSub := s.docker.StatusBroadcast.SubscribeMode(2, snapshotMode)
+	defer dockerStatusSub.Close()
+
+	dockerEventSub := s.docker.EventBroadcast.SubscribeMode(16, collector.DropNewest)
+	defer dockerEventSub.Close()
+
+	servicesSub := s.services.Broadcast.SubscribeMode(2, snapshotMode)
+	defer servicesSub.Close()
+
+	alertSub := s.alerts.Broadcast.SubscribeMode(8, collector.DropNewest)
+	defer alertSub.Close()
+
+	customSub := s.custom.Broadcast.SubscribeMode(2, snapshotMode)
+	defer customSub.Close()
+
+	eventSub := s.events.Broadcast.SubscribeMode(8, collector.DropNewest)
+	defer eventSub.Close()
+
+	// nil channel (never ready) when auto-update is off
+	var updateCh <-chan updater.Result
+	var updateSub *collector.Subscription[updater.Result]
+	if s.updater != nil {
+		updateSub = s.updater.Broadcast.SubscribeMode(4, collector.DropNewest)
+		defer updateSub.Close()
+		updateCh = updateSub.C
+	}
+
+	dropped := func() map[string]uint64 {
+		counts := map[string]uint64{
+			"system":        sysSub.Dropped(),
+			"docker":        dockerSub.Dropped(),
+			"dockerStatus":  dockerStatusSub.Dropped(),
+			"docker-events": dockerEventSub.Dropped(),
+			"services":      servicesSub.Dropped(),
+			"alert":         alertSub.Dropped(),
+			"customMetrics": customSub.Dropped(),
+			"event":         eventSub.Dropped(),
+		}
+		if updateSub != nil {
+			counts["update"] = updateSub.Dropped()
+		}
+		return counts
+	}
+	var reportedDrops uint64
 
-	dockerCh, dockerCleanup := s.docker.Broadcast.Subscribe(2)
-	defer dockerCleanup()
+	enc := &sseEncoder{w: w, flusher: flusher, cbor: binaryStream}
+	if r.URL.Query().Get("delta") == "true" {
+		enc.last = make(map[string]*sseSnapshot)
+	}
+	lagCheck := time.NewTicker(sseLagCheckInterval)
+	defer lagCheck.Stop()
 
 	keepalive := time.NewTicker(15 * time.Second)
 	defer keepalive.Stop()
@@ -52,28 +134,163 @@ func (s *Server) handleStatsStream(w http.ResponseWriter, r *http.Request) {
 	for {
 		select {
 		case <-ctx.Done():
-			log.Printf("SSE stream closed from %s", ip)
+			logf(r, "SSE stream closed from %s", ip)
 			return
 
-		case ev := <-sysCh:
-			writeSSE(w, flusher, "system", ev)
+		case ev := <-sysSub.C:
+			enc.snapshot("system", ev)
+
+		case ev := <-dockerSub.C:
+			enc.snapshot("docker", ev)
+
+		case ev := <-dockerStatusSub.C:
+			enc.snapshot("dockerStatus", ev)
+
+		case ev := <-dockerEventSub.C:
+			enc.event("docker-events", ev)
+
+		case ev := <-servicesSub.C:
+			enc.snapshot("services", ev)
+
+		case ev := <-alertSub.C:
+			enc.event("alert", ev)
 
-		case ev := <-dockerCh:
-			writeSSE(w, flusher, "docker", ev)
+		case ev := <-customSub.C:
+			enc.snapshot("customMetrics", ev)
+
+		case ev := <-eventSub.C:
+			enc.event("event", ev)
+
+		case ev := <-updateCh:
+			enc.event("update", ev)
+
+		case <-lagCheck.C:
+			counts := dropped()
+			var total uint64
+			for _, n := range counts {
+				total += n
+			}
+			if total > reportedDrops {
+				logf(r, "SSE client %s is lagging: %d events dropped", ip, total)
+				enc.event("meta", sseMeta{
+					Lagging:      true,
+					Dropped:      counts,
+					DroppedTotal: total,
+					Coalesce:     coalesce,
+				})
+				reportedDrops = total
+			}
 
 		case <-keepalive.C:
-			fmt.Fprintf(w, ": keepalive\n\n")
-			flusher.Flush()
+			enc.keepalive()
 		}
 	}
 }
 
-// writeSSE marshals data as JSON and writes it as an SSE event.
-func writeSSE(w http.ResponseWriter, flusher http.Flusher, event string, data any) {
-	jsonBytes, err := json.Marshal(data)
+const (
+	sseLagCheckInterval = 5 * time.Second
+	sseKeyframeEvery    = 30 // patches between full snapshots, per event
+)
+
+// sseEncoder writes stream events, as SSE or, for clients that accept
+// CBOR, as a CBOR sequence of {"event", "data"} items. In delta mode
+// snapshot events go out in full first and every sseKeyframeEvery events,
+// and in between as a "<event>Patch" event holding the JSON Patch from the
+// previous snapshot of that event — or in full again when that is smaller.
+type sseEncoder struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+	cbor    bool
+	last    map[string]*sseSnapshot // nil unless ?delta=true
+}
+
+type sseSnapshot struct {
+	doc     any
+	patches int
+}
+
+// streamItem is one event of a CBOR stream.
+type streamItem struct {
+	Event string `json:"event"`
+	Data  any    `json:"data,omitempty"`
+}
+
+func (e *sseEncoder) encode(data any) ([]byte, error) {
+	if e.cbor {
+		return cbor.Marshal(data)
+	}
+	return json.Marshal(data)
+}
+
+// event writes one event as is.
+func (e *sseEncoder) event(event string, data any) {
+	body, err := e.encode(data)
 	if err != nil {
 		return
 	}
-	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, jsonBytes)
-	flusher.Flush()
+	e.write(event, body)
+}
+
+func (e *sseEncoder) write(event string, body []byte) {
+	if e.cbor {
+		item, _ := cbor.Marshal(streamItem{Event: event, Data: cbor.RawMessage(body)})
+		e.w.Write(item)
+	} else {
+		fmt.Fprintf(e.w, "event: %s\ndata: %s\n\n", event, body)
+	}
+	e.flusher.Flush()
+}
+
+// keepalive keeps idle proxies from closing the connection.
+func (e *sseEncoder) keepalive() {
+	if e.cbor {
+		item, _ := cbor.Marshal(streamItem{Event: "keepalive"})
+		e.w.Write(item)
+	} else {
+		fmt.Fprintf(e.w, ": keepalive\n\n")
+	}
+	e.flusher.Flush()
+}
+
+func (e *sseEncoder) snapshot(event string, data any) {
+	if e.last == nil {
+		e.event(event, data)
+		return
+	}
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return
+	}
+	var doc any
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return
+	}
+	full := raw
+	if e.cbor {
+		if full, err = cbor.Marshal(data); err != nil {
+			return
+		}
+	}
+
+	prev := e.last[event]
+	if prev != nil && prev.patches < sseKeyframeEvery {
+		patch, err := e.encode(diffJSON(prev.doc, doc, "", []patchOp{}))
+		if err == nil && len(patch) < len(full) {
+			prev.doc = doc
+			prev.patches++
+			e.write(event+"Patch", patch)
+			return
+		}
+	}
+	e.last[event] = &sseSnapshot{doc: doc}
+	e.write(event, full)
+}
+
+// sseMeta tells a client that events were dropped because it did not read
+// them fast enough. Dropped counts are cumulative for the connection.
+type sseMeta struct {
+	Lagging      bool              `json:"lagging"`
+	Dropped      map[string]uint64 `json:"dropped"`
+	DroppedTotal uint64            `json:"droppedTotal"`
+	Coalesce     bool              `json:"coalesce"`
 }
@@ -0,0 +1,344 @@
+//go:build !nodocker
+
+package api
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+
+	"github.com/neur0map/deskmon-agent/internal/collector"
+)
+
+// Edge types. An edge from A to B means A depends on B, so restarting B
+// affects A.
+const (
+	edgeDependsOn = "depends_on" // compose depends_on
+	edgeLink      = "link"       // legacy --link
+	edgeRoutesTo  = "routes_to"  // proxy route → backend container
+	edgeServedBy  = "served_by"  // proxy route → the proxy's own container
+)
+
+const (
+	composeProjectLabel = "com.docker.compose.project"
+	composeServiceLabel = "com.docker.compose.service"
+	composeDependsLabel = "com.docker.compose.depends_on"
+)
+
+type topologyNode struct {
+	ID       string   `json:"id"`   // "container:<name>" or "route:<proxy>:<name>"
+	Kind     string   `json:"kind"` // "container" or "route"
+	Name     string   `json:"name"`
+	Status   string   `json:"status,omitempty"`
+	Image    string   `json:"image,omitempty"`
+	Project  string   `json:"project,omitempty"` // compose project
+	Service  string   `json:"service,omitempty"` // compose service
+	Networks []string `json:"networks,omitempty"`
+	Proxy    string   `json:"proxy,omitempty"`
+	Hosts    []string `json:"hosts,omitempty"`
+	Impact   []string `json:"impact"` // node IDs that depend on this one, directly or transitively
+}
+
+type topologyEdge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	Type string `json:"type"`
+}
+
+type topologyGroup struct {
+	Name    string   `json:"name"`
+	Members []string `json:"members"` // node IDs
+}
+
+type topologyResponse struct {
+	Nodes    []topologyNode  `json:"nodes"`
+	Edges    []topologyEdge  `json:"edges"`
+	Networks []topologyGroup `json:"networks"`
+	Projects []topologyGroup `json:"projects"`
+	Warnings []string        `json:"warnings,omitempty"`
+}
+
+// handleTopology returns the dependency graph between containers and proxy
+// routes, with each node's restart impact.
+func (s *Server) handleTopology(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	cli, err := collector.NewDockerClient(s.dockerSocket)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, codeDockerUnavail, err.Error())
+		return
+	}
+	defer cli.Close()
+
+	list, err := cli.ContainerList(ctx, container.ListOptions{All: true})
+	if err != nil {
+		logf(r, "topology: container list: %v", err)
+		writeError(w, r, http.StatusInternalServerError, codeDockerError, err.Error())
+		return
+	}
+
+	g := newTopologyGraph()
+	for _, c := range list {
+		if len(c.Names) == 0 {
+			continue
+		}
+		name := strings.TrimPrefix(c.Names[0], "/")
+		node := topologyNode{
+			ID:      "container:" + name,
+			Kind:    "container",
+			Name:    name,
+			Status:  c.State,
+			Image:   c.Image,
+			Project: c.Labels[composeProjectLabel],
+			Service: c.Labels[composeServiceLabel],
+		}
+		if c.NetworkSettings != nil {
+			for netName, ep := range c.NetworkSettings.Networks {
+				if netName == "host" || netName == "none" {
+					continue
+				}
+				node.Networks = append(node.Networks, netName)
+				g.addMember(g.networks, netName, node.ID)
+				if ep != nil && ep.IPAddress != "" {
+					g.byIP[ep.IPAddress] = node.ID
+				}
+			}
+			sort.Strings(node.Networks)
+		}
+		for _, p := range c.Ports {
+			if p.PublicPort != 0 {
+				g.byPort[int(p.PublicPort)] = node.ID
+			}
+		}
+		if node.Project != "" {
+			g.addMember(g.projects, node.Project, node.ID)
+			if node.Service != "" {
+				key := node.Project + "/" + node.Service
+				g.byService[key] = append(g.byService[key], node.ID)
+			}
+		}
+		g.byName[name] = node.ID
+		g.add(node)
+
+		// Legacy links only show up in inspect data.
+		if c.State == "running" && c.HostConfig.NetworkMode != "host" {
+			if info, err := cli.ContainerInspect(ctx, c.ID); err == nil && info.HostConfig != nil {
+				for _, link := range info.HostConfig.Links {
+					target, _, _ := strings.Cut(link, ":")
+					g.pendingLinks = append(g.pendingLinks, topologyEdge{From: node.ID, To: "container:" + strings.TrimPrefix(target, "/"), Type: edgeLink})
+				}
+			}
+		}
+	}
+
+	// Compose dependencies: "db:service_started:false,redis:service_healthy:true".
+	for _, c := range list {
+		deps := c.Labels[composeDependsLabel]
+		if deps == "" || len(c.Names) == 0 {
+			continue
+		}
+		from := "container:" + strings.TrimPrefix(c.Names[0], "/")
+		for _, dep := range strings.Split(deps, ",") {
+			service, _, _ := strings.Cut(strings.TrimSpace(dep), ":")
+			for _, to := range g.byService[c.Labels[composeProjectLabel]+"/"+service] {
+				g.addEdge(from, to, edgeDependsOn)
+			}
+		}
+	}
+	for _, e := range g.pendingLinks {
+		if _, ok := g.nodes[e.To]; ok {
+			g.addEdge(e.From, e.To, e.Type)
+		}
+	}
+
+	var warnings []string
+	if s.services != nil {
+		for _, proxy := range s.services.Routes(ctx) {
+			if proxy.Error != "" {
+				warnings = append(warnings, proxy.Name+": "+proxy.Error)
+				continue
+			}
+			proxyContainer := g.proxyContainer(list, proxy.Proxy)
+			for _, route := range proxy.Routes {
+				node := topologyNode{
+					ID:     "route:" + proxy.Proxy + ":" + route.Name,
+					Kind:   "route",
+					Name:   route.Name,
+					Status: route.Status,
+					Proxy:  proxy.Proxy,
+					Hosts:  route.Hosts,
+				}
+				g.add(node)
+				if proxyContainer != "" {
+					g.addEdge(node.ID, proxyContainer, edgeServedBy)
+				}
+				for _, upstream := range route.Upstreams {
+					if to := g.resolveUpstream(upstream); to != "" {
+						g.addEdge(node.ID, to, edgeRoutesTo)
+					}
+				}
+			}
+		}
+	}
+
+	writeData(w, r, g.response(warnings))
+}
+
+// topologyGraph accumulates nodes and edges while the response is built.
+type topologyGraph struct {
+	nodes        map[string]*topologyNode
+	order        []string
+	edges        []topologyEdge
+	seen         map[topologyEdge]bool
+	pendingLinks []topologyEdge
+	networks     map[string][]string
+	projects     map[string][]string
+	byIP         map[string]string   // container IP → node ID
+	byPort       map[int]string      // published host port → node ID
+	byName       map[string]string   // container name → node ID
+	byService    map[string][]string // "project/service" → node IDs
+}
+
+func newTopologyGraph() *topologyGraph {
+	return &topologyGraph{
+		nodes:     make(map[string]*topologyNode),
+		seen:      make(map[topologyEdge]bool),
+		networks:  make(map[string][]string),
+		projects:  make(map[string][]string),
+		byIP:      make(map[string]string),
+		byPort:    make(map[int]string),
+		byName:    make(map[string]string),
+		byService: make(map[string][]string),
+	}
+}
+
+func (g *topologyGraph) add(n topologyNode) {
+	if _, ok := g.nodes[n.ID]; ok {
+		return
+	}
+	g.nodes[n.ID] = &n
+	g.order = append(g.order, n.ID)
+}
+
+func (g *topologyGraph) addEdge(from, to, typ string) {
+	e := topologyEdge{From: from, To: to, Type: typ}
+	if from == to || g.seen[e] {
+		return
+	}
+	g.seen[e] = true
+	g.edges = append(g.edges, e)
+}
+
+func (g *topologyGraph) addMember(groups map[string][]string, name, id string) {
+	groups[name] = append(groups[name], id)
+}
+
+// resolveUpstream maps a backend URL to a container: by network IP, by
+// published port on a loopback or host address, or by container or compose
+// service name as resolved on a Docker network.
+func (g *topologyGraph) resolveUpstream(upstream string) string {
+	u, err := url.Parse(upstream)
+	if err != nil || u.Host == "" {
+		u, err = url.Parse("//" + upstream)
+		if err != nil {
+			return ""
+		}
+	}
+	host := u.Hostname()
+	if id, ok := g.byIP[host]; ok {
+		return id
+	}
+	if ip := net.ParseIP(host); ip != nil || host == "localhost" || host == "host.docker.internal" {
+		if port, err := strconv.Atoi(u.Port()); err == nil {
+			return g.byPort[port]
+		}
+		return ""
+	}
+	if id, ok := g.byName[host]; ok {
+		return id
+	}
+	for key, ids := range g.byService {
+		if path.Base(key) == host && len(ids) > 0 {
+			return ids[0]
+		}
+	}
+	return ""
+}
+
+// proxyContainer finds the container running a proxy plugin, by image name.
+func (g *topologyGraph) proxyContainer(list []container.Summary, pluginID string) string {
+	for _, c := range list {
+		if c.State != "running" || len(c.Names) == 0 {
+			continue
+		}
+		image := strings.SplitN(path.Base(c.Image), ":", 2)[0]
+		if strings.Contains(image, pluginID) {
+			return "container:" + strings.TrimPrefix(c.Names[0], "/")
+		}
+	}
+	return ""
+}
+
+func (g *topologyGraph) response(warnings []string) topologyResponse {
+	dependents := make(map[string][]string)
+	for _, e := range g.edges {
+		dependents[e.To] = append(dependents[e.To], e.From)
+	}
+
+	resp := topologyResponse{
+		Nodes:    make([]topologyNode, 0, len(g.order)),
+		Edges:    g.edges,
+		Networks: groupList(g.networks),
+		Projects: groupList(g.projects),
+		Warnings: warnings,
+	}
+	if resp.Edges == nil {
+		resp.Edges = []topologyEdge{}
+	}
+	for _, id := range g.order {
+		n := *g.nodes[id]
+		n.Impact = impactOf(id, dependents)
+		resp.Nodes = append(resp.Nodes, n)
+	}
+	sort.Slice(resp.Nodes, func(i, j int) bool { return resp.Nodes[i].ID < resp.Nodes[j].ID })
+	return resp
+}
+
+// impactOf walks dependents breadth-first from id.
+func impactOf(id string, dependents map[string][]string) []string {
+	seen := map[string]bool{id: true}
+	queue := []string{id}
+	impact := []string{}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		for _, d := range dependents[cur] {
+			if !seen[d] {
+				seen[d] = true
+				impact = append(impact, d)
+				queue = append(queue, d)
+			}
+		}
+	}
+	sort.Strings(impact)
+	return impact
+}
+
+func groupList(groups map[string][]string) []topologyGroup {
+	list := make([]topologyGroup, 0, len(groups))
+	for name, members := range groups {
+		sort.Strings(members)
+		list = append(list, topologyGroup{Name: name, Members: members})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
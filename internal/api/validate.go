@@ -0,0 +1,253 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// fieldError is one problem with a request body. Field is the JSON path of
+// the offending value, e.g. "metrics[2].name"; it is empty when the problem
+// is with the body as a whole.
+type fieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func (e fieldError) String() string {
+	if e.Field == "" {
+		return e.Message
+	}
+	return e.Field + ": " + e.Message
+}
+
+// decodeBody reads a JSON request body into v, a pointer, and checks the
+// validate tags of its fields. On failure it writes
+// a 400 listing the problems by field and returns false.
+//
+// Unknown fields are rejected so that a misspelt field gets an error rather
+// than being silently ignored. An empty body is fine when emptyOK is set.
+func decodeBody(w http.ResponseWriter, r *http.Request, v interface{}, emptyOK bool) bool {
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	err := dec.Decode(v)
+	if err == nil && dec.More() {
+		err = errors.New("unexpected data after the JSON value")
+	}
+	if errors.Is(err, io.EOF) && emptyOK {
+		err = nil
+	}
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		writeError(w, r, http.StatusRequestEntityTooLarge, codeBadRequest, fmt.Sprintf("request body too large (max %d bytes)", tooLarge.Limit))
+		return false
+	}
+	if err != nil {
+		fe := decodeFieldError(err)
+		code := codeInvalidJSON
+		if fe.Field != "" {
+			code = codeValidationFailed
+		}
+		writeFieldErrors(w, r, code, []fieldError{fe})
+		return false
+	}
+	if errs := validateFields(v); len(errs) > 0 {
+		writeFieldErrors(w, r, codeValidationFailed, errs)
+		return false
+	}
+	return true
+}
+
+// decodeFieldError describes a json.Decoder error in terms of the field it
+// is about, where it has one.
+func decodeFieldError(err error) fieldError {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.Is(err, io.EOF):
+		return fieldError{Message: "request body is empty"}
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return fieldError{Message: "invalid JSON: unexpected end of body"}
+	case errors.As(err, &syntaxErr):
+		return fieldError{Message: fmt.Sprintf("invalid JSON at byte %d: %s", syntaxErr.Offset, strings.TrimPrefix(syntaxErr.Error(), "json: "))}
+	case errors.As(err, &typeErr):
+		if typeErr.Field == "" {
+			return fieldError{Message: fmt.Sprintf("body must be a JSON %s, not %s", jsonKind(typeErr.Type), typeErr.Value)}
+		}
+		return fieldError{Field: typeErr.Field, Message: fmt.Sprintf("must be %s, not %s", jsonKind(typeErr.Type), typeErr.Value)}
+	}
+	if name, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+		name, _ = strconv.Unquote(name)
+		return fieldError{Field: name, Message: "unknown field"}
+	}
+	return fieldError{Message: "invalid JSON: " + strings.TrimPrefix(err.Error(), "json: ")}
+}
+
+// jsonKind names the JSON type a Go type is decoded from, with an article.
+func jsonKind(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "an integer"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.String:
+		return "a string"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	case reflect.Map, reflect.Struct:
+		return "an object"
+	case reflect.Pointer:
+		return jsonKind(t.Elem())
+	}
+	return "a " + t.String()
+}
+
+// validateFields checks the validate tags of the struct v points to,
+// descending into nested structs and slices of structs. A tag is a comma
+// separated list of:
+//
+//	required     the value must be set: non-nil, or non-zero and non-empty
+//	oneof=a b c  a string must be one of the listed values
+//	min=N max=N  bounds for a number, or for the length of a string,
+//	             slice or map
+func validateFields(v interface{}) []fieldError {
+	var errs []fieldError
+	validateValue(reflect.ValueOf(v), "", &errs)
+	return errs
+}
+
+func validateValue(v reflect.Value, path string, errs *[]fieldError) {
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Struct:
+		t := v.Type()
+		for i := range t.NumField() {
+			f := t.Field(i)
+			if !f.IsExported() {
+				continue
+			}
+			name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+			if name == "-" {
+				continue
+			}
+			fv := v.Field(i)
+			if f.Anonymous && name == "" {
+				validateValue(fv, path, errs) // embedded fields are decoded inline
+				continue
+			}
+			if name == "" {
+				name = f.Name
+			}
+			fieldPath := joinFieldPath(path, name)
+			if tag := f.Tag.Get("validate"); tag != "" {
+				if msg := checkRules(fv, tag); msg != "" {
+					*errs = append(*errs, fieldError{Field: fieldPath, Message: msg})
+					continue
+				}
+			}
+			validateValue(fv, fieldPath, errs)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := range v.Len() {
+			validateValue(v.Index(i), fmt.Sprintf("%s[%d]", path, i), errs)
+		}
+	}
+}
+
+func joinFieldPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// checkRules returns what is wrong with v under a validate tag, or "".
+// Only required applies to a value that isn't set: a nil pointer, or a
+// zero value that isn't behind one.
+func checkRules(v reflect.Value, tag string) string {
+	rules := strings.Split(tag, ",")
+	set := !v.IsZero()
+	if v.Kind() == reflect.Pointer && set {
+		v = v.Elem()
+	}
+	if !set {
+		if slices.Contains(rules, "required") {
+			return "is required"
+		}
+		return ""
+	}
+	for _, rule := range rules {
+		name, arg, _ := strings.Cut(rule, "=")
+		switch name {
+		case "required":
+		case "oneof":
+			allowed := strings.Fields(arg)
+			if !slices.Contains(allowed, v.String()) {
+				return fmt.Sprintf("must be one of %s, not %q", strings.Join(allowed, ", "), v.String())
+			}
+		case "min", "max":
+			limit, err := strconv.ParseFloat(arg, 64)
+			if err != nil {
+				panic(fmt.Sprintf("validate: bad %s rule %q", name, rule))
+			}
+			n, what := measure(v)
+			if name == "min" && n < limit {
+				return fmt.Sprintf("must be at least %s%s", arg, what)
+			}
+			if name == "max" && n > limit {
+				return fmt.Sprintf("must be at most %s%s", arg, what)
+			}
+		default:
+			panic(fmt.Sprintf("validate: unknown rule %q", rule))
+		}
+	}
+	return ""
+}
+
+// measure returns what min and max compare: a number's value, or a
+// length, with the unit to name in messages.
+func measure(v reflect.Value) (float64, string) {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), ""
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), ""
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), ""
+	case reflect.String:
+		return float64(len(v.String())), " characters"
+	case reflect.Map:
+		return float64(v.Len()), " keys"
+	}
+	return float64(v.Len()), " items"
+}
+
+// writeFieldErrors is writeError for a 400 about the request body: the
+// message is the first problem and fields lists all of them.
+func writeFieldErrors(w http.ResponseWriter, r *http.Request, code string, errs []fieldError) {
+	message := errs[0].String()
+	if len(errs) > 1 {
+		message += fmt.Sprintf(" (and %d more)", len(errs)-1)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	if wantsEnvelope(r) {
+		json.NewEncoder(w).Encode(envelopeResponse{Error: &apiError{Code: code, Message: message, RequestID: requestID(r), Fields: errs}})
+		return
+	}
+	json.NewEncoder(w).Encode(legacyErrorResponse{Error: message, Code: code, RequestID: requestID(r), Fields: errs})
+}
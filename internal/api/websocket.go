@@ -0,0 +1,319 @@
+package api
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/neur0map/deskmon-agent/internal/collector"
+	"github.com/neur0map/deskmon-agent/internal/updater"
+)
+
+// WebSocket transport: GET /ws carries the SSE stream's events for clients
+// whose reverse proxy buffers or cuts SSE. Each event is one text message,
+// {"event": "system", "data": {...}}. The agent pings every 15s and drops
+// the connection when nothing, pong or otherwise, has arrived for 45s.
+// Clients only need to answer pings; anything else they send is ignored.
+
+const (
+	wsPingInterval = 15 * time.Second
+	wsIdleTimeout  = 3 * wsPingInterval
+	wsWriteTimeout = 10 * time.Second
+	wsMaxFrame     = 4096 // clients have nothing large to say
+
+	wsOpText  = 0x1
+	wsOpClose = 0x8
+	wsOpPing  = 0x9
+	wsOpPong  = 0xA
+
+	wsCloseGoingAway     = 1001
+	wsCloseProtocolError = 1002
+	wsCloseTooBig        = 1009
+
+	wsAcceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+)
+
+type wsMessage struct {
+	Event string `json:"event"`
+	Data  any    `json:"data"`
+}
+
+// wsConn is the server side of an RFC 6455 connection, just enough for a
+// one-way event stream: unfragmented text frames out, control frames in.
+type wsConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+	mu   sync.Mutex // serializes writes from the stream and the reader's pongs
+}
+
+// handleWebSocket upgrades the request and streams the same events as
+// GET /stats/stream. ?coalesce=true skips lagging snapshot events to the
+// latest value, as on the SSE stream.
+func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	if !headerContains(r.Header, "Connection", "upgrade") || !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		w.Header().Set("Upgrade", "websocket")
+		writeError(w, r, http.StatusUpgradeRequired, codeBadRequest, "WebSocket upgrade required")
+		return
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		writeError(w, r, http.StatusBadRequest, codeBadRequest, "unsupported WebSocket version")
+		return
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if key == "" {
+		writeError(w, r, http.StatusBadRequest, codeBadRequest, "missing Sec-WebSocket-Key")
+		return
+	}
+	if origin := r.Header.Get("Origin"); origin != "" && !s.wsOriginAllowed(r, origin) {
+		writeError(w, r, http.StatusForbidden, codeForbidden, "origin not allowed")
+		return
+	}
+
+	conn, brw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, codeStreamingFailed, "WebSocket not supported")
+		return
+	}
+	defer conn.Close()
+	// The server's read timeout is still armed on the connection.
+	conn.SetDeadline(time.Time{})
+
+	sum := sha1.Sum([]byte(key + wsAcceptGUID))
+	brw.WriteString("HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + base64.StdEncoding.EncodeToString(sum[:]) + "\r\n\r\n")
+	if err := brw.Flush(); err != nil {
+		return
+	}
+
+	ip := clientIP(r)
+	logf(r, "WebSocket stream opened from %s", ip)
+	defer logf(r, "WebSocket stream closed from %s", ip)
+
+	snapshotMode := collector.DropNewest
+	if r.URL.Query().Get("coalesce") == "true" {
+		snapshotMode = collector.KeepLatest
+	}
+
+	sysSub := s.system.Broadcast.SubscribeMode(2, snapshotMode)
+	defer sysSub.Close()
+	dockerSub := s.docker.Broadcast.SubscribeMode(2, snapshotMode)
+	defer dockerSub.Close()
+	dockerStatusSub := s.docker.StatusBroadcast.SubscribeMode(2, snapshotMode)
+	defer dockerStatusSub.Close()
+	dockerEventSub := s.docker.EventBroadcast.SubscribeMode(16, collector.DropNewest)
+	defer dockerEventSub.Close()
+	servicesSub := s.services.Broadcast.SubscribeMode(2, snapshotMode)
+	defer servicesSub.Close()
+	alertSub := s.alerts.Broadcast.SubscribeMode(8, collector.DropNewest)
+	defer alertSub.Close()
+	customSub := s.custom.Broadcast.SubscribeMode(2, snapshotMode)
+	defer customSub.Close()
+	eventSub := s.events.Broadcast.SubscribeMode(8, collector.DropNewest)
+	defer eventSub.Close()
+
+	// nil channel (never ready) when auto-update is off
+	var updateCh <-chan updater.Result
+	if s.updater != nil {
+		updateSub := s.updater.Broadcast.SubscribeMode(4, collector.DropNewest)
+		defer updateSub.Close()
+		updateCh = updateSub.C
+	}
+
+	ws := &wsConn{conn: conn, r: brw.Reader}
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		ws.readLoop()
+	}()
+
+	ping := time.NewTicker(wsPingInterval)
+	defer ping.Stop()
+
+	for {
+		var err error
+		select {
+		case <-closed:
+			return
+		case <-s.stopCh:
+			// Hijacked connections outlive http.Server.Close.
+			ws.close(wsCloseGoingAway)
+			return
+		case <-ping.C:
+			err = ws.writeFrame(wsOpPing, nil)
+		case ev := <-sysSub.C:
+			err = ws.send("system", ev)
+		case ev := <-dockerSub.C:
+			err = ws.send("docker", ev)
+		case ev := <-dockerStatusSub.C:
+			err = ws.send("dockerStatus", ev)
+		case ev := <-dockerEventSub.C:
+			err = ws.send("docker-events", ev)
+		case ev := <-servicesSub.C:
+			err = ws.send("services", ev)
+		case ev := <-alertSub.C:
+			err = ws.send("alert", ev)
+		case ev := <-customSub.C:
+			err = ws.send("customMetrics", ev)
+		case ev := <-eventSub.C:
+			err = ws.send("event", ev)
+		case ev := <-updateCh:
+			err = ws.send("update", ev)
+		}
+		if err != nil {
+			logf(r, "WebSocket write to %s failed: %v", ip, err)
+			return
+		}
+	}
+}
+
+// wsOriginAllowed lets browser pages connect only from the agent's own
+// origin or one allowed by cors.allowed_origins. Browsers don't apply CORS
+// to WebSockets, so without this any page could read the stream from a
+// machine that can reach the agent.
+func (s *Server) wsOriginAllowed(r *http.Request, origin string) bool {
+	if u, err := url.Parse(origin); err == nil && strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	return s.corsOrigin(origin) != ""
+}
+
+// headerContains reports whether a comma-separated header has token,
+// ignoring case ("Connection: keep-alive, Upgrade").
+func headerContains(h http.Header, name, token string) bool {
+	for _, v := range h.Values(name) {
+		for _, part := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (c *wsConn) send(event string, data any) error {
+	body, err := json.Marshal(wsMessage{Event: event, Data: data})
+	if err != nil {
+		return err
+	}
+	return c.writeFrame(wsOpText, body)
+}
+
+// writeFrame sends one unmasked frame, as servers must.
+func (c *wsConn) writeFrame(op byte, payload []byte) error {
+	header := []byte{0x80 | op, 0}
+	switch n := len(payload); {
+	case n < 126:
+		header[1] = byte(n)
+	case n <= 0xFFFF:
+		header[1] = 126
+		header = binary.BigEndian.AppendUint16(header, uint16(n))
+	default:
+		header[1] = 127
+		header = binary.BigEndian.AppendUint64(header, uint64(n))
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+	bufs := net.Buffers{header, payload}
+	_, err := bufs.WriteTo(c.conn)
+	return err
+}
+
+// close sends a close frame with code; the caller then drops the
+// connection without waiting for the client's reply.
+func (c *wsConn) close(code uint16) {
+	c.writeFrame(wsOpClose, binary.BigEndian.AppendUint16(nil, code))
+}
+
+// readLoop handles the client's frames until the connection ends: pings
+// are answered, a close is echoed, and data messages are dropped. Every
+// frame pushes the idle deadline back.
+func (c *wsConn) readLoop() {
+	for {
+		c.conn.SetReadDeadline(time.Now().Add(wsIdleTimeout))
+		op, payload, err := c.readFrame()
+		switch {
+		case errors.Is(err, errWSTooBig):
+			c.close(wsCloseTooBig)
+			return
+		case errors.Is(err, errWSUnmasked):
+			c.close(wsCloseProtocolError)
+			return
+		case err != nil:
+			return
+		}
+		switch op {
+		case wsOpPing:
+			if c.writeFrame(wsOpPong, payload) != nil {
+				return
+			}
+		case wsOpClose:
+			code := payload
+			if len(code) > 2 {
+				code = code[:2]
+			}
+			c.writeFrame(wsOpClose, code)
+			return
+		}
+	}
+}
+
+var (
+	errWSTooBig   = errors.New("WebSocket frame too large")
+	errWSUnmasked = errors.New("unmasked WebSocket frame from client")
+)
+
+func (c *wsConn) readFrame() (byte, []byte, error) {
+	var head [2]byte
+	if _, err := io.ReadFull(c.r, head[:]); err != nil {
+		return 0, nil, err
+	}
+	op := head[0] & 0x0F
+	if head[1]&0x80 == 0 {
+		return 0, nil, errWSUnmasked
+	}
+	length := uint64(head[1] & 0x7F)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.r, ext[:]); err != nil {
+			return 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.r, ext[:]); err != nil {
+			return 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+	if length > wsMaxFrame {
+		return 0, nil, errWSTooBig
+	}
+	var mask [4]byte
+	if _, err := io.ReadFull(c.r, mask[:]); err != nil {
+		return 0, nil, err
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(c.r, payload); err != nil {
+		return 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return op, payload, nil
+}
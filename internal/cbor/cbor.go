@@ -0,0 +1,487 @@
+// Package cbor encodes Go values as CBOR (RFC 8949) with the same shape
+// encoding/json would produce: struct fields are named and omitted by their
+// json tags, embedded structs are flattened, map keys are strings, and
+// types with their own MarshalJSON are encoded from that JSON. Map keys
+// are sorted and numbers take their shortest form, so equal values encode
+// to equal bytes.
+package cbor
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ContentType is the media type of a single CBOR item.
+const ContentType = "application/cbor"
+
+// RawMessage is an already-encoded CBOR item, written as is.
+type RawMessage []byte
+
+// Major types.
+const (
+	majorUint   = 0
+	majorNegint = 1
+	majorBytes  = 2
+	majorText   = 3
+	majorArray  = 4
+	majorMap    = 5
+	majorSimple = 7
+)
+
+// Marshal returns the CBOR encoding of v.
+func Marshal(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := encode(&buf, reflect.ValueOf(v)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+var (
+	jsonMarshalerType = reflect.TypeFor[json.Marshaler]()
+	textMarshalerType = reflect.TypeFor[encoding.TextMarshaler]()
+	timeType          = reflect.TypeFor[time.Time]()
+	rawMessageType    = reflect.TypeFor[json.RawMessage]()
+	cborRawType       = reflect.TypeFor[RawMessage]()
+)
+
+func encode(buf *bytes.Buffer, v reflect.Value) error {
+	if !v.IsValid() {
+		buf.WriteByte(0xf6) // null
+		return nil
+	}
+
+	t := v.Type()
+	switch {
+	case t == timeType:
+		b, _ := v.Interface().(time.Time).MarshalText()
+		writeText(buf, string(b))
+		return nil
+	case t == cborRawType:
+		buf.Write(v.Bytes())
+		return nil
+	case t == rawMessageType:
+		if v.Len() == 0 {
+			buf.WriteByte(0xf6) // encoding/json writes a nil RawMessage as null
+			return nil
+		}
+		return encodeJSON(buf, v.Bytes())
+	case t.Kind() != reflect.Pointer && t.Kind() != reflect.Interface && t.Implements(jsonMarshalerType):
+		return encodeMarshalJSON(buf, v.Interface().(json.Marshaler))
+	case t.Kind() != reflect.Pointer && v.CanAddr() && reflect.PointerTo(t).Implements(jsonMarshalerType):
+		// Like encoding/json, a pointer-receiver MarshalJSON applies to
+		// addressable values: fields of a struct reached through a pointer.
+		return encodeMarshalJSON(buf, v.Addr().Interface().(json.Marshaler))
+	case t.Kind() != reflect.Pointer && t.Kind() != reflect.Interface && t.Implements(textMarshalerType):
+		return encodeMarshalText(buf, v.Interface().(encoding.TextMarshaler))
+	case t.Kind() != reflect.Pointer && v.CanAddr() && reflect.PointerTo(t).Implements(textMarshalerType):
+		return encodeMarshalText(buf, v.Addr().Interface().(encoding.TextMarshaler))
+	}
+
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			buf.WriteByte(0xf6)
+			return nil
+		}
+		return encode(buf, v.Elem())
+	case reflect.Bool:
+		if v.Bool() {
+			buf.WriteByte(0xf5)
+		} else {
+			buf.WriteByte(0xf4)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		writeInt(buf, v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		writeHead(buf, majorUint, v.Uint())
+	case reflect.Float32, reflect.Float64:
+		writeFloat(buf, v.Float())
+	case reflect.String:
+		writeText(buf, v.String())
+	case reflect.Slice:
+		if v.IsNil() {
+			buf.WriteByte(0xf6)
+			return nil
+		}
+		if t.Elem().Kind() == reflect.Uint8 {
+			writeHead(buf, majorBytes, uint64(v.Len()))
+			buf.Write(v.Bytes())
+			return nil
+		}
+		fallthrough
+	case reflect.Array:
+		writeHead(buf, majorArray, uint64(v.Len()))
+		for i := 0; i < v.Len(); i++ {
+			if err := encode(buf, v.Index(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		if v.IsNil() {
+			buf.WriteByte(0xf6)
+			return nil
+		}
+		return encodeMap(buf, v)
+	case reflect.Struct:
+		return encodeStruct(buf, v)
+	default:
+		return fmt.Errorf("cbor: unsupported type %s", t)
+	}
+	return nil
+}
+
+func encodeMarshalJSON(buf *bytes.Buffer, m json.Marshaler) error {
+	b, err := m.MarshalJSON()
+	if err != nil {
+		return err
+	}
+	return encodeJSON(buf, b)
+}
+
+func encodeMarshalText(buf *bytes.Buffer, m encoding.TextMarshaler) error {
+	b, err := m.MarshalText()
+	if err != nil {
+		return err
+	}
+	writeText(buf, string(b))
+	return nil
+}
+
+func encodeMap(buf *bytes.Buffer, v reflect.Value) error {
+	type entry struct {
+		key string
+		val reflect.Value
+	}
+	entries := make([]entry, 0, v.Len())
+	iter := v.MapRange()
+	for iter.Next() {
+		k, err := mapKey(iter.Key())
+		if err != nil {
+			return err
+		}
+		entries = append(entries, entry{k, iter.Value()})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].key < entries[j].key })
+
+	writeHead(buf, majorMap, uint64(len(entries)))
+	for _, e := range entries {
+		writeText(buf, e.key)
+		if err := encode(buf, e.val); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mapKey converts a map key to a string the way encoding/json does.
+func mapKey(k reflect.Value) (string, error) {
+	if k.Kind() == reflect.String {
+		return k.String(), nil
+	}
+	if tm, ok := k.Interface().(encoding.TextMarshaler); ok {
+		b, err := tm.MarshalText()
+		return string(b), err
+	}
+	switch k.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(k.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(k.Uint(), 10), nil
+	}
+	return "", fmt.Errorf("cbor: unsupported map key type %s", k.Type())
+}
+
+func encodeStruct(buf *bytes.Buffer, v reflect.Value) error {
+	fields := cachedFields(v.Type())
+	present := make([]reflect.Value, len(fields))
+	n := 0
+	for i, f := range fields {
+		fv, ok := fieldByIndex(v, f.index)
+		if !ok || (f.omitEmpty && isEmpty(fv)) {
+			continue
+		}
+		present[i] = fv
+		n++
+	}
+
+	writeHead(buf, majorMap, uint64(n))
+	for i, f := range fields {
+		if !present[i].IsValid() {
+			continue
+		}
+		writeText(buf, f.name)
+		if err := encode(buf, present[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fieldByIndex is v.FieldByIndex that reports false instead of panicking
+// when it passes through a nil embedded pointer.
+func fieldByIndex(v reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, true
+}
+
+func isEmpty(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64,
+		reflect.Interface, reflect.Pointer:
+		return v.IsZero()
+	}
+	return false
+}
+
+type field struct {
+	name      string
+	index     []int
+	omitEmpty bool
+	tagged    bool // named by its json tag
+}
+
+var fieldCache sync.Map // reflect.Type → []field
+
+// cachedFields lists the fields encoding/json would encode for t, in
+// order, with embedded structs flattened. Of fields sharing a name, the
+// shallowest wins; at equal depth a single tagged one wins, and otherwise
+// none is encoded.
+func cachedFields(t reflect.Type) []field {
+	if f, ok := fieldCache.Load(t); ok {
+		return f.([]field)
+	}
+	var all []field
+	var walk func(t reflect.Type, index []int)
+	walk = func(t reflect.Type, index []int) {
+		for i := 0; i < t.NumField(); i++ {
+			sf := t.Field(i)
+			tag := sf.Tag.Get("json")
+			if tag == "-" {
+				continue
+			}
+			name, opts, _ := strings.Cut(tag, ",")
+			idx := append(append([]int(nil), index...), i)
+
+			ft := sf.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if sf.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+				walk(ft, idx)
+				continue
+			}
+			if !sf.IsExported() {
+				continue
+			}
+			tagged := name != ""
+			if !tagged {
+				name = sf.Name
+			}
+			all = append(all, field{
+				name:      name,
+				index:     idx,
+				omitEmpty: strings.Contains(","+opts+",", ",omitempty,"),
+				tagged:    tagged,
+			})
+		}
+	}
+	walk(t, nil)
+
+	byName := make(map[string][]int)
+	for i, f := range all {
+		byName[f.name] = append(byName[f.name], i)
+	}
+	var fields []field
+	for i, f := range all {
+		if dominantField(all, byName[f.name]) == i {
+			fields = append(fields, f)
+		}
+	}
+	fieldCache.Store(t, fields)
+	return fields
+}
+
+// dominantField returns which of the candidates (indexes into all, all
+// sharing one name) encoding/json would encode, or -1 if none.
+func dominantField(all []field, candidates []int) int {
+	depth := len(all[candidates[0]].index)
+	for _, c := range candidates[1:] {
+		depth = min(depth, len(all[c].index))
+	}
+	win, n, tagged := -1, 0, 0
+	for _, c := range candidates {
+		if len(all[c].index) != depth {
+			continue
+		}
+		n++
+		if all[c].tagged {
+			tagged++
+			win = c
+		} else if n == 1 {
+			win = c
+		}
+	}
+	switch {
+	case n == 1:
+		return win
+	case tagged == 1:
+		return win
+	}
+	return -1
+}
+
+// encodeJSON re-encodes a JSON document, keeping integers as integers.
+func encodeJSON(buf *bytes.Buffer, data []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return fmt.Errorf("cbor: %w", err)
+	}
+	return encodeTree(buf, v)
+}
+
+func encodeTree(buf *bytes.Buffer, v any) error {
+	switch x := v.(type) {
+	case json.Number:
+		if i, err := x.Int64(); err == nil {
+			writeInt(buf, i)
+			return nil
+		}
+		f, err := x.Float64()
+		if err != nil {
+			return fmt.Errorf("cbor: %w", err)
+		}
+		writeFloat(buf, f)
+		return nil
+	case []any:
+		writeHead(buf, majorArray, uint64(len(x)))
+		for _, e := range x {
+			if err := encodeTree(buf, e); err != nil {
+				return err
+			}
+		}
+		return nil
+	case map[string]any:
+		keys := make([]string, 0, len(x))
+		for k := range x {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		writeHead(buf, majorMap, uint64(len(keys)))
+		for _, k := range keys {
+			writeText(buf, k)
+			if err := encodeTree(buf, x[k]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return encode(buf, reflect.ValueOf(v))
+}
+
+// writeHead writes an item header: the major type and its argument in the
+// shortest form.
+func writeHead(buf *bytes.Buffer, major byte, n uint64) {
+	m := major << 5
+	switch {
+	case n < 24:
+		buf.WriteByte(m | byte(n))
+	case n <= math.MaxUint8:
+		buf.WriteByte(m | 24)
+		buf.WriteByte(byte(n))
+	case n <= math.MaxUint16:
+		buf.WriteByte(m | 25)
+		buf.Write(binary.BigEndian.AppendUint16(nil, uint16(n)))
+	case n <= math.MaxUint32:
+		buf.WriteByte(m | 26)
+		buf.Write(binary.BigEndian.AppendUint32(nil, uint32(n)))
+	default:
+		buf.WriteByte(m | 27)
+		buf.Write(binary.BigEndian.AppendUint64(nil, n))
+	}
+}
+
+func writeInt(buf *bytes.Buffer, i int64) {
+	if i >= 0 {
+		writeHead(buf, majorUint, uint64(i))
+		return
+	}
+	writeHead(buf, majorNegint, uint64(-1-i))
+}
+
+func writeText(buf *bytes.Buffer, s string) {
+	writeHead(buf, majorText, uint64(len(s)))
+	buf.WriteString(s)
+}
+
+// writeFloat writes f in the shortest of half, single and double
+// precision that loses nothing (RFC 8949 §4.2.2). NaN is always f97e00.
+func writeFloat(buf *bytes.Buffer, f float64) {
+	if math.IsNaN(f) {
+		buf.Write([]byte{majorSimple<<5 | 25, 0x7e, 0x00})
+		return
+	}
+	f32 := float32(f)
+	if float64(f32) != f {
+		buf.WriteByte(majorSimple<<5 | 27)
+		buf.Write(binary.BigEndian.AppendUint64(nil, math.Float64bits(f)))
+		return
+	}
+	if h, ok := float16Bits(f32); ok {
+		buf.WriteByte(majorSimple<<5 | 25)
+		buf.Write(binary.BigEndian.AppendUint16(nil, h))
+		return
+	}
+	buf.WriteByte(majorSimple<<5 | 26)
+	buf.Write(binary.BigEndian.AppendUint32(nil, math.Float32bits(f32)))
+}
+
+// float16Bits returns the IEEE 754 half-precision bits of f, if f has
+// one exactly.
+func float16Bits(f float32) (uint16, bool) {
+	bits := math.Float32bits(f)
+	sign := uint16(bits>>16) & 0x8000
+	exp := int(bits>>23) & 0xff
+	mant := bits & 0x7fffff
+	switch {
+	case exp == 0xff: // ±Inf; NaN is handled by the caller
+		return sign | 0x7c00, mant == 0
+	case exp == 0: // ±0, or a single-precision subnormal far below half's range
+		return sign, mant == 0
+	}
+	e := exp - 127
+	switch {
+	case e >= -14 && e <= 15: // normal half
+		return sign | uint16(e+15)<<10 | uint16(mant>>13), mant&0x1fff == 0
+	case e >= -24 && e < -14: // subnormal half: m × 2⁻²⁴
+		full := mant | 0x800000
+		shift := uint(-(e + 1))
+		return sign | uint16(full>>shift), full&(1<<shift-1) == 0
+	}
+	return 0, false
+}
@@ -0,0 +1,365 @@
+package cbor
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// TestAppendixA checks the RFC 8949 Appendix A examples this encoder can
+// produce. Tags, undefined, indefinite lengths and non-string map keys are
+// left out: Marshal never emits them.
+func TestAppendixA(t *testing.T) {
+	tests := []struct {
+		v    any
+		want string
+	}{
+		{0, "00"},
+		{1, "01"},
+		{10, "0a"},
+		{23, "17"},
+		{24, "1818"},
+		{25, "1819"},
+		{100, "1864"},
+		{1000, "1903e8"},
+		{1000000, "1a000f4240"},
+		{int64(1000000000000), "1b000000e8d4a51000"},
+		{uint64(18446744073709551615), "1bffffffffffffffff"},
+		{-1, "20"},
+		{-10, "29"},
+		{-100, "3863"},
+		{-1000, "3903e7"},
+
+		{0.0, "f90000"},
+		{math.Copysign(0, -1), "f98000"},
+		{1.0, "f93c00"},
+		{1.1, "fb3ff199999999999a"},
+		{1.5, "f93e00"},
+		{65504.0, "f97bff"},
+		{100000.0, "fa47c35000"},
+		{3.4028234663852886e+38, "fa7f7fffff"},
+		{1.0e+300, "fb7e37e43c8800759c"},
+		{5.960464477539063e-8, "f90001"},
+		{0.00006103515625, "f90400"},
+		{-4.0, "f9c400"},
+		{-4.1, "fbc010666666666666"},
+		{math.Inf(1), "f97c00"},
+		{math.NaN(), "f97e00"},
+		{math.Inf(-1), "f9fc00"},
+		{float32(100000.0), "fa47c35000"},
+
+		{false, "f4"},
+		{true, "f5"},
+		{nil, "f6"},
+
+		{[]byte{}, "40"},
+		{[]byte{1, 2, 3, 4}, "4401020304"},
+		{"", "60"},
+		{"a", "6161"},
+		{"IETF", "6449455446"},
+		{"\"\\", "62225c"},
+		{"ü", "62c3bc"},
+		{"水", "63e6b0b4"},
+		{"\U00010151", "64f0908591"},
+
+		{[]int{}, "80"},
+		{[]int{1, 2, 3}, "83010203"},
+		{[]any{1, []int{2, 3}, []int{4, 5}}, "8301820203820405"},
+		{seq(1, 25), "98190102030405060708090a0b0c0d0e0f101112131415161718181819"},
+		{map[string]int{}, "a0"},
+		{map[string]any{"a": 1, "b": []int{2, 3}}, "a26161016162820203"},
+		{[]any{"a", map[string]string{"b": "c"}}, "826161a161626163"},
+		{map[string]string{"a": "A", "b": "B", "c": "C", "d": "D", "e": "E"}, "a56161614161626142616361436164614461656145"},
+	}
+	for _, tt := range tests {
+		got, err := Marshal(tt.v)
+		if err != nil {
+			t.Errorf("Marshal(%#v): %v", tt.v, err)
+			continue
+		}
+		if hex.EncodeToString(got) != tt.want {
+			t.Errorf("Marshal(%#v) = %x, want %s", tt.v, got, tt.want)
+		}
+	}
+}
+
+func seq(from, to int) []int {
+	s := make([]int, 0, to-from+1)
+	for i := from; i <= to; i++ {
+		s = append(s, i)
+	}
+	return s
+}
+
+type inner struct {
+	Name  string `json:"name"`
+	Shown int    `json:"shown"`
+}
+
+type Embedded struct {
+	Level string `json:"level"`
+	Depth int
+}
+
+type embeddedPtr struct {
+	Extra string `json:"extra,omitempty"`
+}
+
+type Tagged struct {
+	Conflict string `json:"conflict"`
+	Level    string `json:"level"`
+}
+
+type Untagged struct {
+	Conflict  string `json:"conflict"`
+	Ambiguous string
+}
+
+type Other struct {
+	Ambiguous string
+}
+
+type valueMarshaler struct{ n int }
+
+func (m valueMarshaler) MarshalJSON() ([]byte, error) {
+	return []byte(fmt.Sprintf(`{"value":%d}`, m.n)), nil
+}
+
+type pointerMarshaler struct{ n int }
+
+func (m *pointerMarshaler) MarshalJSON() ([]byte, error) {
+	return []byte(fmt.Sprintf(`["pointer",%d]`, m.n)), nil
+}
+
+type pointerText struct{ s string }
+
+func (m *pointerText) MarshalText() ([]byte, error) {
+	return []byte("text:" + m.s), nil
+}
+
+type sample struct {
+	Embedded
+	*embeddedPtr
+	Tagged `json:"tagged"`
+	Untagged
+	Other
+
+	Level     string `json:"level"` // shadows Embedded.Level
+	Plain     string
+	Renamed   int    `json:"renamed_field"`
+	Skipped   string `json:"-"`
+	Dash      string `json:"-,"`
+	private   string
+	Empty     string            `json:"empty,omitempty"`
+	Zero      int               `json:"zero,omitempty"`
+	NilSlice  []int             `json:"nil_slice,omitempty"`
+	NilMap    map[string]int    `json:"nil_map,omitempty"`
+	EmptyObj  inner             `json:"empty_obj,omitempty"` // structs are never empty
+	NilPtr    *inner            `json:"nil_ptr"`
+	Ptr       *inner            `json:"ptr"`
+	Floats    []float64         `json:"floats"`
+	Bytes     []byte            `json:"bytes"`
+	Map       map[string]inner  `json:"map"`
+	IntKeys   map[int]string    `json:"int_keys"`
+	Any       any               `json:"any"`
+	Raw       json.RawMessage   `json:"raw"`
+	Time      time.Time         `json:"time"`
+	Value     valueMarshaler    `json:"value"`
+	ValuePtr  *valueMarshaler   `json:"value_ptr"`
+	Pointer   pointerMarshaler  `json:"pointer"`
+	PointerP  *pointerMarshaler `json:"pointer_p"`
+	NilPtrM   *pointerMarshaler `json:"nil_pointer_m"`
+	Text      pointerText       `json:"text"`
+	Interface json.Marshaler    `json:"interface"`
+}
+
+func newSample() sample {
+	return sample{
+		Embedded:    Embedded{Level: "hidden", Depth: 3},
+		embeddedPtr: &embeddedPtr{Extra: "x"},
+		Tagged:      Tagged{Conflict: "tagged", Level: "t"},
+		Untagged:    Untagged{Conflict: "untagged", Ambiguous: "u"},
+		Other:       Other{Ambiguous: "o"},
+		Level:       "top",
+		Plain:       "plain",
+		Renamed:     7,
+		Skipped:     "skipped",
+		Dash:        "dash",
+		private:     "private",
+		Ptr:         &inner{Name: "p", Shown: 1},
+		Floats:      []float64{0, 1.5, -2.25, 1.1, 1e300},
+		Bytes:       []byte("hello"),
+		Map:         map[string]inner{"b": {Name: "b"}, "a": {Name: "a"}},
+		IntKeys:     map[int]string{2: "two", 10: "ten"},
+		Any:         []any{nil, true, "s", 42, -1.5},
+		Raw:         json.RawMessage(`{"z":[1,2.5,null],"a":"raw"}`),
+		Time:        time.Date(2026, 1, 2, 3, 4, 5, 6, time.UTC),
+		Value:       valueMarshaler{1},
+		ValuePtr:    &valueMarshaler{2},
+		Pointer:     pointerMarshaler{3},
+		PointerP:    &pointerMarshaler{4},
+		Text:        pointerText{"t"},
+		Interface:   valueMarshaler{5},
+	}
+}
+
+// TestMatchesJSON decodes the CBOR encoding and compares it with what
+// encoding/json produces for the same value. CBOR byte strings stand in for
+// JSON's base64 strings.
+func TestMatchesJSON(t *testing.T) {
+	s := newSample()
+	for name, v := range map[string]any{
+		// Through a pointer the fields are addressable, so pointer-receiver
+		// marshalers apply; by value they don't, for either encoder.
+		"pointer": &s,
+		"value":   s,
+		"slice":   []sample{s},
+		"map":     map[string]*sample{"s": &s},
+		"zero":    &sample{},
+	} {
+		t.Run(name, func(t *testing.T) {
+			b, err := Marshal(v)
+			if err != nil {
+				t.Fatalf("Marshal: %v", err)
+			}
+			got, rest, err := decode(b)
+			if err != nil {
+				t.Fatalf("decode %x: %v", b, err)
+			}
+			if len(rest) != 0 {
+				t.Fatalf("%d trailing bytes", len(rest))
+			}
+
+			j, err := json.Marshal(v)
+			if err != nil {
+				t.Fatalf("json.Marshal: %v", err)
+			}
+			var want any
+			if err := json.Unmarshal(j, &want); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				g, _ := json.Marshal(got)
+				t.Errorf("CBOR decodes to\n%s\nwant\n%s", g, j)
+			}
+		})
+	}
+}
+
+func TestPointerMarshalerAddressable(t *testing.T) {
+	v := &struct {
+		P pointerMarshaler `json:"p"`
+	}{pointerMarshaler{9}}
+	b, err := Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// {"p": ["pointer", 9]}
+	if want := "a161708267706f696e74657209"; hex.EncodeToString(b) != want {
+		t.Errorf("Marshal = %x, want %s", b, want)
+	}
+}
+
+// decode reads one CBOR item into the shape json.Unmarshal gives an any:
+// numbers become float64 and byte strings base64 text.
+func decode(b []byte) (any, []byte, error) {
+	if len(b) == 0 {
+		return nil, nil, fmt.Errorf("unexpected end")
+	}
+	major, info := b[0]>>5, b[0]&0x1f
+	b = b[1:]
+	if major == majorSimple {
+		switch info {
+		case 20:
+			return false, b, nil
+		case 21:
+			return true, b, nil
+		case 22:
+			return nil, b, nil
+		case 25:
+			return float16(binary.BigEndian.Uint16(b)), b[2:], nil
+		case 26:
+			return float64(math.Float32frombits(binary.BigEndian.Uint32(b))), b[4:], nil
+		case 27:
+			return math.Float64frombits(binary.BigEndian.Uint64(b)), b[8:], nil
+		}
+		return nil, nil, fmt.Errorf("simple value %d", info)
+	}
+
+	var n uint64
+	switch {
+	case info < 24:
+		n = uint64(info)
+	case info == 24:
+		n, b = uint64(b[0]), b[1:]
+	case info == 25:
+		n, b = uint64(binary.BigEndian.Uint16(b)), b[2:]
+	case info == 26:
+		n, b = uint64(binary.BigEndian.Uint32(b)), b[4:]
+	case info == 27:
+		n, b = binary.BigEndian.Uint64(b), b[8:]
+	default:
+		return nil, nil, fmt.Errorf("additional info %d", info)
+	}
+
+	switch major {
+	case majorUint:
+		return float64(n), b, nil
+	case majorNegint:
+		return -1 - float64(n), b, nil
+	case majorBytes:
+		return base64.StdEncoding.EncodeToString(b[:n]), b[n:], nil
+	case majorText:
+		return string(b[:n]), b[n:], nil
+	case majorArray:
+		a := make([]any, n)
+		for i := range a {
+			var err error
+			if a[i], b, err = decode(b); err != nil {
+				return nil, nil, err
+			}
+		}
+		return a, b, nil
+	case majorMap:
+		m := make(map[string]any, n)
+		for i := uint64(0); i < n; i++ {
+			k, rest, err := decode(b)
+			if err != nil {
+				return nil, nil, err
+			}
+			key, ok := k.(string)
+			if !ok {
+				return nil, nil, fmt.Errorf("map key %v is not text", k)
+			}
+			if m[key], b, err = decode(rest); err != nil {
+				return nil, nil, err
+			}
+		}
+		return m, b, nil
+	}
+	return nil, nil, fmt.Errorf("major type %d", major)
+}
+
+func float16(h uint16) float64 {
+	sign := 1.0
+	if h&0x8000 != 0 {
+		sign = -1
+	}
+	exp, mant := int(h>>10)&0x1f, float64(h&0x3ff)
+	switch exp {
+	case 0:
+		return sign * math.Ldexp(mant, -24)
+	case 0x1f:
+		if mant != 0 {
+			return math.NaN()
+		}
+		return math.Inf(int(sign))
+	}
+	return sign * math.Ldexp(1024+mant, exp-25)
+}
@@ -1,53 +1,185 @@
 package collector
 
-import "sync"
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// DeliveryMode says what Send does for a subscriber whose buffer is full.
+type DeliveryMode int
+
+const (
+	// DropNewest skips the new value, keeping what is already buffered.
+	DropNewest DeliveryMode = iota
+	// KeepLatest discards the oldest buffered value to make room, so a
+	// snapshot stream always ends on the most recent snapshot.
+	KeepLatest
+)
 
 // Broadcaster is a generic fan-out pub/sub for collector events.
-// Subscribers receive events on a buffered channel. Slow subscribers
-// are dropped (non-blocking send) to avoid back-pressure.
+// Subscribers receive events on a buffered channel. Sends never block:
+// a slow subscriber loses values (see DeliveryMode) and the loss is
+// counted on its Subscription and in Stats.
+//
+// Subscriber channels are never closed, so a Send racing a Close can't
+// panic; it may deliver one last value nobody reads, which is harmless.
 type Broadcaster[T any] struct {
-	mu   sync.Mutex
-	subs map[uint64]chan T
-	next uint64
+	mu      sync.RWMutex
+	subs    map[uint64]*Subscription[T]
+	next    uint64
+	sent    atomic.Uint64
+	dropped atomic.Uint64
+}
+
+// BroadcastStats is a snapshot of a broadcaster's counters. Sent and
+// Dropped cover the broadcaster's lifetime, including subscribers that
+// have since gone away.
+type BroadcastStats struct {
+	Subscribers int    `json:"subscribers"`
+	Sent        uint64 `json:"sent"`
+	Dropped     uint64 `json:"dropped"`
+}
+
+// Subscription is one subscriber's view of a Broadcaster.
+type Subscription[T any] struct {
+	// C receives broadcast values. It stays open after Close; use Done to
+	// learn that the subscription has ended.
+	C <-chan T
+
+	ch      chan T
+	done    chan struct{}
+	once    sync.Once
+	mode    DeliveryMode
+	sendMu  sync.Mutex // serializes KeepLatest's take-then-put
+	dropped atomic.Uint64
+	b       *Broadcaster[T]
+	id      uint64
+}
+
+// Dropped returns how many values this subscriber has lost because its
+// buffer was full.
+func (s *Subscription[T]) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+// Done is closed once the subscription is closed.
+func (s *Subscription[T]) Done() <-chan struct{} {
+	return s.done
+}
+
+// Close unsubscribes. It is safe to call more than once and concurrently
+// with Send.
+func (s *Subscription[T]) Close() {
+	s.once.Do(func() {
+		close(s.done)
+		s.b.remove(s.id)
+	})
 }
 
 // NewBroadcaster creates a ready-to-use broadcaster.
 func NewBroadcaster[T any]() *Broadcaster[T] {
 	return &Broadcaster[T]{
-		subs: make(map[uint64]chan T),
+		subs: make(map[uint64]*Subscription[T]),
 	}
 }
 
 // Subscribe returns a channel that receives broadcast events and a
 // cleanup function the caller must invoke when done.
 func (b *Broadcaster[T]) Subscribe(bufSize int) (<-chan T, func()) {
-	b.mu.Lock()
-	defer b.mu.Unlock()
+	sub := b.SubscribeMode(bufSize, DropNewest)
+	return sub.C, sub.Close
+}
 
-	id := b.next
-	b.next++
+// SubscribeMode subscribes with the given full-buffer behaviour. The
+// caller must Close the subscription when done.
+func (b *Broadcaster[T]) SubscribeMode(bufSize int, mode DeliveryMode) *Subscription[T] {
 	ch := make(chan T, bufSize)
-	b.subs[id] = ch
-
-	return ch, func() {
-		b.mu.Lock()
-		defer b.mu.Unlock()
-		delete(b.subs, id)
-		// Drain and close so readers unblock
-		close(ch)
+	sub := &Subscription[T]{
+		C:    ch,
+		ch:   ch,
+		done: make(chan struct{}),
+		mode: mode,
+		b:    b,
 	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	sub.id = b.next
+	b.next++
+	b.subs[sub.id] = sub
+	return sub
 }
 
-// Send delivers val to every subscriber. Subscribers whose buffer is
-// full are silently skipped.
-func (b *Broadcaster[T]) Send(val T) {
+func (b *Broadcaster[T]) remove(id uint64) {
 	b.mu.Lock()
 	defer b.mu.Unlock()
+	delete(b.subs, id)
+}
+
+// Send delivers val to every subscriber without blocking.
+func (b *Broadcaster[T]) Send(val T) {
+	b.mu.RLock()
+	subs := make([]*Subscription[T], 0, len(b.subs))
+	for _, sub := range b.subs {
+		subs = append(subs, sub)
+	}
+	b.mu.RUnlock()
+
+	b.sent.Add(1)
+	for _, sub := range subs {
+		if !sub.deliver(val) {
+			b.dropped.Add(1)
+		}
+	}
+}
+
+// Stats returns the current subscriber count and lifetime counters.
+func (b *Broadcaster[T]) Stats() BroadcastStats {
+	b.mu.RLock()
+	n := len(b.subs)
+	b.mu.RUnlock()
+	return BroadcastStats{
+		Subscribers: n,
+		Sent:        b.sent.Load(),
+		Dropped:     b.dropped.Load(),
+	}
+}
+
+// deliver reports whether val went out without losing a value.
+func (s *Subscription[T]) deliver(val T) bool {
+	select {
+	case <-s.done:
+		return true
+	default:
+	}
 
-	for _, ch := range b.subs {
+	if s.mode != KeepLatest {
 		select {
-		case ch <- val:
+		case s.ch <- val:
+			return true
 		default:
+			s.dropped.Add(1)
+			return false
 		}
 	}
+
+	s.sendMu.Lock()
+	defer s.sendMu.Unlock()
+	select {
+	case s.ch <- val:
+		return true
+	default:
+	}
+	s.dropped.Add(1)
+	// Senders are serialized, so after taking out the oldest value there
+	// is room unless the channel is unbuffered and nobody is receiving.
+	select {
+	case <-s.ch:
+	default:
+	}
+	select {
+	case s.ch <- val:
+	default:
+	}
+	return false
 }
@@ -0,0 +1,133 @@
+package collector
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestBroadcasterDropNewestCountsDrops(t *testing.T) {
+	b := NewBroadcaster[int]()
+	sub := b.SubscribeMode(2, DropNewest)
+	defer sub.Close()
+
+	for i := 1; i <= 5; i++ {
+		b.Send(i)
+	}
+	if got := []int{<-sub.C, <-sub.C}; got[0] != 1 || got[1] != 2 {
+		t.Errorf("received %v, want [1 2]", got)
+	}
+	if sub.Dropped() != 3 {
+		t.Errorf("Dropped() = %d, want 3", sub.Dropped())
+	}
+	stats := b.Stats()
+	if stats.Subscribers != 1 || stats.Sent != 5 || stats.Dropped != 3 {
+		t.Errorf("Stats() = %+v, want 1 subscriber, 5 sent, 3 dropped", stats)
+	}
+}
+
+func TestBroadcasterKeepLatest(t *testing.T) {
+	b := NewBroadcaster[int]()
+	sub := b.SubscribeMode(2, KeepLatest)
+	defer sub.Close()
+
+	for i := 1; i <= 5; i++ {
+		b.Send(i)
+	}
+	if got := []int{<-sub.C, <-sub.C}; got[0] != 4 || got[1] != 5 {
+		t.Errorf("received %v, want [4 5]", got)
+	}
+	if sub.Dropped() != 3 {
+		t.Errorf("Dropped() = %d, want 3", sub.Dropped())
+	}
+}
+
+func TestBroadcasterCloseStopsDelivery(t *testing.T) {
+	b := NewBroadcaster[int]()
+	sub := b.SubscribeMode(1, DropNewest)
+	sub.Close()
+	sub.Close() // idempotent
+
+	select {
+	case <-sub.Done():
+	default:
+		t.Fatal("Done() not closed after Close")
+	}
+	b.Send(1)
+	if n := b.Stats().Subscribers; n != 0 {
+		t.Errorf("Subscribers = %d after Close, want 0", n)
+	}
+	if sub.Dropped() != 0 {
+		t.Errorf("closed subscription counted a drop")
+	}
+}
+
+// Subscribers come and go while several goroutines send. Run with -race;
+// before subscriber channels stopped being closed, a Send racing a
+// cleanup could panic on a closed channel.
+func TestBroadcasterConcurrentSubscribeSendClose(t *testing.T) {
+	b := NewBroadcaster[int]()
+	const senders, sends, subscribers, minRounds = 4, 5000, 16, 200
+
+	start := make(chan struct{})
+	var sendWG sync.WaitGroup
+	for s := 0; s < senders; s++ {
+		sendWG.Add(1)
+		go func() {
+			defer sendWG.Done()
+			<-start
+			for i := 0; i < sends; i++ {
+				b.Send(i)
+			}
+		}()
+	}
+	sendersDone := make(chan struct{})
+	go func() {
+		sendWG.Wait()
+		close(sendersDone)
+	}()
+
+	var subWG sync.WaitGroup
+	for s := 0; s < subscribers; s++ {
+		subWG.Add(1)
+		go func(s int) {
+			defer subWG.Done()
+			mode := DropNewest
+			if s%2 == 1 {
+				mode = KeepLatest
+			}
+			for r := 0; ; r++ {
+				if r >= minRounds {
+					select {
+					case <-sendersDone:
+						return
+					default:
+					}
+				}
+				sub := b.SubscribeMode(s%3, mode)
+				select {
+				case <-sub.C:
+				default:
+				}
+				var closeWG sync.WaitGroup
+				for c := 0; c < 2; c++ {
+					closeWG.Add(1)
+					go func() {
+						defer closeWG.Done()
+						sub.Close()
+					}()
+				}
+				closeWG.Wait()
+			}
+		}(s)
+	}
+	close(start)
+	subWG.Wait()
+
+	stats := b.Stats()
+	if stats.Subscribers != 0 {
+		t.Errorf("Subscribers = %d after all closed, want 0", stats.Subscribers)
+	}
+	if stats.Sent != senders*sends {
+		t.Errorf("Sent = %d, want %d", stats.Sent, senders*sends)
+	}
+}
@@ -0,0 +1,337 @@
+package collector
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/neur0map/deskmon-agent/internal/hostfs"
+)
+
+const (
+	certScanInterval = time.Hour
+	certExpiringIn   = 14 * 24 * time.Hour
+)
+
+// Certificate is a certificate found in a store on disk, whether or not
+// anything serves it.
+type Certificate struct {
+	Domains       []string  `json:"domains"` // subject common name first, then the other SANs
+	Issuer        string    `json:"issuer"`
+	NotBefore     time.Time `json:"notBefore"`
+	NotAfter      time.Time `json:"notAfter"`
+	DaysRemaining int       `json:"daysRemaining"` // negative once expired
+	Status        string    `json:"status"`        // valid, expiring (within 14 days), expired
+	Source        string    `json:"source"`        // letsencrypt, traefik, caddy, file
+	Path          string    `json:"path"`          // host path of the file it was read from
+	Resolver      string    `json:"resolver,omitempty"`
+}
+
+// Certificate statuses.
+const (
+	CertValid    = "valid"
+	CertExpiring = "expiring"
+	CertExpired  = "expired"
+)
+
+// Well-known certificate stores, as host path globs.
+var certStoreGlobs = []struct {
+	source, pattern string
+}{
+	{"letsencrypt", "/etc/letsencrypt/live/*/cert.pem"},
+	{"traefik", "/etc/traefik/acme.json"},
+	{"traefik", "/etc/traefik/acme/*.json"},
+	{"caddy", "/var/lib/caddy/.local/share/caddy/certificates/*/*/*.crt"},
+	{"caddy", "/root/.local/share/caddy/certificates/*/*/*.crt"},
+	{"caddy", "/home/*/.local/share/caddy/certificates/*/*/*.crt"},
+}
+
+// CertificateCollector reads the certificates Let's Encrypt clients keep
+// on disk: certbot's /etc/letsencrypt, Traefik's acme.json and Caddy's data
+// directory, on the host and in the bind mounts and volumes of containers.
+// Unlike GET /routes it doesn't connect to anything, so it also sees
+// certificates for services that are down or not behind the local proxy.
+type CertificateCollector struct {
+	mu        sync.RWMutex
+	certs     []Certificate
+	sampledAt time.Time
+	sampleErr string
+	docker    *DockerCollector // may be nil
+	paths     []string         // extra globs from certificate_paths
+	stopCh    chan struct{}
+
+	// Broadcast sends the certificates after every scan.
+	Broadcast *Broadcaster[[]Certificate]
+}
+
+// NewCertificateCollector scans the well-known stores, the mounts of
+// docker's containers and the extra path globs (PEM files or acme.json).
+func NewCertificateCollector(docker *DockerCollector, paths []string) *CertificateCollector {
+	return &CertificateCollector{
+		certs:     []Certificate{},
+		docker:    docker,
+		paths:     paths,
+		stopCh:    make(chan struct{}),
+		Broadcast: NewBroadcaster[[]Certificate](),
+	}
+}
+
+// Start scans now and then every hour.
+func (cc *CertificateCollector) Start() {
+	go func() {
+		cc.refresh()
+		// Container mounts are only known once Docker has been listed, so
+		// look again shortly rather than an hour later.
+		wait := certScanInterval
+		if cc.docker != nil {
+			wait = 30 * time.Second
+		}
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		for {
+			select {
+			case <-timer.C:
+				cc.refresh()
+				timer.Reset(certScanInterval)
+			case <-cc.stopCh:
+				return
+			}
+		}
+	}()
+}
+
+func (cc *CertificateCollector) Stop() {
+	close(cc.stopCh)
+}
+
+// Collect returns the certificates found by the last scan, soonest expiry
+// first, with DaysRemaining and Status as of now.
+func (cc *CertificateCollector) Collect() []Certificate {
+	cc.mu.RLock()
+	out := make([]Certificate, len(cc.certs))
+	copy(out, cc.certs)
+	cc.mu.RUnlock()
+	now := time.Now()
+	for i := range out {
+		out[i].setStatus(now)
+	}
+	return out
+}
+
+func (cc *CertificateCollector) SampleInfo() SampleInfo {
+	cc.mu.RLock()
+	defer cc.mu.RUnlock()
+	return NewSampleInfo(cc.sampledAt, certScanInterval, cc.sampleErr)
+}
+
+func (c *Certificate) setStatus(now time.Time) {
+	left := c.NotAfter.Sub(now)
+	c.DaysRemaining = int(math.Floor(left.Hours() / 24))
+	switch {
+	case left <= 0:
+		c.Status = CertExpired
+	case left <= certExpiringIn:
+		c.Status = CertExpiring
+	default:
+		c.Status = CertValid
+	}
+}
+
+func (cc *CertificateCollector) refresh() {
+	// Host paths of each store file, with the source it belongs to.
+	files := make(map[string]string)
+	var order []string
+	add := func(source, path string) {
+		if _, ok := files[path]; !ok {
+			files[path] = source
+			order = append(order, path)
+		}
+	}
+	for _, g := range certStoreGlobs {
+		for _, p := range hostGlob(g.pattern) {
+			add(g.source, p)
+		}
+	}
+	if cc.docker != nil {
+		for _, sources := range cc.docker.MountSources() {
+			for _, src := range sources {
+				for source, paths := range mountedCertStores(src) {
+					for _, p := range paths {
+						add(source, p)
+					}
+				}
+			}
+		}
+	}
+	for _, pattern := range cc.paths {
+		for _, p := range hostGlob(pattern) {
+			source := "file"
+			if strings.HasSuffix(p, ".json") {
+				source = "traefik"
+			}
+			add(source, p)
+		}
+	}
+
+	certs := []Certificate{}
+	var errs []string
+	for _, path := range order {
+		found, err := readCertStore(files[path], path)
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		certs = append(certs, found...)
+	}
+	sort.Slice(certs, func(i, j int) bool {
+		if !certs[i].NotAfter.Equal(certs[j].NotAfter) {
+			return certs[i].NotAfter.Before(certs[j].NotAfter)
+		}
+		return certs[i].Path < certs[j].Path
+	})
+	now := time.Now()
+	for i := range certs {
+		certs[i].setStatus(now)
+	}
+
+	cc.mu.Lock()
+	cc.certs = certs
+	cc.sampledAt = now
+	cc.sampleErr = strings.Join(errs, "; ")
+	cc.mu.Unlock()
+
+	out := make([]Certificate, len(certs))
+	copy(out, certs)
+	cc.Broadcast.Send(out)
+}
+
+// hostGlob expands a host path glob and returns host paths.
+func hostGlob(pattern string) []string {
+	matches, _ := filepath.Glob(hostfs.Path(pattern))
+	root := strings.TrimSuffix(hostfs.Path("/"), "/")
+	for i, m := range matches {
+		matches[i] = strings.TrimPrefix(m, root)
+	}
+	return matches
+}
+
+// mountedCertStores finds stores in a container's mount source: an
+// acme.json file or a directory holding one (Traefik), Caddy's /data
+// volume, or a mounted /etc/letsencrypt (certbot).
+func mountedCertStores(src string) map[string][]string {
+	stores := make(map[string][]string)
+	if filepath.Base(src) == "acme.json" {
+		stores["traefik"] = []string{src}
+		return stores
+	}
+	info, err := os.Stat(hostfs.Path(src))
+	if err != nil || !info.IsDir() {
+		return stores
+	}
+	stores["traefik"] = hostGlob(filepath.Join(src, "acme.json"))
+	stores["caddy"] = hostGlob(filepath.Join(src, "caddy", "certificates", "*", "*", "*.crt"))
+	stores["letsencrypt"] = hostGlob(filepath.Join(src, "live", "*", "cert.pem"))
+	return stores
+}
+
+func readCertStore(source, path string) ([]Certificate, error) {
+	data, err := os.ReadFile(hostfs.Path(path))
+	if err != nil {
+		return nil, err
+	}
+	if source == "traefik" {
+		certs, err := parseAcmeJSON(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		for i := range certs {
+			certs[i].Source, certs[i].Path = source, path
+		}
+		return certs, nil
+	}
+	c, err := parseLeafPEM(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	c.Source, c.Path = source, path
+	return []Certificate{*c}, nil
+}
+
+// parseAcmeJSON reads Traefik's (v2+) ACME storage, which keeps each
+// resolver's certificates as base64-encoded PEM chains:
+//
+//	{"letsencrypt": {"Account": {...}, "Certificates": [
+//	  {"domain": {"main": "example.com", "sans": ["www.example.com"]}, "certificate": "LS0tLS1CRUdJTi...", "key": "...", "Store": "default"}]}}
+func parseAcmeJSON(data []byte) ([]Certificate, error) {
+	var resolvers map[string]struct {
+		Certificates []struct {
+			Certificate string `json:"certificate"`
+		} `json:"Certificates"`
+	}
+	if err := json.Unmarshal(data, &resolvers); err != nil {
+		return nil, fmt.Errorf("invalid acme.json: %w", err)
+	}
+	var certs []Certificate
+	for name, r := range resolvers {
+		for _, entry := range r.Certificates {
+			chain, err := base64.StdEncoding.DecodeString(entry.Certificate)
+			if err != nil {
+				continue
+			}
+			c, err := parseLeafPEM(chain)
+			if err != nil {
+				continue
+			}
+			c.Resolver = name
+			certs = append(certs, *c)
+		}
+	}
+	return certs, nil
+}
+
+// parseLeafPEM parses the first certificate of a PEM file or chain.
+func parseLeafPEM(data []byte) (*Certificate, error) {
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return nil, fmt.Errorf("no certificate found")
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		leaf, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		c := &Certificate{
+			Issuer:    leaf.Issuer.CommonName,
+			NotBefore: leaf.NotBefore,
+			NotAfter:  leaf.NotAfter,
+		}
+		if cn := leaf.Subject.CommonName; cn != "" {
+			c.Domains = append(c.Domains, cn)
+		}
+		for _, name := range leaf.DNSNames {
+			if name != leaf.Subject.CommonName {
+				c.Domains = append(c.Domains, name)
+			}
+		}
+		for _, ip := range leaf.IPAddresses {
+			c.Domains = append(c.Domains, ip.String())
+		}
+		if c.Domains == nil {
+			c.Domains = []string{}
+		}
+		return c, nil
+	}
+}
@@ -0,0 +1,339 @@
+package collector
+
+import (
+	"bufio"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/neur0map/deskmon-agent/internal/hostfs"
+)
+
+const cgroupRefreshInterval = 5 * time.Second
+
+// SliceStats is the resource use of one top-level cgroup v2 group.
+// CPUPercent is relative to the whole machine (all cores = 100).
+type SliceStats struct {
+	Name               string  `json:"name"`
+	Category           string  `json:"category"` // system, user, containers, vms, other
+	CPUPercent         float64 `json:"cpuPercent"`
+	MemoryBytes        uint64  `json:"memoryBytes"`
+	IOReadBytesPerSec  float64 `json:"ioReadBytesPerSec"`
+	IOWriteBytesPerSec float64 `json:"ioWriteBytesPerSec"`
+	Tasks              uint64  `json:"tasks"`
+}
+
+// CgroupReport is the slice breakdown. Available is false on cgroup v1
+// hosts, with Reason explaining why.
+type CgroupReport struct {
+	Available bool         `json:"available"`
+	Reason    string       `json:"reason,omitempty"`
+	Slices    []SliceStats `json:"slices"`
+}
+
+// cgroupCounters are the cumulative values that rates are derived from.
+type cgroupCounters struct {
+	usageUsec uint64
+	ioRead    uint64
+	ioWrite   uint64
+}
+
+// CgroupCollector walks the top level of the cgroup v2 hierarchy so CPU,
+// memory and IO can be split into system services, user sessions and
+// containers.
+type CgroupCollector struct {
+	mu        sync.RWMutex
+	root      string
+	report    CgroupReport
+	prev      map[string]cgroupCounters // by cgroup directory
+	prevAt    time.Time
+	sampledAt time.Time
+	coreCount int
+	stopCh    chan struct{}
+	Pauser
+}
+
+func NewCgroupCollector() *CgroupCollector {
+	return &CgroupCollector{
+		root:      hostfs.Sys("fs/cgroup"),
+		report:    CgroupReport{Slices: []SliceStats{}},
+		prev:      make(map[string]cgroupCounters),
+		coreCount: countCPUCores(),
+		stopCh:    make(chan struct{}),
+	}
+}
+
+// Start begins sampling every 5 seconds. On cgroup v1 hosts it records the
+// reason and does nothing else.
+func (cc *CgroupCollector) Start() {
+	if _, err := os.Stat(filepath.Join(cc.root, "cgroup.controllers")); err != nil {
+		cc.mu.Lock()
+		cc.report.Reason = "cgroup v2 (unified hierarchy) not mounted at " + cc.root
+		cc.mu.Unlock()
+		return
+	}
+
+	cc.refresh()
+	go func() {
+		ticker := time.NewTicker(cgroupRefreshInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if !cc.Paused() {
+					cc.refresh()
+				}
+			case <-cc.stopCh:
+				return
+			}
+		}
+	}()
+}
+
+func (cc *CgroupCollector) Stop() {
+	close(cc.stopCh)
+}
+
+// Collect returns the latest slice breakdown (non-blocking).
+func (cc *CgroupCollector) Collect() CgroupReport {
+	cc.mu.RLock()
+	defer cc.mu.RUnlock()
+	report := cc.report
+	report.Slices = make([]SliceStats, len(cc.report.Slices))
+	copy(report.Slices, cc.report.Slices)
+	return report
+}
+
+func (cc *CgroupCollector) SampleInfo() SampleInfo {
+	cc.mu.RLock()
+	defer cc.mu.RUnlock()
+	return NewSampleInfo(cc.sampledAt, cgroupRefreshInterval, cc.report.Reason)
+}
+
+// groups lists the top-level cgroups to report, keyed by display name. The
+// container scopes systemd places under system.slice are split out into
+// their own group so "system services" doesn't include Docker.
+func (cc *CgroupCollector) groups() map[string][]string {
+	groups := make(map[string][]string)
+	entries, err := os.ReadDir(cc.root)
+	if err != nil {
+		return groups
+	}
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		dir := filepath.Join(cc.root, e.Name())
+		if e.Name() != "system.slice" {
+			groups[e.Name()] = []string{dir}
+			continue
+		}
+
+		var containers []string
+		children, _ := os.ReadDir(dir)
+		for _, c := range children {
+			if c.IsDir() && isContainerScope(c.Name()) {
+				containers = append(containers, filepath.Join(dir, c.Name()))
+			}
+		}
+		groups["system.slice"] = []string{dir}
+		if len(containers) > 0 {
+			groups["system.slice/containers"] = containers
+		}
+	}
+	return groups
+}
+
+func isContainerScope(name string) bool {
+	return strings.HasSuffix(name, ".scope") &&
+		(strings.HasPrefix(name, "docker-") || strings.HasPrefix(name, "libpod-") ||
+			strings.HasPrefix(name, "cri-containerd-") || strings.HasPrefix(name, "crio-"))
+}
+
+func sliceCategory(name string) string {
+	switch {
+	case name == "system.slice/containers", name == "docker", name == "kubepods",
+		name == "kubepods.slice", name == "lxc.payload", strings.HasPrefix(name, "lxc.payload."):
+		return "containers"
+	case name == "machine.slice":
+		return "vms"
+	case name == "system.slice", name == "init.scope":
+		return "system"
+	case name == "user.slice":
+		return "user"
+	}
+	return "other"
+}
+
+func (cc *CgroupCollector) refresh() {
+	now := time.Now()
+	groups := cc.groups()
+
+	cur := make(map[string]cgroupCounters) // by cgroup directory
+	stats := make(map[string]*SliceStats, len(groups))
+	for name, dirs := range groups {
+		s := &SliceStats{Name: name, Category: sliceCategory(name)}
+		for _, dir := range dirs {
+			r, w := readCgroupIO(filepath.Join(dir, "io.stat"))
+			cur[dir] = cgroupCounters{
+				usageUsec: readCgroupKey(filepath.Join(dir, "cpu.stat"), "usage_usec"),
+				ioRead:    r,
+				ioWrite:   w,
+			}
+			s.MemoryBytes += readCgroupUint(filepath.Join(dir, "memory.current"))
+			s.Tasks += readCgroupUint(filepath.Join(dir, "pids.current"))
+		}
+		stats[name] = s
+	}
+
+	// system.slice includes its container scopes; count them only once.
+	if ctr, ok := stats["system.slice/containers"]; ok {
+		sys := stats["system.slice"]
+		sys.MemoryBytes = saturatingSub(sys.MemoryBytes, ctr.MemoryBytes)
+		sys.Tasks = saturatingSub(sys.Tasks, ctr.Tasks)
+	}
+
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+
+	elapsed := now.Sub(cc.prevAt).Seconds()
+	if !cc.prevAt.IsZero() && elapsed > 0 {
+		deltas := cc.deltas(groups, cur)
+		// Subtract the containers' deltas, not their lifetime totals: a
+		// scope that exits leaves its usage in system.slice but drops out
+		// of the containers, and one that starts does the reverse.
+		if ctr, ok := deltas["system.slice/containers"]; ok {
+			if sys, ok := deltas["system.slice"]; ok {
+				deltas["system.slice"] = cgroupCounters{
+					usageUsec: saturatingSub(sys.usageUsec, ctr.usageUsec),
+					ioRead:    saturatingSub(sys.ioRead, ctr.ioRead),
+					ioWrite:   saturatingSub(sys.ioWrite, ctr.ioWrite),
+				}
+			}
+		}
+		for name, d := range deltas {
+			s := stats[name]
+			if cc.coreCount > 0 {
+				cpu := float64(d.usageUsec) / (elapsed * 1e6 * float64(cc.coreCount)) * 100
+				s.CPUPercent = math.Round(cpu*100) / 100
+			}
+			s.IOReadBytesPerSec = math.Round(float64(d.ioRead) / elapsed)
+			s.IOWriteBytesPerSec = math.Round(float64(d.ioWrite) / elapsed)
+		}
+	}
+
+	slices := make([]SliceStats, 0, len(stats))
+	for _, s := range stats {
+		slices = append(slices, *s)
+	}
+	sort.Slice(slices, func(i, j int) bool {
+		if slices[i].CPUPercent != slices[j].CPUPercent {
+			return slices[i].CPUPercent > slices[j].CPUPercent
+		}
+		return slices[i].Name < slices[j].Name
+	})
+
+	cc.prev = cur
+	cc.prevAt = now
+	cc.sampledAt = now
+	cc.report = CgroupReport{Available: true, Slices: slices}
+}
+
+// deltas sums, per group, how much each directory's counters grew since
+// the previous refresh. A container scope new since then counts in full,
+// as all of its usage falls in the interval; any other new group has no
+// rate until the next refresh. Called with cc.mu held.
+func (cc *CgroupCollector) deltas(groups map[string][]string, cur map[string]cgroupCounters) map[string]cgroupCounters {
+	out := make(map[string]cgroupCounters, len(groups))
+	for name, dirs := range groups {
+		var sum cgroupCounters
+		rated := true
+		for _, dir := range dirs {
+			prev, ok := cc.prev[dir]
+			if !ok && name != "system.slice/containers" {
+				rated = false
+				break
+			}
+			c := cur[dir]
+			sum.usageUsec += saturatingSub(c.usageUsec, prev.usageUsec)
+			sum.ioRead += saturatingSub(c.ioRead, prev.ioRead)
+			sum.ioWrite += saturatingSub(c.ioWrite, prev.ioWrite)
+		}
+		if rated {
+			out[name] = sum
+		}
+	}
+	return out
+}
+
+// saturatingSub returns a-b, or 0 when a counter went backwards (cgroup
+// recreated).
+func saturatingSub(a, b uint64) uint64 {
+	if a < b {
+		return 0
+	}
+	return a - b
+}
+
+func readCgroupUint(path string) uint64 {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0
+	}
+	v, _ := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+	return v
+}
+
+// readCgroupKey reads a "key value" line from a flat-keyed file such as
+// cpu.stat.
+func readCgroupKey(path, key string) uint64 {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && fields[0] == key {
+			v, _ := strconv.ParseUint(fields[1], 10, 64)
+			return v
+		}
+	}
+	return 0
+}
+
+// readCgroupIO sums rbytes/wbytes across devices in io.stat:
+//
+//	8:0 rbytes=1459200 wbytes=314773504 rios=192 wios=353 dbytes=0 dios=0
+func readCgroupIO(path string) (read, write uint64) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, 0
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		for _, field := range strings.Fields(scanner.Text()) {
+			key, val, ok := strings.Cut(field, "=")
+			if !ok {
+				continue
+			}
+			n, _ := strconv.ParseUint(val, 10, 64)
+			switch key {
+			case "rbytes":
+				read += n
+			case "wbytes":
+				write += n
+			}
+		}
+	}
+	return read, write
+}
@@ -0,0 +1,71 @@
+package collector
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCgroupSystemSliceSubtractsContainerDeltas(t *testing.T) {
+	root := t.TempDir()
+	write := func(group string, usageUsec, wbytes uint64) {
+		t.Helper()
+		dir := filepath.Join(root, group)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		files := map[string]string{
+			"cpu.stat": fmt.Sprintf("usage_usec %d\nuser_usec 0\n", usageUsec),
+			"io.stat":  fmt.Sprintf("8:0 rbytes=0 wbytes=%d rios=0 wios=0\n", wbytes),
+		}
+		for name, data := range files {
+			if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	cc := &CgroupCollector{root: root, prev: make(map[string]cgroupCounters), coreCount: 1}
+	// refresh measures against one second ago, so rates read as per second.
+	refresh := func() map[string]SliceStats {
+		cc.prevAt = time.Now().Add(-time.Second)
+		cc.refresh()
+		out := make(map[string]SliceStats)
+		for _, s := range cc.Collect().Slices {
+			out[s.Name] = s
+		}
+		return out
+	}
+	near := func(got, want float64) bool { return math.Abs(got-want) <= want*0.05+0.5 }
+
+	// system.slice's counters include the container scope under it.
+	write("system.slice", 10_000_000, 10_000)
+	write("system.slice/docker-a.scope", 8_000_000, 8_000)
+	refresh()
+
+	// Container a exits. Its lifetime usage stays in system.slice, which
+	// itself used 0.1s of CPU and wrote 100 bytes.
+	if err := os.RemoveAll(filepath.Join(root, "system.slice/docker-a.scope")); err != nil {
+		t.Fatal(err)
+	}
+	write("system.slice", 10_100_000, 10_100)
+	got := refresh()
+	if sys := got["system.slice"]; !near(sys.CPUPercent, 10) || !near(sys.IOWriteBytesPerSec, 100) {
+		t.Errorf("after a container exit system.slice = %.2f%% CPU, %.0f B/s written; want about 10%% and 100 B/s",
+			sys.CPUPercent, sys.IOWriteBytesPerSec)
+	}
+
+	// Container b starts and uses 0.5s; system.slice grows by that plus
+	// its own 0.1s.
+	write("system.slice", 10_700_000, 10_200)
+	write("system.slice/docker-b.scope", 500_000, 0)
+	got = refresh()
+	if sys := got["system.slice"]; !near(sys.CPUPercent, 10) {
+		t.Errorf("after a container start system.slice = %.2f%% CPU, want about 10%%", sys.CPUPercent)
+	}
+	if ctr := got["system.slice/containers"]; !near(ctr.CPUPercent, 50) {
+		t.Errorf("containers = %.2f%% CPU, want about 50%%", ctr.CPUPercent)
+	}
+}
@@ -0,0 +1,48 @@
+package collector
+
+import (
+	"maps"
+	"time"
+)
+
+// ContainerDisk is a container's disk footprint from the Docker disk usage
+// API (what `docker system df -v` shows). Measuring it walks every layer
+// and volume, so it is refreshed every diskUsageInterval in the background
+// rather than with the 5s stats.
+type ContainerDisk struct {
+	WritableBytes int64         `json:"writableBytes"` // files the container wrote to its own layer
+	RootFsBytes   int64         `json:"rootFsBytes"`   // writable layer plus the image
+	VolumesBytes  int64         `json:"volumesBytes"`  // sum of the named volumes below with a known size
+	Volumes       []VolumeUsage `json:"volumes"`
+	MeasuredAt    time.Time     `json:"measuredAt"`
+}
+
+// VolumeUsage is one named volume mounted by a container.
+type VolumeUsage struct {
+	Name        string `json:"name"`
+	Destination string `json:"destination"`
+	SizeBytes   int64  `json:"sizeBytes"` // -1 when the volume driver doesn't report it
+	Containers  int    `json:"containers"`
+}
+
+// diskUsageInterval is how often container disk usage is re-measured.
+const diskUsageInterval = 10 * time.Minute
+
+// MountSources returns the host paths each container uses through bind
+// mounts and volumes, keyed by container name.
+func (dc *DockerCollector) MountSources() map[string][]string {
+	dc.mu.RLock()
+	defer dc.mu.RUnlock()
+	return maps.Clone(dc.mounts)
+}
+
+// applyDiskUsage attaches the last disk measurement to each container.
+// Must be called with dc.mu held.
+func (dc *DockerCollector) applyDiskUsage(results []ContainerStats) {
+	for i := range results {
+		if d, ok := dc.disk[results[i].ID]; ok {
+			d := d
+			results[i].Disk = &d
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package collector
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// DiskIOStats is one block device's activity since the previous sample.
+// Only whole devices are listed (sda, nvme0n1, md0, dm-0), not their
+// partitions, so the figures don't count the same I/O twice.
+type DiskIOStats struct {
+	Device           string  `json:"device"`
+	ReadBytesPerSec  float64 `json:"readBytesPerSec"`
+	WriteBytesPerSec float64 `json:"writeBytesPerSec"`
+	ReadIOPS         float64 `json:"readIops"`
+	WriteIOPS        float64 `json:"writeIops"`
+	BusyPercent      float64 `json:"busyPercent"` // share of the interval with I/O in flight
+}
+
+// diskIOCounters are a device's cumulative counters.
+type diskIOCounters struct {
+	reads, readBytes   uint64
+	writes, writeBytes uint64
+	busyMillis         uint64
+}
+
+// diskIOSample is every device's counters at one point in time, read by
+// the platform layer's readDiskIOSample.
+type diskIOSample struct {
+	devices   map[string]diskIOCounters
+	timestamp time.Time
+}
+
+// calcDiskIO turns two samples into per-device rates, sorted by device.
+// Devices that appeared in between are left out until the next sample.
+func calcDiskIO(prev, cur diskIOSample) []DiskIOStats {
+	elapsed := cur.timestamp.Sub(prev.timestamp).Seconds()
+	out := []DiskIOStats{}
+	if elapsed <= 0 {
+		return out
+	}
+	rate := func(p, c uint64) float64 {
+		if c < p {
+			return 0 // counter reset
+		}
+		return math.Round(float64(c-p)/elapsed*100) / 100
+	}
+	for dev, c := range cur.devices {
+		p, ok := prev.devices[dev]
+		if !ok {
+			continue
+		}
+		busy := rate(p.busyMillis, c.busyMillis) / 10 // ms per second → percent
+		out = append(out, DiskIOStats{
+			Device:           dev,
+			ReadBytesPerSec:  rate(p.readBytes, c.readBytes),
+			WriteBytesPerSec: rate(p.writeBytes, c.writeBytes),
+			ReadIOPS:         rate(p.reads, c.reads),
+			WriteIOPS:        rate(p.writes, c.writes),
+			BusyPercent:      math.Min(math.Round(busy*100)/100, 100),
+		})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Device < out[j].Device })
+	return out
+}
@@ -0,0 +1,312 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/neur0map/deskmon-agent/internal/config"
+)
+
+const (
+	defaultDNSInterval = 5 * time.Minute
+	minDNSInterval     = 30 * time.Second
+	dnsLookupTimeout   = 10 * time.Second
+
+	defaultWANURL  = "https://api.ipify.org"
+	defaultWAN6URL = "https://api6.ipify.org"
+)
+
+// DNSReport is the result of the last check of the configured records.
+type DNSReport struct {
+	WANAddress  string            `json:"wanAddress,omitempty"`  // public IPv4 address, when a record expects "wan"
+	WANAddress6 string            `json:"wanAddress6,omitempty"` // public IPv6 address, when an AAAA record expects "wan"
+	Records     []DNSRecordResult `json:"records"`
+	CheckedAt   *time.Time        `json:"checkedAt,omitempty"`
+}
+
+// DNSRecordResult is one configured record as the host's resolvers see it.
+type DNSRecordResult struct {
+	Name     string   `json:"name"`
+	Type     string   `json:"type"`
+	Expected []string `json:"expected"` // with "wan" replaced by the public address
+	Actual   []string `json:"actual"`
+	Status   string   `json:"status"` // ok, mismatch, missing, error, unknown
+	Error    string   `json:"error,omitempty"`
+}
+
+// DNS record check statuses. Only mismatch and missing raise alerts; a
+// failed lookup (timeout, SERVFAIL) or an unknown public address says
+// nothing about the record itself.
+const (
+	DNSOK       = "ok"
+	DNSMismatch = "mismatch"
+	DNSMissing  = "missing" // the name or record type doesn't exist
+	DNSError    = "error"
+	DNSUnknown  = "unknown" // the public address couldn't be looked up
+)
+
+// DNSChecker periodically resolves the records in the dns config through
+// the host's resolvers and compares them with the expected values.
+type DNSChecker struct {
+	mu     sync.RWMutex
+	cfg    config.DNSConfig
+	report DNSReport
+	stopCh chan struct{}
+
+	resolver *net.Resolver
+	client   *http.Client
+
+	// Broadcast sends the report after every check.
+	Broadcast *Broadcaster[DNSReport]
+}
+
+func NewDNSChecker(cfg config.DNSConfig) *DNSChecker {
+	return &DNSChecker{
+		cfg:       cfg,
+		report:    DNSReport{Records: []DNSRecordResult{}},
+		stopCh:    make(chan struct{}),
+		resolver:  net.DefaultResolver,
+		client:    &http.Client{Timeout: dnsLookupTimeout},
+		Broadcast: NewBroadcaster[DNSReport](),
+	}
+}
+
+// Start checks now and then every interval, if any records are configured.
+func (dc *DNSChecker) Start() {
+	if len(dc.cfg.Records) == 0 {
+		return
+	}
+	interval := dc.cfg.Interval
+	if interval <= 0 {
+		interval = defaultDNSInterval
+	}
+	interval = max(interval, minDNSInterval)
+	log.Printf("dns: checking %d record(s) every %s", len(dc.cfg.Records), interval)
+
+	go func() {
+		dc.check()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				dc.check()
+			case <-dc.stopCh:
+				return
+			}
+		}
+	}()
+}
+
+func (dc *DNSChecker) Stop() {
+	close(dc.stopCh)
+}
+
+// Collect returns the last report; Records is empty before the first check
+// and without configured records.
+func (dc *DNSChecker) Collect() DNSReport {
+	dc.mu.RLock()
+	defer dc.mu.RUnlock()
+	r := dc.report
+	r.Records = slices.Clone(r.Records)
+	return r
+}
+
+func (dc *DNSChecker) check() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	report := DNSReport{Records: make([]DNSRecordResult, 0, len(dc.cfg.Records))}
+	var wan4, wan6 string
+	var wan4Err, wan6Err error
+	needsWAN := func(typ string) bool {
+		for _, r := range dc.cfg.Records {
+			if dnsType(r) == typ && slices.Contains(r.Expect, "wan") {
+				return true
+			}
+		}
+		return false
+	}
+	if needsWAN("A") {
+		wan4, wan4Err = dc.publicAddress(ctx, orDefault(dc.cfg.WANURL, defaultWANURL), true)
+		report.WANAddress = wan4
+	}
+	if needsWAN("AAAA") {
+		wan6, wan6Err = dc.publicAddress(ctx, orDefault(dc.cfg.WAN6URL, defaultWAN6URL), false)
+		report.WANAddress6 = wan6
+	}
+
+	for _, r := range dc.cfg.Records {
+		res := DNSRecordResult{Name: r.Name, Type: dnsType(r), Actual: []string{}}
+		wan, wanErr := wan4, wan4Err
+		if res.Type == "AAAA" {
+			wan, wanErr = wan6, wan6Err
+		}
+		for _, v := range r.Expect {
+			if v == "wan" && (res.Type == "A" || res.Type == "AAAA") {
+				if wanErr != nil {
+					res.Status, res.Error = DNSUnknown, "public address: "+wanErr.Error()
+				}
+				v = wan
+			}
+			res.Expected = append(res.Expected, normalizeDNSValue(res.Type, v))
+		}
+
+		actual, err := dc.lookup(ctx, res.Type, r.Name)
+		switch {
+		case err != nil:
+			var dnsErr *net.DNSError
+			if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+				res.Status, res.Error = DNSMissing, err.Error()
+			} else if res.Status == "" {
+				res.Status, res.Error = DNSError, err.Error()
+			}
+		case res.Status == DNSUnknown:
+			res.Actual = actual
+		default:
+			res.Actual = actual
+			res.Status = DNSOK
+			if !sameValues(res.Expected, actual) {
+				res.Status = DNSMismatch
+			}
+		}
+		report.Records = append(report.Records, res)
+	}
+	now := time.Now()
+	report.CheckedAt = &now
+
+	dc.mu.Lock()
+	dc.report = report
+	dc.mu.Unlock()
+	dc.Broadcast.Send(report)
+}
+
+// lookup resolves name's records of one type, normalized for comparison.
+func (dc *DNSChecker) lookup(ctx context.Context, typ, name string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, dnsLookupTimeout)
+	defer cancel()
+	var out []string
+	switch typ {
+	case "A", "AAAA":
+		network := "ip4"
+		if typ == "AAAA" {
+			network = "ip6"
+		}
+		ips, err := dc.resolver.LookupNetIP(ctx, network, name)
+		if err != nil {
+			return nil, err
+		}
+		for _, ip := range ips {
+			out = append(out, ip.Unmap().String())
+		}
+	case "CNAME":
+		cname, err := dc.resolver.LookupCNAME(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, cname)
+	case "MX":
+		mxs, err := dc.resolver.LookupMX(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		for _, mx := range mxs {
+			out = append(out, mx.Host)
+		}
+	case "NS":
+		nss, err := dc.resolver.LookupNS(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		for _, ns := range nss {
+			out = append(out, ns.Host)
+		}
+	case "TXT":
+		txts, err := dc.resolver.LookupTXT(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		out = txts
+	}
+	for i := range out {
+		out[i] = normalizeDNSValue(typ, out[i])
+	}
+	slices.Sort(out)
+	return slices.Compact(out), nil
+}
+
+// publicAddress asks a "what is my IP" service for this network's public
+// address; the body is the address as text.
+func (dc *DNSChecker) publicAddress(ctx context.Context, url string, v4 bool) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := dc.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%s: HTTP %d", url, resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 256))
+	if err != nil {
+		return "", err
+	}
+	family := 6
+	if v4 {
+		family = 4
+	}
+	ip, err := netip.ParseAddr(strings.TrimSpace(string(body)))
+	if err != nil || ip.Unmap().Is4() != v4 {
+		return "", fmt.Errorf("%s did not return an IPv%d address", url, family)
+	}
+	return ip.Unmap().String(), nil
+}
+
+func dnsType(r config.DNSRecordCheck) string {
+	if r.Type == "" {
+		return "A"
+	}
+	return strings.ToUpper(r.Type)
+}
+
+// normalizeDNSValue makes values comparable: host names are lowercased
+// without the trailing dot, addresses in their canonical form.
+func normalizeDNSValue(typ, v string) string {
+	switch typ {
+	case "A", "AAAA":
+		if ip, err := netip.ParseAddr(v); err == nil {
+			return ip.Unmap().String()
+		}
+	case "CNAME", "MX", "NS":
+		return strings.ToLower(strings.TrimSuffix(v, "."))
+	}
+	return v
+}
+
+// sameValues reports whether the record has exactly the expected values,
+// in any order.
+func sameValues(expected, actual []string) bool {
+	want := slices.Clone(expected)
+	slices.Sort(want)
+	return slices.Equal(slices.Compact(want), actual)
+}
+
+func orDefault(s, def string) string {
+	if s == "" {
+		return def
+	}
+	return s
+}
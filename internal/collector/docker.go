@@ -1,18 +1,12 @@
 package collector
 
 import (
-	"context"
-	"encoding/json"
-	"io"
-	"math"
-	"strconv"
+	"errors"
+	"log"
+	"maps"
 	"strings"
 	"sync"
 	"time"
-
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/client"
-	"github.com/docker/go-connections/nat"
 )
 
 type PortMapping struct {
@@ -38,34 +32,187 @@ type ContainerStats struct {
 	Ports           []PortMapping `json:"ports"`
 	RestartCount    int           `json:"restartCount"`
 	HealthStatus    string        `json:"healthStatus"`
+	RecentRestarts  int           `json:"recentRestarts"` // daemon restarts within flapWindow
+	Flapping        bool          `json:"flapping"`       // stuck in a restart loop
+	OOMKilled       bool          `json:"oomKilled"`      // last exit was an OOM kill
+
+	// Limits from HostConfig. Percentages are of the container's own limit,
+	// 0 when the container is unconstrained.
+	CPULimitCores        float64 `json:"cpuLimitCores"` // from --cpus or quota/period
+	CPUShares            int64   `json:"cpuShares"`     // relative weight, 0 = default
+	CPUPercentOfLimit    float64 `json:"cpuPercentOfLimit"`
+	MemoryHardLimitMB    float64 `json:"memoryHardLimitMB"` // --memory, 0 = unlimited
+	MemoryPercentOfLimit float64 `json:"memoryPercentOfLimit"`
+
+	// Image freshness. Vulnerabilities is set only when Trivy scanning is
+	// enabled and the image has been scanned.
+	ImageCreated    string                `json:"imageCreated,omitempty"`
+	ImageAgeDays    int                   `json:"imageAgeDays"`
+	ImageLatestTag  bool                  `json:"imageLatestTag"`
+	Vulnerabilities *VulnerabilitySummary `json:"vulnerabilities,omitempty"`
+
+	// Disk footprint, refreshed every diskUsageInterval; nil until the
+	// first measurement. See container_disk.go.
+	Disk *ContainerDisk `json:"disk,omitempty"`
+}
+
+// DockerCapabilities reports which container actions the Docker endpoint
+// permits. A docker-socket-proxy typically allows GET but rejects POST
+// verbs with 403, in which case the agent runs stats-only.
+type DockerCapabilities struct {
+	Host    string          `json:"host"`
+	Probed  bool            `json:"probed"`
+	Actions map[string]bool `json:"actions"` // "start", "stop", "restart" → permitted
+}
+
+// ReadOnly is true when no container action is permitted.
+func (c DockerCapabilities) ReadOnly() bool {
+	for _, ok := range c.Actions {
+		if ok {
+			return false
+		}
+	}
+	return c.Probed
+}
+
+// Unavailable returns the actions the endpoint rejects, sorted.
+func (c DockerCapabilities) Unavailable() []string {
+	var blocked []string
+	for _, action := range containerActions {
+		if ok, probed := c.Actions[action]; probed && !ok {
+			blocked = append(blocked, action)
+		}
+	}
+	return blocked
 }
 
+// DockerStatus tells clients whether the agent can talk to Docker, so an
+// empty container list can be told apart from an unreachable daemon.
+type DockerStatus struct {
+	Available bool      `json:"available"`
+	Reason    string    `json:"reason,omitempty"` // not_installed, permission_denied, daemon_unreachable, disabled, error
+	Error     string    `json:"error,omitempty"`
+	Host      string    `json:"host"`
+	Runtime   string    `json:"runtime,omitempty"` // docker or podman, once the endpoint has answered
+	CheckedAt time.Time `json:"checkedAt"`
+}
+
+// containerActions are the mutating verbs exposed by the API.
+var containerActions = []string{"start", "stop", "restart"}
+
+// capabilityProbeInterval controls how often action permissions are re-probed
+// so proxy config changes are picked up without an agent restart.
+const capabilityProbeInterval = 5 * time.Minute
+
+const dockerRefreshInterval = 5 * time.Second
+
+// A container restarted by the daemon flapThreshold times within flapWindow
+// is flagged as flapping. Between refreshes a crash-looping container is
+// usually "running", so the restart count is the reliable signal.
+const (
+	flapWindow    = 10 * time.Minute
+	flapThreshold = 3
+)
+
 type DockerCollector struct {
-	socketPath string
+	host       string
 	mu         sync.RWMutex
 	cached     []ContainerStats
+	caps       DockerCapabilities
+	capsProbed time.Time
+	status     DockerStatus
+	runtime    string    // "docker" or "podman", once the endpoint answered
+	refreshed  time.Time // last successful refresh
+	disabled   bool      // switched off in config, see Disable
 	stopCh     chan struct{}
 
+	// Restart-loop tracking, keyed by short container ID
+	restartCounts map[string]int
+	restartTimes  map[string][]time.Time
+
+	// Image metadata and optional Trivy scanning, see images.go
+	images       map[string]imageInfo // image ID → info
+	vulns        map[string]imageScan // image ref → last scan
+	trivyServer  string
+	scanInterval time.Duration
+	scanning     bool
+
+	// Disk usage per container, see container_disk.go
+	disk         map[string]ContainerDisk // short container ID → usage
+	mounts       map[string][]string      // container name → host paths of bind mounts and volumes
+	diskMeasured time.Time
+	diskRunning  bool
+
+	// Container labels, for token policies
+	labels map[string]map[string]string // short container ID → labels
+
+	// Container lifecycle events, see docker_events.go
+	eventLog dockerEventLog
+
 	// SSE broadcast
-	Broadcast *Broadcaster[[]ContainerStats]
+	Broadcast       *Broadcaster[[]ContainerStats]
+	StatusBroadcast *Broadcaster[DockerStatus] // sent when availability changes
+	EventBroadcast  *Broadcaster[DockerEvent]  // one per container event
+}
+
+// DockerHostURL normalizes a socket path or URL into a Docker host URL.
+func DockerHostURL(host string) string {
+	if host == "" {
+		return "unix:///var/run/docker.sock"
+	}
+	if strings.Contains(host, "://") {
+		return host
+	}
+	return "unix://" + host
 }
 
-func NewDockerCollector(socketPath string) *DockerCollector {
+// NewDockerCollector creates a collector for the Docker endpoint at host
+// (socket path or URL, see NewDockerClient).
+func NewDockerCollector(host string) *DockerCollector {
 	return &DockerCollector{
-		socketPath: socketPath,
-		cached:     []ContainerStats{},
-		stopCh:     make(chan struct{}),
-		Broadcast:  NewBroadcaster[[]ContainerStats](),
+		host:      host,
+		cached:    []ContainerStats{},
+		caps:      DockerCapabilities{Host: DockerHostURL(host), Actions: map[string]bool{}},
+		status:    DockerStatus{Host: DockerHostURL(host)},
+		stopCh:    make(chan struct{}),
+		Broadcast: NewBroadcaster[[]ContainerStats](),
+
+		restartCounts: make(map[string]int),
+		restartTimes:  make(map[string][]time.Time),
+		images:        make(map[string]imageInfo),
+		vulns:         make(map[string]imageScan),
+		disk:          make(map[string]ContainerDisk),
+		mounts:        make(map[string][]string),
+		labels:        make(map[string]map[string]string),
+
+		StatusBroadcast: NewBroadcaster[DockerStatus](),
+		EventBroadcast:  NewBroadcaster[DockerEvent](),
 	}
 }
 
+// errDockerOff is the status error of a collector switched off with Disable.
+var errDockerOff = errors.New("Docker collector disabled in config")
+
+// Disable switches the collector off for hosts without Docker: Start only
+// records Docker as unavailable with reason "disabled" and never connects.
+// Call before Start.
+func (dc *DockerCollector) Disable() {
+	dc.disabled = true
+}
+
 // Start begins background collection on a 5-second ticker.
 func (dc *DockerCollector) Start() {
+	if dc.disabled {
+		dc.setStatus(errDockerOff)
+		return
+	}
+
 	// Run initial collection immediately
 	dc.refresh()
+	go dc.watchEvents()
 
 	go func() {
-		ticker := time.NewTicker(5 * time.Second)
+		ticker := time.NewTicker(dockerRefreshInterval)
 		defer ticker.Stop()
 
 		for {
@@ -94,144 +241,138 @@ func (dc *DockerCollector) Collect() []ContainerStats {
 	return result
 }
 
-// refresh fetches live Docker stats and updates the cache.
-func (dc *DockerCollector) refresh() {
-	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
-	defer cancel()
+// SampleInfo reports when the container list was last refreshed. While
+// Docker is unreachable the cached list ages and the error is reported.
+func (dc *DockerCollector) SampleInfo() SampleInfo {
+	dc.mu.RLock()
+	defer dc.mu.RUnlock()
+	return NewSampleInfo(dc.refreshed, dockerRefreshInterval, dc.status.Error)
+}
 
-	cli, err := client.NewClientWithOpts(
-		client.WithHost("unix://"+dc.socketPath),
-		client.WithAPIVersionNegotiation(),
-	)
-	if err != nil {
-		return
-	}
-	defer cli.Close()
+// Status returns whether the last refresh could reach Docker.
+func (dc *DockerCollector) Status() DockerStatus {
+	dc.mu.RLock()
+	defer dc.mu.RUnlock()
+	return dc.status
+}
 
-	containers, err := cli.ContainerList(ctx, container.ListOptions{All: true})
-	if err != nil {
-		return
+// setStatus records the outcome of a refresh, logging and broadcasting
+// only on transitions so a missing socket doesn't spam every 5s.
+func (dc *DockerCollector) setStatus(err error) {
+	status := DockerStatus{
+		Available: err == nil,
+		Host:      DockerHostURL(dc.host),
+		CheckedAt: time.Now(),
 	}
-
-	results := make([]ContainerStats, len(containers))
-
-	var wg sync.WaitGroup
-	for i, c := range containers {
-		results[i] = ContainerStats{
-			ID:           c.ID[:12],
-			Name:         cleanContainerName(c.Names),
-			Image:        c.Image,
-			Status:       normalizeStatus(c.State),
-			Ports:        []PortMapping{},
-			HealthStatus: "none",
-		}
-
-		wg.Add(1)
-		go func(idx int, ctr container.Summary) {
-			defer wg.Done()
-
-			perCtx, perCancel := context.WithTimeout(ctx, 6*time.Second)
-			defer perCancel()
-
-			if ctr.State == "running" {
-				dc.fillRunningStats(perCtx, cli, ctr.ID, &results[idx])
-			}
-
-			info, inspectErr := cli.ContainerInspect(perCtx, ctr.ID)
-			if inspectErr == nil {
-				if info.State != nil {
-					results[idx].StartedAt = info.State.StartedAt
-					if info.State.Health != nil {
-						results[idx].HealthStatus = info.State.Health.Status
-					}
-				}
-				results[idx].RestartCount = info.RestartCount
-				if info.NetworkSettings != nil {
-					results[idx].Ports = extractPorts(info.NetworkSettings.Ports)
-				}
-			}
-		}(i, c)
+	switch {
+	case err == errDockerOff:
+		status.Reason, status.Error = "disabled", err.Error()
+	case err != nil:
+		status.Reason, status.Error = dc.classifyError(err)
 	}
-	wg.Wait()
 
 	dc.mu.Lock()
-	dc.cached = results
+	prev := dc.status
+	status.Runtime = dc.runtime
+	dc.status = status
 	dc.mu.Unlock()
 
-	// Broadcast to SSE subscribers
-	broadcast := make([]ContainerStats, len(results))
-	copy(broadcast, results)
-	dc.Broadcast.Send(broadcast)
-}
-
-func (dc *DockerCollector) fillRunningStats(ctx context.Context, cli *client.Client, containerID string, cs *ContainerStats) {
-	statsResp, err := cli.ContainerStats(ctx, containerID, false)
-	if err != nil {
+	if prev.Available == status.Available && prev.Reason == status.Reason && !prev.CheckedAt.IsZero() {
 		return
 	}
-	defer statsResp.Body.Close()
-
-	var stats container.StatsResponse
-	data, err := io.ReadAll(statsResp.Body)
-	if err != nil {
-		return
-	}
-	if err := json.Unmarshal(data, &stats); err != nil {
-		return
+	if status.Available {
+		log.Printf("docker: connected to %s", status.Host)
+	} else {
+		log.Printf("docker: unavailable (%s): %s", status.Reason, status.Error)
 	}
+	dc.StatusBroadcast.Send(status)
+}
 
-	// CPU percent using PreCPUStats (previous sample provided by Docker)
-	cs.CPUPercent = calculateCPUPercent(&stats)
+// Capabilities returns the last probed container action permissions.
+func (dc *DockerCollector) Capabilities() DockerCapabilities {
+	dc.mu.RLock()
+	defer dc.mu.RUnlock()
 
-	// Memory
-	cs.MemoryUsageMB = math.Round(float64(stats.MemoryStats.Usage)/1024/1024*100) / 100
-	if stats.MemoryStats.Limit > 0 && stats.MemoryStats.Limit < 1<<62 {
-		cs.MemoryLimitMB = math.Round(float64(stats.MemoryStats.Limit)/1024/1024*100) / 100
+	actions := make(map[string]bool, len(dc.caps.Actions))
+	for k, v := range dc.caps.Actions {
+		actions[k] = v
 	}
+	caps := dc.caps
+	caps.Actions = actions
+	return caps
+}
 
-	// Network - sum across all interfaces
-	for _, netStats := range stats.Networks {
-		cs.NetworkRxBytes += netStats.RxBytes
-		cs.NetworkTxBytes += netStats.TxBytes
+// ContainerLabels finds a container by name, ID or ID prefix as of the last
+// refresh and returns its name and labels.
+func (dc *DockerCollector) ContainerLabels(id string) (name string, labels map[string]string, ok bool) {
+	if id == "" {
+		return "", nil, false
 	}
-
-	// Block I/O
-	for _, bioEntry := range stats.BlkioStats.IoServiceBytesRecursive {
-		switch bioEntry.Op {
-		case "read", "Read":
-			cs.BlockReadBytes += bioEntry.Value
-		case "write", "Write":
-			cs.BlockWriteBytes += bioEntry.Value
+	dc.mu.RLock()
+	defer dc.mu.RUnlock()
+	for _, c := range dc.cached {
+		if c.Name == strings.TrimPrefix(id, "/") || strings.HasPrefix(c.ID, id) || strings.HasPrefix(id, c.ID) {
+			return c.Name, maps.Clone(dc.labels[c.ID]), true
 		}
 	}
-
-	// PIDs
-	cs.PIDs = stats.PidsStats.Current
+	return "", nil, false
 }
 
-func calculateCPUPercent(stats *container.StatsResponse) float64 {
-	curContainer := stats.CPUStats.CPUUsage.TotalUsage
-	prevContainer := stats.PreCPUStats.CPUUsage.TotalUsage
-	curSystem := stats.CPUStats.SystemUsage
-	prevSystem := stats.PreCPUStats.SystemUsage
-
-	numCores := len(stats.CPUStats.CPUUsage.PercpuUsage)
-	if numCores == 0 {
-		numCores = int(stats.CPUStats.OnlineCPUs)
-	}
-	if numCores == 0 {
-		numCores = 1
+// MarkActionBlocked records that the endpoint rejected action, e.g. after a
+// proxy config change since the last probe.
+func (dc *DockerCollector) MarkActionBlocked(action string) {
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+	if dc.caps.Actions[action] {
+		log.Printf("docker: %s now rejected by %s", action, dc.caps.Host)
 	}
+	dc.caps.Actions[action] = false
+	dc.caps.Probed = true
+}
 
-	containerDelta := float64(curContainer - prevContainer)
-	systemDelta := float64(curSystem - prevSystem)
+// trackRestarts records restart count increases and fills RecentRestarts
+// and Flapping. Caller holds dc.mu.
+func (dc *DockerCollector) trackRestarts(results []ContainerStats) {
+	now := time.Now()
+	seen := make(map[string]bool, len(results))
+
+	for i := range results {
+		cs := &results[i]
+		seen[cs.ID] = true
+
+		prev, known := dc.restartCounts[cs.ID]
+		dc.restartCounts[cs.ID] = cs.RestartCount
+		restarted := known && cs.RestartCount > prev
+		if restarted {
+			for n := 0; n < cs.RestartCount-prev; n++ {
+				dc.restartTimes[cs.ID] = append(dc.restartTimes[cs.ID], now)
+			}
+		}
+
+		times := dc.restartTimes[cs.ID]
+		cutoff := now.Add(-flapWindow)
+		kept := times[:0]
+		for _, t := range times {
+			if t.After(cutoff) {
+				kept = append(kept, t)
+			}
+		}
+		dc.restartTimes[cs.ID] = kept
 
-	if systemDelta <= 0 || containerDelta <= 0 {
-		return 0
+		cs.RecentRestarts = len(kept)
+		cs.Flapping = len(kept) >= flapThreshold
+		if cs.Flapping && restarted {
+			log.Printf("docker: %s is restarting repeatedly (%d restarts in %s)", cs.Name, len(kept), flapWindow)
+		}
 	}
 
-	cpuPercent := (containerDelta / systemDelta) * float64(numCores) * 100.0
-	return math.Round(cpuPercent*100) / 100
+	// Forget removed containers
+	for id := range dc.restartCounts {
+		if !seen[id] {
+			delete(dc.restartCounts, id)
+			delete(dc.restartTimes, id)
+		}
+	}
 }
 
 func cleanContainerName(names []string) string {
@@ -252,26 +393,3 @@ func normalizeStatus(state string) string {
 		return "stopped"
 	}
 }
-
-func extractPorts(portMap nat.PortMap) []PortMapping {
-	var ports []PortMapping
-	for containerPort, bindings := range portMap {
-		cPort := containerPort.Int()
-		proto := containerPort.Proto()
-		for _, binding := range bindings {
-			hPort, err := strconv.Atoi(binding.HostPort)
-			if err != nil {
-				continue
-			}
-			ports = append(ports, PortMapping{
-				HostPort:      hPort,
-				ContainerPort: cPort,
-				Protocol:      proto,
-			})
-		}
-	}
-	if ports == nil {
-		return []PortMapping{}
-	}
-	return ports
-}
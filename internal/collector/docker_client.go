@@ -0,0 +1,577 @@
+//go:build !nodocker
+
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	cerrdefs "github.com/containerd/errdefs"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/client"
+	"github.com/docker/go-connections/nat"
+)
+
+// Docker API access for DockerCollector. Builds with the nodocker tag
+// replace this file with docker_disabled.go and drop the Docker client.
+
+// NewDockerClient creates a Docker API client for host, which is either a
+// unix socket path ("/var/run/docker.sock") or a URL such as
+// "tcp://socket-proxy:2375" for docker-socket-proxy setups.
+func NewDockerClient(host string) (*client.Client, error) {
+	return client.NewClientWithOpts(
+		client.WithHost(DockerHostURL(host)),
+		client.WithAPIVersionNegotiation(),
+	)
+}
+
+// classifyError maps a connection error to a reason code and a message a
+// user can act on.
+func (dc *DockerCollector) classifyError(err error) (string, string) {
+	hostURL := DockerHostURL(dc.host)
+	if path, ok := strings.CutPrefix(hostURL, "unix://"); ok {
+		if _, statErr := os.Stat(path); os.IsNotExist(statErr) {
+			return "not_installed", "Docker socket " + path + " not found"
+		}
+	}
+	if errors.Is(err, os.ErrPermission) || strings.Contains(err.Error(), "permission denied") {
+		return "permission_denied", "permission denied on " + hostURL + " (is the agent in the docker group?)"
+	}
+	if client.IsErrConnectionFailed(err) {
+		return "daemon_unreachable", "cannot connect to Docker daemon at " + hostURL
+	}
+	return "error", err.Error()
+}
+
+// detectRuntime tells Podman's Docker-compatible API apart from Docker by
+// the engine component it reports.
+func (dc *DockerCollector) detectRuntime(ctx context.Context, cli *client.Client) {
+	v, err := cli.ServerVersion(ctx)
+	if err != nil {
+		return
+	}
+	runtime := "docker"
+	if strings.Contains(v.Platform.Name, "Podman") {
+		runtime = "podman"
+	}
+	for _, c := range v.Components {
+		if strings.Contains(c.Name, "Podman") {
+			runtime = "podman"
+		}
+	}
+
+	dc.mu.Lock()
+	changed := dc.runtime != runtime
+	dc.runtime = runtime
+	dc.status.Runtime = runtime
+	dc.mu.Unlock()
+	if changed && runtime == "podman" {
+		log.Printf("docker: %s is Podman %s", DockerHostURL(dc.host), v.Version)
+	}
+}
+
+// probeCapabilities checks which mutating verbs the endpoint permits by
+// issuing each action against a container ID that cannot exist. The daemon
+// answers 404 when the verb is allowed; a socket proxy answers 403.
+func (dc *DockerCollector) probeCapabilities(ctx context.Context, cli *client.Client) {
+	const probeID = "deskmon-capability-probe"
+	timeout := 0
+
+	actions := make(map[string]bool, len(containerActions))
+	for _, action := range containerActions {
+		var err error
+		switch action {
+		case "start":
+			err = cli.ContainerStart(ctx, probeID, container.StartOptions{})
+		case "stop":
+			err = cli.ContainerStop(ctx, probeID, container.StopOptions{Timeout: &timeout})
+		case "restart":
+			err = cli.ContainerRestart(ctx, probeID, container.StopOptions{Timeout: &timeout})
+		}
+		if err != nil && !cerrdefs.IsNotFound(err) && !cerrdefs.IsPermissionDenied(err) {
+			// Connection or daemon failure: leave the previous result in place.
+			return
+		}
+		actions[action] = cerrdefs.IsNotFound(err)
+	}
+
+	dc.mu.Lock()
+	changed := !dc.caps.Probed
+	for action, ok := range actions {
+		if dc.caps.Actions[action] != ok {
+			changed = true
+		}
+	}
+	dc.caps.Actions = actions
+	dc.caps.Probed = true
+	dc.capsProbed = time.Now()
+	caps := dc.caps
+	dc.mu.Unlock()
+
+	if changed {
+		if blocked := caps.Unavailable(); len(blocked) > 0 {
+			log.Printf("docker: %s rejects container actions %v — running stats-only for those", caps.Host, blocked)
+		} else {
+			log.Printf("docker: %s permits all container actions", caps.Host)
+		}
+	}
+}
+
+// refresh fetches live Docker stats and updates the cache.
+func (dc *DockerCollector) refresh() {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	cli, err := NewDockerClient(dc.host)
+	if err != nil {
+		dc.setStatus(err)
+		return
+	}
+	defer cli.Close()
+
+	containers, err := cli.ContainerList(ctx, container.ListOptions{All: true})
+	dc.setStatus(err)
+	if err != nil {
+		return
+	}
+
+	dc.mu.RLock()
+	needProbe := time.Since(dc.capsProbed) > capabilityProbeInterval
+	dc.mu.RUnlock()
+	if needProbe {
+		dc.detectRuntime(ctx, cli)
+		dc.probeCapabilities(ctx, cli)
+	}
+
+	results := make([]ContainerStats, len(containers))
+	mountSources := make([][]string, len(containers))
+
+	var wg sync.WaitGroup
+	for i, c := range containers {
+		results[i] = ContainerStats{
+			ID:           c.ID[:12],
+			Name:         cleanContainerName(c.Names),
+			Image:        c.Image,
+			Status:       normalizeStatus(c.State),
+			Ports:        []PortMapping{},
+			HealthStatus: "none",
+		}
+
+		wg.Add(1)
+		go func(idx int, ctr container.Summary) {
+			defer wg.Done()
+
+			perCtx, perCancel := context.WithTimeout(ctx, 6*time.Second)
+			defer perCancel()
+
+			if ctr.State == "running" {
+				dc.fillRunningStats(perCtx, cli, ctr.ID, &results[idx])
+			}
+
+			applyImageInfo(&results[idx], dc.imageCreated(perCtx, cli, ctr.ImageID))
+
+			info, inspectErr := cli.ContainerInspect(perCtx, ctr.ID)
+			if inspectErr == nil {
+				if info.State != nil {
+					results[idx].StartedAt = info.State.StartedAt
+					results[idx].OOMKilled = info.State.OOMKilled
+					if info.State.Health != nil {
+						results[idx].HealthStatus = info.State.Health.Status
+					}
+				}
+				results[idx].RestartCount = info.RestartCount
+				if info.NetworkSettings != nil {
+					results[idx].Ports = extractPorts(info.NetworkSettings.Ports)
+				}
+				if info.HostConfig != nil {
+					applyLimits(&results[idx], info.HostConfig.Resources)
+				}
+				for _, m := range info.Mounts {
+					if (m.Type == mount.TypeBind || m.Type == mount.TypeVolume) && m.Source != "" {
+						mountSources[idx] = append(mountSources[idx], m.Source)
+					}
+				}
+			}
+		}(i, c)
+	}
+	wg.Wait()
+
+	refs := make([]string, len(results))
+	for i := range results {
+		refs[i] = results[i].Image
+	}
+	dc.scanImages(refs)
+	dc.measureDiskUsage()
+
+	imageIDs := make([]string, len(containers))
+	for i, c := range containers {
+		imageIDs[i] = c.ImageID
+	}
+
+	dc.mu.Lock()
+	dc.attachScans(results, imageIDs)
+	dc.applyDiskUsage(results)
+	dc.mounts = make(map[string][]string, len(results))
+	dc.labels = make(map[string]map[string]string, len(results))
+	for i, c := range containers {
+		dc.labels[results[i].ID] = c.Labels
+	}
+	for i := range results {
+		if len(mountSources[i]) > 0 {
+			dc.mounts[results[i].Name] = mountSources[i]
+		}
+	}
+	dc.trackRestarts(results)
+	dc.cached = results
+	dc.refreshed = time.Now()
+	dc.mu.Unlock()
+
+	// Broadcast to SSE subscribers
+	broadcast := make([]ContainerStats, len(results))
+	copy(broadcast, results)
+	dc.Broadcast.Send(broadcast)
+}
+
+// measureDiskUsage refreshes per-container disk usage in the background
+// once diskUsageInterval has passed since the last measurement.
+func (dc *DockerCollector) measureDiskUsage() {
+	dc.mu.Lock()
+	if dc.diskRunning || time.Since(dc.diskMeasured) < diskUsageInterval {
+		dc.mu.Unlock()
+		return
+	}
+	dc.diskRunning = true
+	dc.mu.Unlock()
+
+	go func() {
+		usage, err := dc.readDiskUsage()
+		dc.mu.Lock()
+		defer dc.mu.Unlock()
+		dc.diskRunning = false
+		dc.diskMeasured = time.Now() // on failure too: retry after the interval
+		if err != nil {
+			log.Printf("docker: measuring disk usage failed: %v", err)
+			return
+		}
+		dc.disk = usage
+	}()
+}
+
+// readDiskUsage asks the daemon for container and volume sizes and pairs
+// each container with the named volumes it mounts.
+func (dc *DockerCollector) readDiskUsage() (map[string]ContainerDisk, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	cli, err := NewDockerClient(dc.host)
+	if err != nil {
+		return nil, err
+	}
+	defer cli.Close()
+
+	du, err := cli.DiskUsage(ctx, types.DiskUsageOptions{
+		Types: []types.DiskUsageObject{types.ContainerObject, types.VolumeObject},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	volumeSizes := make(map[string]int64, len(du.Volumes))
+	for _, v := range du.Volumes {
+		size := int64(-1)
+		if v.UsageData != nil {
+			size = v.UsageData.Size
+		}
+		volumeSizes[v.Name] = size
+	}
+	volumeUsers := make(map[string]int)
+	for _, c := range du.Containers {
+		for _, m := range c.Mounts {
+			if m.Type == mount.TypeVolume {
+				volumeUsers[m.Name]++
+			}
+		}
+	}
+
+	now := time.Now()
+	usage := make(map[string]ContainerDisk, len(du.Containers))
+	for _, c := range du.Containers {
+		d := ContainerDisk{
+			WritableBytes: c.SizeRw,
+			RootFsBytes:   c.SizeRootFs,
+			Volumes:       []VolumeUsage{},
+			MeasuredAt:    now,
+		}
+		for _, m := range c.Mounts {
+			if m.Type != mount.TypeVolume {
+				continue
+			}
+			size, ok := volumeSizes[m.Name]
+			if !ok {
+				size = -1
+			}
+			if size > 0 {
+				d.VolumesBytes += size
+			}
+			d.Volumes = append(d.Volumes, VolumeUsage{
+				Name:        m.Name,
+				Destination: m.Destination,
+				SizeBytes:   size,
+				Containers:  volumeUsers[m.Name],
+			})
+		}
+		usage[c.ID[:12]] = d
+	}
+	return usage, nil
+}
+
+// imageCreated returns the creation time for imageID, inspecting it once.
+func (dc *DockerCollector) imageCreated(ctx context.Context, cli *client.Client, imageID string) time.Time {
+	dc.mu.RLock()
+	info, ok := dc.images[imageID]
+	dc.mu.RUnlock()
+	if ok {
+		return info.created
+	}
+
+	img, err := cli.ImageInspect(ctx, imageID)
+	if err != nil {
+		return time.Time{}
+	}
+	created, _ := time.Parse(time.RFC3339Nano, img.Created)
+
+	dc.mu.Lock()
+	dc.images[imageID] = imageInfo{created: created}
+	dc.mu.Unlock()
+	return created
+}
+
+func (dc *DockerCollector) fillRunningStats(ctx context.Context, cli *client.Client, containerID string, cs *ContainerStats) {
+	statsResp, err := cli.ContainerStats(ctx, containerID, false)
+	if err != nil {
+		return
+	}
+	defer statsResp.Body.Close()
+
+	var stats container.StatsResponse
+	data, err := io.ReadAll(statsResp.Body)
+	if err != nil {
+		return
+	}
+	if err := json.Unmarshal(data, &stats); err != nil {
+		return
+	}
+
+	// CPU percent using PreCPUStats (previous sample provided by Docker)
+	cs.CPUPercent = calculateCPUPercent(&stats)
+
+	// Memory
+	cs.MemoryUsageMB = math.Round(float64(stats.MemoryStats.Usage)/1024/1024*100) / 100
+	if stats.MemoryStats.Limit > 0 && stats.MemoryStats.Limit < 1<<62 {
+		cs.MemoryLimitMB = math.Round(float64(stats.MemoryStats.Limit)/1024/1024*100) / 100
+	}
+
+	// Network - sum across all interfaces
+	for _, netStats := range stats.Networks {
+		cs.NetworkRxBytes += netStats.RxBytes
+		cs.NetworkTxBytes += netStats.TxBytes
+	}
+
+	// Block I/O
+	for _, bioEntry := range stats.BlkioStats.IoServiceBytesRecursive {
+		switch bioEntry.Op {
+		case "read", "Read":
+			cs.BlockReadBytes += bioEntry.Value
+		case "write", "Write":
+			cs.BlockWriteBytes += bioEntry.Value
+		}
+	}
+
+	// PIDs
+	cs.PIDs = stats.PidsStats.Current
+}
+
+// applyLimits fills the configured CPU/memory limits and usage relative to
+// them, so a container near its own cap is visible before the OOM killer
+// or CFS throttling kicks in.
+func applyLimits(cs *ContainerStats, res container.Resources) {
+	switch {
+	case res.NanoCPUs > 0:
+		cs.CPULimitCores = float64(res.NanoCPUs) / 1e9
+	case res.CPUQuota > 0 && res.CPUPeriod > 0:
+		cs.CPULimitCores = float64(res.CPUQuota) / float64(res.CPUPeriod)
+	}
+	cs.CPULimitCores = math.Round(cs.CPULimitCores*100) / 100
+	cs.CPUShares = res.CPUShares
+
+	if cs.CPULimitCores > 0 {
+		// cpuPercent is 100 per fully used core
+		cs.CPUPercentOfLimit = math.Round(cs.CPUPercent/cs.CPULimitCores*100) / 100
+	}
+
+	if res.Memory > 0 {
+		cs.MemoryHardLimitMB = math.Round(float64(res.Memory)/1024/1024*100) / 100
+		cs.MemoryPercentOfLimit = math.Round(cs.MemoryUsageMB/cs.MemoryHardLimitMB*10000) / 100
+	}
+}
+
+func calculateCPUPercent(stats *container.StatsResponse) float64 {
+	curContainer := stats.CPUStats.CPUUsage.TotalUsage
+	prevContainer := stats.PreCPUStats.CPUUsage.TotalUsage
+	curSystem := stats.CPUStats.SystemUsage
+	prevSystem := stats.PreCPUStats.SystemUsage
+
+	numCores := len(stats.CPUStats.CPUUsage.PercpuUsage)
+	if numCores == 0 {
+		numCores = int(stats.CPUStats.OnlineCPUs)
+	}
+	if numCores == 0 {
+		numCores = 1
+	}
+
+	containerDelta := float64(curContainer - prevContainer)
+	systemDelta := float64(curSystem - prevSystem)
+
+	if systemDelta <= 0 || containerDelta <= 0 {
+		return 0
+	}
+
+	cpuPercent := (containerDelta / systemDelta) * float64(numCores) * 100.0
+	return math.Round(cpuPercent*100) / 100
+}
+
+func extractPorts(portMap nat.PortMap) []PortMapping {
+	var ports []PortMapping
+	for containerPort, bindings := range portMap {
+		cPort := containerPort.Int()
+		proto := containerPort.Proto()
+		for _, binding := range bindings {
+			hPort, err := strconv.Atoi(binding.HostPort)
+			if err != nil {
+				continue
+			}
+			ports = append(ports, PortMapping{
+				HostPort:      hPort,
+				ContainerPort: cPort,
+				Protocol:      proto,
+			})
+		}
+	}
+	if ports == nil {
+		return []PortMapping{}
+	}
+	return ports
+}
+
+// Reconnect delays for the events stream while Docker is unreachable.
+const (
+	eventsRetryMin = 5 * time.Second
+	eventsRetryMax = time.Minute
+)
+
+// watchEvents follows the Docker events API until Stop, reconnecting with
+// backoff. After a reconnect it asks for events since the last one seen, so
+// a daemon restart doesn't lose the containers it stopped and started.
+func (dc *DockerCollector) watchEvents() {
+	var last int64 // TimeNano of the last event recorded
+	retry := eventsRetryMin
+	for {
+		if dc.followEvents(&last) {
+			retry = eventsRetryMin
+		}
+		select {
+		case <-dc.stopCh:
+			return
+		case <-time.After(retry):
+		}
+		retry = min(retry*2, eventsRetryMax)
+	}
+}
+
+// followEvents streams events until the connection ends and reports
+// whether any arrived.
+func (dc *DockerCollector) followEvents(last *int64) bool {
+	cli, err := NewDockerClient(dc.host)
+	if err != nil {
+		return false
+	}
+	defer cli.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-dc.stopCh:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	args := filters.NewArgs(filters.Arg("type", string(events.ContainerEventType)))
+	for _, action := range DockerEventActions {
+		args.Add("event", action)
+	}
+	opts := events.ListOptions{Filters: args}
+	if *last > 0 {
+		opts.Since = fmt.Sprintf("%d.%09d", *last/1e9, *last%1e9)
+	}
+
+	msgs, errs := cli.Events(ctx, opts)
+	received := false
+	for {
+		select {
+		case msg := <-msgs:
+			if msg.TimeNano <= *last {
+				continue // replayed by Since
+			}
+			*last = msg.TimeNano
+			received = true
+			dc.recordEvent(dockerEvent(msg))
+		case err := <-errs:
+			// Losing Docker altogether is logged by setStatus.
+			if err != nil && ctx.Err() == nil && !errors.Is(err, io.EOF) && dc.Status().Available {
+				log.Printf("docker: events stream ended: %v", err)
+			}
+			return received
+		}
+	}
+}
+
+// dockerEvent converts an events API message. Health changes arrive as
+// "health_status: healthy".
+func dockerEvent(msg events.Message) DockerEvent {
+	attrs := msg.Actor.Attributes
+	ev := DockerEvent{
+		Time:   time.Unix(0, msg.TimeNano),
+		Action: string(msg.Action),
+		ID:     msg.Actor.ID,
+		Name:   attrs["name"],
+		Image:  attrs["image"],
+	}
+	if len(ev.ID) > 12 {
+		ev.ID = ev.ID[:12]
+	}
+	if action, health, ok := strings.Cut(ev.Action, ":"); ok {
+		ev.Action, ev.Health = action, strings.TrimSpace(health)
+	}
+	if ev.Action == "die" {
+		if code, err := strconv.Atoi(attrs["exitCode"]); err == nil {
+			ev.ExitCode = &code
+		}
+	}
+	return ev
+}
@@ -0,0 +1,105 @@
+//go:build !nodocker
+
+package collector
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/neur0map/deskmon-agent/internal/fakehost"
+)
+
+func TestDockerCollectorRefresh(t *testing.T) {
+	d := fakehost.NewDocker(fakehost.DockerOptions{Denied: []string{"stop"}},
+		fakehost.Container{
+			Name:         "web",
+			Image:        "nginx:1.27",
+			Health:       "healthy",
+			Ports:        map[int]int{8080: 80},
+			Labels:       map[string]string{"com.docker.compose.project": "site"},
+			RestartCount: 1,
+			CPUPercent:   50,
+			MemoryBytes:  256 << 20,
+			MemoryLimit:  512 << 20,
+		},
+		fakehost.Container{Name: "backup", Image: "restic/restic:latest", State: "exited"},
+	)
+	defer d.Close()
+
+	dc := NewDockerCollector(d.Host)
+	dc.refresh()
+
+	if st := dc.Status(); !st.Available || st.Runtime != "docker" {
+		t.Fatalf("Status() = %+v, want available docker", st)
+	}
+	containers := dc.Collect()
+	if len(containers) != 2 {
+		t.Fatalf("Collect() = %+v, want web and backup", containers)
+	}
+	web, backup := containers[0], containers[1]
+	if web.Name != "web" || web.Status != "running" || web.HealthStatus != "healthy" || web.RestartCount != 1 {
+		t.Errorf("web = %+v, want running and healthy with 1 restart", web)
+	}
+	if web.CPUPercent != 50 || web.MemoryUsageMB != 256 || web.MemoryHardLimitMB != 512 || web.MemoryPercentOfLimit != 50 {
+		t.Errorf("web uses %.2f%% CPU and %.0f of %.0f MB (%.0f%%), want 50%% and 256 of 512 MB",
+			web.CPUPercent, web.MemoryUsageMB, web.MemoryHardLimitMB, web.MemoryPercentOfLimit)
+	}
+	if !slices.Equal(web.Ports, []PortMapping{{HostPort: 8080, ContainerPort: 80, Protocol: "tcp"}}) {
+		t.Errorf("web ports = %+v, want 8080→80/tcp", web.Ports)
+	}
+	if backup.Name != "backup" || backup.Status != "stopped" || backup.CPUPercent != 0 {
+		t.Errorf("backup = %+v, want stopped without stats", backup)
+	}
+	if name, labels, ok := dc.ContainerLabels(web.ID); !ok || name != "web" || labels["com.docker.compose.project"] != "site" {
+		t.Errorf("ContainerLabels(%s) = %q, %v, %v", web.ID, name, labels, ok)
+	}
+
+	caps := dc.Capabilities()
+	if !caps.Probed || !slices.Equal(caps.Unavailable(), []string{"stop"}) {
+		t.Errorf("Capabilities() = %+v, want only stop rejected", caps)
+	}
+	if actions := d.Actions(); len(actions) != 0 {
+		t.Errorf("probing performed %v on real containers", actions)
+	}
+
+	// Disk usage is measured in the background and shows from the next
+	// refresh.
+	waitDiskUsage(t, dc)
+	dc.refresh()
+	if web := dc.Collect()[0]; web.Disk == nil || web.Disk.WritableBytes != 4<<20 || web.Disk.RootFsBytes != 120<<20 {
+		t.Errorf("web disk = %+v, want 4 MiB written, 120 MiB in all", web.Disk)
+	}
+}
+
+func waitDiskUsage(t *testing.T, dc *DockerCollector) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		dc.mu.RLock()
+		done := !dc.diskRunning && !dc.diskMeasured.IsZero()
+		dc.mu.RUnlock()
+		if done {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("disk usage not measured after 5s")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestDockerCollectorDetectsPodman(t *testing.T) {
+	d := fakehost.NewDocker(fakehost.DockerOptions{Podman: true}, fakehost.Container{Name: "db", Image: "docker.io/library/postgres:16"})
+	defer d.Close()
+
+	dc := NewDockerCollector(d.Host)
+	dc.refresh()
+	waitDiskUsage(t, dc)
+	if st := dc.Status(); !st.Available || st.Runtime != "podman" {
+		t.Errorf("Status() = %+v, want available podman", st)
+	}
+	if caps := dc.Capabilities(); caps.ReadOnly() || len(caps.Unavailable()) != 0 {
+		t.Errorf("Capabilities() = %+v, want every action permitted", caps)
+	}
+}
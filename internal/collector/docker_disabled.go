@@ -0,0 +1,20 @@
+//go:build nodocker
+
+package collector
+
+import "errors"
+
+// Builds with the nodocker tag (the embedded profile) have no Docker client:
+// the collector reports Docker as disabled and never lists containers.
+
+var errDockerDisabled = errors.New("agent built without Docker support")
+
+func (dc *DockerCollector) refresh() {
+	dc.setStatus(errDockerDisabled)
+}
+
+func (dc *DockerCollector) classifyError(err error) (string, string) {
+	return "disabled", err.Error()
+}
+
+func (dc *DockerCollector) watchEvents() {}
@@ -0,0 +1,65 @@
+package collector
+
+import (
+	"sync"
+	"time"
+)
+
+// Container lifecycle events from the Docker events API. The collector's
+// 5s refresh only sees the state a container ended up in; the events API
+// also reports a crash that was restarted in between, an OOM kill, or a
+// health check flipping back and forth.
+
+// dockerEventCapacity is how many events DockerEvents keeps.
+const dockerEventCapacity = 200
+
+// DockerEventActions are the container actions the collector subscribes to.
+var DockerEventActions = []string{"start", "die", "oom", "health_status"}
+
+// DockerEvent is one container lifecycle event.
+type DockerEvent struct {
+	Time     time.Time `json:"time"`
+	Action   string    `json:"action"` // start, die, oom or health_status
+	ID       string    `json:"id"`     // short container ID
+	Name     string    `json:"name"`
+	Image    string    `json:"image,omitempty"`
+	ExitCode *int      `json:"exitCode,omitempty"` // die only
+	Health   string    `json:"health,omitempty"`   // health_status only: healthy, unhealthy or starting
+}
+
+// dockerEventLog is the ring buffer behind DockerEvents.
+type dockerEventLog struct {
+	mu     sync.Mutex
+	events []DockerEvent
+	next   int // index to overwrite once full
+}
+
+func (l *dockerEventLog) add(ev DockerEvent) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.events) < dockerEventCapacity {
+		l.events = append(l.events, ev)
+		return
+	}
+	l.events[l.next] = ev
+	l.next = (l.next + 1) % dockerEventCapacity
+}
+
+func (l *dockerEventLog) list() []DockerEvent {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	out := make([]DockerEvent, 0, len(l.events))
+	out = append(out, l.events[l.next:]...)
+	return append(out, l.events[:l.next]...)
+}
+
+// DockerEvents returns the most recent container events, oldest first.
+func (dc *DockerCollector) DockerEvents() []DockerEvent {
+	return dc.eventLog.list()
+}
+
+// recordEvent stores and broadcasts a container event.
+func (dc *DockerCollector) recordEvent(ev DockerEvent) {
+	dc.eventLog.add(ev)
+	dc.EventBroadcast.Send(ev)
+}
@@ -0,0 +1,77 @@
+package collector
+
+import (
+	"runtime"
+	"sync"
+)
+
+// Virtualization kinds, from the point of view of the host being monitored.
+const (
+	VirtNone      = "none"
+	VirtVM        = "vm"
+	VirtContainer = "container"
+	VirtWSL       = "wsl"
+)
+
+// Environment describes where the agent runs and how that affects the
+// numbers it reports. Reported by GET /info.
+type Environment struct {
+	OS             string `json:"os"`
+	Arch           string `json:"arch"`
+	Kernel         string `json:"kernel,omitempty"`
+	Virtualization string `json:"virtualization"`       // none, vm, container, wsl
+	Hypervisor     string `json:"hypervisor,omitempty"` // kvm, qemu, vmware, hyperv, xen, virtualbox, parallels, bhyve, unknown
+	Container      string `json:"container,omitempty"`  // docker, podman, lxc, systemd-nspawn, kubernetes, jail
+	LXCFS          bool   `json:"lxcfs"`
+	// TemperatureSource is where CPU temperature comes from: thermal_zone,
+	// hwmon, sysctl, smc, or "" when it is unavailable.
+	TemperatureSource string             `json:"temperatureSource,omitempty"`
+	Quirks            []EnvironmentQuirk `json:"quirks"`
+}
+
+// EnvironmentQuirk explains one way a reported value differs from what a
+// bare-metal host would show.
+type EnvironmentQuirk struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Environment) addQuirk(code, message string) {
+	e.Quirks = append(e.Quirks, EnvironmentQuirk{Code: code, Message: message})
+}
+
+// HostEnvironment returns the environment detected at first use. It does
+// not change while the agent runs.
+var HostEnvironment = sync.OnceValue(func() Environment {
+	env := Environment{
+		OS:     runtime.GOOS,
+		Arch:   runtime.GOARCH,
+		Quirks: []EnvironmentQuirk{},
+	}
+	detectEnvironment(&env)
+
+	switch {
+	case env.Container != "":
+		env.Virtualization = VirtContainer
+	case env.Virtualization == VirtWSL:
+	case env.Hypervisor != "":
+		env.Virtualization = VirtVM
+	default:
+		env.Virtualization = VirtNone
+	}
+
+	if env.Virtualization == VirtVM && env.TemperatureSource != "" {
+		env.TemperatureSource = ""
+		env.addQuirk("vm_temperature", "running in a virtual machine: thermal sensors are emulated, so temperature is reported as unavailable")
+	}
+	return env
+})
+
+// readCPUTemperature applies the environment's quirks to readTemperature:
+// a VM's emulated sensors report fixed or meaningless values.
+func readCPUTemperature() (float64, bool) {
+	if HostEnvironment().Virtualization == VirtVM {
+		return 0, false
+	}
+	return readTemperature()
+}
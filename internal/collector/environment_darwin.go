@@ -0,0 +1,16 @@
+package collector
+
+import "golang.org/x/sys/unix"
+
+func detectEnvironment(env *Environment) {
+	env.Kernel, _ = unix.Sysctl("kern.osrelease")
+	if vmm, err := unix.SysctlUint32("kern.hv_vmm_present"); err == nil && vmm == 1 {
+		env.Hypervisor = "unknown"
+	}
+
+	if _, ok := readTemperature(); ok {
+		env.TemperatureSource = "smc"
+	} else {
+		env.addQuirk("no_temperature_sensors", "no readable SMC temperature keys (or the agent was built without cgo): temperature is unavailable")
+	}
+}
@@ -0,0 +1,35 @@
+package collector
+
+import "golang.org/x/sys/unix"
+
+// vmGuests maps kern.vm_guest to hypervisor names.
+var vmGuests = map[string]string{
+	"generic":   "unknown",
+	"xen":       "xen",
+	"hv":        "hyperv",
+	"vmware":    "vmware",
+	"kvm":       "kvm",
+	"bhyve":     "bhyve",
+	"vbox":      "virtualbox",
+	"parallels": "parallels",
+	"nvmm":      "nvmm",
+}
+
+func detectEnvironment(env *Environment) {
+	env.Kernel, _ = unix.Sysctl("kern.osrelease")
+	if guest, err := unix.Sysctl("kern.vm_guest"); err == nil {
+		env.Hypervisor = vmGuests[guest]
+	}
+	if jailed, err := unix.SysctlUint32("security.jail.jailed"); err == nil && jailed == 1 {
+		env.Container = "jail"
+	}
+
+	if _, ok := readTemperature(); ok {
+		env.TemperatureSource = "sysctl"
+		if env.Container != "" {
+			env.addQuirk("host_temperature", "temperature sensors are shared with the host: the reading is the host's, not the jail's")
+		}
+	} else {
+		env.addQuirk("no_temperature_sensors", "no CPU temperature sysctls: load coretemp(4) or amdtemp(4) to enable temperature")
+	}
+}
@@ -0,0 +1,172 @@
+package collector
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/neur0map/deskmon-agent/internal/hostfs"
+)
+
+// dmiHypervisors maps DMI sys_vendor/product_name fragments to hypervisor
+// names, checked in order.
+var dmiHypervisors = []struct{ match, name string }{
+	{"kvm", "kvm"},
+	{"qemu", "qemu"},
+	{"vmware", "vmware"},
+	{"virtualbox", "virtualbox"},
+	{"innotek", "virtualbox"},
+	{"xen", "xen"},
+	{"microsoft corporation virtual machine", "hyperv"},
+	{"parallels", "parallels"},
+	{"bhyve", "bhyve"},
+	{"amazon ec2", "amazon"},
+	{"google compute engine", "google"},
+	{"digitalocean", "kvm"},
+	{"hetzner", "kvm"},
+	{"openstack", "kvm"},
+}
+
+func detectEnvironment(env *Environment) {
+	osRelease := readSysString(hostfs.Proc("sys/kernel/osrelease"))
+	env.Kernel = osRelease
+	if lower := strings.ToLower(osRelease); strings.Contains(lower, "microsoft") || strings.Contains(lower, "wsl") {
+		env.Virtualization = VirtWSL
+	} else {
+		env.Hypervisor = detectHypervisor()
+	}
+	env.Container = detectContainer()
+	env.LXCFS = lxcfsMounted()
+
+	if env.LXCFS {
+		env.addQuirk("lxcfs", "/proc is virtualized by lxcfs: memory, CPU count, CPU usage and uptime are the container's limits and usage, not the host's")
+	}
+	if env.Virtualization == VirtWSL {
+		env.addQuirk("wsl", "running under WSL: memory and uptime are the WSL virtual machine's, not Windows'")
+	}
+
+	zones, _ := filepath.Glob(hostfs.Sys("class/thermal/thermal_zone*/temp"))
+	switch {
+	case len(zones) > 0:
+		env.TemperatureSource = "thermal_zone"
+	case hwmonCPUSensors() != nil:
+		env.TemperatureSource = "hwmon"
+		env.addQuirk("hwmon_temperature", "no thermal zones: CPU temperature is read from hwmon (coretemp, k10temp or similar)")
+	default:
+		env.addQuirk("no_temperature_sensors", "no thermal zones or CPU hwmon sensors: temperature is unavailable")
+	}
+	if env.Container != "" && env.TemperatureSource != "" {
+		env.addQuirk("host_temperature", "temperature sensors are shared with the host: the reading is the host's, not the container's")
+	}
+}
+
+// detectHypervisor identifies the hypervisor from DMI, Xen and device-tree
+// data, falling back to the CPU's hypervisor flag.
+func detectHypervisor() string {
+	// Xen dom0 is the host itself, not a guest.
+	if data, err := os.ReadFile(hostfs.Proc("xen/capabilities")); err == nil && strings.Contains(string(data), "control_d") {
+		return ""
+	}
+	if readSysString(hostfs.Sys("hypervisor/type")) == "xen" {
+		return "xen"
+	}
+
+	dmiDir := hostfs.Sys("class/dmi/id")
+	dmi := strings.ToLower(readSysString(filepath.Join(dmiDir, "sys_vendor")) + " " +
+		readSysString(filepath.Join(dmiDir, "product_name")) + " " +
+		readSysString(filepath.Join(dmiDir, "bios_vendor")))
+	for _, h := range dmiHypervisors {
+		if strings.Contains(dmi, h.match) {
+			return h.name
+		}
+	}
+
+	// ARM guests without DMI describe the hypervisor in the device tree.
+	if compat := readSysString(hostfs.Sys("firmware/devicetree/base/hypervisor/compatible")); compat != "" {
+		switch {
+		case strings.Contains(compat, "xen"):
+			return "xen"
+		case strings.Contains(compat, "kvm"):
+			return "kvm"
+		}
+		return "unknown"
+	}
+
+	f, err := os.Open(hostfs.Proc("cpuinfo"))
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "flags") {
+			for _, flag := range strings.Fields(line) {
+				if flag == "hypervisor" {
+					return "unknown"
+				}
+			}
+			return ""
+		}
+	}
+	return ""
+}
+
+// detectContainer names the container runtime the monitored host runs in.
+// In Docker mode (hostfs.Containerized) the agent's own container is
+// expected, so only markers on the host side count.
+func detectContainer() string {
+	if !hostfs.Containerized() {
+		if _, err := os.Stat("/.dockerenv"); err == nil {
+			return "docker"
+		}
+		if _, err := os.Stat("/run/.containerenv"); err == nil {
+			return "podman"
+		}
+		if os.Getenv("KUBERNETES_SERVICE_HOST") != "" {
+			return "kubernetes"
+		}
+	}
+
+	// Written by systemd when it runs as PID 1 inside a container.
+	if name := readSysString(hostfs.Path("/run/systemd/container")); name != "" {
+		return name
+	}
+	if data, err := os.ReadFile(hostfs.Proc("1/environ")); err == nil {
+		for _, kv := range strings.Split(string(data), "\x00") {
+			if name, ok := strings.CutPrefix(kv, "container="); ok && name != "" {
+				return name
+			}
+		}
+	}
+	if data, err := os.ReadFile(hostfs.Proc("1/cgroup")); err == nil {
+		cgroup := string(data)
+		switch {
+		case strings.Contains(cgroup, "/kubepods"):
+			return "kubernetes"
+		case strings.Contains(cgroup, "/docker/"):
+			return "docker"
+		case strings.Contains(cgroup, "/lxc/"), strings.Contains(cgroup, "/lxc.payload"):
+			return "lxc"
+		}
+	}
+	return ""
+}
+
+// lxcfsMounted reports whether lxcfs overlays files in the agent's /proc.
+func lxcfsMounted() bool {
+	f, err := os.Open("/proc/self/mounts")
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 3 && strings.Contains(fields[2], "lxcfs") && strings.HasPrefix(fields[1], "/proc/") {
+			return true
+		}
+	}
+	return false
+}
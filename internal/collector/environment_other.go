@@ -0,0 +1,5 @@
+//go:build !linux && !freebsd && !darwin
+
+package collector
+
+func detectEnvironment(env *Environment) {}
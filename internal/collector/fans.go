@@ -0,0 +1,228 @@
+package collector
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/neur0map/deskmon-agent/internal/hostfs"
+)
+
+// Fan modes, mapped to hwmon pwmN_enable values.
+const (
+	FanModeManual = "manual" // pwmN_enable=1, duty cycle set through pwmN
+	FanModeAuto   = "auto"   // pwmN_enable=2, chip or firmware controls the fan
+	FanModeFull   = "full"   // manual at 255
+)
+
+// FanCurvePoint is one temperature → PWM point of a chip's automatic curve.
+type FanCurvePoint struct {
+	Temperature float64 `json:"temperature"` // °C
+	PWM         int     `json:"pwm"`
+}
+
+// FanInfo is one hwmon PWM output and the fan tachometer paired with it.
+type FanInfo struct {
+	ID      string          `json:"id"` // hwmonN-pwmM
+	Chip    string          `json:"chip"`
+	Label   string          `json:"label,omitempty"`
+	PWM     int             `json:"pwm"` // 0-255
+	Percent float64         `json:"percent"`
+	Mode    string          `json:"mode"` // manual, auto, full, or "unknown"
+	RPM     *int            `json:"rpm,omitempty"`
+	Curve   []FanCurvePoint `json:"curve,omitempty"`
+}
+
+var (
+	ErrFanNotFound = errors.New("fan not found")
+	fanIDPattern   = regexp.MustCompile(`^(hwmon\d+)-(pwm\d+)$`)
+)
+
+// fanSetting is a PWM output's pwmN_enable and pwmN values.
+type fanSetting struct {
+	enable, pwm int
+}
+
+// originalFans holds each PWM output's setting from before the agent first
+// changed it, keyed by pwmN path, so RestoreFans can hand control back.
+var (
+	originalFansMu sync.Mutex
+	originalFans   = make(map[string]fanSetting)
+)
+
+func hwmonRoot() string {
+	return hostfs.Sys("class/hwmon")
+}
+
+// ListFans returns every hwmon PWM output, sorted by ID.
+func ListFans() []FanInfo {
+	fans := []FanInfo{}
+	pwms, _ := filepath.Glob(filepath.Join(hwmonRoot(), "hwmon*", "pwm[0-9]*"))
+	for _, path := range pwms {
+		base := filepath.Base(path)
+		if strings.Contains(base, "_") {
+			continue // pwmN_enable, pwmN_auto_point..., not an output
+		}
+		dir := filepath.Dir(path)
+		fans = append(fans, readFan(dir, filepath.Base(dir), base))
+	}
+	sort.Slice(fans, func(i, j int) bool { return fans[i].ID < fans[j].ID })
+	return fans
+}
+
+func readFan(dir, hwmon, pwm string) FanInfo {
+	n := strings.TrimPrefix(pwm, "pwm")
+	fan := FanInfo{
+		ID:    hwmon + "-" + pwm,
+		Chip:  readSysString(filepath.Join(dir, "name")),
+		Label: readSysString(filepath.Join(dir, "fan"+n+"_label")),
+		PWM:   readSysInt(filepath.Join(dir, pwm)),
+		Mode:  "unknown",
+	}
+	fan.Percent = math.Round(float64(fan.PWM)*1000/255) / 10
+
+	if _, err := os.Stat(filepath.Join(dir, "fan"+n+"_input")); err == nil {
+		rpm := readSysInt(filepath.Join(dir, "fan"+n+"_input"))
+		fan.RPM = &rpm
+	}
+
+	switch readSysInt(filepath.Join(dir, pwm+"_enable")) {
+	case 0:
+		fan.Mode = FanModeFull // on most chips 0 disables control: fan at full speed
+	case 1:
+		fan.Mode = FanModeManual
+		if fan.PWM == 255 {
+			fan.Mode = FanModeFull
+		}
+	default:
+		fan.Mode = FanModeAuto
+	}
+
+	// Chips with a programmable curve (nct6775, it87, ...) expose
+	// pwmN_auto_pointK_temp (m°C) / pwmN_auto_pointK_pwm.
+	for k := 1; ; k++ {
+		prefix := filepath.Join(dir, fmt.Sprintf("%s_auto_point%d_", pwm, k))
+		if _, err := os.Stat(prefix + "pwm"); err != nil {
+			break
+		}
+		fan.Curve = append(fan.Curve, FanCurvePoint{
+			Temperature: float64(readSysInt(prefix+"temp")) / 1000,
+			PWM:         readSysInt(prefix + "pwm"),
+		})
+	}
+	return fan
+}
+
+// fanDir validates a fan ID and returns its hwmon directory and pwm name.
+func fanDir(id string) (string, string, error) {
+	m := fanIDPattern.FindStringSubmatch(id)
+	if m == nil {
+		return "", "", ErrFanNotFound
+	}
+	dir := filepath.Join(hwmonRoot(), m[1])
+	if _, err := os.Stat(filepath.Join(dir, m[2])); err != nil {
+		return "", "", ErrFanNotFound
+	}
+	return dir, m[2], nil
+}
+
+// SetFanPWM switches a fan to manual control at duty cycle pwm (0-255).
+func SetFanPWM(id string, pwm int) (FanInfo, error) {
+	dir, name, err := fanDir(id)
+	if err != nil {
+		return FanInfo{}, err
+	}
+	if pwm < 0 || pwm > 255 {
+		return FanInfo{}, fmt.Errorf("pwm %d out of range 0-255", pwm)
+	}
+	rememberFan(filepath.Join(dir, name))
+	if err := writeSysInt(filepath.Join(dir, name+"_enable"), 1); err != nil {
+		return FanInfo{}, err
+	}
+	if err := writeSysInt(filepath.Join(dir, name), pwm); err != nil {
+		return FanInfo{}, err
+	}
+	return readFan(dir, filepath.Base(dir), name), nil
+}
+
+// SetFanMode switches a fan between automatic and full-speed control.
+// Manual mode is set through SetFanPWM.
+func SetFanMode(id, mode string) (FanInfo, error) {
+	dir, name, err := fanDir(id)
+	if err != nil {
+		return FanInfo{}, err
+	}
+	switch mode {
+	case FanModeAuto:
+		rememberFan(filepath.Join(dir, name))
+		err = writeSysInt(filepath.Join(dir, name+"_enable"), 2)
+	case FanModeFull:
+		return SetFanPWM(id, 255)
+	default:
+		return FanInfo{}, fmt.Errorf("unknown mode %q", mode)
+	}
+	if err != nil {
+		return FanInfo{}, err
+	}
+	return readFan(dir, filepath.Base(dir), name), nil
+}
+
+// rememberFan records the setting of the PWM output at path the first time
+// the agent changes it.
+func rememberFan(path string) {
+	originalFansMu.Lock()
+	defer originalFansMu.Unlock()
+	if _, ok := originalFans[path]; ok {
+		return
+	}
+	enable, err := strconv.Atoi(readSysString(path + "_enable"))
+	if err != nil {
+		return // no mode to restore
+	}
+	originalFans[path] = fanSetting{enable: enable, pwm: readSysInt(path)}
+}
+
+// RestoreFans puts every fan the agent changed back in the mode it had
+// before, and its duty cycle if that mode was manual. Call it on shutdown so
+// a fan isn't left at a fixed speed with nothing watching temperatures.
+func RestoreFans() error {
+	originalFansMu.Lock()
+	defer originalFansMu.Unlock()
+
+	var errs []error
+	for path, orig := range originalFans {
+		err := writeSysInt(path+"_enable", orig.enable)
+		if err == nil && orig.enable == 1 {
+			err = writeSysInt(path, orig.pwm)
+		}
+		if err != nil {
+			errs = append(errs, err)
+		}
+		delete(originalFans, path)
+	}
+	return errors.Join(errs...)
+}
+
+func readSysString(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+func readSysInt(path string) int {
+	n, _ := strconv.Atoi(readSysString(path))
+	return n
+}
+
+func writeSysInt(path string, v int) error {
+	return os.WriteFile(path, []byte(strconv.Itoa(v)), 0644)
+}
@@ -0,0 +1,28 @@
+package collector
+
+import "time"
+
+// staleAfter is how many missed collection intervals make data stale.
+const staleAfter = 3
+
+// SampleInfo tells clients how fresh a section of data is, so they can grey
+// out frozen numbers instead of presenting them as current. It carries no
+// age: that would change on every request and defeat ETags, and clients
+// can work it out from SampledAt.
+type SampleInfo struct {
+	SampledAt time.Time `json:"sampledAt"`
+	Stale     bool      `json:"stale"`
+	LastError string    `json:"lastError,omitempty"`
+}
+
+// NewSampleInfo builds a SampleInfo for data last refreshed at sampledAt by a
+// collector running every interval. Data never sampled is stale.
+func NewSampleInfo(sampledAt time.Time, interval time.Duration, lastError string) SampleInfo {
+	info := SampleInfo{SampledAt: sampledAt, LastError: lastError}
+	if sampledAt.IsZero() {
+		info.Stale = true
+		return info
+	}
+	info.Stale = time.Since(sampledAt) > staleAfter*interval
+	return info
+}
@@ -0,0 +1,411 @@
+package collector
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/neur0map/deskmon-agent/internal/hostfs"
+)
+
+const gpuRefreshInterval = 5 * time.Second
+
+// GPUStats is one card with the processes using it. Processes and
+// containers are only attributed on NVIDIA cards.
+type GPUStats struct {
+	Index              int                 `json:"index"`
+	UUID               string              `json:"uuid"`
+	Name               string              `json:"name"`
+	Vendor             string              `json:"vendor"` // nvidia, amd or intel
+	UtilizationPercent float64             `json:"utilizationPercent"`
+	MemoryUsedMB       float64             `json:"memoryUsedMB"`
+	MemoryTotalMB      float64             `json:"memoryTotalMB"`
+	Temperature        float64             `json:"temperature"`
+	Processes          []GPUProcess        `json:"processes"`
+	Containers         []GPUContainerUsage `json:"containers"`
+}
+
+// GPUProcess is a process holding a GPU context. SMPercent is the share of
+// the card's streaming multiprocessors it used over the last sample, when
+// the driver reports it.
+type GPUProcess struct {
+	PID         int32   `json:"pid"`
+	Name        string  `json:"name"`
+	Type        string  `json:"type,omitempty"` // C (compute), G (graphics), C+G
+	MemoryMB    float64 `json:"memoryMB"`
+	SMPercent   float64 `json:"smPercent"`
+	ContainerID string  `json:"containerId,omitempty"`
+	Container   string  `json:"container,omitempty"`
+}
+
+// GPUContainerUsage sums a container's processes on one GPU.
+type GPUContainerUsage struct {
+	ContainerID string  `json:"containerId"`
+	Container   string  `json:"container"`
+	MemoryMB    float64 `json:"memoryMB"`
+	SMPercent   float64 `json:"smPercent"`
+	Processes   int     `json:"processes"`
+}
+
+// GPUCollector samples NVIDIA GPUs through nvidia-smi, attributing their
+// processes to containers via /proc/<pid>/cgroup, and AMD and Intel GPUs
+// through sysfs (see gpu_drm.go). It is idle on hosts with neither.
+type GPUCollector struct {
+	mu        sync.RWMutex
+	cached    []GPUStats
+	sampledAt time.Time
+	sampleErr string
+	available bool
+	nvidia    bool             // nvidia-smi is installed
+	drm       []*drmCard       // AMD and Intel cards
+	docker    *DockerCollector // resolves container IDs to names, may be nil
+	stopCh    chan struct{}
+	Pauser
+}
+
+func NewGPUCollector(docker *DockerCollector) *GPUCollector {
+	return &GPUCollector{
+		cached: []GPUStats{},
+		docker: docker,
+		stopCh: make(chan struct{}),
+	}
+}
+
+// Start begins sampling every 5 seconds if nvidia-smi is installed or an
+// AMD or Intel GPU is present.
+func (gc *GPUCollector) Start() {
+	_, err := exec.LookPath("nvidia-smi")
+	gc.nvidia = err == nil
+	gc.drm = findDRMCards()
+	if !gc.nvidia && len(gc.drm) == 0 {
+		return
+	}
+	gc.mu.Lock()
+	gc.available = true
+	gc.mu.Unlock()
+	if gc.nvidia {
+		log.Printf("gpu: nvidia-smi found, collecting GPU stats")
+	}
+	for _, c := range gc.drm {
+		log.Printf("gpu: collecting stats for %s (%s)", c.name, filepath.Base(c.dir))
+	}
+
+	gc.refresh()
+	go func() {
+		ticker := time.NewTicker(gpuRefreshInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if !gc.Paused() {
+					gc.refresh()
+				}
+			case <-gc.stopCh:
+				return
+			}
+		}
+	}()
+}
+
+func (gc *GPUCollector) Stop() {
+	close(gc.stopCh)
+}
+
+// Available reports whether nvidia-smi or an AMD or Intel GPU was found.
+func (gc *GPUCollector) Available() bool {
+	gc.mu.RLock()
+	defer gc.mu.RUnlock()
+	return gc.available
+}
+
+// Collect returns the latest cached GPU stats (non-blocking).
+func (gc *GPUCollector) Collect() []GPUStats {
+	gc.mu.RLock()
+	defer gc.mu.RUnlock()
+	result := make([]GPUStats, len(gc.cached))
+	copy(result, gc.cached)
+	return result
+}
+
+func (gc *GPUCollector) SampleInfo() SampleInfo {
+	gc.mu.RLock()
+	defer gc.mu.RUnlock()
+	return NewSampleInfo(gc.sampledAt, gpuRefreshInterval, gc.sampleErr)
+}
+
+func (gc *GPUCollector) refresh() {
+	gpus, sampleErr := []GPUStats{}, ""
+	if gc.nvidia {
+		nv, err := gc.sampleNvidia()
+		if err != nil {
+			// Keep the last NVIDIA sample alongside fresh AMD and Intel ones.
+			sampleErr = "nvidia-smi: " + err.Error()
+			gc.mu.RLock()
+			for _, g := range gc.cached {
+				if g.Vendor == "nvidia" {
+					nv = append(nv, g)
+				}
+			}
+			gc.mu.RUnlock()
+		}
+		gpus = append(gpus, nv...)
+	}
+	// AMD and Intel cards are numbered after the NVIDIA ones.
+	offset := len(gpus)
+	for i, c := range gc.drm {
+		g := c.sample()
+		g.Index = offset + i
+		gpus = append(gpus, g)
+	}
+
+	gc.mu.Lock()
+	gc.cached = gpus
+	gc.sampledAt = time.Now()
+	gc.sampleErr = sampleErr
+	gc.mu.Unlock()
+}
+
+// sampleNvidia queries nvidia-smi for its cards and the processes on them.
+func (gc *GPUCollector) sampleNvidia() ([]GPUStats, error) {
+	gpus, err := queryGPUs()
+	if err != nil {
+		return nil, err
+	}
+
+	// Per-process memory (compute contexts) and SM share (all contexts).
+	// Either query may be unsupported on consumer cards; use what we get.
+	procs := make(map[gpuProcKey]*GPUProcess)
+	byUUID := make(map[string]int)
+	byIndex := make(map[int]int)
+	for i, g := range gpus {
+		byUUID[g.UUID] = i
+		byIndex[g.Index] = i
+	}
+	queryComputeApps(byUUID, procs)
+	queryPmon(byIndex, procs)
+
+	names := make(map[string]string)
+	if gc.docker != nil {
+		for _, c := range gc.docker.Collect() {
+			names[c.ID] = c.Name
+		}
+	}
+
+	for key, p := range procs {
+		if key.gpu < 0 || key.gpu >= len(gpus) {
+			continue
+		}
+		if p.Name == "" {
+			p.Name = readProcName(p.PID)
+		}
+		if id := containerIDForPID(p.PID); id != "" {
+			p.ContainerID = id[:12]
+			p.Container = names[p.ContainerID]
+		}
+		gpus[key.gpu].Processes = append(gpus[key.gpu].Processes, *p)
+	}
+
+	// procs is a map; sort so the order doesn't change between samples.
+	for i := range gpus {
+		sort.Slice(gpus[i].Processes, func(a, b int) bool {
+			return gpus[i].Processes[a].PID < gpus[i].Processes[b].PID
+		})
+		gpus[i].Containers = summarizeGPUContainers(gpus[i].Processes)
+	}
+	return gpus, nil
+}
+
+// gpuProcKey identifies a process on a GPU; gpu is the position in the
+// collected slice, not the nvidia-smi index.
+type gpuProcKey struct {
+	gpu int
+	pid int32
+}
+
+func runNvidiaSMI(args ...string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 4*time.Second)
+	defer cancel()
+	return exec.CommandContext(ctx, "nvidia-smi", args...).Output()
+}
+
+func queryGPUs() ([]GPUStats, error) {
+	out, err := runNvidiaSMI("--query-gpu=index,uuid,name,utilization.gpu,memory.used,memory.total,temperature.gpu",
+		"--format=csv,noheader,nounits")
+	if err != nil {
+		return nil, err
+	}
+	gpus := []GPUStats{}
+	for _, fields := range csvLines(out) {
+		if len(fields) < 7 {
+			continue
+		}
+		index, _ := strconv.Atoi(fields[0])
+		gpus = append(gpus, GPUStats{
+			Index:              index,
+			UUID:               fields[1],
+			Name:               fields[2],
+			Vendor:             "nvidia",
+			UtilizationPercent: parseSMIFloat(fields[3]),
+			MemoryUsedMB:       parseSMIFloat(fields[4]),
+			MemoryTotalMB:      parseSMIFloat(fields[5]),
+			Temperature:        parseSMIFloat(fields[6]),
+			Processes:          []GPUProcess{},
+		})
+	}
+	sort.Slice(gpus, func(i, j int) bool { return gpus[i].Index < gpus[j].Index })
+	return gpus, nil
+}
+
+func queryComputeApps(byUUID map[string]int, procs map[gpuProcKey]*GPUProcess) {
+	out, err := runNvidiaSMI("--query-compute-apps=gpu_uuid,pid,process_name,used_memory",
+		"--format=csv,noheader,nounits")
+	if err != nil {
+		return
+	}
+	for _, fields := range csvLines(out) {
+		if len(fields) < 4 {
+			continue
+		}
+		gpu, ok := byUUID[fields[0]]
+		pid, err := strconv.ParseInt(fields[1], 10, 32)
+		if !ok || err != nil {
+			continue
+		}
+		key := gpuProcKey{gpu, int32(pid)}
+		procs[key] = &GPUProcess{
+			PID:      int32(pid),
+			Name:     filepath.Base(fields[2]),
+			Type:     "C",
+			MemoryMB: parseSMIFloat(fields[3]),
+		}
+	}
+}
+
+// queryPmon reads one sample of `nvidia-smi pmon`, which reports per-process
+// SM utilization for compute and graphics contexts:
+//
+//	# gpu   pid  type  sm  mem  enc  dec  command
+//	    0  1234     C  45   10    -    -  python
+func queryPmon(byIndex map[int]int, procs map[gpuProcKey]*GPUProcess) {
+	out, err := runNvidiaSMI("pmon", "-c", "1", "-s", "u")
+	if err != nil {
+		return
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 4 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		index, err1 := strconv.Atoi(fields[0])
+		pid, err2 := strconv.ParseInt(fields[1], 10, 32)
+		gpu, ok := byIndex[index]
+		if err1 != nil || err2 != nil || !ok {
+			continue // "-" rows: GPU idle
+		}
+		key := gpuProcKey{gpu, int32(pid)}
+		p, ok := procs[key]
+		if !ok {
+			p = &GPUProcess{PID: int32(pid)}
+			if len(fields) >= 8 {
+				p.Name = fields[len(fields)-1]
+			}
+			procs[key] = p
+		}
+		p.Type = fields[2]
+		p.SMPercent = parseSMIFloat(fields[3])
+	}
+}
+
+func summarizeGPUContainers(procs []GPUProcess) []GPUContainerUsage {
+	byID := make(map[string]*GPUContainerUsage)
+	for _, p := range procs {
+		if p.ContainerID == "" {
+			continue
+		}
+		u, ok := byID[p.ContainerID]
+		if !ok {
+			u = &GPUContainerUsage{ContainerID: p.ContainerID, Container: p.Container}
+			byID[p.ContainerID] = u
+		}
+		u.MemoryMB += p.MemoryMB
+		u.SMPercent += p.SMPercent
+		u.Processes++
+	}
+	result := make([]GPUContainerUsage, 0, len(byID))
+	for _, u := range byID {
+		result = append(result, *u)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].MemoryMB != result[j].MemoryMB {
+			return result[i].MemoryMB > result[j].MemoryMB
+		}
+		if result[i].Container != result[j].Container {
+			return result[i].Container < result[j].Container
+		}
+		return result[i].ContainerID < result[j].ContainerID
+	})
+	return result
+}
+
+var containerIDPattern = regexp.MustCompile(`[0-9a-f]{64}`)
+
+// containerIDForPID returns the full container ID from the process's cgroup
+// path (docker-<id>.scope, /docker/<id>, kubepods/.../<id>), or "" for host
+// processes.
+func containerIDForPID(pid int32) string {
+	f, err := os.Open(hostfs.Proc(strconv.Itoa(int(pid)), "cgroup"))
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if ids := containerIDPattern.FindAllString(scanner.Text(), -1); len(ids) > 0 {
+			return ids[len(ids)-1]
+		}
+	}
+	return ""
+}
+
+func readProcName(pid int32) string {
+	data, err := os.ReadFile(hostfs.Proc(strconv.Itoa(int(pid)), "comm"))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+func csvLines(out []byte) [][]string {
+	var rows [][]string
+	for _, line := range bytes.Split(out, []byte("\n")) {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		fields := strings.Split(string(line), ",")
+		for i := range fields {
+			fields[i] = strings.TrimSpace(fields[i])
+		}
+		rows = append(rows, fields)
+	}
+	return rows
+}
+
+// parseSMIFloat parses a nounits value; "[N/A]" and "-" read as 0.
+func parseSMIFloat(s string) float64 {
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0
+	}
+	return v
+}
@@ -0,0 +1,181 @@
+package collector
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/neur0map/deskmon-agent/internal/hostfs"
+)
+
+// AMD and Intel GPUs, read from /sys/class/drm/card<N>/device and its hwmon
+// chip. amdgpu reports busy percent and VRAM directly. i915 and xe have no
+// busy counter, so utilization is the share of time the GT was out of its
+// idle (RC6) state since the previous sample; integrated parts have no
+// VRAM and report 0.
+
+const (
+	pciVendorAMD   = "0x1002"
+	pciVendorIntel = "0x8086"
+)
+
+// Intel GT idle residency counters in milliseconds, relative to the card
+// directory, in the order they are tried.
+var intelIdleCounters = []string{
+	"gt/gt0/rc6_residency_ms",                   // i915 with per-GT sysfs
+	"power/rc6_residency_ms",                    // older i915
+	"device/tile0/gt0/gtidle/idle_residency_ms", // xe
+}
+
+// drmCard is one AMD or Intel GPU. NVIDIA cards also show up under
+// /sys/class/drm but are sampled through nvidia-smi instead.
+type drmCard struct {
+	dir    string // /sys/class/drm/card<N>
+	vendor string // amd or intel
+	name   string
+	uuid   string
+
+	idleCounter string // Intel only
+	lastIdle    int64
+	lastAt      time.Time
+}
+
+// findDRMCards lists the AMD and Intel GPUs, ordered by card number.
+func findDRMCards() []*drmCard {
+	dirs, _ := filepath.Glob(hostfs.Sys("class/drm/card[0-9]*"))
+	sort.Slice(dirs, func(i, j int) bool { return drmCardNumber(dirs[i]) < drmCardNumber(dirs[j]) })
+	var cards []*drmCard
+	seen := make(map[string]bool)
+	for _, dir := range dirs {
+		if strings.Contains(filepath.Base(dir), "-") {
+			continue // connector, e.g. card0-HDMI-A-1
+		}
+		dev := filepath.Join(dir, "device")
+		slot := pciSlot(dev)
+		if slot == "" || seen[slot] {
+			continue
+		}
+		seen[slot] = true
+		vendorID := readSysString(filepath.Join(dev, "vendor"))
+		c := &drmCard{dir: dir, uuid: slot}
+		switch vendorID {
+		case pciVendorAMD:
+			c.vendor = "amd"
+			if id := readSysString(filepath.Join(dev, "unique_id")); id != "" {
+				c.uuid = id
+			}
+			c.name = readSysString(filepath.Join(dev, "product_name"))
+		case pciVendorIntel:
+			c.vendor = "intel"
+			for _, p := range intelIdleCounters {
+				if _, err := os.Stat(filepath.Join(dir, p)); err == nil {
+					c.idleCounter = filepath.Join(dir, p)
+					break
+				}
+			}
+		default:
+			continue
+		}
+		if c.name == "" {
+			c.name = fmt.Sprintf("%s GPU (%s:%s)", vendorName(c.vendor),
+				strings.TrimPrefix(vendorID, "0x"),
+				strings.TrimPrefix(readSysString(filepath.Join(dev, "device")), "0x"))
+		}
+		cards = append(cards, c)
+	}
+	return cards
+}
+
+func drmCardNumber(dir string) int {
+	n, err := strconv.Atoi(strings.TrimPrefix(filepath.Base(dir), "card"))
+	if err != nil {
+		return -1
+	}
+	return n
+}
+
+// pciSlot is the PCI address the device link points at, e.g. 0000:03:00.0.
+func pciSlot(dev string) string {
+	target, err := filepath.EvalSymlinks(dev)
+	if err != nil {
+		return ""
+	}
+	return filepath.Base(target)
+}
+
+func vendorName(vendor string) string {
+	if vendor == "amd" {
+		return "AMD"
+	}
+	return "Intel"
+}
+
+// sample reads the card's current stats. It keeps the Intel idle counter
+// for the next call, so it must not run concurrently.
+func (c *drmCard) sample() GPUStats {
+	dev := filepath.Join(c.dir, "device")
+	g := GPUStats{
+		UUID:        c.uuid,
+		Name:        c.name,
+		Vendor:      c.vendor,
+		Temperature: drmTemperature(dev),
+		Processes:   []GPUProcess{},
+		Containers:  []GPUContainerUsage{},
+	}
+	switch c.vendor {
+	case "amd":
+		g.UtilizationPercent = float64(readSysInt(filepath.Join(dev, "gpu_busy_percent")))
+		g.MemoryUsedMB = readSysMB(filepath.Join(dev, "mem_info_vram_used"))
+		g.MemoryTotalMB = readSysMB(filepath.Join(dev, "mem_info_vram_total"))
+	case "intel":
+		g.UtilizationPercent = c.intelBusy()
+	}
+	return g
+}
+
+// intelBusy is 100 minus the share of the time since the last sample the
+// GT spent idle; 0 on the first sample.
+func (c *drmCard) intelBusy() float64 {
+	if c.idleCounter == "" {
+		return 0
+	}
+	idle, err := strconv.ParseInt(readSysString(c.idleCounter), 10, 64)
+	if err != nil {
+		return 0
+	}
+	now := time.Now()
+	prevIdle, prevAt := c.lastIdle, c.lastAt
+	c.lastIdle, c.lastAt = idle, now
+	if prevAt.IsZero() || idle < prevIdle {
+		return 0
+	}
+	wall := now.Sub(prevAt).Milliseconds()
+	if wall <= 0 {
+		return 0
+	}
+	busy := 100 - float64(idle-prevIdle)*100/float64(wall)
+	return min(max(busy, 0), 100)
+}
+
+// drmTemperature reads the card's hwmon chip in degrees Celsius, preferring
+// temp1 (edge on amdgpu), or 0 without one.
+func drmTemperature(dev string) float64 {
+	inputs, _ := filepath.Glob(filepath.Join(dev, "hwmon", "hwmon*", "temp*_input"))
+	sort.Strings(inputs)
+	for _, in := range inputs {
+		if v, err := strconv.Atoi(readSysString(in)); err == nil && v > 0 {
+			return float64(v) / 1000
+		}
+	}
+	return 0
+}
+
+// readSysMB reads a byte count as MiB, the unit nvidia-smi reports.
+func readSysMB(path string) float64 {
+	n, _ := strconv.ParseInt(readSysString(path), 10, 64)
+	return float64(n) / (1 << 20)
+}
@@ -0,0 +1,29 @@
+package collector
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestSummarizeGPUContainersOrder(t *testing.T) {
+	procs := []GPUProcess{
+		{PID: 1, ContainerID: "ccc", Container: "web", MemoryMB: 100},
+		{PID: 2, ContainerID: "bbb", Container: "api", MemoryMB: 100},
+		{PID: 3, ContainerID: "aaa", Container: "ml", MemoryMB: 400},
+		{PID: 4, ContainerID: "ddd", Container: "api", MemoryMB: 100},
+		{PID: 5, MemoryMB: 900}, // not in a container
+		{PID: 6, ContainerID: "ccc", Container: "web", MemoryMB: 0},
+	}
+	want := []string{"aaa", "bbb", "ddd", "ccc"}
+	// Containers with equal memory come out of a map; repeat so a missing
+	// tie-break shows up.
+	for range 20 {
+		var got []string
+		for _, u := range summarizeGPUContainers(procs) {
+			got = append(got, u.ContainerID)
+		}
+		if !slices.Equal(got, want) {
+			t.Fatalf("order = %v, want %v", got, want)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package collector
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"os/exec"
+	"slices"
+	"strings"
+	"time"
+)
+
+// VulnerabilitySummary counts CVEs found in an image by Trivy.
+type VulnerabilitySummary struct {
+	Critical  int       `json:"critical"`
+	High      int       `json:"high"`
+	Medium    int       `json:"medium"`
+	Low       int       `json:"low"`
+	Unknown   int       `json:"unknown"`
+	ScannedAt time.Time `json:"scannedAt"`
+}
+
+// imageInfo is cached per image ID; image metadata never changes.
+type imageInfo struct {
+	created time.Time
+}
+
+// imageScan is the last Trivy scan of an image ref. summary is nil when
+// the scan failed: the image's CVE count is unknown, not zero.
+type imageScan struct {
+	summary   *VulnerabilitySummary
+	scannedAt time.Time
+}
+
+// defaultScanInterval is how often each image is re-scanned with Trivy.
+const defaultScanInterval = 6 * time.Hour
+
+// EnableImageScanning turns on CVE counts via a Trivy server. The trivy CLI
+// must be installed; it runs in client mode against server, so the
+// vulnerability DB lives on the server. Call before Start.
+func (dc *DockerCollector) EnableImageScanning(server string, interval time.Duration) {
+	if interval <= 0 {
+		interval = defaultScanInterval
+	}
+	if _, err := exec.LookPath("trivy"); err != nil {
+		log.Printf("docker: trivy_server set but trivy CLI not found in PATH, image scanning disabled")
+		return
+	}
+	dc.mu.Lock()
+	dc.trivyServer = server
+	dc.scanInterval = interval
+	dc.mu.Unlock()
+	log.Printf("docker: scanning images via Trivy server %s every %s", server, interval)
+}
+
+// applyImageInfo fills image age and tag fields.
+func applyImageInfo(cs *ContainerStats, created time.Time) {
+	cs.ImageLatestTag = isLatestTag(cs.Image)
+	if created.IsZero() {
+		return
+	}
+	cs.ImageCreated = created.UTC().Format(time.RFC3339)
+	cs.ImageAgeDays = int(time.Since(created).Hours() / 24)
+}
+
+// isLatestTag reports whether ref uses the floating "latest" tag, either
+// explicitly or by omitting the tag. Digest-pinned refs are never latest.
+func isLatestTag(ref string) bool {
+	if strings.Contains(ref, "@") || strings.HasPrefix(ref, "sha256:") {
+		return false
+	}
+	name := ref
+	if i := strings.LastIndex(ref, "/"); i >= 0 {
+		name = ref[i+1:]
+	}
+	_, tag, hasTag := strings.Cut(name, ":")
+	return !hasTag || tag == "latest"
+}
+
+// scanImages runs Trivy for images whose last scan is older than the scan
+// interval. Runs in the background, one image at a time, so a slow scan
+// never delays stats collection.
+func (dc *DockerCollector) scanImages(refs []string) {
+	dc.mu.Lock()
+	if dc.trivyServer == "" || dc.scanning {
+		dc.mu.Unlock()
+		return
+	}
+	var due []string
+	seen := make(map[string]bool)
+	for _, ref := range refs {
+		if seen[ref] {
+			continue
+		}
+		seen[ref] = true
+		if v, ok := dc.vulns[ref]; !ok || time.Since(v.scannedAt) > dc.scanInterval {
+			due = append(due, ref)
+		}
+	}
+	if len(due) == 0 {
+		dc.mu.Unlock()
+		return
+	}
+	dc.scanning = true
+	server := dc.trivyServer
+	dc.mu.Unlock()
+
+	go func() {
+		defer func() {
+			dc.mu.Lock()
+			dc.scanning = false
+			dc.mu.Unlock()
+		}()
+		for _, ref := range due {
+			summary, err := trivyScan(server, ref)
+			if err != nil {
+				log.Printf("docker: trivy scan of %s failed: %v", ref, err)
+			}
+			// A failed scan is retried after the interval like a good one.
+			dc.mu.Lock()
+			dc.vulns[ref] = imageScan{summary: summary, scannedAt: time.Now()}
+			dc.mu.Unlock()
+		}
+	}()
+}
+
+// attachScans sets Vulnerabilities from the last successful scan of each
+// container's image and forgets images and scans no container uses any
+// more. Called with dc.mu held.
+func (dc *DockerCollector) attachScans(results []ContainerStats, imageIDs []string) {
+	refs := make(map[string]bool, len(results))
+	for i := range results {
+		refs[results[i].Image] = true
+		if scan, ok := dc.vulns[results[i].Image]; ok && scan.summary != nil {
+			v := *scan.summary
+			results[i].Vulnerabilities = &v
+		}
+	}
+	for ref := range dc.vulns {
+		if !refs[ref] {
+			delete(dc.vulns, ref)
+		}
+	}
+	for id := range dc.images {
+		if !slices.Contains(imageIDs, id) {
+			delete(dc.images, id)
+		}
+	}
+}
+
+// trivyScan runs the trivy CLI in client/server mode and counts findings
+// by severity.
+func trivyScan(server, ref string) (*VulnerabilitySummary, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "trivy", "image",
+		"--server", server,
+		"--scanners", "vuln",
+		"--format", "json",
+		"--quiet",
+		ref)
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	if err := cmd.Run(); err != nil {
+		return nil, err
+	}
+
+	var report struct {
+		Results []struct {
+			Vulnerabilities []struct {
+				Severity string `json:"Severity"`
+			} `json:"Vulnerabilities"`
+		} `json:"Results"`
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &report); err != nil {
+		return nil, err
+	}
+
+	summary := &VulnerabilitySummary{ScannedAt: time.Now()}
+	for _, result := range report.Results {
+		for _, v := range result.Vulnerabilities {
+			switch v.Severity {
+			case "CRITICAL":
+				summary.Critical++
+			case "HIGH":
+				summary.High++
+			case "MEDIUM":
+				summary.Medium++
+			case "LOW":
+				summary.Low++
+			default:
+				summary.Unknown++
+			}
+		}
+	}
+	return summary, nil
+}
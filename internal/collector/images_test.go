@@ -0,0 +1,38 @@
+package collector
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAttachScansSkipsFailedAndPrunes(t *testing.T) {
+	dc := NewDockerCollector("")
+	now := time.Now()
+	dc.images["sha256:web"] = imageInfo{created: now}
+	dc.images["sha256:gone"] = imageInfo{created: now}
+	dc.vulns["nginx:1.27"] = imageScan{summary: &VulnerabilitySummary{High: 2, ScannedAt: now}, scannedAt: now}
+	dc.vulns["redis:7"] = imageScan{scannedAt: now} // scan failed
+	dc.vulns["old:1"] = imageScan{summary: &VulnerabilitySummary{}, scannedAt: now}
+
+	results := []ContainerStats{{Name: "web", Image: "nginx:1.27"}, {Name: "cache", Image: "redis:7"}}
+	dc.attachScans(results, []string{"sha256:web", "sha256:cache"})
+
+	if v := results[0].Vulnerabilities; v == nil || v.High != 2 {
+		t.Errorf("web vulnerabilities = %+v, want 2 high", v)
+	}
+	if v := results[1].Vulnerabilities; v != nil {
+		t.Errorf("cache vulnerabilities = %+v after a failed scan, want none", v)
+	}
+	if _, ok := dc.vulns["old:1"]; ok {
+		t.Error("scan of an image no container uses was kept")
+	}
+	if _, ok := dc.vulns["redis:7"]; !ok {
+		t.Error("failed scan was forgotten, it would be retried every refresh")
+	}
+	if _, ok := dc.images["sha256:gone"]; ok {
+		t.Error("metadata of a removed image was kept")
+	}
+	if _, ok := dc.images["sha256:web"]; !ok {
+		t.Error("metadata of an image in use was dropped")
+	}
+}
@@ -0,0 +1,20 @@
+package collector
+
+import "sync/atomic"
+
+// Pauser lets the memory guard suspend a collector's optional background
+// work. A paused collector keeps serving its last sample, which goes stale
+// in its SampleInfo until the collector is resumed.
+type Pauser struct {
+	paused atomic.Bool
+}
+
+// SetPaused suspends or resumes the collector's refreshes.
+func (p *Pauser) SetPaused(paused bool) {
+	p.paused.Store(paused)
+}
+
+// Paused reports whether refreshes are suspended.
+func (p *Pauser) Paused() bool {
+	return p.paused.Load()
+}
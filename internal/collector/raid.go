@@ -0,0 +1,155 @@
+package collector
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/neur0map/deskmon-agent/internal/hostfs"
+)
+
+// RAIDArray is a Linux software RAID (md) array from /proc/mdstat.
+type RAIDArray struct {
+	Name      string       `json:"name"`  // md0
+	Level     string       `json:"level"` // raid1, raid5, ...; empty while inactive
+	State     string       `json:"state"` // clean, degraded, rebuilding, resyncing, inactive
+	Degraded  bool         `json:"degraded"`
+	SizeBytes uint64       `json:"sizeBytes"`
+	Devices   int          `json:"devices"`       // members the array should have
+	Active    int          `json:"activeDevices"` // members in sync
+	Members   []RAIDMember `json:"members"`
+	Sync      *RAIDSync    `json:"sync,omitempty"` // resync, recovery, reshape, check or repair in progress
+}
+
+// RAIDMember is one component device of an array.
+type RAIDMember struct {
+	Device string `json:"device"`
+	Role   string `json:"role"` // active, failed, spare, journal, replacement
+}
+
+// RAIDSync is an array's running (or queued) resync.
+type RAIDSync struct {
+	Action           string  `json:"action"` // resync, recovery, reshape, check, repair
+	ProgressPercent  float64 `json:"progressPercent"`
+	FinishSeconds    int64   `json:"finishSeconds"`
+	SpeedBytesPerSec uint64  `json:"speedBytesPerSec"`
+	Pending          bool    `json:"pending"` // DELAYED or PENDING behind another array
+}
+
+// RAID array states.
+const (
+	RAIDClean      = "clean"
+	RAIDDegraded   = "degraded"
+	RAIDRebuilding = "rebuilding" // degraded, recovering onto a new member
+	RAIDResyncing  = "resyncing"  // redundant, but parity or mirrors are being checked or rewritten
+	RAIDInactive   = "inactive"
+)
+
+var (
+	mdHeaderRe   = regexp.MustCompile(`^(md\w+) : (\w+)(?: \([^)]*\))* ?(.*)$`)
+	mdCountsRe   = regexp.MustCompile(`\[(\d+)/(\d+)\] \[[U_]+\]`)
+	mdSyncRe     = regexp.MustCompile(`(resync|recovery|reshape|check|repair) *= *([\d.]+)%.*?finish=([\d.]+)min speed=(\d+)K/sec`)
+	mdPendingRe  = regexp.MustCompile(`(resync|recovery|reshape|check|repair)=(DELAYED|PENDING)`)
+	mdMemberRe   = regexp.MustCompile(`^([^\[]+)\[\d+\]((?:\([A-Z]\))*)$`)
+	mdBlocksRe   = regexp.MustCompile(`^(\d+) blocks`)
+	mdPersonalRe = regexp.MustCompile(`^(raid\d+|linear|multipath|faulty)$`)
+)
+
+// readRAIDArrays parses /proc/mdstat; nil without md arrays or off Linux.
+func readRAIDArrays() []RAIDArray {
+	data, err := os.ReadFile(hostfs.Proc("mdstat"))
+	if err != nil {
+		return nil
+	}
+	return parseMdstat(data)
+}
+
+// parseMdstat reads each array's header and the lines indented under it:
+//
+//	md1 : active raid5 sdd1[3] sdc1[1] sdb1[0](F)
+//	      1953259520 blocks super 1.2 level 5, 512k chunk, algorithm 2 [3/2] [U_U]
+//	      [=>...................]  recovery =  8.5% (83046912/976629760) finish=98.2min speed=151644K/sec
+func parseMdstat(data []byte) []RAIDArray {
+	var arrays []RAIDArray
+	var cur *RAIDArray
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if m := mdHeaderRe.FindStringSubmatch(line); m != nil {
+			arrays = append(arrays, RAIDArray{Name: m[1], State: m[2], Members: []RAIDMember{}})
+			cur = &arrays[len(arrays)-1]
+			for _, f := range strings.Fields(m[3]) {
+				if mdPersonalRe.MatchString(f) {
+					cur.Level = f
+				} else if mm := mdMemberRe.FindStringSubmatch(f); mm != nil {
+					cur.Members = append(cur.Members, RAIDMember{Device: mm[1], Role: mdMemberRole(mm[2])})
+				}
+			}
+			continue
+		}
+		if cur == nil || !strings.HasPrefix(line, " ") {
+			cur = nil
+			continue
+		}
+		line = strings.TrimSpace(line)
+		if m := mdBlocksRe.FindStringSubmatch(line); m != nil {
+			blocks, _ := strconv.ParseUint(m[1], 10, 64)
+			cur.SizeBytes = blocks * 1024
+		}
+		if m := mdCountsRe.FindStringSubmatch(line); m != nil {
+			cur.Devices, _ = strconv.Atoi(m[1])
+			cur.Active, _ = strconv.Atoi(m[2])
+		}
+		if m := mdSyncRe.FindStringSubmatch(line); m != nil {
+			s := &RAIDSync{Action: m[1]}
+			s.ProgressPercent, _ = strconv.ParseFloat(m[2], 64)
+			finish, _ := strconv.ParseFloat(m[3], 64)
+			s.FinishSeconds = int64(finish * 60)
+			kb, _ := strconv.ParseUint(m[4], 10, 64)
+			s.SpeedBytesPerSec = kb * 1024
+			cur.Sync = s
+		} else if m := mdPendingRe.FindStringSubmatch(line); m != nil {
+			cur.Sync = &RAIDSync{Action: m[1], Pending: true}
+		}
+	}
+	for i := range arrays {
+		arrays[i].State, arrays[i].Degraded = mdArrayState(arrays[i])
+	}
+	return arrays
+}
+
+// mdArrayState turns mdstat's active/inactive into one of the RAID*
+// states. An array is degraded while fewer members are in sync than it
+// should have, including while it rebuilds.
+func mdArrayState(a RAIDArray) (string, bool) {
+	if a.State != "active" {
+		return RAIDInactive, true
+	}
+	degraded := a.Active < a.Devices
+	switch {
+	case degraded && a.Sync != nil && a.Sync.Action == "recovery":
+		return RAIDRebuilding, true
+	case degraded:
+		return RAIDDegraded, true
+	case a.Sync != nil:
+		return RAIDResyncing, false
+	}
+	return RAIDClean, false
+}
+
+func mdMemberRole(flags string) string {
+	switch {
+	case strings.Contains(flags, "(F)"):
+		return "failed"
+	case strings.Contains(flags, "(S)"):
+		return "spare"
+	case strings.Contains(flags, "(J)"):
+		return "journal"
+	case strings.Contains(flags, "(R)"):
+		return "replacement"
+	}
+	return "active"
+}
@@ -0,0 +1,456 @@
+//go:build !noplugins
+
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Access log analytics for the web server plugins, opt-in with the
+// "accessLog" setting: comma-separated paths or globs of log files. Each
+// collection reads what was appended since the previous one, so nothing
+// runs between collections and nothing is read twice. A file seen for the
+// first time is read from its end; a rotated or truncated one from its
+// start. Lines are nginx's combined (or common) format, optionally
+// prefixed with the virtual host as in Apache's vhost_combined, or JSON
+// such as Caddy's. Lines without a host are counted under the file's
+// name, for one log per vhost.
+
+const (
+	accessLogWindow        = 5 * time.Minute
+	maxAccessLogFiles      = 50
+	maxAccessLogRead       = 16 << 20 // per file per collection; older lines beyond it are skipped
+	maxAccessPathsPerBatch = 500      // distinct paths per vhost per collection, the rest count as "(other)"
+	maxAccessPathLen       = 128
+	maxAccessVhosts        = 20
+	topAccessPaths         = 10
+	topVhostPaths          = 5
+
+	defaultAccessErrorPercent = 5.0
+	minAccessErrorRequests    = 20 // a handful of requests is too few to call a surge
+)
+
+// accessLogs tails one service's access logs and keeps a rolling window of
+// what they recorded.
+type accessLogs struct {
+	mu      sync.Mutex
+	files   map[string]*tailedLog
+	batches []accessBatch // oldest first
+	since   time.Time     // first collection, to compute rates before a full window
+}
+
+type tailedLog struct {
+	info   os.FileInfo
+	offset int64
+}
+
+// accessBatch is what one collection read, by vhost.
+type accessBatch struct {
+	at       time.Time
+	hosts    map[string]*accessCounts
+	unparsed int64
+}
+
+type accessCounts struct {
+	requests int64
+	status   [6]int64 // by status class, index 1-5
+	paths    map[string]int64
+}
+
+// accessEntry is one parsed log line.
+type accessEntry struct {
+	host   string
+	path   string
+	status int
+}
+
+// accessLogReport is stats.accessLog.
+type accessLogReport struct {
+	WindowSeconds  int                 `json:"windowSeconds"`
+	Requests       int64               `json:"requests"`
+	RequestsPerSec float64             `json:"requestsPerSec"`
+	Status         map[string]int64    `json:"status"`
+	ErrorPercent   float64             `json:"errorPercent"` // share of 5xx responses
+	TopPaths       []accessPathCount   `json:"topPaths"`
+	Vhosts         []accessVhostReport `json:"vhosts"`
+	Files          int                 `json:"files"`
+	Unparsed       int64               `json:"unparsed"`
+	Error          string              `json:"error,omitempty"`
+}
+
+// accessVhostReport is one virtual host's share of the window.
+type accessVhostReport struct {
+	Host           string            `json:"host"`
+	Requests       int64             `json:"requests"`
+	RequestsPerSec float64           `json:"requestsPerSec"`
+	Status         map[string]int64  `json:"status"`
+	ErrorPercent   float64           `json:"errorPercent"`
+	TopPaths       []accessPathCount `json:"topPaths"`
+}
+
+// accessPathCount is a path and its requests in the window.
+type accessPathCount struct {
+	Path     string `json:"path"`
+	Requests int64  `json:"requests"`
+}
+
+// apply adds stats.accessLog when the service has an accessLog setting,
+// and degrades the card while 5xx responses exceed accessLogErrorPercent
+// (default 5) of the window's requests.
+func (l *accessLogs) apply(svc *DetectedService, stats *ServiceStats) {
+	patterns := svc.Meta["accessLog"]
+	if patterns == "" {
+		return
+	}
+	r := l.collect(time.Now(), patterns)
+	stats.Stats["accessLog"] = r
+
+	threshold := defaultAccessErrorPercent
+	if v, err := strconv.ParseFloat(svc.Meta["accessLogErrorPercent"], 64); err == nil && v > 0 {
+		threshold = v
+	}
+	if r.Requests >= minAccessErrorRequests && r.ErrorPercent >= threshold {
+		stats.degrade("server_errors", fmt.Sprintf("%.1f%% of requests in the last 5 minutes returned 5xx", r.ErrorPercent))
+	}
+}
+
+func (l *accessLogs) collect(now time.Time, patterns string) *accessLogReport {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.files == nil {
+		l.files = make(map[string]*tailedLog)
+		l.since = now
+	}
+
+	paths, err := accessLogPaths(patterns)
+	batch := accessBatch{at: now, hosts: make(map[string]*accessCounts)}
+	seen := make(map[string]bool, len(paths))
+	for _, path := range paths {
+		seen[path] = true
+		l.read(path, &batch)
+	}
+	for path := range l.files {
+		if !seen[path] {
+			delete(l.files, path)
+		}
+	}
+
+	l.batches = append(l.batches, batch)
+	cut := 0
+	for cut < len(l.batches) && now.Sub(l.batches[cut].at) > accessLogWindow {
+		cut++
+	}
+	l.batches = append(l.batches[:0], l.batches[cut:]...)
+
+	r := l.report(now)
+	r.Files = len(paths)
+	if err != nil {
+		r.Error = err.Error()
+	}
+	return r
+}
+
+// accessLogPaths expands the comma-separated patterns on the host.
+func accessLogPaths(patterns string) ([]string, error) {
+	var paths []string
+	for _, pattern := range strings.Split(patterns, ",") {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" {
+			continue
+		}
+		matches, err := filepath.Glob(HostPath(pattern))
+		if err != nil {
+			return nil, fmt.Errorf("invalid accessLog pattern %q: %w", pattern, err)
+		}
+		paths = append(paths, matches...)
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no access log matches %q", patterns)
+	}
+	sort.Strings(paths)
+	if len(paths) > maxAccessLogFiles {
+		paths = paths[:maxAccessLogFiles]
+	}
+	return paths, nil
+}
+
+// read adds the complete lines appended to path since the last call.
+func (l *accessLogs) read(path string, batch *accessBatch) {
+	f, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil || info.IsDir() {
+		return
+	}
+
+	t := l.files[path]
+	switch {
+	case t == nil:
+		l.files[path] = &tailedLog{info: info, offset: info.Size()}
+		return
+	case !os.SameFile(t.info, info) || info.Size() < t.offset:
+		t.offset = 0 // rotated or truncated
+	}
+	t.info = info
+
+	start := max(t.offset, info.Size()-maxAccessLogRead)
+	if _, err := f.Seek(start, io.SeekStart); err != nil {
+		return
+	}
+	data, err := io.ReadAll(io.LimitReader(f, info.Size()-start))
+	if err != nil {
+		return
+	}
+	if start > t.offset {
+		// Skipped ahead: drop the partial line at the start.
+		i := bytes.IndexByte(data, '\n') + 1
+		start += int64(i)
+		data = data[i:]
+	}
+	end := bytes.LastIndexByte(data, '\n')
+	if end < 0 {
+		t.offset = start
+		return // no complete line yet
+	}
+	t.offset = start + int64(end) + 1
+
+	fallbackHost := accessLogHost(path)
+	for _, line := range bytes.Split(data[:end], []byte{'\n'}) {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		e, ok := parseAccessLine(line)
+		if !ok {
+			batch.unparsed++
+			continue
+		}
+		if e.host == "" {
+			e.host = fallbackHost
+		}
+		batch.add(e)
+	}
+}
+
+func (b *accessBatch) add(e accessEntry) {
+	c := b.hosts[e.host]
+	if c == nil {
+		c = &accessCounts{paths: make(map[string]int64)}
+		b.hosts[e.host] = c
+	}
+	c.requests++
+	if class := e.status / 100; class >= 1 && class <= 5 {
+		c.status[class]++
+	}
+	path := e.path
+	if _, ok := c.paths[path]; !ok && len(c.paths) >= maxAccessPathsPerBatch {
+		path = "(other)"
+	}
+	c.paths[path]++
+}
+
+// accessLogHost names a log file's vhost from its file name:
+// example.com.access.log or access-example.com.log give example.com, and
+// a plain access.log gives "default".
+func accessLogHost(path string) string {
+	name := strings.TrimSuffix(filepath.Base(path), ".log")
+	for _, affix := range []string{".access", "-access", "_access", "access.", "access-", "access_"} {
+		name = strings.TrimSuffix(name, affix)
+		name = strings.TrimPrefix(name, affix)
+	}
+	if name == "" || name == "access" {
+		return "default"
+	}
+	return name
+}
+
+// combinedRe matches the common and combined formats, optionally
+// prefixed with the vhost:
+//
+//	example.com 203.0.113.7 - - [10/Oct/2025:13:55:36 +0000] "GET /index.html?x=1 HTTP/1.1" 200 2326 "-" "curl/8.5.0"
+var combinedRe = regexp.MustCompile(`^(?:(\S+) )?\S+ \S+ \S+ \[[^\]]+\] "(?:[A-Z]+ )?([^" ]*)[^"]*" (\d{3}) `)
+
+func parseAccessLine(line []byte) (accessEntry, bool) {
+	if line[0] == '{' {
+		return parseAccessJSON(line)
+	}
+	m := combinedRe.FindSubmatch(line)
+	if m == nil {
+		return accessEntry{}, false
+	}
+	status, _ := strconv.Atoi(string(m[3]))
+	return accessEntry{host: accessHost(string(m[1])), path: accessPath(string(m[2])), status: status}, true
+}
+
+// parseAccessJSON reads a JSON log line: Caddy's, with the request
+// nested, or a flat log_format escape=json with host, uri or request_uri,
+// and status (a number or a string).
+func parseAccessJSON(line []byte) (accessEntry, bool) {
+	var v struct {
+		Request *struct {
+			Host string `json:"host"`
+			URI  string `json:"uri"`
+		} `json:"request"`
+		Host       string          `json:"host"`
+		URI        string          `json:"uri"`
+		RequestURI string          `json:"request_uri"`
+		Status     json.RawMessage `json:"status"`
+	}
+	if json.Unmarshal(line, &v) != nil {
+		return accessEntry{}, false
+	}
+	status, err := strconv.Atoi(strings.Trim(string(v.Status), `"`))
+	if err != nil {
+		return accessEntry{}, false
+	}
+	e := accessEntry{host: v.Host, path: v.URI, status: status}
+	if v.Request != nil {
+		e.host, e.path = v.Request.Host, v.Request.URI
+	}
+	if e.path == "" {
+		e.path = v.RequestURI
+	}
+	e.host, e.path = accessHost(e.host), accessPath(e.path)
+	return e, true
+}
+
+// accessHost drops the port and case from a logged host; "-" means none.
+func accessHost(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if host == "-" {
+		return ""
+	}
+	return strings.ToLower(host)
+}
+
+// accessPath drops the query string, so /search?q=a and /search?q=b count
+// as one path.
+func accessPath(uri string) string {
+	if i := strings.IndexByte(uri, '?'); i >= 0 {
+		uri = uri[:i]
+	}
+	if uri == "" {
+		return "-"
+	}
+	if len(uri) > maxAccessPathLen {
+		uri = uri[:maxAccessPathLen]
+	}
+	return uri
+}
+
+// report sums the batches in the window.
+func (l *accessLogs) report(now time.Time) *accessLogReport {
+	elapsed := min(now.Sub(l.since), accessLogWindow).Seconds()
+	total := &accessCounts{paths: make(map[string]int64)}
+	hosts := make(map[string]*accessCounts)
+	var unparsed int64
+	for _, b := range l.batches {
+		unparsed += b.unparsed
+		for host, c := range b.hosts {
+			h := hosts[host]
+			if h == nil {
+				h = &accessCounts{paths: make(map[string]int64)}
+				hosts[host] = h
+			}
+			h.merge(c)
+			total.merge(c)
+		}
+	}
+
+	r := &accessLogReport{
+		WindowSeconds:  int(accessLogWindow.Seconds()),
+		Requests:       total.requests,
+		RequestsPerSec: perSecond(total.requests, elapsed),
+		Status:         total.statusMap(),
+		ErrorPercent:   total.errorPercent(),
+		TopPaths:       total.topPaths(topAccessPaths),
+		Vhosts:         []accessVhostReport{},
+		Unparsed:       unparsed,
+	}
+	for host, c := range hosts {
+		r.Vhosts = append(r.Vhosts, accessVhostReport{
+			Host:           host,
+			Requests:       c.requests,
+			RequestsPerSec: perSecond(c.requests, elapsed),
+			Status:         c.statusMap(),
+			ErrorPercent:   c.errorPercent(),
+			TopPaths:       c.topPaths(topVhostPaths),
+		})
+	}
+	sort.Slice(r.Vhosts, func(i, j int) bool {
+		if r.Vhosts[i].Requests != r.Vhosts[j].Requests {
+			return r.Vhosts[i].Requests > r.Vhosts[j].Requests
+		}
+		return r.Vhosts[i].Host < r.Vhosts[j].Host
+	})
+	if len(r.Vhosts) > maxAccessVhosts {
+		r.Vhosts = r.Vhosts[:maxAccessVhosts]
+	}
+	return r
+}
+
+func (c *accessCounts) merge(o *accessCounts) {
+	c.requests += o.requests
+	for i := range c.status {
+		c.status[i] += o.status[i]
+	}
+	for p, n := range o.paths {
+		c.paths[p] += n
+	}
+}
+
+func (c *accessCounts) statusMap() map[string]int64 {
+	m := make(map[string]int64, 5)
+	for class := 1; class <= 5; class++ {
+		m[strconv.Itoa(class)+"xx"] = c.status[class]
+	}
+	return m
+}
+
+func (c *accessCounts) errorPercent() float64 {
+	if c.requests == 0 {
+		return 0
+	}
+	return math.Round(float64(c.status[5])/float64(c.requests)*10000) / 100
+}
+
+func (c *accessCounts) topPaths(n int) []accessPathCount {
+	out := make([]accessPathCount, 0, len(c.paths))
+	for p, count := range c.paths {
+		out = append(out, accessPathCount{Path: p, Requests: count})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Requests != out[j].Requests {
+			return out[i].Requests > out[j].Requests
+		}
+		return out[i].Path < out[j].Path
+	})
+	if len(out) > n {
+		out = out[:n]
+	}
+	return out
+}
+
+func perSecond(n int64, seconds float64) float64 {
+	if seconds <= 0 {
+		return 0
+	}
+	return math.Round(float64(n)/seconds*100) / 100
+}
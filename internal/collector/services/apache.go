@@ -0,0 +1,235 @@
+//go:build !noplugins
+
+package services
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+func init() {
+	Register(&ApachePlugin{})
+}
+
+// ApachePlugin detects Apache httpd and collects stats from mod_status's
+// machine-readable page (server-status?auto). "accessLog" adds access log
+// analytics, see accesslog.go.
+type ApachePlugin struct {
+	mu     sync.Mutex
+	last   *apacheStatus // previous collection, for request and byte rates
+	lastAt time.Time
+	logs   accessLogs
+}
+
+func (p *ApachePlugin) ID() string   { return "apache" }
+func (p *ApachePlugin) Name() string { return "Apache" }
+func (p *ApachePlugin) Icon() string { return "globe.americas" }
+
+// Common mod_status paths; /server-status is the stock configuration.
+var apacheStatusPaths = []string{"/server-status?auto", "/status?auto"}
+
+func (p *ApachePlugin) Detect(ctx context.Context, env *DetectionEnv) *DetectedService {
+	base := &DetectedService{
+		PluginID: p.ID(),
+		Name:     p.Name(),
+		Icon:     p.Icon(),
+		Meta:     make(map[string]string),
+	}
+
+	// Strategy 1: Docker container running the httpd image (or a PHP
+	// image with Apache built in)
+	for _, image := range []string{"httpd", "apache"} {
+		if c := env.FindDockerImage(image); c != nil && c.State == "running" {
+			if url, path := probeApacheStatus(env, append(c.HostPorts, 80, 8080)); url != "" {
+				base.BaseURL = url
+				base.Meta["statusPath"] = path
+				log.Printf("services: apache detected via docker (%s) at %s%s", c.Image, url, path)
+				return base
+			}
+		}
+	}
+
+	// Strategy 2: apache2 (Debian) or httpd (Red Hat, Alpine) process
+	for _, name := range []string{"apache2", "httpd"} {
+		if !env.HasProcess(name) {
+			continue
+		}
+		ports := append(env.FindProcessPorts(name), 80, 8080, 443, 8443)
+		if url, path := probeApacheStatus(env, ports); url != "" {
+			base.BaseURL = url
+			base.Meta["statusPath"] = path
+			log.Printf("services: apache detected via process (%s) at %s%s", name, url, path)
+			return base
+		}
+	}
+
+	return nil
+}
+
+// probeApacheStatus tries each status path on each port, returns (baseURL, path) or ("", "").
+func probeApacheStatus(env *DetectionEnv, ports []int) (string, string) {
+	for _, path := range apacheStatusPaths {
+		if url := env.ProbeHTTP(ports, path); url != "" {
+			return url, path
+		}
+	}
+	return "", ""
+}
+
+func (p *ApachePlugin) Collect(ctx context.Context, svc *DetectedService) (*ServiceStats, error) {
+	statusPath := svc.Meta["statusPath"]
+	if statusPath == "" {
+		statusPath = "/server-status?auto"
+	}
+
+	body, err := HTTPGet(ctx, svc.BaseURL+statusPath)
+	if err != nil {
+		return nil, fmt.Errorf("could not reach Apache mod_status at %s%s: %w", svc.BaseURL, statusPath, err)
+	}
+	st, err := parseApacheStatus(string(body))
+	if err != nil {
+		return nil, fmt.Errorf("invalid mod_status response: %w", err)
+	}
+	reqRate, byteRate := p.rates(st, time.Now())
+
+	stats := &ServiceStats{
+		PluginID: p.ID(),
+		Name:     p.Name(),
+		Icon:     p.Icon(),
+		Status:   StatusRunning,
+		Summary: []StatItem{
+			{Label: "Requests/s", Value: strconv.FormatFloat(reqRate, 'f', 1, 64), Type: "number"},
+			{Label: "Busy Workers", Value: FormatNumber(st.busyWorkers), Type: "number"},
+			{Label: "Idle Workers", Value: FormatNumber(st.idleWorkers), Type: "number"},
+			{Label: "Served", Value: formatBytes(st.totalKBytes * 1024), Type: "text"},
+		},
+		Stats: map[string]interface{}{
+			"version":         st.version,
+			"mpm":             st.mpm,
+			"uptimeSeconds":   st.uptime,
+			"totalAccesses":   st.totalAccesses,
+			"totalBytes":      st.totalKBytes * 1024,
+			"requestsPerSec":  reqRate,
+			"bytesPerSec":     byteRate,
+			"busyWorkers":     st.busyWorkers,
+			"idleWorkers":     st.idleWorkers,
+			"processes":       st.processes,
+			"connections":     st.connsTotal,
+			"extendedStatus":  st.extended,
+			"scoreboardSlots": st.slots,
+		},
+	}
+	// With every worker busy and no room to start more, new connections
+	// wait in the listen queue.
+	if st.idleWorkers == 0 && st.busyWorkers > 0 && st.openSlots == 0 {
+		stats.degrade("workers_exhausted", fmt.Sprintf("all %d workers busy", st.busyWorkers))
+	}
+	p.logs.apply(svc, stats)
+	return stats, nil
+}
+
+// rates returns requests and bytes per second since the previous
+// collection. On the first, or after Apache restarted, they fall back to
+// the averages since Apache started.
+func (p *ApachePlugin) rates(st *apacheStatus, now time.Time) (float64, float64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	reqRate, byteRate := st.reqPerSec, st.bytesPerSec
+	if prev := p.last; prev != nil && st.extended && st.uptime >= prev.uptime && st.totalAccesses >= prev.totalAccesses {
+		if elapsed := now.Sub(p.lastAt).Seconds(); elapsed > 0 {
+			reqRate = float64(st.totalAccesses-prev.totalAccesses) / elapsed
+			byteRate = float64(st.totalKBytes-prev.totalKBytes) * 1024 / elapsed
+		}
+	}
+	p.last, p.lastAt = st, now
+	return math.Round(reqRate*100) / 100, math.Round(byteRate*100) / 100
+}
+
+// apacheStatus holds parsed mod_status values. The totals and averages
+// need ExtendedStatus, which is on by default since Apache 2.3.6.
+type apacheStatus struct {
+	version       string
+	mpm           string
+	uptime        int64
+	totalAccesses int64
+	totalKBytes   int64
+	reqPerSec     float64
+	bytesPerSec   float64
+	busyWorkers   int64
+	idleWorkers   int64
+	processes     int64
+	connsTotal    int64
+	slots         int64 // scoreboard length: the most workers Apache can run
+	openSlots     int64 // scoreboard slots without a process ('.')
+	extended      bool
+}
+
+// parseApacheStatus parses mod_status's ?auto output:
+//
+//	ServerVersion: Apache/2.4.58 (Ubuntu)
+//	ServerMPM: event
+//	Uptime: 86400
+//	Total Accesses: 12345
+//	Total kBytes: 67890
+//	ReqPerSec: .142882
+//	BytesPerSec: 804.648
+//	BusyWorkers: 2
+//	IdleWorkers: 48
+//	Processes: 2
+//	ConnsTotal: 3
+//	Scoreboard: __W_K_______...
+func parseApacheStatus(body string) (*apacheStatus, error) {
+	st := &apacheStatus{}
+	found := false
+	scanner := bufio.NewScanner(strings.NewReader(body))
+	scanner.Buffer(make([]byte, 64*1024), 1<<20) // long scoreboards
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		num := func() int64 { n, _ := strconv.ParseInt(value, 10, 64); return n }
+		float := func() float64 { f, _ := strconv.ParseFloat(value, 64); return f }
+		switch key {
+		case "ServerVersion":
+			st.version = value
+		case "ServerMPM":
+			st.mpm = value
+		case "Uptime":
+			st.uptime = num()
+		case "Total Accesses":
+			st.totalAccesses = num()
+			st.extended = true
+		case "Total kBytes":
+			st.totalKBytes = num()
+		case "ReqPerSec":
+			st.reqPerSec = float()
+		case "BytesPerSec":
+			st.bytesPerSec = float()
+		case "BusyWorkers":
+			st.busyWorkers = num()
+			found = true
+		case "IdleWorkers":
+			st.idleWorkers = num()
+		case "Processes":
+			st.processes = num()
+		case "ConnsTotal":
+			st.connsTotal = num()
+		case "Scoreboard":
+			st.slots = int64(len(value))
+			st.openSlots = int64(strings.Count(value, "."))
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("missing BusyWorkers line")
+	}
+	return st, nil
+}
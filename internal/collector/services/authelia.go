@@ -0,0 +1,263 @@
+//go:build !noplugins
+
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+func init() {
+	Register(&AutheliaPlugin{})
+}
+
+// AutheliaPlugin reports health and failed authentication attempts for
+// Authelia. Failures come from its Prometheus metrics
+// (telemetry.metrics.enabled), read from "metricsUrl" or the default
+// port 9959; "failedLoginSpike" (default 10) is how many failures in 15
+// minutes mark the card degraded. Authelia has no API that lists sessions.
+type AutheliaPlugin struct {
+	failures authFailureWindow
+}
+
+func (p *AutheliaPlugin) ID() string   { return "authelia" }
+func (p *AutheliaPlugin) Name() string { return "Authelia" }
+func (p *AutheliaPlugin) Icon() string { return "person.badge.key" }
+
+const (
+	autheliaDefaultPort        = 9091
+	autheliaMetricsDefaultPort = 9959
+
+	// authFailureSpan is the span failed logins are counted over, and
+	// defaultFailedLoginSpike how many within it count as a spike.
+	authFailureSpan         = 15 * time.Minute
+	defaultFailedLoginSpike = 10
+)
+
+func (p *AutheliaPlugin) Detect(ctx context.Context, env *DetectionEnv) *DetectedService {
+	base := &DetectedService{
+		PluginID: p.ID(),
+		Name:     p.Name(),
+		Icon:     p.Icon(),
+		Meta:     make(map[string]string),
+	}
+
+	if url := strings.TrimRight(env.Config(p.ID(), "url"), "/"); url != "" {
+		base.BaseURL = url
+		log.Printf("services: authelia configured at %s", url)
+		return base
+	}
+
+	// Strategy 1: Docker container
+	// Strategy 2: authelia process
+	var ports []int
+	if c := env.FindDockerImage("authelia"); c != nil && c.State == "running" {
+		ports = append(ports, c.HostPorts...)
+	} else if env.HasProcess("authelia") {
+		ports = append(ports, env.FindProcessPorts("authelia")...)
+	} else {
+		return nil
+	}
+	ports = append(ports, autheliaDefaultPort)
+
+	for _, port := range ports {
+		if port == autheliaMetricsDefaultPort {
+			continue
+		}
+		if url := env.ProbeHTTP([]int{port}, "/api/health"); url != "" {
+			base.BaseURL = url
+			if metrics := env.ProbeHTTP([]int{autheliaMetricsDefaultPort}, "/metrics"); metrics != "" {
+				base.Meta["metricsUrl"] = metrics + "/metrics"
+			}
+			log.Printf("services: authelia detected at %s", url)
+			return base
+		}
+	}
+
+	log.Printf("services: authelia found but its API is not reachable")
+	return nil
+}
+
+func (p *AutheliaPlugin) Collect(ctx context.Context, svc *DetectedService) (*ServiceStats, error) {
+	stats := &ServiceStats{
+		PluginID: p.ID(),
+		Name:     p.Name(),
+		Icon:     p.Icon(),
+		Status:   StatusRunning,
+		Stats:    make(map[string]interface{}),
+	}
+
+	body, err := HTTPGet(ctx, svc.BaseURL+"/api/health")
+	if err != nil {
+		return nil, fmt.Errorf("could not reach Authelia at %s: %w", svc.BaseURL, err)
+	}
+	var status struct {
+		Status string `json:"status"`
+	}
+	healthy := json.Unmarshal(body, &status) == nil && status.Status == "OK"
+
+	health := "OK"
+	if !healthy {
+		health = "Unhealthy"
+		stats.degrade("unhealthy", "health check failed")
+	}
+	stats.Summary = []StatItem{
+		{Label: "Health", Value: health, Type: "status"},
+	}
+	stats.Stats["healthy"] = healthy
+
+	metricsURL := svc.Meta["metricsUrl"]
+	if metricsURL == "" {
+		stats.Stats["metricsAvailable"] = false
+		return stats, nil
+	}
+	body, err = HTTPGet(ctx, metricsURL)
+	if err != nil {
+		log.Printf("services: authelia metrics: %v", err)
+		stats.Stats["metricsAvailable"] = false
+		return stats, nil
+	}
+
+	metrics := parsePromText(body)
+	firstFactor := metrics.sum("authelia_authentication_first_factor_total", "success", "false")
+	secondFactor := metrics.sum("authelia_authentication_second_factor_total", "success", "false")
+	recent := p.failures.add(time.Now(), firstFactor+secondFactor)
+	spike := recent >= thresholdSetting(svc.Meta["failedLoginSpike"], defaultFailedLoginSpike)
+
+	stats.Summary = append(stats.Summary,
+		StatItem{Label: "Failed (15m)", Value: FormatNumber(int64(recent)), Type: "number"},
+	)
+	stats.Stats["metricsAvailable"] = true
+	stats.Stats["failedFirstFactorTotal"] = firstFactor
+	stats.Stats["failedSecondFactorTotal"] = secondFactor
+	stats.Stats["failedLoginsRecent"] = recent
+	stats.Stats["failedLoginSpike"] = spike
+	if spike {
+		stats.degrade("login_spike", fmt.Sprintf("%d failed logins in 15 minutes", int64(recent)))
+	}
+	return stats, nil
+}
+
+// authFailureWindow turns a cumulative failure counter into the number of
+// failures over the last authFailureSpan.
+type authFailureWindow struct {
+	mu      sync.Mutex
+	samples []authFailureSample
+}
+
+type authFailureSample struct {
+	at    time.Time
+	total float64
+}
+
+// add records the counter's current total and returns the increase since
+// the newest sample at least a span old, or the oldest one kept. A counter
+// reset (service restart) starts the window over.
+func (w *authFailureWindow) add(now time.Time, total float64) float64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if n := len(w.samples); n > 0 && total < w.samples[n-1].total {
+		w.samples = nil
+	}
+	w.samples = append(w.samples, authFailureSample{at: now, total: total})
+	cutoff := now.Add(-authFailureSpan)
+	i := 0
+	for i < len(w.samples)-1 && !w.samples[i+1].at.After(cutoff) {
+		i++
+	}
+	w.samples = w.samples[i:]
+	return total - w.samples[0].total
+}
+
+// promMetrics holds parsed samples from the Prometheus text format.
+type promMetrics map[string][]promSample
+
+type promSample struct {
+	labels map[string]string
+	value  float64
+}
+
+// parsePromText parses the Prometheus text exposition format, ignoring
+// comments, timestamps and malformed lines.
+func parsePromText(body []byte) promMetrics {
+	metrics := make(promMetrics)
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		name, rest := line, ""
+		labels := map[string]string{}
+		if i := strings.IndexByte(line, '{'); i >= 0 {
+			j := strings.LastIndexByte(line, '}')
+			if j < i {
+				continue
+			}
+			name, rest = line[:i], line[j+1:]
+			for _, pair := range splitPromLabels(line[i+1 : j]) {
+				k, v, ok := strings.Cut(pair, "=")
+				if ok {
+					labels[strings.TrimSpace(k)] = strings.Trim(strings.TrimSpace(v), `"`)
+				}
+			}
+		} else if i := strings.IndexAny(line, " \t"); i >= 0 {
+			name, rest = line[:i], line[i:]
+		}
+		fields := strings.Fields(rest)
+		if len(fields) == 0 {
+			continue
+		}
+		value, err := strconv.ParseFloat(fields[0], 64)
+		if err != nil {
+			continue
+		}
+		metrics[name] = append(metrics[name], promSample{labels: labels, value: value})
+	}
+	return metrics
+}
+
+// splitPromLabels splits `a="x",b="y,z"` on commas outside quotes.
+func splitPromLabels(s string) []string {
+	var parts []string
+	inQuote, start := false, 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			inQuote = !inQuote
+		case ',':
+			if !inQuote {
+				parts = append(parts, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	if start < len(s) {
+		parts = append(parts, s[start:])
+	}
+	return parts
+}
+
+// sum adds the samples of a metric whose label matches value ("" matches
+// all samples).
+func (m promMetrics) sum(name, label, value string) float64 {
+	var total float64
+	for _, s := range m[name] {
+		if label == "" || s.labels[label] == value {
+			total += s.value
+		}
+	}
+	return total
+}
@@ -0,0 +1,229 @@
+//go:build !noplugins
+
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+func init() {
+	Register(&AuthentikPlugin{})
+}
+
+// AuthentikPlugin reports health, active sessions, failed logins and
+// outstanding admin work (failing system tasks, a pending upgrade) for
+// Authentik. "token" is an API token with read access; "url" points at an
+// instance elsewhere and "failedLoginSpike" (default 10) is how many
+// failed logins in 15 minutes mark the card degraded.
+type AuthentikPlugin struct{}
+
+func (p *AuthentikPlugin) ID() string   { return "authentik" }
+func (p *AuthentikPlugin) Name() string { return "Authentik" }
+func (p *AuthentikPlugin) Icon() string { return "person.badge.shield.checkmark" }
+
+func (p *AuthentikPlugin) Detect(ctx context.Context, env *DetectionEnv) *DetectedService {
+	base := &DetectedService{
+		PluginID: p.ID(),
+		Name:     p.Name(),
+		Icon:     p.Icon(),
+		Meta:     make(map[string]string),
+	}
+
+	if url := strings.TrimRight(env.Config(p.ID(), "url"), "/"); url != "" {
+		base.BaseURL = url
+		log.Printf("services: authentik configured at %s", url)
+		return base
+	}
+
+	// The server and worker share one image; only the server publishes ports.
+	c := env.FindDockerImage("goauthentik/server")
+	if c == nil {
+		c = env.FindDockerImage("authentik")
+	}
+	if c == nil || c.State != "running" {
+		return nil
+	}
+	ports := append(c.HostPorts, 9000, 9443)
+	if url := env.ProbeHTTP(ports, "/-/health/live/"); url != "" {
+		base.BaseURL = url
+		log.Printf("services: authentik detected via docker (%s) at %s", c.Image, url)
+		return base
+	}
+
+	log.Printf("services: authentik container found but its API is not reachable")
+	return nil
+}
+
+func (p *AuthentikPlugin) Collect(ctx context.Context, svc *DetectedService) (*ServiceStats, error) {
+	stats := &ServiceStats{
+		PluginID: p.ID(),
+		Name:     p.Name(),
+		Icon:     p.Icon(),
+		Status:   StatusRunning,
+		Stats:    make(map[string]interface{}),
+	}
+
+	// /-/health/live/ answers 204; HTTPGet only takes 200.
+	live, err := authentikHealth(ctx, svc.BaseURL+"/-/health/live/")
+	if err != nil {
+		return nil, fmt.Errorf("could not reach Authentik at %s: %w", svc.BaseURL, err)
+	}
+	ready, _ := authentikHealth(ctx, svc.BaseURL+"/-/health/ready/")
+	healthy := live && ready
+
+	health := "OK"
+	if !healthy {
+		health = "Unhealthy"
+		stats.degrade("unhealthy", "liveness or readiness check failed")
+	}
+
+	token := svc.Meta["token"]
+	if token == "" {
+		if healthy {
+			stats.setStatus(StatusAuthRequired, "credentials_missing", "set token to an Authentik API token")
+		}
+		stats.Summary = []StatItem{
+			{Label: "Health", Value: health, Type: "status"},
+		}
+		stats.Stats = map[string]interface{}{
+			"healthy":      healthy,
+			"authRequired": true,
+		}
+		return stats, nil
+	}
+	api := func(path string, out interface{}) error {
+		return authentikGet(ctx, svc.BaseURL+"/api/v3"+path, token, out)
+	}
+
+	var version struct {
+		Current  string `json:"version_current"`
+		Latest   string `json:"version_latest"`
+		Outdated bool   `json:"outdated"`
+	}
+	if err := api("/admin/version/", &version); err != nil {
+		return nil, fmt.Errorf("could not reach Authentik API at %s: %w", svc.BaseURL, err)
+	}
+
+	var sessions struct {
+		Pagination struct {
+			Count int `json:"count"`
+		} `json:"pagination"`
+	}
+	if err := api("/core/authenticated_sessions/?page_size=1", &sessions); err != nil {
+		log.Printf("services: authentik sessions: %v", err)
+	}
+
+	// The newest 100 failed logins are enough to tell a spike apart.
+	var events struct {
+		Results []struct {
+			Created string `json:"created"`
+		} `json:"results"`
+	}
+	recent := 0
+	if err := api("/events/events/?action=login_failed&ordering=-created&page_size=100", &events); err == nil {
+		cutoff := time.Now().Add(-authFailureSpan)
+		for _, e := range events.Results {
+			if t, err := time.Parse(time.RFC3339Nano, e.Created); err == nil && t.After(cutoff) {
+				recent++
+			}
+		}
+	} else {
+		log.Printf("services: authentik events: %v", err)
+	}
+	spike := float64(recent) >= thresholdSetting(svc.Meta["failedLoginSpike"], defaultFailedLoginSpike)
+
+	failing := []map[string]interface{}{}
+	for _, t := range authentikSystemTasks(ctx, svc.BaseURL, token) {
+		if t.Status == "error" || t.Status == "warning" {
+			failing = append(failing, map[string]interface{}{
+				"name":        t.Name,
+				"status":      t.Status,
+				"description": t.Description,
+			})
+		}
+	}
+	adminTasks := len(failing)
+	if version.Outdated {
+		adminTasks++
+	}
+
+	stats.Summary = []StatItem{
+		{Label: "Health", Value: health, Type: "status"},
+		{Label: "Sessions", Value: FormatNumber(int64(sessions.Pagination.Count)), Type: "number"},
+		{Label: "Failed (15m)", Value: FormatNumber(int64(recent)), Type: "number"},
+		{Label: "Admin Tasks", Value: FormatNumber(int64(adminTasks)), Type: "number"},
+	}
+	stats.Stats = map[string]interface{}{
+		"healthy":            healthy,
+		"version":            version.Current,
+		"latestVersion":      version.Latest,
+		"updateAvailable":    version.Outdated,
+		"activeSessions":     sessions.Pagination.Count,
+		"failedLoginsRecent": recent,
+		"failedLoginSpike":   spike,
+		"failingTasks":       failing,
+		"adminTasks":         adminTasks,
+	}
+	switch {
+	case spike:
+		stats.degrade("login_spike", fmt.Sprintf("%d failed logins in 15 minutes", recent))
+	case len(failing) > 0:
+		stats.degrade("tasks_failing", fmt.Sprintf("%d system tasks failing", len(failing)))
+	}
+	return stats, nil
+}
+
+// authentikSystemTask is an entry from the admin system tasks list.
+type authentikSystemTask struct {
+	Name        string `json:"name"`
+	Status      string `json:"status"` // "successful", "warning", "error", "unknown"
+	Description string `json:"description"`
+}
+
+// authentikSystemTasks lists system tasks. Older releases return a bare
+// array, newer ones a paginated object; errors yield no tasks.
+func authentikSystemTasks(ctx context.Context, baseURL, token string) []authentikSystemTask {
+	var raw json.RawMessage
+	if err := authentikGet(ctx, baseURL+"/api/v3/admin/system_tasks/?page_size=100", token, &raw); err != nil {
+		log.Printf("services: authentik system tasks: %v", err)
+		return nil
+	}
+	var tasks []authentikSystemTask
+	if json.Unmarshal(raw, &tasks) == nil {
+		return tasks
+	}
+	var page struct {
+		Results []authentikSystemTask `json:"results"`
+	}
+	json.Unmarshal(raw, &page)
+	return page.Results
+}
+
+func authentikGet(ctx context.Context, url, token string, out interface{}) error {
+	body, err := HTTPGetWithHeaders(ctx, url, map[string]string{"Authorization": "Bearer " + token})
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(body, out)
+}
+
+// authentikHealth reports whether a health endpoint answers 2xx.
+func authentikHealth(ctx context.Context, url string) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return false, err
+	}
+	cl := serviceClient(ctx, 5*time.Second)
+	resp, err := cl.Do(req)
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+	return resp.StatusCode >= 200 && resp.StatusCode < 300, nil
+}
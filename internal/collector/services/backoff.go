@@ -0,0 +1,101 @@
+package services
+
+import (
+	"errors"
+	"log"
+	"time"
+)
+
+// Collection backoff: a plugin whose Collect keeps failing is retried less
+// often, from the collection interval doubling up to the detection
+// interval, and reported as "unreachable" once unreachableAfter attempts in
+// a row have failed. Its last error is reported in between attempts and
+// logged only when it changes.
+
+const unreachableAfter = 3
+
+type collectBackoff struct {
+	failures int
+	retryAt  time.Time    // no attempt before this
+	last     ServiceStats // reported until retryAt
+}
+
+// backoffDelay is the wait after n consecutive failures.
+func backoffDelay(n int) time.Duration {
+	return min(collectInterval<<min(n-1, 8), detectInterval)
+}
+
+// backingOff returns the stats to report instead of collecting while id
+// waits for its next attempt.
+func (sd *ServiceDetector) backingOff(id string, now time.Time) (ServiceStats, bool) {
+	sd.mu.RLock()
+	defer sd.mu.RUnlock()
+	b := sd.backoff[id]
+	if b == nil || !now.Before(b.retryAt) {
+		return ServiceStats{}, false
+	}
+	return b.last, true
+}
+
+// recordCollect updates a plugin's backoff with the outcome of a collection
+// and returns the stats to report.
+func (sd *ServiceDetector) recordCollect(plugin ServicePlugin, svc *DetectedService, stats *ServiceStats, err error) ServiceStats {
+	id := plugin.ID()
+	if err == nil && stats == nil {
+		err = errors.New("plugin returned no stats")
+	}
+	sd.mu.Lock()
+	defer sd.mu.Unlock()
+
+	if err == nil {
+		if b := sd.backoff[id]; b != nil {
+			log.Printf("services: %s collecting again after %d failed attempt(s)", plugin.Name(), b.failures)
+			delete(sd.backoff, id)
+		}
+		stats.URL = svc.BaseURL
+		return *stats
+	}
+
+	b := sd.backoff[id]
+	if b == nil {
+		b = &collectBackoff{}
+		sd.backoff[id] = b
+	}
+	msg := RedactSecrets(err.Error(), svc.Meta)
+	if msg != b.last.Error {
+		log.Printf("services: %s collection failed: %s", plugin.Name(), msg)
+	}
+	b.failures++
+	b.retryAt = time.Now().Add(backoffDelay(b.failures))
+
+	status, code := StatusError, "collect_failed"
+	if b.failures >= unreachableAfter {
+		status, code = StatusUnreachable, "unreachable"
+		if b.failures == unreachableAfter {
+			log.Printf("services: %s unreachable, retrying every %s", plugin.Name(), backoffDelay(b.failures))
+		}
+	}
+	retryAt := b.retryAt
+	b.last = ServiceStats{
+		PluginID:            id,
+		Name:                plugin.Name(),
+		Icon:                plugin.Icon(),
+		Status:              status,
+		StatusReason:        &StatusReason{Code: code, Message: msg},
+		Summary:             []StatItem{},
+		Stats:               map[string]interface{}{},
+		Error:               msg,
+		URL:                 svc.BaseURL,
+		ConsecutiveFailures: b.failures,
+		RetryAt:             &retryAt,
+	}
+	return b.last
+}
+
+// resetBackoff lets id's next collection run right away, e.g. after its
+// settings changed. Caller holds sd.mu.
+func (sd *ServiceDetector) resetBackoff(id string) {
+	if b := sd.backoff[id]; b != nil {
+		b.retryAt = time.Time{}
+	}
+}
@@ -0,0 +1,269 @@
+//go:build !noplugins
+
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+)
+
+func init() {
+	Register(&CaddyPlugin{})
+}
+
+// CaddyPlugin reads Caddy's running configuration from its admin API. The
+// API only listens on localhost:2019 by default, so for a container that
+// does not publish it the agent queries it from inside the container.
+// "accessLog" adds access log analytics, see accesslog.go.
+type CaddyPlugin struct {
+	logs accessLogs
+}
+
+func (p *CaddyPlugin) ID() string   { return "caddy" }
+func (p *CaddyPlugin) Name() string { return "Caddy" }
+func (p *CaddyPlugin) Icon() string { return "lock.square.stack" }
+
+const caddyAdminPort = 2019
+
+func (p *CaddyPlugin) Detect(ctx context.Context, env *DetectionEnv) *DetectedService {
+	base := &DetectedService{
+		PluginID: p.ID(),
+		Name:     p.Name(),
+		Icon:     p.Icon(),
+		Meta:     make(map[string]string),
+	}
+
+	// Strategy 1: admin API configured by address
+	if url := strings.TrimRight(env.Config(p.ID(), "url"), "/"); url != "" {
+		base.BaseURL = url
+		log.Printf("services: caddy detected via config at %s", url)
+		return base
+	}
+
+	// Strategy 2: Docker container with "caddy" in image name
+	if c := env.FindDockerImage("caddy"); c != nil && c.State == "running" {
+		if url := env.ProbeHTTP(append(c.HostPorts, caddyAdminPort), "/config/"); url != "" {
+			base.BaseURL = url
+			log.Printf("services: caddy detected via docker (%s) at %s", c.Image, url)
+			return base
+		}
+		base.Meta["container"] = c.Name
+		base.Meta["dockerSocket"] = env.DockerSocket
+		log.Printf("services: caddy detected via docker (%s), admin API inside the container", c.Image)
+		return base
+	}
+
+	// Strategy 3: caddy process
+	if env.HasProcess("caddy") {
+		if url := env.ProbeHTTP([]int{caddyAdminPort}, "/config/"); url != "" {
+			base.BaseURL = url
+			log.Printf("services: caddy detected via process at %s", url)
+			return base
+		}
+	}
+
+	return nil
+}
+
+func (p *CaddyPlugin) Collect(ctx context.Context, svc *DetectedService) (*ServiceStats, error) {
+	stats := &ServiceStats{
+		PluginID: p.ID(),
+		Name:     p.Name(),
+		Icon:     p.Icon(),
+		Status:   StatusRunning,
+		Stats:    make(map[string]interface{}),
+	}
+
+	cfg, err := caddyConfig(ctx, svc)
+	if err != nil {
+		return nil, err
+	}
+	routes := caddyRoutes(cfg)
+	hosts := make(map[string]bool)
+	for _, r := range routes {
+		for _, h := range r.Hosts {
+			hosts[h] = true
+		}
+	}
+
+	// Upstream health from the reverse proxy's passive checks
+	var upstreams []caddyUpstream
+	if body, err := caddyAdminGet(ctx, svc, "/reverse_proxy/upstreams"); err == nil {
+		json.Unmarshal(body, &upstreams)
+	}
+	failing := 0
+	upstreamList := make([]map[string]interface{}, 0, len(upstreams))
+	for _, u := range upstreams {
+		if u.Fails > 0 {
+			failing++
+		}
+		upstreamList = append(upstreamList, map[string]interface{}{
+			"address":  u.Address,
+			"requests": u.NumRequests,
+			"fails":    u.Fails,
+		})
+	}
+
+	stats.Summary = []StatItem{
+		{Label: "Sites", Value: FormatNumber(int64(len(hosts))), Type: "number"},
+		{Label: "Routes", Value: FormatNumber(int64(len(routes))), Type: "number"},
+		{Label: "Upstreams", Value: FormatNumber(int64(len(upstreams))), Type: "number"},
+		{Label: "Failing", Value: FormatNumber(int64(failing)), Type: "number"},
+	}
+	stats.Stats = map[string]interface{}{
+		"servers":          len(cfg.Apps.HTTP.Servers),
+		"routes":           len(routes),
+		"hosts":            len(hosts),
+		"upstreams":        upstreamList,
+		"failingUpstreams": failing,
+	}
+	if failing > 0 {
+		stats.degrade("upstreams_failing", fmt.Sprintf("%d upstreams failing", failing))
+	}
+	p.logs.apply(svc, stats)
+
+	return stats, nil
+}
+
+// Routes lists each server's top-level routes with the hosts they match
+// and the reverse_proxy upstreams they hand off to, subroutes included.
+func (p *CaddyPlugin) Routes(ctx context.Context, svc *DetectedService) ([]Route, error) {
+	cfg, err := caddyConfig(ctx, svc)
+	if err != nil {
+		return nil, err
+	}
+	return caddyRoutes(cfg), nil
+}
+
+// caddyAdminGet fetches an admin API path over HTTP, or with wget inside
+// the container when the API is not reachable from the host.
+func caddyAdminGet(ctx context.Context, svc *DetectedService, path string) ([]byte, error) {
+	if svc.BaseURL != "" {
+		body, err := HTTPGet(ctx, svc.BaseURL+path)
+		if err != nil {
+			return nil, fmt.Errorf("could not reach Caddy admin API at %s: %w", svc.BaseURL, err)
+		}
+		return body, nil
+	}
+	url := fmt.Sprintf("http://localhost:%d%s", caddyAdminPort, path)
+	out, err := execInContainer(ctx, svc.Meta["dockerSocket"], svc.Meta["container"], []string{"wget", "-qO-", url})
+	if err != nil {
+		return nil, fmt.Errorf("could not reach Caddy admin API in %s: %w", svc.Meta["container"], err)
+	}
+	return []byte(out), nil
+}
+
+func caddyConfig(ctx context.Context, svc *DetectedService) (*caddyConfigDoc, error) {
+	body, err := caddyAdminGet(ctx, svc, "/config/")
+	if err != nil {
+		return nil, err
+	}
+	var cfg caddyConfigDoc
+	if err := json.Unmarshal(body, &cfg); err != nil {
+		return nil, fmt.Errorf("invalid Caddy config response: %w", err)
+	}
+	return &cfg, nil
+}
+
+func caddyRoutes(cfg *caddyConfigDoc) []Route {
+	names := make([]string, 0, len(cfg.Apps.HTTP.Servers))
+	for name := range cfg.Apps.HTTP.Servers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	routes := []Route{}
+	for _, name := range names {
+		srv := cfg.Apps.HTTP.Servers[name]
+		tls := len(srv.TLSConnectionPolicies) > 0
+		if srv.AutomaticHTTPS == nil || !srv.AutomaticHTTPS.Disable {
+			for _, l := range srv.Listen {
+				if strings.HasSuffix(l, ":443") {
+					tls = true
+				}
+			}
+		}
+		for i, cr := range srv.Routes {
+			r := Route{
+				Name:        fmt.Sprintf("%s#%d", name, i),
+				Hosts:       []string{},
+				EntryPoints: srv.Listen,
+				TLS:         tls,
+				Service:     name,
+				Upstreams:   []string{},
+			}
+			seen := make(map[string]bool)
+			cr.walk(func(route caddyRoute) {
+				for _, m := range route.Match {
+					for _, h := range m.Host {
+						if !seen["host:"+h] {
+							seen["host:"+h] = true
+							r.Hosts = append(r.Hosts, h)
+						}
+					}
+				}
+				for _, h := range route.Handle {
+					for _, u := range h.Upstreams {
+						if u.Dial != "" && !seen[u.Dial] {
+							seen[u.Dial] = true
+							r.Upstreams = append(r.Upstreams, u.Dial)
+						}
+					}
+				}
+			})
+			if len(r.Hosts) > 0 {
+				r.Name = r.Hosts[0]
+			}
+			routes = append(routes, r)
+		}
+	}
+	return routes
+}
+
+// walk visits the route and every route nested in its subroute handlers.
+func (r caddyRoute) walk(fn func(caddyRoute)) {
+	fn(r)
+	for _, h := range r.Handle {
+		for _, sub := range h.Routes {
+			sub.walk(fn)
+		}
+	}
+}
+
+type caddyConfigDoc struct {
+	Apps struct {
+		HTTP struct {
+			Servers map[string]struct {
+				Listen         []string     `json:"listen"`
+				Routes         []caddyRoute `json:"routes"`
+				AutomaticHTTPS *struct {
+					Disable bool `json:"disable"`
+				} `json:"automatic_https"`
+				TLSConnectionPolicies []json.RawMessage `json:"tls_connection_policies"`
+			} `json:"servers"`
+		} `json:"http"`
+	} `json:"apps"`
+}
+
+type caddyRoute struct {
+	Match []struct {
+		Host []string `json:"host"`
+	} `json:"match"`
+	Handle []struct {
+		Handler   string `json:"handler"`
+		Upstreams []struct {
+			Dial string `json:"dial"`
+		} `json:"upstreams"`
+		Routes []caddyRoute `json:"routes"`
+	} `json:"handle"`
+}
+
+type caddyUpstream struct {
+	Address     string `json:"address"`
+	NumRequests int    `json:"num_requests"`
+	Fails       int    `json:"fails"`
+}
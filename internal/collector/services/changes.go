@@ -0,0 +1,104 @@
+package services
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"slices"
+	"time"
+)
+
+// Change detection for the services broadcast. Most cards read the same
+// from one 10s collection to the next, so the broadcast only goes out when
+// a service's stats changed or one came or went. Each changed service lists
+// what changed in changedFields: top-level field names, with stats keys as
+// "stats.<key>". A new service lists all its fields; an unchanged one has
+// none. Uptime percentages drift with every collection, so they don't count
+// as a change and are only refreshed when something else changed. A full
+// snapshot still goes out every servicesResendInterval so stream clients
+// that connected in between catch up.
+
+const servicesResendInterval = time.Minute
+
+// serviceFields is a service's JSON encoding split into fields, with the
+// stats map split into "stats.<key>" entries.
+type serviceFields map[string]json.RawMessage
+
+func splitServiceFields(s ServiceStats) serviceFields {
+	s.ChangedFields, s.Uptime = nil, nil
+	data, err := json.Marshal(s)
+	if err != nil {
+		return nil
+	}
+	var top map[string]json.RawMessage
+	if json.Unmarshal(data, &top) != nil {
+		return nil
+	}
+	fields := make(serviceFields, len(top))
+	for k, v := range top {
+		if k != "stats" {
+			fields[k] = v
+			continue
+		}
+		var stats map[string]json.RawMessage
+		if json.Unmarshal(v, &stats) != nil {
+			fields[k] = v
+			continue
+		}
+		for sk, sv := range stats {
+			fields["stats."+sk] = sv
+		}
+	}
+	return fields
+}
+
+// changedFieldNames lists the fields that differ between prev and cur,
+// sorted; prev is nil for a new service.
+func changedFieldNames(prev, cur serviceFields) []string {
+	var changed []string
+	for k, v := range cur {
+		if old, ok := prev[k]; !ok || !bytes.Equal(old, v) {
+			changed = append(changed, k)
+		}
+	}
+	for k := range prev {
+		if _, ok := cur[k]; !ok {
+			changed = append(changed, k)
+		}
+	}
+	slices.Sort(changed)
+	return changed
+}
+
+// broadcastChanges sends stats to stream subscribers if anything changed
+// since the last broadcast, or the resend interval passed. Only the
+// collection loop calls it.
+func (sd *ServiceDetector) broadcastChanges(stats []ServiceStats) {
+	broadcast := make([]ServiceStats, len(stats))
+	copy(broadcast, stats)
+
+	current := make(map[string]serviceFields, len(broadcast))
+	changed := false
+	for i := range broadcast {
+		s := &broadcast[i]
+		fields := splitServiceFields(*s)
+		current[s.PluginID] = fields
+		s.ChangedFields = changedFieldNames(sd.lastBroadcast[s.PluginID], fields)
+		changed = changed || len(s.ChangedFields) > 0
+	}
+	for id := range sd.lastBroadcast {
+		if _, ok := current[id]; !ok {
+			changed = true // service went away
+		}
+	}
+
+	now := time.Now()
+	if !changed && now.Sub(sd.lastBroadcastAt) < servicesResendInterval {
+		return
+	}
+	slices.SortFunc(broadcast, func(a, b ServiceStats) int {
+		return cmp.Compare(a.PluginID, b.PluginID)
+	})
+	sd.lastBroadcast, sd.lastBroadcastAt = current, now
+	sd.Broadcast.Send(broadcast)
+}
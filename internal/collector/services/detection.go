@@ -0,0 +1,166 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/neur0map/deskmon-agent/internal/config"
+)
+
+// Detection noise control. By default every cycle runs each plugin in turn
+// and probes candidate ports on 127.0.0.1 and localhost. The detection
+// config can spread cycles out with jitter, cap the HTTP probes per cycle,
+// restrict the probed hosts, run plugins concurrently, and in quiet mode
+// skip cycles entirely while nothing on the host has changed.
+
+var defaultProbeHosts = []string{"127.0.0.1", "localhost"}
+
+// quietRefresh bounds how long quiet mode goes without a full cycle, so a
+// service that was still starting when its container appeared is found.
+const quietRefresh = 30 * time.Minute
+
+// SetDetection applies the detection config. Call before Start.
+func (sd *ServiceDetector) SetDetection(cfg config.DetectionConfig) {
+	sd.mu.Lock()
+	defer sd.mu.Unlock()
+	sd.detection = cfg
+}
+
+// nextDetection is the delay until the next detection cycle.
+func (sd *ServiceDetector) nextDetection() time.Duration {
+	sd.mu.RLock()
+	jitter := sd.detection.Jitter
+	sd.mu.RUnlock()
+	if jitter <= 0 {
+		return detectInterval
+	}
+	return detectInterval + rand.N(jitter)
+}
+
+// probeHosts returns the hosts ProbeHTTP tries, in order.
+func (e *DetectionEnv) probeHosts() []string {
+	if len(e.hosts) > 0 {
+		return e.hosts
+	}
+	return defaultProbeHosts
+}
+
+// takeProbe reports whether one more HTTP probe fits in the cycle's
+// budget. When it doesn't, the plugin is marked starved so it goes first
+// next cycle.
+func (e *DetectionEnv) takeProbe() bool {
+	if e.budget == nil || e.budget.Add(-1) >= 0 {
+		return true
+	}
+	e.starved = true
+	return false
+}
+
+// quietSkip reports whether quiet mode lets this cycle skip probing: a
+// full cycle ran within quietRefresh, no service config changed since, and
+// the containers and listening processes are the ones it saw.
+func (sd *ServiceDetector) quietSkip(env *DetectionEnv) bool {
+	sd.mu.RLock()
+	defer sd.mu.RUnlock()
+	return sd.detection.Quiet && !sd.configChanged && len(sd.starved) == 0 &&
+		time.Since(sd.detectedAt) < quietRefresh && sd.fingerprint == hostFingerprint(env)
+}
+
+// hostFingerprint summarizes what detection depends on: the containers
+// and the processes listening on TCP ports. Short-lived processes without
+// ports are left out so they don't trigger a re-probe.
+func hostFingerprint(env *DetectionEnv) string {
+	lines := make([]string, 0, len(env.Containers)+len(env.ProcessPorts))
+	for _, c := range env.Containers {
+		lines = append(lines, fmt.Sprintf("c %s %s %s %v", c.Name, c.Image, c.State, c.HostPorts))
+	}
+	for name, ports := range env.ProcessPorts {
+		ports = slices.Clone(ports)
+		slices.Sort(ports)
+		lines = append(lines, fmt.Sprintf("p %s %v", name, ports))
+	}
+	slices.Sort(lines)
+	return strings.Join(lines, "\n")
+}
+
+// detectAll runs Detect for every plugin under the detection config and
+// returns what was found, which plugins ran out of probe budget and which
+// failed by panicking or timing out. Starved plugins from the last cycle go
+// first. Each plugin gets detectTimeout of
+// its own, so a slow one doesn't eat into the others' time.
+func (sd *ServiceDetector) detectAll(plugins []ServicePlugin, env *DetectionEnv) (detected map[string]*DetectedService, starved, failed map[string]bool) {
+	sd.mu.RLock()
+	cfg := sd.detection
+	lastStarved := sd.starved
+	sd.mu.RUnlock()
+
+	env.hosts = cfg.Hosts
+	if cfg.ProbeBudget > 0 {
+		env.budget = new(atomic.Int64)
+		env.budget.Store(int64(cfg.ProbeBudget))
+	}
+	plugins = slices.Clone(plugins)
+	slices.SortStableFunc(plugins, func(a, b ServicePlugin) int {
+		switch sa, sb := lastStarved[a.ID()], lastStarved[b.ID()]; {
+		case sa && !sb:
+			return -1
+		case sb && !sa:
+			return 1
+		}
+		return 0
+	})
+
+	var mu sync.Mutex
+	detected = make(map[string]*DetectedService)
+	starved = make(map[string]bool)
+	failed = make(map[string]bool)
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, max(cfg.Concurrency, 1))
+	for _, p := range plugins {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			// penv is only read through the result: an abandoned call may
+			// still be using it.
+			type outcome struct {
+				svc     *DetectedService
+				starved bool
+			}
+			res, err := isolate(sd, p.ID(), phaseDetect, detectTimeout, func(ctx context.Context) (outcome, error) {
+				penv := *env
+				penv.starved = false
+				svc := p.Detect(ctx, &penv)
+				return outcome{svc, penv.starved}, nil
+			})
+
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err != nil:
+				log.Printf("services: plugin %s detection failed: %v", p.ID(), err)
+				failed[p.ID()] = true
+			case res.svc != nil:
+				detected[p.ID()] = res.svc
+			case res.starved:
+				starved[p.ID()] = true
+			default:
+				log.Printf("services: plugin %s did not detect a service", p.ID())
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(starved) > 0 {
+		log.Printf("services: probe budget of %d used up, %d plugin(s) left for the next cycle", cfg.ProbeBudget, len(starved))
+	}
+	return detected, starved, failed
+}
@@ -2,19 +2,23 @@ package services
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"maps"
 	"sort"
 	"sync"
 	"time"
 
 	"github.com/neur0map/deskmon-agent/internal/collector"
+	"github.com/neur0map/deskmon-agent/internal/config"
 )
 
 const (
 	detectInterval  = 30 * time.Second
 	collectInterval = 10 * time.Second
 	collectTimeout  = 8 * time.Second
+	releaseTimeout  = 5 * time.Second
 )
 
 // ServiceDetector runs service detection and stats collection in the background.
@@ -22,12 +26,40 @@ type ServiceDetector struct {
 	mu             sync.RWMutex
 	detected       map[string]*DetectedService
 	cachedStats    []ServiceStats
+	collectedAt    time.Time
 	serviceConfigs map[string]map[string]string // pluginID → key → value
 	dockerSocket   string
 	stopCh         chan struct{}
 
+	// Set by the memory guard to skip detection and collection.
+	collector.Pauser
+
+	// Set by DisableDocker to detect host processes only.
+	noDocker bool
+
+	// Detection noise control, see detection.go
+	detection     config.DetectionConfig
+	starved       map[string]bool // plugins the last cycle's probe budget didn't cover
+	fingerprint   string          // containers and listening processes at the last full cycle
+	detectedAt    time.Time       // end of the last full cycle
+	configChanged bool            // a service setting changed since the last full cycle
+
+	// Plugins whose collection is failing, see backoff.go
+	backoff map[string]*collectBackoff
+
+	// Per-plugin call counters and in-flight calls, see isolation.go
+	runtimeMu sync.Mutex
+	runtime   map[string]*pluginRuntime
+
 	// SSE broadcast
 	Broadcast *collector.Broadcaster[[]ServiceStats]
+
+	// Last broadcast snapshot, see changes.go
+	lastBroadcast   map[string]serviceFields
+	lastBroadcastAt time.Time
+
+	// Per-plugin up/down history, see uptime.go
+	uptime map[string]*uptimeTracker
 }
 
 // NewServiceDetector creates a detector that will use the given Docker socket
@@ -36,12 +68,21 @@ func NewServiceDetector(dockerSocket string) *ServiceDetector {
 	return &ServiceDetector{
 		detected:       make(map[string]*DetectedService),
 		serviceConfigs: make(map[string]map[string]string),
+		backoff:        make(map[string]*collectBackoff),
+		runtime:        make(map[string]*pluginRuntime),
+		uptime:         make(map[string]*uptimeTracker),
 		dockerSocket:   dockerSocket,
 		stopCh:         make(chan struct{}),
 		Broadcast:      collector.NewBroadcaster[[]ServiceStats](),
 	}
 }
 
+// DisableDocker stops container-based detection, for hosts where the Docker
+// collector is switched off. Call before Start.
+func (sd *ServiceDetector) DisableDocker() {
+	sd.noDocker = true
+}
+
 // SetServiceConfig stores a configuration key/value for a plugin.
 // The value is injected into the DetectedService.Meta during detection.
 func (sd *ServiceDetector) SetServiceConfig(pluginID, key, value string) {
@@ -52,6 +93,8 @@ func (sd *ServiceDetector) SetServiceConfig(pluginID, key, value string) {
 		sd.serviceConfigs[pluginID] = make(map[string]string)
 	}
 	sd.serviceConfigs[pluginID][key] = value
+	sd.configChanged = true
+	sd.resetBackoff(pluginID)
 
 	// Also inject into already-detected service so the next collection picks it up
 	if svc, ok := sd.detected[pluginID]; ok {
@@ -72,18 +115,23 @@ func (sd *ServiceDetector) Start() {
 		sd.runDetection()
 		sd.runCollection()
 
-		detectTicker := time.NewTicker(detectInterval)
+		detectTimer := time.NewTimer(sd.nextDetection())
 		collectTicker := time.NewTicker(collectInterval)
-		defer detectTicker.Stop()
+		defer detectTimer.Stop()
 		defer collectTicker.Stop()
 
 		for {
 			select {
-			case <-detectTicker.C:
-				sd.runDetection()
-				sd.runCollection()
+			case <-detectTimer.C:
+				if !sd.Paused() {
+					sd.runDetection()
+					sd.runCollection()
+				}
+				detectTimer.Reset(sd.nextDetection())
 			case <-collectTicker.C:
-				sd.runCollection()
+				if !sd.Paused() {
+					sd.runCollection()
+				}
 			case <-sd.stopCh:
 				return
 			}
@@ -91,9 +139,20 @@ func (sd *ServiceDetector) Start() {
 	}()
 }
 
-// Stop terminates the background loops.
+// Stop terminates the background loops and releases what plugins hold on
+// the detected services.
 func (sd *ServiceDetector) Stop() {
 	close(sd.stopCh)
+
+	sd.mu.RLock()
+	detected := make([]*DetectedService, 0, len(sd.detected))
+	for _, svc := range sd.detected {
+		detected = append(detected, svc)
+	}
+	sd.mu.RUnlock()
+	ctx, cancel := context.WithTimeout(context.Background(), releaseTimeout)
+	defer cancel()
+	sd.release(ctx, detected)
 }
 
 // DebugInfo returns a snapshot of the detection environment for diagnostics.
@@ -104,10 +163,12 @@ type DebugSnapshot struct {
 	ProcessPorts map[string][]int    `json:"processPorts"`
 	Detected     map[string]string   `json:"detected"` // pluginID → baseURL
 	Stats        []ServiceStats      `json:"stats"`
+
+	PluginMetrics map[string]PluginMetrics `json:"pluginMetrics"`
 }
 
 func (sd *ServiceDetector) DebugInfo() DebugSnapshot {
-	env := BuildDetectionEnv(sd.dockerSocket)
+	env := buildDetectionEnv(sd.dockerSocket, !sd.noDocker)
 
 	plugins := RegisteredPlugins()
 	pluginNames := make([]string, len(plugins))
@@ -137,6 +198,8 @@ func (sd *ServiceDetector) DebugInfo() DebugSnapshot {
 		ProcessPorts: env.ProcessPorts,
 		Detected:     detected,
 		Stats:        stats,
+
+		PluginMetrics: sd.PluginMetrics(),
 	}
 }
 
@@ -156,13 +219,75 @@ func (sd *ServiceDetector) PerformAction(ctx context.Context, pluginID, action s
 			if !ok {
 				return "", fmt.Errorf("service %s does not support actions", pluginID)
 			}
-			return ap.PerformAction(ctx, svc, action, params)
+			ctx, err := withServiceTLS(ctx, svc.Meta)
+			if err != nil {
+				return "", err
+			}
+			result, err := ap.PerformAction(ctx, svc, action, params)
+			if err != nil {
+				return result, errors.New(RedactSecrets(err.Error(), svc.Meta))
+			}
+			return result, nil
 		}
 	}
 
 	return "", fmt.Errorf("plugin %s not found", pluginID)
 }
 
+// IsDestructiveAction reports whether the plugin pluginID marks action with
+// params as destructive.
+func (sd *ServiceDetector) IsDestructiveAction(pluginID, action string, params map[string]interface{}) bool {
+	for _, p := range RegisteredPlugins() {
+		if p.ID() == pluginID {
+			dp, ok := p.(DestructiveActionPlugin)
+			return ok && dp.DestructiveAction(action, params)
+		}
+	}
+	return false
+}
+
+// Routes lists the routes of every detected reverse proxy, sorted by
+// proxy. A proxy whose routes can't be read carries the error instead.
+func (sd *ServiceDetector) Routes(ctx context.Context) []ProxyRoutes {
+	sd.mu.RLock()
+	detected := make(map[string]DetectedService, len(sd.detected))
+	for id, svc := range sd.detected {
+		detected[id] = *svc
+	}
+	sd.mu.RUnlock()
+
+	result := []ProxyRoutes{}
+	for _, p := range RegisteredPlugins() {
+		rp, ok := p.(ServiceRoutePlugin)
+		svc, found := detected[p.ID()]
+		if !ok || !found {
+			continue
+		}
+		entry := ProxyRoutes{Proxy: p.ID(), Name: svc.Name, Routes: []Route{}}
+		tlsCtx, err := withServiceTLS(ctx, svc.Meta)
+		var routes []Route
+		if err == nil {
+			routes, err = rp.Routes(tlsCtx, &svc)
+		}
+		if err != nil {
+			entry.Error = RedactSecrets(err.Error(), svc.Meta)
+		} else if routes != nil {
+			entry.Routes = routes
+		}
+		result = append(result, entry)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Proxy < result[j].Proxy })
+	return result
+}
+
+// SampleInfo reports when service stats were last collected. Per-plugin
+// failures are reported on each ServiceStats entry instead.
+func (sd *ServiceDetector) SampleInfo() collector.SampleInfo {
+	sd.mu.RLock()
+	defer sd.mu.RUnlock()
+	return collector.NewSampleInfo(sd.collectedAt, collectInterval, "")
+}
+
 // Collect returns the latest cached service stats.
 func (sd *ServiceDetector) Collect() []ServiceStats {
 	sd.mu.RLock()
@@ -185,26 +310,29 @@ func (sd *ServiceDetector) runDetection() {
 		return
 	}
 
+	env := buildDetectionEnv(sd.dockerSocket, !sd.noDocker)
+	if sd.quietSkip(env) {
+		return
+	}
 	log.Printf("services: running detection with %d plugins", len(plugins))
-	env := BuildDetectionEnv(sd.dockerSocket)
-
-	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
-	defer cancel()
+	sd.mu.Lock()
+	env.Configs = make(map[string]map[string]string, len(sd.serviceConfigs))
+	for id, cfg := range sd.serviceConfigs {
+		env.Configs[id] = maps.Clone(cfg)
+	}
+	sd.configChanged = false
+	sd.mu.Unlock()
 
 	// Run detection without holding the lock (network I/O happens here)
-	newDetected := make(map[string]*DetectedService)
-	for _, p := range plugins {
-		svc := p.Detect(ctx, env)
-		if svc != nil {
-			newDetected[p.ID()] = svc
-		} else {
-			log.Printf("services: plugin %s did not detect a service", p.ID())
-		}
-	}
+	newDetected, starved, failed := sd.detectAll(plugins, env)
 
-	// Brief lock to merge results
+	// Brief lock to merge results. Instances that went away are released
+	// after it.
+	var gone []*DetectedService
 	sd.mu.Lock()
-	defer sd.mu.Unlock()
+	sd.starved = starved
+	sd.fingerprint = hostFingerprint(env)
+	sd.detectedAt = time.Now()
 
 	seen := make(map[string]bool, len(newDetected))
 	for id, svc := range newDetected {
@@ -222,14 +350,43 @@ func (sd *ServiceDetector) runDetection() {
 		if prev, exists := sd.detected[id]; exists && svc.Version == "" {
 			svc.Version = prev.Version
 		}
+		if prev, exists := sd.detected[id]; exists && prev.BaseURL != svc.BaseURL {
+			gone = append(gone, prev)
+		}
 		sd.detected[id] = svc
 	}
 
-	// Remove services that are no longer detected
+	// Remove services that are no longer detected. Plugins the probe
+	// budget didn't reach, or whose Detect panicked or timed out, keep
+	// their last result until they run cleanly.
 	for id, svc := range sd.detected {
-		if !seen[id] {
+		if !seen[id] && !starved[id] && !failed[id] {
 			log.Printf("services: %s no longer detected", svc.Name)
 			delete(sd.detected, id)
+			delete(sd.backoff, id)
+			gone = append(gone, svc)
+		}
+	}
+	sd.mu.Unlock()
+
+	if len(gone) > 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), releaseTimeout)
+		defer cancel()
+		sd.release(ctx, gone)
+	}
+}
+
+// release hands each service to its plugin's Release, if it has one.
+func (sd *ServiceDetector) release(ctx context.Context, svcs []*DetectedService) {
+	plugins := make(map[string]ServicePlugin)
+	for _, p := range RegisteredPlugins() {
+		plugins[p.ID()] = p
+	}
+	for _, svc := range svcs {
+		if rp, ok := plugins[svc.PluginID].(ServiceReleasePlugin); ok {
+			// A broken tlsCa was already reported by collection.
+			tlsCtx, _ := withServiceTLS(ctx, svc.Meta)
+			rp.Release(tlsCtx, svc)
 		}
 	}
 }
@@ -246,7 +403,9 @@ func (sd *ServiceDetector) runCollection() {
 	if len(detected) == 0 {
 		sd.mu.Lock()
 		sd.cachedStats = []ServiceStats{}
+		sd.collectedAt = time.Now()
 		sd.mu.Unlock()
+		sd.broadcastChanges(nil)
 		return
 	}
 
@@ -263,36 +422,29 @@ func (sd *ServiceDetector) runCollection() {
 	results := make(chan result, len(detected))
 
 	var wg sync.WaitGroup
+	now := time.Now()
 	for id, svc := range detected {
 		p, ok := pluginMap[id]
 		if !ok {
 			continue
 		}
+		if last, ok := sd.backingOff(id, now); ok {
+			results <- result{stats: last}
+			continue
+		}
 
 		wg.Add(1)
 		go func(plugin ServicePlugin, service *DetectedService) {
 			defer wg.Done()
 
-			ctx, cancel := context.WithTimeout(context.Background(), collectTimeout)
-			defer cancel()
-
-			stats, err := plugin.Collect(ctx, service)
-			if err != nil {
-				results <- result{stats: ServiceStats{
-					PluginID: plugin.ID(),
-					Name:     plugin.Name(),
-					Icon:     plugin.Icon(),
-					Status:   "error",
-					Summary:  []StatItem{},
-					Stats:    map[string]interface{}{},
-					Error:    err.Error(),
-					URL:      service.BaseURL,
-				}}
-				return
-			}
-
-			stats.URL = service.BaseURL
-			results <- result{stats: *stats}
+			stats, err := isolate(sd, plugin.ID(), phaseCollect, collectTimeout, func(ctx context.Context) (*ServiceStats, error) {
+				ctx, err := withServiceTLS(ctx, service.Meta)
+				if err != nil {
+					return nil, err
+				}
+				return plugin.Collect(ctx, service)
+			})
+			results <- result{stats: sd.recordCollect(plugin, service, stats, err)}
 		}(p, svc)
 	}
 
@@ -309,13 +461,13 @@ func (sd *ServiceDetector) runCollection() {
 	if stats == nil {
 		stats = []ServiceStats{}
 	}
+	sd.trackUptime(time.Now(), stats)
 
 	sd.mu.Lock()
 	sd.cachedStats = stats
+	sd.collectedAt = time.Now()
 	sd.mu.Unlock()
 
-	// Broadcast to SSE subscribers
-	broadcast := make([]ServiceStats, len(stats))
-	copy(broadcast, stats)
-	sd.Broadcast.Send(broadcast)
+	// Broadcast to SSE subscribers when something changed
+	sd.broadcastChanges(stats)
 }
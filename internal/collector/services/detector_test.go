@@ -0,0 +1,108 @@
+//go:build !noplugins
+
+package services
+
+import (
+	"log"
+	"os"
+	"testing"
+
+	"github.com/neur0map/deskmon-agent/internal/config"
+	"github.com/neur0map/deskmon-agent/internal/fakehost"
+)
+
+// host is the fake host every test in this package reads, see
+// internal/fakehost.
+var host *fakehost.Host
+
+func TestMain(m *testing.M) {
+	var err error
+	if host, err = fakehost.Install(); err != nil {
+		log.Fatal(err)
+	}
+	code := m.Run()
+	host.Close()
+	os.Exit(code)
+}
+
+// newTestDetector returns a detector that probes 127.0.0.1 only, so
+// plugins don't wait on localhost for ports nothing listens on.
+func newTestDetector(dockerHost string) *ServiceDetector {
+	sd := NewServiceDetector(dockerHost)
+	if dockerHost == "" {
+		sd.DisableDocker()
+	}
+	sd.SetDetection(config.DetectionConfig{Hosts: []string{"127.0.0.1"}, Concurrency: 8})
+	return sd
+}
+
+// addProcess adds p to the fake host for the rest of the test.
+func addProcess(t *testing.T, p fakehost.Process) {
+	t.Helper()
+	if err := host.AddProcess(p); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { host.RemoveProcess(p.PID) })
+}
+
+// detectAndCollect runs a detection and a collection cycle and returns the
+// stats by plugin ID.
+func detectAndCollect(sd *ServiceDetector) map[string]ServiceStats {
+	sd.runDetection()
+	sd.runCollection()
+	byID := make(map[string]ServiceStats)
+	for _, s := range sd.Collect() {
+		byID[s.PluginID] = s
+	}
+	return byID
+}
+
+func TestDetectsServicesByListeningProcess(t *testing.T) {
+	traefik, nginx, pihole := fakehost.Traefik(), fakehost.NginxStubStatus(), fakehost.PiHoleV5()
+	defer traefik.Close()
+	defer nginx.Close()
+	defer pihole.Close()
+	addProcess(t, fakehost.Process{PID: 2001, Name: "traefik", Ports: []int{fakehost.Port(traefik)}})
+	addProcess(t, fakehost.Process{PID: 2002, Name: "nginx", UID: 33, Ports: []int{fakehost.Port(nginx)}})
+	addProcess(t, fakehost.Process{PID: 2003, Name: "pihole-FTL", UID: 999, Ports: []int{53, fakehost.Port(pihole)}})
+
+	stats := detectAndCollect(newTestDetector(""))
+
+	tr := stats["traefik"]
+	if tr.Status != StatusRunning || tr.Stats["totalRouters"] != 7 || tr.Stats["entrypoints"] != int64(3) {
+		t.Errorf("traefik = %+v, want running with 7 routers and 3 entrypoints", tr)
+	}
+	ng := stats["nginx"]
+	if ng.Status != StatusRunning || ng.Stats["activeConnections"] != int64(291) || ng.Stats["requests"] != int64(31070465) {
+		t.Errorf("nginx = %+v, want running with 291 connections", ng)
+	}
+	ph := stats["pihole"]
+	if ph.Status != StatusRunning || ph.Stats["version"] != "v5" || ph.Stats["queriesToday"] != int64(24680) {
+		t.Errorf("pihole = %+v, want v5 running with 24,680 queries", ph)
+	}
+}
+
+func TestPiHoleV6Password(t *testing.T) {
+	srv := fakehost.PiHoleV6("correct horse")
+	defer srv.Close()
+	addProcess(t, fakehost.Process{PID: 2101, Name: "pihole-FTL", UID: 999, Ports: []int{fakehost.Port(srv)}})
+
+	sd := newTestDetector("")
+	stats := detectAndCollect(sd)
+	if ph := stats["pihole"]; ph.Status != StatusAuthRequired || ph.StatusReason == nil || ph.StatusReason.Code != "credentials_missing" {
+		t.Errorf("without a password pihole = %+v, want credentials_missing", ph)
+	}
+
+	sd.SetServiceConfig("pihole", "password", "battery staple")
+	sd.runCollection()
+	if ph := sd.Collect()[0]; ph.Status != StatusAuthRequired || ph.StatusReason == nil || ph.StatusReason.Code != "credentials_rejected" {
+		t.Errorf("with a wrong password pihole = %+v, want credentials_rejected", ph)
+	}
+
+	sd.SetServiceConfig("pihole", "password", "correct horse")
+	sd.runCollection()
+	ph := sd.Collect()[0]
+	if ph.Status != StatusRunning || ph.Stats["version"] != "v6" || ph.Stats["queriesToday"] != int64(30000) || ph.Stats["adsPercentToday"] != 15.0 {
+		t.Errorf("with the password pihole = %+v, want v6 running with 30,000 queries, 15%% blocked", ph)
+	}
+}
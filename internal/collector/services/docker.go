@@ -0,0 +1,109 @@
+//go:build !nodocker
+
+package services
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/pkg/stdcopy"
+
+	"github.com/neur0map/deskmon-agent/internal/collector"
+)
+
+// listDockerContainers does a lightweight container list (no stats).
+func listDockerContainers(socketPath string) []ContainerInfo {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cli, err := collector.NewDockerClient(socketPath)
+	if err != nil {
+		log.Printf("services: docker client init error: %v", err)
+		return nil
+	}
+	defer cli.Close()
+
+	containers, err := cli.ContainerList(ctx, container.ListOptions{All: true})
+	if err != nil {
+		log.Printf("services: docker list error: %v", err)
+		return nil
+	}
+
+	result := make([]ContainerInfo, 0, len(containers))
+	for _, c := range containers {
+		var hostPorts []int
+		for _, p := range c.Ports {
+			if p.PublicPort > 0 {
+				hostPorts = append(hostPorts, int(p.PublicPort))
+			}
+		}
+
+		name := ""
+		if len(c.Names) > 0 {
+			name = strings.TrimPrefix(c.Names[0], "/")
+		}
+
+		var mounts map[string]string
+		for _, m := range c.Mounts {
+			if m.Source == "" {
+				continue
+			}
+			if mounts == nil {
+				mounts = make(map[string]string)
+			}
+			mounts[m.Destination] = m.Source
+		}
+
+		result = append(result, ContainerInfo{
+			Name:      name,
+			Image:     c.Image,
+			State:     c.State,
+			HostPorts: hostPorts,
+			Mounts:    mounts,
+		})
+	}
+	return result
+}
+
+// execInContainer runs cmd inside the named container and returns its
+// combined output. A non-zero exit status is an error carrying the output.
+func execInContainer(ctx context.Context, socketPath, name string, cmd []string) (string, error) {
+	cli, err := collector.NewDockerClient(socketPath)
+	if err != nil {
+		return "", err
+	}
+	defer cli.Close()
+
+	created, err := cli.ContainerExecCreate(ctx, name, container.ExecOptions{
+		Cmd:          cmd,
+		AttachStdout: true,
+		AttachStderr: true,
+	})
+	if err != nil {
+		return "", fmt.Errorf("create exec: %w", err)
+	}
+	attach, err := cli.ContainerExecAttach(ctx, created.ID, container.ExecAttachOptions{})
+	if err != nil {
+		return "", fmt.Errorf("attach exec: %w", err)
+	}
+	defer attach.Close()
+
+	var out bytes.Buffer
+	if _, err := stdcopy.StdCopy(&out, &out, attach.Reader); err != nil {
+		return "", fmt.Errorf("read exec output: %w", err)
+	}
+	inspect, err := cli.ContainerExecInspect(ctx, created.ID)
+	if err != nil {
+		return "", fmt.Errorf("inspect exec: %w", err)
+	}
+	output := strings.TrimSpace(out.String())
+	if inspect.ExitCode != 0 {
+		return output, fmt.Errorf("%s exited with status %d: %s", cmd[0], inspect.ExitCode, output)
+	}
+	return output, nil
+}
@@ -0,0 +1,18 @@
+//go:build nodocker
+
+package services
+
+import (
+	"context"
+	"errors"
+)
+
+// listDockerContainers finds nothing in builds without the Docker client;
+// detection falls back to processes and ports.
+func listDockerContainers(socketPath string) []ContainerInfo {
+	return nil
+}
+
+func execInContainer(ctx context.Context, socketPath, name string, cmd []string) (string, error) {
+	return "", errors.New("built without Docker support")
+}
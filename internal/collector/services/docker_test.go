@@ -0,0 +1,28 @@
+//go:build !nodocker && !noplugins
+
+package services
+
+import (
+	"testing"
+
+	"github.com/neur0map/deskmon-agent/internal/fakehost"
+)
+
+func TestDetectsServicesInContainers(t *testing.T) {
+	pihole := fakehost.PiHoleV6("")
+	defer pihole.Close()
+	d := fakehost.NewDocker(fakehost.DockerOptions{},
+		fakehost.Container{Name: "pihole", Image: "pihole/pihole:2025.03.0", Ports: map[int]int{fakehost.Port(pihole): 80}},
+		fakehost.Container{Name: "proxy", Image: "traefik:v3.3", State: "exited"},
+	)
+	defer d.Close()
+
+	stats := detectAndCollect(newTestDetector(d.Host))
+	ph, ok := stats["pihole"]
+	if !ok || ph.Status != StatusRunning || ph.Stats["version"] != "v6" || ph.Stats["queriesToday"] != int64(30000) {
+		t.Errorf("pihole = %+v, want v6 running with 30,000 queries, found through its published port", ph)
+	}
+	if tr, ok := stats["traefik"]; ok {
+		t.Errorf("traefik = %+v, want nothing for a stopped container", tr)
+	}
+}
@@ -0,0 +1,462 @@
+//go:build !noplugins
+
+package services
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+func init() {
+	Register(&RegistryPlugin{})
+}
+
+// RegistryPlugin reports repository count, storage usage and blobs that
+// garbage collection would free for a self-hosted Docker registry
+// (registry:2 / CNCF distribution). Storage is read from the registry's
+// data directory on the host: the container's /var/lib/registry mount, or
+// "dataDir" when configured. A registry behind htpasswd auth needs
+// "username" and "password".
+type RegistryPlugin struct {
+	mu       sync.Mutex
+	usage    *registryUsage
+	scanDir  string
+	scanning bool
+}
+
+func (p *RegistryPlugin) ID() string   { return "registry" }
+func (p *RegistryPlugin) Name() string { return "Docker Registry" }
+func (p *RegistryPlugin) Icon() string { return "shippingbox" }
+
+const (
+	registryDefaultPort = 5000
+	registryDataPath    = "/var/lib/registry" // storage root inside the official image
+	registryConfigPath  = "/etc/docker/registry/config.yml"
+
+	// Walking blob storage reads every manifest, so it runs in the
+	// background and is repeated at most this often.
+	registryScanInterval = 10 * time.Minute
+	registryCatalogPages = 100
+)
+
+func (p *RegistryPlugin) Detect(ctx context.Context, env *DetectionEnv) *DetectedService {
+	base := &DetectedService{
+		PluginID: p.ID(),
+		Name:     p.Name(),
+		Icon:     p.Icon(),
+		Meta:     make(map[string]string),
+	}
+
+	// Strategy 1: registry:2 or distribution container.
+	for _, c := range env.Containers {
+		if c.State != "running" || !isRegistryImage(c.Image) {
+			continue
+		}
+		ports := append(c.HostPorts, registryDefaultPort)
+		// "/" answers 200 even when /v2/ requires auth.
+		if url := env.ProbeHTTP(ports, "/"); url != "" {
+			base.BaseURL = url
+			base.Meta["container"] = c.Name
+			base.Meta["dockerSocket"] = env.DockerSocket
+			if dir := c.Mounts[registryDataPath]; dir != "" {
+				base.Meta["dataDir"] = dir
+			}
+			log.Printf("services: registry detected via docker (%s) at %s", c.Image, url)
+			return base
+		}
+	}
+
+	// Strategy 2: the registry binary running on the host.
+	if env.HasProcess("registry") {
+		ports := append(env.FindProcessPorts("registry"), registryDefaultPort)
+		if url := env.ProbeHTTP(ports, "/v2/"); url != "" {
+			base.BaseURL = url
+			base.Meta["dataDir"] = registryDataPath
+			log.Printf("services: registry detected via process at %s", url)
+			return base
+		}
+	}
+
+	return nil
+}
+
+// isRegistryImage matches the official image ("registry:2",
+// "docker.io/library/registry") and distribution builds, but not images
+// merely hosted on a registry ("registry.gitlab.com/...").
+func isRegistryImage(image string) bool {
+	name, _, _ := strings.Cut(image, "@")
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		name = name[:i]
+	}
+	switch path.Base(name) {
+	case "registry", "distribution":
+		return true
+	}
+	return false
+}
+
+// --- Collection ---
+
+// registryUsage is the result of one walk over blob storage.
+type registryUsage struct {
+	StorageBytes int64
+	Blobs        int
+	GCBlobs      int
+	GCBytes      int64
+	MeasuredAt   time.Time
+}
+
+func (p *RegistryPlugin) Collect(ctx context.Context, svc *DetectedService) (*ServiceStats, error) {
+	stats := &ServiceStats{
+		PluginID: p.ID(),
+		Name:     p.Name(),
+		Icon:     p.Icon(),
+		Status:   StatusRunning,
+		Stats:    make(map[string]interface{}),
+	}
+
+	repos, err := registryCatalog(ctx, svc)
+	if errors.Is(err, errRegistryUnauthorized) && svc.Meta["username"] == "" {
+		stats.setStatus(StatusAuthRequired, "credentials_missing", "set username and password for the registry")
+		stats.Summary = []StatItem{
+			{Label: "Status", Value: "Running", Type: "status"},
+		}
+		stats.Stats = map[string]interface{}{
+			"authRequired": true,
+		}
+		return stats, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not reach registry at %s: %w", svc.BaseURL, err)
+	}
+
+	usage := p.storageUsage(svc.Meta["dataDir"])
+
+	stats.Summary = []StatItem{
+		{Label: "Repositories", Value: FormatNumber(int64(repos)), Type: "number"},
+	}
+	stats.Stats = map[string]interface{}{
+		"repositories":     repos,
+		"storageAvailable": usage != nil,
+	}
+	if usage != nil {
+		stats.Summary = append(stats.Summary,
+			StatItem{Label: "Storage", Value: formatBytes(usage.StorageBytes), Type: "text"},
+			StatItem{Label: "Reclaimable", Value: formatBytes(usage.GCBytes), Type: "text"},
+		)
+		stats.Stats["storageBytes"] = usage.StorageBytes
+		stats.Stats["blobs"] = usage.Blobs
+		stats.Stats["gcBlobs"] = usage.GCBlobs
+		stats.Stats["gcBytes"] = usage.GCBytes
+		stats.Stats["measuredAt"] = usage.MeasuredAt
+	}
+
+	return stats, nil
+}
+
+// storageUsage returns the last scan of dataDir, starting a new one in the
+// background when it is missing or older than registryScanInterval.
+func (p *RegistryPlugin) storageUsage(dataDir string) *registryUsage {
+	if dataDir == "" {
+		return nil
+	}
+	root := filepath.Join(HostPath(dataDir), "docker", "registry", "v2")
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.scanDir != root {
+		p.scanDir, p.usage = root, nil
+	}
+	stale := p.usage == nil || time.Since(p.usage.MeasuredAt) >= registryScanInterval
+	if stale && !p.scanning {
+		p.scanning = true
+		go func() {
+			usage, err := scanRegistryStorage(root)
+			if err != nil {
+				log.Printf("services: registry storage scan: %v", err)
+			}
+			p.mu.Lock()
+			defer p.mu.Unlock()
+			p.scanning = false
+			if err == nil && p.scanDir == root {
+				p.usage = usage
+			}
+		}()
+	}
+	return p.usage
+}
+
+// invalidateUsage forces a rescan on the next collection.
+func (p *RegistryPlugin) invalidateUsage() {
+	p.mu.Lock()
+	p.usage = nil
+	p.mu.Unlock()
+}
+
+// scanRegistryStorage walks the filesystem driver's layout
+// (docker/registry/v2/{blobs,repositories}) and marks blobs the way
+// "registry garbage-collect" does: every manifest revision of every
+// repository and the config, layers and child manifests it references.
+// Unmarked blobs are what GC would delete.
+func scanRegistryStorage(root string) (*registryUsage, error) {
+	if _, err := os.Stat(root); err != nil {
+		return nil, err
+	}
+	usage := &registryUsage{}
+	blobs := make(map[string]int64) // digest → size
+	err := filepath.WalkDir(filepath.Join(root, "blobs"), func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() || d.Name() != "data" {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		// blobs/sha256/ab/abcdef.../data
+		hexDir := filepath.Dir(p)
+		algo := filepath.Base(filepath.Dir(filepath.Dir(hexDir)))
+		blobs[algo+":"+filepath.Base(hexDir)] = info.Size()
+		usage.StorageBytes += info.Size()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	usage.Blobs = len(blobs)
+
+	marked := make(map[string]bool)
+	var queue []string
+	err = filepath.WalkDir(filepath.Join(root, "repositories"), func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		// repositories/<name>/_manifests/revisions/sha256/<hex>/link
+		if d.IsDir() || d.Name() != "link" {
+			return nil
+		}
+		hexDir := filepath.Dir(p)
+		algoDir := filepath.Dir(hexDir)
+		if filepath.Base(filepath.Dir(algoDir)) != "revisions" {
+			return nil
+		}
+		queue = append(queue, filepath.Base(algoDir)+":"+filepath.Base(hexDir))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for len(queue) > 0 {
+		digest := queue[0]
+		queue = queue[1:]
+		if marked[digest] {
+			continue
+		}
+		marked[digest] = true
+		queue = append(queue, manifestReferences(root, digest)...)
+	}
+
+	for digest, size := range blobs {
+		if !marked[digest] {
+			usage.GCBlobs++
+			usage.GCBytes += size
+		}
+	}
+	usage.MeasuredAt = time.Now()
+	return usage, nil
+}
+
+// manifestReferences returns the digests a manifest or index references.
+// Layers and configs aren't manifests and yield nothing.
+func manifestReferences(root, digest string) []string {
+	algo, hex, ok := strings.Cut(digest, ":")
+	if !ok || len(hex) < 2 {
+		return nil
+	}
+	f, err := os.Open(filepath.Join(root, "blobs", algo, hex[:2], hex, "data"))
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	// Manifests are small; anything large is a layer.
+	data, err := io.ReadAll(io.LimitReader(f, 4<<20))
+	if err != nil || len(data) == 0 || data[0] != '{' {
+		return nil
+	}
+	type descriptor struct {
+		Digest string `json:"digest"`
+	}
+	var m struct {
+		Config    *descriptor  `json:"config"`
+		Layers    []descriptor `json:"layers"`
+		Manifests []descriptor `json:"manifests"`
+		Blobs     []descriptor `json:"blobs"`
+		FSLayers  []struct {
+			BlobSum string `json:"blobSum"`
+		} `json:"fsLayers"` // schema 1
+	}
+	if json.Unmarshal(data, &m) != nil {
+		return nil
+	}
+
+	var refs []string
+	if m.Config != nil && m.Config.Digest != "" {
+		refs = append(refs, m.Config.Digest)
+	}
+	for _, list := range [][]descriptor{m.Layers, m.Manifests, m.Blobs} {
+		for _, d := range list {
+			refs = append(refs, d.Digest)
+		}
+	}
+	for _, l := range m.FSLayers {
+		refs = append(refs, l.BlobSum)
+	}
+	return refs
+}
+
+// registryCatalog counts repositories through the catalog API, following
+// its Link pagination.
+func registryCatalog(ctx context.Context, svc *DetectedService) (int, error) {
+	next := "/v2/_catalog?n=1000"
+	count := 0
+	for page := 0; next != "" && page < registryCatalogPages; page++ {
+		body, link, err := registryGet(ctx, svc, next)
+		if err != nil {
+			return 0, err
+		}
+		var catalog struct {
+			Repositories []string `json:"repositories"`
+		}
+		if err := json.Unmarshal(body, &catalog); err != nil {
+			return 0, fmt.Errorf("invalid catalog response: %w", err)
+		}
+		count += len(catalog.Repositories)
+		next = nextCatalogPage(link)
+	}
+	return count, nil
+}
+
+// nextCatalogPage extracts the path from a `</v2/_catalog?last=x&n=1000>;
+// rel="next"` Link header.
+func nextCatalogPage(link string) string {
+	start, end := strings.Index(link, "<"), strings.Index(link, ">")
+	if start < 0 || end <= start || !strings.Contains(link[end:], `rel="next"`) {
+		return ""
+	}
+	return link[start+1 : end]
+}
+
+var errRegistryUnauthorized = errors.New("registry requires a valid username and password")
+
+// registryGet fetches a registry API path with basic auth when
+// configured, returning the body and the Link header.
+func registryGet(ctx context.Context, svc *DetectedService, path string) ([]byte, string, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", svc.BaseURL+path, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	if user := svc.Meta["username"]; user != "" {
+		req.Header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(user+":"+svc.Meta["password"])))
+	}
+
+	cl := serviceClient(ctx, 5*time.Second)
+	resp, err := cl.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		return nil, "", errRegistryUnauthorized
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	return body, resp.Header.Get("Link"), err
+}
+
+// formatBytes renders a byte count with a binary unit ("1.5 GB").
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for v := n / unit; v >= unit; v /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// --- Actions ---
+
+// DestructiveAction implements DestructiveActionPlugin: garbage collection
+// deletes blobs unless it is a dry run.
+func (p *RegistryPlugin) DestructiveAction(action string, params map[string]interface{}) bool {
+	dryRun, _ := params["dryRun"].(bool)
+	return action == "garbageCollect" && !dryRun
+}
+
+// PerformAction implements ServiceActionPlugin.
+// Supported action: garbageCollect with optional params
+// {"deleteUntagged": bool, "dryRun": bool}. It runs "registry
+// garbage-collect" inside the registry container; pushes that land while
+// it runs can lose blobs, so run it when nobody is pushing.
+func (p *RegistryPlugin) PerformAction(ctx context.Context, svc *DetectedService, action string, params map[string]interface{}) (string, error) {
+	if action != "garbageCollect" {
+		return "", fmt.Errorf("unknown action: %s", action)
+	}
+	name := svc.Meta["container"]
+	if name == "" {
+		return "", fmt.Errorf("garbage collection needs the registry to run in a container")
+	}
+
+	cmd := []string{"registry", "garbage-collect"}
+	if deleteUntagged, _ := params["deleteUntagged"].(bool); deleteUntagged {
+		cmd = append(cmd, "--delete-untagged")
+	}
+	dryRun, _ := params["dryRun"].(bool)
+	if dryRun {
+		cmd = append(cmd, "--dry-run")
+	}
+	cmd = append(cmd, registryConfigPath)
+
+	out, err := execInContainer(ctx, svc.Meta["dockerSocket"], name, cmd)
+	if err != nil {
+		return "", fmt.Errorf("garbage collection failed: %w", err)
+	}
+	if !dryRun {
+		p.invalidateUsage()
+	}
+
+	// The last line summarizes: "N blobs marked, M blobs and K manifests eligible for deletion".
+	lines := strings.Split(out, "\n")
+	summary := strings.TrimSpace(lines[len(lines)-1])
+	log.Printf("services: registry garbage collection in %s: %s", name, summary)
+	return summary, nil
+}
@@ -0,0 +1,381 @@
+//go:build !noplugins
+
+package services
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"sync"
+	"time"
+)
+
+func init() {
+	Register(&FirewallPlugin{})
+}
+
+// FirewallPlugin reports gateway status, firewall state count, WAN
+// throughput and pending package updates from an OPNsense or pfSense box
+// on the LAN. It is only active when "url" is configured. OPNsense needs
+// "apiKey" and "apiSecret"; pfSense needs the REST API package and an
+// "apiKey". "flavor" (opnsense or pfsense) overrides the guess made from
+// which credentials are set, and "wan" names the WAN interface (default
+// "wan").
+type FirewallPlugin struct {
+	mu  sync.Mutex
+	wan wanSample // previous WAN counters, for throughput
+}
+
+// wanSample is a reading of the WAN interface's byte counters.
+type wanSample struct {
+	rxBytes, txBytes uint64
+	at               time.Time
+}
+
+func (p *FirewallPlugin) ID() string   { return "firewall" }
+func (p *FirewallPlugin) Name() string { return "Firewall" }
+func (p *FirewallPlugin) Icon() string { return "shield.lefthalf.filled" }
+
+const (
+	flavorOPNsense = "opnsense"
+	flavorPfSense  = "pfsense"
+)
+
+func (p *FirewallPlugin) Detect(ctx context.Context, env *DetectionEnv) *DetectedService {
+	url := strings.TrimRight(env.Config(p.ID(), "url"), "/")
+	if url == "" {
+		return nil
+	}
+
+	flavor := strings.ToLower(env.Config(p.ID(), "flavor"))
+	if flavor != flavorOPNsense && flavor != flavorPfSense {
+		flavor = flavorPfSense
+		if env.Config(p.ID(), "apiSecret") != "" {
+			flavor = flavorOPNsense
+		}
+	}
+
+	log.Printf("services: firewall (%s) configured at %s", flavor, url)
+	return &DetectedService{
+		PluginID: p.ID(),
+		Name:     firewallName(flavor),
+		Icon:     p.Icon(),
+		BaseURL:  url,
+		Meta:     map[string]string{"flavor": flavor},
+	}
+}
+
+func firewallName(flavor string) string {
+	if flavor == flavorOPNsense {
+		return "OPNsense"
+	}
+	return "pfSense"
+}
+
+// --- Collection ---
+
+// firewallGateway is a gateway's monitoring result, common to both flavors.
+type firewallGateway struct {
+	Name        string  `json:"name"`
+	Status      string  `json:"status"`
+	Online      bool    `json:"online"`
+	DelayMs     float64 `json:"delayMs"`
+	LossPercent float64 `json:"lossPercent"`
+}
+
+// firewallReading is what one collection gathered from the API.
+type firewallReading struct {
+	version     string
+	gateways    []firewallGateway
+	states      int64
+	statesLimit int64
+	wanRx       uint64
+	wanTx       uint64
+	wanFound    bool
+	updates     int64
+}
+
+func (p *FirewallPlugin) Collect(ctx context.Context, svc *DetectedService) (*ServiceStats, error) {
+	flavor := svc.Meta["flavor"]
+	stats := &ServiceStats{
+		PluginID: p.ID(),
+		Name:     firewallName(flavor),
+		Icon:     p.Icon(),
+		Status:   StatusRunning,
+		Stats:    make(map[string]interface{}),
+	}
+
+	apiKey := svc.Meta["apiKey"]
+	if apiKey == "" || (flavor == flavorOPNsense && svc.Meta["apiSecret"] == "") {
+		stats.setStatus(StatusAuthRequired, "credentials_missing", "set apiKey (and apiSecret on OPNsense)")
+		stats.Summary = []StatItem{
+			{Label: "Status", Value: "Running", Type: "status"},
+		}
+		stats.Stats = map[string]interface{}{
+			"flavor":       flavor,
+			"authRequired": true,
+		}
+		return stats, nil
+	}
+
+	wan := svc.Meta["wan"]
+	if wan == "" {
+		wan = "wan"
+	}
+
+	var r *firewallReading
+	var err error
+	if flavor == flavorOPNsense {
+		r, err = collectOPNsense(ctx, svc.BaseURL, apiKey, svc.Meta["apiSecret"], wan)
+	} else {
+		r, err = collectPfSense(ctx, svc.BaseURL, apiKey, wan)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not reach %s API at %s: %w", stats.Name, svc.BaseURL, err)
+	}
+
+	online := 0
+	for _, gw := range r.gateways {
+		if gw.Online {
+			online++
+		}
+	}
+	if r.gateways == nil {
+		r.gateways = []firewallGateway{}
+	}
+
+	var rxRate, txRate float64
+	if r.wanFound {
+		rxRate, txRate = p.wanThroughput(wanSample{rxBytes: r.wanRx, txBytes: r.wanTx, at: time.Now()})
+	}
+
+	stats.Summary = []StatItem{
+		{Label: "Gateways", Value: fmt.Sprintf("%d/%d", online, len(r.gateways)), Type: "text"},
+		{Label: "States", Value: FormatNumber(r.states), Type: "number"},
+		{Label: "WAN", Value: fmt.Sprintf("↓ %s ↑ %s", formatBitRate(rxRate), formatBitRate(txRate)), Type: "text"},
+		{Label: "Updates", Value: FormatNumber(r.updates), Type: "number"},
+	}
+
+	stats.Stats = map[string]interface{}{
+		"flavor":              flavor,
+		"version":             r.version,
+		"gatewaysOnline":      online,
+		"gatewaysTotal":       len(r.gateways),
+		"gateways":            r.gateways,
+		"states":              r.states,
+		"statesLimit":         r.statesLimit,
+		"wanInterface":        wan,
+		"wanRxBytesPerSecond": math.Round(rxRate),
+		"wanTxBytesPerSecond": math.Round(txRate),
+		"updatesAvailable":    r.updates,
+	}
+
+	if online < len(r.gateways) {
+		stats.degrade("gateways_offline", fmt.Sprintf("%d of %d gateways offline", len(r.gateways)-online, len(r.gateways)))
+	}
+
+	return stats, nil
+}
+
+// wanThroughput turns the WAN byte counters into bytes per second since
+// the previous collection. The first reading, and any after a counter
+// reset, reports zero.
+func (p *FirewallPlugin) wanThroughput(cur wanSample) (rx, tx float64) {
+	p.mu.Lock()
+	prev := p.wan
+	p.wan = cur
+	p.mu.Unlock()
+
+	elapsed := cur.at.Sub(prev.at).Seconds()
+	if prev.at.IsZero() || elapsed <= 0 || cur.rxBytes < prev.rxBytes || cur.txBytes < prev.txBytes {
+		return 0, 0
+	}
+	return float64(cur.rxBytes-prev.rxBytes) / elapsed, float64(cur.txBytes-prev.txBytes) / elapsed
+}
+
+// formatBitRate renders bytes per second as a network rate ("12.4 Mbps").
+func formatBitRate(bytesPerSec float64) string {
+	bits := bytesPerSec * 8
+	switch {
+	case bits >= 1e9:
+		return fmt.Sprintf("%.1f Gbps", bits/1e9)
+	case bits >= 1e6:
+		return fmt.Sprintf("%.1f Mbps", bits/1e6)
+	case bits >= 1e3:
+		return fmt.Sprintf("%.1f Kbps", bits/1e3)
+	}
+	return fmt.Sprintf("%.0f bps", bits)
+}
+
+// --- OPNsense ---
+
+// collectOPNsense reads the OPNsense core API, authenticated with HTTP
+// basic auth using the API key and secret. Only the gateway call is
+// required; the others are best effort.
+func collectOPNsense(ctx context.Context, base, key, secret, wan string) (*firewallReading, error) {
+	headers := map[string]string{
+		"Authorization": "Basic " + base64.StdEncoding.EncodeToString([]byte(key+":"+secret)),
+	}
+	r := &firewallReading{}
+
+	var gateways struct {
+		Items []struct {
+			Name   string `json:"name"`
+			Status string `json:"status"` // "none" when healthy
+			Label  string `json:"status_translated"`
+			Delay  string `json:"delay"` // "1.2 ms"
+			Loss   string `json:"loss"`  // "0.0 %"
+		} `json:"items"`
+	}
+	if err := firewallGet(ctx, base+"/api/routes/gateway/status", headers, &gateways); err != nil {
+		return nil, err
+	}
+	for _, gw := range gateways.Items {
+		status := gw.Label
+		if status == "" {
+			status = gw.Status
+		}
+		r.gateways = append(r.gateways, firewallGateway{
+			Name:        gw.Name,
+			Status:      status,
+			Online:      gw.Status == "none" || gw.Status == "online",
+			DelayMs:     toFloat64(gw.Delay),
+			LossPercent: toFloat64(gw.Loss),
+		})
+	}
+
+	var states struct {
+		Total interface{} `json:"total"`
+	}
+	if err := firewallGet(ctx, base+"/api/diagnostics/firewall/query_states?rowCount=1", headers, &states); err != nil {
+		log.Printf("services: opnsense states: %v", err)
+	}
+	r.states = toInt64(states.Total)
+
+	var traffic struct {
+		Interfaces map[string]map[string]interface{} `json:"interfaces"`
+	}
+	if err := firewallGet(ctx, base+"/api/diagnostics/traffic/interface", headers, &traffic); err != nil {
+		log.Printf("services: opnsense traffic: %v", err)
+	}
+	if iface, ok := traffic.Interfaces[wan]; ok {
+		r.wanRx = uint64(toInt64(iface["bytes received"]))
+		r.wanTx = uint64(toInt64(iface["bytes transmitted"]))
+		r.wanFound = true
+	}
+
+	var firmware struct {
+		Status  string      `json:"status"` // "update", "upgrade", "none", ...
+		Updates interface{} `json:"updates"`
+		Product struct {
+			Version string `json:"product_version"`
+		} `json:"product"`
+	}
+	if err := firewallGet(ctx, base+"/api/core/firmware/status", headers, &firmware); err != nil {
+		log.Printf("services: opnsense firmware status: %v", err)
+	}
+	r.version = firmware.Product.Version
+	r.updates = toInt64(firmware.Updates)
+
+	return r, nil
+}
+
+// --- pfSense ---
+
+// collectPfSense reads the pfSense REST API package (v2), authenticated
+// with the X-API-Key header. Responses wrap their payload in "data".
+func collectPfSense(ctx context.Context, base, key, wan string) (*firewallReading, error) {
+	headers := map[string]string{"X-API-Key": key}
+	r := &firewallReading{}
+
+	var gateways []struct {
+		Name   string  `json:"name"`
+		Status string  `json:"status"` // "online", "down", "loss", "delay", ...
+		Delay  float64 `json:"delay"`
+		Loss   float64 `json:"loss"`
+	}
+	if err := pfSenseGet(ctx, base+"/api/v2/status/gateways", headers, &gateways); err != nil {
+		return nil, err
+	}
+	for _, gw := range gateways {
+		r.gateways = append(r.gateways, firewallGateway{
+			Name:        gw.Name,
+			Status:      gw.Status,
+			Online:      gw.Status == "online",
+			DelayMs:     gw.Delay,
+			LossPercent: gw.Loss,
+		})
+	}
+
+	var states struct {
+		Current int64 `json:"currentstates"`
+		Maximum int64 `json:"maximumstates"`
+	}
+	if err := pfSenseGet(ctx, base+"/api/v2/firewall/states/size", headers, &states); err != nil {
+		log.Printf("services: pfsense states: %v", err)
+	}
+	r.states, r.statesLimit = states.Current, states.Maximum
+
+	var interfaces []struct {
+		Name     string `json:"name"`
+		InBytes  uint64 `json:"inbytes"`
+		OutBytes uint64 `json:"outbytes"`
+	}
+	if err := pfSenseGet(ctx, base+"/api/v2/status/interfaces", headers, &interfaces); err != nil {
+		log.Printf("services: pfsense interfaces: %v", err)
+	}
+	for _, iface := range interfaces {
+		if strings.EqualFold(iface.Name, wan) {
+			r.wanRx, r.wanTx, r.wanFound = iface.InBytes, iface.OutBytes, true
+			break
+		}
+	}
+
+	var version struct {
+		Version string `json:"version"`
+	}
+	if err := pfSenseGet(ctx, base+"/api/v2/system/version", headers, &version); err != nil {
+		log.Printf("services: pfsense version: %v", err)
+	}
+	r.version = version.Version
+
+	var packages []struct {
+		UpdateAvailable bool `json:"update_available"`
+	}
+	if err := pfSenseGet(ctx, base+"/api/v2/system/packages", headers, &packages); err != nil {
+		log.Printf("services: pfsense packages: %v", err)
+	}
+	for _, pkg := range packages {
+		if pkg.UpdateAvailable {
+			r.updates++
+		}
+	}
+
+	return r, nil
+}
+
+// pfSenseGet decodes the "data" field of the REST API's response envelope.
+func pfSenseGet(ctx context.Context, url string, headers map[string]string, out interface{}) error {
+	var envelope struct {
+		Data json.RawMessage `json:"data"`
+	}
+	if err := firewallGet(ctx, url, headers, &envelope); err != nil {
+		return err
+	}
+	return json.Unmarshal(envelope.Data, out)
+}
+
+func firewallGet(ctx context.Context, url string, headers map[string]string, out interface{}) error {
+	body, err := HTTPGetWithHeaders(ctx, url, headers)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("invalid response from %s: %w", url, err)
+	}
+	return nil
+}
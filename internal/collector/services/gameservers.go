@@ -0,0 +1,598 @@
+//go:build !noplugins
+
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/neur0map/deskmon-agent/internal/hostfs"
+)
+
+func init() {
+	Register(&GameServersPlugin{})
+}
+
+// GameServersPlugin reports players, MOTD and version for game servers on
+// the host: Minecraft through the server list ping, and Source engine
+// games and Valheim through A2S_INFO queries. Servers are found in Docker
+// containers and by process; "minecraft" and "a2s" add comma-separated
+// host:port addresses. With "rconPassword" (and "rconPort", default
+// 25575) Minecraft servers also report tick health over RCON.
+type GameServersPlugin struct{}
+
+func (p *GameServersPlugin) ID() string   { return "gameservers" }
+func (p *GameServersPlugin) Name() string { return "Game Servers" }
+func (p *GameServersPlugin) Icon() string { return "gamecontroller" }
+
+const (
+	gameMinecraft = "minecraft"
+	gameA2S       = "a2s"
+
+	minecraftDefaultPort = 25565
+	minecraftRCONPort    = 25575
+	sourceDefaultPort    = 27015
+	valheimQueryPort     = 2457 // game port + 1
+
+	gameQueryTimeout = 2 * time.Second
+)
+
+// gameTarget is one server to query.
+type gameTarget struct {
+	Protocol string `json:"protocol"` // gameMinecraft or gameA2S
+	Name     string `json:"name"`     // container or process it was found through
+	Addr     string `json:"addr"`
+}
+
+// a2sImages are image fragments of Source engine and A2S-speaking servers.
+var a2sImages = []string{"valheim", "srcds", "csgo", "cs2", "tf2", "garrysmod", "gmod", "l4d2", "insurgency", "squad", "rust-server", "arma3", "7dtd", "7daystodie", "ark-server", "conanexiles", "palworld"}
+
+func (p *GameServersPlugin) Detect(ctx context.Context, env *DetectionEnv) *DetectedService {
+	var targets []gameTarget
+	seen := make(map[string]bool)
+	add := func(protocol, name, addr string) {
+		if key := protocol + "/" + addr; !seen[key] {
+			seen[key] = true
+			targets = append(targets, gameTarget{Protocol: protocol, Name: name, Addr: addr})
+		}
+	}
+
+	for _, c := range env.Containers {
+		if c.State != "running" {
+			continue
+		}
+		image := strings.ToLower(c.Image)
+		switch {
+		case strings.Contains(image, "minecraft") && !strings.Contains(image, "bedrock"):
+			for _, port := range append(c.HostPorts, minecraftDefaultPort) {
+				addr := net.JoinHostPort("127.0.0.1", strconv.Itoa(port))
+				if _, err := minecraftPing(ctx, addr); err == nil {
+					add(gameMinecraft, c.Name, addr)
+					break
+				}
+			}
+		case matchesAny(image, a2sImages):
+			for _, port := range c.HostPorts {
+				addr := net.JoinHostPort("127.0.0.1", strconv.Itoa(port))
+				if _, err := a2sInfo(ctx, addr); err == nil {
+					add(gameA2S, c.Name, addr)
+					break
+				}
+			}
+		}
+	}
+
+	// Bare-metal servers. Minecraft runs as java, so only ports that answer
+	// the server list ping count.
+	for _, port := range env.FindProcessPorts("java") {
+		addr := net.JoinHostPort("127.0.0.1", strconv.Itoa(port))
+		if _, err := minecraftPing(ctx, addr); err == nil {
+			add(gameMinecraft, "java", addr)
+		}
+	}
+	for _, proc := range []struct {
+		name string
+		port int
+	}{
+		{"srcds_linux", sourceDefaultPort},
+		{"valheim_server.", valheimQueryPort}, // comm is cut at 15 characters
+	} {
+		if !env.HasProcess(proc.name) {
+			continue
+		}
+		addr := net.JoinHostPort("127.0.0.1", strconv.Itoa(proc.port))
+		if _, err := a2sInfo(ctx, addr); err == nil {
+			add(gameA2S, strings.TrimSuffix(proc.name, "."), addr)
+		}
+	}
+
+	for _, protocol := range []string{gameMinecraft, gameA2S} {
+		for _, addr := range strings.Split(env.Config(p.ID(), protocol), ",") {
+			if addr = strings.TrimSpace(addr); addr != "" {
+				add(protocol, addr, addr)
+			}
+		}
+	}
+
+	if len(targets) == 0 {
+		return nil
+	}
+	encoded, _ := json.Marshal(targets)
+	log.Printf("services: gameservers detected %d server(s)", len(targets))
+	return &DetectedService{
+		PluginID: p.ID(),
+		Name:     p.Name(),
+		Icon:     p.Icon(),
+		Meta:     map[string]string{"targets": string(encoded)},
+	}
+}
+
+func matchesAny(s string, fragments []string) bool {
+	for _, f := range fragments {
+		if strings.Contains(s, f) {
+			return true
+		}
+	}
+	return false
+}
+
+// --- Collection ---
+
+// gameServerStatus is one server's entry in stats.servers.
+type gameServerStatus struct {
+	Name       string   `json:"name"`
+	Protocol   string   `json:"protocol"`
+	Address    string   `json:"address"`
+	Online     bool     `json:"online"`
+	Game       string   `json:"game,omitempty"`
+	Version    string   `json:"version,omitempty"`
+	MOTD       string   `json:"motd,omitempty"`
+	Map        string   `json:"map,omitempty"`
+	Players    int      `json:"players"`
+	MaxPlayers int      `json:"maxPlayers"`
+	PlayerList []string `json:"playerList,omitempty"`
+	LatencyMs  float64  `json:"latencyMs"`
+	TPS        *float64 `json:"tps,omitempty"`
+	MSPT       *float64 `json:"msptMs,omitempty"`
+	TickHealth string   `json:"tickHealth,omitempty"` // "good", "lagging", "overloaded"
+	Error      string   `json:"error,omitempty"`
+}
+
+func (p *GameServersPlugin) Collect(ctx context.Context, svc *DetectedService) (*ServiceStats, error) {
+	var targets []gameTarget
+	if err := json.Unmarshal([]byte(svc.Meta["targets"]), &targets); err != nil {
+		return nil, fmt.Errorf("invalid game server list: %w", err)
+	}
+	rconPort := minecraftRCONPort
+	if n, err := strconv.Atoi(svc.Meta["rconPort"]); err == nil && n > 0 {
+		rconPort = n
+	}
+
+	servers := make([]gameServerStatus, len(targets))
+	var wg sync.WaitGroup
+	for i, t := range targets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			servers[i] = queryGameServer(ctx, t, svc.Meta["rconPassword"], rconPort)
+		}()
+	}
+	wg.Wait()
+
+	online, players := 0, 0
+	worstTick := ""
+	for _, s := range servers {
+		if s.Online {
+			online++
+			players += s.Players
+		}
+		if tickRank(s.TickHealth) > tickRank(worstTick) {
+			worstTick = s.TickHealth
+		}
+	}
+	sort.Slice(servers, func(i, j int) bool { return servers[i].Name < servers[j].Name })
+
+	stats := &ServiceStats{
+		PluginID: p.ID(),
+		Name:     p.Name(),
+		Icon:     p.Icon(),
+		Status:   StatusRunning,
+		Summary: []StatItem{
+			{Label: "Servers", Value: fmt.Sprintf("%d/%d", online, len(servers)), Type: "text"},
+			{Label: "Players", Value: FormatNumber(int64(players)), Type: "number"},
+		},
+		Stats: map[string]interface{}{
+			"serversOnline": online,
+			"serversTotal":  len(servers),
+			"players":       players,
+			"servers":       servers,
+		},
+	}
+	if worstTick != "" {
+		stats.Summary = append(stats.Summary, StatItem{Label: "Tick", Value: worstTick, Type: "status"})
+	}
+	switch {
+	case online == 0:
+		stats.setStatus(StatusStopped, "servers_offline", "no game server is online")
+	case online < len(servers):
+		stats.degrade("servers_offline", fmt.Sprintf("%d of %d game servers offline", len(servers)-online, len(servers)))
+	case worstTick == "overloaded":
+		stats.degrade("server_overloaded", "a game server is overloaded")
+	}
+	return stats, nil
+}
+
+func tickRank(health string) int {
+	switch health {
+	case "good":
+		return 1
+	case "lagging":
+		return 2
+	case "overloaded":
+		return 3
+	}
+	return 0
+}
+
+func queryGameServer(ctx context.Context, t gameTarget, rconPassword string, rconPort int) gameServerStatus {
+	s := gameServerStatus{Name: t.Name, Protocol: t.Protocol, Address: t.Addr}
+	start := time.Now()
+
+	switch t.Protocol {
+	case gameMinecraft:
+		st, err := minecraftPing(ctx, t.Addr)
+		if err != nil {
+			s.Error = err.Error()
+			return s
+		}
+		s.Online = true
+		s.Game = "Minecraft"
+		s.Version = st.Version.Name
+		s.MOTD = st.motd()
+		s.Players, s.MaxPlayers = st.Players.Online, st.Players.Max
+		for _, pl := range st.Players.Sample {
+			s.PlayerList = append(s.PlayerList, pl.Name)
+		}
+		s.LatencyMs = roundMs(time.Since(start))
+
+		if rconPassword != "" {
+			host, _, _ := net.SplitHostPort(t.Addr)
+			tps, mspt, err := minecraftTickHealth(ctx, net.JoinHostPort(host, strconv.Itoa(rconPort)), rconPassword)
+			if err != nil {
+				log.Printf("services: gameservers rcon %s: %v", t.Name, err)
+			} else {
+				s.TPS, s.MSPT = tps, mspt
+				s.TickHealth = tickHealth(tps, mspt)
+			}
+		}
+
+	case gameA2S:
+		info, err := a2sInfo(ctx, t.Addr)
+		if err != nil {
+			s.Error = err.Error()
+			return s
+		}
+		s.Online = true
+		s.Game, s.Version, s.MOTD, s.Map = info.game, info.version, info.name, info.mapName
+		s.Players, s.MaxPlayers = info.players, info.maxPlayers
+		s.LatencyMs = roundMs(time.Since(start))
+	}
+	return s
+}
+
+func roundMs(d time.Duration) float64 {
+	return math.Round(float64(d.Microseconds())/10) / 100
+}
+
+// tickHealth grades a server against Minecraft's 20 ticks per second.
+func tickHealth(tps, mspt *float64) string {
+	switch {
+	case tps != nil && *tps >= 19, tps == nil && mspt != nil && *mspt <= 50:
+		return "good"
+	case tps != nil && *tps >= 15, tps == nil && mspt != nil && *mspt <= 67:
+		return "lagging"
+	}
+	return "overloaded"
+}
+
+// --- Minecraft server list ping ---
+
+type minecraftStatus struct {
+	Version struct {
+		Name string `json:"name"`
+	} `json:"version"`
+	Players struct {
+		Max    int `json:"max"`
+		Online int `json:"online"`
+		Sample []struct {
+			Name string `json:"name"`
+		} `json:"sample"`
+	} `json:"players"`
+	Description json.RawMessage `json:"description"` // string or chat component
+}
+
+// motd flattens the description to plain text, dropping § formatting codes.
+func (st *minecraftStatus) motd() string {
+	var text string
+	if json.Unmarshal(st.Description, &text) != nil {
+		var component chatComponent
+		if json.Unmarshal(st.Description, &component) == nil {
+			text = component.plain()
+		}
+	}
+	return strings.TrimSpace(formattingCodes.ReplaceAllString(text, ""))
+}
+
+var formattingCodes = regexp.MustCompile(`§.`)
+
+type chatComponent struct {
+	Text  string          `json:"text"`
+	Extra []chatComponent `json:"extra"`
+}
+
+func (c chatComponent) plain() string {
+	var b strings.Builder
+	b.WriteString(c.Text)
+	for _, e := range c.Extra {
+		b.WriteString(e.plain())
+	}
+	return b.String()
+}
+
+// minecraftPing performs the handshake and status request of the server
+// list ping protocol (Java Edition 1.7+).
+func minecraftPing(ctx context.Context, addr string) (*minecraftStatus, error) {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	port, _ := strconv.Atoi(portStr)
+
+	ctx, cancel := context.WithTimeout(ctx, gameQueryTimeout)
+	defer cancel()
+	conn, err := hostfs.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	deadline, _ := ctx.Deadline()
+	conn.SetDeadline(deadline)
+
+	// Handshake: id 0, protocol version (-1 when only asking for status),
+	// server address, port, next state 1 (status).
+	var handshake bytes.Buffer
+	handshake.WriteByte(0x00)
+	handshake.Write(binary.AppendUvarint(nil, uint64(uint32(math.MaxUint32))))
+	handshake.Write(binary.AppendUvarint(nil, uint64(len(host))))
+	handshake.WriteString(host)
+	binary.Write(&handshake, binary.BigEndian, uint16(port))
+	handshake.WriteByte(0x01)
+
+	var out bytes.Buffer
+	out.Write(binary.AppendUvarint(nil, uint64(handshake.Len())))
+	out.Write(handshake.Bytes())
+	out.Write([]byte{0x01, 0x00}) // status request
+	if _, err := conn.Write(out.Bytes()); err != nil {
+		return nil, err
+	}
+
+	r := bufio.NewReader(conn)
+	length, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, fmt.Errorf("read status: %w", err)
+	}
+	if length > 1<<20 {
+		return nil, errors.New("status response too large")
+	}
+	packet := make([]byte, length)
+	if _, err := io.ReadFull(r, packet); err != nil {
+		return nil, fmt.Errorf("read status: %w", err)
+	}
+	pr := bytes.NewReader(packet)
+	if id, err := binary.ReadUvarint(pr); err != nil || id != 0x00 {
+		return nil, errors.New("not a Minecraft status response")
+	}
+	strLen, err := binary.ReadUvarint(pr)
+	if err != nil || strLen > uint64(pr.Len()) {
+		return nil, errors.New("malformed Minecraft status response")
+	}
+	payload := make([]byte, strLen)
+	io.ReadFull(pr, payload)
+
+	var st minecraftStatus
+	if err := json.Unmarshal(payload, &st); err != nil {
+		return nil, fmt.Errorf("invalid Minecraft status: %w", err)
+	}
+	return &st, nil
+}
+
+// --- Minecraft RCON ---
+
+const (
+	rconAuth    = 3
+	rconCommand = 2
+)
+
+var (
+	paperTPS    = regexp.MustCompile(`1m, 5m, 15m: (?:§.)*\*?([\d.]+)`)
+	vanillaMSPT = regexp.MustCompile(`Average time per tick: ([\d.]+) ?ms`)
+)
+
+// minecraftTickHealth asks over RCON for the tick rate: Paper and Spigot
+// answer "tps" with the 1-minute average; vanilla 1.20.3+ answers
+// "tick query" with the average milliseconds per tick.
+func minecraftTickHealth(ctx context.Context, addr, password string) (tps, mspt *float64, err error) {
+	ctx, cancel := context.WithTimeout(ctx, gameQueryTimeout)
+	defer cancel()
+	conn, err := hostfs.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer conn.Close()
+	deadline, _ := ctx.Deadline()
+	conn.SetDeadline(deadline)
+
+	if id, _, err := rconExchange(conn, 1, rconAuth, password); err != nil {
+		return nil, nil, err
+	} else if id == -1 {
+		return nil, nil, errors.New("RCON password rejected")
+	}
+
+	if _, body, err := rconExchange(conn, 2, rconCommand, "tps"); err == nil {
+		if m := paperTPS.FindStringSubmatch(body); m != nil {
+			if v, err := strconv.ParseFloat(m[1], 64); err == nil {
+				return &v, nil, nil
+			}
+		}
+	}
+	_, body, err := rconExchange(conn, 3, rconCommand, "tick query")
+	if err != nil {
+		return nil, nil, err
+	}
+	if m := vanillaMSPT.FindStringSubmatch(body); m != nil {
+		if v, err := strconv.ParseFloat(m[1], 64); err == nil {
+			rate := math.Round(math.Min(20, 1000/math.Max(v, 50))*100) / 100
+			return &rate, &v, nil
+		}
+	}
+	return nil, nil, errors.New("server reported no tick rate")
+}
+
+// rconExchange sends one RCON packet and reads the reply's request ID and
+// body. The auth reply carries ID -1 when the password is wrong.
+func rconExchange(conn net.Conn, id, kind int32, body string) (int32, string, error) {
+	var pkt bytes.Buffer
+	binary.Write(&pkt, binary.LittleEndian, int32(len(body)+10))
+	binary.Write(&pkt, binary.LittleEndian, id)
+	binary.Write(&pkt, binary.LittleEndian, kind)
+	pkt.WriteString(body)
+	pkt.Write([]byte{0, 0})
+	if _, err := conn.Write(pkt.Bytes()); err != nil {
+		return 0, "", err
+	}
+
+	for {
+		var length, respID, respType int32
+		if err := binary.Read(conn, binary.LittleEndian, &length); err != nil {
+			return 0, "", err
+		}
+		if length < 10 || length > 1<<16 {
+			return 0, "", errors.New("malformed RCON packet")
+		}
+		data := make([]byte, length)
+		if _, err := io.ReadFull(conn, data); err != nil {
+			return 0, "", err
+		}
+		respID = int32(binary.LittleEndian.Uint32(data[0:4]))
+		respType = int32(binary.LittleEndian.Uint32(data[4:8]))
+		// Servers send an empty RESPONSE_VALUE before the auth reply.
+		if kind == rconAuth && respType != rconCommand {
+			continue
+		}
+		return respID, string(bytes.TrimRight(data[8:], "\x00")), nil
+	}
+}
+
+// --- A2S_INFO (Source engine query) ---
+
+type a2sServerInfo struct {
+	name, mapName, game, version string
+	players, maxPlayers          int
+}
+
+var a2sInfoRequest = append([]byte{0xFF, 0xFF, 0xFF, 0xFF, 'T'}, "Source Engine Query\x00"...)
+
+// a2sInfo sends A2S_INFO over UDP, answering the challenge newer servers
+// require before they reply.
+func a2sInfo(ctx context.Context, addr string) (*a2sServerInfo, error) {
+	ctx, cancel := context.WithTimeout(ctx, gameQueryTimeout)
+	defer cancel()
+	conn, err := hostfs.DialContext(ctx, "udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	deadline, _ := ctx.Deadline()
+	conn.SetDeadline(deadline)
+
+	buf := make([]byte, 1400)
+	req := a2sInfoRequest
+	for range 2 {
+		if _, err := conn.Write(req); err != nil {
+			return nil, err
+		}
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		resp := buf[:n]
+		if len(resp) < 5 || !bytes.Equal(resp[:4], []byte{0xFF, 0xFF, 0xFF, 0xFF}) {
+			return nil, errors.New("not an A2S response")
+		}
+		switch resp[4] {
+		case 'A': // S2C_CHALLENGE
+			if len(resp) < 9 {
+				return nil, errors.New("malformed A2S challenge")
+			}
+			req = append(append([]byte{}, a2sInfoRequest...), resp[5:9]...)
+		case 'I':
+			return parseA2SInfo(resp[5:])
+		default:
+			return nil, fmt.Errorf("unexpected A2S response type 0x%02x", resp[4])
+		}
+	}
+	return nil, errors.New("A2S challenge not accepted")
+}
+
+func parseA2SInfo(b []byte) (*a2sServerInfo, error) {
+	r := bytes.NewReader(b)
+	cstring := func() string {
+		var s []byte
+		for {
+			c, err := r.ReadByte()
+			if err != nil || c == 0 {
+				return string(s)
+			}
+			s = append(s, c)
+		}
+	}
+
+	info := &a2sServerInfo{}
+	r.ReadByte() // protocol
+	info.name = cstring()
+	info.mapName = cstring()
+	cstring() // folder
+	info.game = cstring()
+	var appID uint16
+	binary.Read(r, binary.LittleEndian, &appID)
+	players, _ := r.ReadByte()
+	maxPlayers, _ := r.ReadByte()
+	r.ReadByte()                            // bots
+	r.ReadByte()                            // server type
+	r.ReadByte()                            // environment
+	r.ReadByte()                            // visibility
+	if _, err := r.ReadByte(); err != nil { // VAC
+		return nil, errors.New("truncated A2S_INFO response")
+	}
+	if appID == 2400 { // The Ship has three more bytes
+		r.Seek(3, io.SeekCurrent)
+	}
+	info.version = cstring()
+	info.players, info.maxPlayers = int(players), int(maxPlayers)
+	return info, nil
+}
@@ -2,7 +2,6 @@ package services
 
 import (
 	"context"
-	"crypto/tls"
 	"fmt"
 	"io"
 	"log"
@@ -11,17 +10,44 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/client"
+	"github.com/neur0map/deskmon-agent/internal/config"
+	"github.com/neur0map/deskmon-agent/internal/hostfs"
 )
 
+// RedactSecrets replaces any credential from meta that appears in msg, so
+// plugin errors (which may echo URLs or request bodies) are safe to log
+// and return to clients.
+func RedactSecrets(msg string, meta map[string]string) string {
+	for key, value := range meta {
+		if len(value) < 4 || !config.IsSecretKey(key) {
+			continue
+		}
+		msg = strings.ReplaceAll(msg, value, "<redacted>")
+	}
+	return msg
+}
+
 // DetectionEnv provides helpers that plugins use to discover services.
 type DetectionEnv struct {
 	Containers   []ContainerInfo
 	Processes    map[string]bool   // process name → exists
 	ProcessPorts map[string][]int  // process name → TCP listening ports
+	Configs      map[string]map[string]string // pluginID → key → value
+	DockerSocket string
+
+	// Probe policy for the current cycle, see detection.go
+	hosts   []string
+	budget  *atomic.Int64 // HTTP probes left, nil for no limit
+	starved bool          // a probe was refused for lack of budget
+}
+
+// Config returns a plugin setting from the services config. Plugins for
+// devices elsewhere on the LAN use it to find the address to collect from.
+func (e *DetectionEnv) Config(pluginID, key string) string {
+	return e.Configs[pluginID][key]
 }
 
 // FindDockerImage returns the first container whose image contains the match string.
@@ -74,7 +100,9 @@ func (e *DetectionEnv) FindProcessPortsBySubstring(substr string) []int {
 	return ports
 }
 
-// ProbeHTTP tries an HTTP GET on localhost at each port+path combination.
+// ProbeHTTP tries an HTTP GET on localhost (or the hosts set in the
+// detection config) at each port+path combination, within the cycle's
+// probe budget.
 // For typical HTTPS ports (443, 8443, 9443) it tries HTTPS first, then HTTP.
 // For all other ports it tries HTTP first, then HTTPS as fallback.
 // Returns the base URL (scheme://host:port) of the first successful probe, or "".
@@ -84,9 +112,7 @@ func (e *DetectionEnv) ProbeHTTP(ports []int, path string) string {
 		CheckRedirect: func(req *http.Request, via []*http.Request) error {
 			return http.ErrUseLastResponse
 		},
-		Transport: &http.Transport{
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-		},
+		Transport: serviceTransport(context.Background()),
 	}
 
 	isHTTPSPort := func(port int) bool {
@@ -94,6 +120,9 @@ func (e *DetectionEnv) ProbeHTTP(ports []int, path string) string {
 	}
 
 	tryProbe := func(scheme, host string, port int) string {
+		if !e.takeProbe() {
+			return ""
+		}
 		url := fmt.Sprintf("%s://%s:%d%s", scheme, host, port, path)
 		resp, err := cl.Get(url)
 		if err != nil {
@@ -117,16 +146,13 @@ func (e *DetectionEnv) ProbeHTTP(ports []int, path string) string {
 			schemes = []string{"http", "https"}
 		}
 
-		// Try 127.0.0.1 first (avoids DNS resolution), fall back to localhost
-		for _, scheme := range schemes {
-			if base := tryProbe(scheme, "127.0.0.1", port); base != "" {
-				return base
-			}
-		}
-		// Only try localhost if 127.0.0.1 failed completely
-		for _, scheme := range schemes {
-			if base := tryProbe(scheme, "localhost", port); base != "" {
-				return base
+		// By default try 127.0.0.1 first (avoids DNS resolution), and
+		// localhost only if 127.0.0.1 failed completely
+		for _, host := range e.probeHosts() {
+			for _, scheme := range schemes {
+				if base := tryProbe(scheme, host, port); base != "" {
+					return base
+				}
 			}
 		}
 	}
@@ -134,18 +160,22 @@ func (e *DetectionEnv) ProbeHTTP(ports []int, path string) string {
 }
 
 // HTTPGet performs a GET request with context and returns the response body.
-// Accepts self-signed certs for localhost services.
+// Accepts self-signed certs unless the service's TLS settings say
+// otherwise, see tlsverify.go.
 func HTTPGet(ctx context.Context, url string) ([]byte, error) {
+	return HTTPGetWithHeaders(ctx, url, nil)
+}
+
+// HTTPGetWithHeaders is HTTPGet with extra request headers (e.g. API keys).
+func HTTPGetWithHeaders(ctx context.Context, url string, headers map[string]string) ([]byte, error) {
 	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return nil, err
 	}
-	cl := &http.Client{
-		Timeout: 5 * time.Second,
-		Transport: &http.Transport{
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-		},
+	for k, v := range headers {
+		req.Header.Set(k, v)
 	}
+	cl := serviceClient(ctx, 5*time.Second)
 	resp, err := cl.Do(req)
 	if err != nil {
 		return nil, err
@@ -159,9 +189,24 @@ func HTTPGet(ctx context.Context, url string) ([]byte, error) {
 	return io.ReadAll(io.LimitReader(resp.Body, 1<<20)) // 1MB max
 }
 
+// HostPath maps an absolute host path into the agent's view of the host
+// filesystem. In Docker mode the host root is mounted at DESKMON_HOST_ROOT.
+func HostPath(path string) string {
+	return hostfs.Path(path)
+}
+
 // BuildDetectionEnv constructs a DetectionEnv by querying Docker and /proc.
 func BuildDetectionEnv(dockerSocket string) *DetectionEnv {
-	containers := listDockerContainers(dockerSocket)
+	return buildDetectionEnv(dockerSocket, true)
+}
+
+// buildDetectionEnv leaves Docker out when withDocker is false, so only
+// host processes are detected.
+func buildDetectionEnv(dockerSocket string, withDocker bool) *DetectionEnv {
+	var containers []ContainerInfo
+	if withDocker {
+		containers = listDockerContainers(dockerSocket)
+	}
 	pidNames := scanProcesses()
 	processPorts := discoverProcessPorts(pidNames)
 
@@ -185,59 +230,16 @@ func BuildDetectionEnv(dockerSocket string) *DetectionEnv {
 		Containers:   containers,
 		Processes:    processes,
 		ProcessPorts: processPorts,
+		DockerSocket: dockerSocket,
 	}
 }
 
-// listDockerContainers does a lightweight container list (no stats).
-func listDockerContainers(socketPath string) []ContainerInfo {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	cli, err := client.NewClientWithOpts(
-		client.WithHost("unix://"+socketPath),
-		client.WithAPIVersionNegotiation(),
-	)
-	if err != nil {
-		log.Printf("services: docker client init error: %v", err)
-		return nil
-	}
-	defer cli.Close()
-
-	containers, err := cli.ContainerList(ctx, container.ListOptions{All: true})
-	if err != nil {
-		log.Printf("services: docker list error: %v", err)
-		return nil
-	}
-
-	result := make([]ContainerInfo, 0, len(containers))
-	for _, c := range containers {
-		var hostPorts []int
-		for _, p := range c.Ports {
-			if p.PublicPort > 0 {
-				hostPorts = append(hostPorts, int(p.PublicPort))
-			}
-		}
-
-		name := ""
-		if len(c.Names) > 0 {
-			name = strings.TrimPrefix(c.Names[0], "/")
-		}
-
-		result = append(result, ContainerInfo{
-			Name:      name,
-			Image:     c.Image,
-			State:     c.State,
-			HostPorts: hostPorts,
-		})
-	}
-	return result
-}
-
 // scanProcesses reads /proc/*/comm to build a PID→name map.
 func scanProcesses() map[int]string {
-	entries, err := os.ReadDir("/proc")
+	procDir := hostfs.Proc()
+	entries, err := os.ReadDir(procDir)
 	if err != nil {
-		log.Printf("services: cannot read /proc: %v", err)
+		log.Printf("services: cannot read %s: %v", procDir, err)
 		return make(map[int]string)
 	}
 
@@ -250,7 +252,7 @@ func scanProcesses() map[int]string {
 		if err != nil {
 			continue
 		}
-		data, err := os.ReadFile(filepath.Join("/proc", entry.Name(), "comm"))
+		data, err := os.ReadFile(filepath.Join(procDir, entry.Name(), "comm"))
 		if err != nil {
 			continue
 		}
@@ -271,7 +273,7 @@ func discoverProcessPorts(pidNames map[int]string) map[string][]int {
 	seen := make(map[string]map[int]bool)
 
 	for pid, name := range pidNames {
-		fdPath := fmt.Sprintf("/proc/%d/fd", pid)
+		fdPath := hostfs.Proc(strconv.Itoa(pid), "fd")
 		entries, err := os.ReadDir(fdPath)
 		if err != nil {
 			continue
@@ -305,7 +307,7 @@ func discoverProcessPorts(pidNames map[int]string) map[string][]int {
 // parseListenSockets reads /proc/net/tcp{,6} and returns inode→port for LISTEN sockets.
 func parseListenSockets() map[uint64]int {
 	result := make(map[uint64]int)
-	for _, path := range []string{"/proc/net/tcp", "/proc/net/tcp6"} {
+	for _, path := range []string{hostfs.Net("tcp"), hostfs.Net("tcp6")} {
 		data, err := os.ReadFile(path)
 		if err != nil {
 			continue
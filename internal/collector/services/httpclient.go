@@ -0,0 +1,95 @@
+package services
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/neur0map/deskmon-agent/internal/config"
+	"github.com/neur0map/deskmon-agent/internal/hostfs"
+)
+
+// Pooled HTTP clients for service API calls. Services are polled every 10
+// seconds, so connections are kept alive between calls instead of set up
+// each time: plugins share one transport per distinct TLS setting (see
+// tlsverify.go). Requests go through the configured proxy, or HTTP_PROXY,
+// HTTPS_PROXY and NO_PROXY from the environment; localhost is never
+// proxied.
+
+const (
+	defaultDialTimeout  = 3 * time.Second
+	maxIdleConnsPerHost = 4
+	idleConnTimeout     = 90 * time.Second
+)
+
+var transports struct {
+	sync.Mutex
+	dialTimeout time.Duration
+	proxy       func(*http.Request) (*url.URL, error)
+	m           map[serviceTLS]*http.Transport
+}
+
+// SetHTTPOptions applies the service_http settings. Connections already
+// pooled are dropped.
+func SetHTTPOptions(cfg config.ServiceHTTPConfig) {
+	transports.Lock()
+	defer transports.Unlock()
+	transports.dialTimeout = cfg.DialTimeout
+	transports.proxy = nil
+	if cfg.Proxy != "" {
+		if u, err := url.Parse(cfg.Proxy); err == nil {
+			transports.proxy = http.ProxyURL(u)
+		}
+	}
+	for _, t := range transports.m {
+		t.CloseIdleConnections()
+	}
+	transports.m = nil
+}
+
+// serviceClient is an HTTP client for service API calls made under ctx,
+// sharing pooled connections with every other call with the same TLS
+// settings.
+func serviceClient(ctx context.Context, timeout time.Duration) *http.Client {
+	return &http.Client{Timeout: timeout, Transport: serviceTransport(ctx)}
+}
+
+// serviceTransport returns the pooled transport for the TLS settings ctx
+// carries.
+func serviceTransport(ctx context.Context) *http.Transport {
+	st := serviceTLSFrom(ctx)
+	transports.Lock()
+	defer transports.Unlock()
+	if t, ok := transports.m[st]; ok {
+		return t
+	}
+	proxy := transports.proxy
+	if proxy == nil {
+		proxy = http.ProxyFromEnvironment
+	}
+	dialTimeout := transports.dialTimeout
+	if dialTimeout <= 0 {
+		dialTimeout = defaultDialTimeout
+	}
+	t := &http.Transport{
+		Proxy: proxy,
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			ctx, cancel := context.WithTimeout(ctx, dialTimeout)
+			defer cancel()
+			return hostfs.DialContext(ctx, network, addr)
+		},
+		TLSClientConfig:     st.config(),
+		TLSHandshakeTimeout: 5 * time.Second,
+		ForceAttemptHTTP2:   true,
+		MaxIdleConnsPerHost: maxIdleConnsPerHost,
+		IdleConnTimeout:     idleConnTimeout,
+	}
+	if transports.m == nil {
+		transports.m = make(map[serviceTLS]*http.Transport)
+	}
+	transports.m[st] = t
+	return t
+}
@@ -0,0 +1,384 @@
+//go:build !noplugins
+
+package services
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+func init() {
+	Register(&ImporterPlugin{})
+}
+
+// ImporterPlugin imports a curated subset of metrics — CPU, memory, load
+// and active alerts — from a Netdata or Glances instance already running
+// on the host, so its alerting carries over without collecting twice.
+// "url" points at an instance elsewhere; "username" and "password" are
+// for a Glances server started with --password.
+type ImporterPlugin struct{}
+
+func (p *ImporterPlugin) ID() string   { return "importer" }
+func (p *ImporterPlugin) Name() string { return "Monitoring" }
+func (p *ImporterPlugin) Icon() string { return "chart.xyaxis.line" }
+
+const (
+	netdataDefaultPort = 19999
+	glancesDefaultPort = 61208
+)
+
+func (p *ImporterPlugin) Detect(ctx context.Context, env *DetectionEnv) *DetectedService {
+	base := &DetectedService{
+		PluginID: p.ID(),
+		Icon:     p.Icon(),
+		Meta:     make(map[string]string),
+	}
+	found := func(source, url, how string) *DetectedService {
+		base.BaseURL = url
+		base.Meta["source"] = source
+		base.Name = map[string]string{"netdata": "Netdata", "glances": "Glances"}[source]
+		log.Printf("services: %s detected via %s at %s", source, how, url)
+		return base
+	}
+
+	// Strategy 1: an instance configured by address
+	if url := strings.TrimRight(env.Config(p.ID(), "url"), "/"); url != "" {
+		if _, err := HTTPGet(ctx, url+"/api/v1/info"); err == nil {
+			return found("netdata", url, "config")
+		}
+		return found("glances", url, "config")
+	}
+
+	// Strategy 2: Docker container
+	// Strategy 3: process
+	var netdataPorts, glancesPorts []int
+	if c := env.FindDockerImage("netdata"); c != nil && c.State == "running" {
+		netdataPorts = append(netdataPorts, c.HostPorts...)
+	}
+	if env.HasProcess("netdata") {
+		netdataPorts = append(netdataPorts, env.FindProcessPorts("netdata")...)
+	}
+	if c := env.FindDockerImage("glances"); c != nil && c.State == "running" {
+		glancesPorts = append(glancesPorts, c.HostPorts...)
+	}
+	if env.HasProcessSubstring("glances") {
+		glancesPorts = append(glancesPorts, env.FindProcessPortsBySubstring("glances")...)
+	}
+
+	if len(netdataPorts) > 0 {
+		if url := env.ProbeHTTP(append(netdataPorts, netdataDefaultPort), "/api/v1/info"); url != "" {
+			return found("netdata", url, "local install")
+		}
+	}
+	if len(glancesPorts) > 0 {
+		// Glances 4 serves /api/4, earlier releases /api/3.
+		for _, version := range []string{"4", "3"} {
+			if url := env.ProbeHTTP(append(glancesPorts, glancesDefaultPort), "/api/"+version+"/quicklook"); url != "" {
+				base.Meta["apiVersion"] = version
+				return found("glances", url, "local install")
+			}
+		}
+		// A password-protected server answers 401; collect reports authRequired.
+		base.Meta["apiVersion"] = "4"
+		return found("glances", fmt.Sprintf("http://127.0.0.1:%d", glancesDefaultPort), "local install")
+	}
+	return nil
+}
+
+// importedAlert is an alert raised by the source, in a common shape.
+type importedAlert struct {
+	Name   string
+	Status string // "warning" or "critical"
+	Value  string
+	Since  time.Time
+}
+
+// importedMetrics is the curated subset read from either source.
+type importedMetrics struct {
+	Version       string
+	CPUPercent    float64
+	MemoryPercent float64
+	Load          [3]float64
+	Alerts        []importedAlert
+}
+
+func (p *ImporterPlugin) Collect(ctx context.Context, svc *DetectedService) (*ServiceStats, error) {
+	var (
+		m   *importedMetrics
+		err error
+	)
+	if svc.Meta["source"] == "netdata" {
+		m, err = collectNetdata(ctx, svc.BaseURL)
+	} else {
+		m, err = collectGlances(ctx, svc)
+	}
+	if err != nil {
+		if err.Error() == "HTTP 401" && svc.Meta["password"] == "" {
+			return &ServiceStats{
+				PluginID: p.ID(),
+				Name:     svc.Name,
+				Icon:     p.Icon(),
+				Status:   StatusAuthRequired,
+				StatusReason: &StatusReason{
+					Code:    "credentials_missing",
+					Message: "set password for " + svc.Name,
+				},
+				Summary: []StatItem{
+					{Label: "Status", Value: "Running", Type: "status"},
+				},
+				Stats: map[string]interface{}{"authRequired": true},
+			}, nil
+		}
+		return nil, fmt.Errorf("could not reach %s at %s: %w", svc.Name, svc.BaseURL, err)
+	}
+
+	var warning, critical int
+	alerts := make([]map[string]interface{}, 0, len(m.Alerts))
+	sort.Slice(m.Alerts, func(i, j int) bool {
+		if m.Alerts[i].Status != m.Alerts[j].Status {
+			return m.Alerts[i].Status == "critical"
+		}
+		return m.Alerts[i].Name < m.Alerts[j].Name
+	})
+	for _, a := range m.Alerts {
+		if a.Status == "critical" {
+			critical++
+		} else {
+			warning++
+		}
+		entry := map[string]interface{}{
+			"name":   a.Name,
+			"status": a.Status,
+			"value":  a.Value,
+		}
+		if !a.Since.IsZero() {
+			entry["since"] = a.Since.UTC().Format(time.RFC3339)
+		}
+		alerts = append(alerts, entry)
+	}
+
+	round := func(v float64) float64 { return math.Round(v*10) / 10 }
+	stats := &ServiceStats{
+		PluginID: p.ID(),
+		Name:     svc.Name,
+		Icon:     p.Icon(),
+		Status:   StatusRunning,
+		Summary: []StatItem{
+			{Label: "CPU", Value: fmt.Sprintf("%.1f%%", m.CPUPercent), Type: "percent"},
+			{Label: "Memory", Value: fmt.Sprintf("%.1f%%", m.MemoryPercent), Type: "percent"},
+			{Label: "Load", Value: fmt.Sprintf("%.2f", m.Load[0]), Type: "text"},
+			{Label: "Alerts", Value: FormatNumber(int64(warning + critical)), Type: "number"},
+		},
+		Stats: map[string]interface{}{
+			"source":         svc.Meta["source"],
+			"version":        m.Version,
+			"cpuPercent":     round(m.CPUPercent),
+			"memoryPercent":  round(m.MemoryPercent),
+			"load1":          m.Load[0],
+			"load5":          m.Load[1],
+			"load15":         m.Load[2],
+			"alertsWarning":  warning,
+			"alertsCritical": critical,
+			"alerts":         alerts,
+		},
+	}
+	if critical > 0 {
+		stats.degrade("alerts_critical", fmt.Sprintf("%d critical alerts", critical))
+	}
+	return stats, nil
+}
+
+// --- Netdata ---
+
+func collectNetdata(ctx context.Context, baseURL string) (*importedMetrics, error) {
+	body, err := HTTPGet(ctx, baseURL+"/api/v1/info")
+	if err != nil {
+		return nil, err
+	}
+	var info struct {
+		Version string `json:"version"`
+	}
+	json.Unmarshal(body, &info)
+	m := &importedMetrics{Version: strings.TrimPrefix(info.Version, "v")}
+
+	if cpu, err := netdataLatest(ctx, baseURL, "system.cpu"); err == nil {
+		for _, v := range cpu {
+			m.CPUPercent += v
+		}
+	} else {
+		log.Printf("services: netdata system.cpu: %v", err)
+	}
+	if ram, err := netdataLatest(ctx, baseURL, "system.ram"); err == nil {
+		var total float64
+		for _, v := range ram {
+			total += v
+		}
+		if total > 0 {
+			m.MemoryPercent = ram["used"] / total * 100
+		}
+	} else {
+		log.Printf("services: netdata system.ram: %v", err)
+	}
+	if load, err := netdataLatest(ctx, baseURL, "system.load"); err == nil {
+		m.Load = [3]float64{load["load1"], load["load5"], load["load15"]}
+	}
+
+	body, err = HTTPGet(ctx, baseURL+"/api/v1/alarms")
+	if err != nil {
+		return nil, err
+	}
+	var alarms struct {
+		Alarms map[string]struct {
+			Name             string `json:"name"`
+			Chart            string `json:"chart"`
+			Status           string `json:"status"`
+			ValueString      string `json:"value_string"`
+			LastStatusChange int64  `json:"last_status_change"`
+		} `json:"alarms"`
+	}
+	if err := json.Unmarshal(body, &alarms); err != nil {
+		return nil, fmt.Errorf("invalid Netdata alarms response: %w", err)
+	}
+	for _, a := range alarms.Alarms {
+		status := strings.ToLower(a.Status)
+		if status != "warning" && status != "critical" {
+			continue
+		}
+		alert := importedAlert{Name: a.Chart + "." + a.Name, Status: status, Value: a.ValueString}
+		if a.LastStatusChange > 0 {
+			alert.Since = time.Unix(a.LastStatusChange, 0)
+		}
+		m.Alerts = append(m.Alerts, alert)
+	}
+	return m, nil
+}
+
+// netdataLatest returns a chart's dimensions averaged over the last few
+// seconds.
+func netdataLatest(ctx context.Context, baseURL, chart string) (map[string]float64, error) {
+	body, err := HTTPGet(ctx, baseURL+"/api/v1/data?chart="+chart+"&after=-5&points=1&group=average&format=json")
+	if err != nil {
+		return nil, err
+	}
+	var data struct {
+		Labels []string    `json:"labels"`
+		Data   [][]float64 `json:"data"`
+	}
+	if err := json.Unmarshal(body, &data); err != nil {
+		return nil, err
+	}
+	if len(data.Data) == 0 {
+		return nil, fmt.Errorf("no data for %s", chart)
+	}
+	dims := make(map[string]float64)
+	for i, label := range data.Labels {
+		if i > 0 && i < len(data.Data[0]) { // column 0 is the timestamp
+			dims[label] = data.Data[0][i]
+		}
+	}
+	return dims, nil
+}
+
+// --- Glances ---
+
+func collectGlances(ctx context.Context, svc *DetectedService) (*importedMetrics, error) {
+	api := svc.BaseURL + "/api/" + svc.Meta["apiVersion"]
+	if svc.Meta["apiVersion"] == "" {
+		api = svc.BaseURL + "/api/4"
+	}
+	headers := map[string]string{}
+	if svc.Meta["password"] != "" {
+		username := svc.Meta["username"]
+		if username == "" {
+			username = "glances"
+		}
+		headers["Authorization"] = "Basic " + base64.StdEncoding.EncodeToString([]byte(username+":"+svc.Meta["password"]))
+	}
+	get := func(path string, out interface{}) error {
+		body, err := HTTPGetWithHeaders(ctx, api+path, headers)
+		if err != nil {
+			return err
+		}
+		return json.Unmarshal(body, out)
+	}
+
+	var quick struct {
+		CPU float64 `json:"cpu"`
+		Mem float64 `json:"mem"`
+	}
+	if err := get("/quicklook", &quick); err != nil {
+		return nil, err
+	}
+	m := &importedMetrics{CPUPercent: quick.CPU, MemoryPercent: quick.Mem}
+
+	var load struct {
+		Min1  float64 `json:"min1"`
+		Min5  float64 `json:"min5"`
+		Min15 float64 `json:"min15"`
+	}
+	if err := get("/load", &load); err == nil {
+		m.Load = [3]float64{load.Min1, load.Min5, load.Min15}
+	}
+	var version string
+	if err := get("/version", &version); err == nil {
+		m.Version = version
+	}
+
+	// Ongoing alerts have end -1; finished ones stay in the list for a while.
+	var raw json.RawMessage
+	if err := get("/alert", &raw); err != nil {
+		log.Printf("services: glances alerts: %v", err)
+	}
+	for _, a := range parseGlancesAlerts(raw) {
+		status := strings.ToLower(a.State)
+		if a.End != -1 || (status != "warning" && status != "critical") {
+			continue
+		}
+		m.Alerts = append(m.Alerts, importedAlert{
+			Name:   a.Type,
+			Status: status,
+			Value:  fmt.Sprintf("%.1f", a.Max),
+			Since:  time.Unix(int64(a.Begin), 0),
+		})
+	}
+	return m, nil
+}
+
+type glancesAlert struct {
+	Begin float64 `json:"begin"`
+	End   float64 `json:"end"`
+	State string  `json:"state"`
+	Type  string  `json:"type"`
+	Max   float64 `json:"max"`
+}
+
+// parseGlancesAlerts reads the alert list: objects in Glances 4, arrays of
+// [begin, end, state, type, max, ...] in Glances 3.
+func parseGlancesAlerts(raw json.RawMessage) []glancesAlert {
+	var alerts []glancesAlert
+	if json.Unmarshal(raw, &alerts) == nil {
+		return alerts
+	}
+	var rows [][]json.RawMessage
+	json.Unmarshal(raw, &rows)
+	for _, row := range rows {
+		if len(row) < 5 {
+			continue
+		}
+		var a glancesAlert
+		json.Unmarshal(row[0], &a.Begin)
+		json.Unmarshal(row[1], &a.End)
+		json.Unmarshal(row[2], &a.State)
+		json.Unmarshal(row[3], &a.Type)
+		json.Unmarshal(row[4], &a.Max)
+		alerts = append(alerts, a)
+	}
+	return alerts
+}
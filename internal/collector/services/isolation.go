@@ -0,0 +1,156 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"runtime/debug"
+	"time"
+)
+
+// Plugin isolation: every Detect and Collect call runs in its own goroutine
+// with its own timeout, and a panic becomes an error for that plugin alone.
+// A call that overruns its timeout is abandoned but keeps running; until it
+// returns, further calls for the same plugin and phase fail fast instead of
+// piling up goroutines.
+
+const detectTimeout = 10 * time.Second
+
+const (
+	phaseDetect  = "detect"
+	phaseCollect = "collect"
+)
+
+var errPluginBusy = errors.New("previous call has not returned yet")
+
+// PluginMetrics counts a plugin's Detect and Collect outcomes since start.
+// Errors include panics and timeouts; Detect has no errors of its own.
+type PluginMetrics struct {
+	DetectCalls     uint64     `json:"detectCalls"`
+	DetectPanics    uint64     `json:"detectPanics"`
+	DetectTimeouts  uint64     `json:"detectTimeouts"`
+	CollectCalls    uint64     `json:"collectCalls"`
+	CollectErrors   uint64     `json:"collectErrors"`
+	CollectPanics   uint64     `json:"collectPanics"`
+	CollectTimeouts uint64     `json:"collectTimeouts"`
+	LastError       string     `json:"lastError,omitempty"`
+	LastErrorAt     *time.Time `json:"lastErrorAt,omitempty"`
+}
+
+type pluginRuntime struct {
+	metrics PluginMetrics
+	busy    map[string]bool // phase → an abandoned call is still running
+}
+
+// PluginMetrics returns the per-plugin call counters, keyed by plugin ID.
+func (sd *ServiceDetector) PluginMetrics() map[string]PluginMetrics {
+	sd.runtimeMu.Lock()
+	defer sd.runtimeMu.Unlock()
+	out := make(map[string]PluginMetrics, len(sd.runtime))
+	for id, rt := range sd.runtime {
+		out[id] = rt.metrics
+	}
+	return out
+}
+
+// isolate runs one plugin call under the plugin isolation rules above.
+func isolate[T any](sd *ServiceDetector, id, phase string, timeout time.Duration, fn func(context.Context) (T, error)) (T, error) {
+	var zero T
+	sd.runtimeMu.Lock()
+	rt := sd.runtime[id]
+	if rt == nil {
+		rt = &pluginRuntime{busy: make(map[string]bool)}
+		sd.runtime[id] = rt
+	}
+	busy := rt.busy[phase]
+	if !busy {
+		rt.busy[phase] = true
+	}
+	sd.runtimeMu.Unlock()
+	if busy {
+		sd.recordPluginError(id, phase, errPluginBusy, "")
+		return zero, errPluginBusy
+	}
+
+	type outcome struct {
+		val      T
+		err      error
+		panicked bool
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	done := make(chan outcome, 1)
+	go func() {
+		defer cancel()
+		defer func() {
+			sd.runtimeMu.Lock()
+			rt.busy[phase] = false
+			sd.runtimeMu.Unlock()
+		}()
+		defer func() {
+			if p := recover(); p != nil {
+				log.Printf("services: plugin %s panicked in %s: %v\n%s", id, phase, p, debug.Stack())
+				done <- outcome{err: fmt.Errorf("plugin panicked: %v", p), panicked: true}
+			}
+		}()
+		val, err := fn(ctx)
+		done <- outcome{val: val, err: err}
+	}()
+
+	select {
+	case o := <-done:
+		switch {
+		case o.panicked:
+			sd.recordPluginError(id, phase, o.err, "panic")
+		case o.err != nil:
+			sd.recordPluginError(id, phase, o.err, "")
+		default:
+			sd.recordPluginCall(id, phase)
+		}
+		return o.val, o.err
+	case <-time.After(timeout + time.Second):
+		// The plugin ignored its context; leave it running.
+		err := fmt.Errorf("plugin did not return within %s", timeout)
+		sd.recordPluginError(id, phase, err, "timeout")
+		return zero, err
+	}
+}
+
+func (sd *ServiceDetector) recordPluginCall(id, phase string) {
+	sd.runtimeMu.Lock()
+	defer sd.runtimeMu.Unlock()
+	m := &sd.runtime[id].metrics
+	if phase == phaseDetect {
+		m.DetectCalls++
+	} else {
+		m.CollectCalls++
+	}
+}
+
+// recordPluginError counts a failed call; kind is "panic", "timeout" or
+// empty for an error the plugin returned.
+func (sd *ServiceDetector) recordPluginError(id, phase string, err error, kind string) {
+	now := time.Now()
+	sd.runtimeMu.Lock()
+	defer sd.runtimeMu.Unlock()
+	m := &sd.runtime[id].metrics
+	m.LastError, m.LastErrorAt = err.Error(), &now
+	if phase == phaseDetect {
+		m.DetectCalls++
+		switch kind {
+		case "panic":
+			m.DetectPanics++
+		case "timeout":
+			m.DetectTimeouts++
+		}
+		return
+	}
+	m.CollectCalls++
+	m.CollectErrors++
+	switch kind {
+	case "panic":
+		m.CollectPanics++
+	case "timeout":
+		m.CollectTimeouts++
+	}
+}
@@ -1,3 +1,5 @@
+//go:build !noplugins
+
 package services
 
 import (
@@ -8,14 +10,21 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 )
 
 func init() {
-	Register(&NginxPlugin{})
+	Register(&NginxPlugin{lastDropped: -1})
 }
 
-// NginxPlugin detects and collects stats from Nginx's stub_status module.
-type NginxPlugin struct{}
+// NginxPlugin detects and collects stats from Nginx's stub_status module,
+// or from the Nginx Plus API or vts module when one is enabled (see
+// nginxapi.go). "accessLog" adds access log analytics, see accesslog.go.
+type NginxPlugin struct {
+	mu          sync.Mutex
+	lastDropped int64 // dropped connections at the previous collection, -1 before the first
+	logs        accessLogs
+}
 
 func (p *NginxPlugin) ID() string   { return "nginx" }
 func (p *NginxPlugin) Name() string { return "Nginx" }
@@ -36,10 +45,11 @@ func (p *NginxPlugin) Detect(ctx context.Context, env *DetectionEnv) *DetectedSe
 	if c := env.FindDockerImage("nginx"); c != nil && c.State == "running" {
 		if !strings.Contains(strings.ToLower(c.Image), "traefik") {
 			ports := append(c.HostPorts, 80, 8080)
-			if url, path := probeNginxStatus(env, ports); url != "" {
+			if url := probeNginxStatus(ctx, env, ports, base.Meta); url != "" {
 				base.BaseURL = url
-				base.Meta["statusPath"] = path
-				log.Printf("services: nginx detected via docker (%s) at %s%s", c.Image, url, path)
+				base.Meta["container"] = c.Name
+				base.Meta["dockerSocket"] = env.DockerSocket
+				log.Printf("services: nginx detected via docker (%s) at %s (%s)", c.Image, url, nginxSource(base.Meta))
 				return base
 			}
 		}
@@ -49,10 +59,9 @@ func (p *NginxPlugin) Detect(ctx context.Context, env *DetectionEnv) *DetectedSe
 	if env.HasProcess("nginx") {
 		ports := env.FindProcessPorts("nginx")
 		ports = append(ports, 80, 8080, 443, 8443)
-		if url, path := probeNginxStatus(env, ports); url != "" {
+		if url := probeNginxStatus(ctx, env, ports, base.Meta); url != "" {
 			base.BaseURL = url
-			base.Meta["statusPath"] = path
-			log.Printf("services: nginx detected via process at %s%s", url, path)
+			log.Printf("services: nginx detected via process at %s (%s)", url, nginxSource(base.Meta))
 			return base
 		}
 	}
@@ -60,17 +69,48 @@ func (p *NginxPlugin) Detect(ctx context.Context, env *DetectionEnv) *DetectedSe
 	return nil
 }
 
-// probeNginxStatus tries each status path on each port, returns (baseURL, path) or ("", "").
-func probeNginxStatus(env *DetectionEnv, ports []int) (string, string) {
+// probeNginxStatus tries each stub_status path on each port, then the
+// Plus API and vts paths, and returns the base URL or "". Where nginx
+// answers it also looks for the Plus API or vts; meta records the
+// stub_status path and the module found.
+func probeNginxStatus(ctx context.Context, env *DetectionEnv, ports []int, meta map[string]string) string {
 	for _, path := range nginxStatusPaths {
 		if url := env.ProbeHTTP(ports, path); url != "" {
-			return url, path
+			meta["statusPath"] = path
+			detectNginxModule(ctx, url, meta)
+			return url
 		}
 	}
-	return "", ""
+	for _, path := range append([]string{"/api/"}, nginxVTSPaths...) {
+		if url := env.ProbeHTTP(ports, path); url != "" && detectNginxModule(ctx, url, meta) {
+			return url
+		}
+	}
+	return ""
+}
+
+// nginxSource names where the stats come from, for logs and the card.
+func nginxSource(meta map[string]string) string {
+	switch meta["module"] {
+	case nginxModulePlus:
+		return "Nginx Plus API"
+	case nginxModuleVTS:
+		return "vts"
+	}
+	return "stub_status"
 }
 
 func (p *NginxPlugin) Collect(ctx context.Context, svc *DetectedService) (*ServiceStats, error) {
+	if svc.Meta["module"] != "" {
+		m, err := collectNginxModule(ctx, svc)
+		if err != nil {
+			return nil, err
+		}
+		stats := p.moduleStats(svc, m)
+		p.logs.apply(svc, stats)
+		return stats, nil
+	}
+
 	statusPath := svc.Meta["statusPath"]
 	if statusPath == "" {
 		statusPath = "/nginx_status"
@@ -87,12 +127,13 @@ func (p *NginxPlugin) Collect(ctx context.Context, svc *DetectedService) (*Servi
 	}
 
 	dropped := parsed.accepts - parsed.handled
+	newlyDropped := p.droppedSince(dropped)
 
-	return &ServiceStats{
+	stats := &ServiceStats{
 		PluginID: p.ID(),
 		Name:     p.Name(),
 		Icon:     p.Icon(),
-		Status:   "running",
+		Status:   StatusRunning,
 		Summary: []StatItem{
 			{Label: "Active Connections", Value: FormatNumber(parsed.activeConnections), Type: "number"},
 			{Label: "Total Requests", Value: FormatNumber(parsed.requests), Type: "number"},
@@ -100,6 +141,7 @@ func (p *NginxPlugin) Collect(ctx context.Context, svc *DetectedService) (*Servi
 			{Label: "Writing", Value: FormatNumber(parsed.writing), Type: "number"},
 		},
 		Stats: map[string]interface{}{
+			"source":            "stub_status",
 			"activeConnections": parsed.activeConnections,
 			"accepts":           parsed.accepts,
 			"handled":           parsed.handled,
@@ -109,7 +151,85 @@ func (p *NginxPlugin) Collect(ctx context.Context, svc *DetectedService) (*Servi
 			"waiting":           parsed.waiting,
 			"dropped":           dropped,
 		},
-	}, nil
+	}
+	if newlyDropped > 0 {
+		stats.degrade("connections_dropped", fmt.Sprintf("%d connections dropped since the last check", newlyDropped))
+	}
+	p.logs.apply(svc, stats)
+	return stats, nil
+}
+
+// moduleStats builds the card from the Plus API or vts: the stub_status
+// counters plus per-zone traffic and upstream server states.
+func (p *NginxPlugin) moduleStats(svc *DetectedService, m *nginxModuleStats) *ServiceStats {
+	m.sortZones()
+	dropped := m.accepts - m.handled
+	newlyDropped := p.droppedSince(dropped)
+	failing, peers := m.failingPeers()
+
+	var errors5xx int64
+	for _, z := range m.zones {
+		errors5xx += z.Responses.R5xx
+	}
+	zones := m.zones
+	if zones == nil {
+		zones = []nginxZone{}
+	}
+	upstreams := m.upstreams
+	if upstreams == nil {
+		upstreams = []nginxUpstreamGroup{}
+	}
+
+	stats := &ServiceStats{
+		PluginID: p.ID(),
+		Name:     p.Name(),
+		Icon:     p.Icon(),
+		Status:   StatusRunning,
+		Summary: []StatItem{
+			{Label: "Active Connections", Value: FormatNumber(m.activeConnections), Type: "number"},
+			{Label: "Total Requests", Value: FormatNumber(m.requests), Type: "number"},
+			{Label: "Server Zones", Value: FormatNumber(int64(len(m.zones))), Type: "number"},
+			{Label: "Upstreams Up", Value: fmt.Sprintf("%d/%d", peers-failing, peers), Type: "text"},
+		},
+		Stats: map[string]interface{}{
+			"source":            svc.Meta["module"],
+			"activeConnections": m.activeConnections,
+			"accepts":           m.accepts,
+			"handled":           m.handled,
+			"requests":          m.requests,
+			"dropped":           dropped,
+			"serverZones":       zones,
+			"upstreams":         upstreams,
+			"responses5xx":      errors5xx,
+			"failingUpstreams":  failing,
+		},
+	}
+	if m.rww != nil {
+		stats.Stats["reading"] = m.rww[0]
+		stats.Stats["writing"] = m.rww[1]
+		stats.Stats["waiting"] = m.rww[2]
+	}
+	switch {
+	case failing > 0:
+		stats.degrade("upstreams_failing", fmt.Sprintf("%d of %d upstream servers down", failing, peers))
+	case newlyDropped > 0:
+		stats.degrade("connections_dropped", fmt.Sprintf("%d connections dropped since the last check", newlyDropped))
+	}
+	return stats
+}
+
+// droppedSince returns the connections dropped (worker_connections
+// exhausted) since the last collection. The counters are cumulative; only
+// new drops degrade the card.
+func (p *NginxPlugin) droppedSince(dropped int64) int64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	newlyDropped := dropped - p.lastDropped
+	if p.lastDropped < 0 || newlyDropped < 0 {
+		newlyDropped = 0 // first collection, or nginx restarted
+	}
+	p.lastDropped = dropped
+	return newlyDropped
 }
 
 // stubStatus holds parsed Nginx stub_status values.
@@ -0,0 +1,310 @@
+//go:build !noplugins
+
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+)
+
+// Richer sources than stub_status: the Nginx Plus REST API and the
+// third-party vhost_traffic_status (vts) module. Both report traffic per
+// server zone and the state of each upstream server. Detection records
+// which one answered in Meta["module"] ("plus" or "vts"), with the API
+// version in Meta["apiVersion"] or the JSON path in Meta["vtsPath"]; the
+// card then comes from it instead of stub_status.
+
+const (
+	nginxModulePlus = "plus"
+	nginxModuleVTS  = "vts"
+
+	maxNginxZones = 50 // busiest server zones reported
+)
+
+// Common vhost_traffic_status_display locations, JSON format.
+var nginxVTSPaths = []string{"/status/format/json", "/vts/format/json", "/vts_status/format/json"}
+
+// nginxResponses counts responses by status class.
+type nginxResponses struct {
+	R1xx int64 `json:"1xx"`
+	R2xx int64 `json:"2xx"`
+	R3xx int64 `json:"3xx"`
+	R4xx int64 `json:"4xx"`
+	R5xx int64 `json:"5xx"`
+}
+
+// nginxZone is one server zone's totals.
+type nginxZone struct {
+	Name          string         `json:"name"`
+	Requests      int64          `json:"requests"`
+	Responses     nginxResponses `json:"responses"`
+	ReceivedBytes int64          `json:"receivedBytes"`
+	SentBytes     int64          `json:"sentBytes"`
+}
+
+// nginxPeer is one server of an upstream group.
+type nginxPeer struct {
+	Server    string         `json:"server"`
+	State     string         `json:"state"` // up, down, unavail, unhealthy, draining, checking
+	Backup    bool           `json:"backup"`
+	Requests  int64          `json:"requests"`
+	Responses nginxResponses `json:"responses"`
+}
+
+// failing reports whether the peer is out of rotation because it failed,
+// as opposed to being drained or still checked.
+func (p nginxPeer) failing() bool {
+	return p.State == "down" || p.State == "unavail" || p.State == "unhealthy"
+}
+
+// nginxUpstreamGroup is an upstream group and its servers.
+type nginxUpstreamGroup struct {
+	Name  string      `json:"name"`
+	Peers []nginxPeer `json:"peers"`
+}
+
+// nginxModuleStats is what either module reports, in a common shape. The
+// connection counters match stub_status; reading, writing and waiting are
+// only known from vts.
+type nginxModuleStats struct {
+	activeConnections int64
+	accepts           int64
+	handled           int64
+	requests          int64
+	rww               *[3]int64
+	zones             []nginxZone
+	upstreams         []nginxUpstreamGroup
+}
+
+// detectNginxModule looks for the Nginx Plus API, then a vts status page,
+// on an nginx already found at baseURL, and records the first in meta.
+func detectNginxModule(ctx context.Context, baseURL string, meta map[string]string) bool {
+	if v, err := nginxPlusVersion(ctx, baseURL); err == nil {
+		meta["module"] = nginxModulePlus
+		meta["apiVersion"] = strconv.Itoa(v)
+		return true
+	}
+	for _, path := range nginxVTSPaths {
+		body, err := HTTPGet(ctx, baseURL+path)
+		if err != nil {
+			continue
+		}
+		var probe struct {
+			ServerZones map[string]json.RawMessage `json:"serverZones"`
+		}
+		if json.Unmarshal(body, &probe) == nil && probe.ServerZones != nil {
+			meta["module"] = nginxModuleVTS
+			meta["vtsPath"] = path
+			return true
+		}
+	}
+	return false
+}
+
+// nginxPlusVersion returns the newest API version the Plus API offers;
+// GET /api/ lists them, e.g. [1,2,3,4,5,6,7,8,9].
+func nginxPlusVersion(ctx context.Context, baseURL string) (int, error) {
+	body, err := HTTPGet(ctx, baseURL+"/api/")
+	if err != nil {
+		return 0, err
+	}
+	var versions []int
+	if err := json.Unmarshal(body, &versions); err != nil || len(versions) == 0 {
+		return 0, fmt.Errorf("not an Nginx Plus API")
+	}
+	return slices.Max(versions), nil
+}
+
+func collectNginxModule(ctx context.Context, svc *DetectedService) (*nginxModuleStats, error) {
+	if svc.Meta["module"] == nginxModulePlus {
+		return collectNginxPlus(ctx, svc.BaseURL+"/api/"+svc.Meta["apiVersion"])
+	}
+	return collectNginxVTS(ctx, svc.BaseURL+svc.Meta["vtsPath"])
+}
+
+func collectNginxPlus(ctx context.Context, api string) (*nginxModuleStats, error) {
+	get := func(path string, out interface{}) error {
+		body, err := HTTPGet(ctx, api+path)
+		if err != nil {
+			return fmt.Errorf("could not reach Nginx Plus API at %s%s: %w", api, path, err)
+		}
+		if err := json.Unmarshal(body, out); err != nil {
+			return fmt.Errorf("invalid Nginx Plus %s response: %w", path, err)
+		}
+		return nil
+	}
+
+	var conns struct {
+		Accepted int64 `json:"accepted"`
+		Dropped  int64 `json:"dropped"`
+		Active   int64 `json:"active"`
+	}
+	if err := get("/connections", &conns); err != nil {
+		return nil, err
+	}
+	var requests struct {
+		Total int64 `json:"total"`
+	}
+	if err := get("/http/requests", &requests); err != nil {
+		return nil, err
+	}
+	m := &nginxModuleStats{
+		activeConnections: conns.Active,
+		accepts:           conns.Accepted,
+		handled:           conns.Accepted - conns.Dropped,
+		requests:          requests.Total,
+	}
+
+	// Zones and upstreams exist only when configured; a missing one
+	// leaves its list empty.
+	var zones map[string]struct {
+		Requests  int64          `json:"requests"`
+		Responses nginxResponses `json:"responses"`
+		Received  int64          `json:"received"`
+		Sent      int64          `json:"sent"`
+	}
+	if get("/http/server_zones", &zones) == nil {
+		for name, z := range zones {
+			m.zones = append(m.zones, nginxZone{
+				Name:          name,
+				Requests:      z.Requests,
+				Responses:     z.Responses,
+				ReceivedBytes: z.Received,
+				SentBytes:     z.Sent,
+			})
+		}
+	}
+	var upstreams map[string]struct {
+		Peers []struct {
+			Server    string         `json:"server"`
+			State     string         `json:"state"`
+			Backup    bool           `json:"backup"`
+			Requests  int64          `json:"requests"`
+			Responses nginxResponses `json:"responses"`
+		} `json:"peers"`
+	}
+	if get("/http/upstreams", &upstreams) == nil {
+		for name, u := range upstreams {
+			up := nginxUpstreamGroup{Name: name, Peers: make([]nginxPeer, 0, len(u.Peers))}
+			for _, p := range u.Peers {
+				up.Peers = append(up.Peers, nginxPeer(p))
+			}
+			m.upstreams = append(m.upstreams, up)
+		}
+	}
+	return m, nil
+}
+
+// collectNginxVTS reads the vts JSON status page:
+//
+//	{"connections": {"active": 3, "reading": 0, ..., "accepted": 120, "handled": 120, "requests": 450},
+//	 "serverZones": {"example.com": {"requestCounter": 450, "inBytes": ..., "outBytes": ..., "responses": {"2xx": 440, ...}}},
+//	 "upstreamZones": {"backend": [{"server": "10.0.0.5:8080", "requestCounter": 300, "responses": {...}, "backup": false, "down": false}]}}
+func collectNginxVTS(ctx context.Context, url string) (*nginxModuleStats, error) {
+	body, err := HTTPGet(ctx, url)
+	if err != nil {
+		return nil, fmt.Errorf("could not reach Nginx vts status at %s: %w", url, err)
+	}
+	var doc struct {
+		Connections struct {
+			Active   int64 `json:"active"`
+			Reading  int64 `json:"reading"`
+			Writing  int64 `json:"writing"`
+			Waiting  int64 `json:"waiting"`
+			Accepted int64 `json:"accepted"`
+			Handled  int64 `json:"handled"`
+			Requests int64 `json:"requests"`
+		} `json:"connections"`
+		ServerZones map[string]struct {
+			RequestCounter int64          `json:"requestCounter"`
+			InBytes        int64          `json:"inBytes"`
+			OutBytes       int64          `json:"outBytes"`
+			Responses      nginxResponses `json:"responses"`
+		} `json:"serverZones"`
+		UpstreamZones map[string][]struct {
+			Server         string         `json:"server"`
+			RequestCounter int64          `json:"requestCounter"`
+			Responses      nginxResponses `json:"responses"`
+			Backup         bool           `json:"backup"`
+			Down           bool           `json:"down"`
+		} `json:"upstreamZones"`
+	}
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return nil, fmt.Errorf("invalid Nginx vts response: %w", err)
+	}
+
+	c := doc.Connections
+	m := &nginxModuleStats{
+		activeConnections: c.Active,
+		accepts:           c.Accepted,
+		handled:           c.Handled,
+		requests:          c.Requests,
+		rww:               &[3]int64{c.Reading, c.Writing, c.Waiting},
+	}
+	for name, z := range doc.ServerZones {
+		if name == "*" { // sum of all zones
+			continue
+		}
+		m.zones = append(m.zones, nginxZone{
+			Name:          name,
+			Requests:      z.RequestCounter,
+			Responses:     z.Responses,
+			ReceivedBytes: z.InBytes,
+			SentBytes:     z.OutBytes,
+		})
+	}
+	for name, peers := range doc.UpstreamZones {
+		up := nginxUpstreamGroup{Name: name, Peers: make([]nginxPeer, 0, len(peers))}
+		for _, p := range peers {
+			state := "up"
+			if p.Down {
+				state = "down"
+			}
+			up.Peers = append(up.Peers, nginxPeer{
+				Server:    p.Server,
+				State:     state,
+				Backup:    p.Backup,
+				Requests:  p.RequestCounter,
+				Responses: p.Responses,
+			})
+		}
+		m.upstreams = append(m.upstreams, up)
+	}
+	return m, nil
+}
+
+// sortZones orders zones busiest first and keeps maxNginxZones of them,
+// and upstreams by name.
+func (m *nginxModuleStats) sortZones() {
+	sort.Slice(m.zones, func(i, j int) bool {
+		if m.zones[i].Requests != m.zones[j].Requests {
+			return m.zones[i].Requests > m.zones[j].Requests
+		}
+		return m.zones[i].Name < m.zones[j].Name
+	})
+	if len(m.zones) > maxNginxZones {
+		m.zones = m.zones[:maxNginxZones]
+	}
+	sort.Slice(m.upstreams, func(i, j int) bool { return m.upstreams[i].Name < m.upstreams[j].Name })
+}
+
+// failingPeers counts primary upstream servers out of rotation; backups
+// only take traffic when the primaries fail.
+func (m *nginxModuleStats) failingPeers() (failing, total int) {
+	for _, u := range m.upstreams {
+		for _, p := range u.Peers {
+			if p.Backup {
+				continue
+			}
+			total++
+			if p.failing() {
+				failing++
+			}
+		}
+	}
+	return failing, total
+}
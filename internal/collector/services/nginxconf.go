@@ -0,0 +1,269 @@
+//go:build !noplugins
+
+package services
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Routes lists server blocks with the upstreams their locations proxy to.
+// The configuration comes from `nginx -T`, run in the container or on the
+// host; failing that, from /etc/nginx on the host with includes followed.
+func (p *NginxPlugin) Routes(ctx context.Context, svc *DetectedService) ([]Route, error) {
+	conf, err := nginxConfig(ctx, svc)
+	if err != nil {
+		return nil, err
+	}
+	return nginxRoutes(parseNginxConf(conf)), nil
+}
+
+const nginxConfRoot = "/etc/nginx/nginx.conf"
+
+func nginxConfig(ctx context.Context, svc *DetectedService) (string, error) {
+	if name := svc.Meta["container"]; name != "" {
+		out, err := execInContainer(ctx, svc.Meta["dockerSocket"], name, []string{"nginx", "-T"})
+		if err != nil {
+			return "", fmt.Errorf("could not dump the Nginx config in %s: %w", name, err)
+		}
+		return out, nil
+	}
+	if out, err := exec.CommandContext(ctx, "nginx", "-T").Output(); err == nil {
+		return string(out), nil
+	}
+	var b strings.Builder
+	if err := readNginxConf(HostPath(nginxConfRoot), filepath.Dir(HostPath(nginxConfRoot)), &b, 0); err != nil {
+		return "", fmt.Errorf("could not read the Nginx config: %w", err)
+	}
+	return b.String(), nil
+}
+
+// readNginxConf appends a config file and, after it, every file its
+// include directives name. Relative includes resolve against the config
+// directory, as nginx does.
+func readNginxConf(path, confDir string, b *strings.Builder, depth int) error {
+	if depth > 8 {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	b.Write(data)
+	b.WriteString("\n")
+	for _, d := range parseNginxConf(string(data)) {
+		walkNginx(d, func(d *nginxDirective) {
+			if d.name != "include" || len(d.args) == 0 {
+				return
+			}
+			pattern := d.args[0]
+			if filepath.IsAbs(pattern) {
+				pattern = HostPath(pattern)
+			} else {
+				pattern = filepath.Join(confDir, pattern)
+			}
+			matches, _ := filepath.Glob(pattern)
+			for _, m := range matches {
+				readNginxConf(m, confDir, b, depth+1)
+			}
+		})
+	}
+	return nil
+}
+
+// nginxDirective is one directive, with its block's children if it has one.
+type nginxDirective struct {
+	name     string
+	args     []string
+	children []*nginxDirective
+}
+
+func walkNginx(d *nginxDirective, fn func(*nginxDirective)) {
+	fn(d)
+	for _, c := range d.children {
+		walkNginx(c, fn)
+	}
+}
+
+// parseNginxConf parses nginx configuration syntax into directives. It is
+// lenient: unbalanced braces close at end of input.
+func parseNginxConf(conf string) []*nginxDirective {
+	tokens := tokenizeNginx(conf)
+	var parse func() []*nginxDirective
+	i := 0
+	parse = func() []*nginxDirective {
+		var list []*nginxDirective
+		var cur *nginxDirective
+		for i < len(tokens) {
+			t := tokens[i]
+			i++
+			switch t {
+			case ";":
+				if cur != nil {
+					list = append(list, cur)
+					cur = nil
+				}
+			case "{":
+				if cur == nil {
+					cur = &nginxDirective{}
+				}
+				cur.children = parse()
+				list = append(list, cur)
+				cur = nil
+			case "}":
+				return list
+			default:
+				if cur == nil {
+					cur = &nginxDirective{name: t}
+				} else {
+					cur.args = append(cur.args, t)
+				}
+			}
+		}
+		return list
+	}
+	return parse()
+}
+
+func tokenizeNginx(conf string) []string {
+	var tokens []string
+	var word strings.Builder
+	flush := func() {
+		if word.Len() > 0 {
+			tokens = append(tokens, word.String())
+			word.Reset()
+		}
+	}
+	for i := 0; i < len(conf); i++ {
+		c := conf[i]
+		switch {
+		case c == '#':
+			flush()
+			for i < len(conf) && conf[i] != '\n' {
+				i++
+			}
+		case c == '"' || c == '\'':
+			flush()
+			j := i + 1
+			for j < len(conf) && conf[j] != c {
+				if conf[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j > len(conf) {
+				j = len(conf)
+			}
+			tokens = append(tokens, conf[i+1:j])
+			i = j
+		case c == ';' || c == '{' || c == '}':
+			flush()
+			tokens = append(tokens, string(c))
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			flush()
+		default:
+			word.WriteByte(c)
+		}
+	}
+	flush()
+	return tokens
+}
+
+// nginxRoutes turns server blocks into routes. proxy_pass to a named
+// upstream block expands to that block's servers.
+func nginxRoutes(directives []*nginxDirective) []Route {
+	upstreams := make(map[string][]string)
+	var servers []*nginxDirective
+	for _, d := range directives {
+		walkNginx(d, func(d *nginxDirective) {
+			switch {
+			case d.name == "upstream" && len(d.args) > 0:
+				for _, c := range d.children {
+					if c.name == "server" && len(c.args) > 0 {
+						upstreams[d.args[0]] = append(upstreams[d.args[0]], c.args[0])
+					}
+				}
+			case d.name == "server" && d.children != nil:
+				servers = append(servers, d)
+			}
+		})
+	}
+
+	routes := []Route{}
+	for _, srv := range servers {
+		r := Route{Hosts: []string{}, Upstreams: []string{}}
+		var listens []string
+		seen := make(map[string]bool)
+		walkNginx(srv, func(d *nginxDirective) {
+			switch d.name {
+			case "server_name":
+				for _, h := range d.args {
+					if h != "_" && h != "" && h != `""` {
+						r.Hosts = append(r.Hosts, h)
+					}
+				}
+			case "listen":
+				listens = append(listens, strings.Join(d.args, " "))
+				for _, a := range d.args[1:] {
+					if a == "ssl" || a == "quic" {
+						r.TLS = true
+					}
+				}
+			case "ssl":
+				if len(d.args) > 0 && d.args[0] == "on" {
+					r.TLS = true
+				}
+			case "proxy_pass", "grpc_pass", "fastcgi_pass", "uwsgi_pass":
+				if len(d.args) == 0 {
+					return
+				}
+				for _, u := range nginxUpstream(d.args[0], upstreams) {
+					if !seen[u] {
+						seen[u] = true
+						r.Upstreams = append(r.Upstreams, u)
+					}
+				}
+			}
+		})
+		r.EntryPoints = listens
+		r.Name = "default"
+		if len(r.Hosts) > 0 {
+			r.Name = r.Hosts[0]
+		}
+		if len(listens) > 0 {
+			r.Name += " (" + strings.Fields(listens[0])[0] + ")"
+		}
+		routes = append(routes, r)
+	}
+	sort.SliceStable(routes, func(i, j int) bool { return routes[i].Name < routes[j].Name })
+	return routes
+}
+
+// nginxUpstream resolves a *_pass target, "http://backend/path" or
+// "unix:/run/app.sock", to upstream addresses.
+func nginxUpstream(target string, upstreams map[string][]string) []string {
+	scheme, rest, ok := strings.Cut(target, "://")
+	if !ok {
+		scheme, rest = "", target
+	}
+	host := rest
+	if i := strings.IndexByte(rest, '/'); i >= 0 {
+		host = rest[:i]
+	}
+	if servers, ok := upstreams[host]; ok {
+		var out []string
+		for _, s := range servers {
+			if scheme != "" {
+				s = scheme + "://" + s
+			}
+			out = append(out, s)
+		}
+		return out
+	}
+	return []string{target}
+}
@@ -0,0 +1,434 @@
+//go:build !noplugins
+
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/textproto"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/neur0map/deskmon-agent/internal/hostfs"
+)
+
+func init() {
+	Register(&PHPFPMPlugin{})
+}
+
+// PHPFPMPlugin detects PHP-FPM and collects each pool's status page
+// (pm.status_path). The page is read over FastCGI straight from the pool's
+// socket or port, so no web server has to expose it; "url" reads it
+// through one instead. Detection records the pools in Meta["pools"], as
+// comma-separated "address statusPath" pairs.
+type PHPFPMPlugin struct {
+	mu   sync.Mutex
+	prev map[string]phpFPMStatus // last status per address and pool, for counter deltas
+}
+
+func (p *PHPFPMPlugin) ID() string   { return "phpfpm" }
+func (p *PHPFPMPlugin) Name() string { return "PHP-FPM" }
+func (p *PHPFPMPlugin) Icon() string { return "chevron.left.forwardslash.chevron.right" }
+
+const phpFPMPort = 9000
+
+var (
+	// pm.status_path is unset by default; these are the usual choices.
+	phpFPMStatusPaths = []string{"/status", "/fpm-status", "/php-fpm-status"}
+
+	// Where distributions put pool sockets (listen = ...).
+	phpFPMSocketGlobs = []string{
+		"/run/php/*.sock",
+		"/run/php-fpm/*.sock",
+		"/var/run/php/*.sock",
+		"/var/run/php-fpm/*.sock",
+		"/var/run/php*-fpm.sock",
+	}
+)
+
+func (p *PHPFPMPlugin) Detect(ctx context.Context, env *DetectionEnv) *DetectedService {
+	base := &DetectedService{
+		PluginID: p.ID(),
+		Name:     p.Name(),
+		Icon:     p.Icon(),
+		Meta:     make(map[string]string),
+	}
+
+	// Strategy 1: status page behind a web server, configured by URL
+	if url := env.Config(p.ID(), "url"); url != "" {
+		base.BaseURL = url
+		log.Printf("services: phpfpm detected via config at %s", url)
+		return base
+	}
+
+	// Strategy 2: pool addresses from the config, or found on the host
+	var addrs []string
+	if cfg := env.Config(p.ID(), "address"); cfg != "" {
+		for _, a := range strings.Split(cfg, ",") {
+			if a = strings.TrimSpace(a); a != "" {
+				addrs = append(addrs, a)
+			}
+		}
+	} else {
+		addrs = phpFPMCandidates(env)
+	}
+	paths := phpFPMStatusPaths
+	if path := env.Config(p.ID(), "statusPath"); path != "" {
+		paths = []string{path}
+	}
+
+	var pools []string
+	for _, addr := range addrs {
+		for _, path := range paths {
+			if !env.takeProbe() {
+				break
+			}
+			if _, err := fastCGIGet(ctx, addr, path, "json"); err == nil {
+				pools = append(pools, addr+" "+path)
+				break
+			}
+		}
+	}
+	if len(pools) == 0 {
+		return nil
+	}
+	base.Meta["pools"] = strings.Join(pools, ",")
+	log.Printf("services: phpfpm detected, %d pool(s) at %s", len(pools), base.Meta["pools"])
+	return base
+}
+
+// phpFPMCandidates lists the FastCGI addresses worth probing: sockets in
+// the usual places and the TCP ports of php-fpm processes and containers.
+func phpFPMCandidates(env *DetectionEnv) []string {
+	var addrs []string
+	seen := make(map[string]bool)
+	add := func(a string) {
+		if !seen[a] {
+			seen[a] = true
+			addrs = append(addrs, a)
+		}
+	}
+
+	if env.HasProcessSubstring("php-fpm") {
+		root := strings.TrimSuffix(HostPath("/"), "/")
+		for _, pattern := range phpFPMSocketGlobs {
+			matches, _ := filepath.Glob(HostPath(pattern))
+			for _, m := range matches {
+				add("unix:" + strings.TrimPrefix(m, root))
+			}
+		}
+		for _, port := range env.FindProcessPortsBySubstring("php-fpm") {
+			for _, host := range env.probeHosts() {
+				add(fmt.Sprintf("%s:%d", host, port))
+			}
+		}
+	}
+
+	// php:*-fpm, nextcloud:fpm, wordpress:fpm and the like. The port is
+	// only reachable when published.
+	for _, c := range env.Containers {
+		if c.State != "running" || !strings.Contains(c.Image, "fpm") {
+			continue
+		}
+		for _, port := range c.HostPorts {
+			if port == phpFPMPort {
+				for _, host := range env.probeHosts() {
+					add(fmt.Sprintf("%s:%d", host, port))
+				}
+			}
+		}
+	}
+	return addrs
+}
+
+func (p *PHPFPMPlugin) Collect(ctx context.Context, svc *DetectedService) (*ServiceStats, error) {
+	var (
+		statuses []phpFPMStatus
+		failed   = []string{}
+		lastErr  error
+	)
+	if svc.BaseURL != "" {
+		st, err := phpFPMStatusHTTP(ctx, svc.BaseURL)
+		if err != nil {
+			return nil, err
+		}
+		statuses = append(statuses, *st)
+	} else {
+		for _, pool := range strings.Split(svc.Meta["pools"], ",") {
+			addr, path, _ := strings.Cut(pool, " ")
+			if addr == "" {
+				continue
+			}
+			st, err := phpFPMStatusFastCGI(ctx, addr, path)
+			if err != nil {
+				failed = append(failed, addr)
+				lastErr = err
+				continue
+			}
+			statuses = append(statuses, *st)
+		}
+		if len(statuses) == 0 {
+			if lastErr == nil {
+				lastErr = errors.New("no pools detected")
+			}
+			return nil, lastErr
+		}
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Pool < statuses[j].Pool })
+
+	var (
+		active, idle, queue, slowRecent int64
+		exhausted                       = []string{}
+		pools                           = make([]map[string]interface{}, 0, len(statuses))
+	)
+	p.mu.Lock()
+	if p.prev == nil {
+		p.prev = make(map[string]phpFPMStatus)
+	}
+	for _, st := range statuses {
+		maxReachedRecent, slow := p.deltas(st)
+		active += st.ActiveProcesses
+		idle += st.IdleProcesses
+		queue += st.ListenQueue
+		slowRecent += slow
+		// Hitting pm.max_children, or requests queueing with no idle
+		// worker, means the pool is too small for its load.
+		if maxReachedRecent > 0 || (st.ListenQueue > 0 && st.IdleProcesses == 0) {
+			exhausted = append(exhausted, st.Pool)
+		}
+		pools = append(pools, map[string]interface{}{
+			"name":                     st.Pool,
+			"address":                  st.address,
+			"processManager":           st.ProcessManager,
+			"startedAt":                time.Unix(st.StartTime, 0).UTC(),
+			"acceptedConnections":      st.AcceptedConn,
+			"activeProcesses":          st.ActiveProcesses,
+			"idleProcesses":            st.IdleProcesses,
+			"totalProcesses":           st.TotalProcesses,
+			"maxActiveProcesses":       st.MaxActiveProcesses,
+			"listenQueue":              st.ListenQueue,
+			"maxListenQueue":           st.MaxListenQueue,
+			"listenQueueLength":        st.ListenQueueLen,
+			"maxChildrenReached":       st.MaxChildrenReached,
+			"maxChildrenReachedRecent": maxReachedRecent,
+			"slowRequests":             st.SlowRequests,
+			"slowRequestsRecent":       slow,
+		})
+	}
+	p.mu.Unlock()
+
+	stats := &ServiceStats{
+		PluginID: p.ID(),
+		Name:     p.Name(),
+		Icon:     p.Icon(),
+		Status:   StatusRunning,
+		Summary: []StatItem{
+			{Label: "Active", Value: FormatNumber(active), Type: "number"},
+			{Label: "Idle", Value: FormatNumber(idle), Type: "number"},
+			{Label: "Queued", Value: FormatNumber(queue), Type: "number"},
+			{Label: "Slow", Value: FormatNumber(slowRecent), Type: "number"},
+		},
+		Stats: map[string]interface{}{
+			"pools":              pools,
+			"activeProcesses":    active,
+			"idleProcesses":      idle,
+			"listenQueue":        queue,
+			"slowRequestsRecent": slowRecent,
+			"exhaustedPools":     exhausted,
+			"unreachablePools":   failed,
+		},
+	}
+	if len(exhausted) > 0 {
+		stats.degrade("pool_exhausted", fmt.Sprintf("pool %s hit pm.max_children", strings.Join(exhausted, ", ")))
+	} else if len(failed) > 0 {
+		stats.degrade("pool_unreachable", fmt.Sprintf("no status from %s", strings.Join(failed, ", ")))
+	}
+	return stats, nil
+}
+
+// deltas returns how much max children reached and slow requests grew
+// since the previous collection of the same pool, 0 on the first or after
+// the pool restarted. Call with p.mu held.
+func (p *PHPFPMPlugin) deltas(st phpFPMStatus) (maxReached, slow int64) {
+	key := st.address + "|" + st.Pool
+	if prev, ok := p.prev[key]; ok && prev.StartTime == st.StartTime {
+		maxReached = max(st.MaxChildrenReached-prev.MaxChildrenReached, 0)
+		slow = max(st.SlowRequests-prev.SlowRequests, 0)
+	}
+	p.prev[key] = st
+	return maxReached, slow
+}
+
+// phpFPMStatus is the status page's JSON (?json). Slow requests are only
+// counted when request_slowlog_timeout is set.
+type phpFPMStatus struct {
+	Pool               string `json:"pool"`
+	ProcessManager     string `json:"process manager"`
+	StartTime          int64  `json:"start time"`
+	AcceptedConn       int64  `json:"accepted conn"`
+	ListenQueue        int64  `json:"listen queue"`
+	MaxListenQueue     int64  `json:"max listen queue"`
+	ListenQueueLen     int64  `json:"listen queue len"`
+	IdleProcesses      int64  `json:"idle processes"`
+	ActiveProcesses    int64  `json:"active processes"`
+	TotalProcesses     int64  `json:"total processes"`
+	MaxActiveProcesses int64  `json:"max active processes"`
+	MaxChildrenReached int64  `json:"max children reached"`
+	SlowRequests       int64  `json:"slow requests"`
+
+	address string
+}
+
+func parsePHPFPMStatus(body []byte, address string) (*phpFPMStatus, error) {
+	st := &phpFPMStatus{}
+	if err := json.Unmarshal(body, st); err != nil {
+		return nil, fmt.Errorf("invalid PHP-FPM status response: %w", err)
+	}
+	if st.Pool == "" {
+		return nil, errors.New("invalid PHP-FPM status response: no pool name")
+	}
+	st.address = address
+	return st, nil
+}
+
+func phpFPMStatusHTTP(ctx context.Context, url string) (*phpFPMStatus, error) {
+	sep := "?"
+	if strings.Contains(url, "?") {
+		sep = "&"
+	}
+	body, err := HTTPGet(ctx, url+sep+"json")
+	if err != nil {
+		return nil, fmt.Errorf("could not reach PHP-FPM status at %s: %w", url, err)
+	}
+	return parsePHPFPMStatus(body, url)
+}
+
+func phpFPMStatusFastCGI(ctx context.Context, addr, path string) (*phpFPMStatus, error) {
+	body, err := fastCGIGet(ctx, addr, path, "json")
+	if err != nil {
+		return nil, fmt.Errorf("could not reach PHP-FPM status at %s%s: %w", addr, path, err)
+	}
+	return parsePHPFPMStatus(body, addr)
+}
+
+// --- FastCGI ---
+
+const (
+	fcgiVersion      = 1
+	fcgiBeginRequest = 1
+	fcgiEndRequest   = 3
+	fcgiParams       = 4
+	fcgiStdin        = 5
+	fcgiStdout       = 6
+	fcgiResponder    = 1
+
+	fcgiTimeout = 3 * time.Second
+)
+
+// fastCGIGet sends a GET for path to the FastCGI responder at addr
+// ("host:port", or a socket as "unix:/path" or "/path") and returns the
+// body. PHP-FPM serves its status page itself, without a script behind it.
+func fastCGIGet(ctx context.Context, addr, path, query string) ([]byte, error) {
+	network := "tcp"
+	if strings.HasPrefix(addr, "unix:") || strings.HasPrefix(addr, "/") {
+		network, addr = "unix", HostPath(strings.TrimPrefix(addr, "unix:"))
+	}
+	ctx, cancel := context.WithTimeout(ctx, fcgiTimeout)
+	defer cancel()
+	conn, err := hostfs.DialContext(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	deadline, _ := ctx.Deadline()
+	conn.SetDeadline(deadline)
+
+	params := [][2]string{
+		{"GATEWAY_INTERFACE", "CGI/1.1"},
+		{"SERVER_PROTOCOL", "HTTP/1.1"},
+		{"REQUEST_METHOD", "GET"},
+		{"SCRIPT_NAME", path},
+		{"SCRIPT_FILENAME", path},
+		{"REQUEST_URI", path + "?" + query},
+		{"QUERY_STRING", query},
+	}
+	var p bytes.Buffer
+	for _, kv := range params {
+		for _, s := range kv {
+			if n := len(s); n < 128 {
+				p.WriteByte(byte(n))
+			} else {
+				binary.Write(&p, binary.BigEndian, uint32(n)|1<<31)
+			}
+		}
+		p.WriteString(kv[0])
+		p.WriteString(kv[1])
+	}
+
+	var req bytes.Buffer
+	writeFastCGIRecord(&req, fcgiBeginRequest, []byte{0, fcgiResponder, 0, 0, 0, 0, 0, 0})
+	writeFastCGIRecord(&req, fcgiParams, p.Bytes())
+	writeFastCGIRecord(&req, fcgiParams, nil)
+	writeFastCGIRecord(&req, fcgiStdin, nil)
+	if _, err := conn.Write(req.Bytes()); err != nil {
+		return nil, err
+	}
+
+	var stdout bytes.Buffer
+	r := bufio.NewReader(conn)
+	for {
+		var h [8]byte
+		if _, err := io.ReadFull(r, h[:]); err != nil {
+			return nil, fmt.Errorf("read FastCGI response: %w", err)
+		}
+		length := int(binary.BigEndian.Uint16(h[4:6]))
+		content := make([]byte, length+int(h[6]))
+		if _, err := io.ReadFull(r, content); err != nil {
+			return nil, fmt.Errorf("read FastCGI response: %w", err)
+		}
+		switch h[1] {
+		case fcgiStdout:
+			if stdout.Len()+length > 1<<20 {
+				return nil, errors.New("FastCGI response too large")
+			}
+			stdout.Write(content[:length])
+		case fcgiEndRequest:
+			return fastCGIBody(stdout.Bytes())
+		}
+	}
+}
+
+func writeFastCGIRecord(w *bytes.Buffer, typ byte, content []byte) {
+	w.Write([]byte{fcgiVersion, typ, 0, 1}) // request id 1
+	binary.Write(w, binary.BigEndian, uint16(len(content)))
+	w.Write([]byte{0, 0}) // no padding
+	w.Write(content)
+}
+
+// fastCGIBody splits the CGI response into headers and body, and fails
+// unless the Status header (200 when absent) is a success.
+func fastCGIBody(out []byte) ([]byte, error) {
+	tp := textproto.NewReader(bufio.NewReader(bytes.NewReader(out)))
+	header, err := tp.ReadMIMEHeader()
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("invalid FastCGI response: %w", err)
+	}
+	if status := header.Get("Status"); status != "" {
+		code, _ := strconv.Atoi(strings.Fields(status)[0])
+		if code < 200 || code >= 300 {
+			return nil, fmt.Errorf("HTTP %s", status)
+		}
+	}
+	return io.ReadAll(tp.R)
+}
@@ -1,10 +1,12 @@
+//go:build !noplugins
+
 package services
 
 import (
 	"bytes"
 	"context"
-	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -15,6 +17,8 @@ import (
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/neur0map/deskmon-agent/internal/hostfs"
 )
 
 func init() {
@@ -22,7 +26,10 @@ func init() {
 }
 
 // PiHolePlugin detects and collects stats from Pi-hole (v5 and v6).
-type PiHolePlugin struct{}
+type PiHolePlugin struct {
+	mu       sync.Mutex
+	sessions map[string]*piholeSession // v6 sessions by instance BaseURL
+}
 
 func (p *PiHolePlugin) ID() string   { return "pihole" }
 func (p *PiHolePlugin) Name() string { return "Pi-hole" }
@@ -30,19 +37,51 @@ func (p *PiHolePlugin) Icon() string { return "shield.checkerboard" }
 
 // --- Pi-hole v6 session management ---
 
+// piholeSession is the login session with one Pi-hole v6 instance. Pi-hole
+// only allows a few concurrent sessions, so each instance keeps one and
+// it is logged out when the instance goes away or the agent stops.
 type piholeSession struct {
+	baseURL   string
 	mu        sync.Mutex
 	sid       string
 	csrf      string
+	password  string // the session was opened with this password
 	expiresAt time.Time
 }
 
-var v6Session = &piholeSession{}
+// session returns the v6 session for the instance at baseURL.
+func (p *PiHolePlugin) session(baseURL string) *piholeSession {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.sessions == nil {
+		p.sessions = make(map[string]*piholeSession)
+	}
+	sess := p.sessions[baseURL]
+	if sess == nil {
+		sess = &piholeSession{baseURL: baseURL}
+		p.sessions[baseURL] = sess
+	}
+	return sess
+}
+
+// Release implements ServiceReleasePlugin: the instance's session is
+// logged out and forgotten.
+func (p *PiHolePlugin) Release(ctx context.Context, svc *DetectedService) {
+	p.mu.Lock()
+	sess := p.sessions[svc.BaseURL]
+	delete(p.sessions, svc.BaseURL)
+	p.mu.Unlock()
+	if sess != nil {
+		sess.logout(ctx)
+	}
+}
 
-func (s *piholeSession) isValid() bool {
+// isValid reports whether the session is open, unexpired and was opened
+// with password.
+func (s *piholeSession) isValid(password string) bool {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	return s.sid != "" && time.Now().Before(s.expiresAt)
+	return s.sid != "" && s.password == password && time.Now().Before(s.expiresAt)
 }
 
 func (s *piholeSession) get() (sid, csrf string) {
@@ -51,17 +90,18 @@ func (s *piholeSession) get() (sid, csrf string) {
 	return s.sid, s.csrf
 }
 
-func (s *piholeSession) set(sid, csrf string, validity int) {
+func (s *piholeSession) set(sid, csrf, password string, validity int) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	s.sid = sid
 	s.csrf = csrf
+	s.password = password
 	// Expire slightly early to avoid edge cases
 	if validity <= 0 {
 		validity = 300
 	}
 	s.expiresAt = time.Now().Add(time.Duration(validity-10) * time.Second)
-	log.Printf("services: pihole v6 session acquired (expires in %ds)", validity)
+	log.Printf("services: pihole v6 session acquired for %s (expires in %ds)", s.baseURL, validity)
 }
 
 func (s *piholeSession) clear() {
@@ -72,22 +112,43 @@ func (s *piholeSession) clear() {
 	s.expiresAt = time.Time{}
 }
 
-// authenticate performs POST /api/auth with the given password and caches the session.
-func (s *piholeSession) authenticate(ctx context.Context, baseURL, password string) error {
+// logout ends the session with DELETE /api/auth so it doesn't take up one
+// of Pi-hole's session slots until it expires.
+func (s *piholeSession) logout(ctx context.Context) {
+	s.mu.Lock()
+	sid, csrf := s.sid, s.csrf
+	s.mu.Unlock()
+	s.clear()
+	if sid == "" {
+		return
+	}
+	// 401 means the session had already expired on Pi-hole's side.
+	_, status, err := httpRequestWithSID(ctx, "DELETE", s.baseURL+"/api/auth", nil, sid, csrf)
+	switch {
+	case err != nil:
+		log.Printf("services: pihole v6 logout from %s failed: %v", s.baseURL, err)
+	case status < 300:
+		log.Printf("services: pihole v6 session for %s logged out", s.baseURL)
+	}
+}
+
+// errPiholeUnauthorized is Pi-hole v6 answering 401: the password is
+// missing or wrong.
+var errPiholeUnauthorized = errors.New("HTTP 401 Unauthorized")
+
+// authenticate performs POST /api/auth with the given password and caches the
+// session, logging out the one it replaces.
+func (s *piholeSession) authenticate(ctx context.Context, password string) error {
+	s.logout(ctx)
 	payload, _ := json.Marshal(map[string]string{"password": password})
 
-	req, err := http.NewRequestWithContext(ctx, "POST", baseURL+"/api/auth", bytes.NewReader(payload))
+	req, err := http.NewRequestWithContext(ctx, "POST", s.baseURL+"/api/auth", bytes.NewReader(payload))
 	if err != nil {
 		return fmt.Errorf("create auth request: %w", err)
 	}
 	req.Header.Set("Content-Type", "application/json")
 
-	cl := &http.Client{
-		Timeout: 5 * time.Second,
-		Transport: &http.Transport{
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-		},
-	}
+	cl := serviceClient(ctx, 5*time.Second)
 
 	resp, err := cl.Do(req)
 	if err != nil {
@@ -101,7 +162,7 @@ func (s *piholeSession) authenticate(ctx context.Context, baseURL, password stri
 	}
 
 	if resp.StatusCode == 401 {
-		return fmt.Errorf("invalid Pi-hole password")
+		return fmt.Errorf("invalid Pi-hole password: %w", errPiholeUnauthorized)
 	}
 	if resp.StatusCode != 200 {
 		return fmt.Errorf("auth returned HTTP %d", resp.StatusCode)
@@ -124,7 +185,7 @@ func (s *piholeSession) authenticate(ctx context.Context, baseURL, password stri
 		return fmt.Errorf("Pi-hole auth returned valid=false")
 	}
 
-	s.set(authResp.Session.SID, authResp.Session.CSRF, authResp.Session.Validity)
+	s.set(authResp.Session.SID, authResp.Session.CSRF, password, authResp.Session.Validity)
 	return nil
 }
 
@@ -139,12 +200,7 @@ func httpGetWithSID(ctx context.Context, url, sid, csrf string) ([]byte, int, er
 		req.Header.Set("X-FTL-CSRF", csrf)
 	}
 
-	cl := &http.Client{
-		Timeout: 5 * time.Second,
-		Transport: &http.Transport{
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-		},
-	}
+	cl := serviceClient(ctx, 5*time.Second)
 
 	resp, err := cl.Do(req)
 	if err != nil {
@@ -179,12 +235,7 @@ func httpRequestWithSID(ctx context.Context, method, url string, jsonBody []byte
 		req.Header.Set("X-FTL-CSRF", csrf)
 	}
 
-	cl := &http.Client{
-		Timeout: 5 * time.Second,
-		Transport: &http.Transport{
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-		},
-	}
+	cl := serviceClient(ctx, 5*time.Second)
 
 	resp, err := cl.Do(req)
 	if err != nil {
@@ -273,7 +324,7 @@ func (p *PiHolePlugin) probeAPI(env *DetectionEnv, ports []int) string {
 }
 
 func readPiHoleConfigPort() int {
-	if data, err := os.ReadFile("/etc/pihole/pihole.toml"); err == nil {
+	if data, err := os.ReadFile(hostfs.Etc("pihole/pihole.toml")); err == nil {
 		for _, line := range strings.Split(string(data), "\n") {
 			line = strings.TrimSpace(line)
 			if strings.HasPrefix(line, "port") && strings.Contains(line, "=") {
@@ -289,7 +340,7 @@ func readPiHoleConfigPort() int {
 		}
 	}
 
-	for _, path := range []string{"/etc/lighttpd/external.conf", "/etc/lighttpd/lighttpd.conf"} {
+	for _, path := range []string{hostfs.Etc("lighttpd/external.conf"), hostfs.Etc("lighttpd/lighttpd.conf")} {
 		if data, err := os.ReadFile(path); err == nil {
 			for _, line := range strings.Split(string(data), "\n") {
 				line = strings.TrimSpace(line)
@@ -314,7 +365,7 @@ func (p *PiHolePlugin) Collect(ctx context.Context, svc *DetectedService) (*Serv
 		PluginID: p.ID(),
 		Name:     p.Name(),
 		Icon:     p.Icon(),
-		Status:   "running",
+		Status:   StatusRunning,
 		Stats:    make(map[string]interface{}),
 	}
 
@@ -323,9 +374,7 @@ func (p *PiHolePlugin) Collect(ctx context.Context, svc *DetectedService) (*Serv
 	// Try v5 API first
 	v5err := ""
 	if data, err := p.collectV5(ctx, svc.BaseURL); err == nil {
-		stats.Summary = data.summary
-		stats.Stats = data.stats
-		stats.Status = data.status
+		data.apply(stats)
 		if svc.Version == "" {
 			svc.Version = "v5"
 		}
@@ -335,36 +384,36 @@ func (p *PiHolePlugin) Collect(ctx context.Context, svc *DetectedService) (*Serv
 	}
 
 	// Try v6 API (with authentication if password is available)
-	v6err := ""
+	var v6err error
 	if data, err := p.collectV6Authenticated(ctx, svc.BaseURL, password); err == nil {
-		stats.Summary = data.summary
-		stats.Stats = data.stats
-		stats.Status = data.status
+		data.apply(stats)
 		if svc.Version == "" {
 			svc.Version = "v6"
 		}
 		return stats, nil
 	} else {
-		v6err = err.Error()
+		v6err = err
 	}
 
 	// Try v6 public endpoint (no auth required)
 	if data, err := p.collectV6Public(ctx, svc.BaseURL); err == nil {
-		stats.Summary = data.summary
-		stats.Stats = data.stats
-		stats.Status = data.status
+		data.apply(stats)
 		if svc.Version == "" {
 			svc.Version = "v6"
 		}
 		return stats, nil
 	}
 
-	// If we got 401 from v6 and have no password, signal auth required
-	if strings.Contains(v6err, "401") || strings.Contains(v6err, "authentication") {
+	// A 401 from v6 means the password is missing or wrong
+	if errors.Is(v6err, errPiholeUnauthorized) {
 		if svc.Version == "" {
 			svc.Version = "v6"
 		}
-		stats.Status = "running"
+		if password == "" {
+			stats.setStatus(StatusAuthRequired, "credentials_missing", "set password to the Pi-hole web or app password")
+		} else {
+			stats.setStatus(StatusAuthRequired, "credentials_rejected", "Pi-hole rejected the password")
+		}
 		stats.Summary = []StatItem{
 			{Label: "Version", Value: "v6", Type: "text"},
 			{Label: "Status", Value: "Running", Type: "status"},
@@ -376,13 +425,23 @@ func (p *PiHolePlugin) Collect(ctx context.Context, svc *DetectedService) (*Serv
 		return stats, nil
 	}
 
-	return nil, fmt.Errorf("could not reach Pi-hole API at %s (v5: %s, v6: %s)", svc.BaseURL, v5err, v6err)
+	return nil, fmt.Errorf("could not reach Pi-hole API at %s (v5: %s, v6: %v)", svc.BaseURL, v5err, v6err)
 }
 
 type piholeData struct {
 	summary []StatItem
 	stats   map[string]interface{}
-	status  string
+	status  string // "running", or "stopped" with blocking disabled
+}
+
+// apply copies the data into stats. Pi-hole with blocking disabled still
+// answers DNS, so it is degraded rather than stopped.
+func (d *piholeData) apply(stats *ServiceStats) {
+	stats.Summary = d.summary
+	stats.Stats = d.stats
+	if d.status == "stopped" {
+		stats.degrade("blocking_disabled", "DNS blocking is disabled")
+	}
 }
 
 func (p *PiHolePlugin) collectV5(ctx context.Context, baseURL string) (*piholeData, error) {
@@ -436,16 +495,17 @@ func (p *PiHolePlugin) collectV5(ctx context.Context, baseURL string) (*piholeDa
 
 // collectV6Authenticated tries to fetch v6 stats, authenticating if needed.
 func (p *PiHolePlugin) collectV6Authenticated(ctx context.Context, baseURL, password string) (*piholeData, error) {
+	sess := p.session(baseURL)
+
 	// If we have a valid session, try it first
-	if v6Session.isValid() {
-		sid, csrf := v6Session.get()
+	if sess.isValid(password) {
+		sid, csrf := sess.get()
 		data, err := p.fetchV6Summary(ctx, baseURL, sid, csrf)
 		if err == nil {
 			return data, nil
 		}
-		// Session expired or invalid — clear and retry
+		// Session expired or invalid — authenticate replaces it
 		log.Printf("services: pihole v6 session expired, re-authenticating")
-		v6Session.clear()
 	}
 
 	// Try without auth (Pi-hole might not require a password)
@@ -456,15 +516,15 @@ func (p *PiHolePlugin) collectV6Authenticated(ctx context.Context, baseURL, pass
 
 	// Need auth — authenticate with password
 	if password == "" {
-		return nil, fmt.Errorf("Pi-hole v6 requires authentication (401)")
+		return nil, fmt.Errorf("Pi-hole v6 requires authentication: %w", errPiholeUnauthorized)
 	}
 
-	if err := v6Session.authenticate(ctx, baseURL, password); err != nil {
+	if err := sess.authenticate(ctx, password); err != nil {
 		return nil, fmt.Errorf("pihole auth: %w", err)
 	}
 
 	// Retry with new session
-	sid, csrf := v6Session.get()
+	sid, csrf := sess.get()
 	return p.fetchV6Summary(ctx, baseURL, sid, csrf)
 }
 
@@ -614,17 +674,18 @@ func (p *PiHolePlugin) setBlocking(ctx context.Context, svc *DetectedService, pa
 	}
 
 	// v6: POST /api/dns/blocking with session
-	if !v6Session.isValid() {
-		password := svc.Meta["password"]
+	sess := p.session(svc.BaseURL)
+	password := svc.Meta["password"]
+	if !sess.isValid(password) {
 		if password == "" {
 			return "", fmt.Errorf("Pi-hole v6 requires authentication")
 		}
-		if err := v6Session.authenticate(ctx, svc.BaseURL, password); err != nil {
+		if err := sess.authenticate(ctx, password); err != nil {
 			return "", fmt.Errorf("auth failed: %w", err)
 		}
 	}
 
-	sid, csrf := v6Session.get()
+	sid, csrf := sess.get()
 	body, _ := json.Marshal(map[string]interface{}{"blocking": enabled})
 
 	respBody, status, err := httpRequestWithSID(ctx, "POST", svc.BaseURL+"/api/dns/blocking", body, sid, csrf)
@@ -634,15 +695,14 @@ func (p *PiHolePlugin) setBlocking(ctx context.Context, svc *DetectedService, pa
 
 	if status == 401 {
 		// Session expired, retry once
-		v6Session.clear()
-		password := svc.Meta["password"]
+		sess.clear()
 		if password == "" {
 			return "", fmt.Errorf("Pi-hole v6 requires authentication")
 		}
-		if err := v6Session.authenticate(ctx, svc.BaseURL, password); err != nil {
+		if err := sess.authenticate(ctx, password); err != nil {
 			return "", fmt.Errorf("re-auth failed: %w", err)
 		}
-		sid, csrf = v6Session.get()
+		sid, csrf = sess.get()
 		respBody, status, err = httpRequestWithSID(ctx, "POST", svc.BaseURL+"/api/dns/blocking", body, sid, csrf)
 		if err != nil {
 			return "", fmt.Errorf("set blocking retry failed: %w", err)
@@ -0,0 +1,403 @@
+//go:build !noplugins
+
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+)
+
+func init() {
+	Register(&PrinterPlugin{})
+}
+
+// PrinterPlugin reports printer state, job progress, hotend and bed
+// temperatures and time remaining from OctoPrint or Moonraker (Klipper).
+// OctoPrint requires an API key configured as "apiKey"; Moonraker only
+// needs one when the agent isn't a trusted client.
+type PrinterPlugin struct{}
+
+func (p *PrinterPlugin) ID() string   { return "printer" }
+func (p *PrinterPlugin) Name() string { return "3D Printer" }
+func (p *PrinterPlugin) Icon() string { return "printer.fill" }
+
+const (
+	printerOctoPrint = "octoprint"
+	printerMoonraker = "moonraker"
+
+	octoprintDefaultPort = 5000
+	moonrakerDefaultPort = 7125
+)
+
+func (p *PrinterPlugin) Detect(ctx context.Context, env *DetectionEnv) *DetectedService {
+	detected := func(backend, url, via string) *DetectedService {
+		log.Printf("services: printer (%s) detected via %s at %s", backend, via, url)
+		return &DetectedService{
+			PluginID: p.ID(),
+			Name:     printerName(backend),
+			Icon:     p.Icon(),
+			BaseURL:  url,
+			Meta:     map[string]string{"backend": backend},
+		}
+	}
+
+	// Strategy 1: containers.
+	if c := env.FindDockerImage("octoprint"); c != nil && c.State == "running" {
+		ports := append(c.HostPorts, octoprintDefaultPort, 80)
+		// /api/version answers 403 without a key; the UI redirects to its login page.
+		if url := env.ProbeHTTP(ports, "/"); url != "" {
+			return detected(printerOctoPrint, url, "docker")
+		}
+	}
+	if c := env.FindDockerImage("moonraker"); c != nil && c.State == "running" {
+		ports := append(c.HostPorts, moonrakerDefaultPort)
+		if url := env.ProbeHTTP(ports, "/server/info"); url != "" {
+			return detected(printerMoonraker, url, "docker")
+		}
+	}
+
+	// Strategy 2: OctoPrint process (OctoPi proxies it on port 80).
+	if env.HasProcess("octoprint") {
+		ports := append(env.FindProcessPorts("octoprint"), octoprintDefaultPort, 80)
+		if url := env.ProbeHTTP(ports, "/"); url != "" {
+			return detected(printerOctoPrint, url, "process")
+		}
+	}
+
+	// Strategy 3: Moonraker runs as a python script, so its process name
+	// says nothing; probe its default port.
+	if url := env.ProbeHTTP([]int{moonrakerDefaultPort}, "/server/info"); url != "" {
+		return detected(printerMoonraker, url, "port")
+	}
+
+	return nil
+}
+
+func printerName(backend string) string {
+	if backend == printerOctoPrint {
+		return "OctoPrint"
+	}
+	return "Klipper"
+}
+
+// --- Collection ---
+
+// printerReading is the state common to both backends.
+type printerReading struct {
+	state         string // "printing", "paused", "ready", "error", ...
+	message       string
+	file          string
+	progress      float64 // 0-100
+	printTime     int64
+	timeRemaining int64
+	hotend        printerTemp
+	bed           printerTemp
+}
+
+type printerTemp struct {
+	Actual float64 `json:"actual"`
+	Target float64 `json:"target"`
+}
+
+func (p *PrinterPlugin) Collect(ctx context.Context, svc *DetectedService) (*ServiceStats, error) {
+	backend := svc.Meta["backend"]
+	stats := &ServiceStats{
+		PluginID: p.ID(),
+		Name:     printerName(backend),
+		Icon:     p.Icon(),
+		Status:   StatusRunning,
+		Stats:    make(map[string]interface{}),
+	}
+
+	apiKey := svc.Meta["apiKey"]
+	if backend == printerOctoPrint && apiKey == "" {
+		stats.setStatus(StatusAuthRequired, "credentials_missing", "set apiKey to an OctoPrint API key")
+		stats.Summary = []StatItem{
+			{Label: "Status", Value: "Running", Type: "status"},
+		}
+		stats.Stats = map[string]interface{}{
+			"backend":      backend,
+			"authRequired": true,
+		}
+		return stats, nil
+	}
+
+	var r *printerReading
+	var err error
+	if backend == printerOctoPrint {
+		r, err = collectOctoPrint(ctx, svc.BaseURL, apiKey)
+	} else {
+		r, err = collectMoonraker(ctx, svc.BaseURL, apiKey)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not reach %s at %s: %w", stats.Name, svc.BaseURL, err)
+	}
+
+	active := r.state == "printing" || r.state == "paused"
+	stats.Summary = []StatItem{
+		{Label: "State", Value: capitalize(r.state), Type: "status"},
+		{Label: "Hotend", Value: formatPrinterTemp(r.hotend), Type: "text"},
+		{Label: "Bed", Value: formatPrinterTemp(r.bed), Type: "text"},
+	}
+	if active {
+		stats.Summary = append(stats.Summary,
+			StatItem{Label: "Progress", Value: fmt.Sprintf("%.1f%%", r.progress), Type: "percent"},
+			StatItem{Label: "Remaining", Value: formatDuration(r.timeRemaining), Type: "text"},
+		)
+	}
+
+	stats.Stats = map[string]interface{}{
+		"backend":              backend,
+		"state":                r.state,
+		"message":              r.message,
+		"printing":             active,
+		"file":                 r.file,
+		"progressPercent":      math.Round(r.progress*10) / 10,
+		"printTimeSeconds":     r.printTime,
+		"timeRemainingSeconds": r.timeRemaining,
+		"hotend":               r.hotend,
+		"bed":                  r.bed,
+	}
+
+	if r.state == "error" {
+		stats.degrade("printer_error", "printer reports an error")
+	}
+	return stats, nil
+}
+
+func formatPrinterTemp(t printerTemp) string {
+	if t.Target > 0 {
+		return fmt.Sprintf("%.0f/%.0f°C", t.Actual, t.Target)
+	}
+	return fmt.Sprintf("%.0f°C", t.Actual)
+}
+
+// --- OctoPrint ---
+
+func collectOctoPrint(ctx context.Context, baseURL, apiKey string) (*printerReading, error) {
+	var job struct {
+		Job struct {
+			File struct {
+				Name string `json:"name"`
+			} `json:"file"`
+		} `json:"job"`
+		Progress struct {
+			Completion    *float64 `json:"completion"`
+			PrintTime     *int64   `json:"printTime"`
+			PrintTimeLeft *int64   `json:"printTimeLeft"`
+		} `json:"progress"`
+		State string `json:"state"` // "Operational", "Printing", "Paused", "Offline", "Error: ..."
+	}
+	body, status, err := printerRequest(ctx, "GET", baseURL+"/api/job", apiKey, nil)
+	if err != nil {
+		return nil, err
+	}
+	if status == http.StatusForbidden || status == http.StatusUnauthorized {
+		return nil, fmt.Errorf("invalid OctoPrint API key")
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("HTTP %d", status)
+	}
+	if err := json.Unmarshal(body, &job); err != nil {
+		return nil, fmt.Errorf("invalid OctoPrint response: %w", err)
+	}
+
+	r := &printerReading{file: job.Job.File.Name, message: job.State}
+	lower := strings.ToLower(job.State)
+	switch {
+	case strings.HasPrefix(lower, "printing"):
+		r.state = "printing"
+	case strings.HasPrefix(lower, "paus"):
+		r.state = "paused"
+	case strings.HasPrefix(lower, "operational"):
+		r.state = "ready"
+	case strings.HasPrefix(lower, "offline") || strings.HasPrefix(lower, "closed"):
+		r.state = "offline"
+	case strings.HasPrefix(lower, "error"):
+		r.state = "error"
+	default:
+		r.state = lower
+	}
+	if job.Progress.Completion != nil {
+		r.progress = *job.Progress.Completion
+	}
+	if job.Progress.PrintTime != nil {
+		r.printTime = *job.Progress.PrintTime
+	}
+	if job.Progress.PrintTimeLeft != nil {
+		r.timeRemaining = *job.Progress.PrintTimeLeft
+	}
+
+	// /api/printer answers 409 while no printer is connected.
+	var printer struct {
+		Temperature struct {
+			Tool0 printerTemp `json:"tool0"`
+			Bed   printerTemp `json:"bed"`
+		} `json:"temperature"`
+	}
+	if body, status, err := printerRequest(ctx, "GET", baseURL+"/api/printer?exclude=sd,state", apiKey, nil); err == nil && status == http.StatusOK {
+		if json.Unmarshal(body, &printer) == nil {
+			r.hotend, r.bed = printer.Temperature.Tool0, printer.Temperature.Bed
+		}
+	}
+	return r, nil
+}
+
+// --- Moonraker ---
+
+func collectMoonraker(ctx context.Context, baseURL, apiKey string) (*printerReading, error) {
+	var resp struct {
+		Result struct {
+			Status struct {
+				PrintStats struct {
+					State         string  `json:"state"` // "standby", "printing", "paused", "complete", "cancelled", "error"
+					Filename      string  `json:"filename"`
+					PrintDuration float64 `json:"print_duration"`
+					Message       string  `json:"message"`
+				} `json:"print_stats"`
+				VirtualSDCard struct {
+					Progress float64 `json:"progress"` // 0-1
+				} `json:"virtual_sdcard"`
+				Extruder struct {
+					Temperature float64 `json:"temperature"`
+					Target      float64 `json:"target"`
+				} `json:"extruder"`
+				HeaterBed struct {
+					Temperature float64 `json:"temperature"`
+					Target      float64 `json:"target"`
+				} `json:"heater_bed"`
+				Webhooks struct {
+					State        string `json:"state"` // Klippy: "ready", "startup", "shutdown", "error"
+					StateMessage string `json:"state_message"`
+				} `json:"webhooks"`
+			} `json:"status"`
+		} `json:"result"`
+	}
+	url := baseURL + "/printer/objects/query?print_stats&virtual_sdcard&extruder&heater_bed&webhooks"
+	body, status, err := printerRequest(ctx, "GET", url, apiKey, nil)
+	if err != nil {
+		return nil, err
+	}
+	if status == http.StatusUnauthorized || status == http.StatusForbidden {
+		return nil, fmt.Errorf("Moonraker requires an API key")
+	}
+	if status != http.StatusOK {
+		// Moonraker answers 503 while Klippy is disconnected.
+		return &printerReading{state: "offline", message: fmt.Sprintf("Klippy unavailable (HTTP %d)", status)}, nil
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("invalid Moonraker response: %w", err)
+	}
+
+	st := resp.Result.Status
+	r := &printerReading{
+		state:     st.PrintStats.State,
+		message:   st.PrintStats.Message,
+		file:      st.PrintStats.Filename,
+		progress:  st.VirtualSDCard.Progress * 100,
+		printTime: int64(st.PrintStats.PrintDuration),
+		hotend:    printerTemp{Actual: st.Extruder.Temperature, Target: st.Extruder.Target},
+		bed:       printerTemp{Actual: st.HeaterBed.Temperature, Target: st.HeaterBed.Target},
+	}
+	switch {
+	case st.Webhooks.State != "" && st.Webhooks.State != "ready":
+		r.state = st.Webhooks.State
+		if st.Webhooks.State == "shutdown" {
+			r.state = "error"
+		}
+		r.message = st.Webhooks.StateMessage
+	case r.state == "standby" || r.state == "complete" || r.state == "cancelled":
+		r.state = "ready"
+	}
+	// Estimate from elapsed print time, as Mainsail and Fluidd do by default.
+	if p := st.VirtualSDCard.Progress; p > 0 && p < 1 && (r.state == "printing" || r.state == "paused") {
+		r.timeRemaining = int64(st.PrintStats.PrintDuration/p - st.PrintStats.PrintDuration)
+	}
+	return r, nil
+}
+
+// --- Actions ---
+
+// DestructiveAction implements DestructiveActionPlugin: a cancelled job
+// can't be resumed.
+func (p *PrinterPlugin) DestructiveAction(action string, params map[string]interface{}) bool {
+	return action == "cancel"
+}
+
+// PerformAction implements ServiceActionPlugin.
+// Supported actions: pause, resume, cancel (the current print job).
+func (p *PrinterPlugin) PerformAction(ctx context.Context, svc *DetectedService, action string, params map[string]interface{}) (string, error) {
+	if action != "pause" && action != "resume" && action != "cancel" {
+		return "", fmt.Errorf("unknown action: %s", action)
+	}
+
+	var url string
+	var body []byte
+	if svc.Meta["backend"] == printerOctoPrint {
+		url = svc.BaseURL + "/api/job"
+		cmd := map[string]string{"command": action}
+		if action != "cancel" {
+			cmd = map[string]string{"command": "pause", "action": action}
+		}
+		body, _ = json.Marshal(cmd)
+	} else {
+		url = svc.BaseURL + "/printer/print/" + action
+	}
+
+	resp, status, err := printerRequest(ctx, "POST", url, svc.Meta["apiKey"], body)
+	if err != nil {
+		return "", fmt.Errorf("%s failed: %w", action, err)
+	}
+	// OctoPrint answers 204; 409 means there's no job in a state to act on.
+	if status == http.StatusConflict {
+		return "", fmt.Errorf("no print job to %s", action)
+	}
+	if status != http.StatusOK && status != http.StatusNoContent {
+		return "", fmt.Errorf("%s returned HTTP %d: %s", action, status, strings.TrimSpace(string(resp)))
+	}
+
+	log.Printf("services: printer %s requested", action)
+	return action, nil
+}
+
+// --- helpers ---
+
+// printerRequest sends a request with an optional JSON body. Both backends
+// take the API key in X-Api-Key.
+func printerRequest(ctx context.Context, method, url, apiKey string, jsonBody []byte) ([]byte, int, error) {
+	var bodyReader io.Reader
+	if jsonBody != nil {
+		bodyReader = bytes.NewReader(jsonBody)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, bodyReader)
+	if err != nil {
+		return nil, 0, err
+	}
+	if jsonBody != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if apiKey != "" {
+		req.Header.Set("X-Api-Key", apiKey)
+	}
+
+	cl := serviceClient(ctx, 5*time.Second)
+	resp, err := cl.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, resp.StatusCode, err
+	}
+	return body, resp.StatusCode, nil
+}
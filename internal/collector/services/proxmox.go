@@ -0,0 +1,350 @@
+//go:build !noplugins
+
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+func init() {
+	Register(&ProxmoxPlugin{})
+}
+
+// ProxmoxPlugin detects a Proxmox VE host and reports guests, quorum and
+// storage through the PVE REST API. Requires an API token configured as
+// "token" in the form USER@REALM!TOKENID=SECRET.
+type ProxmoxPlugin struct{}
+
+func (p *ProxmoxPlugin) ID() string   { return "proxmox" }
+func (p *ProxmoxPlugin) Name() string { return "Proxmox VE" }
+func (p *ProxmoxPlugin) Icon() string { return "server.rack" }
+
+// pveDefaultPort is the port pveproxy serves the API and web UI on.
+const pveDefaultPort = 8006
+
+func (p *ProxmoxPlugin) Detect(ctx context.Context, env *DetectionEnv) *DetectedService {
+	if !env.HasProcess("pveproxy") && !env.HasProcess("pvedaemon") {
+		return nil
+	}
+
+	base := &DetectedService{
+		PluginID: p.ID(),
+		Name:     p.Name(),
+		Icon:     p.Icon(),
+		Meta:     make(map[string]string),
+	}
+
+	ports := env.FindProcessPortsBySubstring("pveproxy")
+	ports = append(ports, pveDefaultPort)
+	// The web UI at "/" is served without authentication, unlike /api2/json.
+	if url := env.ProbeHTTP(ports, "/"); url != "" {
+		base.BaseURL = url
+		log.Printf("services: proxmox detected via process at %s", url)
+		return base
+	}
+
+	log.Printf("services: pveproxy process found but no API reachable")
+	return nil
+}
+
+// --- Collection ---
+
+// pveResource is an entry from /api2/json/cluster/resources.
+type pveResource struct {
+	ID      string  `json:"id"`
+	Type    string  `json:"type"` // "qemu", "lxc", "node", "storage", ...
+	Node    string  `json:"node"`
+	VMID    int     `json:"vmid"`
+	Name    string  `json:"name"`
+	Status  string  `json:"status"`
+	CPU     float64 `json:"cpu"` // fraction of maxcpu (0-1)
+	MaxCPU  float64 `json:"maxcpu"`
+	Mem     uint64  `json:"mem"`
+	MaxMem  uint64  `json:"maxmem"`
+	Disk    uint64  `json:"disk"`
+	MaxDisk uint64  `json:"maxdisk"`
+	Uptime  int64   `json:"uptime"`
+	Storage string  `json:"storage"`
+	Shared  int     `json:"shared"`
+}
+
+// pveClusterStatus is an entry from /api2/json/cluster/status.
+type pveClusterStatus struct {
+	Type    string `json:"type"` // "cluster" or "node"
+	Name    string `json:"name"`
+	Quorate int    `json:"quorate"`
+	Nodes   int    `json:"nodes"`
+	Online  int    `json:"online"`
+}
+
+func (p *ProxmoxPlugin) Collect(ctx context.Context, svc *DetectedService) (*ServiceStats, error) {
+	stats := &ServiceStats{
+		PluginID: p.ID(),
+		Name:     p.Name(),
+		Icon:     p.Icon(),
+		Status:   StatusRunning,
+		Stats:    make(map[string]interface{}),
+	}
+
+	token := svc.Meta["token"]
+	if token == "" {
+		stats.setStatus(StatusAuthRequired, "credentials_missing", "set token to a Proxmox API token")
+		stats.Summary = []StatItem{
+			{Label: "Status", Value: "Running", Type: "status"},
+		}
+		stats.Stats = map[string]interface{}{
+			"authRequired": true,
+		}
+		return stats, nil
+	}
+
+	var resources []pveResource
+	if err := pveGet(ctx, svc.BaseURL+"/api2/json/cluster/resources", token, &resources); err != nil {
+		return nil, fmt.Errorf("could not reach Proxmox API at %s: %w", svc.BaseURL, err)
+	}
+
+	var clusterStatus []pveClusterStatus
+	if err := pveGet(ctx, svc.BaseURL+"/api2/json/cluster/status", token, &clusterStatus); err != nil {
+		log.Printf("services: proxmox cluster status: %v", err)
+	}
+
+	var guests, storage []map[string]interface{}
+	var vmTotal, vmRunning, lxcTotal, lxcRunning int
+	var storageUsed, storageTotal uint64
+
+	for _, r := range resources {
+		switch r.Type {
+		case "qemu", "lxc":
+			if r.Type == "qemu" {
+				vmTotal++
+				if r.Status == "running" {
+					vmRunning++
+				}
+			} else {
+				lxcTotal++
+				if r.Status == "running" {
+					lxcRunning++
+				}
+			}
+			guests = append(guests, map[string]interface{}{
+				"vmid":          r.VMID,
+				"name":          r.Name,
+				"type":          r.Type,
+				"node":          r.Node,
+				"status":        r.Status,
+				"cpuPercent":    math.Round(r.CPU*100*100) / 100,
+				"cpuCount":      r.MaxCPU,
+				"memUsedBytes":  r.Mem,
+				"memTotalBytes": r.MaxMem,
+				"diskBytes":     r.MaxDisk,
+				"uptimeSeconds": r.Uptime,
+			})
+		case "storage":
+			// Shared storage appears once per node; count it once.
+			if r.Shared == 1 && containsStorage(storage, r.Storage) {
+				continue
+			}
+			storageUsed += r.Disk
+			storageTotal += r.MaxDisk
+			var pct float64
+			if r.MaxDisk > 0 {
+				pct = math.Round(float64(r.Disk)/float64(r.MaxDisk)*1000) / 10
+			}
+			storage = append(storage, map[string]interface{}{
+				"storage":      r.Storage,
+				"node":         r.Node,
+				"status":       r.Status,
+				"shared":       r.Shared == 1,
+				"usedBytes":    r.Disk,
+				"totalBytes":   r.MaxDisk,
+				"usagePercent": pct,
+			})
+		}
+	}
+
+	sort.Slice(guests, func(i, j int) bool {
+		return guests[i]["vmid"].(int) < guests[j]["vmid"].(int)
+	})
+	if guests == nil {
+		guests = []map[string]interface{}{}
+	}
+	if storage == nil {
+		storage = []map[string]interface{}{}
+	}
+
+	quorum := "Standalone"
+	quorate := true
+	nodes := 1
+	for _, cs := range clusterStatus {
+		if cs.Type == "cluster" {
+			nodes = cs.Nodes
+			quorate = cs.Quorate == 1
+			if quorate {
+				quorum = "OK"
+			} else {
+				quorum = "Lost"
+			}
+		}
+	}
+
+	var storagePercent float64
+	if storageTotal > 0 {
+		storagePercent = float64(storageUsed) / float64(storageTotal) * 100
+	}
+
+	stats.Summary = []StatItem{
+		{Label: "VMs", Value: fmt.Sprintf("%d/%d", vmRunning, vmTotal), Type: "text"},
+		{Label: "Containers", Value: fmt.Sprintf("%d/%d", lxcRunning, lxcTotal), Type: "text"},
+		{Label: "Quorum", Value: quorum, Type: "status"},
+		{Label: "Storage", Value: fmt.Sprintf("%.1f%%", storagePercent), Type: "percent"},
+	}
+
+	stats.Stats = map[string]interface{}{
+		"vmsRunning":        vmRunning,
+		"vmsTotal":          vmTotal,
+		"containersRunning": lxcRunning,
+		"containersTotal":   lxcTotal,
+		"quorate":           quorate,
+		"nodes":             nodes,
+		"storageUsedBytes":  storageUsed,
+		"storageTotalBytes": storageTotal,
+		"guests":            guests,
+		"storage":           storage,
+	}
+
+	if !quorate {
+		stats.degrade("no_quorum", "cluster has lost quorum")
+	}
+
+	return stats, nil
+}
+
+func containsStorage(storage []map[string]interface{}, name string) bool {
+	for _, s := range storage {
+		if s["storage"] == name {
+			return true
+		}
+	}
+	return false
+}
+
+// --- Actions ---
+
+// DestructiveAction implements DestructiveActionPlugin: stopping and
+// rebooting a guest interrupts it.
+func (p *ProxmoxPlugin) DestructiveAction(action string, params map[string]interface{}) bool {
+	return action == "stopVM" || action == "rebootVM"
+}
+
+// PerformAction implements ServiceActionPlugin for Proxmox guests.
+// Supported actions: startVM, stopVM, rebootVM with params {"vmid": 100}.
+func (p *ProxmoxPlugin) PerformAction(ctx context.Context, svc *DetectedService, action string, params map[string]interface{}) (string, error) {
+	var verb string
+	switch action {
+	case "startVM":
+		verb = "start"
+	case "stopVM":
+		verb = "stop"
+	case "rebootVM":
+		verb = "reboot"
+	default:
+		return "", fmt.Errorf("unknown action: %s", action)
+	}
+
+	token := svc.Meta["token"]
+	if token == "" {
+		return "", fmt.Errorf("Proxmox requires an API token")
+	}
+
+	vmid := int(toInt64(params["vmid"]))
+	if vmid <= 0 {
+		return "", fmt.Errorf("missing or invalid vmid")
+	}
+
+	// Resolve node and guest type from the cluster resource list so the
+	// client only needs to send the vmid.
+	var resources []pveResource
+	if err := pveGet(ctx, svc.BaseURL+"/api2/json/cluster/resources?type=vm", token, &resources); err != nil {
+		return "", fmt.Errorf("list guests: %w", err)
+	}
+	var guest *pveResource
+	for i := range resources {
+		if resources[i].VMID == vmid {
+			guest = &resources[i]
+			break
+		}
+	}
+	if guest == nil {
+		return "", fmt.Errorf("guest %d not found", vmid)
+	}
+
+	url := fmt.Sprintf("%s/api2/json/nodes/%s/%s/%d/status/%s", svc.BaseURL, guest.Node, guest.Type, vmid, verb)
+	body, status, err := pveRequest(ctx, "POST", url, token)
+	if err != nil {
+		return "", fmt.Errorf("%s %d failed: %w", verb, vmid, err)
+	}
+	if status != http.StatusOK {
+		return "", fmt.Errorf("%s %d returned HTTP %d: %s", verb, vmid, status, strings.TrimSpace(string(body)))
+	}
+
+	log.Printf("services: proxmox %s requested for %s %d (%s)", verb, guest.Type, vmid, guest.Name)
+	return verb, nil
+}
+
+// --- helpers ---
+
+// pveGet performs an authenticated GET and decodes the "data" field of the
+// standard PVE response envelope into out.
+func pveGet(ctx context.Context, url, token string, out interface{}) error {
+	body, status, err := pveRequest(ctx, "GET", url, token)
+	if err != nil {
+		return err
+	}
+	if status == http.StatusUnauthorized {
+		return fmt.Errorf("invalid Proxmox API token")
+	}
+	if status != http.StatusOK {
+		return fmt.Errorf("HTTP %d", status)
+	}
+
+	var envelope struct {
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		return fmt.Errorf("invalid Proxmox response: %w", err)
+	}
+	return json.Unmarshal(envelope.Data, out)
+}
+
+// pveRequest sends a request with the PVEAPIToken authorization header.
+func pveRequest(ctx context.Context, method, url, token string) ([]byte, int, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	req.Header.Set("Authorization", "PVEAPIToken="+token)
+
+	cl := serviceClient(ctx, 5*time.Second)
+
+	resp, err := cl.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, resp.StatusCode, err
+	}
+
+	return body, resp.StatusCode, nil
+}
@@ -1,6 +1,9 @@
 package services
 
-import "context"
+import (
+	"context"
+	"time"
+)
 
 // ServicePlugin is the interface every service integration must implement.
 // Contributors add a single file with an init() that calls Register().
@@ -23,6 +26,51 @@ type ServiceActionPlugin interface {
 	PerformAction(ctx context.Context, svc *DetectedService, action string, params map[string]interface{}) (string, error)
 }
 
+// DestructiveActionPlugin is an optional interface for action plugins whose
+// actions can stop, cancel or delete something. confirm_destructive makes
+// clients confirm the actions it reports before they run.
+type DestructiveActionPlugin interface {
+	ServiceActionPlugin
+	DestructiveAction(action string, params map[string]interface{}) bool
+}
+
+// ServiceRoutePlugin is an optional interface for reverse proxies that can
+// list the routes they serve.
+type ServiceRoutePlugin interface {
+	ServicePlugin
+	Routes(ctx context.Context, svc *DetectedService) ([]Route, error)
+}
+
+// ServiceReleasePlugin is an optional interface for plugins that hold state
+// on a service instance, such as a login session. Release is called when the
+// instance is no longer detected, moves to another BaseURL, or the agent
+// stops.
+type ServiceReleasePlugin interface {
+	ServicePlugin
+	Release(ctx context.Context, svc *DetectedService)
+}
+
+// Route is one reverse proxy route: the hostnames it answers for and the
+// upstreams it forwards to.
+type Route struct {
+	Name        string   `json:"name"`
+	Hosts       []string `json:"hosts"`
+	Rule        string   `json:"rule,omitempty"`
+	EntryPoints []string `json:"entryPoints,omitempty"`
+	TLS         bool     `json:"tls"`
+	Service     string   `json:"service,omitempty"`
+	Upstreams   []string `json:"upstreams"` // backend URLs
+	Status      string   `json:"status,omitempty"`
+}
+
+// ProxyRoutes is the route listing of one detected reverse proxy.
+type ProxyRoutes struct {
+	Proxy  string  `json:"proxy"` // plugin ID
+	Name   string  `json:"name"`
+	Routes []Route `json:"routes"`
+	Error  string  `json:"error,omitempty"`
+}
+
 // DetectedService holds information about a discovered service instance.
 type DetectedService struct {
 	PluginID string
@@ -38,11 +86,59 @@ type ServiceStats struct {
 	PluginID string                 `json:"pluginId"`
 	Name     string                 `json:"name"`
 	Icon     string                 `json:"icon"`
-	Status   string                 `json:"status"` // "running", "stopped", "error"
+	Status   string                 `json:"status"` // one of the Status constants
 	Summary  []StatItem             `json:"summary"`
 	Stats    map[string]interface{} `json:"stats"`
 	Error    string                 `json:"error,omitempty"`
 	URL      string                 `json:"url,omitempty"`
+
+	// Why Status isn't running; nil when it is.
+	StatusReason *StatusReason `json:"statusReason,omitempty"`
+
+	// Set while collection is failing and backing off, see backoff.go.
+	ConsecutiveFailures int        `json:"consecutiveFailures,omitempty"`
+	RetryAt             *time.Time `json:"retryAt,omitempty"`
+
+	// Availability over the last 24h and 7d, see uptime.go.
+	Uptime *ServiceUptime `json:"uptime,omitempty"`
+
+	// What changed since the previous broadcast; stream events only, see
+	// changes.go.
+	ChangedFields []string `json:"changedFields,omitempty"`
+}
+
+// Service statuses. Plugins report running, degraded, stopped or
+// auth-required; error and unreachable are set when collection fails (see
+// backoff.go).
+const (
+	StatusRunning      = "running"       // up and healthy
+	StatusDegraded     = "degraded"      // up, with a problem the reason names
+	StatusStopped      = "stopped"       // reachable, but what it serves is switched off
+	StatusAuthRequired = "auth-required" // reachable, but credentials are missing or rejected
+	StatusError        = "error"         // the last collection failed
+	StatusUnreachable  = "unreachable"   // collection failed repeatedly and is backing off
+)
+
+// StatusReason explains a status other than running. Code is stable and
+// meant for client logic, e.g. "credentials_missing" or "router_errors";
+// Message is for display.
+type StatusReason struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// setStatus sets a status other than running and the reason for it.
+func (s *ServiceStats) setStatus(status, code, message string) {
+	s.Status = status
+	s.StatusReason = &StatusReason{Code: code, Message: message}
+}
+
+// degrade marks the service degraded unless it already reports a worse
+// status.
+func (s *ServiceStats) degrade(code, message string) {
+	if s.Status == StatusRunning {
+		s.setStatus(StatusDegraded, code, message)
+	}
 }
 
 // StatItem is a single key-value metric shown on the service card.
@@ -54,10 +150,11 @@ type StatItem struct {
 
 // ContainerInfo is a lightweight container record used during detection.
 type ContainerInfo struct {
-	Name      string `json:"name"`
-	Image     string `json:"image"`
-	State     string `json:"state"`
-	HostPorts []int  `json:"hostPorts,omitempty"`
+	Name      string            `json:"name"`
+	Image     string            `json:"image"`
+	State     string            `json:"state"`
+	HostPorts []int             `json:"hostPorts,omitempty"`
+	Mounts    map[string]string `json:"mounts,omitempty"` // container path → host path
 }
 
 var registry []ServicePlugin
@@ -0,0 +1,441 @@
+//go:build !noplugins
+
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os/exec"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func init() {
+	Register(&SecurityPlugin{})
+}
+
+// SecurityPlugin reports intrusion prevention state from CrowdSec (active
+// decisions, recent alert scenarios, bouncer health) or fail2ban (jails and
+// bans). Both are read through their CLIs, cscli and fail2ban-client, run
+// inside the container or on the host. A CrowdSec LAPI elsewhere is read
+// through "url" and a bouncer "apiKey", which only covers decisions.
+type SecurityPlugin struct {
+	bans authFailureWindow // fail2ban's cumulative ban counter
+}
+
+func (p *SecurityPlugin) ID() string   { return "security" }
+func (p *SecurityPlugin) Name() string { return "Security" }
+func (p *SecurityPlugin) Icon() string { return "lock.shield" }
+
+const (
+	crowdsecLAPIPort = 8080
+
+	// A bouncer polls the LAPI every few seconds; one silent for longer
+	// than this has stopped enforcing decisions.
+	bouncerStaleAfter = 5 * time.Minute
+
+	// securityListMax caps the lists carried in stats.
+	securityListMax = 20
+)
+
+func (p *SecurityPlugin) Detect(ctx context.Context, env *DetectionEnv) *DetectedService {
+	base := &DetectedService{
+		PluginID: p.ID(),
+		Icon:     p.Icon(),
+		Meta:     make(map[string]string),
+	}
+	crowdsec := func(how string) *DetectedService {
+		base.Name = "CrowdSec"
+		base.Meta["engine"] = "crowdsec"
+		if base.BaseURL == "" {
+			base.BaseURL = fmt.Sprintf("http://127.0.0.1:%d", crowdsecLAPIPort)
+		}
+		log.Printf("services: crowdsec detected via %s", how)
+		return base
+	}
+	fail2ban := func(how string) *DetectedService {
+		base.Name = "fail2ban"
+		base.Meta["engine"] = "fail2ban"
+		log.Printf("services: fail2ban detected via %s", how)
+		return base
+	}
+
+	// Strategy 1: a CrowdSec LAPI configured by address
+	if url := strings.TrimRight(env.Config(p.ID(), "url"), "/"); url != "" {
+		base.BaseURL = url
+		return crowdsec("config (" + url + ")")
+	}
+
+	// Strategy 2: containers, where the CLIs run through docker exec
+	for _, c := range env.Containers {
+		if c.State != "running" {
+			continue
+		}
+		image := strings.ToLower(path.Base(strings.SplitN(c.Image, ":", 2)[0]))
+		switch {
+		case strings.Contains(image, "crowdsec") && !strings.Contains(image, "bouncer"):
+			base.Meta["container"] = c.Name
+			base.Meta["dockerSocket"] = env.DockerSocket
+			for _, port := range c.HostPorts {
+				if port == crowdsecLAPIPort {
+					base.BaseURL = fmt.Sprintf("http://127.0.0.1:%d", port)
+				}
+			}
+			return crowdsec("docker (" + c.Image + ")")
+		case strings.Contains(image, "fail2ban"):
+			base.Meta["container"] = c.Name
+			base.Meta["dockerSocket"] = env.DockerSocket
+			return fail2ban("docker (" + c.Image + ")")
+		}
+	}
+
+	// Strategy 3: host processes
+	if env.HasProcess("crowdsec") {
+		return crowdsec("process")
+	}
+	if env.HasProcessSubstring("fail2ban-server") {
+		return fail2ban("process")
+	}
+	return nil
+}
+
+func (p *SecurityPlugin) Collect(ctx context.Context, svc *DetectedService) (*ServiceStats, error) {
+	if svc.Meta["engine"] == "fail2ban" {
+		return p.collectFail2ban(ctx, svc)
+	}
+	return p.collectCrowdSec(ctx, svc)
+}
+
+// securityCommand runs an engine CLI in the service's container, or on the
+// host when it has none.
+func securityCommand(ctx context.Context, svc *DetectedService, args ...string) ([]byte, error) {
+	if name := svc.Meta["container"]; name != "" {
+		out, err := execInContainer(ctx, svc.Meta["dockerSocket"], name, args)
+		return []byte(out), err
+	}
+	return exec.CommandContext(ctx, args[0], args[1:]...).Output()
+}
+
+// decodeCLIJSON decodes CLI output, skipping any log lines printed before
+// the JSON document (container exec output mixes in stderr).
+func decodeCLIJSON(out []byte, v interface{}) error {
+	for len(out) > 0 {
+		line, rest, _ := bytes.Cut(out, []byte("\n"))
+		if s := bytes.TrimSpace(line); len(s) > 0 && (s[0] == '[' || s[0] == '{' || string(s) == "null") {
+			break
+		}
+		out = rest
+	}
+	if s := bytes.TrimSpace(out); len(s) == 0 || string(s) == "null" {
+		return nil
+	}
+	return json.Unmarshal(out, v)
+}
+
+// --- CrowdSec ---
+
+type crowdsecDecision struct {
+	Origin   string `json:"origin"`
+	Type     string `json:"type"`
+	Scope    string `json:"scope"`
+	Value    string `json:"value"`
+	Duration string `json:"duration"`
+	Scenario string `json:"scenario"`
+}
+
+type crowdsecAlert struct {
+	Scenario  string `json:"scenario"`
+	CreatedAt string `json:"created_at"`
+	Source    struct {
+		IP    string `json:"ip"`
+		Value string `json:"value"`
+		Cn    string `json:"cn"`
+	} `json:"source"`
+	Decisions []crowdsecDecision `json:"decisions"`
+}
+
+type crowdsecBouncer struct {
+	Name      string `json:"name"`
+	IPAddress string `json:"ip_address"`
+	Type      string `json:"type"`
+	Version   string `json:"version"`
+	LastPull  string `json:"last_pull"`
+	Revoked   bool   `json:"revoked"`
+}
+
+func (p *SecurityPlugin) collectCrowdSec(ctx context.Context, svc *DetectedService) (*ServiceStats, error) {
+	stats := &ServiceStats{
+		PluginID: p.ID(),
+		Name:     svc.Name,
+		Icon:     p.Icon(),
+		Status:   StatusRunning,
+		Stats:    map[string]interface{}{"engine": "crowdsec"},
+	}
+
+	// cscli lists local decisions (not the community blocklist) grouped
+	// under the alerts that caused them.
+	var decisions []crowdsecDecision
+	out, err := securityCommand(ctx, svc, "cscli", "decisions", "list", "-o", "json", "--limit", "0")
+	cli := err == nil
+	if cli {
+		var grouped []crowdsecAlert
+		if err := decodeCLIJSON(out, &grouped); err != nil {
+			return nil, fmt.Errorf("invalid cscli decisions output: %w", err)
+		}
+		for _, a := range grouped {
+			decisions = append(decisions, a.Decisions...)
+		}
+	} else if apiKey := svc.Meta["apiKey"]; apiKey != "" {
+		body, err := HTTPGetWithHeaders(ctx, svc.BaseURL+"/v1/decisions?origins=crowdsec,cscli", map[string]string{"X-Api-Key": apiKey})
+		if err != nil {
+			return nil, fmt.Errorf("could not reach CrowdSec LAPI at %s: %w", svc.BaseURL, err)
+		}
+		if err := decodeCLIJSON(body, &decisions); err != nil {
+			return nil, fmt.Errorf("invalid CrowdSec decisions response: %w", err)
+		}
+	} else if svc.Meta["container"] == "" {
+		// Bare LAPI, or an agent in Docker that can't run the host's cscli.
+		stats.Summary = []StatItem{
+			{Label: "Status", Value: "Running", Type: "status"},
+		}
+		stats.Stats["authRequired"] = true
+		stats.setStatus(StatusAuthRequired, "credentials_missing", "set apiKey to a CrowdSec bouncer key, or container to run cscli in")
+		return stats, nil
+	} else {
+		return nil, fmt.Errorf("could not run cscli in %s: %w", svc.Meta["container"], err)
+	}
+
+	bans := 0
+	byOrigin := make(map[string]int)
+	active := []map[string]interface{}{}
+	for _, d := range decisions {
+		if d.Type == "ban" {
+			bans++
+		}
+		byOrigin[d.Origin]++
+		if len(active) < securityListMax {
+			active = append(active, map[string]interface{}{
+				"value":    d.Value,
+				"scope":    d.Scope,
+				"type":     d.Type,
+				"scenario": d.Scenario,
+				"origin":   d.Origin,
+				"duration": d.Duration,
+			})
+		}
+	}
+	stats.Summary = []StatItem{
+		{Label: "Decisions", Value: FormatNumber(int64(len(decisions))), Type: "number"},
+	}
+	stats.Stats["activeDecisions"] = len(decisions)
+	stats.Stats["activeBans"] = bans
+	stats.Stats["decisionsByOrigin"] = byOrigin
+	stats.Stats["decisions"] = active
+	if !cli {
+		return stats, nil
+	}
+
+	// Alerts and bouncers need a machine login that only cscli has.
+	var alerts []crowdsecAlert
+	if out, err := securityCommand(ctx, svc, "cscli", "alerts", "list", "-o", "json", "--since", "24h", "--limit", "500"); err == nil {
+		if err := decodeCLIJSON(out, &alerts); err != nil {
+			log.Printf("services: crowdsec alerts: %v", err)
+		}
+	} else {
+		log.Printf("services: crowdsec alerts: %v", err)
+	}
+	recentCutoff := time.Now().Add(-authFailureSpan)
+	recentBans := 0
+	counts := make(map[string]int)
+	var lastAlert time.Time
+	for _, a := range alerts {
+		counts[a.Scenario]++
+		t, err := time.Parse(time.RFC3339, a.CreatedAt)
+		if err != nil {
+			continue
+		}
+		if t.After(lastAlert) {
+			lastAlert = t
+		}
+		if t.After(recentCutoff) {
+			for _, d := range a.Decisions {
+				if d.Type == "ban" {
+					recentBans++
+				}
+			}
+		}
+	}
+	scenarios := make([]map[string]interface{}, 0, len(counts))
+	for name, n := range counts {
+		scenarios = append(scenarios, map[string]interface{}{"scenario": name, "alerts": n})
+	}
+	sort.Slice(scenarios, func(i, j int) bool {
+		ni, nj := scenarios[i]["alerts"].(int), scenarios[j]["alerts"].(int)
+		if ni != nj {
+			return ni > nj
+		}
+		return scenarios[i]["scenario"].(string) < scenarios[j]["scenario"].(string)
+	})
+	if len(scenarios) > securityListMax {
+		scenarios = scenarios[:securityListMax]
+	}
+
+	var bouncers []crowdsecBouncer
+	if out, err := securityCommand(ctx, svc, "cscli", "bouncers", "list", "-o", "json"); err == nil {
+		if err := decodeCLIJSON(out, &bouncers); err != nil {
+			log.Printf("services: crowdsec bouncers: %v", err)
+		}
+	} else {
+		log.Printf("services: crowdsec bouncers: %v", err)
+	}
+	healthy := 0
+	bouncerList := make([]map[string]interface{}, 0, len(bouncers))
+	for _, b := range bouncers {
+		entry := map[string]interface{}{
+			"name":    b.Name,
+			"type":    b.Type,
+			"version": b.Version,
+			"ip":      b.IPAddress,
+			"revoked": b.Revoked,
+		}
+		ok := false
+		if t, err := time.Parse(time.RFC3339, b.LastPull); err == nil {
+			entry["lastPull"] = t.UTC().Format(time.RFC3339)
+			ok = !b.Revoked && time.Since(t) < bouncerStaleAfter
+		}
+		entry["healthy"] = ok
+		if ok {
+			healthy++
+		}
+		bouncerList = append(bouncerList, entry)
+	}
+
+	stats.Summary = append(stats.Summary,
+		StatItem{Label: "Alerts (24h)", Value: FormatNumber(int64(len(alerts))), Type: "number"},
+		StatItem{Label: "Bouncers", Value: fmt.Sprintf("%d/%d", healthy, len(bouncers)), Type: "text"},
+	)
+	stats.Stats["alerts24h"] = len(alerts)
+	stats.Stats["recentBans"] = recentBans
+	stats.Stats["scenarios"] = scenarios
+	if !lastAlert.IsZero() {
+		stats.Stats["lastAlertAt"] = lastAlert.UTC().Format(time.RFC3339)
+	}
+	stats.Stats["bouncers"] = bouncerList
+	stats.Stats["bouncersHealthy"] = healthy
+	if healthy < len(bouncers) {
+		stats.degrade("bouncers_unhealthy", fmt.Sprintf("%d of %d bouncers not pulling decisions", len(bouncers)-healthy, len(bouncers)))
+	}
+	return stats, nil
+}
+
+// --- fail2ban ---
+
+// fail2banJail is the parsed output of `fail2ban-client status <jail>`.
+type fail2banJail struct {
+	Name            string
+	CurrentlyFailed int
+	TotalFailed     int
+	CurrentlyBanned int
+	TotalBanned     int
+	BannedIPs       []string
+}
+
+func (p *SecurityPlugin) collectFail2ban(ctx context.Context, svc *DetectedService) (*ServiceStats, error) {
+	out, err := securityCommand(ctx, svc, "fail2ban-client", "status")
+	if err != nil {
+		return nil, fmt.Errorf("could not query fail2ban: %w", err)
+	}
+	names := strings.Split(fail2banField(out, "Jail list"), ",")
+
+	var jails []fail2banJail
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		out, err := securityCommand(ctx, svc, "fail2ban-client", "status", name)
+		if err != nil {
+			log.Printf("services: fail2ban jail %s: %v", name, err)
+			continue
+		}
+		jails = append(jails, parseFail2banJail(name, out))
+	}
+
+	var banned, failed, totalBanned int
+	jailList := make([]map[string]interface{}, 0, len(jails))
+	for _, j := range jails {
+		banned += j.CurrentlyBanned
+		failed += j.CurrentlyFailed
+		totalBanned += j.TotalBanned
+		ips := j.BannedIPs
+		if len(ips) > securityListMax {
+			ips = ips[:securityListMax]
+		}
+		jailList = append(jailList, map[string]interface{}{
+			"name":            j.Name,
+			"currentlyBanned": j.CurrentlyBanned,
+			"totalBanned":     j.TotalBanned,
+			"currentlyFailed": j.CurrentlyFailed,
+			"totalFailed":     j.TotalFailed,
+			"bannedIps":       ips,
+		})
+	}
+	recentBans := int(p.bans.add(time.Now(), float64(totalBanned)))
+
+	return &ServiceStats{
+		PluginID: p.ID(),
+		Name:     svc.Name,
+		Icon:     p.Icon(),
+		Status:   StatusRunning,
+		Summary: []StatItem{
+			{Label: "Jails", Value: FormatNumber(int64(len(jails))), Type: "number"},
+			{Label: "Banned", Value: FormatNumber(int64(banned)), Type: "number"},
+			{Label: "Failing", Value: FormatNumber(int64(failed)), Type: "number"},
+		},
+		Stats: map[string]interface{}{
+			"engine":      "fail2ban",
+			"jails":       jailList,
+			"activeBans":  banned,
+			"failing":     failed,
+			"totalBanned": totalBanned,
+			"recentBans":  recentBans,
+		},
+	}, nil
+}
+
+// parseFail2banJail reads the tree `fail2ban-client status <jail>` prints.
+func parseFail2banJail(name string, out []byte) fail2banJail {
+	num := func(label string) int {
+		n, _ := strconv.Atoi(fail2banField(out, label))
+		return n
+	}
+	return fail2banJail{
+		Name:            name,
+		CurrentlyFailed: num("Currently failed"),
+		TotalFailed:     num("Total failed"),
+		CurrentlyBanned: num("Currently banned"),
+		TotalBanned:     num("Total banned"),
+		BannedIPs:       strings.Fields(fail2banField(out, "Banned IP list")),
+	}
+}
+
+// fail2banField returns the value after "label:" in fail2ban-client's
+// status tree, e.g. "|- Currently banned:\t2".
+func fail2banField(out []byte, label string) string {
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+	for scanner.Scan() {
+		line := strings.TrimLeft(scanner.Text(), " |`-")
+		if value, ok := strings.CutPrefix(line, label+":"); ok {
+			return strings.TrimSpace(value)
+		}
+	}
+	return ""
+}
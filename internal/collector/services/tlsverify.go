@@ -0,0 +1,116 @@
+package services
+
+import (
+	"cmp"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Per-service TLS verification. Service APIs are called without verifying
+// certificates by default, since most self-hosted services use self-signed
+// ones. Three service settings turn verification on:
+//
+//	tlsCa          PEM CA bundle to verify the service's certificate with
+//	tlsSkipVerify  "false" verifies against the system roots; "true" skips even with tlsCa
+//	tlsServerName  name expected in the certificate and sent as SNI, for services reached by IP
+//
+// Collection, actions and route listing carry the settings in their context
+// to the HTTP helpers. Detection probes only check that something answers
+// and send no credentials, so they stay unverified.
+
+// serviceTLS is comparable so it can key the pooled transports.
+type serviceTLS struct {
+	verify     bool
+	roots      *x509.CertPool // nil for the system roots
+	serverName string
+}
+
+type serviceTLSKey struct{}
+
+// withServiceTLS returns ctx carrying the TLS settings in a service's meta.
+func withServiceTLS(ctx context.Context, meta map[string]string) (context.Context, error) {
+	st := serviceTLS{serverName: meta["tlsServerName"]}
+	if ca := meta["tlsCa"]; ca != "" {
+		pool, err := loadCAPool(ca)
+		if err != nil {
+			return ctx, fmt.Errorf("tlsCa: %w", err)
+		}
+		st.roots, st.verify = pool, true
+	}
+	if v := meta["tlsSkipVerify"]; v != "" {
+		skip, err := strconv.ParseBool(v)
+		if err != nil {
+			return ctx, fmt.Errorf("tlsSkipVerify: %q is not true or false", v)
+		}
+		st.verify = !skip
+	}
+	return context.WithValue(ctx, serviceTLSKey{}, st), nil
+}
+
+// tlsConfigFor is the client TLS config for a connection to host made
+// under ctx.
+func tlsConfigFor(ctx context.Context, host string) *tls.Config {
+	cfg := serviceTLSFrom(ctx).config()
+	cfg.ServerName = cmp.Or(cfg.ServerName, host)
+	return cfg
+}
+
+// serviceTLSFrom returns the settings ctx carries; the zero value, which
+// skips verification, when it carries none.
+func serviceTLSFrom(ctx context.Context) serviceTLS {
+	st, _ := ctx.Value(serviceTLSKey{}).(serviceTLS)
+	return st
+}
+
+// config is the client TLS config for these settings. An empty ServerName
+// makes the transport use the host it connects to.
+func (st serviceTLS) config() *tls.Config {
+	return &tls.Config{
+		InsecureSkipVerify: !st.verify,
+		RootCAs:            st.roots,
+		ServerName:         st.serverName,
+	}
+}
+
+// CA bundles are cached and re-read when the file changes.
+var caPools struct {
+	sync.Mutex
+	m map[string]cachedCAPool
+}
+
+type cachedCAPool struct {
+	modTime time.Time
+	size    int64
+	pool    *x509.CertPool
+}
+
+func loadCAPool(path string) (*x509.CertPool, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	caPools.Lock()
+	defer caPools.Unlock()
+	if c, ok := caPools.m[path]; ok && c.modTime.Equal(fi.ModTime()) && c.size == fi.Size() {
+		return c.pool, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no PEM certificates in %s", path)
+	}
+	if caPools.m == nil {
+		caPools.m = make(map[string]cachedCAPool)
+	}
+	caPools.m[path] = cachedCAPool{modTime: fi.ModTime(), size: fi.Size(), pool: pool}
+	return pool, nil
+}
@@ -1,3 +1,5 @@
+//go:build !noplugins
+
 package services
 
 import (
@@ -5,6 +7,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"regexp"
+	"sort"
+	"strings"
 )
 
 func init() {
@@ -61,7 +66,7 @@ func (p *TraefikPlugin) Collect(ctx context.Context, svc *DetectedService) (*Ser
 		PluginID: p.ID(),
 		Name:     p.Name(),
 		Icon:     p.Icon(),
-		Status:   "running",
+		Status:   StatusRunning,
 		Stats:    make(map[string]interface{}),
 	}
 
@@ -123,12 +128,98 @@ func (p *TraefikPlugin) Collect(ctx context.Context, svc *DetectedService) (*Ser
 	}
 
 	if totalWarnings > 0 {
-		stats.Status = "degraded"
+		stats.degrade("router_errors", fmt.Sprintf("%d routers or services with errors", totalWarnings))
 	}
 
 	return stats, nil
 }
 
+// Routes lists the HTTP routers with the load balancer servers of the
+// service each one forwards to.
+func (p *TraefikPlugin) Routes(ctx context.Context, svc *DetectedService) ([]Route, error) {
+	body, err := HTTPGet(ctx, svc.BaseURL+"/api/http/routers?per_page=1000")
+	if err != nil {
+		return nil, fmt.Errorf("could not reach Traefik API at %s: %w", svc.BaseURL, err)
+	}
+	var routers []traefikRouter
+	if err := json.Unmarshal(body, &routers); err != nil {
+		return nil, fmt.Errorf("invalid Traefik routers response: %w", err)
+	}
+
+	upstreams := make(map[string][]string)
+	if body, err := HTTPGet(ctx, svc.BaseURL+"/api/http/services?per_page=1000"); err == nil {
+		var services []traefikService
+		if json.Unmarshal(body, &services) == nil {
+			for _, s := range services {
+				for _, server := range s.LoadBalancer.Servers {
+					upstreams[s.Name] = append(upstreams[s.Name], server.URL)
+				}
+			}
+		}
+	}
+
+	routes := make([]Route, 0, len(routers))
+	for _, r := range routers {
+		// Routers name services within their own provider without a suffix.
+		service := r.Service
+		if !strings.Contains(service, "@") && r.Provider != "" {
+			service += "@" + r.Provider
+		}
+		ups := upstreams[service]
+		if ups == nil {
+			ups = []string{}
+		}
+		routes = append(routes, Route{
+			Name:        r.Name,
+			Hosts:       traefikRuleHosts(r.Rule),
+			Rule:        r.Rule,
+			EntryPoints: r.EntryPoints,
+			TLS:         r.TLS != nil,
+			Service:     service,
+			Upstreams:   ups,
+			Status:      r.Status,
+		})
+	}
+	sort.Slice(routes, func(i, j int) bool { return routes[i].Name < routes[j].Name })
+	return routes, nil
+}
+
+var (
+	traefikHostMatcher = regexp.MustCompile(`\bHost\(([^)]*)\)`)
+	traefikQuoted      = regexp.MustCompile("[`\"]([^`\"]+)[`\"]")
+)
+
+// traefikRuleHosts extracts the hostnames from Host(...) matchers in a
+// router rule, e.g. "Host(`a.example.com`) || Host(`b.example.com`)".
+func traefikRuleHosts(rule string) []string {
+	hosts := []string{}
+	for _, m := range traefikHostMatcher.FindAllStringSubmatch(rule, -1) {
+		for _, q := range traefikQuoted.FindAllStringSubmatch(m[1], -1) {
+			hosts = append(hosts, q[1])
+		}
+	}
+	return hosts
+}
+
+type traefikRouter struct {
+	Name        string          `json:"name"`
+	Rule        string          `json:"rule"`
+	Service     string          `json:"service"`
+	Provider    string          `json:"provider"`
+	Status      string          `json:"status"`
+	EntryPoints []string        `json:"entryPoints"`
+	TLS         json.RawMessage `json:"tls"`
+}
+
+type traefikService struct {
+	Name         string `json:"name"`
+	LoadBalancer struct {
+		Servers []struct {
+			URL string `json:"url"`
+		} `json:"servers"`
+	} `json:"loadBalancer"`
+}
+
 // Traefik /api/overview response structure
 type traefikOverview struct {
 	HTTP traefikProto `json:"http"`
@@ -0,0 +1,195 @@
+//go:build !noplugins
+
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"strings"
+)
+
+func init() {
+	Register(&TrueNASPlugin{})
+}
+
+// TrueNASPlugin reports pool health, scrub/resilver progress and active
+// alerts from the TrueNAS SCALE middleware REST API. Requires an API key
+// configured as "apiKey".
+type TrueNASPlugin struct{}
+
+func (p *TrueNASPlugin) ID() string   { return "truenas" }
+func (p *TrueNASPlugin) Name() string { return "TrueNAS SCALE" }
+func (p *TrueNASPlugin) Icon() string { return "internaldrive" }
+
+func (p *TrueNASPlugin) Detect(ctx context.Context, env *DetectionEnv) *DetectedService {
+	if !isTrueNASHost() && !env.HasProcessSubstring("middlewared") {
+		return nil
+	}
+
+	base := &DetectedService{
+		PluginID: p.ID(),
+		Name:     p.Name(),
+		Icon:     p.Icon(),
+		Meta:     make(map[string]string),
+	}
+
+	if data, err := os.ReadFile(HostPath("/etc/version")); err == nil {
+		base.Version = strings.TrimSpace(string(data))
+	}
+
+	if url := env.ProbeHTTP([]int{80, 443}, "/api/v2.0/"); url != "" {
+		base.BaseURL = url
+		log.Printf("services: truenas %s detected at %s", base.Version, url)
+		return base
+	}
+	if url := env.ProbeHTTP([]int{80, 443}, "/ui/"); url != "" {
+		base.BaseURL = url
+		log.Printf("services: truenas %s detected via web UI at %s", base.Version, url)
+		return base
+	}
+
+	log.Printf("services: truenas host found but middleware API not reachable")
+	return nil
+}
+
+// isTrueNASHost checks for files only present on TrueNAS SCALE installs.
+func isTrueNASHost() bool {
+	for _, path := range []string{"/usr/bin/midclt", "/data/freenas-v1.db"} {
+		if _, err := os.Stat(HostPath(path)); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// truenasPool is an entry from GET /api/v2.0/pool.
+type truenasPool struct {
+	Name      string `json:"name"`
+	Status    string `json:"status"` // ONLINE, DEGRADED, FAULTED, ...
+	Healthy   bool   `json:"healthy"`
+	Size      uint64 `json:"size"`
+	Allocated uint64 `json:"allocated"`
+	Scan      *struct {
+		Function   string  `json:"function"` // SCRUB, RESILVER
+		State      string  `json:"state"`    // SCANNING, FINISHED, CANCELED
+		Percentage float64 `json:"percentage"`
+		Errors     int64   `json:"errors"`
+	} `json:"scan"`
+}
+
+// truenasAlert is an entry from GET /api/v2.0/alert/list.
+type truenasAlert struct {
+	Level     string `json:"level"` // INFO, WARNING, CRITICAL, ...
+	Dismissed bool   `json:"dismissed"`
+	Formatted string `json:"formatted"`
+}
+
+func (p *TrueNASPlugin) Collect(ctx context.Context, svc *DetectedService) (*ServiceStats, error) {
+	stats := &ServiceStats{
+		PluginID: p.ID(),
+		Name:     p.Name(),
+		Icon:     p.Icon(),
+		Status:   StatusRunning,
+		Stats:    make(map[string]interface{}),
+	}
+
+	apiKey := svc.Meta["apiKey"]
+	if apiKey == "" {
+		stats.setStatus(StatusAuthRequired, "credentials_missing", "set apiKey to a TrueNAS API key")
+		stats.Summary = []StatItem{
+			{Label: "Status", Value: "Running", Type: "status"},
+		}
+		stats.Stats = map[string]interface{}{
+			"version":      svc.Version,
+			"authRequired": true,
+		}
+		return stats, nil
+	}
+	headers := map[string]string{"Authorization": "Bearer " + apiKey}
+
+	body, err := HTTPGetWithHeaders(ctx, svc.BaseURL+"/api/v2.0/pool", headers)
+	if err != nil {
+		return nil, fmt.Errorf("could not reach TrueNAS API at %s: %w", svc.BaseURL, err)
+	}
+	var pools []truenasPool
+	if err := json.Unmarshal(body, &pools); err != nil {
+		return nil, fmt.Errorf("invalid TrueNAS pool response: %w", err)
+	}
+
+	var alerts []truenasAlert
+	if body, err := HTTPGetWithHeaders(ctx, svc.BaseURL+"/api/v2.0/alert/list", headers); err == nil {
+		_ = json.Unmarshal(body, &alerts)
+	}
+
+	unhealthy := 0
+	scanning := ""
+	poolList := make([]map[string]interface{}, 0, len(pools))
+	for _, pool := range pools {
+		if !pool.Healthy || pool.Status != "ONLINE" {
+			unhealthy++
+		}
+		entry := map[string]interface{}{
+			"name":           pool.Name,
+			"status":         pool.Status,
+			"healthy":        pool.Healthy,
+			"sizeBytes":      pool.Size,
+			"allocatedBytes": pool.Allocated,
+		}
+		if pool.Size > 0 {
+			entry["usagePercent"] = math.Round(float64(pool.Allocated)/float64(pool.Size)*1000) / 10
+		}
+		if pool.Scan != nil {
+			entry["scanFunction"] = pool.Scan.Function
+			entry["scanState"] = pool.Scan.State
+			entry["scanPercent"] = math.Round(pool.Scan.Percentage*10) / 10
+			entry["scanErrors"] = pool.Scan.Errors
+			if pool.Scan.State == "SCANNING" && scanning == "" {
+				scanning = fmt.Sprintf("%s %.1f%%", capitalize(pool.Scan.Function), pool.Scan.Percentage)
+			}
+		}
+		poolList = append(poolList, entry)
+	}
+
+	var activeAlerts, criticalAlerts int
+	for _, a := range alerts {
+		if a.Dismissed {
+			continue
+		}
+		activeAlerts++
+		if a.Level == "CRITICAL" || a.Level == "ALERT" || a.Level == "EMERGENCY" {
+			criticalAlerts++
+		}
+	}
+
+	if scanning == "" {
+		scanning = "Idle"
+	}
+
+	stats.Summary = []StatItem{
+		{Label: "Pools", Value: FormatNumber(int64(len(pools))), Type: "number"},
+		{Label: "Unhealthy", Value: FormatNumber(int64(unhealthy)), Type: "number"},
+		{Label: "Scrub", Value: scanning, Type: "text"},
+		{Label: "Alerts", Value: FormatNumber(int64(activeAlerts)), Type: "number"},
+	}
+
+	stats.Stats = map[string]interface{}{
+		"version":        svc.Version,
+		"pools":          poolList,
+		"unhealthyPools": unhealthy,
+		"activeAlerts":   activeAlerts,
+		"criticalAlerts": criticalAlerts,
+	}
+
+	switch {
+	case unhealthy > 0:
+		stats.degrade("pools_unhealthy", fmt.Sprintf("%d pools unhealthy", unhealthy))
+	case criticalAlerts > 0:
+		stats.degrade("alerts_critical", fmt.Sprintf("%d critical alerts", criticalAlerts))
+	}
+
+	return stats, nil
+}
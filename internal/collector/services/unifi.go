@@ -0,0 +1,448 @@
+//go:build !noplugins
+
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/cookiejar"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+func init() {
+	Register(&UniFiPlugin{})
+}
+
+// UniFiPlugin reports adopted devices, clients online, WAN uptime and
+// pending firmware upgrades from a UniFi Network controller. It detects a
+// local controller (Docker image or package install) or uses a configured
+// "url" for one elsewhere on the LAN, such as a Cloud Key or UDM. Requires
+// "username" and "password" of a local controller account, or an "apiKey"
+// on UniFi OS consoles. "site" selects the site (default "default").
+type UniFiPlugin struct {
+	mu      sync.Mutex
+	session *unifiSession
+}
+
+func (p *UniFiPlugin) ID() string   { return "unifi" }
+func (p *UniFiPlugin) Name() string { return "UniFi Network" }
+func (p *UniFiPlugin) Icon() string { return "wifi.router" }
+
+// unifiDefaultPort is the controller's HTTPS port for the API and web UI.
+const unifiDefaultPort = 8443
+
+func (p *UniFiPlugin) Detect(ctx context.Context, env *DetectionEnv) *DetectedService {
+	base := &DetectedService{
+		PluginID: p.ID(),
+		Name:     p.Name(),
+		Icon:     p.Icon(),
+		Meta:     make(map[string]string),
+	}
+
+	// Strategy 1: configured controller, possibly on another machine.
+	if url := strings.TrimRight(env.Config(p.ID(), "url"), "/"); url != "" {
+		base.BaseURL = url
+		base.Version = unifiVersion(ctx, url)
+		log.Printf("services: unifi configured at %s", url)
+		return base
+	}
+
+	// Strategy 2: controller container (jacobalberty/unifi,
+	// linuxserver/unifi-network-application, ...).
+	if c := env.FindDockerImage("unifi"); c != nil && c.State == "running" {
+		ports := append(c.HostPorts, unifiDefaultPort)
+		if url := env.ProbeHTTP(ports, "/status"); url != "" {
+			base.BaseURL = url
+			base.Version = unifiVersion(ctx, url)
+			log.Printf("services: unifi detected via docker (%s) at %s", c.Image, url)
+			return base
+		}
+	}
+
+	// Strategy 3: Debian package install. The controller runs as java, so
+	// look for its install directory too.
+	_, err := os.Stat(HostPath("/usr/lib/unifi/lib/ace.jar"))
+	if err != nil && !env.HasProcessSubstring("unifi") {
+		return nil
+	}
+	if url := env.ProbeHTTP([]int{unifiDefaultPort}, "/status"); url != "" {
+		base.BaseURL = url
+		base.Version = unifiVersion(ctx, url)
+		log.Printf("services: unifi detected at %s", url)
+		return base
+	}
+
+	log.Printf("services: unifi install found but controller not reachable")
+	return nil
+}
+
+// unifiVersion reads the controller version from the unauthenticated
+// /status endpoint. UniFi OS consoles don't serve it and return "".
+func unifiVersion(ctx context.Context, baseURL string) string {
+	body, err := HTTPGet(ctx, baseURL+"/status")
+	if err != nil {
+		return ""
+	}
+	var status struct {
+		Meta struct {
+			ServerVersion string `json:"server_version"`
+		} `json:"meta"`
+	}
+	if json.Unmarshal(body, &status) != nil {
+		return ""
+	}
+	return status.Meta.ServerVersion
+}
+
+// --- Collection ---
+
+// unifiDevice is an entry from stat/device.
+type unifiDevice struct {
+	Name       string `json:"name"`
+	MAC        string `json:"mac"`
+	Model      string `json:"model"`
+	Type       string `json:"type"`  // "uap", "usw", "ugw", "udm", ...
+	State      int    `json:"state"` // 1 = connected
+	Adopted    bool   `json:"adopted"`
+	Version    string `json:"version"`
+	Upgradable bool   `json:"upgradable"`
+	UpgradeTo  string `json:"upgrade_to_firmware"`
+	Uptime     int64  `json:"uptime"`
+	NumClients int    `json:"num_sta"`
+}
+
+// unifiHealth is an entry from stat/health, one per subsystem.
+type unifiHealth struct {
+	Subsystem    string `json:"subsystem"` // "wan", "www", "lan", "wlan", "vpn"
+	Status       string `json:"status"`    // "ok", "warning", "error", "unknown"
+	NumUser      int    `json:"num_user"`
+	NumGuest     int    `json:"num_guest"`
+	Uptime       int64  `json:"uptime"` // "www": seconds of internet connectivity
+	WANIP        string `json:"wan_ip"`
+	GatewayStats struct {
+		Uptime interface{} `json:"uptime"`
+	} `json:"gw_system-stats"`
+}
+
+func (p *UniFiPlugin) Collect(ctx context.Context, svc *DetectedService) (*ServiceStats, error) {
+	stats := &ServiceStats{
+		PluginID: p.ID(),
+		Name:     p.Name(),
+		Icon:     p.Icon(),
+		Status:   StatusRunning,
+		Stats:    make(map[string]interface{}),
+	}
+
+	creds := unifiCredentials{
+		username: svc.Meta["username"],
+		password: svc.Meta["password"],
+		apiKey:   svc.Meta["apiKey"],
+	}
+	if creds.apiKey == "" && (creds.username == "" || creds.password == "") {
+		stats.setStatus(StatusAuthRequired, "credentials_missing", "set apiKey, or username and password")
+		stats.Summary = []StatItem{
+			{Label: "Status", Value: "Running", Type: "status"},
+		}
+		stats.Stats = map[string]interface{}{
+			"version":      svc.Version,
+			"authRequired": true,
+		}
+		return stats, nil
+	}
+
+	site := svc.Meta["site"]
+	if site == "" {
+		site = "default"
+	}
+	s := p.sessionFor(ctx, svc.BaseURL)
+
+	var devices []unifiDevice
+	if err := s.get(ctx, creds, "/api/s/"+site+"/stat/device", &devices); err != nil {
+		return nil, fmt.Errorf("could not reach UniFi controller at %s: %w", svc.BaseURL, err)
+	}
+	var health []unifiHealth
+	if err := s.get(ctx, creds, "/api/s/"+site+"/stat/health", &health); err != nil {
+		log.Printf("services: unifi health: %v", err)
+	}
+
+	var adopted, online, upgrades int
+	deviceList := make([]map[string]interface{}, 0, len(devices))
+	for _, d := range devices {
+		if !d.Adopted {
+			continue
+		}
+		adopted++
+		if d.State == 1 {
+			online++
+		}
+		if d.Upgradable {
+			upgrades++
+		}
+		name := d.Name
+		if name == "" {
+			name = d.MAC
+		}
+		deviceList = append(deviceList, map[string]interface{}{
+			"name":          name,
+			"mac":           d.MAC,
+			"model":         d.Model,
+			"type":          d.Type,
+			"online":        d.State == 1,
+			"version":       d.Version,
+			"upgradable":    d.Upgradable,
+			"upgradeTo":     d.UpgradeTo,
+			"clients":       d.NumClients,
+			"uptimeSeconds": d.Uptime,
+		})
+	}
+	sort.Slice(deviceList, func(i, j int) bool {
+		return deviceList[i]["name"].(string) < deviceList[j]["name"].(string)
+	})
+
+	var wired, wireless int
+	wanStatus := "unknown"
+	var wanUptime int64
+	var wanIP string
+	for _, h := range health {
+		switch h.Subsystem {
+		case "lan":
+			wired = h.NumUser + h.NumGuest
+		case "wlan":
+			wireless = h.NumUser + h.NumGuest
+		case "wan":
+			wanStatus = h.Status
+			wanIP = h.WANIP
+			if wanUptime == 0 {
+				wanUptime = toInt64(h.GatewayStats.Uptime)
+			}
+		case "www":
+			// Internet uptime is the better measure when the gateway reports it.
+			if h.Uptime > 0 {
+				wanUptime = h.Uptime
+			}
+		}
+	}
+
+	stats.Summary = []StatItem{
+		{Label: "Devices", Value: fmt.Sprintf("%d/%d", online, adopted), Type: "text"},
+		{Label: "Clients", Value: FormatNumber(int64(wired + wireless)), Type: "number"},
+		{Label: "WAN Uptime", Value: formatDuration(wanUptime), Type: "text"},
+		{Label: "Upgrades", Value: FormatNumber(int64(upgrades)), Type: "number"},
+	}
+
+	stats.Stats = map[string]interface{}{
+		"version":           svc.Version,
+		"site":              site,
+		"devicesAdopted":    adopted,
+		"devicesOnline":     online,
+		"clientsOnline":     wired + wireless,
+		"wiredClients":      wired,
+		"wirelessClients":   wireless,
+		"wanStatus":         wanStatus,
+		"wanIp":             wanIP,
+		"wanUptimeSeconds":  wanUptime,
+		"upgradesAvailable": upgrades,
+		"devices":           deviceList,
+	}
+
+	switch {
+	case wanStatus != "ok" && wanStatus != "unknown":
+		stats.degrade("wan_down", "WAN status is "+wanStatus)
+	case online < adopted:
+		stats.degrade("devices_offline", fmt.Sprintf("%d of %d devices offline", adopted-online, adopted))
+	}
+
+	return stats, nil
+}
+
+// formatDuration renders seconds as the two largest units ("3d 4h", "12m").
+func formatDuration(seconds int64) string {
+	if seconds <= 0 {
+		return "—"
+	}
+	d := time.Duration(seconds) * time.Second
+	days := int64(d.Hours()) / 24
+	hours := int64(d.Hours()) % 24
+	minutes := int64(d.Minutes()) % 60
+	switch {
+	case days > 0:
+		return fmt.Sprintf("%dd %dh", days, hours)
+	case hours > 0:
+		return fmt.Sprintf("%dh %dm", hours, minutes)
+	}
+	return fmt.Sprintf("%dm", minutes)
+}
+
+// --- Controller session ---
+
+type unifiCredentials struct {
+	username, password, apiKey string
+}
+
+// unifiSession holds the login cookie for one controller. Classic
+// controllers serve the API at the root; UniFi OS consoles proxy it under
+// /proxy/network and also require the CSRF token returned at login.
+type unifiSession struct {
+	mu       sync.Mutex
+	baseURL  string
+	client   *http.Client
+	unifiOS  bool
+	csrf     string
+	loggedIn bool
+}
+
+// sessionFor returns the session for baseURL, starting a new one when the
+// controller address or its TLS settings changed.
+func (p *UniFiPlugin) sessionFor(ctx context.Context, baseURL string) *unifiSession {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	transport := serviceTransport(ctx)
+	if p.session == nil || p.session.baseURL != baseURL || p.session.client.Transport != transport {
+		jar, _ := cookiejar.New(nil)
+		p.session = &unifiSession{
+			baseURL: baseURL,
+			client: &http.Client{
+				Timeout:   5 * time.Second,
+				Jar:       jar,
+				Transport: transport,
+			},
+		}
+	}
+	return p.session
+}
+
+// get fetches a site API path and decodes the "data" field of the
+// response envelope into out, logging in first (and again once if the
+// session expired). API keys only exist on UniFi OS and need no login.
+func (s *unifiSession) get(ctx context.Context, creds unifiCredentials, path string, out interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if creds.apiKey != "" {
+		s.unifiOS = true
+	} else if !s.loggedIn {
+		if err := s.login(ctx, creds); err != nil {
+			return err
+		}
+	}
+
+	body, status, err := s.request(ctx, "GET", s.apiPath(path), nil, creds.apiKey)
+	if err == nil && status == http.StatusUnauthorized && creds.apiKey == "" {
+		log.Printf("services: unifi session expired, logging in again")
+		s.loggedIn = false
+		if err := s.login(ctx, creds); err != nil {
+			return err
+		}
+		body, status, err = s.request(ctx, "GET", s.apiPath(path), nil, "")
+	}
+	if err != nil {
+		return err
+	}
+	if status == http.StatusUnauthorized {
+		return fmt.Errorf("UniFi rejected the credentials")
+	}
+	if status != http.StatusOK {
+		return fmt.Errorf("HTTP %d", status)
+	}
+
+	var envelope struct {
+		Meta struct {
+			RC  string `json:"rc"`
+			Msg string `json:"msg"`
+		} `json:"meta"`
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		return fmt.Errorf("invalid UniFi response: %w", err)
+	}
+	if envelope.Meta.RC != "" && envelope.Meta.RC != "ok" {
+		return fmt.Errorf("UniFi API error: %s", envelope.Meta.Msg)
+	}
+	return json.Unmarshal(envelope.Data, out)
+}
+
+// login tries the UniFi OS endpoint first and falls back to the classic
+// controller's when the console doesn't have it.
+// Must be called with s.mu held.
+func (s *unifiSession) login(ctx context.Context, creds unifiCredentials) error {
+	payload, _ := json.Marshal(map[string]interface{}{
+		"username": creds.username,
+		"password": creds.password,
+		"remember": true,
+	})
+
+	s.unifiOS = true
+	s.csrf = ""
+	_, status, err := s.request(ctx, "POST", "/api/auth/login", payload, "")
+	if err == nil && (status == http.StatusNotFound || status == http.StatusMethodNotAllowed) {
+		s.unifiOS = false
+		_, status, err = s.request(ctx, "POST", "/api/login", payload, "")
+	}
+	if err != nil {
+		return fmt.Errorf("login request failed: %w", err)
+	}
+	switch {
+	case status == http.StatusUnauthorized || status == http.StatusBadRequest || status == http.StatusForbidden:
+		return fmt.Errorf("invalid UniFi username or password")
+	case status != http.StatusOK:
+		return fmt.Errorf("login returned HTTP %d", status)
+	}
+
+	s.loggedIn = true
+	log.Printf("services: unifi session acquired (unifiOS=%v)", s.unifiOS)
+	return nil
+}
+
+func (s *unifiSession) apiPath(path string) string {
+	if s.unifiOS {
+		return "/proxy/network" + path
+	}
+	return path
+}
+
+// request sends one request, remembering a CSRF token the console hands out.
+// Must be called with s.mu held.
+func (s *unifiSession) request(ctx context.Context, method, path string, jsonBody []byte, apiKey string) ([]byte, int, error) {
+	var bodyReader io.Reader
+	if jsonBody != nil {
+		bodyReader = bytes.NewReader(jsonBody)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, s.baseURL+path, bodyReader)
+	if err != nil {
+		return nil, 0, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if jsonBody != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if apiKey != "" {
+		req.Header.Set("X-API-KEY", apiKey)
+	}
+	if s.csrf != "" {
+		req.Header.Set("X-CSRF-Token", s.csrf)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+
+	if token := resp.Header.Get("X-CSRF-Token"); token != "" {
+		s.csrf = token
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 4<<20))
+	if err != nil {
+		return nil, resp.StatusCode, err
+	}
+	return body, resp.StatusCode, nil
+}
@@ -0,0 +1,246 @@
+//go:build !noplugins
+
+package services
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+func init() {
+	Register(&UnraidPlugin{})
+}
+
+// UnraidPlugin reports array state, parity check progress and disk health
+// from the state files emhttpd maintains under /var/local/emhttp.
+type UnraidPlugin struct{}
+
+func (p *UnraidPlugin) ID() string   { return "unraid" }
+func (p *UnraidPlugin) Name() string { return "Unraid" }
+func (p *UnraidPlugin) Icon() string { return "externaldrive.connected.to.line.below" }
+
+const unraidStateDir = "/var/local/emhttp"
+
+func (p *UnraidPlugin) Detect(ctx context.Context, env *DetectionEnv) *DetectedService {
+	data, err := os.ReadFile(HostPath("/etc/unraid-version"))
+	if err != nil {
+		return nil
+	}
+	if _, err := os.Stat(HostPath(unraidStateDir + "/var.ini")); err != nil {
+		log.Printf("services: unraid version file found but %s/var.ini missing", unraidStateDir)
+		return nil
+	}
+
+	// /etc/unraid-version contains: version="6.12.4"
+	version := ""
+	if kv := parseINIValues(string(data)); kv["version"] != "" {
+		version = kv["version"]
+	}
+
+	log.Printf("services: unraid %s detected", version)
+	return &DetectedService{
+		PluginID: p.ID(),
+		Name:     p.Name(),
+		Icon:     p.Icon(),
+		Version:  version,
+		Meta:     map[string]string{"stateDir": HostPath(unraidStateDir)},
+	}
+}
+
+func (p *UnraidPlugin) Collect(ctx context.Context, svc *DetectedService) (*ServiceStats, error) {
+	stateDir := svc.Meta["stateDir"]
+	varData, err := os.ReadFile(stateDir + "/var.ini")
+	if err != nil {
+		return nil, fmt.Errorf("could not read Unraid state: %w", err)
+	}
+	vars := parseINIValues(string(varData))
+
+	var disks []unraidDisk
+	if diskData, err := os.ReadFile(stateDir + "/disks.ini"); err == nil {
+		disks = parseUnraidDisks(string(diskData))
+	}
+
+	arrayState := vars["mdState"] // STARTED, STOPPED, ...
+	parity := unraidParityStatus(vars)
+
+	var diskErrors, diskProblems int
+	var hottest int64
+	diskList := make([]map[string]interface{}, 0, len(disks))
+	for _, d := range disks {
+		if d.status == "DISK_NP" || d.status == "DISK_NP_DSBL" {
+			continue // slot not populated
+		}
+		if d.status != "DISK_OK" {
+			diskProblems++
+		}
+		diskErrors += int(d.errors)
+		if d.temp > hottest {
+			hottest = d.temp
+		}
+		diskList = append(diskList, map[string]interface{}{
+			"name":   d.name,
+			"device": d.device,
+			"type":   d.diskType,
+			"status": d.status,
+			"temp":   d.temp,
+			"errors": d.errors,
+		})
+	}
+
+	stats := &ServiceStats{
+		PluginID: p.ID(),
+		Name:     p.Name(),
+		Icon:     p.Icon(),
+		Status:   StatusRunning,
+	}
+
+	parityValue := "Idle"
+	if parity.running {
+		parityValue = fmt.Sprintf("%.1f%%", parity.progress)
+	}
+
+	stats.Summary = []StatItem{
+		{Label: "Array", Value: capitalize(arrayState), Type: "status"},
+		{Label: "Parity Check", Value: parityValue, Type: "text"},
+		{Label: "Disk Problems", Value: FormatNumber(int64(diskProblems)), Type: "number"},
+		{Label: "Hottest Disk", Value: fmt.Sprintf("%d°C", hottest), Type: "text"},
+	}
+
+	stats.Stats = map[string]interface{}{
+		"arrayState":       arrayState,
+		"numDisks":         toInt64(vars["mdNumDisks"]),
+		"numDisabled":      toInt64(vars["mdNumDisabled"]),
+		"numInvalid":       toInt64(vars["mdNumInvalid"]),
+		"numMissing":       toInt64(vars["mdNumMissing"]),
+		"parityRunning":    parity.running,
+		"parityAction":     parity.action,
+		"parityProgress":   parity.progress,
+		"parityLastErrors": toInt64(vars["sbSyncErrs"]),
+		"parityLastRun":    toInt64(vars["sbSynced"]),
+		"diskErrors":       diskErrors,
+		"diskProblems":     diskProblems,
+		"disks":            diskList,
+	}
+
+	switch {
+	case arrayState != "STARTED":
+		stats.setStatus(StatusStopped, "array_stopped", "array is "+strings.ToLower(arrayState))
+	case diskProblems > 0 || toInt64(vars["mdNumDisabled"]) > 0 || toInt64(vars["mdNumInvalid"]) > 0:
+		stats.degrade("disks_failing", "array has disabled, invalid or failing disks")
+	}
+
+	return stats, nil
+}
+
+type unraidParity struct {
+	running  bool
+	action   string
+	progress float64
+}
+
+// unraidParityStatus derives parity check/rebuild progress from var.ini.
+// mdResync is non-zero while an operation runs; mdResyncPos/mdResyncSize
+// give the position in 1K blocks.
+func unraidParityStatus(vars map[string]string) unraidParity {
+	var ps unraidParity
+	if toInt64(vars["mdResync"]) == 0 {
+		return ps
+	}
+	ps.running = true
+	ps.action = vars["mdResyncAction"]
+	pos := toFloat64(vars["mdResyncPos"])
+	size := toFloat64(vars["mdResyncSize"])
+	if size > 0 {
+		ps.progress = math.Round(pos/size*1000) / 10
+	}
+	return ps
+}
+
+type unraidDisk struct {
+	name     string
+	device   string
+	diskType string
+	status   string
+	temp     int64
+	errors   int64
+}
+
+// parseUnraidDisks parses disks.ini, which has one ["section"] per slot:
+//
+//	["disk1"]
+//	name="disk1"
+//	device="sdb"
+//	status="DISK_OK"
+//	temp="34"
+//	numErrors="0"
+func parseUnraidDisks(content string) []unraidDisk {
+	var disks []unraidDisk
+	var section []string
+
+	flush := func() {
+		if len(section) == 0 {
+			return
+		}
+		kv := parseINIValues(strings.Join(section, "\n"))
+		section = nil
+		if kv["name"] == "" {
+			return
+		}
+		temp, _ := strconv.ParseInt(kv["temp"], 10, 64) // "*" when spun down
+		disks = append(disks, unraidDisk{
+			name:     kv["name"],
+			device:   kv["device"],
+			diskType: kv["type"],
+			status:   kv["status"],
+			temp:     temp,
+			errors:   toInt64(kv["numErrors"]),
+		})
+	}
+
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "[") {
+			flush()
+			continue
+		}
+		section = append(section, line)
+	}
+	flush()
+
+	sort.Slice(disks, func(i, j int) bool { return disks[i].name < disks[j].name })
+	return disks
+}
+
+// capitalize turns "STARTED" into "Started".
+func capitalize(s string) string {
+	if s == "" {
+		return s
+	}
+	lower := strings.ToLower(s)
+	return strings.ToUpper(lower[:1]) + lower[1:]
+}
+
+// parseINIValues parses key="value" lines into a map, ignoring sections.
+func parseINIValues(content string) map[string]string {
+	result := make(map[string]string)
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "[") || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		result[strings.TrimSpace(parts[0])] = strings.Trim(strings.TrimSpace(parts[1]), "\"")
+	}
+	return result
+}
@@ -0,0 +1,149 @@
+package services
+
+import (
+	"math"
+	"time"
+)
+
+// Uptime tracking. Every collection records whether each service was up;
+// running, degraded and auth-required count as up, since the service
+// still answers, while stopped, error and unreachable count as down. The
+// time between two collections belongs to the later one's state, so an
+// outage is counted from the last collection that still saw the service
+// up. Gaps longer than uptimeGap (the agent paused, the service not
+// detected) are left out of the percentages rather than guessed at.
+// History is kept in memory and starts over when the agent restarts.
+
+const (
+	uptimeWindow   = 7 * 24 * time.Hour
+	uptimeGap      = 3 * collectInterval
+	maxUptimeSpans = 5000 // per service; a flapping service loses its oldest spans
+)
+
+// ServiceUptime is a service's availability as seen by the agent.
+type ServiceUptime struct {
+	Percent24h        float64    `json:"percent24h"`
+	Percent7d         float64    `json:"percent7d"`
+	TrackedSince      time.Time  `json:"trackedSince"`                // oldest observation in the last 7 days
+	LastOutageAt      *time.Time `json:"lastOutageAt,omitempty"`      // start of the most recent outage
+	LastOutageEndedAt *time.Time `json:"lastOutageEndedAt,omitempty"` // nil while it is ongoing
+}
+
+// uptimeSpan is a stretch of consecutive collections in one state.
+type uptimeSpan struct {
+	start, end time.Time
+	up         bool
+}
+
+type uptimeTracker struct {
+	spans         []uptimeSpan // oldest first
+	outageAt      time.Time
+	outageEndedAt time.Time
+}
+
+// serviceUp reports whether a status counts as up.
+func serviceUp(status string) bool {
+	switch status {
+	case StatusRunning, StatusDegraded, StatusAuthRequired:
+		return true
+	}
+	return false
+}
+
+// trackUptime records each service's status at now and sets its Uptime.
+// Only the collection loop calls it.
+func (sd *ServiceDetector) trackUptime(now time.Time, stats []ServiceStats) {
+	for i := range stats {
+		t := sd.uptime[stats[i].PluginID]
+		if t == nil {
+			t = &uptimeTracker{}
+			sd.uptime[stats[i].PluginID] = t
+		}
+		t.record(now, serviceUp(stats[i].Status))
+		stats[i].Uptime = t.report(now)
+	}
+}
+
+func (t *uptimeTracker) record(now time.Time, up bool) {
+	n := len(t.spans)
+	switch {
+	case n > 0 && now.Sub(t.spans[n-1].end) <= uptimeGap && t.spans[n-1].up == up:
+		t.spans[n-1].end = now
+	case n > 0 && now.Sub(t.spans[n-1].end) <= uptimeGap:
+		t.spans = append(t.spans, uptimeSpan{start: t.spans[n-1].end, end: now, up: up})
+	default:
+		t.spans = append(t.spans, uptimeSpan{start: now, end: now, up: up})
+	}
+
+	// An outage starts when a service is first seen down after being up
+	// (or on its first collection) and ends when it is seen up again.
+	changedAt := t.spans[len(t.spans)-1].start
+	switch {
+	case !up && (n == 0 || t.spans[n-1].up):
+		t.outageAt, t.outageEndedAt = changedAt, time.Time{}
+	case up && n > 0 && !t.spans[n-1].up:
+		t.outageEndedAt = changedAt
+	}
+
+	// Drop spans that ended before the window.
+	cut := 0
+	for cut < len(t.spans)-1 && now.Sub(t.spans[cut].end) > uptimeWindow {
+		cut++
+	}
+	if over := len(t.spans) - cut - maxUptimeSpans; over > 0 {
+		cut += over
+	}
+	if cut > 0 {
+		t.spans = append(t.spans[:0], t.spans[cut:]...)
+	}
+}
+
+func (t *uptimeTracker) report(now time.Time) *ServiceUptime {
+	u := &ServiceUptime{
+		Percent24h: t.percent(now, 24*time.Hour),
+		Percent7d:  t.percent(now, uptimeWindow),
+	}
+	if since := now.Add(-uptimeWindow); t.spans[0].start.Before(since) {
+		u.TrackedSince = since
+	} else {
+		u.TrackedSince = t.spans[0].start
+	}
+	if !t.outageAt.IsZero() {
+		at := t.outageAt
+		u.LastOutageAt = &at
+		if !t.outageEndedAt.IsZero() {
+			ended := t.outageEndedAt
+			u.LastOutageEndedAt = &ended
+		}
+	}
+	return u
+}
+
+// percent is the up share of the observed time within window before now,
+// rounded to two decimals. With nothing observed yet it follows the
+// current state.
+func (t *uptimeTracker) percent(now time.Time, window time.Duration) float64 {
+	from := now.Add(-window)
+	var up, total time.Duration
+	for _, s := range t.spans {
+		start := s.start
+		if start.Before(from) {
+			start = from
+		}
+		if !s.end.After(start) {
+			continue
+		}
+		d := s.end.Sub(start)
+		total += d
+		if s.up {
+			up += d
+		}
+	}
+	if total == 0 {
+		if t.spans[len(t.spans)-1].up {
+			return 100
+		}
+		return 0
+	}
+	return math.Round(float64(up)/float64(total)*10000) / 100
+}
@@ -0,0 +1,282 @@
+//go:build !noplugins
+
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func init() {
+	Register(&Zigbee2MQTTPlugin{})
+}
+
+// Zigbee2MQTTPlugin reports bridge state, device count, permit-join and
+// devices with a low battery or weak link from the Zigbee2MQTT frontend's
+// WebSocket API. "token" is the frontend auth token when one is set;
+// "url" points at a frontend elsewhere (e.g. a Home Assistant add-on).
+// "lowBattery" (percent, default 20) and "poorLinkQuality" (0-255,
+// default 30) set the thresholds.
+type Zigbee2MQTTPlugin struct{}
+
+func (p *Zigbee2MQTTPlugin) ID() string   { return "zigbee2mqtt" }
+func (p *Zigbee2MQTTPlugin) Name() string { return "Zigbee2MQTT" }
+func (p *Zigbee2MQTTPlugin) Icon() string { return "antenna.radiowaves.left.and.right" }
+
+const (
+	z2mDefaultPort         = 8080
+	defaultLowBattery      = 20
+	defaultPoorLinkQuality = 30
+
+	// On connect the frontend replays bridge state and every device's last
+	// state; once the device list arrived, this much silence ends the replay.
+	wsReplayQuiet = 300 * time.Millisecond
+)
+
+func (p *Zigbee2MQTTPlugin) Detect(ctx context.Context, env *DetectionEnv) *DetectedService {
+	base := &DetectedService{
+		PluginID: p.ID(),
+		Name:     p.Name(),
+		Icon:     p.Icon(),
+		Meta:     make(map[string]string),
+	}
+
+	if url := strings.TrimRight(env.Config(p.ID(), "url"), "/"); url != "" {
+		base.BaseURL = url
+		log.Printf("services: zigbee2mqtt configured at %s", url)
+		return base
+	}
+
+	if c := env.FindDockerImage("zigbee2mqtt"); c != nil && c.State == "running" {
+		ports := append(c.HostPorts, z2mDefaultPort)
+		if url := env.ProbeHTTP(ports, "/"); url != "" {
+			base.BaseURL = url
+			log.Printf("services: zigbee2mqtt detected via docker (%s) at %s", c.Image, url)
+			return base
+		}
+	}
+
+	// Bare-metal installs run under node; the frontend is the only marker.
+	if env.HasProcess("node") {
+		for _, port := range append(env.FindProcessPorts("node"), z2mDefaultPort) {
+			if url := env.ProbeHTTP([]int{port}, "/"); url != "" && isZigbee2MQTT(ctx, url) {
+				base.BaseURL = url
+				log.Printf("services: zigbee2mqtt detected via process at %s", url)
+				return base
+			}
+		}
+	}
+	return nil
+}
+
+// isZigbee2MQTT checks that the page at baseURL is the Zigbee2MQTT frontend.
+func isZigbee2MQTT(ctx context.Context, baseURL string) bool {
+	body, err := HTTPGet(ctx, baseURL+"/")
+	return err == nil && strings.Contains(strings.ToLower(string(body)), "zigbee2mqtt")
+}
+
+// --- Collection ---
+
+// z2mDevice is an entry from the bridge/devices topic.
+type z2mDevice struct {
+	IEEEAddress        string `json:"ieee_address"`
+	FriendlyName       string `json:"friendly_name"`
+	Type               string `json:"type"` // "Coordinator", "Router", "EndDevice"
+	PowerSource        string `json:"power_source"`
+	InterviewCompleted bool   `json:"interview_completed"`
+	Supported          bool   `json:"supported"`
+	Disabled           bool   `json:"disabled"`
+}
+
+// z2mDeviceState holds the fields of a device's state message this plugin uses.
+type z2mDeviceState struct {
+	Battery     *float64 `json:"battery"`
+	LinkQuality *float64 `json:"linkquality"`
+}
+
+func (p *Zigbee2MQTTPlugin) Collect(ctx context.Context, svc *DetectedService) (*ServiceStats, error) {
+	stats := &ServiceStats{
+		PluginID: p.ID(),
+		Name:     p.Name(),
+		Icon:     p.Icon(),
+		Status:   StatusRunning,
+		Stats:    make(map[string]interface{}),
+	}
+
+	wsURL, err := z2mSocketURL(svc.BaseURL, svc.Meta["token"])
+	if err != nil {
+		return nil, err
+	}
+	ws, err := wsDial(ctx, wsURL, nil)
+	if err != nil {
+		if errors.Is(err, errWSUnauthorized) && svc.Meta["token"] == "" {
+			stats.setStatus(StatusAuthRequired, "credentials_missing", "set token to the frontend auth token")
+			stats.Summary = []StatItem{
+				{Label: "Status", Value: "Running", Type: "status"},
+			}
+			stats.Stats = map[string]interface{}{
+				"authRequired": true,
+			}
+			return stats, nil
+		}
+		return nil, fmt.Errorf("could not reach Zigbee2MQTT at %s: %w", svc.BaseURL, err)
+	}
+	defer ws.Close()
+
+	bridgeState := "unknown"
+	var info struct {
+		Version    string `json:"version"`
+		PermitJoin bool   `json:"permit_join"`
+	}
+	var devices []z2mDevice
+	states := make(map[string]z2mDeviceState)
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(5 * time.Second)
+	}
+	for {
+		readBy := deadline
+		if devices != nil {
+			readBy = time.Now().Add(wsReplayQuiet)
+		}
+		ws.SetDeadline(readBy)
+		data, err := ws.ReadMessage()
+		if err != nil {
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() && devices != nil {
+				break
+			}
+			return nil, fmt.Errorf("reading Zigbee2MQTT state: %w", err)
+		}
+
+		var msg struct {
+			Topic   string          `json:"topic"`
+			Payload json.RawMessage `json:"payload"`
+		}
+		if json.Unmarshal(data, &msg) != nil {
+			continue
+		}
+		switch msg.Topic {
+		case "bridge/state":
+			// {"state":"online"}, or a bare string before 1.30.
+			var st struct {
+				State string `json:"state"`
+			}
+			if json.Unmarshal(msg.Payload, &st) != nil {
+				json.Unmarshal(msg.Payload, &st.State)
+			}
+			bridgeState = st.State
+		case "bridge/info":
+			json.Unmarshal(msg.Payload, &info)
+		case "bridge/devices":
+			if json.Unmarshal(msg.Payload, &devices) == nil && devices == nil {
+				devices = []z2mDevice{}
+			}
+		default:
+			if !strings.HasPrefix(msg.Topic, "bridge/") {
+				var st z2mDeviceState
+				if json.Unmarshal(msg.Payload, &st) == nil {
+					states[msg.Topic] = st
+				}
+			}
+		}
+	}
+
+	lowBattery := thresholdSetting(svc.Meta["lowBattery"], defaultLowBattery)
+	poorLink := thresholdSetting(svc.Meta["poorLinkQuality"], defaultPoorLinkQuality)
+
+	var total, routers, endDevices, notInterviewed int
+	lowList := []map[string]interface{}{}
+	weakList := []map[string]interface{}{}
+	for _, d := range devices {
+		if d.Type == "Coordinator" || d.Disabled {
+			continue
+		}
+		total++
+		switch d.Type {
+		case "Router":
+			routers++
+		case "EndDevice":
+			endDevices++
+		}
+		if !d.InterviewCompleted {
+			notInterviewed++
+		}
+		st := states[d.FriendlyName]
+		if st.Battery != nil && *st.Battery <= lowBattery {
+			lowList = append(lowList, map[string]interface{}{"name": d.FriendlyName, "battery": *st.Battery})
+		}
+		if st.LinkQuality != nil && *st.LinkQuality <= poorLink {
+			weakList = append(weakList, map[string]interface{}{"name": d.FriendlyName, "linkQuality": *st.LinkQuality})
+		}
+	}
+	sort.Slice(lowList, func(i, j int) bool { return lowList[i]["battery"].(float64) < lowList[j]["battery"].(float64) })
+	sort.Slice(weakList, func(i, j int) bool {
+		return weakList[i]["linkQuality"].(float64) < weakList[j]["linkQuality"].(float64)
+	})
+
+	permitJoin := "Off"
+	if info.PermitJoin {
+		permitJoin = "On"
+	}
+	stats.Summary = []StatItem{
+		{Label: "Bridge", Value: capitalize(bridgeState), Type: "status"},
+		{Label: "Devices", Value: FormatNumber(int64(total)), Type: "number"},
+		{Label: "Permit Join", Value: permitJoin, Type: "status"},
+		{Label: "Attention", Value: FormatNumber(int64(len(lowList) + len(weakList))), Type: "number"},
+	}
+	stats.Stats = map[string]interface{}{
+		"bridgeState":      bridgeState,
+		"version":          info.Version,
+		"permitJoin":       info.PermitJoin,
+		"devices":          total,
+		"routers":          routers,
+		"endDevices":       endDevices,
+		"notInterviewed":   notInterviewed,
+		"lowBattery":       lowList,
+		"poorLinkQuality":  weakList,
+		"batteryThreshold": lowBattery,
+		"linkThreshold":    poorLink,
+	}
+
+	if bridgeState != "online" {
+		stats.degrade("bridge_offline", "bridge is "+bridgeState)
+	}
+	return stats, nil
+}
+
+// z2mSocketURL turns the frontend's base URL into its WebSocket API URL.
+func z2mSocketURL(baseURL, token string) (string, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme == "https" {
+		u.Scheme = "wss"
+	} else {
+		u.Scheme = "ws"
+	}
+	u.Path = strings.TrimRight(u.Path, "/") + "/api"
+	if token != "" {
+		u.RawQuery = url.Values{"token": {token}}.Encode()
+	}
+	return u.String(), nil
+}
+
+// thresholdSetting parses a numeric plugin setting, falling back to def.
+func thresholdSetting(value string, def float64) float64 {
+	if v, err := strconv.ParseFloat(value, 64); err == nil && v >= 0 {
+		return v
+	}
+	return def
+}
@@ -0,0 +1,269 @@
+//go:build !noplugins
+
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func init() {
+	Register(&ZWaveJSPlugin{})
+}
+
+// ZWaveJSPlugin reports driver state, node count, inclusion mode and
+// nodes with a low battery or that are dead, through the Z-Wave JS
+// server's WebSocket API (enabled under "WS Server" in Z-Wave JS UI).
+// "url" (ws://host:3000) points at a server elsewhere; "lowBattery"
+// (percent, default 20) sets the battery threshold.
+type ZWaveJSPlugin struct{}
+
+func (p *ZWaveJSPlugin) ID() string   { return "zwavejs" }
+func (p *ZWaveJSPlugin) Name() string { return "Z-Wave JS" }
+func (p *ZWaveJSPlugin) Icon() string { return "dot.radiowaves.left.and.right" }
+
+const zwaveDefaultPort = 3000
+
+// Z-Wave node status values.
+const (
+	zwaveNodeAsleep = 1
+	zwaveNodeDead   = 3
+)
+
+// zwaveInclusionStates names the controller's inclusionState values.
+var zwaveInclusionStates = map[int]string{
+	0: "idle",
+	1: "including",
+	2: "excluding",
+	3: "busy",
+	4: "smartStart",
+}
+
+func (p *ZWaveJSPlugin) Detect(ctx context.Context, env *DetectionEnv) *DetectedService {
+	base := &DetectedService{
+		PluginID: p.ID(),
+		Name:     p.Name(),
+		Icon:     p.Icon(),
+		Meta:     make(map[string]string),
+	}
+
+	if url := strings.TrimRight(env.Config(p.ID(), "url"), "/"); url != "" {
+		base.BaseURL = url
+		log.Printf("services: zwavejs configured at %s", url)
+		return base
+	}
+
+	var ports []int
+	for _, image := range []string{"zwave-js", "zwavejs"} {
+		if c := env.FindDockerImage(image); c != nil && c.State == "running" {
+			ports = append(ports, c.HostPorts...)
+		}
+	}
+	if len(ports) == 0 && !env.HasProcess("node") {
+		return nil
+	}
+	ports = append(ports, zwaveDefaultPort)
+
+	for _, port := range ports {
+		url := "ws://" + net.JoinHostPort("127.0.0.1", strconv.Itoa(port))
+		if version, err := zwaveHello(ctx, url); err == nil {
+			base.BaseURL = url
+			base.Version = version
+			log.Printf("services: zwavejs server %s detected at %s", version, url)
+			return base
+		}
+	}
+	return nil
+}
+
+// zwaveHello connects and reads the version message the server sends first.
+func zwaveHello(ctx context.Context, url string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	ws, err := wsDial(ctx, url, nil)
+	if err != nil {
+		return "", err
+	}
+	defer ws.Close()
+	deadline, _ := ctx.Deadline()
+	ws.SetDeadline(deadline)
+	return zwaveReadVersion(ws)
+}
+
+func zwaveReadVersion(ws *wsConn) (string, error) {
+	data, err := ws.ReadMessage()
+	if err != nil {
+		return "", err
+	}
+	var hello struct {
+		Type          string `json:"type"`
+		DriverVersion string `json:"driverVersion"`
+	}
+	if json.Unmarshal(data, &hello) != nil || hello.Type != "version" {
+		return "", fmt.Errorf("not a Z-Wave JS server")
+	}
+	return hello.DriverVersion, nil
+}
+
+// --- Collection ---
+
+// zwaveNode is a node from the start_listening state dump.
+type zwaveNode struct {
+	NodeID           int    `json:"nodeId"`
+	Name             string `json:"name"`
+	Location         string `json:"location"`
+	Status           int    `json:"status"`
+	Ready            bool   `json:"ready"`
+	IsControllerNode bool   `json:"isControllerNode"`
+	DeviceConfig     struct {
+		Label string `json:"label"`
+	} `json:"deviceConfig"`
+	Values []struct {
+		CommandClass int             `json:"commandClass"`
+		Property     json.RawMessage `json:"property"`
+		Value        json.RawMessage `json:"value"`
+	} `json:"values"`
+}
+
+// battery returns the Battery CC level, if the node reports one.
+func (n *zwaveNode) battery() (float64, bool) {
+	for _, v := range n.Values {
+		if v.CommandClass == 0x80 && string(v.Property) == `"level"` {
+			var level float64
+			if json.Unmarshal(v.Value, &level) == nil {
+				return level, true
+			}
+		}
+	}
+	return 0, false
+}
+
+func (n *zwaveNode) displayName() string {
+	switch {
+	case n.Name != "":
+		return n.Name
+	case n.DeviceConfig.Label != "":
+		return fmt.Sprintf("%s (node %d)", n.DeviceConfig.Label, n.NodeID)
+	}
+	return fmt.Sprintf("Node %d", n.NodeID)
+}
+
+func (p *ZWaveJSPlugin) Collect(ctx context.Context, svc *DetectedService) (*ServiceStats, error) {
+	ws, err := wsDial(ctx, svc.BaseURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("could not reach Z-Wave JS server at %s: %w", svc.BaseURL, err)
+	}
+	defer ws.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		ws.SetDeadline(deadline)
+	}
+
+	version, err := zwaveReadVersion(ws)
+	if err != nil {
+		return nil, err
+	}
+	if err := ws.WriteText([]byte(`{"messageId":"deskmon","command":"start_listening"}`)); err != nil {
+		return nil, err
+	}
+
+	var state struct {
+		Controller struct {
+			OwnNodeID      int  `json:"ownNodeId"`
+			InclusionState *int `json:"inclusionState"`
+		} `json:"controller"`
+		Nodes []zwaveNode `json:"nodes"`
+	}
+	for {
+		data, err := ws.ReadMessage()
+		if err != nil {
+			return nil, fmt.Errorf("reading Z-Wave JS state: %w", err)
+		}
+		var msg struct {
+			Type      string `json:"type"`
+			MessageID string `json:"messageId"`
+			Success   bool   `json:"success"`
+			ErrorCode string `json:"errorCode"`
+			Result    struct {
+				State json.RawMessage `json:"state"`
+			} `json:"result"`
+		}
+		if json.Unmarshal(data, &msg) != nil || msg.Type != "result" || msg.MessageID != "deskmon" {
+			continue // events that raced the reply
+		}
+		if !msg.Success {
+			return nil, fmt.Errorf("start_listening failed: %s", msg.ErrorCode)
+		}
+		if err := json.Unmarshal(msg.Result.State, &state); err != nil {
+			return nil, fmt.Errorf("invalid Z-Wave JS state: %w", err)
+		}
+		break
+	}
+
+	lowBattery := thresholdSetting(svc.Meta["lowBattery"], defaultLowBattery)
+
+	var total, dead, asleep, notReady int
+	lowList := []map[string]interface{}{}
+	deadList := []map[string]interface{}{}
+	for i := range state.Nodes {
+		n := &state.Nodes[i]
+		if n.IsControllerNode || n.NodeID == state.Controller.OwnNodeID {
+			continue
+		}
+		total++
+		switch n.Status {
+		case zwaveNodeDead:
+			dead++
+			deadList = append(deadList, map[string]interface{}{"nodeId": n.NodeID, "name": n.displayName(), "location": n.Location})
+		case zwaveNodeAsleep:
+			asleep++
+		}
+		if !n.Ready {
+			notReady++
+		}
+		if level, ok := n.battery(); ok && level <= lowBattery {
+			lowList = append(lowList, map[string]interface{}{"nodeId": n.NodeID, "name": n.displayName(), "battery": level})
+		}
+	}
+	sort.Slice(lowList, func(i, j int) bool { return lowList[i]["battery"].(float64) < lowList[j]["battery"].(float64) })
+
+	inclusion := "unknown"
+	if s := state.Controller.InclusionState; s != nil {
+		if name, ok := zwaveInclusionStates[*s]; ok {
+			inclusion = name
+		}
+	}
+
+	stats := &ServiceStats{
+		PluginID: p.ID(),
+		Name:     p.Name(),
+		Icon:     p.Icon(),
+		Status:   StatusRunning,
+		Summary: []StatItem{
+			{Label: "Nodes", Value: FormatNumber(int64(total)), Type: "number"},
+			{Label: "Dead", Value: FormatNumber(int64(dead)), Type: "number"},
+			{Label: "Inclusion", Value: capitalize(inclusion), Type: "status"},
+			{Label: "Low Battery", Value: FormatNumber(int64(len(lowList))), Type: "number"},
+		},
+		Stats: map[string]interface{}{
+			"driverVersion":    version,
+			"nodes":            total,
+			"deadNodes":        deadList,
+			"asleep":           asleep,
+			"notReady":         notReady,
+			"inclusionState":   inclusion,
+			"lowBattery":       lowList,
+			"batteryThreshold": lowBattery,
+		},
+	}
+	if dead > 0 {
+		stats.degrade("nodes_dead", fmt.Sprintf("%d nodes dead", dead))
+	}
+	return stats, nil
+}
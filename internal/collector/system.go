@@ -1,17 +1,14 @@
 package collector
 
 import (
-	"bufio"
 	"fmt"
+	"log"
 	"math"
-	"os"
-	"os/user"
-	"path/filepath"
+	"path"
+	"slices"
 	"sort"
-	"strconv"
 	"strings"
 	"sync"
-	"syscall"
 	"time"
 )
 
@@ -21,18 +18,128 @@ type SystemStats struct {
 	Disks   []DiskInfo    `json:"disks"`
 	Network NetworkReport `json:"network"`
 	Uptime  int64         `json:"uptimeSeconds"`
+
+	ProcessStates ProcessStateStats `json:"processStates"`
+	Limits        KernelLimits      `json:"limits"`
+	Kernel        *KernelHealth     `json:"kernel,omitempty"` // Linux only
+
+	// Run-queue averages; zero where the OS doesn't report them.
+	Load LoadAverage `json:"loadAverage"`
+
+	// Per-device throughput over the last second, Linux only.
+	DiskIO []DiskIOStats `json:"diskIO"`
+
+	// Software RAID (md) arrays, Linux only; omitted without any.
+	RAID []RAIDArray `json:"raid,omitempty"`
+}
+
+// KernelHealth holds low-level kernel counters for deeper diagnostics.
+type KernelHealth struct {
+	// EntropyAvailable is the random pool's entropy in bits. Kernels since
+	// 5.18 always report 256.
+	EntropyAvailable int `json:"entropyAvailable"`
+
+	HugePagesTotal    uint64 `json:"hugePagesTotal"`
+	HugePagesFree     uint64 `json:"hugePagesFree"`
+	HugePagesReserved uint64 `json:"hugePagesReserved"`
+	HugePageSizeBytes uint64 `json:"hugePageSizeBytes"`
+
+	// DirtyBytes is modified page cache not yet written back; a backlog
+	// that keeps growing means storage can't keep up with writes.
+	DirtyBytes     uint64 `json:"dirtyBytes"`
+	WritebackBytes uint64 `json:"writebackBytes"` // being written right now
+
+	// OOMKills counts OOM-killer invocations since boot (vmstat oom_kill,
+	// Linux 4.13+).
+	OOMKills uint64 `json:"oomKills"`
 }
 
+// KernelLimits is system-wide use of kernel tables that take services down
+// with confusing errors ("too many open files", fork failures) when full.
+// A zero maximum means the platform doesn't report that limit.
+type KernelLimits struct {
+	OpenFiles  uint64 `json:"openFiles"`
+	MaxFiles   uint64 `json:"maxFiles"`             // fs.file-max, kern.maxfiles
+	Threads    uint64 `json:"threads,omitempty"`    // Linux only
+	MaxThreads uint64 `json:"maxThreads,omitempty"` // lower of kernel.threads-max and kernel.pid_max
+}
+
+// FilesPercent is open files as a percentage of the limit, or 0 when the
+// limit is unknown.
+func (l KernelLimits) FilesPercent() float64 {
+	return limitPercent(l.OpenFiles, l.MaxFiles)
+}
+
+// ThreadsPercent is threads as a percentage of the limit, or 0 when the
+// limit is unknown.
+func (l KernelLimits) ThreadsPercent() float64 {
+	return limitPercent(l.Threads, l.MaxThreads)
+}
+
+func limitPercent(used, limit uint64) float64 {
+	if limit == 0 {
+		return 0
+	}
+	return math.Round(float64(used)/float64(limit)*100*100) / 100
+}
+
+// ProcessStateStats counts processes stuck in states that point at trouble:
+// zombies (exited but never reaped by their parent) and uninterruptible
+// sleep (D state), where a growing count is usually a dying disk or a hung
+// NFS mount.
+type ProcessStateStats struct {
+	Zombie          int            `json:"zombie"`
+	Uninterruptible int            `json:"uninterruptible"`
+	Offenders       []StuckProcess `json:"offenders"` // longest-stuck first, at most maxStuckProcesses
+}
+
+// StuckProcess is one zombie or uninterruptible process.
+type StuckProcess struct {
+	PID   int32     `json:"pid"`
+	PPID  int32     `json:"ppid"`
+	Name  string    `json:"name"`
+	State string    `json:"state"`           // zombie, uninterruptible
+	WChan string    `json:"wchan,omitempty"` // kernel function the process is blocked in
+	Since time.Time `json:"since"`           // first sample that saw it in this state
+}
+
+// Process states reported in StuckProcess.State.
+const (
+	StateZombie          = "zombie"
+	StateUninterruptible = "uninterruptible"
+)
+
+// maxStuckProcesses caps ProcessStateStats.Offenders.
+const maxStuckProcesses = 20
+
 type CPUStats struct {
 	UsagePercent         float64 `json:"usagePercent"`
 	CoreCount            int     `json:"coreCount"`
 	Temperature          float64 `json:"temperature"`
 	TemperatureAvailable bool    `json:"temperatureAvailable"`
+	Throttled            bool    `json:"throttled"`
+	ThrottleReason       string  `json:"throttleReason,omitempty"` // soft_temp_limit, frequency_capped, thermal_throttle, throttled
+	UnderVoltage         bool    `json:"underVoltage"`             // Raspberry Pi supply voltage is too low
+
+	// Usage of each logical CPU, indexed by CPU number; only with
+	// per_core_cpu or ?perCore=true.
+	PerCore []float64 `json:"perCore,omitempty"`
 }
 
 type MemoryStats struct {
 	UsedBytes  uint64 `json:"usedBytes"`
 	TotalBytes uint64 `json:"totalBytes"`
+
+	// Swap space; both 0 without swap.
+	SwapUsedBytes  uint64 `json:"swapUsedBytes"`
+	SwapTotalBytes uint64 `json:"swapTotalBytes"`
+}
+
+// LoadAverage is the 1, 5 and 15 minute load average.
+type LoadAverage struct {
+	Load1  float64 `json:"load1"`
+	Load5  float64 `json:"load5"`
+	Load15 float64 `json:"load15"`
 }
 
 type DiskInfo struct {
@@ -41,6 +148,16 @@ type DiskInfo struct {
 	FsType     string `json:"fsType"`
 	UsedBytes  uint64 `json:"usedBytes"`
 	TotalBytes uint64 `json:"totalBytes"`
+
+	// Containers whose bind mounts or volumes live on this disk.
+	Containers []DiskContainer `json:"containers,omitempty"`
+}
+
+// DiskContainer is a container storing data on a disk, with the host paths
+// it mounts from there.
+type DiskContainer struct {
+	Name  string   `json:"name"`
+	Paths []string `json:"paths"`
 }
 
 type InterfaceStats struct {
@@ -67,6 +184,17 @@ type ProcessInfo struct {
 	User          string  `json:"user,omitempty"`
 }
 
+// UserUsage is process CPU and memory summed per owning user. Memory is
+// the sum of resident sets, so pages shared between processes count more
+// than once.
+type UserUsage struct {
+	User          string  `json:"user"`
+	Processes     int     `json:"processes"`
+	CPUPercent    float64 `json:"cpuPercent"`
+	MemoryMB      float64 `json:"memoryMB"`
+	MemoryPercent float64 `json:"memoryPercent"`
+}
+
 type processCPUSample struct {
 	utime     uint64
 	stime     uint64
@@ -76,8 +204,12 @@ type processCPUSample struct {
 type cpuSample struct {
 	total uint64
 	idle  uint64
+	cores []cpuSample // per logical CPU, nil where unsupported
 }
 
+// maxPerCore caps the CPUs sampled individually.
+const maxPerCore = 1024
+
 type netSample struct {
 	physRx      uint64
 	physTx      uint64
@@ -94,6 +226,13 @@ type netSample struct {
 	timestamp   time.Time
 }
 
+// Each supported OS implements the platform layer in system_<os>.go:
+// countCPUCores, readTotalMemKB, readCPUSample, readNetSample,
+// readDiskIOSample, readMemory, readLoadAverage,
+// readDisks, readTemperature, readUptime, readKernelLimits,
+// readKernelHealth, agentPID and SystemCollector.sampleProcesses.
+// Everything else in this file is shared.
+
 // SystemEvent is the payload broadcast each time system stats are sampled.
 type SystemEvent struct {
 	System    SystemStats   `json:"system"`
@@ -114,7 +253,34 @@ type SystemCollector struct {
 	prevProcCPU  map[int32]processCPUSample
 	smoothedCPU  map[int32]float64 // EMA-smoothed CPU per process
 	topProcesses []ProcessInfo
+	userUsage    []UserUsage
 	totalMemKB   uint64
+	excludePID   int32    // the agent itself when exclude_self is set, else 0
+	excludeNames []string // process name globs left out of topProcesses
+
+	// Zombie and D-state tracking
+	stuckSince map[stuckKey]time.Time
+	procStates ProcessStateStats
+
+	throttle throttleState
+
+	// Per-core usage, see EnablePerCore
+	perCore        []float64
+	perCoreEnabled bool
+
+	// Disk I/O rates, see disk_io.go
+	prevDiskIO diskIOSample
+	diskIO     []DiskIOStats
+
+	docker *DockerCollector // maps container mounts to disks, may be nil
+
+	// Subsystems switched off in config
+	noProcesses   bool
+	noTemperature bool
+
+	// Freshness of the CPU/network/process samples
+	sampledAt time.Time
+	sampleErr string
 
 	// SSE broadcast
 	Broadcast *Broadcaster[SystemEvent]
@@ -125,13 +291,19 @@ func NewSystemCollector() *SystemCollector {
 		stopCh:      make(chan struct{}),
 		prevProcCPU: make(map[int32]processCPUSample),
 		smoothedCPU: make(map[int32]float64),
+		stuckSince:  make(map[stuckKey]time.Time),
+		procStates:  ProcessStateStats{Offenders: []StuckProcess{}},
+		userUsage:   []UserUsage{},
 		Broadcast:   NewBroadcaster[SystemEvent](),
+		throttle:    newThrottleState(),
+		diskIO:      []DiskIOStats{},
 	}
 	sc.coreCount = countCPUCores()
 	sc.totalMemKB = readTotalMemKB()
 	// Take initial samples so first delta is meaningful
 	sc.prevCPU = readCPUSample()
 	sc.prevNet = readNetSample()
+	sc.prevDiskIO = readDiskIOSample()
 	return sc
 }
 
@@ -155,15 +327,27 @@ func (sc *SystemCollector) Stop() {
 }
 
 func (sc *SystemCollector) sample() {
+	// Throttle checks may exec vcgencmd; run them before taking the lock.
+	// sample is the only writer of sc.throttle, so reading it here is safe.
+	throttle := sc.throttle
+	throttle.checkThrottle(time.Now())
+
 	// CPU delta
 	cur := readCPUSample()
 	sc.mu.Lock()
+	sc.throttle = throttle
+	sc.sampledAt = time.Now()
+	sc.sampleErr = ""
+	if cur.total == 0 {
+		sc.sampleErr = "could not read CPU counters"
+	}
 	totalDelta := cur.total - sc.prevCPU.total
 	idleDelta := cur.idle - sc.prevCPU.idle
 	if totalDelta > 0 {
 		sc.cpuUsage = float64(totalDelta-idleDelta) / float64(totalDelta) * 100
 		sc.cpuUsage = math.Round(sc.cpuUsage*100) / 100
 	}
+	sc.perCore = calcPerCore(sc.prevCPU.cores, cur.cores)
 	sc.prevCPU = cur
 
 	// Network delta
@@ -191,13 +375,23 @@ func (sc *SystemCollector) sample() {
 	}
 	sc.prevNet = netCur
 
+	// Disk I/O delta
+	diskCur := readDiskIOSample()
+	sc.diskIO = calcDiskIO(sc.prevDiskIO, diskCur)
+	sc.prevDiskIO = diskCur
+
 	// Process sampling
-	sc.sampleProcesses()
+	if !sc.noProcesses {
+		sc.sampleProcesses()
+	}
 
 	// Snapshot for broadcast while holding the lock
 	cpuUsage := sc.cpuUsage
 	phys := sc.netPhysical
 	virt := sc.netVirtual
+	procStates := sc.procStates
+	diskIO := sc.diskIO
+	perCore := sc.perCoreIfEnabled()
 	procs := make([]ProcessInfo, len(sc.topProcesses))
 	copy(procs, sc.topProcesses)
 
@@ -205,9 +399,13 @@ func (sc *SystemCollector) sample() {
 
 	// Broadcast full system snapshot (non-blocking)
 	mem := readMemory()
-	disks := readDisks()
-	temp, tempAvail := readTemperature()
+	disks := sc.attachContainers(readDisks())
+	temp, tempAvail := sc.cpuTemperature()
 	uptime := readUptime()
+	load := readLoadAverage()
+	limits := readKernelLimits()
+	kernel := readKernelHealth()
+	raid := readRAIDArrays()
 
 	netReport := NetworkReport{Physical: phys}
 	if virt.DownloadBytesPerSec > 0 || virt.UploadBytesPerSec > 0 ||
@@ -222,27 +420,52 @@ func (sc *SystemCollector) sample() {
 				CoreCount:            sc.coreCount,
 				Temperature:          temp,
 				TemperatureAvailable: tempAvail,
+				Throttled:            throttle.throttled,
+				ThrottleReason:       throttle.reason,
+				UnderVoltage:         throttle.underVoltage,
+				PerCore:              perCore,
 			},
-			Memory:  mem,
-			Disks:   disks,
-			Network: netReport,
-			Uptime:  uptime,
+			Memory:        mem,
+			Disks:         disks,
+			Network:       netReport,
+			Uptime:        uptime,
+			ProcessStates: procStates,
+			Limits:        limits,
+			Kernel:        kernel,
+			Load:          load,
+			DiskIO:        diskIO,
+			RAID:          raid,
 		},
 		Processes: procs,
 	})
 }
 
+// SampleInfo reports when CPU, network and process data were last sampled.
+func (sc *SystemCollector) SampleInfo() SampleInfo {
+	sc.mu.RLock()
+	defer sc.mu.RUnlock()
+	return NewSampleInfo(sc.sampledAt, time.Second, sc.sampleErr)
+}
+
 func (sc *SystemCollector) Collect() SystemStats {
 	sc.mu.RLock()
 	cpuUsage := sc.cpuUsage
 	phys := sc.netPhysical
 	virt := sc.netVirtual
+	throttle := sc.throttle
+	procStates := sc.procStates
+	diskIO := sc.diskIO
+	perCore := sc.perCoreIfEnabled()
 	sc.mu.RUnlock()
 
 	mem := readMemory()
-	disks := readDisks()
-	temp, tempAvail := readTemperature()
+	disks := sc.attachContainers(readDisks())
+	temp, tempAvail := sc.cpuTemperature()
 	uptime := readUptime()
+	load := readLoadAverage()
+	limits := readKernelLimits()
+	kernel := readKernelHealth()
+	raid := readRAIDArrays()
 
 	netReport := NetworkReport{Physical: phys}
 	if virt.DownloadBytesPerSec > 0 || virt.UploadBytesPerSec > 0 ||
@@ -256,291 +479,301 @@ func (sc *SystemCollector) Collect() SystemStats {
 			CoreCount:            sc.coreCount,
 			Temperature:          temp,
 			TemperatureAvailable: tempAvail,
+			Throttled:            throttle.throttled,
+			ThrottleReason:       throttle.reason,
+			UnderVoltage:         throttle.underVoltage,
+			PerCore:              perCore,
 		},
-		Memory:  mem,
-		Disks:   disks,
-		Network: netReport,
-		Uptime:  uptime,
+		Memory:        mem,
+		Disks:         disks,
+		Network:       netReport,
+		Uptime:        uptime,
+		ProcessStates: procStates,
+		Limits:        limits,
+		Kernel:        kernel,
+		Load:          load,
+		DiskIO:        diskIO,
+		RAID:          raid,
 	}
 }
 
-// CollectTopProcesses returns the pre-calculated top processes by CPU usage.
-func (sc *SystemCollector) CollectTopProcesses(limit int) []ProcessInfo {
-	sc.mu.RLock()
-	defer sc.mu.RUnlock()
-
-	if limit > len(sc.topProcesses) {
-		limit = len(sc.topProcesses)
-	}
-	result := make([]ProcessInfo, limit)
-	copy(result, sc.topProcesses[:limit])
-	return result
+type stuckKey struct {
+	pid   int32
+	state string
 }
 
-// sampleProcesses reads /proc/ to collect per-process CPU and memory stats.
+// recordStuckProcesses replaces the zombie/D-state report with stuck, the
+// processes currently in one of those states, keeping Since across samples.
 // Must be called with sc.mu held for writing.
-func (sc *SystemCollector) sampleProcesses() {
-	entries, err := os.ReadDir("/proc")
-	if err != nil {
-		return
-	}
-
-	now := time.Now()
-	clkTck := float64(100) // standard Linux USER_HZ
-	numCPU := sc.coreCount
-	if numCPU < 1 {
-		numCPU = 1
+func (sc *SystemCollector) recordStuckProcesses(stuck []StuckProcess, now time.Time) {
+	stats := ProcessStateStats{Offenders: []StuckProcess{}}
+	seen := make(map[stuckKey]time.Time, len(stuck))
+	for i := range stuck {
+		key := stuckKey{stuck[i].PID, stuck[i].State}
+		since, ok := sc.stuckSince[key]
+		if !ok {
+			since = now
+		}
+		seen[key] = since
+		stuck[i].Since = since
+
+		switch stuck[i].State {
+		case StateZombie:
+			stats.Zombie++
+		case StateUninterruptible:
+			stats.Uninterruptible++
+		}
 	}
+	sc.stuckSince = seen
 
-	totalMemKB := sc.totalMemKB
-	if totalMemKB == 0 {
-		totalMemKB = readTotalMemKB()
-		sc.totalMemKB = totalMemKB
+	sort.Slice(stuck, func(i, j int) bool {
+		if !stuck[i].Since.Equal(stuck[j].Since) {
+			return stuck[i].Since.Before(stuck[j].Since)
+		}
+		return stuck[i].PID < stuck[j].PID
+	})
+	if len(stuck) > maxStuckProcesses {
+		stuck = stuck[:maxStuckProcesses]
 	}
+	stats.Offenders = append(stats.Offenders, stuck...)
+	sc.procStates = stats
+}
 
-	currentPIDs := make(map[int32]struct{})
-	var processes []ProcessInfo
+// SetDocker lets disks report the containers whose bind mounts and volumes
+// live on them. Call before Start.
+func (sc *SystemCollector) SetDocker(dc *DockerCollector) {
+	sc.docker = dc
+}
 
-	for _, entry := range entries {
-		if !entry.IsDir() {
-			continue
+// attachContainers assigns each container mount source to the disk with
+// the longest mount point containing it.
+func (sc *SystemCollector) attachContainers(disks []DiskInfo) []DiskInfo {
+	if sc.docker == nil || len(disks) == 0 {
+		return disks
+	}
+	for name, sources := range sc.docker.MountSources() {
+		byDisk := make(map[int][]string)
+		for _, src := range sources {
+			if i := diskForPath(disks, src); i >= 0 {
+				byDisk[i] = append(byDisk[i], src)
+			}
 		}
-		pid64, err := strconv.ParseInt(entry.Name(), 10, 32)
-		if err != nil {
-			continue
+		for i, paths := range byDisk {
+			sort.Strings(paths)
+			disks[i].Containers = append(disks[i].Containers, DiskContainer{Name: name, Paths: paths})
 		}
-		pid := int32(pid64)
-		currentPIDs[pid] = struct{}{}
-
-		procDir := filepath.Join("/proc", entry.Name())
+	}
+	for i := range disks {
+		sort.Slice(disks[i].Containers, func(a, b int) bool {
+			return disks[i].Containers[a].Name < disks[i].Containers[b].Name
+		})
+	}
+	return disks
+}
 
-		// Read CPU times from /proc/<pid>/stat
-		name, utime, stime, ok := readProcStat(procDir)
-		if !ok {
+// diskForPath returns the index of the disk whose mount point is the
+// longest prefix of path, or -1.
+func diskForPath(disks []DiskInfo, p string) int {
+	best, bestLen := -1, -1
+	for i, d := range disks {
+		mp := d.MountPoint
+		if p != mp && mp != "/" && !strings.HasPrefix(p, mp+"/") {
 			continue
 		}
-
-		// Read RSS from /proc/<pid>/status
-		rssKB := readProcRSS(procDir)
-
-		// Calculate CPU percent as delta from previous sample
-		var rawCPU float64
-		if prev, exists := sc.prevProcCPU[pid]; exists {
-			elapsed := now.Sub(prev.timestamp).Seconds()
-			if elapsed > 0 {
-				totalTicks := float64((utime - prev.utime) + (stime - prev.stime))
-				rawCPU = (totalTicks / clkTck) / elapsed * 100.0 / float64(numCPU)
-				if rawCPU < 0 {
-					rawCPU = 0
-				}
-			}
+		if len(mp) > bestLen {
+			best, bestLen = i, len(mp)
 		}
+	}
+	return best
+}
 
-		// EMA smoothing (alpha=0.2) to prevent noisy per-second fluctuations.
-		// Lower alpha = heavier smoothing = more stable rankings.
-		const emaAlpha = 0.2
-		cpuPercent := rawCPU
-		if prev, exists := sc.smoothedCPU[pid]; exists {
-			cpuPercent = emaAlpha*rawCPU + (1-emaAlpha)*prev
-		}
-		sc.smoothedCPU[pid] = cpuPercent
-		cpuPercent = math.Round(cpuPercent*100) / 100
-
-		// Update previous sample
-		sc.prevProcCPU[pid] = processCPUSample{
-			utime:     utime,
-			stime:     stime,
-			timestamp: now,
-		}
+// DisableProcesses stops per-process sampling: top processes, per-user
+// usage and process states stay empty. Call before Start.
+func (sc *SystemCollector) DisableProcesses() {
+	sc.noProcesses = true
+}
 
-		memMB := float64(rssKB) / 1024.0
-		memMB = math.Round(memMB*100) / 100
+// DisableTemperature stops reading the CPU temperature, which then reports
+// as unavailable. Call before Start.
+func (sc *SystemCollector) DisableTemperature() {
+	sc.noTemperature = true
+}
 
-		var memPercent float64
-		if totalMemKB > 0 {
-			memPercent = float64(rssKB) / float64(totalMemKB) * 100.0
-			memPercent = math.Round(memPercent*100) / 100
-		}
+// EnablePerCore adds per-core usage to every SystemStats, streams
+// included. Call before Start.
+func (sc *SystemCollector) EnablePerCore() {
+	sc.perCoreEnabled = true
+}
 
-		processes = append(processes, ProcessInfo{
-			PID:           pid,
-			Name:          name,
-			CPUPercent:    cpuPercent,
-			MemoryMB:      memMB,
-			MemoryPercent: memPercent,
-		})
-	}
+// PerCoreUsage returns the latest usage of each logical CPU, whether or
+// not EnablePerCore was called.
+func (sc *SystemCollector) PerCoreUsage() []float64 {
+	sc.mu.RLock()
+	defer sc.mu.RUnlock()
+	return slices.Clone(sc.perCore)
+}
 
-	// Clean up stale entries for dead processes
-	for pid := range sc.prevProcCPU {
-		if _, alive := currentPIDs[pid]; !alive {
-			delete(sc.prevProcCPU, pid)
-			delete(sc.smoothedCPU, pid)
-		}
+// perCoreIfEnabled copies the per-core usage for a snapshot. Callers hold
+// sc.mu.
+func (sc *SystemCollector) perCoreIfEnabled() []float64 {
+	if !sc.perCoreEnabled {
+		return nil
 	}
+	return slices.Clone(sc.perCore)
+}
 
-	// Combined score: CPU usage + memory weight so heavy-RAM processes stay visible.
-	// 200 MB ≈ 20 score points, comparable to 20% CPU.
-	procScore := func(p ProcessInfo) float64 {
-		return p.CPUPercent + p.MemoryMB*0.1
+// calcPerCore turns two samples' per-CPU counters into usage percentages.
+// A CPU without counters in both (offline, or just hot-plugged) reads 0.
+func calcPerCore(prev, cur []cpuSample) []float64 {
+	if len(cur) == 0 {
+		return nil
 	}
-
-	// Sort by combined score descending; use PID as tiebreaker for stability.
-	// Threshold of 0.5 prevents tiny fluctuations from shuffling the list.
-	sort.Slice(processes, func(i, j int) bool {
-		si, sj := procScore(processes[i]), procScore(processes[j])
-		if math.Abs(si-sj) < 0.5 {
-			return processes[i].PID < processes[j].PID
+	out := make([]float64, len(cur))
+	for i, c := range cur {
+		if i >= len(prev) || c.total <= prev[i].total || c.idle < prev[i].idle {
+			continue
 		}
-		return si > sj
-	})
-
-	// Keep top 15 — frontend caps display at 10 but uses the extra
-	// headroom for its damped sort to prevent processes popping in/out.
-	const maxKeep = 15
-	if len(processes) > maxKeep {
-		processes = processes[:maxKeep]
+		totalDelta := c.total - prev[i].total
+		busy := totalDelta - min(c.idle-prev[i].idle, totalDelta)
+		out[i] = math.Round(float64(busy)/float64(totalDelta)*10000) / 100
 	}
-
-	// Enrich top processes with command line and user (only for top N to avoid excess I/O)
-	for i := range processes {
-		procDir := filepath.Join("/proc", strconv.Itoa(int(processes[i].PID)))
-		processes[i].Command = readProcCmdline(procDir)
-		processes[i].User = readProcUser(procDir)
-	}
-
-	sc.topProcesses = processes
+	return out
 }
 
-// readProcStat reads /proc/<pid>/stat and returns the process name and CPU times.
-// Returns (name, utime, stime, ok).
-func readProcStat(procDir string) (string, uint64, uint64, bool) {
-	data, err := os.ReadFile(filepath.Join(procDir, "stat"))
-	if err != nil {
-		return "", 0, 0, false
-	}
-
-	content := string(data)
-
-	// The process name is in parentheses and can contain spaces and special chars.
-	// Find the last ')' to handle names like "(my process)" correctly.
-	openParen := strings.IndexByte(content, '(')
-	closeParen := strings.LastIndexByte(content, ')')
-	if openParen < 0 || closeParen < 0 || closeParen <= openParen {
-		return "", 0, 0, false
+func (sc *SystemCollector) cpuTemperature() (float64, bool) {
+	if sc.noTemperature {
+		return 0, false
 	}
+	return readCPUTemperature()
+}
 
-	name := content[openParen+1 : closeParen]
-
-	// Fields after the closing paren: state, ppid, pgrp, session, tty_nr,
-	// tpgid, flags, minflt, cminflt, majflt, cmajflt, utime(14), stime(15)
-	// Index relative to after ')': field 0=state, ..., field 11=utime, field 12=stime
-	rest := strings.TrimSpace(content[closeParen+1:])
-	fields := strings.Fields(rest)
-	// utime is at index 11 (field 14 overall, minus 3 for pid/name/state offset)
-	// Actually: fields after ')' are indexed from 0.
-	// field 0 = state (field 3 overall)
-	// field 11 = utime (field 14 overall)
-	// field 12 = stime (field 15 overall)
-	if len(fields) < 13 {
-		return "", 0, 0, false
+// SetProcessFilter leaves the agent itself (excludeSelf) and processes whose
+// name matches one of patterns (path.Match globs, e.g. "kworker/*") out of
+// the top processes. Call before Start.
+func (sc *SystemCollector) SetProcessFilter(excludeSelf bool, patterns []string) {
+	var names []string
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			log.Printf("system: ignoring invalid process exclude pattern %q: %v", pattern, err)
+			continue
+		}
+		names = append(names, pattern)
 	}
 
-	utime, err := strconv.ParseUint(fields[11], 10, 64)
-	if err != nil {
-		return "", 0, 0, false
-	}
-	stime, err := strconv.ParseUint(fields[12], 10, 64)
-	if err != nil {
-		return "", 0, 0, false
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	sc.excludePID = 0
+	if excludeSelf {
+		sc.excludePID = agentPID()
 	}
-
-	return name, utime, stime, true
+	sc.excludeNames = names
 }
 
-// readProcRSS reads VmRSS from /proc/<pid>/status and returns the value in kB.
-func readProcRSS(procDir string) uint64 {
-	f, err := os.Open(filepath.Join(procDir, "status"))
-	if err != nil {
-		return 0
+// filterProcesses drops the processes excluded by SetProcessFilter.
+// Must be called with sc.mu held.
+func (sc *SystemCollector) filterProcesses(processes []ProcessInfo) []ProcessInfo {
+	if sc.excludePID == 0 && len(sc.excludeNames) == 0 {
+		return processes
 	}
-	defer f.Close()
-
-	scanner := bufio.NewScanner(f)
-	for scanner.Scan() {
-		line := scanner.Text()
-		if strings.HasPrefix(line, "VmRSS:") {
-			return parseMemInfoValue(line)
+	kept := processes[:0]
+	for _, p := range processes {
+		if p.PID == sc.excludePID || sc.excludedName(p.Name) {
+			continue
 		}
+		kept = append(kept, p)
 	}
-	return 0
+	return kept
 }
 
-// readTotalMemKB reads the total system memory in kB from /proc/meminfo.
-func readTotalMemKB() uint64 {
-	f, err := os.Open("/proc/meminfo")
-	if err != nil {
-		return 0
-	}
-	defer f.Close()
-
-	scanner := bufio.NewScanner(f)
-	for scanner.Scan() {
-		line := scanner.Text()
-		if strings.HasPrefix(line, "MemTotal:") {
-			return parseMemInfoValue(line)
+func (sc *SystemCollector) excludedName(name string) bool {
+	for _, pattern := range sc.excludeNames {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
 		}
 	}
-	return 0
+	return false
 }
 
-func countCPUCores() int {
-	f, err := os.Open("/proc/cpuinfo")
-	if err != nil {
-		return 1
+// CollectTopProcesses returns the pre-calculated top processes by CPU usage.
+func (sc *SystemCollector) CollectTopProcesses(limit int) []ProcessInfo {
+	sc.mu.RLock()
+	defer sc.mu.RUnlock()
+
+	if limit > len(sc.topProcesses) {
+		limit = len(sc.topProcesses)
 	}
-	defer f.Close()
+	result := make([]ProcessInfo, limit)
+	copy(result, sc.topProcesses[:limit])
+	return result
+}
 
-	count := 0
-	scanner := bufio.NewScanner(f)
-	for scanner.Scan() {
-		if strings.HasPrefix(scanner.Text(), "processor") {
-			count++
+// CollectUserUsage returns process usage summed per user, heaviest first.
+func (sc *SystemCollector) CollectUserUsage() []UserUsage {
+	sc.mu.RLock()
+	defer sc.mu.RUnlock()
+	return slices.Clone(sc.userUsage)
+}
+
+// aggregateUsers sums processes (every process, with User set) per user and
+// orders the result by the same CPU + memory score as rankProcesses.
+func aggregateUsers(processes []ProcessInfo) []UserUsage {
+	byUser := make(map[string]*UserUsage)
+	for _, p := range processes {
+		u := byUser[p.User]
+		if u == nil {
+			u = &UserUsage{User: p.User}
+			byUser[p.User] = u
 		}
-	}
-	if count == 0 {
-		return 1
-	}
-	return count
+		u.Processes++
+		u.CPUPercent += p.CPUPercent
+		u.MemoryMB += p.MemoryMB
+		u.MemoryPercent += p.MemoryPercent
+	}
+
+	users := make([]UserUsage, 0, len(byUser))
+	for _, u := range byUser {
+		u.CPUPercent = math.Round(u.CPUPercent*100) / 100
+		u.MemoryMB = math.Round(u.MemoryMB*100) / 100
+		u.MemoryPercent = math.Round(u.MemoryPercent*100) / 100
+		users = append(users, *u)
+	}
+	sort.Slice(users, func(i, j int) bool {
+		si := users[i].CPUPercent + users[i].MemoryMB*0.1
+		sj := users[j].CPUPercent + users[j].MemoryMB*0.1
+		if si != sj {
+			return si > sj
+		}
+		return users[i].User < users[j].User
+	})
+	return users
 }
 
-func readCPUSample() cpuSample {
-	f, err := os.Open("/proc/stat")
-	if err != nil {
-		return cpuSample{}
+// rankProcesses orders processes by a combined CPU + memory score and keeps
+// the top entries.
+func rankProcesses(processes []ProcessInfo) []ProcessInfo {
+	// Combined score: CPU usage + memory weight so heavy-RAM processes stay visible.
+	// 200 MB ≈ 20 score points, comparable to 20% CPU.
+	procScore := func(p ProcessInfo) float64 {
+		return p.CPUPercent + p.MemoryMB*0.1
 	}
-	defer f.Close()
 
-	scanner := bufio.NewScanner(f)
-	for scanner.Scan() {
-		line := scanner.Text()
-		if strings.HasPrefix(line, "cpu ") {
-			fields := strings.Fields(line)
-			if len(fields) < 5 {
-				return cpuSample{}
-			}
-			var total, idle uint64
-			for i := 1; i < len(fields); i++ {
-				val, _ := strconv.ParseUint(fields[i], 10, 64)
-				total += val
-				if i == 4 { // idle is the 4th value (index 4 in fields)
-					idle = val
-				}
-			}
-			return cpuSample{total: total, idle: idle}
+	// Sort by combined score descending; use PID as tiebreaker for stability.
+	// Threshold of 0.5 prevents tiny fluctuations from shuffling the list.
+	sort.Slice(processes, func(i, j int) bool {
+		si, sj := procScore(processes[i]), procScore(processes[j])
+		if math.Abs(si-sj) < 0.5 {
+			return processes[i].PID < processes[j].PID
 		}
+		return si > sj
+	})
+
+	// Keep top 15 — frontend caps display at 10 but uses the extra
+	// headroom for its damped sort to prevent processes popping in/out.
+	const maxKeep = 15
+	if len(processes) > maxKeep {
+		processes = processes[:maxKeep]
 	}
-	return cpuSample{}
+	return processes
 }
 
 // isVirtualInterface returns true for docker bridges, veth pairs, and similar virtual interfaces.
@@ -558,65 +791,6 @@ func isVirtualInterface(name string) bool {
 	return false
 }
 
-func readNetSample() netSample {
-	f, err := os.Open("/proc/net/dev")
-	if err != nil {
-		return netSample{timestamp: time.Now()}
-	}
-	defer f.Close()
-
-	var s netSample
-	s.timestamp = time.Now()
-
-	scanner := bufio.NewScanner(f)
-	for scanner.Scan() {
-		line := scanner.Text()
-		if strings.Contains(line, "|") || strings.TrimSpace(line) == "" {
-			continue
-		}
-		parts := strings.SplitN(line, ":", 2)
-		if len(parts) != 2 {
-			continue
-		}
-		iface := strings.TrimSpace(parts[0])
-		if iface == "lo" {
-			continue
-		}
-		fields := strings.Fields(parts[1])
-		if len(fields) < 12 {
-			continue
-		}
-
-		// /proc/net/dev columns:
-		// RX: bytes(0) packets(1) errs(2) drop(3) ...
-		// TX: bytes(8) packets(9) errs(10) drop(11) ...
-		rx, _ := strconv.ParseUint(fields[0], 10, 64)
-		rxErr, _ := strconv.ParseUint(fields[2], 10, 64)
-		rxDrop, _ := strconv.ParseUint(fields[3], 10, 64)
-		tx, _ := strconv.ParseUint(fields[8], 10, 64)
-		txErr, _ := strconv.ParseUint(fields[10], 10, 64)
-		txDrop, _ := strconv.ParseUint(fields[11], 10, 64)
-
-		if isVirtualInterface(iface) {
-			s.virtRx += rx
-			s.virtTx += tx
-			s.virtRxErr += rxErr
-			s.virtRxDrop += rxDrop
-			s.virtTxErr += txErr
-			s.virtTxDrop += txDrop
-		} else {
-			s.physRx += rx
-			s.physTx += tx
-			s.physRxErr += rxErr
-			s.physRxDrop += rxDrop
-			s.physTxErr += txErr
-			s.physTxDrop += txDrop
-		}
-	}
-
-	return s
-}
-
 func calcInterfaceStats(
 	prevRx, curRx, prevTx, curTx uint64,
 	prevRxErr, curRxErr, prevRxDrop, curRxDrop uint64,
@@ -635,44 +809,6 @@ func calcInterfaceStats(
 	}
 }
 
-func readMemory() MemoryStats {
-	f, err := os.Open("/proc/meminfo")
-	if err != nil {
-		return MemoryStats{}
-	}
-	defer f.Close()
-
-	var total, available uint64
-	scanner := bufio.NewScanner(f)
-	for scanner.Scan() {
-		line := scanner.Text()
-		if strings.HasPrefix(line, "MemTotal:") {
-			total = parseMemInfoValue(line)
-		} else if strings.HasPrefix(line, "MemAvailable:") {
-			available = parseMemInfoValue(line)
-		}
-	}
-
-	// /proc/meminfo reports in kB
-	totalBytes := total * 1024
-	availableBytes := available * 1024
-	usedBytes := totalBytes - availableBytes
-
-	return MemoryStats{
-		UsedBytes:  usedBytes,
-		TotalBytes: totalBytes,
-	}
-}
-
-func parseMemInfoValue(line string) uint64 {
-	fields := strings.Fields(line)
-	if len(fields) < 2 {
-		return 0
-	}
-	val, _ := strconv.ParseUint(fields[1], 10, 64)
-	return val
-}
-
 // pseudoFS is the set of filesystem types to skip when enumerating disks.
 var pseudoFS = map[string]bool{
 	"tmpfs": true, "devtmpfs": true, "sysfs": true, "proc": true,
@@ -682,176 +818,9 @@ var pseudoFS = map[string]bool{
 	"debugfs": true, "hugetlbfs": true, "mqueue": true, "configfs": true,
 	"fusectl": true, "autofs": true, "ramfs": true, "rpc_pipefs": true,
 	"nfsd": true, "fuse.gvfsd-fuse": true,
-}
-
-func readDisks() []DiskInfo {
-	// In Docker mode, /proc/mounts shows container mounts.
-	// Read /proc/1/mounts instead (PID 1 = host init, its mounts = host mounts).
-	hostRoot := os.Getenv("DESKMON_HOST_ROOT")
-	mountsPath := "/proc/mounts"
-	if hostRoot != "" {
-		mountsPath = "/proc/1/mounts"
-	}
-
-	f, err := os.Open(mountsPath)
-	if err != nil {
-		return nil
-	}
-	defer f.Close()
-
-	seenDevices := make(map[string]bool)
-	var disks []DiskInfo
-
-	scanner := bufio.NewScanner(f)
-	for scanner.Scan() {
-		fields := strings.Fields(scanner.Text())
-		if len(fields) < 3 {
-			continue
-		}
-		device := fields[0]
-		mountPoint := fields[1]
-		fsType := fields[2]
-
-		// Skip pseudo-filesystems
-		if pseudoFS[fsType] {
-			continue
-		}
-		// Skip non-device mounts (e.g., "none", "systemd-1")
-		if !strings.HasPrefix(device, "/") {
-			continue
-		}
-		// Deduplicate by device (keep first mount)
-		if seenDevices[device] {
-			continue
-		}
-		seenDevices[device] = true
-
-		// In Docker mode, prefix mount points with host root for statfs calls.
-		// Report the original mount point name in the API response.
-		statfsPath := mountPoint
-		if hostRoot != "" {
-			statfsPath = hostRoot + mountPoint
-		}
-
-		var stat syscall.Statfs_t
-		if err := syscall.Statfs(statfsPath, &stat); err != nil {
-			continue
-		}
-
-		totalBytes := stat.Blocks * uint64(stat.Bsize)
-		availBytes := stat.Bavail * uint64(stat.Bsize) // user-available (excludes reserved)
-		usedBytes := totalBytes - (stat.Bfree * uint64(stat.Bsize))
-
-		// Skip tiny/empty filesystems (< 50MB)
-		if totalBytes < 50*1024*1024 {
-			continue
-		}
-
-		_ = availBytes // Bavail used for correct "available" calculation
-		disks = append(disks, DiskInfo{
-			MountPoint: mountPoint,
-			Device:     device,
-			FsType:     fsType,
-			UsedBytes:  usedBytes,
-			TotalBytes: totalBytes,
-		})
-	}
-
-	// Sort by mount point for stable ordering
-	sort.Slice(disks, func(i, j int) bool {
-		return disks[i].MountPoint < disks[j].MountPoint
-	})
-
-	return disks
-}
-
-func readTemperature() (float64, bool) {
-	sysPath := os.Getenv("DESKMON_HOST_SYS")
-	if sysPath == "" {
-		sysPath = "/sys"
-	}
-	matches, err := filepath.Glob(filepath.Join(sysPath, "class/thermal/thermal_zone*/temp"))
-	if err != nil || len(matches) == 0 {
-		return 0, false
-	}
-
-	var maxTemp float64
-	found := false
-	for _, path := range matches {
-		data, err := os.ReadFile(path)
-		if err != nil {
-			continue
-		}
-		val, err := strconv.ParseFloat(strings.TrimSpace(string(data)), 64)
-		if err != nil {
-			continue
-		}
-		temp := val / 1000.0
-		if temp > 0 {
-			found = true
-			if temp > maxTemp {
-				maxTemp = temp
-			}
-		}
-	}
-
-	return math.Round(maxTemp*10) / 10, found
-}
-
-func readUptime() int64 {
-	data, err := os.ReadFile("/proc/uptime")
-	if err != nil {
-		return 0
-	}
-	fields := strings.Fields(string(data))
-	if len(fields) == 0 {
-		return 0
-	}
-	val, err := strconv.ParseFloat(fields[0], 64)
-	if err != nil {
-		return 0
-	}
-	return int64(val)
-}
-
-// readProcCmdline reads /proc/<pid>/cmdline and returns the full command line.
-func readProcCmdline(procDir string) string {
-	data, err := os.ReadFile(filepath.Join(procDir, "cmdline"))
-	if err != nil || len(data) == 0 {
-		return ""
-	}
-	// cmdline is null-byte separated
-	cmdline := strings.ReplaceAll(string(data), "\x00", " ")
-	cmdline = strings.TrimSpace(cmdline)
-	if len(cmdline) > 256 {
-		cmdline = cmdline[:256]
-	}
-	return cmdline
-}
-
-// readProcUser reads the effective UID from /proc/<pid>/status and resolves it to a username.
-func readProcUser(procDir string) string {
-	f, err := os.Open(filepath.Join(procDir, "status"))
-	if err != nil {
-		return ""
-	}
-	defer f.Close()
-
-	scanner := bufio.NewScanner(f)
-	for scanner.Scan() {
-		line := scanner.Text()
-		if strings.HasPrefix(line, "Uid:") {
-			fields := strings.Fields(line)
-			if len(fields) >= 2 {
-				u, err := user.LookupId(fields[1])
-				if err == nil {
-					return u.Username
-				}
-				return fields[1]
-			}
-		}
-	}
-	return ""
+	// FreeBSD
+	"devfs": true, "fdescfs": true, "nullfs": true, "procfs": true,
+	"linprocfs": true, "linsysfs": true,
 }
 
 // FormatBytes is a helper for logging/debugging, not used in API responses
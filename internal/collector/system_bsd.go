@@ -0,0 +1,244 @@
+//go:build freebsd || darwin
+
+package collector
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"math"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// Platform layer parts shared by FreeBSD and macOS: both have hw.ncpu,
+// kern.boottime, getfsstat(2) and a BSD ps(1).
+
+func countCPUCores() int {
+	n, err := unix.SysctlUint32("hw.ncpu")
+	if err != nil || n == 0 {
+		return 1
+	}
+	return int(n)
+}
+
+// readLoadAverage decodes vm.loadavg, a struct loadavg: three fixed-point
+// averages (uint32) and their scale (a long, 8-byte aligned).
+func readLoadAverage() LoadAverage {
+	raw, err := unix.SysctlRaw("vm.loadavg")
+	if err != nil || len(raw) < 24 {
+		return LoadAverage{}
+	}
+	scale := float64(binary.LittleEndian.Uint64(raw[16:24]))
+	if scale == 0 {
+		return LoadAverage{}
+	}
+	load := func(i int) float64 {
+		v := float64(binary.LittleEndian.Uint32(raw[i*4:])) / scale
+		return math.Round(v*100) / 100
+	}
+	return LoadAverage{Load1: load(0), Load5: load(1), Load15: load(2)}
+}
+
+func readUptime() int64 {
+	boot, err := unix.SysctlTimeval("kern.boottime")
+	if err != nil {
+		return 0
+	}
+	return int64(time.Since(time.Unix(boot.Unix())).Seconds())
+}
+
+// readKernelLimits reports open files; neither OS exposes a system-wide
+// thread count.
+func readKernelLimits() KernelLimits {
+	var l KernelLimits
+	if n, err := unix.SysctlUint32(openFilesSysctl); err == nil {
+		l.OpenFiles = uint64(n)
+	}
+	if n, err := unix.SysctlUint32("kern.maxfiles"); err == nil {
+		l.MaxFiles = uint64(n)
+	}
+	return l
+}
+
+func readKernelHealth() *KernelHealth {
+	return nil
+}
+
+func agentPID() int32 {
+	return int32(os.Getpid())
+}
+
+// isVirtualBSDInterface covers bridges, jail epairs, VPN tunnels, pf and
+// Apple's wireless-direct pseudo-interfaces on top of the Linux-style names.
+func isVirtualBSDInterface(name string) bool {
+	for _, prefix := range []string{
+		"bridge", "epair", "tap", "tun", "vnet", "pflog", "pfsync", "enc", "gif", "gre", "wg", "ovpn", // FreeBSD
+		"utun", "awdl", "llw", "stf", "anpi", "ap", // macOS
+	} {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return isVirtualInterface(name)
+}
+
+// readDiskIOSample reports no devices: per-device counters need devstat
+// on FreeBSD and IOKit on macOS.
+func readDiskIOSample() diskIOSample {
+	return diskIOSample{timestamp: time.Now()}
+}
+
+func readDisks() []DiskInfo {
+	n, err := unix.Getfsstat(nil, unix.MNT_NOWAIT)
+	if err != nil || n == 0 {
+		return nil
+	}
+	mounts := make([]unix.Statfs_t, n)
+	n, err = unix.Getfsstat(mounts, unix.MNT_NOWAIT)
+	if err != nil {
+		return nil
+	}
+
+	seenDevices := make(map[string]bool)
+	var disks []DiskInfo
+	for _, m := range mounts[:n] {
+		fsType := unix.ByteSliceToString(m.Fstypename[:])
+		device := unix.ByteSliceToString(m.Mntfromname[:])
+		mountPoint := unix.ByteSliceToString(m.Mntonname[:])
+
+		if pseudoFS[fsType] || seenDevices[device] {
+			continue
+		}
+		// ZFS datasets ("zroot/ROOT/default") are not device paths.
+		if fsType != "zfs" && !strings.HasPrefix(device, "/") {
+			continue
+		}
+		// macOS system volumes share the APFS container with the data volume.
+		if strings.HasPrefix(mountPoint, "/System/Volumes/") && mountPoint != "/System/Volumes/Data" {
+			continue
+		}
+		seenDevices[device] = true
+
+		bsize := uint64(m.Bsize)
+		totalBytes := m.Blocks * bsize
+		usedBytes := totalBytes - m.Bfree*bsize
+		if totalBytes < 50*1024*1024 {
+			continue
+		}
+		disks = append(disks, DiskInfo{
+			MountPoint: mountPoint,
+			Device:     device,
+			FsType:     fsType,
+			UsedBytes:  usedBytes,
+			TotalBytes: totalBytes,
+		})
+	}
+
+	sort.Slice(disks, func(i, j int) bool {
+		return disks[i].MountPoint < disks[j].MountPoint
+	})
+	return disks
+}
+
+func runPS(args ...string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	return exec.CommandContext(ctx, "ps", args...).Output()
+}
+
+// sampleProcesses lists processes with ps(1). Its %CPU is already a decaying
+// average, so no further smoothing is applied.
+// Must be called with sc.mu held for writing.
+func (sc *SystemCollector) sampleProcesses() {
+	// ucomm goes last: on macOS it can contain spaces.
+	out, err := runPS("-ax", "-o", "pid=,ppid=,pcpu=,rss=,user=,state=,wchan=,ucomm=")
+	if err != nil {
+		return
+	}
+
+	totalMemKB := sc.totalMemKB
+	if totalMemKB == 0 {
+		totalMemKB = readTotalMemKB()
+		sc.totalMemKB = totalMemKB
+	}
+	numCPU := max(sc.coreCount, 1)
+
+	var processes []ProcessInfo
+	var stuck []StuckProcess
+	for _, line := range bytes.Split(out, []byte("\n")) {
+		fields := strings.Fields(string(line))
+		if len(fields) < 8 {
+			continue
+		}
+		pid, err := strconv.ParseInt(fields[0], 10, 32)
+		if err != nil {
+			continue
+		}
+		ppid, _ := strconv.ParseInt(fields[1], 10, 32)
+		cpu, _ := strconv.ParseFloat(fields[2], 64)
+		rssKB, _ := strconv.ParseUint(fields[3], 10, 64)
+		name := strings.Join(fields[7:], " ")
+
+		// Z is a zombie; FreeBSD's D and macOS's U are uninterruptible waits.
+		switch fields[5][0] {
+		case 'Z':
+			stuck = append(stuck, StuckProcess{PID: int32(pid), PPID: int32(ppid), Name: name, State: StateZombie})
+		case 'D', 'U':
+			wchan := fields[6]
+			if wchan == "-" {
+				wchan = ""
+			}
+			stuck = append(stuck, StuckProcess{PID: int32(pid), PPID: int32(ppid), Name: name, State: StateUninterruptible, WChan: wchan})
+		}
+
+		var memPercent float64
+		if totalMemKB > 0 {
+			memPercent = math.Round(float64(rssKB)/float64(totalMemKB)*100*100) / 100
+		}
+		processes = append(processes, ProcessInfo{
+			PID:  int32(pid),
+			Name: name,
+			// ps reports percent of one core; match Linux's percent of all cores.
+			CPUPercent:    math.Round(cpu/float64(numCPU)*100) / 100,
+			MemoryMB:      math.Round(float64(rssKB)/1024*100) / 100,
+			MemoryPercent: memPercent,
+			User:          fields[4],
+		})
+	}
+	sc.userUsage = aggregateUsers(processes)
+	processes = rankProcesses(sc.filterProcesses(processes))
+	sc.recordStuckProcesses(stuck, time.Now())
+
+	// Command lines only for the processes that made the cut.
+	pids := make([]string, len(processes))
+	for i, p := range processes {
+		pids[i] = strconv.Itoa(int(p.PID))
+	}
+	if len(pids) > 0 {
+		if out, err := runPS("-o", "pid=,args=", "-p", strings.Join(pids, ",")); err == nil {
+			commands := make(map[int32]string)
+			for _, line := range bytes.Split(out, []byte("\n")) {
+				pidStr, args, ok := strings.Cut(strings.TrimSpace(string(line)), " ")
+				if pid, err := strconv.ParseInt(pidStr, 10, 32); ok && err == nil {
+					args = strings.TrimSpace(args)
+					if len(args) > 256 {
+						args = args[:256]
+					}
+					commands[int32(pid)] = args
+				}
+			}
+			for i := range processes {
+				processes[i].Command = commands[processes[i].PID]
+			}
+		}
+	}
+
+	sc.topProcesses = processes
+}
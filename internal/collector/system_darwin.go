@@ -0,0 +1,87 @@
+package collector
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// macOS implementation of the platform layer. CPU, memory and temperature
+// need cgo (host_statistics and the SMC via IOKit) and live in
+// system_darwin_cgo.go; the rest is shared with FreeBSD in system_bsd.go.
+
+// openFilesSysctl counts open files for readKernelLimits.
+const openFilesSysctl = "kern.num_files"
+
+// readSwap decodes vm.swapusage, a struct xsw_usage: total, available and
+// used bytes as uint64s.
+func readSwap() (used, total uint64) {
+	raw, err := unix.SysctlRaw("vm.swapusage")
+	if err != nil || len(raw) < 24 {
+		return 0, 0
+	}
+	return binary.LittleEndian.Uint64(raw[16:24]), binary.LittleEndian.Uint64(raw[0:8])
+}
+
+func readTotalMemKB() uint64 {
+	total, err := unix.SysctlUint64("hw.memsize")
+	if err != nil {
+		return 0
+	}
+	return total / 1024
+}
+
+// readNetSample parses `netstat -ibn`. Link rows ("<Link#N>") hold the
+// interface totals; their address column is empty for tunnels and loopback,
+// so the counters are taken from the end of the line:
+// Ipkts Ierrs Ibytes Opkts Oerrs Obytes Coll.
+func readNetSample() netSample {
+	s := netSample{timestamp: time.Now()}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, "netstat", "-ibn").Output()
+	if err != nil {
+		return s
+	}
+
+	seen := make(map[string]bool)
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 10 || !strings.HasPrefix(fields[2], "<Link#") {
+			continue
+		}
+		name := strings.TrimSuffix(fields[0], "*")
+		if strings.HasPrefix(name, "lo") || seen[name] {
+			continue
+		}
+		seen[name] = true
+
+		counters := fields[len(fields)-7:]
+		rxErr, _ := strconv.ParseUint(counters[1], 10, 64)
+		rx, _ := strconv.ParseUint(counters[2], 10, 64)
+		txErr, _ := strconv.ParseUint(counters[4], 10, 64)
+		tx, _ := strconv.ParseUint(counters[5], 10, 64)
+
+		if isVirtualBSDInterface(name) {
+			s.virtRx += rx
+			s.virtTx += tx
+			s.virtRxErr += rxErr
+			s.virtTxErr += txErr
+		} else {
+			s.physRx += rx
+			s.physTx += tx
+			s.physRxErr += rxErr
+			s.physTxErr += txErr
+		}
+	}
+	return s
+}
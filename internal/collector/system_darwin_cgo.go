@@ -0,0 +1,211 @@
+//go:build darwin && cgo
+
+package collector
+
+/*
+#cgo LDFLAGS: -framework IOKit
+#include <mach/mach.h>
+#include <mach/mach_host.h>
+#include <IOKit/IOKitLib.h>
+#include <string.h>
+
+static int cpu_ticks(unsigned long long *total, unsigned long long *idle) {
+	host_cpu_load_info_data_t info;
+	mach_msg_type_number_t count = HOST_CPU_LOAD_INFO_COUNT;
+	if (host_statistics(mach_host_self(), HOST_CPU_LOAD_INFO, (host_info_t)&info, &count) != KERN_SUCCESS) {
+		return -1;
+	}
+	*total = 0;
+	for (int i = 0; i < CPU_STATE_MAX; i++) {
+		*total += info.cpu_ticks[i];
+	}
+	*idle = info.cpu_ticks[CPU_STATE_IDLE];
+	return 0;
+}
+
+// core_ticks fills total and idle with up to max CPUs' tick counters and
+// returns how many it filled.
+static int core_ticks(int max, unsigned long long *total, unsigned long long *idle) {
+	natural_t ncpu;
+	processor_info_array_t info;
+	mach_msg_type_number_t count;
+	if (host_processor_info(mach_host_self(), PROCESSOR_CPU_LOAD_INFO, &ncpu, &info, &count) != KERN_SUCCESS) {
+		return -1;
+	}
+	processor_cpu_load_info_t load = (processor_cpu_load_info_t)info;
+	int n = (int)ncpu < max ? (int)ncpu : max;
+	for (int c = 0; c < n; c++) {
+		total[c] = 0;
+		for (int i = 0; i < CPU_STATE_MAX; i++) {
+			total[c] += load[c].cpu_ticks[i];
+		}
+		idle[c] = load[c].cpu_ticks[CPU_STATE_IDLE];
+	}
+	vm_deallocate(mach_task_self(), (vm_address_t)info, count * sizeof(integer_t));
+	return n;
+}
+
+// used_memory matches Activity Monitor's "Memory Used": app memory
+// (internal minus purgeable pages), wired and compressed.
+static int used_memory(unsigned long long *used) {
+	vm_statistics64_data_t vm;
+	mach_msg_type_number_t count = HOST_VM_INFO64_COUNT;
+	if (host_statistics64(mach_host_self(), HOST_VM_INFO64, (host_info64_t)&vm, &count) != KERN_SUCCESS) {
+		return -1;
+	}
+	vm_size_t page_size;
+	if (host_page_size(mach_host_self(), &page_size) != KERN_SUCCESS) {
+		return -1;
+	}
+	unsigned long long pages = (unsigned long long)vm.internal_page_count - vm.purgeable_count
+		+ vm.wire_count + vm.compressor_page_count;
+	*used = pages * page_size;
+	return 0;
+}
+
+// AppleSMC user client structures, as used by every SMC reader since
+// smcFanControl.
+typedef struct {
+	char major, minor, build, reserved;
+	UInt16 release;
+} smc_vers_t;
+
+typedef struct {
+	UInt16 version, length;
+	UInt32 cpuPLimit, gpuPLimit, memPLimit;
+} smc_plimit_t;
+
+typedef struct {
+	UInt32 dataSize;
+	UInt32 dataType;
+	char dataAttributes;
+} smc_keyinfo_t;
+
+typedef struct {
+	UInt32 key;
+	smc_vers_t vers;
+	smc_plimit_t pLimitData;
+	smc_keyinfo_t keyInfo;
+	char result, status, data8;
+	UInt32 data32;
+	unsigned char bytes[32];
+} smc_data_t;
+
+#define SMC_KERNEL_INDEX 2
+#define SMC_CMD_READ_BYTES 5
+#define SMC_CMD_READ_KEYINFO 9
+#define SMC_TYPE_SP78 ((UInt32)('s' << 24 | 'p' << 16 | '7' << 8 | '8'))
+#define SMC_TYPE_FLT ((UInt32)('f' << 24 | 'l' << 16 | 't' << 8 | ' '))
+
+static io_connect_t smc_conn;
+
+static int smc_call(smc_data_t *in, smc_data_t *out) {
+	size_t out_size = sizeof(smc_data_t);
+	memset(out, 0, sizeof(smc_data_t));
+	if (IOConnectCallStructMethod(smc_conn, SMC_KERNEL_INDEX, in, sizeof(smc_data_t), out, &out_size) != KERN_SUCCESS) {
+		return -1;
+	}
+	return out->result == 0 ? 0 : -1;
+}
+
+// smc_temperature reads a temperature key in °C, or returns -1 when the key
+// does not exist on this model.
+static double smc_temperature(UInt32 key) {
+	if (!smc_conn) {
+		io_service_t service = IOServiceGetMatchingService(MACH_PORT_NULL, IOServiceMatching("AppleSMC"));
+		if (!service) {
+			return -1;
+		}
+		kern_return_t ret = IOServiceOpen(service, mach_task_self(), 0, &smc_conn);
+		IOObjectRelease(service);
+		if (ret != KERN_SUCCESS) {
+			smc_conn = 0;
+			return -1;
+		}
+	}
+
+	smc_data_t in, out;
+	memset(&in, 0, sizeof(in));
+	in.key = key;
+	in.data8 = SMC_CMD_READ_KEYINFO;
+	if (smc_call(&in, &out) != 0) {
+		return -1;
+	}
+	UInt32 size = out.keyInfo.dataSize;
+	UInt32 type = out.keyInfo.dataType;
+
+	in.keyInfo.dataSize = size;
+	in.data8 = SMC_CMD_READ_BYTES;
+	if (smc_call(&in, &out) != 0) {
+		return -1;
+	}
+	if (type == SMC_TYPE_SP78 && size == 2) {
+		return (double)(SInt16)(out.bytes[0] << 8 | out.bytes[1]) / 256.0;
+	}
+	if (type == SMC_TYPE_FLT && size == 4) {
+		float f;
+		memcpy(&f, out.bytes, sizeof(f));
+		return f;
+	}
+	return -1;
+}
+*/
+import "C"
+
+import (
+	"math"
+	"sync"
+)
+
+func readCPUSample() cpuSample {
+	var total, idle C.ulonglong
+	if C.cpu_ticks(&total, &idle) != 0 {
+		return cpuSample{}
+	}
+	s := cpuSample{total: uint64(total), idle: uint64(idle)}
+	var totals, idles [maxPerCore]C.ulonglong
+	n := int(C.core_ticks(C.int(maxPerCore), &totals[0], &idles[0]))
+	for c := 0; c < n; c++ {
+		s.cores = append(s.cores, cpuSample{total: uint64(totals[c]), idle: uint64(idles[c])})
+	}
+	return s
+}
+
+func readMemory() MemoryStats {
+	total := readTotalMemKB() * 1024
+	m := MemoryStats{TotalBytes: total}
+	m.SwapUsedBytes, m.SwapTotalBytes = readSwap()
+	var used C.ulonglong
+	if C.used_memory(&used) == 0 {
+		m.UsedBytes = min(uint64(used), total)
+	}
+	return m
+}
+
+// smcTemperatureKeys are CPU die/proximity sensors: Intel Macs use TC0*,
+// Apple silicon Tp* (performance and efficiency clusters). Missing keys are
+// skipped.
+var smcTemperatureKeys = []string{
+	"TC0P", "TC0D", "TC0E", "TC0F", "TC0H",
+	"Tp01", "Tp05", "Tp09", "Tp0D", "Tp0T", "Tp0b", "Tp0f", "Tp0j",
+}
+
+// smcMu serializes use of the shared SMC connection.
+var smcMu sync.Mutex
+
+func readTemperature() (float64, bool) {
+	smcMu.Lock()
+	defer smcMu.Unlock()
+
+	var maxTemp float64
+	found := false
+	for _, key := range smcTemperatureKeys {
+		code := uint32(key[0])<<24 | uint32(key[1])<<16 | uint32(key[2])<<8 | uint32(key[3])
+		t := float64(C.smc_temperature(C.UInt32(code)))
+		if t > 0 && t < 150 {
+			found = true
+			maxTemp = math.Max(maxTemp, t)
+		}
+	}
+	return math.Round(maxTemp*10) / 10, found
+}
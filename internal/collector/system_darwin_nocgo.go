@@ -0,0 +1,17 @@
+//go:build darwin && !cgo
+
+package collector
+
+// Without cgo there is no access to host_statistics or the SMC: CPU usage
+// and temperature are unavailable and only total memory is reported. Build
+// on a Mac (cgo is on by default there) for full stats.
+
+func readCPUSample() cpuSample { return cpuSample{} }
+
+func readMemory() MemoryStats {
+	m := MemoryStats{TotalBytes: readTotalMemKB() * 1024}
+	m.SwapUsedBytes, m.SwapTotalBytes = readSwap()
+	return m
+}
+
+func readTemperature() (float64, bool) { return 0, false }
@@ -0,0 +1,215 @@
+package collector
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// FreeBSD implementation of the platform layer (also pfSense and OPNsense):
+// counters come from sysctl and interfaces from netstat. The rest is shared
+// with macOS in system_bsd.go.
+
+// openFilesSysctl counts open files for readKernelLimits.
+const openFilesSysctl = "kern.openfiles"
+
+func readTotalMemKB() uint64 {
+	total, err := unix.SysctlUint64("hw.physmem")
+	if err != nil {
+		return 0
+	}
+	return total / 1024
+}
+
+// readCPUSample reads kern.cp_time: user, nice, sys, intr and idle ticks as
+// C longs.
+func readCPUSample() cpuSample {
+	raw, err := unix.SysctlRaw("kern.cp_time")
+	if err != nil || len(raw) < 5*4 {
+		return cpuSample{}
+	}
+	size := len(raw) / 5
+	var s cpuSample
+	for i := 0; i < 5; i++ {
+		var v uint64
+		if size == 8 {
+			v = binary.LittleEndian.Uint64(raw[i*8:])
+		} else {
+			v = uint64(binary.LittleEndian.Uint32(raw[i*4:]))
+		}
+		s.total += v
+		if i == 4 {
+			s.idle = v
+		}
+	}
+	s.cores = readCoreSamples(size)
+	return s
+}
+
+// readCoreSamples reads kern.cp_times, the kern.cp_time counters of each
+// CPU in turn.
+func readCoreSamples(size int) []cpuSample {
+	raw, err := unix.SysctlRaw("kern.cp_times")
+	if err != nil || len(raw) < 5*size {
+		return nil
+	}
+	n := min(len(raw)/(5*size), maxPerCore)
+	cores := make([]cpuSample, n)
+	for c := range cores {
+		for i := 0; i < 5; i++ {
+			off := (c*5 + i) * size
+			var v uint64
+			if size == 8 {
+				v = binary.LittleEndian.Uint64(raw[off:])
+			} else {
+				v = uint64(binary.LittleEndian.Uint32(raw[off:]))
+			}
+			cores[c].total += v
+			if i == 4 {
+				cores[c].idle = v
+			}
+		}
+	}
+	return cores
+}
+
+// netstatInterface is one row of `netstat -ibn --libxo json`.
+type netstatInterface struct {
+	Name     string `json:"name"`
+	Network  string `json:"network"`
+	RxBytes  uint64 `json:"received-bytes"`
+	RxErrors uint64 `json:"received-errors"`
+	TxBytes  uint64 `json:"sent-bytes"`
+	TxErrors uint64 `json:"send-errors"`
+}
+
+func readNetSample() netSample {
+	s := netSample{timestamp: time.Now()}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, "netstat", "-ibn", "--libxo", "json").Output()
+	if err != nil {
+		return s
+	}
+	var parsed struct {
+		Statistics struct {
+			Interface []netstatInterface `json:"interface"`
+		} `json:"statistics"`
+	}
+	if err := json.Unmarshal(out, &parsed); err != nil {
+		return s
+	}
+
+	for _, iface := range parsed.Statistics.Interface {
+		// Address rows repeat the link counters; count each link once.
+		if !strings.HasPrefix(iface.Network, "<Link#") || strings.HasPrefix(iface.Name, "lo") {
+			continue
+		}
+		if isVirtualBSDInterface(iface.Name) {
+			s.virtRx += iface.RxBytes
+			s.virtTx += iface.TxBytes
+			s.virtRxErr += iface.RxErrors
+			s.virtTxErr += iface.TxErrors
+		} else {
+			s.physRx += iface.RxBytes
+			s.physTx += iface.TxBytes
+			s.physRxErr += iface.RxErrors
+			s.physTxErr += iface.TxErrors
+		}
+	}
+	return s
+}
+
+// readMemory counts free, inactive and (pre-FreeBSD 12) cache pages as
+// available, matching what top(1) shows as reclaimable.
+func readMemory() MemoryStats {
+	total, err := unix.SysctlUint64("hw.physmem")
+	if err != nil {
+		return MemoryStats{}
+	}
+	pageSize, err := unix.SysctlUint32("vm.stats.vm.v_page_size")
+	if err != nil {
+		return MemoryStats{TotalBytes: total}
+	}
+
+	var availablePages uint64
+	for _, name := range []string{"vm.stats.vm.v_free_count", "vm.stats.vm.v_inactive_count", "vm.stats.vm.v_cache_count"} {
+		if n, err := unix.SysctlUint32(name); err == nil {
+			availablePages += uint64(n)
+		}
+	}
+	available := availablePages * uint64(pageSize)
+	if available > total {
+		available = total
+	}
+	m := MemoryStats{UsedBytes: total - available, TotalBytes: total}
+	m.SwapUsedBytes, m.SwapTotalBytes = readSwap()
+	return m
+}
+
+// readSwap sums the devices `swapinfo -k` lists:
+//
+//	Device          1K-blocks     Used    Avail Capacity
+//	/dev/ada0p3       2097152    10240  2086912     0%
+//
+// With more than one device it adds a "Total" row, which is skipped.
+func readSwap() (used, total uint64) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, "swapinfo", "-k").Output()
+	if err != nil {
+		return 0, 0
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 3 || !strings.HasPrefix(fields[0], "/") {
+			continue
+		}
+		blocks, err1 := strconv.ParseUint(fields[1], 10, 64)
+		inUse, err2 := strconv.ParseUint(fields[2], 10, 64)
+		if err1 == nil && err2 == nil {
+			total += blocks * 1024
+			used += inUse * 1024
+		}
+	}
+	return used, total
+}
+
+// readTemperature reads per-core sensors from coretemp(4)/amdtemp(4), then
+// ACPI thermal zones. Both report tenths of a kelvin.
+func readTemperature() (float64, bool) {
+	var maxTemp float64
+	found := false
+	read := func(name string) bool {
+		v, err := unix.SysctlUint32(name)
+		if err != nil {
+			return false
+		}
+		if c := (float64(v) - 2731.5) / 10; c > 0 {
+			found = true
+			maxTemp = math.Max(maxTemp, c)
+		}
+		return true
+	}
+
+	for i := 0; i < countCPUCores(); i++ {
+		if !read(fmt.Sprintf("dev.cpu.%d.temperature", i)) {
+			break
+		}
+	}
+	for i := 0; ; i++ {
+		if !read(fmt.Sprintf("hw.acpi.thermal.tz%d.temperature", i)) {
+			break
+		}
+	}
+	return math.Round(maxTemp*10) / 10, found
+}
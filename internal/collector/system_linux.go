@@ -0,0 +1,800 @@
+package collector
+
+import (
+	"bufio"
+	"math"
+	"os"
+	"os/user"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/neur0map/deskmon-agent/internal/hostfs"
+)
+
+// Linux implementation of the platform layer: everything is read from /proc
+// and /sys, or the host's copies of them in Docker mode (see hostfs).
+
+// sampleProcesses reads /proc/ to collect per-process CPU and memory stats.
+// Must be called with sc.mu held for writing.
+func (sc *SystemCollector) sampleProcesses() {
+	entries, err := os.ReadDir(hostfs.Proc())
+	if err != nil {
+		return
+	}
+
+	now := time.Now()
+	clkTck := float64(100) // standard Linux USER_HZ
+	numCPU := sc.coreCount
+	if numCPU < 1 {
+		numCPU = 1
+	}
+
+	totalMemKB := sc.totalMemKB
+	if totalMemKB == 0 {
+		totalMemKB = readTotalMemKB()
+		sc.totalMemKB = totalMemKB
+	}
+
+	currentPIDs := make(map[int32]struct{})
+	var processes []ProcessInfo
+	var stuck []StuckProcess
+
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		pid64, err := strconv.ParseInt(entry.Name(), 10, 32)
+		if err != nil {
+			continue
+		}
+		pid := int32(pid64)
+		currentPIDs[pid] = struct{}{}
+
+		procDir := hostfs.Proc(entry.Name())
+
+		// Read CPU times from /proc/<pid>/stat
+		st, ok := readProcStat(procDir)
+		if !ok {
+			continue
+		}
+		name, utime, stime := st.name, st.utime, st.stime
+		switch st.state {
+		case 'Z':
+			stuck = append(stuck, StuckProcess{PID: pid, PPID: st.ppid, Name: name, State: StateZombie})
+		case 'D':
+			stuck = append(stuck, StuckProcess{PID: pid, PPID: st.ppid, Name: name, State: StateUninterruptible})
+		}
+
+		// Read RSS and owner from /proc/<pid>/status
+		rssKB, uid := readProcStatus(procDir)
+
+		// Calculate CPU percent as delta from previous sample
+		var rawCPU float64
+		if prev, exists := sc.prevProcCPU[pid]; exists {
+			elapsed := now.Sub(prev.timestamp).Seconds()
+			if elapsed > 0 {
+				totalTicks := float64((utime - prev.utime) + (stime - prev.stime))
+				rawCPU = (totalTicks / clkTck) / elapsed * 100.0 / float64(numCPU)
+				if rawCPU < 0 {
+					rawCPU = 0
+				}
+			}
+		}
+
+		// EMA smoothing (alpha=0.2) to prevent noisy per-second fluctuations.
+		// Lower alpha = heavier smoothing = more stable rankings.
+		const emaAlpha = 0.2
+		cpuPercent := rawCPU
+		if prev, exists := sc.smoothedCPU[pid]; exists {
+			cpuPercent = emaAlpha*rawCPU + (1-emaAlpha)*prev
+		}
+		sc.smoothedCPU[pid] = cpuPercent
+		cpuPercent = math.Round(cpuPercent*100) / 100
+
+		// Update previous sample
+		sc.prevProcCPU[pid] = processCPUSample{
+			utime:     utime,
+			stime:     stime,
+			timestamp: now,
+		}
+
+		memMB := float64(rssKB) / 1024.0
+		memMB = math.Round(memMB*100) / 100
+
+		var memPercent float64
+		if totalMemKB > 0 {
+			memPercent = float64(rssKB) / float64(totalMemKB) * 100.0
+			memPercent = math.Round(memPercent*100) / 100
+		}
+
+		processes = append(processes, ProcessInfo{
+			PID:           pid,
+			Name:          name,
+			CPUPercent:    cpuPercent,
+			MemoryMB:      memMB,
+			MemoryPercent: memPercent,
+			User:          uid,
+		})
+	}
+
+	// Resolve each distinct uid once, then sum per user.
+	usernames := make(map[string]string)
+	for i := range processes {
+		uid := processes[i].User
+		name, ok := usernames[uid]
+		if !ok {
+			name = lookupUsername(uid)
+			usernames[uid] = name
+		}
+		processes[i].User = name
+	}
+	sc.userUsage = aggregateUsers(processes)
+
+	// Clean up stale entries for dead processes
+	for pid := range sc.prevProcCPU {
+		if _, alive := currentPIDs[pid]; !alive {
+			delete(sc.prevProcCPU, pid)
+			delete(sc.smoothedCPU, pid)
+		}
+	}
+
+	processes = rankProcesses(sc.filterProcesses(processes))
+
+	sc.recordStuckProcesses(stuck, now)
+	for i, p := range sc.procStates.Offenders {
+		if p.State == StateUninterruptible {
+			sc.procStates.Offenders[i].WChan = readProcWChan(hostfs.Proc(strconv.Itoa(int(p.PID))))
+		}
+	}
+
+	// Enrich top processes with command line (only for top N to avoid excess I/O)
+	for i := range processes {
+		procDir := hostfs.Proc(strconv.Itoa(int(processes[i].PID)))
+		processes[i].Command = readProcCmdline(procDir)
+	}
+
+	sc.topProcesses = processes
+}
+
+// agentPID returns the agent's PID in the process list's numbering: in
+// Docker mode the host's /proc/self names the agent's host PID.
+func agentPID() int32 {
+	if link, err := os.Readlink(hostfs.Proc("self")); err == nil {
+		if pid, err := strconv.ParseInt(link, 10, 32); err == nil {
+			return int32(pid)
+		}
+	}
+	return int32(os.Getpid())
+}
+
+// procStat holds the fields of /proc/<pid>/stat the agent uses.
+type procStat struct {
+	name         string
+	state        byte // R, S, D, Z, T, ...
+	ppid         int32
+	utime, stime uint64
+}
+
+// readProcStat reads /proc/<pid>/stat and returns the process name, state,
+// parent and CPU times.
+func readProcStat(procDir string) (procStat, bool) {
+	data, err := os.ReadFile(filepath.Join(procDir, "stat"))
+	if err != nil {
+		return procStat{}, false
+	}
+
+	content := string(data)
+
+	// The process name is in parentheses and can contain spaces and special chars.
+	// Find the last ')' to handle names like "(my process)" correctly.
+	openParen := strings.IndexByte(content, '(')
+	closeParen := strings.LastIndexByte(content, ')')
+	if openParen < 0 || closeParen < 0 || closeParen <= openParen {
+		return procStat{}, false
+	}
+
+	name := content[openParen+1 : closeParen]
+
+	// Fields after the closing paren: state, ppid, pgrp, session, tty_nr,
+	// tpgid, flags, minflt, cminflt, majflt, cmajflt, utime(14), stime(15)
+	// Index relative to after ')': field 0=state, ..., field 11=utime, field 12=stime
+	rest := strings.TrimSpace(content[closeParen+1:])
+	fields := strings.Fields(rest)
+	// utime is at index 11 (field 14 overall, minus 3 for pid/name/state offset)
+	// Actually: fields after ')' are indexed from 0.
+	// field 0 = state (field 3 overall)
+	// field 11 = utime (field 14 overall)
+	// field 12 = stime (field 15 overall)
+	if len(fields) < 13 {
+		return procStat{}, false
+	}
+
+	ppid, _ := strconv.ParseInt(fields[1], 10, 32)
+	utime, err := strconv.ParseUint(fields[11], 10, 64)
+	if err != nil {
+		return procStat{}, false
+	}
+	stime, err := strconv.ParseUint(fields[12], 10, 64)
+	if err != nil {
+		return procStat{}, false
+	}
+
+	return procStat{name: name, state: fields[0][0], ppid: int32(ppid), utime: utime, stime: stime}, true
+}
+
+// readProcWChan returns the kernel function a sleeping process waits in, or
+// "" when the kernel hides it.
+func readProcWChan(procDir string) string {
+	data, err := os.ReadFile(filepath.Join(procDir, "wchan"))
+	if err != nil {
+		return ""
+	}
+	wchan := strings.TrimSpace(string(data))
+	if wchan == "0" {
+		return ""
+	}
+	return wchan
+}
+
+// readProcStatus reads VmRSS (in kB) and the real uid from
+// /proc/<pid>/status.
+func readProcStatus(procDir string) (rssKB uint64, uid string) {
+	f, err := os.Open(filepath.Join(procDir, "status"))
+	if err != nil {
+		return 0, ""
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "Uid:"):
+			if fields := strings.Fields(line); len(fields) >= 2 {
+				uid = fields[1]
+			}
+		case strings.HasPrefix(line, "VmRSS:"):
+			// Uid comes first, so the rest of the file can be skipped.
+			return parseMemInfoValue(line), uid
+		}
+	}
+	return 0, uid
+}
+
+// readTotalMemKB reads the total system memory in kB from /proc/meminfo.
+func readTotalMemKB() uint64 {
+	f, err := os.Open(hostfs.Proc("meminfo"))
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "MemTotal:") {
+			return parseMemInfoValue(line)
+		}
+	}
+	return 0
+}
+
+func countCPUCores() int {
+	f, err := os.Open(hostfs.Proc("cpuinfo"))
+	if err != nil {
+		return 1
+	}
+	defer f.Close()
+
+	count := 0
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if strings.HasPrefix(scanner.Text(), "processor") {
+			count++
+		}
+	}
+	if count == 0 {
+		return 1
+	}
+	return count
+}
+
+func readCPUSample() cpuSample {
+	f, err := os.Open(hostfs.Proc("stat"))
+	if err != nil {
+		return cpuSample{}
+	}
+	defer f.Close()
+
+	// The aggregate "cpu" line comes first, then one "cpuN" line per
+	// online CPU. Offline CPUs have no line and keep a zero sample.
+	var s cpuSample
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 5 || !strings.HasPrefix(fields[0], "cpu") {
+			if s.total > 0 {
+				break // past the cpu lines
+			}
+			continue
+		}
+		var c cpuSample
+		for i := 1; i < len(fields); i++ {
+			val, _ := strconv.ParseUint(fields[i], 10, 64)
+			c.total += val
+			if i == 4 { // idle is the 4th value (index 4 in fields)
+				c.idle = val
+			}
+		}
+		if fields[0] == "cpu" {
+			s.total, s.idle = c.total, c.idle
+			continue
+		}
+		n, err := strconv.Atoi(fields[0][3:])
+		if err != nil || n < 0 || n >= maxPerCore {
+			continue
+		}
+		for len(s.cores) <= n {
+			s.cores = append(s.cores, cpuSample{})
+		}
+		s.cores[n] = c
+	}
+	return s
+}
+
+func readNetSample() netSample {
+	f, err := os.Open(hostfs.Net("dev"))
+	if err != nil {
+		return netSample{timestamp: time.Now()}
+	}
+	defer f.Close()
+
+	var s netSample
+	s.timestamp = time.Now()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.Contains(line, "|") || strings.TrimSpace(line) == "" {
+			continue
+		}
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		iface := strings.TrimSpace(parts[0])
+		if iface == "lo" {
+			continue
+		}
+		fields := strings.Fields(parts[1])
+		if len(fields) < 12 {
+			continue
+		}
+
+		// /proc/net/dev columns:
+		// RX: bytes(0) packets(1) errs(2) drop(3) ...
+		// TX: bytes(8) packets(9) errs(10) drop(11) ...
+		rx, _ := strconv.ParseUint(fields[0], 10, 64)
+		rxErr, _ := strconv.ParseUint(fields[2], 10, 64)
+		rxDrop, _ := strconv.ParseUint(fields[3], 10, 64)
+		tx, _ := strconv.ParseUint(fields[8], 10, 64)
+		txErr, _ := strconv.ParseUint(fields[10], 10, 64)
+		txDrop, _ := strconv.ParseUint(fields[11], 10, 64)
+
+		if isVirtualInterface(iface) {
+			s.virtRx += rx
+			s.virtTx += tx
+			s.virtRxErr += rxErr
+			s.virtRxDrop += rxDrop
+			s.virtTxErr += txErr
+			s.virtTxDrop += txDrop
+		} else {
+			s.physRx += rx
+			s.physTx += tx
+			s.physRxErr += rxErr
+			s.physRxDrop += rxDrop
+			s.physTxErr += txErr
+			s.physTxDrop += txDrop
+		}
+	}
+
+	return s
+}
+
+// readDiskIOSample reads /proc/diskstats for the devices in /sys/block,
+// skipping loop and RAM disks and devices that never did any I/O (empty
+// optical drives and the like). Columns after the name:
+//
+//	reads merged sectorsRead msReading writes merged sectorsWritten msWriting inFlight msBusy ...
+//
+// Sectors are always 512 bytes here, whatever the device's block size.
+func readDiskIOSample() diskIOSample {
+	s := diskIOSample{devices: make(map[string]diskIOCounters), timestamp: time.Now()}
+	entries, err := os.ReadDir(hostfs.Sys("block"))
+	if err != nil {
+		return s
+	}
+	whole := make(map[string]bool, len(entries))
+	for _, e := range entries {
+		whole[e.Name()] = true
+	}
+
+	f, err := os.Open(hostfs.Proc("diskstats"))
+	if err != nil {
+		return s
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 13 {
+			continue
+		}
+		name := fields[2]
+		if !whole[name] || strings.HasPrefix(name, "loop") || strings.HasPrefix(name, "ram") {
+			continue
+		}
+		num := func(i int) uint64 {
+			v, _ := strconv.ParseUint(fields[i], 10, 64)
+			return v
+		}
+		c := diskIOCounters{
+			reads:      num(3),
+			readBytes:  num(5) * 512,
+			writes:     num(7),
+			writeBytes: num(9) * 512,
+			busyMillis: num(12),
+		}
+		if c.reads == 0 && c.writes == 0 {
+			continue
+		}
+		s.devices[name] = c
+	}
+	return s
+}
+
+func readMemory() MemoryStats {
+	f, err := os.Open(hostfs.Proc("meminfo"))
+	if err != nil {
+		return MemoryStats{}
+	}
+	defer f.Close()
+
+	var total, available, free, buffers, cached, swapTotal, swapFree uint64
+	hasAvailable := false
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "MemTotal:"):
+			total = parseMemInfoValue(line)
+		case strings.HasPrefix(line, "MemAvailable:"):
+			available = parseMemInfoValue(line)
+			hasAvailable = true
+		case strings.HasPrefix(line, "MemFree:"):
+			free = parseMemInfoValue(line)
+		case strings.HasPrefix(line, "Buffers:"):
+			buffers = parseMemInfoValue(line)
+		case strings.HasPrefix(line, "Cached:"):
+			cached = parseMemInfoValue(line)
+		case strings.HasPrefix(line, "SwapTotal:"):
+			swapTotal = parseMemInfoValue(line)
+		case strings.HasPrefix(line, "SwapFree:"):
+			swapFree = parseMemInfoValue(line)
+		}
+	}
+	// Old kernels and some lxcfs versions omit MemAvailable; without this
+	// all memory would show as used.
+	if !hasAvailable {
+		available = min(free+buffers+cached, total)
+	}
+
+	// /proc/meminfo reports in kB
+	totalBytes := total * 1024
+	availableBytes := available * 1024
+	usedBytes := totalBytes - availableBytes
+
+	return MemoryStats{
+		UsedBytes:      usedBytes,
+		TotalBytes:     totalBytes,
+		SwapUsedBytes:  (swapTotal - min(swapFree, swapTotal)) * 1024,
+		SwapTotalBytes: swapTotal * 1024,
+	}
+}
+
+func parseMemInfoValue(line string) uint64 {
+	fields := strings.Fields(line)
+	if len(fields) < 2 {
+		return 0
+	}
+	val, _ := strconv.ParseUint(fields[1], 10, 64)
+	return val
+}
+
+func readDisks() []DiskInfo {
+	// In Docker mode, /proc/mounts shows container mounts.
+	// Read /proc/1/mounts instead (PID 1 = host init, its mounts = host mounts).
+	mountsPath := "/proc/mounts"
+	if hostfs.Containerized() {
+		mountsPath = hostfs.Proc("1/mounts")
+	}
+
+	f, err := os.Open(mountsPath)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	seenDevices := make(map[string]bool)
+	var disks []DiskInfo
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 {
+			continue
+		}
+		device := fields[0]
+		mountPoint := fields[1]
+		fsType := fields[2]
+
+		// Skip pseudo-filesystems
+		if pseudoFS[fsType] {
+			continue
+		}
+		// Skip non-device mounts (e.g., "none", "systemd-1")
+		if !strings.HasPrefix(device, "/") {
+			continue
+		}
+		// Deduplicate by device (keep first mount)
+		if seenDevices[device] {
+			continue
+		}
+		seenDevices[device] = true
+
+		// In Docker mode, prefix mount points with host root for statfs calls.
+		// Report the original mount point name in the API response.
+		statfsPath := hostfs.Path(mountPoint)
+
+		var stat syscall.Statfs_t
+		if err := syscall.Statfs(statfsPath, &stat); err != nil {
+			continue
+		}
+
+		totalBytes := stat.Blocks * uint64(stat.Bsize)
+		availBytes := stat.Bavail * uint64(stat.Bsize) // user-available (excludes reserved)
+		usedBytes := totalBytes - (stat.Bfree * uint64(stat.Bsize))
+
+		// Skip tiny/empty filesystems (< 50MB)
+		if totalBytes < 50*1024*1024 {
+			continue
+		}
+
+		_ = availBytes // Bavail used for correct "available" calculation
+		disks = append(disks, DiskInfo{
+			MountPoint: mountPoint,
+			Device:     device,
+			FsType:     fsType,
+			UsedBytes:  usedBytes,
+			TotalBytes: totalBytes,
+		})
+	}
+
+	// Sort by mount point for stable ordering
+	sort.Slice(disks, func(i, j int) bool {
+		return disks[i].MountPoint < disks[j].MountPoint
+	})
+
+	return disks
+}
+
+func readTemperature() (float64, bool) {
+	matches, err := filepath.Glob(hostfs.Sys("class/thermal/thermal_zone*/temp"))
+	if err != nil || len(matches) == 0 {
+		// Many x86 desktops and servers have no ACPI thermal zones but
+		// expose the CPU sensor through hwmon.
+		matches = hwmonCPUSensors()
+	}
+	if len(matches) == 0 {
+		return 0, false
+	}
+
+	var maxTemp float64
+	found := false
+	for _, path := range matches {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		val, err := strconv.ParseFloat(strings.TrimSpace(string(data)), 64)
+		if err != nil {
+			continue
+		}
+		temp := val / 1000.0
+		if temp > 0 {
+			found = true
+			if temp > maxTemp {
+				maxTemp = temp
+			}
+		}
+	}
+
+	return math.Round(maxTemp*10) / 10, found
+}
+
+// cpuHwmonChips are hwmon drivers reporting CPU die temperature.
+var cpuHwmonChips = map[string]bool{
+	"coretemp":    true, // Intel
+	"k10temp":     true, // AMD
+	"zenpower":    true, // AMD, out-of-tree
+	"cpu_thermal": true, // ARM SoCs
+	"via_cputemp": true,
+}
+
+// hwmonCPUSensors returns the tempN_input files of CPU hwmon chips.
+func hwmonCPUSensors() []string {
+	var sensors []string
+	chips, _ := filepath.Glob(filepath.Join(hwmonRoot(), "hwmon*"))
+	for _, chip := range chips {
+		if !cpuHwmonChips[readSysString(filepath.Join(chip, "name"))] {
+			continue
+		}
+		inputs, _ := filepath.Glob(filepath.Join(chip, "temp*_input"))
+		sensors = append(sensors, inputs...)
+	}
+	return sensors
+}
+
+// readLoadAverage parses the first three fields of /proc/loadavg.
+func readLoadAverage() LoadAverage {
+	fields := strings.Fields(readSysString(hostfs.Proc("loadavg")))
+	if len(fields) < 3 {
+		return LoadAverage{}
+	}
+	var loads [3]float64
+	for i := range loads {
+		loads[i], _ = strconv.ParseFloat(fields[i], 64)
+	}
+	return LoadAverage{Load1: loads[0], Load5: loads[1], Load15: loads[2]}
+}
+
+func readUptime() int64 {
+	data, err := os.ReadFile(hostfs.Proc("uptime"))
+	if err != nil {
+		return 0
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return 0
+	}
+	val, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return 0
+	}
+	return int64(val)
+}
+
+// readKernelLimits reads open files from fs/file-nr and the thread count
+// from loadavg's "running/total" field.
+func readKernelLimits() KernelLimits {
+	var l KernelLimits
+	if fields := strings.Fields(readSysString(hostfs.Proc("sys/fs/file-nr"))); len(fields) == 3 {
+		allocated, _ := strconv.ParseUint(fields[0], 10, 64)
+		free, _ := strconv.ParseUint(fields[1], 10, 64)
+		if free <= allocated {
+			l.OpenFiles = allocated - free
+		}
+		l.MaxFiles, _ = strconv.ParseUint(fields[2], 10, 64)
+	}
+	if fields := strings.Fields(readSysString(hostfs.Proc("loadavg"))); len(fields) >= 4 {
+		if _, total, ok := strings.Cut(fields[3], "/"); ok {
+			l.Threads, _ = strconv.ParseUint(total, 10, 64)
+		}
+	}
+	threadsMax, _ := strconv.ParseUint(readSysString(hostfs.Proc("sys/kernel/threads-max")), 10, 64)
+	pidMax, _ := strconv.ParseUint(readSysString(hostfs.Proc("sys/kernel/pid_max")), 10, 64)
+	l.MaxThreads = threadsMax
+	if pidMax > 0 && (l.MaxThreads == 0 || pidMax < l.MaxThreads) {
+		l.MaxThreads = pidMax
+	}
+	return l
+}
+
+// readKernelHealth reads entropy, hugepage and writeback figures from
+// meminfo and the OOM-kill counter from vmstat.
+func readKernelHealth() *KernelHealth {
+	f, err := os.Open(hostfs.Proc("meminfo"))
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	k := &KernelHealth{}
+	k.EntropyAvailable, _ = strconv.Atoi(readSysString(hostfs.Proc("sys/kernel/random/entropy_avail")))
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "HugePages_Total:"):
+			k.HugePagesTotal = parseMemInfoValue(line)
+		case strings.HasPrefix(line, "HugePages_Free:"):
+			k.HugePagesFree = parseMemInfoValue(line)
+		case strings.HasPrefix(line, "HugePages_Rsvd:"):
+			k.HugePagesReserved = parseMemInfoValue(line)
+		case strings.HasPrefix(line, "Hugepagesize:"):
+			k.HugePageSizeBytes = parseMemInfoValue(line) * 1024
+		case strings.HasPrefix(line, "Dirty:"):
+			k.DirtyBytes = parseMemInfoValue(line) * 1024
+		case strings.HasPrefix(line, "Writeback:"):
+			k.WritebackBytes = parseMemInfoValue(line) * 1024
+		}
+	}
+
+	if data, err := os.ReadFile(hostfs.Proc("vmstat")); err == nil {
+		for _, line := range strings.Split(string(data), "\n") {
+			if value, ok := strings.CutPrefix(line, "oom_kill "); ok {
+				k.OOMKills, _ = strconv.ParseUint(value, 10, 64)
+				break
+			}
+		}
+	}
+	return k
+}
+
+// readProcCmdline reads /proc/<pid>/cmdline and returns the full command line.
+func readProcCmdline(procDir string) string {
+	data, err := os.ReadFile(filepath.Join(procDir, "cmdline"))
+	if err != nil || len(data) == 0 {
+		return ""
+	}
+	// cmdline is null-byte separated
+	cmdline := strings.ReplaceAll(string(data), "\x00", " ")
+	cmdline = strings.TrimSpace(cmdline)
+	if len(cmdline) > 256 {
+		cmdline = cmdline[:256]
+	}
+	return cmdline
+}
+
+// hostUsers caches the host's /etc/passwd in Docker mode, where the
+// container's own user database does not know the host's users.
+var hostUsers struct {
+	sync.Mutex
+	names    map[string]string // uid → name
+	loadedAt time.Time
+}
+
+// lookupUsername resolves uid to a user name, or returns uid unchanged.
+func lookupUsername(uid string) string {
+	if !hostfs.Containerized() {
+		if u, err := user.LookupId(uid); err == nil {
+			return u.Username
+		}
+		return uid
+	}
+
+	hostUsers.Lock()
+	defer hostUsers.Unlock()
+	if time.Since(hostUsers.loadedAt) > time.Minute {
+		hostUsers.names = make(map[string]string)
+		hostUsers.loadedAt = time.Now()
+		if data, err := os.ReadFile(hostfs.Etc("passwd")); err == nil {
+			for _, line := range strings.Split(string(data), "\n") {
+				// name:password:uid:gid:gecos:home:shell
+				fields := strings.SplitN(line, ":", 4)
+				if len(fields) >= 3 {
+					hostUsers.names[fields[2]] = fields[0]
+				}
+			}
+		}
+	}
+	if name, ok := hostUsers.names[uid]; ok {
+		return name
+	}
+	return uid
+}
@@ -0,0 +1,183 @@
+package collector
+
+import (
+	"errors"
+	"log"
+	"os"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/neur0map/deskmon-agent/internal/fakehost"
+)
+
+// host is the fake host every test in this package reads, see
+// internal/fakehost.
+var host *fakehost.Host
+
+func TestMain(m *testing.M) {
+	var err error
+	if host, err = fakehost.Install(); err != nil {
+		log.Fatal(err)
+	}
+	code := m.Run()
+	host.Close()
+	os.Exit(code)
+}
+
+func TestSystemCollectorReadsHost(t *testing.T) {
+	if err := host.AddProcess(fakehost.Process{PID: 1200, Name: "nginx", UID: 33, RSSKB: 100 * 1024, UTime: 500, STime: 100}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { host.RemoveProcess(1200) })
+
+	sc := NewSystemCollector()
+	// One second later: 3000 ticks busy and 1000 idle across the 4 CPUs.
+	if err := host.WriteFile("/proc/stat", "cpu  43000 0 20000 121000 2000 0 1000 0 0 0\n"+
+		"cpu0 10750 0 5000 30250 500 0 250 0 0 0\n"+
+		"cpu1 10750 0 5000 30250 500 0 250 0 0 0\n"+
+		"cpu2 10750 0 5000 30250 500 0 250 0 0 0\n"+
+		"cpu3 10750 0 5000 30250 500 0 250 0 0 0\n"+
+		"intr 1000000 0 0 0\n"); err != nil {
+		t.Fatal(err)
+	}
+	sc.sample()
+	stats := sc.Collect()
+
+	if stats.CPU.UsagePercent != 75 || stats.CPU.CoreCount != 4 {
+		t.Errorf("CPU = %.2f%% of %d cores, want 75%% of 4", stats.CPU.UsagePercent, stats.CPU.CoreCount)
+	}
+	if got := sc.PerCoreUsage(); !slices.Equal(got, []float64{75, 75, 75, 75}) {
+		t.Errorf("PerCoreUsage() = %v, want 75 each", got)
+	}
+	if !stats.CPU.TemperatureAvailable || stats.CPU.Temperature != 48 {
+		t.Errorf("temperature = %v (available %v), want 48", stats.CPU.Temperature, stats.CPU.TemperatureAvailable)
+	}
+	wantMem := MemoryStats{UsedBytes: 2000000 * 1024, TotalBytes: 8000000 * 1024, SwapUsedBytes: 500000 * 1024, SwapTotalBytes: 2000000 * 1024}
+	if stats.Memory != wantMem {
+		t.Errorf("Memory = %+v, want %+v", stats.Memory, wantMem)
+	}
+	if stats.Load != (LoadAverage{0.52, 0.58, 0.59}) || stats.Uptime != 86400 {
+		t.Errorf("load %+v, uptime %d; want 0.52/0.58/0.59 and 86400", stats.Load, stats.Uptime)
+	}
+	if stats.Limits.OpenFiles != 3200 || stats.Limits.Threads != 312 || stats.Limits.MaxThreads != 62000 {
+		t.Errorf("Limits = %+v, want 3200 open files, 312 of 62000 threads", stats.Limits)
+	}
+	if k := stats.Kernel; k == nil || k.EntropyAvailable != 256 || k.DirtyBytes != 1024*1024 || k.OOMKills != 2 {
+		t.Errorf("Kernel = %+v, want 256 bits of entropy, 1 MiB dirty, 2 OOM kills", k)
+	}
+	if i := slices.IndexFunc(stats.Disks, func(d DiskInfo) bool { return d.MountPoint == "/" }); i < 0 || stats.Disks[i].Device != "/dev/sda1" {
+		t.Errorf("Disks = %+v, want / on /dev/sda1 from PID 1's mounts", stats.Disks)
+	}
+
+	if len(stats.RAID) != 2 {
+		t.Fatalf("RAID = %+v, want md0 and md1", stats.RAID)
+	}
+	if md0 := stats.RAID[0]; md0.Name != "md0" || md0.State != RAIDClean || md0.Active != 2 {
+		t.Errorf("md0 = %+v, want clean with 2 active members", md0)
+	}
+	md1 := stats.RAID[1]
+	if md1.State != RAIDRebuilding || !md1.Degraded || md1.Sync == nil || md1.Sync.ProgressPercent != 8.5 {
+		t.Errorf("md1 = %+v, want rebuilding at 8.5%%", md1)
+	}
+	if !slices.Contains(md1.Members, RAIDMember{Device: "sde1", Role: "failed"}) {
+		t.Errorf("md1 members = %+v, want sde1 failed", md1.Members)
+	}
+
+	if ps := stats.ProcessStates; ps.Zombie != 1 || len(ps.Offenders) != 1 || ps.Offenders[0].PID != 980 || ps.Offenders[0].PPID != 412 {
+		t.Errorf("ProcessStates = %+v, want zombie 980 of sshd (412)", ps)
+	}
+	procs := sc.CollectTopProcesses(10)
+	i := slices.IndexFunc(procs, func(p ProcessInfo) bool { return p.PID == 1200 })
+	if i < 0 {
+		t.Fatalf("top processes %+v lack nginx", procs)
+	}
+	if p := procs[i]; p.Name != "nginx" || p.User != "www-data" || p.MemoryMB != 100 || p.Command != "nginx" {
+		t.Errorf("nginx = %+v, want www-data's, 100 MB", p)
+	}
+	users := sc.CollectUserUsage()
+	for _, name := range []string{"root", "www-data", "alice"} {
+		if !slices.ContainsFunc(users, func(u UserUsage) bool { return u.User == name }) {
+			t.Errorf("user usage %+v lacks %s, named from the host's /etc/passwd", users, name)
+		}
+	}
+}
+
+func TestThrottleReportsUnderVoltageSeparately(t *testing.T) {
+	const flagsPath = "/sys/devices/platform/soc/soc:firmware/get_throttled"
+	t.Cleanup(func() { os.Remove(host.Path(flagsPath)) })
+
+	tests := []struct {
+		flags        string
+		throttled    bool
+		reason       string
+		underVoltage bool
+	}{
+		{"0", false, "", false},
+		{"1", false, "", true},
+		{"5", true, "throttled", true},
+		{"8", true, "soft_temp_limit", false},
+		{"50002", true, "frequency_capped", false}, // past events only in the high bits
+	}
+	for _, tt := range tests {
+		if err := host.WriteFile(flagsPath, tt.flags+"\n"); err != nil {
+			t.Fatal(err)
+		}
+		var ts throttleState
+		ts.checkThrottle(time.Now())
+		if ts.throttled != tt.throttled || ts.reason != tt.reason || ts.underVoltage != tt.underVoltage {
+			t.Errorf("flags %s: throttled=%v reason=%q underVoltage=%v, want %v %q %v", tt.flags,
+				ts.throttled, ts.reason, ts.underVoltage, tt.throttled, tt.reason, tt.underVoltage)
+		}
+	}
+}
+
+func TestFanControlRestoresOriginalModes(t *testing.T) {
+	files := map[string]string{
+		"/sys/class/hwmon/hwmon0/name":        "nct6775\n",
+		"/sys/class/hwmon/hwmon0/pwm1":        "128\n",
+		"/sys/class/hwmon/hwmon0/pwm1_enable": "2\n", // auto
+		"/sys/class/hwmon/hwmon0/pwm2":        "200\n",
+		"/sys/class/hwmon/hwmon0/pwm2_enable": "1\n", // manual
+	}
+	for path, data := range files {
+		if err := host.WriteFile(path, data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Cleanup(func() { os.RemoveAll(host.Path("/sys/class/hwmon")) })
+
+	if _, err := SetFanPWM("hwmon0-pwm1", 256); err == nil {
+		t.Error("pwm 256 was accepted")
+	}
+	if _, err := SetFanPWM("hwmon0-pwm9", 100); !errors.Is(err, ErrFanNotFound) {
+		t.Errorf("unknown fan: err = %v, want ErrFanNotFound", err)
+	}
+	fan, err := SetFanPWM("hwmon0-pwm1", 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fan.Mode != FanModeManual || fan.PWM != 100 {
+		t.Errorf("after SetFanPWM fan = %+v, want manual at 100", fan)
+	}
+	for _, id := range []string{"hwmon0-pwm2", "hwmon0-pwm2"} {
+		if _, err := SetFanMode(id, FanModeFull); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := RestoreFans(); err != nil {
+		t.Fatal(err)
+	}
+	fans := ListFans()
+	if len(fans) != 2 {
+		t.Fatalf("%d fans, want 2", len(fans))
+	}
+	if fans[0].Mode != FanModeAuto {
+		t.Errorf("pwm1 mode = %s after restore, want auto", fans[0].Mode)
+	}
+	// Set twice: the first setting is the one restored.
+	if fans[1].Mode != FanModeManual || fans[1].PWM != 200 {
+		t.Errorf("pwm2 = %s at %d after restore, want manual at 200", fans[1].Mode, fans[1].PWM)
+	}
+}
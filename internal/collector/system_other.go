@@ -0,0 +1,27 @@
+//go:build !linux && !freebsd && !darwin
+
+package collector
+
+import (
+	"os"
+	"time"
+)
+
+// Fallback platform layer for operating systems without an implementation:
+// the agent runs and serves Docker and service data, but system stats stay
+// empty.
+
+func countCPUCores() int                     { return 1 }
+func readTotalMemKB() uint64                 { return 0 }
+func readCPUSample() cpuSample               { return cpuSample{} }
+func readNetSample() netSample               { return netSample{timestamp: time.Now()} }
+func readDiskIOSample() diskIOSample         { return diskIOSample{timestamp: time.Now()} }
+func readMemory() MemoryStats                { return MemoryStats{} }
+func readDisks() []DiskInfo                  { return nil }
+func readTemperature() (float64, bool)       { return 0, false }
+func readUptime() int64                      { return 0 }
+func readLoadAverage() LoadAverage           { return LoadAverage{} }
+func readKernelLimits() KernelLimits         { return KernelLimits{} }
+func readKernelHealth() *KernelHealth        { return nil }
+func agentPID() int32                        { return int32(os.Getpid()) }
+func (sc *SystemCollector) sampleProcesses() {}
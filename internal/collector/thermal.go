@@ -0,0 +1,141 @@
+package collector
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/neur0map/deskmon-agent/internal/hostfs"
+)
+
+// throttleCheckInterval spaces out throttle checks; they may exec vcgencmd
+// and sustained throttling is measured in tens of seconds anyway.
+const throttleCheckInterval = 5 * time.Second
+
+// Raspberry Pi get_throttled bits (current state).
+const (
+	rpiUnderVoltage  = 1 << 0
+	rpiFreqCapped    = 1 << 1
+	rpiThrottled     = 1 << 2
+	rpiSoftTempLimit = 1 << 3
+)
+
+// throttleState tracks what is needed between checks.
+type throttleState struct {
+	checkedAt    time.Time
+	prevCount    uint64 // Intel thermal_throttle event counters, summed
+	throttled    bool
+	reason       string
+	underVoltage bool // Raspberry Pi supply below 4.63V; a power fault, not throttling
+	hasVcgencmd  bool
+}
+
+func newThrottleState() throttleState {
+	_, err := exec.LookPath("vcgencmd")
+	return throttleState{hasVcgencmd: err == nil, prevCount: readThrottleCount()}
+}
+
+// checkThrottle refreshes ts when the interval has passed. Sources, first
+// match wins: Raspberry Pi firmware flags, new Intel thermal_throttle
+// events since the last check, or a CPU cooling device actively capping
+// frequency. It may exec vcgencmd, so callers must not hold a lock that
+// readers wait on.
+func (ts *throttleState) checkThrottle(now time.Time) {
+	if now.Sub(ts.checkedAt) < throttleCheckInterval {
+		return
+	}
+	ts.checkedAt = now
+
+	count := readThrottleCount()
+	newEvents := count > ts.prevCount
+	ts.prevCount = count
+
+	flags, ok := readRPiThrottled(ts.hasVcgencmd)
+	ts.underVoltage = ok && flags&rpiUnderVoltage != 0
+	if ok && flags&(rpiFreqCapped|rpiThrottled|rpiSoftTempLimit) != 0 {
+		ts.throttled = true
+		switch {
+		case flags&rpiSoftTempLimit != 0:
+			ts.reason = "soft_temp_limit"
+		case flags&rpiFreqCapped != 0:
+			ts.reason = "frequency_capped"
+		default:
+			ts.reason = "throttled"
+		}
+		return
+	}
+	if newEvents {
+		ts.throttled, ts.reason = true, "thermal_throttle"
+		return
+	}
+	if cpuCoolingActive() {
+		ts.throttled, ts.reason = true, "frequency_capped"
+		return
+	}
+	ts.throttled, ts.reason = false, ""
+}
+
+// readThrottleCount sums the Intel per-CPU throttle event counters.
+func readThrottleCount() uint64 {
+	matches, _ := filepath.Glob(hostfs.Sys("devices/system/cpu/cpu*/thermal_throttle/*_throttle_count"))
+	var total uint64
+	for _, path := range matches {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		n, _ := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+		total += n
+	}
+	return total
+}
+
+// readRPiThrottled reads the firmware throttle flags from sysfs (newer
+// kernels) or `vcgencmd get_throttled`.
+func readRPiThrottled(hasVcgencmd bool) (uint64, bool) {
+	if data, err := os.ReadFile(hostfs.Sys("devices/platform/soc/soc:firmware/get_throttled")); err == nil {
+		v, err := strconv.ParseUint(strings.TrimSpace(string(data)), 16, 64)
+		return v, err == nil
+	}
+	if !hasVcgencmd {
+		return 0, false
+	}
+	out, err := exec.Command("vcgencmd", "get_throttled").Output()
+	if err != nil {
+		return 0, false
+	}
+	// throttled=0x50005
+	_, hex, ok := strings.Cut(strings.TrimSpace(string(out)), "=")
+	if !ok {
+		return 0, false
+	}
+	v, err := strconv.ParseUint(strings.TrimPrefix(hex, "0x"), 16, 64)
+	return v, err == nil
+}
+
+// cpuCoolingActive reports whether a CPU frequency cooling device is
+// engaged, i.e. the kernel is capping clocks for thermal reasons.
+func cpuCoolingActive() bool {
+	devices, _ := filepath.Glob(hostfs.Sys("class/thermal/cooling_device*"))
+	for _, dev := range devices {
+		typ, err := os.ReadFile(filepath.Join(dev, "type"))
+		if err != nil {
+			continue
+		}
+		t := strings.TrimSpace(string(typ))
+		if !strings.HasPrefix(t, "cpufreq") && t != "Processor" {
+			continue
+		}
+		state, err := os.ReadFile(filepath.Join(dev, "cur_state"))
+		if err != nil {
+			continue
+		}
+		if n, _ := strconv.Atoi(strings.TrimSpace(string(state))); n > 0 {
+			return true
+		}
+	}
+	return false
+}
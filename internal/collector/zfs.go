@@ -0,0 +1,294 @@
+package collector
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/neur0map/deskmon-agent/internal/hostfs"
+)
+
+const zfsRefreshInterval = 30 * time.Second
+
+// ZFSPool is one pool's health, capacity and last scrub or resilver.
+type ZFSPool struct {
+	Name                 string   `json:"name"`
+	Health               string   `json:"health"` // ONLINE, DEGRADED, FAULTED, OFFLINE, UNAVAIL, REMOVED, SUSPENDED
+	SizeBytes            uint64   `json:"sizeBytes"`
+	AllocatedBytes       uint64   `json:"allocatedBytes"`
+	FreeBytes            uint64   `json:"freeBytes"`
+	CapacityPercent      float64  `json:"capacityPercent"`
+	FragmentationPercent float64  `json:"fragmentationPercent"`
+	Scan                 *ZFSScan `json:"scan"` // nil when no scrub or resilver ever ran
+	DataErrors           bool     `json:"dataErrors"`
+	Detail               bool     `json:"detail"` // false when only health is known (kstat fallback)
+}
+
+// ZFSScan is a pool's current or last scrub or resilver.
+type ZFSScan struct {
+	Function        string     `json:"function"` // scrub, resilver
+	State           string     `json:"state"`    // scanning, finished, canceled
+	ProgressPercent float64    `json:"progressPercent"`
+	Errors          int64      `json:"errors"`
+	StartedAt       *time.Time `json:"startedAt,omitempty"`
+	FinishedAt      *time.Time `json:"finishedAt,omitempty"`
+}
+
+// ZFSCollector reports ZFS pools through the zpool command. Where it
+// isn't installed, as in the agent's container, pool health alone is read
+// from /proc/spl/kstat/zfs on Linux. It is idle on hosts without ZFS.
+type ZFSCollector struct {
+	mu        sync.RWMutex
+	pools     []ZFSPool
+	sampledAt time.Time
+	sampleErr string
+	zpool     bool   // zpool is installed
+	kstat     string // /proc/spl/kstat/zfs, when present
+	stopCh    chan struct{}
+	Pauser
+}
+
+func NewZFSCollector() *ZFSCollector {
+	return &ZFSCollector{
+		pools:  []ZFSPool{},
+		stopCh: make(chan struct{}),
+	}
+}
+
+// Start begins sampling every 30 seconds if zpool is installed or the ZFS
+// module is loaded.
+func (zc *ZFSCollector) Start() {
+	_, err := exec.LookPath("zpool")
+	zc.zpool = err == nil
+	if dir := hostfs.Proc("spl/kstat/zfs"); !zc.zpool {
+		if _, err := os.Stat(dir); err == nil {
+			zc.kstat = dir
+		}
+	}
+	if !zc.zpool && zc.kstat == "" {
+		return
+	}
+	if zc.zpool {
+		log.Printf("zfs: zpool found, collecting pool stats")
+	} else {
+		log.Printf("zfs: zpool not installed, reading pool health from %s", zc.kstat)
+	}
+
+	zc.refresh()
+	go func() {
+		ticker := time.NewTicker(zfsRefreshInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if !zc.Paused() {
+					zc.refresh()
+				}
+			case <-zc.stopCh:
+				return
+			}
+		}
+	}()
+}
+
+func (zc *ZFSCollector) Stop() {
+	close(zc.stopCh)
+}
+
+// Collect returns the latest pools (non-blocking), [] without ZFS.
+func (zc *ZFSCollector) Collect() []ZFSPool {
+	zc.mu.RLock()
+	defer zc.mu.RUnlock()
+	out := make([]ZFSPool, len(zc.pools))
+	copy(out, zc.pools)
+	return out
+}
+
+func (zc *ZFSCollector) SampleInfo() SampleInfo {
+	zc.mu.RLock()
+	defer zc.mu.RUnlock()
+	return NewSampleInfo(zc.sampledAt, zfsRefreshInterval, zc.sampleErr)
+}
+
+func (zc *ZFSCollector) refresh() {
+	var (
+		pools []ZFSPool
+		err   error
+	)
+	if zc.zpool {
+		pools, err = zpoolPools()
+	} else {
+		pools = kstatPools(zc.kstat)
+	}
+
+	zc.mu.Lock()
+	defer zc.mu.Unlock()
+	zc.sampledAt = time.Now()
+	if err != nil {
+		zc.sampleErr = "zpool: " + err.Error() // keep the last pools
+		return
+	}
+	zc.sampleErr = ""
+	zc.pools = pools
+}
+
+func runZpool(args ...string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	return exec.CommandContext(ctx, "zpool", args...).Output()
+}
+
+// zpoolPools lists pools with `zpool list -Hp` (tab-separated, exact
+// numbers) and adds each one's scan and error lines from `zpool status`.
+func zpoolPools() ([]ZFSPool, error) {
+	out, err := runZpool("list", "-Hp", "-o", "name,size,alloc,free,frag,cap,health")
+	if err != nil {
+		return nil, err
+	}
+	pools := []ZFSPool{}
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		f := strings.Split(line, "\t")
+		if len(f) < 7 {
+			continue
+		}
+		p := ZFSPool{Name: f[0], Health: f[6], Detail: true}
+		p.SizeBytes, _ = strconv.ParseUint(f[1], 10, 64)
+		p.AllocatedBytes, _ = strconv.ParseUint(f[2], 10, 64)
+		p.FreeBytes, _ = strconv.ParseUint(f[3], 10, 64)
+		p.FragmentationPercent, _ = strconv.ParseFloat(strings.TrimSuffix(f[4], "%"), 64) // "-" when unknown
+		p.CapacityPercent, _ = strconv.ParseFloat(strings.TrimSuffix(f[5], "%"), 64)
+		pools = append(pools, p)
+	}
+
+	out, err = runZpool("status")
+	if err != nil {
+		return pools, nil // health and capacity are still right
+	}
+	status := parseZpoolStatus(out)
+	for i := range pools {
+		if st, ok := status[pools[i].Name]; ok {
+			pools[i].Scan = st.scan
+			pools[i].DataErrors = st.dataErrors
+		}
+	}
+	return pools, nil
+}
+
+// zpoolStatus is what `zpool status` adds for one pool.
+type zpoolStatus struct {
+	scan       *ZFSScan
+	dataErrors bool
+}
+
+var (
+	zpoolScanDoneRe     = regexp.MustCompile(`^(scrub repaired|resilvered) .* with (\d+) errors on (.+)$`)
+	zpoolScanRunningRe  = regexp.MustCompile(`^(scrub|resilver) in progress since (.+)$`)
+	zpoolScanCanceledRe = regexp.MustCompile(`^(scrub|resilver) canceled on (.+)$`)
+	zpoolProgressRe     = regexp.MustCompile(`([\d.]+)% done`)
+)
+
+// parseZpoolStatus reads each pool's scan and errors lines:
+//
+//	  pool: tank
+//	 state: ONLINE
+//	  scan: scrub repaired 0B in 00:10:12 with 0 errors on Sun Oct 13 00:34:13 2024
+//	...
+//	errors: No known data errors
+//
+// A running scan continues on the following lines:
+//
+//	  scan: scrub in progress since Sun Oct 13 00:24:01 2024
+//		1.23T / 2.00T scanned at 500M/s, 800G / 2.00T issued at 300M/s
+//		0B repaired, 40.00% done, 01:10:00 to go
+func parseZpoolStatus(out []byte) map[string]zpoolStatus {
+	status := make(map[string]zpoolStatus)
+	var (
+		pool string
+		cur  zpoolStatus
+		key  string // last "key:" seen, for continuation lines
+	)
+	flush := func() {
+		if pool != "" {
+			status[pool] = cur
+		}
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if k, v, ok := strings.Cut(line, ": "); ok && !strings.ContainsAny(k, " \t") {
+			key = k
+			switch k {
+			case "pool":
+				flush()
+				pool, cur = v, zpoolStatus{}
+			case "scan":
+				cur.scan = parseZpoolScan(v)
+			case "errors":
+				cur.dataErrors = v != "No known data errors"
+			}
+			continue
+		}
+		if key == "scan" && cur.scan != nil && cur.scan.State == "scanning" {
+			if m := zpoolProgressRe.FindStringSubmatch(line); m != nil {
+				cur.scan.ProgressPercent, _ = strconv.ParseFloat(m[1], 64)
+			}
+		}
+	}
+	flush()
+	return status
+}
+
+func parseZpoolScan(v string) *ZFSScan {
+	function := func(word string) string {
+		if strings.HasPrefix(word, "resilver") {
+			return "resilver"
+		}
+		return "scrub"
+	}
+	switch {
+	case zpoolScanDoneRe.MatchString(v):
+		m := zpoolScanDoneRe.FindStringSubmatch(v)
+		s := &ZFSScan{Function: function(m[1]), State: "finished", ProgressPercent: 100}
+		s.Errors, _ = strconv.ParseInt(m[2], 10, 64)
+		s.FinishedAt = parseZpoolTime(m[3])
+		return s
+	case zpoolScanRunningRe.MatchString(v):
+		m := zpoolScanRunningRe.FindStringSubmatch(v)
+		return &ZFSScan{Function: function(m[1]), State: "scanning", StartedAt: parseZpoolTime(m[2])}
+	case zpoolScanCanceledRe.MatchString(v):
+		m := zpoolScanCanceledRe.FindStringSubmatch(v)
+		return &ZFSScan{Function: function(m[1]), State: "canceled", FinishedAt: parseZpoolTime(m[2])}
+	}
+	return nil // "none requested"
+}
+
+// parseZpoolTime parses zpool's ctime-style local timestamps.
+func parseZpoolTime(s string) *time.Time {
+	t, err := time.ParseInLocation("Mon Jan _2 15:04:05 2006", strings.TrimSpace(s), time.Local)
+	if err != nil {
+		return nil
+	}
+	return &t
+}
+
+// kstatPools reads each pool's state from /proc/spl/kstat/zfs/<pool>/state
+// (OpenZFS 0.8+). Capacity and scans aren't exposed there.
+func kstatPools(dir string) []ZFSPool {
+	pools := []ZFSPool{}
+	matches, _ := filepath.Glob(filepath.Join(dir, "*", "state"))
+	for _, path := range matches {
+		if health := readSysString(path); health != "" {
+			pools = append(pools, ZFSPool{Name: filepath.Base(filepath.Dir(path)), Health: health})
+		}
+	}
+	return pools
+}
@@ -1,7 +1,15 @@
 package config
 
 import (
+	"errors"
+	"fmt"
+	"net/url"
 	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
@@ -17,16 +25,618 @@ const (
 type Config struct {
 	Port int    `yaml:"port"`
 	Bind string `yaml:"bind"`
+
+	// TLSCert and TLSKey serve HTTPS (and TLS on grpc_port) with this PEM
+	// certificate and key. If neither file exists yet, a self-signed pair
+	// is generated at these paths on startup.
+	TLSCert string `yaml:"tls_cert,omitempty"`
+	TLSKey  string `yaml:"tls_key,omitempty"`
+
+	// GRPCPort serves the gRPC API (internal/deskmonpb/deskmon.proto) on
+	// this port at the same bind address, with the same auth_token and
+	// read_only. 0 disables it.
+	GRPCPort int `yaml:"grpc_port,omitempty"`
+
+	// DockerHost is the Docker API endpoint: a unix socket path or a URL
+	// such as "tcp://socket-proxy:2375" for docker-socket-proxy setups.
+	// Podman's Docker-compatible socket works too.
+	DockerHost string `yaml:"docker_host,omitempty"`
+
+	// ContainerRuntime picks the socket when docker_host isn't set:
+	// "docker", "podman" (rootful, then rootless), or "auto", the default,
+	// which takes Docker's socket if it exists and Podman's otherwise.
+	ContainerRuntime string `yaml:"container_runtime,omitempty"`
+
+	// TrivyServer enables CVE counts per container image by running the
+	// trivy CLI against a Trivy server, e.g. "http://trivy:4954".
+	TrivyServer   string        `yaml:"trivy_server,omitempty"`
+	TrivyInterval time.Duration `yaml:"trivy_interval,omitempty"` // re-scan interval, default 6h
+
+	// ReadOnly disables every mutating endpoint (container/process/service
+	// actions, agent control, config writes) for semi-trusted clients.
+	ReadOnly bool `yaml:"read_only,omitempty"`
+
+	// ConfirmDestructive makes container stop/restart, process kill, agent
+	// restart/stop and destructive service actions answer with a
+	// confirmation token that must be sent back within 30 seconds before
+	// anything happens. gRPC can't confirm, so it refuses stop and restart.
+	ConfirmDestructive bool `yaml:"confirm_destructive,omitempty"`
+
+	// Services holds per-plugin settings (e.g. Pi-hole password, Proxmox
+	// API token), keyed by plugin ID then setting name.
+	Services map[string]map[string]string `yaml:"services,omitempty"`
+
+	// AuthToken, when set, requires "Authorization: Bearer <token>" on every
+	// endpoint except /health. Empty keeps the SSH-tunnel-only model.
+	AuthToken string `yaml:"auth_token,omitempty"`
+
+	// AuthTokenFile reads the token from a file instead (Docker secrets,
+	// systemd LoadCredential). Service settings support the same via a
+	// "_file" suffix, e.g. "password_file", and any auth_token or service
+	// value may be an environment reference such as "${PIHOLE_PASSWORD}".
+	AuthTokenFile string `yaml:"auth_token_file,omitempty"`
+
+	// Tokens are further bearer tokens, each limited to a scope, so e.g. a
+	// dashboard can get a read-only token. auth_token counts as admin.
+	Tokens []TokenConfig `yaml:"tokens,omitempty"`
+
+	// SessionTTL is how long tokens from POST /auth/session last, default
+	// 15 minutes.
+	SessionTTL time.Duration `yaml:"session_ttl,omitempty"`
+
+	// EncryptSecrets stores auth_token, tokens, the ingest secret, webhook
+	// URLs, secrets and headers, a service_http proxy URL with credentials,
+	// and service credentials encrypted (AES-256-GCM) when the agent writes
+	// the config. The key comes from SecretKeyFile, or is derived from
+	// /etc/machine-id when that is empty.
+	EncryptSecrets bool   `yaml:"encrypt_secrets,omitempty"`
+	SecretKeyFile  string `yaml:"secret_key_file,omitempty"`
+
+	plaintextSecrets bool                 // set by Load when a credential was stored unencrypted
+	secretRefs       map[string]secretRef // externally sourced values, restored on Save
+
+	RateLimit RateLimitConfig `yaml:"rate_limit,omitempty"`
+
+	// TrustedProxies lists reverse proxy IPs or CIDRs whose
+	// X-Forwarded-For / X-Real-IP headers are honored for client IPs.
+	TrustedProxies []string `yaml:"trusted_proxies,omitempty"`
+
+	CORS CORSConfig `yaml:"cors,omitempty"`
+
+	Alerts AlertsConfig `yaml:"alerts,omitempty"`
+
+	Events EventsConfig `yaml:"events,omitempty"`
+
+	Notifications NotificationsConfig `yaml:"notifications,omitempty"`
+
+	AutoUpdate AutoUpdateConfig `yaml:"auto_update,omitempty"`
+
+	FanControl FanControlConfig `yaml:"fan_control,omitempty"`
+
+	Processes ProcessesConfig `yaml:"processes,omitempty"`
+
+	// TextfileDir is scanned for *.prom and *.json metric files written by
+	// other tools (node_exporter textfile style); their metrics are merged
+	// into the custom metrics.
+	TextfileDir string `yaml:"textfile_dir,omitempty"`
+
+	// AccessLog writes one line per request (method, path, status,
+	// duration, bytes, token) for debugging client issues.
+	AccessLog bool `yaml:"access_log,omitempty"`
+
+	// MaxMemoryMB bounds the agent's own memory: history is sized to fit
+	// and optional collectors are paused while resident memory nears the
+	// limit. 0 leaves memory unmanaged.
+	MaxMemoryMB int `yaml:"max_memory_mb,omitempty"`
+
+	Collectors CollectorsConfig `yaml:"collectors,omitempty"`
+
+	// PerCoreCPU adds each logical CPU's usage (cpu.perCore) to every
+	// system stats response and stream. Without it only
+	// GET /stats/system?perCore=true includes it.
+	PerCoreCPU bool `yaml:"per_core_cpu,omitempty"`
+
+	Detection DetectionConfig `yaml:"detection,omitempty"`
+
+	// ServiceHTTP tunes the connections plugins open to service APIs.
+	ServiceHTTP ServiceHTTPConfig `yaml:"service_http,omitempty"`
+
+	// CertificatePaths adds PEM certificates or Traefik acme.json files
+	// (globs) to the stores scanned for GET /stats/certificates.
+	CertificatePaths []string `yaml:"certificate_paths,omitempty"`
+
+	DNS DNSConfig `yaml:"dns,omitempty"`
+}
+
+// CORSConfig allows browser-based dashboards to call the API directly.
+// CORS is disabled while AllowedOrigins is empty.
+type CORSConfig struct {
+	AllowedOrigins   []string      `yaml:"allowed_origins,omitempty"` // exact origins, or "*"
+	AllowedMethods   []string      `yaml:"allowed_methods,omitempty"` // default: GET, POST, PUT, OPTIONS
+	AllowedHeaders   []string      `yaml:"allowed_headers,omitempty"` // default: Authorization, Content-Type, If-Match
+	ExposedHeaders   []string      `yaml:"exposed_headers,omitempty"`
+	AllowCredentials bool          `yaml:"allow_credentials,omitempty"`
+	MaxAge           time.Duration `yaml:"max_age,omitempty"` // preflight cache, default 10m
+}
+
+// validate rejects "*" with allow_credentials: browsers refuse a wildcard
+// on credentialed requests, and echoing the Origin instead would let any
+// site make them.
+func (c CORSConfig) validate() error {
+	if c.AllowCredentials && slices.Contains(c.AllowedOrigins, "*") {
+		return fmt.Errorf(`allow_credentials needs explicit allowed_origins, not "*"`)
+	}
+	return nil
+}
+
+// AutoUpdateConfig schedules Watchtower-style image updates. Containers opt
+// in by name here or with the label deskmon.auto-update=true (optionally
+// deskmon.auto-update.schedule=...); deskmon.auto-update=false opts out.
+type AutoUpdateConfig struct {
+	Enabled    bool     `yaml:"enabled,omitempty"`
+	Schedule   string   `yaml:"schedule,omitempty"`   // "HH:MM" daily or an interval like "12h", default "04:00"
+	Containers []string `yaml:"containers,omitempty"` // container name globs
+	Cleanup    bool     `yaml:"cleanup,omitempty"`    // remove the old image after updating
+}
+
+// FanControlConfig enables writes to hwmon PWM outputs. Fans are always
+// readable; setting them is opt-in because a wrong value can overheat the
+// machine.
+type FanControlConfig struct {
+	Enabled bool `yaml:"enabled,omitempty"`
+	MinPWM  int  `yaml:"min_pwm,omitempty"` // lowest manual duty cycle accepted (0-255), default 64
+}
+
+// ProcessesConfig filters the top-processes list, e.g. to hide kernel
+// threads that can't be acted on.
+type ProcessesConfig struct {
+	ExcludeSelf bool     `yaml:"exclude_self,omitempty"` // hide the agent's own process
+	Exclude     []string `yaml:"exclude,omitempty"`      // process name globs, e.g. "kworker/*"
+}
+
+// CollectorsConfig switches off subsystems a host doesn't need, e.g. Docker
+// and process sampling on a DNS-only Pi. Each is on unless set to false.
+type CollectorsConfig struct {
+	Docker      *bool `yaml:"docker,omitempty"`      // container stats, actions and Docker-based service detection
+	Processes   *bool `yaml:"processes,omitempty"`   // top processes, per-user usage and zombie/D-state tracking
+	Services    *bool `yaml:"services,omitempty"`    // service detection and plugin stats
+	Temperature *bool `yaml:"temperature,omitempty"` // CPU temperature
+}
+
+func (c CollectorsConfig) DockerEnabled() bool      { return enabled(c.Docker) }
+func (c CollectorsConfig) ProcessesEnabled() bool   { return enabled(c.Processes) }
+func (c CollectorsConfig) ServicesEnabled() bool    { return enabled(c.Services) }
+func (c CollectorsConfig) TemperatureEnabled() bool { return enabled(c.Temperature) }
+
+// Disabled lists the collectors switched off, for logging.
+func (c CollectorsConfig) Disabled() []string {
+	var off []string
+	for _, sw := range []struct {
+		name string
+		on   bool
+	}{
+		{"docker", c.DockerEnabled()},
+		{"processes", c.ProcessesEnabled()},
+		{"services", c.ServicesEnabled()},
+		{"temperature", c.TemperatureEnabled()},
+	} {
+		if !sw.on {
+			off = append(off, sw.name)
+		}
+	}
+	return off
+}
+
+func enabled(b *bool) bool {
+	return b == nil || *b
+}
+
+// DetectionConfig tunes service detection, which by default probes every
+// candidate port on localhost every 30 seconds — traffic an IDS can take
+// for a port scan.
+type DetectionConfig struct {
+	Concurrency int           `yaml:"concurrency,omitempty"`  // plugins probing at once, default 1
+	Hosts       []string      `yaml:"hosts,omitempty"`        // hosts HTTP probes target, default 127.0.0.1 then localhost
+	ProbeBudget int           `yaml:"probe_budget,omitempty"` // HTTP probes per detection cycle, 0 for no limit
+	Jitter      time.Duration `yaml:"jitter,omitempty"`       // random extra delay before each cycle, up to this
+	Quiet       bool          `yaml:"quiet,omitempty"`        // re-probe only when containers or listening processes change
+}
+
+func (d DetectionConfig) validate() error {
+	switch {
+	case d.Concurrency < 0:
+		return fmt.Errorf("concurrency must not be negative")
+	case d.ProbeBudget < 0:
+		return fmt.Errorf("probe_budget must not be negative")
+	case d.Jitter < 0:
+		return fmt.Errorf("jitter must not be negative")
+	}
+	for _, h := range d.Hosts {
+		if h == "" || strings.ContainsAny(h, "/ ") {
+			return fmt.Errorf("invalid host %q", h)
+		}
+	}
+	return nil
+}
+
+// ServiceHTTPConfig tunes the pooled HTTP clients service plugins share.
+// Without Proxy, HTTP_PROXY, HTTPS_PROXY and NO_PROXY from the environment
+// apply; services on localhost are never proxied.
+type ServiceHTTPConfig struct {
+	DialTimeout time.Duration `yaml:"dial_timeout,omitempty"` // TCP connect timeout, default 3s
+	Proxy       string        `yaml:"proxy,omitempty"`        // proxy URL (http, https or socks5) overriding the environment
+}
+
+func (c ServiceHTTPConfig) validate() error {
+	if c.DialTimeout < 0 {
+		return fmt.Errorf("dial_timeout must not be negative")
+	}
+	if c.Proxy != "" {
+		// The URL may carry credentials, so errors leave it out.
+		u, err := url.Parse(c.Proxy)
+		if err != nil {
+			var uerr *url.Error
+			if errors.As(err, &uerr) {
+				err = uerr.Err
+			}
+			return fmt.Errorf("proxy: %w", err)
+		}
+		switch u.Scheme {
+		case "http", "https", "socks5":
+		default:
+			return fmt.Errorf("proxy scheme %q must be http, https or socks5", u.Scheme)
+		}
+		if u.Host == "" {
+			return fmt.Errorf("proxy has no host")
+		}
+	}
+	return nil
+}
+
+// DNSConfig lists DNS records the agent resolves through the host's
+// resolvers and compares with what they should be, e.g. to catch a dynamic
+// DNS name that stopped following the WAN address.
+type DNSConfig struct {
+	Interval time.Duration    `yaml:"interval,omitempty"` // between checks, default 5m
+	WANURL   string           `yaml:"wan_url,omitempty"`  // returns the public IPv4 address as text, default https://api.ipify.org
+	WAN6URL  string           `yaml:"wan6_url,omitempty"` // same for IPv6, default https://api6.ipify.org
+	Records  []DNSRecordCheck `yaml:"records,omitempty"`
+}
+
+// DNSRecordCheck is one expected record. Expect lists every value the
+// record should have; for A and AAAA records "wan" stands for the public
+// address, looked up at wan_url or wan6_url.
+type DNSRecordCheck struct {
+	Name   string   `yaml:"name"`
+	Type   string   `yaml:"type,omitempty"` // A (default), AAAA, CNAME, MX, NS, TXT
+	Expect []string `yaml:"expect"`
+}
+
+// DNS record types DNSRecordCheck accepts.
+var dnsRecordTypes = map[string]bool{"A": true, "AAAA": true, "CNAME": true, "MX": true, "NS": true, "TXT": true}
+
+func (d DNSConfig) validate() error {
+	if d.Interval < 0 {
+		return fmt.Errorf("interval must not be negative")
+	}
+	for i, r := range d.Records {
+		switch {
+		case r.Name == "":
+			return fmt.Errorf("records[%d]: name must not be empty", i)
+		case r.Type != "" && !dnsRecordTypes[strings.ToUpper(r.Type)]:
+			return fmt.Errorf("records[%d]: type must be A, AAAA, CNAME, MX, NS or TXT", i)
+		case len(r.Expect) == 0:
+			return fmt.Errorf("records[%d]: expect must list at least one value", i)
+		}
+	}
+	return nil
+}
+
+// Token scopes, from least to most privileged. Each includes the ones
+// before it.
+const (
+	ScopeReadOnly = "read-only" // GET endpoints and streams
+	ScopeControl  = "control"   // container, process, service and fan actions, layout and metric pushes
+	ScopeAdmin    = "admin"     // agent restart/stop, service configuration, support bundles
+)
+
+// TokenConfig is one scoped bearer token. Token may be a "${VAR}"
+// reference and is encrypted on save like auth_token.
+type TokenConfig struct {
+	Name  string `yaml:"name,omitempty"` // shown in logs instead of the token
+	Token string `yaml:"token"`
+	Scope string `yaml:"scope"`
+
+	// Policy narrows what the scope allows, e.g. restarting only some
+	// containers. Without it the scope alone decides.
+	Policy []PolicyRule `yaml:"policy,omitempty"`
+}
+
+// PolicyRule allows or denies actions, optionally only on some
+// containers. A token's rules are tried in order and the first that
+// matches decides; when none matches the action is allowed only if every
+// rule is a deny rule, so a list of allows reads as "this and nothing
+// else" and a list of denies as "anything but this".
+type PolicyRule struct {
+	Effect  string   `yaml:"effect"`  // allow or deny
+	Actions []string `yaml:"actions"` // action names or globs: container.restart, container.*, process.kill
+
+	// Containers and Labels limit the rule to container actions on
+	// containers whose name matches one of the globs and that carry every
+	// label (a "*" value matches any value).
+	Containers []string          `yaml:"containers,omitempty"`
+	Labels     map[string]string `yaml:"labels,omitempty"`
+}
+
+// Policy actions. Each names one mutating or admin endpoint; reads aren't
+// subject to policies.
+var PolicyActions = []string{
+	"agent.restart", "agent.stop",
+	"container.start", "container.stop", "container.restart",
+	"process.kill",
+	"service.configure", "service.action",
+	"fan.set",
+	"layout.save",
+	"metrics.push",
+	"debug.bundle",
+	"logs.journal",
+}
+
+// PolicyAllows reports whether a token with policy may perform action. For
+// container actions, container and labels describe the target; both are
+// empty when it isn't known. An unknown target could be one a rule scoped
+// by containers or labels is meant to deny, so such a rule covering the
+// action denies it.
+func PolicyAllows(policy []PolicyRule, action, container string, labels map[string]string) bool {
+	if strings.HasPrefix(action, "container.") && container == "" {
+		for _, rule := range policy {
+			if (len(rule.Containers) > 0 || len(rule.Labels) > 0) && matchAny(rule.Actions, action) {
+				return false
+			}
+		}
+	}
+	onlyDeny := true
+	for _, rule := range policy {
+		if rule.Effect == "allow" {
+			onlyDeny = false
+		}
+		if rule.matches(action, container, labels) {
+			return rule.Effect == "allow"
+		}
+	}
+	return onlyDeny
+}
+
+func (p PolicyRule) matches(action, container string, labels map[string]string) bool {
+	if !matchAny(p.Actions, action) {
+		return false
+	}
+	if len(p.Containers) == 0 && len(p.Labels) == 0 {
+		return true
+	}
+	if !strings.HasPrefix(action, "container.") || container == "" {
+		return false
+	}
+	if len(p.Containers) > 0 && !matchAny(p.Containers, container) {
+		return false
+	}
+	for k, want := range p.Labels {
+		got, ok := labels[k]
+		if !ok || want != "*" && got != want {
+			return false
+		}
+	}
+	return true
+}
+
+func matchAny(patterns []string, s string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, s); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (p PolicyRule) validate() error {
+	if p.Effect != "allow" && p.Effect != "deny" {
+		return fmt.Errorf("effect must be allow or deny")
+	}
+	if len(p.Actions) == 0 {
+		return fmt.Errorf("actions must list at least one action")
+	}
+	for _, pattern := range append(append([]string{}, p.Actions...), p.Containers...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid pattern %q", pattern)
+		}
+	}
+	for _, pattern := range p.Actions {
+		known := false
+		for _, action := range PolicyActions {
+			if ok, _ := path.Match(pattern, action); ok {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return fmt.Errorf("%q matches no action (%s)", pattern, strings.Join(PolicyActions, ", "))
+		}
+	}
+	return nil
+}
+
+// ScopeAllows reports whether a token with scope may call a route that
+// requires required.
+func ScopeAllows(scope, required string) bool {
+	return scopeRank(scope) >= scopeRank(required) && scopeRank(scope) > 0
+}
+
+func scopeRank(scope string) int {
+	switch scope {
+	case ScopeReadOnly:
+		return 1
+	case ScopeControl:
+		return 2
+	case ScopeAdmin:
+		return 3
+	}
+	return 0
+}
+
+func (t TokenConfig) validate() error {
+	if t.Token == "" {
+		return fmt.Errorf("token must not be empty")
+	}
+	if scopeRank(t.Scope) == 0 {
+		return fmt.Errorf("scope must be %s, %s or %s", ScopeReadOnly, ScopeControl, ScopeAdmin)
+	}
+	for i, rule := range t.Policy {
+		if err := rule.validate(); err != nil {
+			return fmt.Errorf("policy[%d]: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// AuthEnabled reports whether requests need a bearer token.
+func (cfg *Config) AuthEnabled() bool {
+	return cfg.AuthToken != "" || len(cfg.Tokens) > 0
+}
+
+// EventsConfig configures the event timeline.
+type EventsConfig struct {
+	// IngestSecret enables POST /events/ingest. Each payload must be signed
+	// with HMAC-SHA256 of the body using this secret. May be "${VAR}".
+	IngestSecret string `yaml:"ingest_secret,omitempty"`
+}
+
+// NotificationsConfig sends webhooks when alerts fire or resolve and when
+// containers turn unhealthy or start restarting.
+type NotificationsConfig struct {
+	Webhooks []WebhookConfig `yaml:"webhooks,omitempty"`
+}
+
+// WebhookConfig is one webhook receiver. URL, Secret and header values may
+// be "${VAR}" references.
+type WebhookConfig struct {
+	URL         string            `yaml:"url"`
+	Events      []string          `yaml:"events,omitempty"`       // kinds to send, globs allowed (e.g. "alert.*"); default all
+	MinSeverity string            `yaml:"min_severity,omitempty"` // info (default), warning, critical
+	Headers     map[string]string `yaml:"headers,omitempty"`      // extra request headers, e.g. Authorization
+	Secret      string            `yaml:"secret,omitempty"`       // signs the body as X-Deskmon-Signature: sha256=<hmac>
+}
+
+func (h WebhookConfig) validate() error {
+	if !strings.HasPrefix(h.URL, "http://") && !strings.HasPrefix(h.URL, "https://") {
+		return fmt.Errorf("url must be an http or https URL")
+	}
+	switch h.MinSeverity {
+	case "", "info", "warning", "critical":
+	default:
+		return fmt.Errorf("min_severity must be info, warning or critical")
+	}
+	return nil
+}
+
+// AlertsConfig lists alert rules. With no rules configured the built-in
+// container_flapping and container_oom rules apply to every container.
+type AlertsConfig struct {
+	Rules []AlertRule `yaml:"rules,omitempty"`
+}
+
+// AlertRule raises an alert when its condition holds. Fields beyond Type
+// are optional and type-specific.
+type AlertRule struct {
+	Type      string        `yaml:"type"`                // container_flapping, container_oom, thermal, custom_metric, event, kernel_limits, intrusion, raid, certificate_expiry, dns
+	Container string        `yaml:"container,omitempty"` // container name glob, default all
+	Severity  string        `yaml:"severity,omitempty"`  // info, warning (default), critical
+	Threshold int           `yaml:"threshold,omitempty"` // container_flapping: restarts within 10m, default 3; thermal: °C; kernel_limits: percent of the limit, default 90; intrusion: bans within 15m, default 10; certificate_expiry: days left, default 14
+	Duration  time.Duration `yaml:"duration,omitempty"`  // thermal: how long the condition must hold, default 1m; event, container_oom: how long the alert stays active, default 1h
+
+	// thermal: also fire while the CPU is throttled. A rule without a
+	// threshold always watches throttling.
+	Throttling bool `yaml:"throttling,omitempty"`
+
+	// custom_metric: fires while the named metric is above or below a bound.
+	Metric string   `yaml:"metric,omitempty"`
+	Above  *float64 `yaml:"above,omitempty"`
+	Below  *float64 `yaml:"below,omitempty"`
+
+	// event: fires on an ingested event whose type matches Event (a glob),
+	// optionally only from sources matching Source. A later event from the
+	// same source matching Resolve clears it early.
+	Event   string `yaml:"event,omitempty"`
+	Source  string `yaml:"source,omitempty"`
+	Resolve string `yaml:"resolve,omitempty"`
+}
+
+// RateLimitConfig tunes the per-IP request buckets. Zero values fall back
+// to the built-in defaults (60 requests/min, 10 mutating/min, ban after 5
+// consecutive auth failures).
+type RateLimitConfig struct {
+	Requests     int           `yaml:"requests,omitempty"`      // general requests per period per IP
+	Period       time.Duration `yaml:"period,omitempty"`        // bucket window, e.g. "1m"
+	Mutating     int           `yaml:"mutating,omitempty"`      // POST/PUT/DELETE per period per client
+	AuthFailures int           `yaml:"auth_failures,omitempty"` // consecutive failed auth attempts before a ban
+	MaxBan       time.Duration `yaml:"max_ban,omitempty"`       // auth bans start at Period and double up to this, default 1h
+
+	// Endpoints overrides the general limit for specific paths,
+	// e.g. {"/stats": 120}. Each path gets its own bucket per IP.
+	Endpoints map[string]int `yaml:"endpoints,omitempty"`
 }
 
 func (cfg *Config) Save(path string) error {
-	data, err := yaml.Marshal(cfg)
+	out := cfg.withSecretRefs()
+	if cfg.EncryptSecrets {
+		enc, err := out.encryptedCopy()
+		if err != nil {
+			return fmt.Errorf("encrypting secrets: %w", err)
+		}
+		out = enc
+	}
+
+	data, err := yaml.Marshal(out)
 	if err != nil {
 		return err
 	}
 	return os.WriteFile(path, data, 0600)
 }
 
+// Podman's Docker-compatible API sockets. Rootless ones live in each
+// user's runtime directory.
+const (
+	podmanSock      = "/run/podman/podman.sock"
+	podmanUserSocks = "/run/user/*/podman/podman.sock"
+)
+
+// containerSocket returns the API socket for runtime when docker_host isn't
+// set. When no socket exists it returns the runtime's usual path, so the
+// container status reports it as not installed.
+func containerSocket(runtime string) string {
+	if runtime == "docker" {
+		return DefaultDockerSock
+	}
+	if runtime != "podman" {
+		if _, err := os.Stat(DefaultDockerSock); err == nil {
+			return DefaultDockerSock
+		}
+	}
+	candidates := []string{podmanSock}
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		candidates = append(candidates, filepath.Join(dir, "podman", "podman.sock"))
+	}
+	rootless, _ := filepath.Glob(podmanUserSocks)
+	for _, sock := range append(candidates, rootless...) {
+		if _, err := os.Stat(sock); err == nil {
+			return sock
+		}
+	}
+	if runtime == "podman" {
+		return podmanSock
+	}
+	return DefaultDockerSock
+}
+
 func Load(path string) (*Config, error) {
 	cfg := &Config{
 		Port: DefaultPort,
@@ -36,6 +646,7 @@ func Load(path string) (*Config, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
 		if os.IsNotExist(err) {
+			cfg.DockerHost = containerSocket("")
 			return cfg, nil
 		}
 		return nil, err
@@ -44,6 +655,12 @@ func Load(path string) (*Config, error) {
 	if err := yaml.Unmarshal(data, cfg); err != nil {
 		return nil, err
 	}
+	if err := cfg.decryptSecrets(); err != nil {
+		return nil, fmt.Errorf("decrypting secrets: %w", err)
+	}
+	if err := cfg.resolveSecretRefs(); err != nil {
+		return nil, fmt.Errorf("resolving secrets: %w", err)
+	}
 
 	if cfg.Port == 0 {
 		cfg.Port = DefaultPort
@@ -51,6 +668,47 @@ func Load(path string) (*Config, error) {
 	if cfg.Bind == "" {
 		cfg.Bind = DefaultBind
 	}
+	switch cfg.ContainerRuntime {
+	case "", "auto", "docker", "podman":
+	default:
+		return nil, fmt.Errorf("container_runtime must be auto, docker or podman")
+	}
+	if cfg.DockerHost == "" {
+		cfg.DockerHost = containerSocket(cfg.ContainerRuntime)
+	}
+	if (cfg.TLSCert == "") != (cfg.TLSKey == "") {
+		return nil, fmt.Errorf("tls_cert and tls_key must be set together")
+	}
+	if cfg.GRPCPort != 0 && cfg.GRPCPort == cfg.Port {
+		return nil, fmt.Errorf("grpc_port %d is the same as port", cfg.GRPCPort)
+	}
+	for i, hook := range cfg.Notifications.Webhooks {
+		if err := hook.validate(); err != nil {
+			return nil, fmt.Errorf("notifications.webhooks[%d]: %w", i, err)
+		}
+	}
+	if err := cfg.CORS.validate(); err != nil {
+		return nil, fmt.Errorf("cors: %w", err)
+	}
+	if err := cfg.Detection.validate(); err != nil {
+		return nil, fmt.Errorf("detection: %w", err)
+	}
+	if err := cfg.ServiceHTTP.validate(); err != nil {
+		return nil, fmt.Errorf("service_http: %w", err)
+	}
+	if err := cfg.DNS.validate(); err != nil {
+		return nil, fmt.Errorf("dns: %w", err)
+	}
+	seen := map[string]bool{cfg.AuthToken: cfg.AuthToken != ""}
+	for i, t := range cfg.Tokens {
+		if err := t.validate(); err != nil {
+			return nil, fmt.Errorf("tokens[%d]: %w", i, err)
+		}
+		if seen[t.Token] {
+			return nil, fmt.Errorf("tokens[%d]: token is already in use", i)
+		}
+		seen[t.Token] = true
+	}
 
 	return cfg, nil
 }
@@ -0,0 +1,266 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// envRefPattern matches a value that is entirely an environment reference,
+// e.g. "${PIHOLE_PASSWORD}". Partial references are left as literals so a
+// password containing "$" is never mangled.
+var envRefPattern = regexp.MustCompile(`^\$\{([A-Za-z_][A-Za-z0-9_]*)\}$`)
+
+// fileSuffix marks a service setting whose value is a path to read the real
+// value from, e.g. "password_file: /run/secrets/pihole".
+const fileSuffix = "_file"
+
+// secretRef remembers where an externally sourced value came from so Save
+// writes the reference back instead of inlining the secret.
+type secretRef struct {
+	resolved string // value after resolution
+	raw      string // original "${VAR}" or file path
+	fileKey  string // e.g. "password_file"; empty for env references
+}
+
+func isEnvRef(value string) bool {
+	return envRefPattern.MatchString(value)
+}
+
+// readSecretFile reads a credential file, expanding env vars in the path so
+// "${CREDENTIALS_DIRECTORY}/token" works with systemd LoadCredential.
+func readSecretFile(path string) (string, error) {
+	data, err := os.ReadFile(os.ExpandEnv(path))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+func resolveEnvRef(value string) (string, error) {
+	m := envRefPattern.FindStringSubmatch(value)
+	resolved, ok := os.LookupEnv(m[1])
+	if !ok {
+		return "", fmt.Errorf("environment variable %s is not set", m[1])
+	}
+	return resolved, nil
+}
+
+// resolveSecretRefs replaces auth_token_file, "<name>_file" service settings
+// and "${VAR}" values with the referenced content.
+func (cfg *Config) resolveSecretRefs() error {
+	cfg.secretRefs = make(map[string]secretRef)
+
+	switch {
+	case cfg.AuthTokenFile != "" && cfg.AuthToken != "":
+		return fmt.Errorf("auth_token and auth_token_file are both set")
+	case cfg.AuthTokenFile != "":
+		token, err := readSecretFile(cfg.AuthTokenFile)
+		if err != nil {
+			return fmt.Errorf("auth_token_file: %w", err)
+		}
+		cfg.AuthToken = token
+		cfg.secretRefs["auth_token"] = secretRef{resolved: token, raw: cfg.AuthTokenFile, fileKey: "auth_token_file"}
+	case isEnvRef(cfg.AuthToken):
+		token, err := resolveEnvRef(cfg.AuthToken)
+		if err != nil {
+			return fmt.Errorf("auth_token: %w", err)
+		}
+		cfg.secretRefs["auth_token"] = secretRef{resolved: token, raw: cfg.AuthToken}
+		cfg.AuthToken = token
+	}
+
+	if isEnvRef(cfg.Events.IngestSecret) {
+		secret, err := resolveEnvRef(cfg.Events.IngestSecret)
+		if err != nil {
+			return fmt.Errorf("events.ingest_secret: %w", err)
+		}
+		cfg.secretRefs["events.ingest_secret"] = secretRef{resolved: secret, raw: cfg.Events.IngestSecret}
+		cfg.Events.IngestSecret = secret
+	}
+
+	for i := range cfg.Tokens {
+		t := &cfg.Tokens[i]
+		if !isEnvRef(t.Token) {
+			continue
+		}
+		token, err := resolveEnvRef(t.Token)
+		if err != nil {
+			return fmt.Errorf("%s: %w", tokenField(i), err)
+		}
+		cfg.secretRefs[tokenField(i)] = secretRef{resolved: token, raw: t.Token}
+		t.Token = token
+	}
+
+	for i := range cfg.Notifications.Webhooks {
+		if err := cfg.resolveWebhookRefs(i); err != nil {
+			return err
+		}
+	}
+
+	for pluginID, values := range cfg.Services {
+		for name, value := range values {
+			field := "services." + pluginID + "." + name
+			switch {
+			case strings.HasSuffix(name, fileSuffix):
+				base := strings.TrimSuffix(name, fileSuffix)
+				if _, inline := values[base]; inline {
+					return fmt.Errorf("%s and %s are both set", "services."+pluginID+"."+base, field)
+				}
+				resolved, err := readSecretFile(value)
+				if err != nil {
+					return fmt.Errorf("%s: %w", field, err)
+				}
+				delete(values, name)
+				values[base] = resolved
+				cfg.secretRefs["services."+pluginID+"."+base] = secretRef{resolved: resolved, raw: value, fileKey: name}
+			case isEnvRef(value):
+				resolved, err := resolveEnvRef(value)
+				if err != nil {
+					return fmt.Errorf("%s: %w", field, err)
+				}
+				values[name] = resolved
+				cfg.secretRefs[field] = secretRef{resolved: resolved, raw: value}
+			}
+		}
+	}
+	return nil
+}
+
+func tokenField(i int) string {
+	return "tokens." + strconv.Itoa(i) + ".token"
+}
+
+func webhookField(i int) string {
+	return "notifications.webhooks." + strconv.Itoa(i)
+}
+
+// resolveWebhookRefs resolves "${VAR}" in a webhook's URL, secret and
+// header values, which often embed tokens.
+func (cfg *Config) resolveWebhookRefs(i int) error {
+	hook := &cfg.Notifications.Webhooks[i]
+	prefix := webhookField(i)
+	resolve := func(field string, value *string) error {
+		if !isEnvRef(*value) {
+			return nil
+		}
+		resolved, err := resolveEnvRef(*value)
+		if err != nil {
+			return fmt.Errorf("%s: %w", field, err)
+		}
+		cfg.secretRefs[field] = secretRef{resolved: resolved, raw: *value}
+		*value = resolved
+		return nil
+	}
+	if err := resolve(prefix+".url", &hook.URL); err != nil {
+		return err
+	}
+	if err := resolve(prefix+".secret", &hook.Secret); err != nil {
+		return err
+	}
+	for name, value := range hook.Headers {
+		if err := resolve(prefix+".headers."+name, &value); err != nil {
+			return err
+		}
+		hook.Headers[name] = value
+	}
+	return nil
+}
+
+// withSecretRefs returns a copy of cfg for writing to disk with externally
+// sourced values replaced by their original references. A value changed
+// since load (e.g. via the configure endpoint) is written inline instead.
+func (cfg *Config) withSecretRefs() *Config {
+	out := *cfg
+	out.Services = copyServices(cfg.Services)
+
+	if ref, ok := cfg.secretRefs["auth_token"]; ok {
+		if cfg.AuthToken == ref.resolved {
+			out.AuthToken = ref.raw
+			if ref.fileKey != "" {
+				out.AuthToken = ""
+			}
+		} else {
+			out.AuthTokenFile = ""
+		}
+	}
+
+	if ref, ok := cfg.secretRefs["events.ingest_secret"]; ok && cfg.Events.IngestSecret == ref.resolved {
+		out.Events.IngestSecret = ref.raw
+	}
+
+	out.Tokens = slices.Clone(cfg.Tokens)
+	for i := range out.Tokens {
+		if ref, ok := cfg.secretRefs[tokenField(i)]; ok && out.Tokens[i].Token == ref.resolved {
+			out.Tokens[i].Token = ref.raw
+		}
+	}
+
+	out.Notifications.Webhooks = copyWebhooks(cfg.Notifications.Webhooks)
+	for i := range out.Notifications.Webhooks {
+		hook := &out.Notifications.Webhooks[i]
+		prefix := webhookField(i)
+		restore := func(field string, value *string) {
+			if ref, ok := cfg.secretRefs[field]; ok && *value == ref.resolved {
+				*value = ref.raw
+			}
+		}
+		restore(prefix+".url", &hook.URL)
+		restore(prefix+".secret", &hook.Secret)
+		for name, value := range hook.Headers {
+			restore(prefix+".headers."+name, &value)
+			hook.Headers[name] = value
+		}
+	}
+
+	for pluginID, values := range out.Services {
+		for name, value := range values {
+			ref, ok := cfg.secretRefs["services."+pluginID+"."+name]
+			if !ok || value != ref.resolved {
+				continue
+			}
+			if ref.fileKey != "" {
+				delete(values, name)
+				values[ref.fileKey] = ref.raw
+			} else {
+				values[name] = ref.raw
+			}
+		}
+	}
+	return &out
+}
+
+func copyWebhooks(hooks []WebhookConfig) []WebhookConfig {
+	if hooks == nil {
+		return nil
+	}
+	out := make([]WebhookConfig, len(hooks))
+	for i, h := range hooks {
+		out[i] = h
+		if h.Headers != nil {
+			out[i].Headers = make(map[string]string, len(h.Headers))
+			for k, v := range h.Headers {
+				out[i].Headers[k] = v
+			}
+		}
+	}
+	return out
+}
+
+func copyServices(services map[string]map[string]string) map[string]map[string]string {
+	if services == nil {
+		return nil
+	}
+	out := make(map[string]map[string]string, len(services))
+	for pluginID, values := range services {
+		copied := make(map[string]string, len(values))
+		for name, value := range values {
+			copied[name] = value
+		}
+		out[pluginID] = copied
+	}
+	return out
+}
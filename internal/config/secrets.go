@@ -0,0 +1,441 @@
+package config
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/neur0map/deskmon-agent/internal/hostfs"
+)
+
+// encryptedPrefix marks a config value sealed with AES-256-GCM. The rest is
+// base64(nonce || ciphertext).
+const encryptedPrefix = "enc:v1:"
+
+// machineIDPaths are tried in order when no secret_key_file is configured.
+// The host root (Docker installs) is checked first so the key matches the
+// host, not the container.
+var machineIDPaths = []string{"/etc/machine-id", "/var/lib/dbus/machine-id"}
+
+// IsSecretKey reports whether a service setting name holds a credential.
+// Such values are encrypted on save (when enabled) and never logged.
+// "<name>_file" settings hold a path, not the secret itself.
+func IsSecretKey(name string) bool {
+	if strings.HasSuffix(name, fileSuffix) {
+		return false
+	}
+	lower := strings.ToLower(name)
+	for _, marker := range []string{"password", "token", "secret", "apikey", "api_key"} {
+		if strings.Contains(lower, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsEncrypted reports whether value is an encrypted config value.
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, encryptedPrefix)
+}
+
+// secretKey derives the 32-byte encryption key from secret_key_file, or
+// from the machine ID when no keyfile is configured.
+func (cfg *Config) secretKey() ([]byte, error) {
+	var material []byte
+	if cfg.SecretKeyFile != "" {
+		data, err := os.ReadFile(cfg.SecretKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading secret_key_file: %w", err)
+		}
+		material = data
+	} else {
+		material = readMachineID()
+		if material == nil {
+			return nil, errors.New("no machine-id found; set secret_key_file to encrypt secrets")
+		}
+	}
+
+	material = []byte(strings.TrimSpace(string(material)))
+	if len(material) == 0 {
+		return nil, errors.New("secret key material is empty")
+	}
+	sum := sha256.Sum256(append([]byte("deskmon-agent/secrets/v1\x00"), material...))
+	return sum[:], nil
+}
+
+func readMachineID() []byte {
+	var candidates []string
+	if hostfs.Containerized() {
+		candidates = append(candidates, hostfs.Etc("machine-id"), hostfs.Path("/var/lib/dbus/machine-id"))
+	}
+	candidates = append(candidates, machineIDPaths...)
+
+	for _, p := range candidates {
+		if data, err := os.ReadFile(p); err == nil && len(strings.TrimSpace(string(data))) > 0 {
+			return data
+		}
+	}
+	return nil
+}
+
+func encryptValue(key []byte, plain string) (string, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(plain), nil)
+	return encryptedPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func decryptValue(key []byte, value string) (string, error) {
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, encryptedPrefix))
+	if err != nil {
+		return "", fmt.Errorf("malformed encrypted value: %w", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+	if len(raw) < gcm.NonceSize() {
+		return "", errors.New("malformed encrypted value: too short")
+	}
+	plain, err := gcm.Open(nil, raw[:gcm.NonceSize()], raw[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", errors.New("cannot decrypt value (machine-id or secret_key_file changed?)")
+	}
+	return string(plain), nil
+}
+
+// decryptSecrets replaces encrypted values with their plaintext in memory.
+// Plaintext values are left alone so existing configs keep working; they
+// are encrypted the next time the config is saved with encrypt_secrets.
+func (cfg *Config) decryptSecrets() error {
+	var key []byte
+	decrypt := func(field, value string, secret bool) (string, error) {
+		if !IsEncrypted(value) {
+			if value != "" && secret && !isEnvRef(value) {
+				cfg.plaintextSecrets = true
+			}
+			return value, nil
+		}
+		if key == nil {
+			k, err := cfg.secretKey()
+			if err != nil {
+				return "", fmt.Errorf("%s: %w", field, err)
+			}
+			key = k
+		}
+		plain, err := decryptValue(key, value)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", field, err)
+		}
+		return plain, nil
+	}
+
+	var err error
+	if cfg.AuthToken, err = decrypt("auth_token", cfg.AuthToken, true); err != nil {
+		return err
+	}
+	for i := range cfg.Tokens {
+		t := &cfg.Tokens[i]
+		if t.Token, err = decrypt(tokenField(i), t.Token, true); err != nil {
+			return err
+		}
+	}
+	if cfg.Events.IngestSecret, err = decrypt("events.ingest_secret", cfg.Events.IngestSecret, true); err != nil {
+		return err
+	}
+	if cfg.ServiceHTTP.Proxy, err = decrypt("service_http.proxy", cfg.ServiceHTTP.Proxy, hasUserinfo(cfg.ServiceHTTP.Proxy)); err != nil {
+		return err
+	}
+	// Webhook URLs often carry the token in their path or query.
+	for i := range cfg.Notifications.Webhooks {
+		hook := &cfg.Notifications.Webhooks[i]
+		prefix := webhookField(i)
+		if hook.URL, err = decrypt(prefix+".url", hook.URL, true); err != nil {
+			return err
+		}
+		if hook.Secret, err = decrypt(prefix+".secret", hook.Secret, true); err != nil {
+			return err
+		}
+		for name, value := range hook.Headers {
+			if hook.Headers[name], err = decrypt(prefix+".headers."+name, value, true); err != nil {
+				return err
+			}
+		}
+	}
+	for pluginID, values := range cfg.Services {
+		for name, value := range values {
+			plain, err := decrypt("services."+pluginID+"."+name, value, IsSecretKey(name))
+			if err != nil {
+				return err
+			}
+			values[name] = plain
+		}
+	}
+	return nil
+}
+
+// NeedsEncryption reports whether encrypt_secrets is on but the loaded file
+// still holds plaintext credentials, i.e. it should be re-saved.
+func (cfg *Config) NeedsEncryption() bool {
+	return cfg.EncryptSecrets && cfg.plaintextSecrets
+}
+
+// EncryptFile encrypts the plaintext credentials in the config file at path
+// in place, keeping its comments and layout, and reports whether it wrote
+// anything. Run it at startup when NeedsEncryption is true; unlike Save it
+// leaves a file with nothing to encrypt untouched.
+func (cfg *Config) EncryptFile(path string) (bool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false, err
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return false, err
+	}
+	if len(doc.Content) == 0 {
+		return false, nil
+	}
+	key, err := cfg.secretKey()
+	if err != nil {
+		return false, err
+	}
+
+	changed := false
+	seal := func(n *yaml.Node) error {
+		if n == nil || n.Kind != yaml.ScalarNode || n.Value == "" || IsEncrypted(n.Value) || isEnvRef(n.Value) {
+			return nil
+		}
+		enc, err := encryptValue(key, n.Value)
+		if err != nil {
+			return err
+		}
+		n.Value, n.Style, n.Tag = enc, yaml.DoubleQuotedStyle, "!!str"
+		changed = true
+		return nil
+	}
+
+	root := doc.Content[0]
+	var errs []error
+	errs = append(errs, seal(mappingValue(root, "auth_token")))
+	for _, t := range sequenceItems(mappingValue(root, "tokens")) {
+		errs = append(errs, seal(mappingValue(t, "token")))
+	}
+	errs = append(errs, seal(mappingValue(mappingValue(root, "events"), "ingest_secret")))
+	if proxy := mappingValue(mappingValue(root, "service_http"), "proxy"); proxy != nil && hasUserinfo(proxy.Value) {
+		errs = append(errs, seal(proxy))
+	}
+	for _, hook := range sequenceItems(mappingValue(mappingValue(root, "notifications"), "webhooks")) {
+		errs = append(errs, seal(mappingValue(hook, "url")), seal(mappingValue(hook, "secret")))
+		for _, kv := range mappingPairs(mappingValue(hook, "headers")) {
+			errs = append(errs, seal(kv[1]))
+		}
+	}
+	for _, plugin := range mappingPairs(mappingValue(root, "services")) {
+		for _, kv := range mappingPairs(plugin[1]) {
+			if IsSecretKey(kv[0].Value) {
+				errs = append(errs, seal(kv[1]))
+			}
+		}
+	}
+	if err := errors.Join(errs...); err != nil || !changed {
+		return false, err
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return false, err
+	}
+	if err := enc.Close(); err != nil {
+		return false, err
+	}
+	return true, os.WriteFile(path, buf.Bytes(), 0600)
+}
+
+// mappingPairs returns the key and value nodes of a YAML mapping.
+func mappingPairs(n *yaml.Node) [][2]*yaml.Node {
+	if n == nil || n.Kind != yaml.MappingNode {
+		return nil
+	}
+	var pairs [][2]*yaml.Node
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		pairs = append(pairs, [2]*yaml.Node{n.Content[i], n.Content[i+1]})
+	}
+	return pairs
+}
+
+// mappingValue returns the value node for key in a YAML mapping, or nil.
+func mappingValue(n *yaml.Node, key string) *yaml.Node {
+	for _, kv := range mappingPairs(n) {
+		if kv[0].Value == key {
+			return kv[1]
+		}
+	}
+	return nil
+}
+
+// sequenceItems returns the items of a YAML sequence.
+func sequenceItems(n *yaml.Node) []*yaml.Node {
+	if n == nil || n.Kind != yaml.SequenceNode {
+		return nil
+	}
+	return n.Content
+}
+
+// encryptedCopy returns a copy of cfg with credentials encrypted, for
+// writing to disk. cfg itself keeps the plaintext.
+func (cfg *Config) encryptedCopy() (*Config, error) {
+	key, err := cfg.secretKey()
+	if err != nil {
+		return nil, err
+	}
+
+	// seal encrypts *value unless it is empty, already encrypted or a
+	// "${VAR}" reference.
+	seal := func(value *string) error {
+		if *value == "" || IsEncrypted(*value) || isEnvRef(*value) {
+			return nil
+		}
+		*value, err = encryptValue(key, *value)
+		return err
+	}
+
+	out := *cfg
+	if err := seal(&out.AuthToken); err != nil {
+		return nil, err
+	}
+	out.Tokens = slices.Clone(cfg.Tokens)
+	for i := range out.Tokens {
+		if err := seal(&out.Tokens[i].Token); err != nil {
+			return nil, err
+		}
+	}
+	if err := seal(&out.Events.IngestSecret); err != nil {
+		return nil, err
+	}
+	// A proxy URL is only a secret when it carries credentials.
+	if hasUserinfo(out.ServiceHTTP.Proxy) {
+		if err := seal(&out.ServiceHTTP.Proxy); err != nil {
+			return nil, err
+		}
+	}
+	out.Notifications.Webhooks = copyWebhooks(cfg.Notifications.Webhooks)
+	for i := range out.Notifications.Webhooks {
+		hook := &out.Notifications.Webhooks[i]
+		if err := seal(&hook.URL); err != nil {
+			return nil, err
+		}
+		if err := seal(&hook.Secret); err != nil {
+			return nil, err
+		}
+		for name, value := range hook.Headers {
+			if err := seal(&value); err != nil {
+				return nil, err
+			}
+			hook.Headers[name] = value
+		}
+	}
+	out.Services = copyServices(cfg.Services)
+	for _, values := range out.Services {
+		for name, value := range values {
+			if !IsSecretKey(name) {
+				continue
+			}
+			if err := seal(&value); err != nil {
+				return nil, err
+			}
+			values[name] = value
+		}
+	}
+	return &out, nil
+}
+
+// redactedValue replaces credentials in Redacted output.
+const redactedValue = "[redacted]"
+
+// Redacted returns a copy of cfg with the auth tokens, ingest secret,
+// webhook and proxy credentials and service credentials replaced, for
+// diagnostics that may be shared.
+func (cfg *Config) Redacted() *Config {
+	out := *cfg
+	if out.AuthToken != "" {
+		out.AuthToken = redactedValue
+	}
+	out.Tokens = slices.Clone(cfg.Tokens)
+	for i := range out.Tokens {
+		out.Tokens[i].Token = redactedValue
+	}
+	if out.Events.IngestSecret != "" {
+		out.Events.IngestSecret = redactedValue
+	}
+	out.ServiceHTTP.Proxy = redactURL(cfg.ServiceHTTP.Proxy)
+	out.Notifications.Webhooks = copyWebhooks(cfg.Notifications.Webhooks)
+	for i := range out.Notifications.Webhooks {
+		hook := &out.Notifications.Webhooks[i]
+		hook.URL = redactURL(hook.URL)
+		if hook.Secret != "" {
+			hook.Secret = redactedValue
+		}
+		for name := range hook.Headers {
+			hook.Headers[name] = redactedValue
+		}
+	}
+	out.Services = copyServices(cfg.Services)
+	for _, values := range out.Services {
+		for name, value := range values {
+			if IsSecretKey(name) && value != "" {
+				values[name] = redactedValue
+			}
+		}
+	}
+	return &out
+}
+
+// hasUserinfo reports whether raw is a URL with a user or password.
+func hasUserinfo(raw string) bool {
+	u, err := url.Parse(raw)
+	return err == nil && u.User != nil
+}
+
+// redactURL keeps a webhook URL's scheme and host but drops the path and
+// query, where services like Slack and Discord put the token.
+func redactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		if raw == "" {
+			return ""
+		}
+		return redactedValue
+	}
+	if u.Path == "" && u.RawQuery == "" && u.User == nil {
+		return raw
+	}
+	return u.Scheme + "://" + u.Host + "/" + redactedValue
+}
@@ -0,0 +1,248 @@
+// Package custom holds user-defined metrics pushed by local scripts (POST
+// /custom-metrics). Each metric expires after its TTL unless pushed again,
+// so a dead cron job shows up as a missing metric rather than a stale one.
+package custom
+
+import (
+	"fmt"
+	"maps"
+	"math"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/neur0map/deskmon-agent/internal/collector"
+)
+
+// Metric types.
+const (
+	TypeGauge   = "gauge"   // value replaces the previous one
+	TypeCounter = "counter" // value is added to the previous one
+)
+
+const (
+	DefaultTTL = 10 * time.Minute
+	MaxTTL     = 7 * 24 * time.Hour
+	maxMetrics = 1000
+	maxLabels  = 10
+)
+
+var namePattern = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+
+// ReservedPrefix starts the names of the agent's own /metrics series. A
+// custom metric under it would repeat their HELP and TYPE lines, which
+// fails the whole scrape.
+const ReservedPrefix = "deskmon_"
+
+// Metric is one named value, optionally distinguished by labels.
+type Metric struct {
+	Name      string            `json:"name"`
+	Type      string            `json:"type"`
+	Value     float64           `json:"value"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	Help      string            `json:"help,omitempty"`
+	Source    string            `json:"source"` // "push", or where it was read from
+	UpdatedAt time.Time         `json:"updatedAt"`
+	ExpiresAt time.Time         `json:"expiresAt"`
+}
+
+// Key identifies a series: name plus sorted labels.
+func (m Metric) Key() string {
+	if len(m.Labels) == 0 {
+		return m.Name
+	}
+	var b strings.Builder
+	b.WriteString(m.Name)
+	for _, k := range slices.Sorted(maps.Keys(m.Labels)) {
+		fmt.Fprintf(&b, ",%s=%s", k, m.Labels[k])
+	}
+	return b.String()
+}
+
+// Validate checks the name, type and labels, filling in the default type.
+func (m *Metric) Validate() error {
+	if !namePattern.MatchString(m.Name) {
+		return fmt.Errorf("invalid metric name %q (letters, digits, _ and :)", m.Name)
+	}
+	if strings.HasPrefix(m.Name, ReservedPrefix) {
+		return fmt.Errorf("%s: the %s prefix is reserved for the agent's own metrics", m.Name, ReservedPrefix)
+	}
+	if math.IsNaN(m.Value) || math.IsInf(m.Value, 0) {
+		return fmt.Errorf("%s: value must be a finite number", m.Name)
+	}
+	switch m.Type {
+	case "":
+		m.Type = TypeGauge
+	case TypeGauge:
+	case TypeCounter:
+		if m.Value < 0 {
+			return fmt.Errorf("%s: counter increments must not be negative", m.Name)
+		}
+	default:
+		return fmt.Errorf("%s: unknown type %q (gauge or counter)", m.Name, m.Type)
+	}
+	if len(m.Labels) > maxLabels {
+		return fmt.Errorf("%s: at most %d labels", m.Name, maxLabels)
+	}
+	for k := range m.Labels {
+		if !namePattern.MatchString(k) || strings.HasPrefix(k, "__") {
+			return fmt.Errorf("%s: invalid label name %q", m.Name, k)
+		}
+	}
+	return nil
+}
+
+// Store keeps the live custom metrics and broadcasts the full set whenever
+// it changes.
+type Store struct {
+	mu      sync.Mutex
+	metrics map[string]*Metric
+	stopCh  chan struct{}
+
+	Broadcast *collector.Broadcaster[[]Metric]
+}
+
+func NewStore() *Store {
+	return &Store{
+		metrics:   make(map[string]*Metric),
+		stopCh:    make(chan struct{}),
+		Broadcast: collector.NewBroadcaster[[]Metric](),
+	}
+}
+
+// Start expires metrics past their TTL, checking every 10 seconds.
+func (s *Store) Start() {
+	go func() {
+		ticker := time.NewTicker(10 * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if s.expire(time.Now()) {
+					s.Broadcast.Send(s.List())
+				}
+			case <-s.stopCh:
+				return
+			}
+		}
+	}()
+}
+
+func (s *Store) Stop() {
+	close(s.stopCh)
+}
+
+// Push validates and stores metrics, all or nothing. ttl applies to every
+// metric in the batch.
+func (s *Store) Push(source string, ttl time.Duration, metrics []Metric) error {
+	for i := range metrics {
+		if err := metrics[i].Validate(); err != nil {
+			return err
+		}
+	}
+
+	now := time.Now()
+	s.mu.Lock()
+	for _, m := range metrics {
+		key := m.Key()
+		existing, ok := s.metrics[key]
+		if !ok && len(s.metrics) >= maxMetrics {
+			s.mu.Unlock()
+			return fmt.Errorf("too many custom metrics (max %d)", maxMetrics)
+		}
+		if ok && existing.Type == TypeCounter && m.Type == TypeCounter {
+			m.Value += existing.Value
+		}
+		m.Source = source
+		m.UpdatedAt = now
+		m.ExpiresAt = now.Add(ttl)
+		s.metrics[key] = &m
+	}
+	s.mu.Unlock()
+
+	s.Broadcast.Send(s.List())
+	return nil
+}
+
+// Replace swaps every metric from source for metrics, which are stored as
+// given: counters are absolute values here, not increments. An empty list
+// removes the source's metrics. Subscribers are only notified when a value
+// changed, not when a re-read merely extends the TTL.
+func (s *Store) Replace(source string, ttl time.Duration, metrics []Metric) error {
+	for i := range metrics {
+		if err := metrics[i].Validate(); err != nil {
+			return err
+		}
+	}
+
+	now := time.Now()
+	s.mu.Lock()
+	kept := 0
+	for _, m := range s.metrics {
+		if m.Source != source {
+			kept++
+		}
+	}
+	if kept+len(metrics) > maxMetrics {
+		s.mu.Unlock()
+		return fmt.Errorf("too many custom metrics (max %d)", maxMetrics)
+	}
+	previous := make(map[string]*Metric)
+	for key, m := range s.metrics {
+		if m.Source == source {
+			previous[key] = m
+			delete(s.metrics, key)
+		}
+	}
+	changed := len(previous) != len(metrics)
+	for _, m := range metrics {
+		key := m.Key()
+		if old, ok := previous[key]; !ok || old.Value != m.Value || old.Type != m.Type || old.Help != m.Help {
+			changed = true
+		}
+		m.Source = source
+		m.UpdatedAt = now
+		m.ExpiresAt = now.Add(ttl)
+		s.metrics[key] = &m
+	}
+	s.mu.Unlock()
+
+	if changed {
+		s.Broadcast.Send(s.List())
+	}
+	return nil
+}
+
+// List returns the live metrics sorted by name, then labels.
+func (s *Store) List() []Metric {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := make([]Metric, 0, len(s.metrics))
+	for _, m := range s.metrics {
+		if now.Before(m.ExpiresAt) {
+			result = append(result, *m)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Key() < result[j].Key() })
+	return result
+}
+
+// expire drops metrics past their TTL and reports whether any were removed.
+func (s *Store) expire(now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	removed := false
+	for key, m := range s.metrics {
+		if !now.Before(m.ExpiresAt) {
+			delete(s.metrics, key)
+			removed = true
+		}
+	}
+	return removed
+}
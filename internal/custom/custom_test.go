@@ -0,0 +1,100 @@
+package custom
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetricValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		metric  Metric
+		wantErr string // substring, empty for valid
+	}{
+		{"gauge", Metric{Name: "backup_age_seconds", Value: 3600}, ""},
+		{"counter", Metric{Name: "jobs:total", Type: TypeCounter, Value: 1}, ""},
+		{"labels", Metric{Name: "ups_load", Labels: map[string]string{"ups": "a", "site": "home"}}, ""},
+		{"empty name", Metric{Name: ""}, "invalid metric name"},
+		{"leading digit", Metric{Name: "1x"}, "invalid metric name"},
+		{"dash", Metric{Name: "backup-age"}, "invalid metric name"},
+		{"reserved prefix", Metric{Name: "deskmon_cpu_usage_percent"}, "reserved"},
+		{"NaN", Metric{Name: "x", Value: math.NaN()}, "finite"},
+		{"infinite", Metric{Name: "x", Value: math.Inf(1)}, "finite"},
+		{"negative counter", Metric{Name: "x", Type: TypeCounter, Value: -1}, "negative"},
+		{"unknown type", Metric{Name: "x", Type: "histogram"}, "unknown type"},
+		{"bad label", Metric{Name: "x", Labels: map[string]string{"a-b": "1"}}, "invalid label"},
+		{"reserved label", Metric{Name: "x", Labels: map[string]string{"__name__": "y"}}, "invalid label"},
+		{"too many labels", Metric{Name: "x", Labels: map[string]string{
+			"a": "", "b": "", "c": "", "d": "", "e": "", "f": "", "g": "", "h": "", "i": "", "j": "", "k": "",
+		}}, "at most 10 labels"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := tt.metric
+			err := m.Validate()
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("Validate() = %v, want nil", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Errorf("Validate() = %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	m := Metric{Name: "x"}
+	if err := m.Validate(); err != nil || m.Type != TypeGauge {
+		t.Errorf("Validate() left type %q (err %v), want gauge", m.Type, err)
+	}
+}
+
+func TestStorePush(t *testing.T) {
+	tests := []struct {
+		name    string
+		batches [][]Metric // pushed in order from one source
+		want    float64    // value of "x" afterwards
+		wantErr bool       // for the last batch
+	}{
+		{"gauge replaces", [][]Metric{{{Name: "x", Value: 5}}, {{Name: "x", Value: 2}}}, 2, false},
+		{"counter adds", [][]Metric{{{Name: "x", Type: TypeCounter, Value: 5}}, {{Name: "x", Type: TypeCounter, Value: 2}}}, 7, false},
+		{"counter after gauge restarts", [][]Metric{{{Name: "x", Value: 5}}, {{Name: "x", Type: TypeCounter, Value: 2}}}, 2, false},
+		{"invalid batch stores nothing", [][]Metric{{{Name: "x", Value: 5}}, {{Name: "x", Value: 9}, {Name: "bad-name"}}}, 5, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewStore()
+			var err error
+			for _, batch := range tt.batches {
+				err = s.Push("test", time.Minute, batch)
+			}
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("last Push error = %v, want error %v", err, tt.wantErr)
+			}
+			list := s.List()
+			if len(list) != 1 || list[0].Value != tt.want {
+				t.Errorf("metrics = %+v, want x = %g", list, tt.want)
+			}
+		})
+	}
+}
+
+func TestStoreExpires(t *testing.T) {
+	s := NewStore()
+	if err := s.Push("test", time.Minute, []Metric{{Name: "short"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Push("test", time.Hour, []Metric{{Name: "long"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if s.expire(time.Now()) {
+		t.Error("expired metrics before their TTL")
+	}
+	if !s.expire(time.Now().Add(2 * time.Minute)) {
+		t.Error("nothing expired after the short TTL")
+	}
+	if list := s.List(); len(list) != 1 || list[0].Name != "long" {
+		t.Errorf("metrics = %+v, want only long", list)
+	}
+}
@@ -0,0 +1,264 @@
+package custom
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	textfileInterval = 15 * time.Second
+	// Metrics outlive a few missed scans, then expire like a stale push.
+	textfileTTL     = 3 * textfileInterval
+	maxTextfileSize = 1 << 20
+)
+
+// TextfileCollector merges metrics from *.prom (Prometheus text format) and
+// *.json files in a directory, like node_exporter's textfile collector.
+// Writers should create the file under a temporary name and rename it into
+// place so a half-written file is never read.
+type TextfileCollector struct {
+	dir     string
+	store   *Store
+	sources map[string]bool   // sources stored by the previous scan
+	errors  map[string]string // last logged error per file
+	stopCh  chan struct{}
+}
+
+func NewTextfileCollector(dir string, store *Store) *TextfileCollector {
+	return &TextfileCollector{
+		dir:     dir,
+		store:   store,
+		sources: make(map[string]bool),
+		errors:  make(map[string]string),
+		stopCh:  make(chan struct{}),
+	}
+}
+
+func (tc *TextfileCollector) Start() {
+	log.Printf("textfile: reading metrics from %s", tc.dir)
+	go func() {
+		tc.scan()
+		ticker := time.NewTicker(textfileInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				tc.scan()
+			case <-tc.stopCh:
+				return
+			}
+		}
+	}()
+}
+
+func (tc *TextfileCollector) Stop() {
+	close(tc.stopCh)
+}
+
+func (tc *TextfileCollector) scan() {
+	var files []string
+	for _, pattern := range []string{"*.prom", "*.json"} {
+		matches, _ := filepath.Glob(filepath.Join(tc.dir, pattern))
+		files = append(files, matches...)
+	}
+
+	seen := make(map[string]bool, len(files))
+	for _, path := range files {
+		name := filepath.Base(path)
+		source := "textfile:" + name
+		metrics, err := readTextfile(path)
+		if err == nil {
+			err = tc.store.Replace(source, textfileTTL, metrics)
+		}
+		if err != nil {
+			// Keep the previous values; they expire if the file stays broken.
+			if tc.errors[name] != err.Error() {
+				log.Printf("textfile: %s: %v", name, err)
+				tc.errors[name] = err.Error()
+			}
+			seen[source] = tc.sources[source]
+			continue
+		}
+		delete(tc.errors, name)
+		seen[source] = true
+	}
+
+	for source := range tc.sources {
+		if !seen[source] {
+			tc.store.Replace(source, 0, nil)
+		}
+	}
+	tc.sources = seen
+}
+
+func readTextfile(path string) ([]Metric, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() > maxTextfileSize {
+		return nil, fmt.Errorf("file larger than %d bytes", maxTextfileSize)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasSuffix(path, ".json") {
+		return parseJSONMetrics(data)
+	}
+	return parsePromText(data)
+}
+
+// parseJSONMetrics accepts the POST /custom-metrics batch shape
+// ({"metrics": [...]}) or a bare array of metrics.
+func parseJSONMetrics(data []byte) ([]Metric, error) {
+	data = bytes.TrimSpace(data)
+	var metrics []Metric
+	if len(data) > 0 && data[0] == '[' {
+		if err := json.Unmarshal(data, &metrics); err != nil {
+			return nil, err
+		}
+		return metrics, nil
+	}
+	var batch struct {
+		Metrics []Metric `json:"metrics"`
+	}
+	if err := json.Unmarshal(data, &batch); err != nil {
+		return nil, err
+	}
+	return batch.Metrics, nil
+}
+
+// parsePromText parses the Prometheus text exposition format. HELP and TYPE
+// comments are applied to the samples that follow; summary and histogram
+// series are stored as plain gauges. Timestamps are ignored, as are NaN and
+// infinite values, which JSON clients cannot represent.
+func parsePromText(data []byte) ([]Metric, error) {
+	help := make(map[string]string)
+	types := make(map[string]string)
+	var metrics []Metric
+
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for lineNo := 1; sc.Scan(); lineNo++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			fields := strings.SplitN(line, " ", 4)
+			if len(fields) >= 3 && fields[1] == "HELP" {
+				if len(fields) == 4 {
+					help[fields[2]] = fields[3]
+				}
+			} else if len(fields) == 4 && fields[1] == "TYPE" {
+				types[fields[2]] = fields[3]
+			}
+			continue
+		}
+
+		m, err := parsePromSample(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNo, err)
+		}
+		if math.IsNaN(m.Value) || math.IsInf(m.Value, 0) {
+			continue
+		}
+		m.Help = help[m.Name]
+		if types[m.Name] == "counter" {
+			m.Type = TypeCounter
+		} else {
+			m.Type = TypeGauge
+		}
+		metrics = append(metrics, m)
+	}
+	return metrics, sc.Err()
+}
+
+// parsePromSample parses `name{label="value",...} value [timestamp]`.
+func parsePromSample(line string) (Metric, error) {
+	var m Metric
+	end := strings.IndexAny(line, "{ \t")
+	if end <= 0 {
+		return m, errors.New("missing value")
+	}
+	m.Name = line[:end]
+	rest := line[end:]
+
+	if rest[0] == '{' {
+		labels, n, err := parsePromLabels(rest[1:])
+		if err != nil {
+			return m, err
+		}
+		m.Labels = labels
+		rest = rest[1+n:]
+	}
+
+	fields := strings.Fields(rest)
+	if len(fields) == 0 || len(fields) > 2 {
+		return m, errors.New("expected a value and optional timestamp")
+	}
+	v, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return m, fmt.Errorf("invalid value %q", fields[0])
+	}
+	m.Value = v
+	return m, nil
+}
+
+// parsePromLabels parses label pairs up to and including the closing brace,
+// returning the number of bytes consumed.
+func parsePromLabels(s string) (map[string]string, int, error) {
+	labels := make(map[string]string)
+	i := 0
+	for {
+		for i < len(s) && (s[i] == ' ' || s[i] == ',') {
+			i++
+		}
+		if i < len(s) && s[i] == '}' {
+			if len(labels) == 0 {
+				labels = nil
+			}
+			return labels, i + 1, nil
+		}
+
+		eq := strings.IndexByte(s[i:], '=')
+		if eq < 0 || eq+i+1 >= len(s) || s[i+eq+1] != '"' {
+			return nil, 0, errors.New("malformed labels")
+		}
+		name := strings.TrimSpace(s[i : i+eq])
+		i += eq + 2
+
+		var value strings.Builder
+		for {
+			if i >= len(s) {
+				return nil, 0, errors.New("unterminated label value")
+			}
+			c := s[i]
+			i++
+			if c == '"' {
+				break
+			}
+			if c == '\\' && i < len(s) {
+				switch s[i] {
+				case 'n':
+					c = '\n'
+				default:
+					c = s[i]
+				}
+				i++
+			}
+			value.WriteByte(c)
+		}
+		labels[name] = value.String()
+	}
+}
@@ -0,0 +1,149 @@
+// Package deskmonpb holds the messages of the agent's gRPC API
+// (deskmon.proto) and a codec for them. The types are written by hand
+// rather than generated, so the agent builds without protoc; each field's
+// pb tag is its field number in the schema.
+package deskmonpb
+
+// ServiceName is the fully qualified gRPC service name.
+const ServiceName = "deskmon.v1.Deskmon"
+
+type StatsRequest struct{}
+
+type Stats struct {
+	System     *System      `pb:"1"`
+	Containers []*Container `pb:"2"`
+	Services   []*Service   `pb:"3"`
+	Alerts     []*Alert     `pb:"4"`
+}
+
+type System struct {
+	CPUPercent           float64 `pb:"1"`
+	CoreCount            int32   `pb:"2"`
+	Temperature          float64 `pb:"3"`
+	TemperatureAvailable bool    `pb:"4"`
+	MemoryUsedBytes      uint64  `pb:"5"`
+	MemoryTotalBytes     uint64  `pb:"6"`
+	Disks                []*Disk `pb:"7"`
+	DownloadBytesPerSec  float64 `pb:"8"`
+	UploadBytesPerSec    float64 `pb:"9"`
+	UptimeSeconds        int64   `pb:"10"`
+
+	Load1          float64 `pb:"11"`
+	Load5          float64 `pb:"12"`
+	Load15         float64 `pb:"13"`
+	SwapUsedBytes  uint64  `pb:"14"`
+	SwapTotalBytes uint64  `pb:"15"`
+}
+
+type Disk struct {
+	MountPoint string `pb:"1"`
+	Device     string `pb:"2"`
+	FsType     string `pb:"3"`
+	UsedBytes  uint64 `pb:"4"`
+	TotalBytes uint64 `pb:"5"`
+}
+
+type Container struct {
+	ID             string  `pb:"1"`
+	Name           string  `pb:"2"`
+	Image          string  `pb:"3"`
+	Status         string  `pb:"4"`
+	CPUPercent     float64 `pb:"5"`
+	MemoryUsageMB  float64 `pb:"6"`
+	MemoryLimitMB  float64 `pb:"7"`
+	NetworkRxBytes uint64  `pb:"8"`
+	NetworkTxBytes uint64  `pb:"9"`
+	HealthStatus   string  `pb:"10"`
+	RestartCount   int32   `pb:"11"`
+	StartedAt      string  `pb:"12"`
+}
+
+type Service struct {
+	PluginID  string      `pb:"1"`
+	Name      string      `pb:"2"`
+	Icon      string      `pb:"3"`
+	Status    string      `pb:"4"`
+	Summary   []*StatItem `pb:"5"`
+	Error     string      `pb:"6"`
+	URL       string      `pb:"7"`
+	StatsJSON string      `pb:"8"`
+
+	StatusReasonCode string `pb:"9"`
+	StatusReason     string `pb:"10"`
+}
+
+type StatItem struct {
+	Label string `pb:"1"`
+	Value string `pb:"2"`
+	Type  string `pb:"3"`
+}
+
+type Alert struct {
+	ID             string `pb:"1"`
+	Type           string `pb:"2"`
+	Severity       string `pb:"3"`
+	Source         string `pb:"4"`
+	Message        string `pb:"5"`
+	StartedAtUnix  int64  `pb:"6"`
+	UpdatedAtUnix  int64  `pb:"7"`
+	ResolvedAtUnix int64  `pb:"8"`
+}
+
+type StreamRequest struct {
+	Events []string `pb:"1"`
+}
+
+// StatsEvent is a oneof: exactly one field is set.
+type StatsEvent struct {
+	System     *System        `pb:"1"`
+	Containers *ContainerList `pb:"2"`
+	Services   *ServiceList   `pb:"3"`
+	Alert      *Alert         `pb:"4"`
+}
+
+type ContainerList struct {
+	Containers []*Container `pb:"1"`
+}
+
+type ServiceList struct {
+	Services []*Service `pb:"1"`
+}
+
+type ContainerActionType int32
+
+const (
+	ContainerActionUnspecified ContainerActionType = iota
+	ContainerActionStart
+	ContainerActionStop
+	ContainerActionRestart
+)
+
+// String returns the action as the HTTP API names it, or "" when unset.
+func (a ContainerActionType) String() string {
+	switch a {
+	case ContainerActionStart:
+		return "start"
+	case ContainerActionStop:
+		return "stop"
+	case ContainerActionRestart:
+		return "restart"
+	}
+	return ""
+}
+
+type ContainerActionRequest struct {
+	ID     string              `pb:"1"`
+	Action ContainerActionType `pb:"2"`
+}
+
+type ContainerActionResponse struct {
+	Message string `pb:"1"`
+}
+
+type AgentStatusRequest struct{}
+
+type AgentStatus struct {
+	Version  string `pb:"1"`
+	Status   string `pb:"2"`
+	ReadOnly bool   `pb:"3"`
+}
@@ -0,0 +1,251 @@
+package deskmonpb
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"sync"
+)
+
+// Wire types used by the schema.
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+var errTruncated = errors.New("deskmonpb: truncated message")
+
+// Marshal encodes a message (a pointer to one of this package's structs)
+// in the protobuf wire format. Zero scalars are left out as proto3 does;
+// set message pointers are always written, which is what oneof needs.
+func Marshal(m any) ([]byte, error) {
+	v := reflect.ValueOf(m)
+	if v.Kind() != reflect.Pointer || v.Elem().Kind() != reflect.Struct {
+		return nil, fmt.Errorf("deskmonpb: cannot marshal %T", m)
+	}
+	return appendMessage(nil, v.Elem())
+}
+
+// Unmarshal decodes b into the message m points to. Unknown fields are
+// skipped so older agents accept newer clients.
+func Unmarshal(b []byte, m any) error {
+	v := reflect.ValueOf(m)
+	if v.Kind() != reflect.Pointer || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("deskmonpb: cannot unmarshal into %T", m)
+	}
+	return decodeMessage(b, v.Elem())
+}
+
+type fieldInfo struct {
+	num   uint64
+	index int
+}
+
+var fieldCache sync.Map // reflect.Type → []fieldInfo
+
+func fields(t reflect.Type) []fieldInfo {
+	if f, ok := fieldCache.Load(t); ok {
+		return f.([]fieldInfo)
+	}
+	var out []fieldInfo
+	for i := 0; i < t.NumField(); i++ {
+		n, err := strconv.ParseUint(t.Field(i).Tag.Get("pb"), 10, 32)
+		if err != nil || n == 0 {
+			continue
+		}
+		out = append(out, fieldInfo{num: n, index: i})
+	}
+	fieldCache.Store(t, out)
+	return out
+}
+
+func appendMessage(b []byte, v reflect.Value) ([]byte, error) {
+	for _, f := range fields(v.Type()) {
+		var err error
+		if b, err = appendField(b, f.num, v.Field(f.index)); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+func appendTag(b []byte, num uint64, wire int) []byte {
+	return binary.AppendUvarint(b, num<<3|uint64(wire))
+}
+
+func appendField(b []byte, num uint64, v reflect.Value) ([]byte, error) {
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			b = appendTag(b, num, wireVarint)
+			b = append(b, 1)
+		}
+	case reflect.Int32, reflect.Int64:
+		if v.Int() != 0 {
+			b = appendTag(b, num, wireVarint)
+			b = binary.AppendUvarint(b, uint64(v.Int())) // negative values take ten bytes
+		}
+	case reflect.Uint32, reflect.Uint64:
+		if v.Uint() != 0 {
+			b = appendTag(b, num, wireVarint)
+			b = binary.AppendUvarint(b, v.Uint())
+		}
+	case reflect.Float64:
+		if v.Float() != 0 {
+			b = appendTag(b, num, wireFixed64)
+			b = binary.LittleEndian.AppendUint64(b, math.Float64bits(v.Float()))
+		}
+	case reflect.String:
+		if v.Len() > 0 {
+			b = appendTag(b, num, wireBytes)
+			b = binary.AppendUvarint(b, uint64(v.Len()))
+			b = append(b, v.String()...)
+		}
+	case reflect.Pointer:
+		if v.IsNil() {
+			return b, nil
+		}
+		body, err := appendMessage(nil, v.Elem())
+		if err != nil {
+			return nil, err
+		}
+		b = appendTag(b, num, wireBytes)
+		b = binary.AppendUvarint(b, uint64(len(body)))
+		b = append(b, body...)
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			e := v.Index(i)
+			if e.Kind() == reflect.String {
+				// Repeated strings keep empty elements.
+				b = appendTag(b, num, wireBytes)
+				b = binary.AppendUvarint(b, uint64(e.Len()))
+				b = append(b, e.String()...)
+				continue
+			}
+			if e.IsNil() {
+				return nil, fmt.Errorf("deskmonpb: nil element in repeated field %d", num)
+			}
+			var err error
+			if b, err = appendField(b, num, e); err != nil {
+				return nil, err
+			}
+		}
+	default:
+		return nil, fmt.Errorf("deskmonpb: unsupported field type %s", v.Type())
+	}
+	return b, nil
+}
+
+func decodeMessage(b []byte, v reflect.Value) error {
+	fs := fields(v.Type())
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		if n <= 0 {
+			return errTruncated
+		}
+		b = b[n:]
+		num, wire := key>>3, int(key&7)
+
+		var raw uint64
+		var data []byte
+		switch wire {
+		case wireVarint:
+			raw, n = binary.Uvarint(b)
+			if n <= 0 {
+				return errTruncated
+			}
+			b = b[n:]
+		case wireFixed64:
+			if len(b) < 8 {
+				return errTruncated
+			}
+			raw, b = binary.LittleEndian.Uint64(b), b[8:]
+		case wireFixed32:
+			if len(b) < 4 {
+				return errTruncated
+			}
+			raw, b = uint64(binary.LittleEndian.Uint32(b)), b[4:]
+		case wireBytes:
+			l, n := binary.Uvarint(b)
+			if n <= 0 || l > uint64(len(b)-n) {
+				return errTruncated
+			}
+			data, b = b[n:n+int(l)], b[n+int(l):]
+		default:
+			return fmt.Errorf("deskmonpb: unsupported wire type %d", wire)
+		}
+
+		for _, f := range fs {
+			if f.num == num {
+				if err := setField(v.Field(f.index), wire, raw, data); err != nil {
+					return fmt.Errorf("deskmonpb: field %d: %w", num, err)
+				}
+				break
+			}
+		}
+	}
+	return nil
+}
+
+func setField(v reflect.Value, wire int, raw uint64, data []byte) error {
+	want := wireBytes
+	switch v.Kind() {
+	case reflect.Bool, reflect.Int32, reflect.Int64, reflect.Uint32, reflect.Uint64:
+		want = wireVarint
+	case reflect.Float64:
+		want = wireFixed64
+	}
+	if wire != want {
+		return fmt.Errorf("wire type %d for %s", wire, v.Type())
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		v.SetBool(raw != 0)
+	case reflect.Int32:
+		v.SetInt(int64(int32(raw)))
+	case reflect.Int64:
+		v.SetInt(int64(raw))
+	case reflect.Uint32:
+		v.SetUint(uint64(uint32(raw)))
+	case reflect.Uint64:
+		v.SetUint(raw)
+	case reflect.Float64:
+		v.SetFloat(math.Float64frombits(raw))
+	case reflect.String:
+		v.SetString(string(data))
+	case reflect.Pointer:
+		// A message field seen twice is merged, as protobuf specifies.
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return decodeMessage(data, v.Elem())
+	case reflect.Slice:
+		et := v.Type().Elem()
+		if et.Kind() == reflect.String {
+			v.Set(reflect.Append(v, reflect.ValueOf(string(data)).Convert(et)))
+			return nil
+		}
+		e := reflect.New(et.Elem())
+		if err := decodeMessage(data, e.Elem()); err != nil {
+			return err
+		}
+		v.Set(reflect.Append(v, e))
+	default:
+		return fmt.Errorf("unsupported field type %s", v.Type())
+	}
+	return nil
+}
+
+// Codec is a gRPC codec for this package's messages. It is named "proto"
+// so standard protobuf clients talk to it unchanged.
+type Codec struct{}
+
+func (Codec) Marshal(v any) ([]byte, error)      { return Marshal(v) }
+func (Codec) Unmarshal(data []byte, v any) error { return Unmarshal(data, v) }
+func (Codec) Name() string                       { return "proto" }
@@ -0,0 +1,28 @@
+package deskmonpb
+
+import "testing"
+
+func TestMarshalRoundTrip(t *testing.T) {
+	in := &StatsEvent{Containers: &ContainerList{Containers: []*Container{
+		{ID: "a", CPUPercent: 12.5, RestartCount: -1, NetworkRxBytes: 1 << 40},
+		{Name: "b"},
+	}}}
+	b, err := Marshal(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out StatsEvent
+	if err := Unmarshal(b, &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.System != nil || out.Containers == nil || len(out.Containers.Containers) != 2 {
+		t.Fatalf("decoded %+v", out)
+	}
+	c := out.Containers.Containers[0]
+	if c.ID != "a" || c.CPUPercent != 12.5 || c.RestartCount != -1 || c.NetworkRxBytes != 1<<40 {
+		t.Errorf("container = %+v", c)
+	}
+	if out.Containers.Containers[1].Name != "b" {
+		t.Errorf("second container = %+v", out.Containers.Containers[1])
+	}
+}
@@ -0,0 +1,127 @@
+// Package events keeps a bounded, in-memory timeline of notable events so
+// clients can show what happened on the host and when.
+package events
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/neur0map/deskmon-agent/internal/collector"
+)
+
+// Categories group events by origin.
+const (
+	CategoryContainer = "container" // state changes from Docker refreshes
+	CategoryService   = "service"   // services detected, lost or changing status
+	CategoryAlert     = "alert"     // alerts fired and resolved
+	CategoryAgent     = "agent"     // agent start, restart and stop
+	CategoryConfig    = "config"    // settings changed through the API
+	CategoryAuth      = "auth"      // client logins and bans
+	CategoryExternal  = "external"  // pushed via POST /events/ingest
+)
+
+// DefaultCapacity is the number of events the agent keeps.
+const DefaultCapacity = 1000
+
+// Severity levels, matching alert severities.
+const (
+	SeverityInfo     = "info"
+	SeverityWarning  = "warning"
+	SeverityCritical = "critical"
+)
+
+// Event is one entry in the timeline. IDs increase monotonically for the
+// lifetime of the agent process.
+type Event struct {
+	ID       uint64          `json:"id"`
+	At       time.Time       `json:"at"`
+	Category string          `json:"category"`
+	Type     string          `json:"type"` // e.g. "backup.failed"
+	Source   string          `json:"source"`
+	Severity string          `json:"severity"`
+	Message  string          `json:"message,omitempty"`
+	Data     json.RawMessage `json:"data,omitempty"`
+}
+
+// ValidSeverity reports whether s is a known severity level.
+func ValidSeverity(s string) bool {
+	return s == SeverityInfo || s == SeverityWarning || s == SeverityCritical
+}
+
+// Timeline holds the most recent events, dropping the oldest when full.
+type Timeline struct {
+	mu     sync.Mutex
+	buf    []Event
+	start  int
+	n      int
+	nextID uint64
+	stopCh chan struct{}
+
+	Broadcast *collector.Broadcaster[Event]
+}
+
+func NewTimeline(capacity int) *Timeline {
+	return &Timeline{
+		buf:       make([]Event, capacity),
+		nextID:    1,
+		stopCh:    make(chan struct{}),
+		Broadcast: collector.NewBroadcaster[Event](),
+	}
+}
+
+// Stop ends the watchers started by the Watch* methods.
+func (t *Timeline) Stop() {
+	close(t.stopCh)
+}
+
+// Add assigns the event an ID (and a time, if unset), stores it and
+// broadcasts it.
+func (t *Timeline) Add(ev Event) Event {
+	t.mu.Lock()
+	ev.ID = t.nextID
+	t.nextID++
+	if ev.At.IsZero() {
+		ev.At = time.Now()
+	}
+	if ev.Severity == "" {
+		ev.Severity = SeverityInfo
+	}
+	if t.n < len(t.buf) {
+		t.buf[(t.start+t.n)%len(t.buf)] = ev
+		t.n++
+	} else {
+		t.buf[t.start] = ev
+		t.start = (t.start + 1) % len(t.buf)
+	}
+	t.mu.Unlock()
+
+	t.Broadcast.Send(ev)
+	return ev
+}
+
+// LatestID returns the ID of the most recent event, 0 when there is none.
+func (t *Timeline) LatestID() uint64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.nextID - 1
+}
+
+// List returns stored events, oldest first.
+func (t *Timeline) List() []Event {
+	return t.Since(0)
+}
+
+// Since returns stored events with an ID greater than id, oldest first.
+func (t *Timeline) Since(id uint64) []Event {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	out := make([]Event, 0, t.n)
+	for i := 0; i < t.n; i++ {
+		if ev := t.buf[(t.start+i)%len(t.buf)]; ev.ID > id {
+			out = append(out, ev)
+		}
+	}
+	return out
+}
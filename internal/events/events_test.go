@@ -0,0 +1,51 @@
+package events
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestTimelineWraps(t *testing.T) {
+	tests := []struct {
+		name     string
+		capacity int
+		adds     int
+		since    uint64
+		want     []uint64 // IDs returned by Since
+	}{
+		{"empty", 3, 0, 0, []uint64{}},
+		{"not full", 3, 2, 0, []uint64{1, 2}},
+		{"full", 3, 3, 0, []uint64{1, 2, 3}},
+		{"wrapped once", 3, 5, 0, []uint64{3, 4, 5}},
+		{"wrapped twice", 3, 7, 0, []uint64{5, 6, 7}},
+		{"since inside", 3, 5, 3, []uint64{4, 5}},
+		{"since dropped", 3, 5, 1, []uint64{3, 4, 5}},
+		{"since latest", 3, 5, 5, []uint64{}},
+		{"capacity one", 1, 4, 0, []uint64{4}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tl := NewTimeline(tt.capacity)
+			for range tt.adds {
+				tl.Add(Event{Type: "test"})
+			}
+			got := []uint64{}
+			for _, ev := range tl.Since(tt.since) {
+				got = append(got, ev.ID)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Since(%d) = %v, want %v", tt.since, got, tt.want)
+			}
+			if latest := tl.LatestID(); latest != uint64(tt.adds) {
+				t.Errorf("LatestID = %d, want %d", latest, tt.adds)
+			}
+		})
+	}
+}
+
+func TestTimelineAddDefaults(t *testing.T) {
+	ev := NewTimeline(1).Add(Event{Type: "test"})
+	if ev.ID != 1 || ev.At.IsZero() || ev.Severity != SeverityInfo {
+		t.Errorf("Add = %+v, want ID 1, a time and info severity", ev)
+	}
+}
@@ -0,0 +1,209 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/neur0map/deskmon-agent/internal/collector"
+	"github.com/neur0map/deskmon-agent/internal/collector/services"
+	"github.com/neur0map/deskmon-agent/internal/updater"
+)
+
+// WatchContainers records container state changes by comparing each Docker
+// refresh with the previous one, until Stop is called. The first refresh is
+// the baseline and records nothing.
+func (t *Timeline) WatchContainers(b *collector.Broadcaster[[]collector.ContainerStats]) {
+	ch, cleanup := b.Subscribe(2)
+	go func() {
+		defer cleanup()
+		var prev map[string]collector.ContainerStats
+		for {
+			select {
+			case containers := <-ch:
+				cur := make(map[string]collector.ContainerStats, len(containers))
+				for _, c := range containers {
+					cur[c.Name] = c
+				}
+				if prev != nil {
+					for _, ev := range diffContainers(prev, cur) {
+						t.Add(ev)
+					}
+				}
+				prev = cur
+			case <-t.stopCh:
+				return
+			}
+		}
+	}()
+}
+
+// WatchDockerEvents records an entry for each Docker oom event, until Stop
+// is called. Other Docker events are covered by WatchContainers.
+func (t *Timeline) WatchDockerEvents(b *collector.Broadcaster[collector.DockerEvent]) {
+	ch, cleanup := b.Subscribe(16)
+	go func() {
+		defer cleanup()
+		for {
+			select {
+			case ev := <-ch:
+				if ev.Action != "oom" {
+					continue
+				}
+				t.Add(Event{
+					Category: CategoryContainer,
+					Type:     "container.oom",
+					Source:   "container:" + ev.Name,
+					Severity: SeverityWarning,
+					Message:  fmt.Sprintf("%s was killed by the OOM killer", ev.Name),
+				})
+			case <-t.stopCh:
+				return
+			}
+		}
+	}()
+}
+
+func diffContainers(prev, cur map[string]collector.ContainerStats) []Event {
+	var out []Event
+	add := func(name, typ, severity, msg string) {
+		out = append(out, Event{
+			Category: CategoryContainer,
+			Type:     typ,
+			Source:   "container:" + name,
+			Severity: severity,
+			Message:  msg,
+		})
+	}
+
+	for name, c := range cur {
+		old, ok := prev[name]
+		switch {
+		case !ok:
+			add(name, "container.created", SeverityInfo, fmt.Sprintf("%s created (%s)", name, c.Image))
+		case c.Status != old.Status && c.Status == "running":
+			add(name, "container.started", SeverityInfo, fmt.Sprintf("%s started", name))
+		case c.Status != old.Status && old.Status == "running":
+			add(name, "container.stopped", SeverityInfo, fmt.Sprintf("%s is now %s", name, c.Status))
+		case c.Status != old.Status:
+			add(name, "container."+c.Status, SeverityInfo, fmt.Sprintf("%s is now %s", name, c.Status))
+		case c.RestartCount > old.RestartCount || c.StartedAt != old.StartedAt && c.Status == "running":
+			add(name, "container.restarted", SeverityInfo, fmt.Sprintf("%s restarted", name))
+		}
+		if ok && c.Image != old.Image {
+			add(name, "container.image_changed", SeverityInfo, fmt.Sprintf("%s now runs %s", name, c.Image))
+		}
+	}
+	for name := range prev {
+		if _, ok := cur[name]; !ok {
+			add(name, "container.removed", SeverityInfo, fmt.Sprintf("%s removed", name))
+		}
+	}
+	return out
+}
+
+// WatchServices records services being detected, lost, or changing status,
+// until Stop is called. The first detection pass is the baseline.
+func (t *Timeline) WatchServices(b *collector.Broadcaster[[]services.ServiceStats]) {
+	ch, cleanup := b.Subscribe(2)
+	go func() {
+		defer cleanup()
+		var prev map[string]services.ServiceStats
+		for {
+			select {
+			case list := <-ch:
+				cur := make(map[string]services.ServiceStats, len(list))
+				for _, s := range list {
+					cur[s.PluginID] = s
+				}
+				if prev != nil {
+					for _, ev := range diffServices(prev, cur) {
+						t.Add(ev)
+					}
+				}
+				prev = cur
+			case <-t.stopCh:
+				return
+			}
+		}
+	}()
+}
+
+func diffServices(prev, cur map[string]services.ServiceStats) []Event {
+	var out []Event
+	add := func(s services.ServiceStats, typ, severity, msg string) {
+		out = append(out, Event{
+			Category: CategoryService,
+			Type:     typ,
+			Source:   "service:" + s.PluginID,
+			Severity: severity,
+			Message:  msg,
+		})
+	}
+
+	for id, s := range cur {
+		old, ok := prev[id]
+		switch {
+		case !ok:
+			add(s, "service.detected", SeverityInfo, fmt.Sprintf("%s detected", s.Name))
+		case s.Status != old.Status && s.Status == "error":
+			add(s, "service.error", SeverityWarning, fmt.Sprintf("%s: %s", s.Name, s.Error))
+		case s.Status != old.Status && s.Status == "unreachable":
+			add(s, "service.unreachable", SeverityWarning, fmt.Sprintf("%s unreachable: %s", s.Name, s.Error))
+		case s.Status != old.Status && s.StatusReason != nil:
+			add(s, "service."+s.Status, SeverityInfo, fmt.Sprintf("%s is now %s: %s", s.Name, s.Status, s.StatusReason.Message))
+		case s.Status != old.Status:
+			add(s, "service."+s.Status, SeverityInfo, fmt.Sprintf("%s is now %s", s.Name, s.Status))
+		}
+	}
+	for id, s := range prev {
+		if _, ok := cur[id]; !ok {
+			add(s, "service.lost", SeverityInfo, fmt.Sprintf("%s is no longer detected", s.Name))
+		}
+	}
+	return out
+}
+
+// WatchUpdates records every auto-update attempt, with the result as data,
+// until Stop is called.
+func (t *Timeline) WatchUpdates(b *collector.Broadcaster[updater.Result]) {
+	ch, cleanup := b.Subscribe(4)
+	go func() {
+		defer cleanup()
+		for {
+			select {
+			case r := <-ch:
+				t.Add(updateEvent(r))
+			case <-t.stopCh:
+				return
+			}
+		}
+	}()
+}
+
+func updateEvent(r updater.Result) Event {
+	ev := Event{
+		At:       r.At,
+		Category: CategoryContainer,
+		Source:   "container:" + r.Container,
+		Severity: SeverityInfo,
+	}
+	switch r.Status {
+	case updater.StatusUpdated:
+		ev.Type = "container.updated"
+		ev.Message = fmt.Sprintf("%s updated to the latest %s", r.Container, r.Image)
+	case updater.StatusUpToDate:
+		ev.Type = "container.up_to_date"
+		ev.Message = fmt.Sprintf("%s is up to date with %s", r.Container, r.Image)
+	case updater.StatusRolledBack:
+		ev.Type, ev.Severity = "container.update_rolled_back", SeverityWarning
+		ev.Message = fmt.Sprintf("%s: update to %s failed, old container restored: %s", r.Container, r.Image, r.Error)
+	case updater.StatusSkipped:
+		ev.Type = "container.update_skipped"
+		ev.Message = fmt.Sprintf("%s not updated: %s", r.Container, r.Error)
+	default:
+		ev.Type, ev.Severity = "container.update_failed", SeverityWarning
+		ev.Message = fmt.Sprintf("%s: update failed: %s", r.Container, r.Error)
+	}
+	ev.Data, _ = json.Marshal(r)
+	return ev
+}
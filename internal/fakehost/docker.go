@@ -0,0 +1,352 @@
+package fakehost
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/go-connections/nat"
+)
+
+// dockerAPIVersion is the Engine API version the mock reports; clients
+// negotiate down to it.
+const dockerAPIVersion = "1.47"
+
+// dockerStarted is the StartedAt of every running container.
+var dockerStarted = time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+// Container is a container served by the mock Docker API.
+type Container struct {
+	ID           string // default: 64 hex digits derived from Name
+	Name         string
+	Image        string
+	State        string      // default "running"
+	Health       string      // healthy, unhealthy or starting; "" without a health check
+	Ports        map[int]int // host port → container port, TCP
+	Labels       map[string]string
+	Mounts       map[string]string // container path → host path, bind mounts
+	RestartCount int
+	CPUPercent   float64 // 100 per fully used core
+	MemoryBytes  uint64
+	MemoryLimit  uint64 // hard limit, 0 for none
+}
+
+// DockerOptions change how the mock Docker API behaves.
+type DockerOptions struct {
+	// Podman makes /version report Podman's Docker-compatible API.
+	Podman bool
+	// Denied container actions (start, stop, restart) are answered with
+	// 403, as docker-socket-proxy does with POST=0.
+	Denied []string
+}
+
+// Docker is a mock Docker Engine API on a local TCP port, serving the calls
+// the agent makes: ping and version, container list, inspect, stats and
+// actions, image inspect, disk usage and the event stream.
+type Docker struct {
+	// Host is the endpoint for collector.NewDockerClient, e.g.
+	// "tcp://127.0.0.1:41234".
+	Host string
+
+	opts DockerOptions
+	srv  *httptest.Server
+	done chan struct{} // closed by Close, ends /events streams
+
+	mu         sync.Mutex
+	containers []Container
+	actions    []string
+}
+
+// versionPrefix matches the API version clients put in front of paths.
+var versionPrefix = regexp.MustCompile(`^/v[0-9.]+/`)
+
+// NewDocker starts a mock Docker API serving containers.
+func NewDocker(opts DockerOptions, containers ...Container) *Docker {
+	d := &Docker{opts: opts, done: make(chan struct{})}
+	for _, c := range containers {
+		if c.ID == "" {
+			sum := sha256.Sum256([]byte(c.Name))
+			c.ID = hex.EncodeToString(sum[:])
+		}
+		if c.State == "" {
+			c.State = "running"
+		}
+		d.containers = append(d.containers, c)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /_ping", d.handlePing)
+	mux.HandleFunc("GET /version", d.handleVersion)
+	mux.HandleFunc("GET /containers/json", d.handleList)
+	mux.HandleFunc("GET /containers/{id}/json", d.handleInspect)
+	mux.HandleFunc("GET /containers/{id}/stats", d.handleStats)
+	mux.HandleFunc("POST /containers/{id}/{action}", d.handleAction)
+	mux.HandleFunc("GET /images/{id}/json", d.handleImage)
+	mux.HandleFunc("GET /system/df", d.handleDiskUsage)
+	mux.HandleFunc("GET /events", d.handleEvents)
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		dockerError(w, http.StatusNotFound, "page not found")
+	})
+	d.srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.URL.Path = versionPrefix.ReplaceAllString(r.URL.Path, "/")
+		mux.ServeHTTP(w, r)
+	}))
+	d.Host = "tcp://" + d.srv.Listener.Addr().String()
+	return d
+}
+
+// Close ends open event streams and shuts the server down.
+func (d *Docker) Close() {
+	close(d.done)
+	d.srv.Close()
+}
+
+// Actions returns the container actions performed so far, as "restart
+// web" with the container's name.
+func (d *Docker) Actions() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return slices.Clone(d.actions)
+}
+
+func dockerError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"message": msg})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// find returns the index of the container with an ID, ID prefix or name.
+// Must be called with d.mu held.
+func (d *Docker) find(ref string) int {
+	ref = strings.TrimPrefix(ref, "/")
+	for i, c := range d.containers {
+		if c.Name == ref || (len(ref) >= 12 && strings.HasPrefix(c.ID, ref)) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (d *Docker) handlePing(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Api-Version", dockerAPIVersion)
+	w.Header().Set("Ostype", "linux")
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte("OK"))
+}
+
+func (d *Docker) handleVersion(w http.ResponseWriter, r *http.Request) {
+	v := types.Version{
+		Version:    "27.3.1",
+		APIVersion: dockerAPIVersion,
+		Os:         "linux",
+		Arch:       "amd64",
+		Components: []types.ComponentVersion{{Name: "Engine", Version: "27.3.1"}},
+	}
+	v.Platform.Name = "Docker Engine - Community"
+	if d.opts.Podman {
+		v.Version = "5.2.2"
+		v.Components = []types.ComponentVersion{{Name: "Podman Engine", Version: "5.2.2"}}
+		v.Platform.Name = "linux/amd64/ubuntu-24.04"
+	}
+	writeJSON(w, http.StatusOK, v)
+}
+
+func (d *Docker) handleList(w http.ResponseWriter, r *http.Request) {
+	all, _ := strconv.ParseBool(r.URL.Query().Get("all"))
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	list := []container.Summary{}
+	for _, c := range d.containers {
+		if !all && c.State != "running" {
+			continue
+		}
+		s := container.Summary{
+			ID:      c.ID,
+			Names:   []string{"/" + c.Name},
+			Image:   c.Image,
+			ImageID: imageID(c.Image),
+			Created: dockerStarted.Unix(),
+			Labels:  c.Labels,
+			State:   c.State,
+			Status:  c.State,
+			Ports:   []container.Port{},
+			Mounts:  mountPoints(c),
+		}
+		for _, host := range sortedKeys(c.Ports) {
+			s.Ports = append(s.Ports, container.Port{IP: "0.0.0.0", PrivatePort: uint16(c.Ports[host]), PublicPort: uint16(host), Type: "tcp"})
+		}
+		list = append(list, s)
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+func (d *Docker) handleInspect(w http.ResponseWriter, r *http.Request) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	i := d.find(r.PathValue("id"))
+	if i < 0 {
+		dockerError(w, http.StatusNotFound, "No such container: "+r.PathValue("id"))
+		return
+	}
+	c := d.containers[i]
+	state := &container.State{Status: c.State, Running: c.State == "running"}
+	if state.Running {
+		state.StartedAt = dockerStarted.Format(time.RFC3339Nano)
+	}
+	if c.Health != "" {
+		state.Health = &container.Health{Status: c.Health}
+	}
+	ports := nat.PortMap{}
+	for host, ctr := range c.Ports {
+		port := nat.Port(fmt.Sprintf("%d/tcp", ctr))
+		ports[port] = append(ports[port], nat.PortBinding{HostIP: "0.0.0.0", HostPort: strconv.Itoa(host)})
+	}
+	writeJSON(w, http.StatusOK, container.InspectResponse{
+		ContainerJSONBase: &container.ContainerJSONBase{
+			ID:           c.ID,
+			Name:         "/" + c.Name,
+			Image:        imageID(c.Image),
+			State:        state,
+			RestartCount: c.RestartCount,
+			HostConfig:   &container.HostConfig{Resources: container.Resources{Memory: int64(c.MemoryLimit)}},
+		},
+		Mounts: mountPoints(c),
+		Config: &container.Config{Image: c.Image, Labels: c.Labels},
+		NetworkSettings: &container.NetworkSettings{
+			NetworkSettingsBase: container.NetworkSettingsBase{Ports: ports},
+		},
+	})
+}
+
+// handleStats answers a one-shot stats request. CPU usage is derived so
+// that the client's usual calculation gives c.CPUPercent.
+func (d *Docker) handleStats(w http.ResponseWriter, r *http.Request) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	i := d.find(r.PathValue("id"))
+	if i < 0 {
+		dockerError(w, http.StatusNotFound, "No such container: "+r.PathValue("id"))
+		return
+	}
+	c := d.containers[i]
+	const cores, systemDelta = 4, 1e10
+	stats := container.StatsResponse{
+		Name:        "/" + c.Name,
+		ID:          c.ID,
+		Read:        time.Now(),
+		PidsStats:   container.PidsStats{Current: 8},
+		MemoryStats: container.MemoryStats{Usage: c.MemoryBytes, Limit: c.MemoryLimit},
+		Networks:    map[string]container.NetworkStats{"eth0": {RxBytes: 1 << 20, TxBytes: 1 << 19}},
+	}
+	if stats.MemoryStats.Limit == 0 {
+		stats.MemoryStats.Limit = 8 << 30
+	}
+	stats.PreCPUStats = container.CPUStats{SystemUsage: 5e11, OnlineCPUs: cores}
+	stats.PreCPUStats.CPUUsage.TotalUsage = 1e10
+	stats.CPUStats = container.CPUStats{SystemUsage: 5e11 + systemDelta, OnlineCPUs: cores}
+	stats.CPUStats.CPUUsage.TotalUsage = 1e10 + uint64(c.CPUPercent/100/cores*systemDelta)
+	writeJSON(w, http.StatusOK, stats)
+}
+
+func (d *Docker) handleAction(w http.ResponseWriter, r *http.Request) {
+	action := r.PathValue("action")
+	if action != "start" && action != "stop" && action != "restart" {
+		dockerError(w, http.StatusNotFound, "page not found")
+		return
+	}
+	if slices.Contains(d.opts.Denied, action) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte("Forbidden\n"))
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	i := d.find(r.PathValue("id"))
+	if i < 0 {
+		dockerError(w, http.StatusNotFound, "No such container: "+r.PathValue("id"))
+		return
+	}
+	c := &d.containers[i]
+	switch action {
+	case "start", "restart":
+		c.State = "running"
+	case "stop":
+		c.State = "exited"
+	}
+	d.actions = append(d.actions, action+" "+c.Name)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (d *Docker) handleImage(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, image.InspectResponse{
+		ID:      r.PathValue("id"),
+		Created: dockerStarted.Add(-30 * 24 * time.Hour).Format(time.RFC3339Nano),
+	})
+}
+
+func (d *Docker) handleDiskUsage(w http.ResponseWriter, r *http.Request) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	du := types.DiskUsage{}
+	for _, c := range d.containers {
+		du.Containers = append(du.Containers, &container.Summary{
+			ID:         c.ID,
+			Names:      []string{"/" + c.Name},
+			SizeRw:     4 << 20,
+			SizeRootFs: 120 << 20,
+		})
+	}
+	writeJSON(w, http.StatusOK, du)
+}
+
+// handleEvents holds the event stream open without events until the
+// client goes away or the mock is closed.
+func (d *Docker) handleEvents(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.(http.Flusher).Flush()
+	select {
+	case <-r.Context().Done():
+	case <-d.done:
+	}
+}
+
+func imageID(ref string) string {
+	sum := sha256.Sum256([]byte(ref))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+func mountPoints(c Container) []container.MountPoint {
+	mounts := []container.MountPoint{}
+	for _, dst := range sortedKeys(c.Mounts) {
+		mounts = append(mounts, container.MountPoint{Type: mount.TypeBind, Source: c.Mounts[dst], Destination: dst, RW: true})
+	}
+	return mounts
+}
+
+func sortedKeys[K int | string, V any](m map[K]V) []K {
+	keys := make([]K, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
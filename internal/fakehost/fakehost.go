@@ -0,0 +1,190 @@
+// Package fakehost is a fake Linux host for integration tests: a fixture
+// tree standing in for the host's /proc, /sys and /etc, a mock Docker
+// Engine API (docker.go) and mock service endpoints (services.go).
+//
+// Collectors read the tree through hostfs, exactly as they read a host
+// mounted into the agent's container. hostfs resolves its paths once, so
+// a test binary installs the tree from TestMain, before anything reads the
+// host:
+//
+//	var host *fakehost.Host
+//
+//	func TestMain(m *testing.M) {
+//		var err error
+//		if host, err = fakehost.Install(); err != nil {
+//			log.Fatal(err)
+//		}
+//		code := m.Run()
+//		host.Close()
+//		os.Exit(code)
+//	}
+//
+// The tree describes a 4-core machine with 8 GB of memory, a clean and a
+// degraded md array, one thermal zone at 48 °C, and three processes:
+// systemd (PID 1), sshd (412) and a zombie (980). Tests add the processes
+// they need with AddProcess.
+package fakehost
+
+import (
+	"cmp"
+	"embed"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+//go:embed root
+var fixtures embed.FS
+
+// Host is an installed fixture tree.
+type Host struct {
+	// Root is the host's / as collectors see it (DESKMON_HOST_ROOT).
+	Root string
+
+	mu        sync.Mutex
+	sockets   map[int][]socket // PID → listening sockets
+	nextInode uint64
+}
+
+type socket struct {
+	port  int
+	inode uint64
+}
+
+// tcpHeader is the first line of /proc/net/tcp.
+const tcpHeader = "  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode\n"
+
+// Install copies the fixture tree into a new temporary directory and points
+// DESKMON_HOST_ROOT at it. It must run before the first hostfs call of the
+// test binary.
+func Install() (*Host, error) {
+	dir, err := os.MkdirTemp("", "deskmon-fakehost-")
+	if err != nil {
+		return nil, err
+	}
+	tree, _ := fs.Sub(fixtures, "root")
+	if err := os.CopyFS(dir, tree); err != nil {
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("fakehost: %w", err)
+	}
+	os.Setenv("DESKMON_HOST_ROOT", dir)
+	for _, env := range []string{"DESKMON_HOST_PROC", "DESKMON_HOST_SYS", "DESKMON_HOST_ETC", "DESKMON_HOST_NETNS"} {
+		os.Unsetenv(env)
+	}
+	return &Host{Root: dir, sockets: make(map[int][]socket), nextInode: 40000}, nil
+}
+
+// Close removes the tree.
+func (h *Host) Close() error {
+	return os.RemoveAll(h.Root)
+}
+
+// Path returns the real path of a host path, e.g. Path("/proc/loadavg").
+func (h *Host) Path(path string) string {
+	return filepath.Join(h.Root, path)
+}
+
+// WriteFile replaces a host file, creating its directory as needed, e.g.
+// WriteFile("/proc/loadavg", "4.00 3.00 2.00 5/400 9000\n").
+func (h *Host) WriteFile(path, data string) error {
+	p := h.Path(path)
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(p, []byte(data), 0o644)
+}
+
+// Process is a process to add to /proc.
+type Process struct {
+	PID     int
+	PPID    int // default 1
+	Name    string
+	Cmdline []string // default Name
+	UID     int
+	State   byte   // default 'S'
+	RSSKB   uint64 // resident memory
+	UTime   uint64 // CPU time in clock ticks
+	STime   uint64
+	Ports   []int // TCP ports it listens on, on 127.0.0.1
+}
+
+// AddProcess writes /proc/<pid> for p. Its listening ports are added to
+// /proc/net/tcp with a socket inode linked from /proc/<pid>/fd, which is
+// how service detection maps ports to processes.
+func (h *Host) AddProcess(p Process) error {
+	if p.PPID == 0 && p.PID != 1 {
+		p.PPID = 1
+	}
+	if p.State == 0 {
+		p.State = 'S'
+	}
+	if p.Cmdline == nil {
+		p.Cmdline = []string{p.Name}
+	}
+	pid := strconv.Itoa(p.PID)
+	stat := fmt.Sprintf("%d (%s) %c %d %d %d 0 -1 4194560 100 0 0 0 %d %d 0 0 20 0 1 0 100 10000000 %d\n",
+		p.PID, p.Name, p.State, p.PPID, p.PID, p.PID, p.UTime, p.STime, p.RSSKB/4)
+	status := fmt.Sprintf("Name:\t%s\nState:\t%c\nPid:\t%d\nPPid:\t%d\nUid:\t%d\t%d\t%d\t%d\nGid:\t%d\t%d\t%d\t%d\nVmRSS:\t%8d kB\n",
+		p.Name, p.State, p.PID, p.PPID, p.UID, p.UID, p.UID, p.UID, p.UID, p.UID, p.UID, p.UID, p.RSSKB)
+	files := map[string]string{
+		"comm":    p.Name + "\n",
+		"stat":    stat,
+		"status":  status,
+		"cmdline": strings.Join(p.Cmdline, "\x00") + "\x00",
+	}
+	for name, data := range files {
+		if err := h.WriteFile(filepath.Join("/proc", pid, name), data); err != nil {
+			return err
+		}
+	}
+
+	fdDir := h.Path(filepath.Join("/proc", pid, "fd"))
+	if err := os.MkdirAll(fdDir, 0o755); err != nil {
+		return err
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for i, port := range p.Ports {
+		h.nextInode++
+		s := socket{port: port, inode: h.nextInode}
+		if err := os.Symlink(fmt.Sprintf("socket:[%d]", s.inode), filepath.Join(fdDir, strconv.Itoa(3+i))); err != nil {
+			return err
+		}
+		h.sockets[p.PID] = append(h.sockets[p.PID], s)
+	}
+	return h.writeTCP()
+}
+
+// RemoveProcess removes /proc/<pid> and its listening sockets.
+func (h *Host) RemoveProcess(pid int) error {
+	if err := os.RemoveAll(h.Path(filepath.Join("/proc", strconv.Itoa(pid)))); err != nil {
+		return err
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.sockets, pid)
+	return h.writeTCP()
+}
+
+// writeTCP rewrites PID 1's net/tcp, which hostfs.Net reads in Docker
+// mode, from h.sockets. Must be called with h.mu held.
+func (h *Host) writeTCP() error {
+	var all []socket
+	for _, socks := range h.sockets {
+		all = append(all, socks...)
+	}
+	slices.SortFunc(all, func(a, b socket) int { return cmp.Compare(a.inode, b.inode) })
+
+	var b strings.Builder
+	b.WriteString(tcpHeader)
+	for i, s := range all {
+		fmt.Fprintf(&b, "%4d: 0100007F:%04X 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 %d 1 0000000000000000 100 0 0 10 0\n",
+			i, s.port, s.inode)
+	}
+	return h.WriteFile("/proc/1/net/tcp", b.String())
+}
@@ -0,0 +1,184 @@
+package fakehost
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync"
+)
+
+// Mock service endpoints for the service plugins. Each answers the paths
+// its plugin probes and collects from with fixed figures; anything else is
+// a 404, as on the real thing.
+
+// Port returns the local port srv listens on, for AddProcess and
+// Container.Ports.
+func Port(srv *httptest.Server) int {
+	u, _ := url.Parse(srv.URL)
+	port, _ := strconv.Atoi(u.Port())
+	return port
+}
+
+// PiHoleV5 serves Pi-hole 5's /admin/api.php?summaryRaw: 24,680 queries
+// today, 15% blocked.
+func PiHoleV5() *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /admin/api.php", func(w http.ResponseWriter, r *http.Request) {
+		if !r.URL.Query().Has("summaryRaw") {
+			writeJSON(w, http.StatusOK, []interface{}{})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"domains_being_blocked": 123456,
+			"dns_queries_today":     24680,
+			"ads_blocked_today":     3702,
+			"ads_percentage_today":  15.0,
+			"unique_domains":        2345,
+			"queries_forwarded":     14000,
+			"queries_cached":        6978,
+			"unique_clients":        12,
+			"status":                "enabled",
+		})
+	})
+	mux.HandleFunc("GET /admin/{$}", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "<html><title>Pi-hole</title></html>")
+	})
+	return httptest.NewServer(mux)
+}
+
+// PiHoleV6 serves Pi-hole 6's REST API: 30,000 queries, 4,500 blocked.
+// With a password, /api/stats/summary and /api/dns/blocking need a session
+// from POST /api/auth, passed in X-FTL-SID; an empty password leaves the
+// API open.
+func PiHoleV6(password string) *httptest.Server {
+	var mu sync.Mutex
+	sessions := make(map[string]bool)
+	nextSID := 0
+	authorized := func(r *http.Request) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return password == "" || sessions[r.Header.Get("X-FTL-SID")]
+	}
+	unauthorized := func(w http.ResponseWriter) {
+		writeJSON(w, http.StatusUnauthorized, map[string]interface{}{
+			"error": map[string]interface{}{"key": "unauthorized", "message": "Unauthorized", "hint": nil},
+			"took":  0.0001,
+		})
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/auth", func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Password string `json:"password"`
+		}
+		if json.NewDecoder(r.Body).Decode(&body) != nil || body.Password != password {
+			unauthorized(w)
+			return
+		}
+		mu.Lock()
+		nextSID++
+		sid := fmt.Sprintf("fakehost-sid-%d", nextSID)
+		sessions[sid] = true
+		mu.Unlock()
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"session": map[string]interface{}{"valid": true, "totp": false, "sid": sid, "csrf": "fakehost-csrf", "validity": 1800},
+		})
+	})
+	mux.HandleFunc("DELETE /api/auth", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		found := sessions[r.Header.Get("X-FTL-SID")]
+		delete(sessions, r.Header.Get("X-FTL-SID"))
+		mu.Unlock()
+		if !found {
+			unauthorized(w)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("GET /api/auth", func(w http.ResponseWriter, r *http.Request) {
+		if !authorized(r) || password == "" {
+			unauthorized(w)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"session": map[string]interface{}{"valid": true}})
+	})
+	mux.HandleFunc("GET /api/stats/summary", func(w http.ResponseWriter, r *http.Request) {
+		if !authorized(r) {
+			unauthorized(w)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"queries": map[string]interface{}{
+				"total": 30000, "blocked": 4500, "percent_blocked": 15.0,
+				"unique_domains": 3100, "forwarded": 18000, "cached": 7500,
+			},
+			"clients": map[string]interface{}{"active": 9, "total": 14},
+			"gravity": map[string]interface{}{"domains_being_blocked": 150000},
+		})
+	})
+	mux.HandleFunc("GET /api/dns/blocking", func(w http.ResponseWriter, r *http.Request) {
+		if !authorized(r) {
+			unauthorized(w)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"blocking": "enabled", "timer": nil})
+	})
+	mux.HandleFunc("GET /admin/{$}", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "<html><title>Pi-hole</title></html>")
+	})
+	return httptest.NewServer(mux)
+}
+
+// Traefik serves Traefik's API: 6 HTTP routers, 5 services, 3 middlewares,
+// one TCP router and 3 entrypoints, none with errors.
+func Traefik() *httptest.Server {
+	count := func(total int) map[string]int {
+		return map[string]int{"total": total, "warnings": 0, "errors": 0}
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/overview", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"http":      map[string]interface{}{"routers": count(6), "services": count(5), "middlewares": count(3)},
+			"tcp":       map[string]interface{}{"routers": count(1), "services": count(1), "middlewares": count(0)},
+			"udp":       map[string]interface{}{"routers": count(0), "services": count(0)},
+			"features":  map[string]interface{}{"tracing": "", "metrics": "", "accessLog": false},
+			"providers": []string{"Docker", "File"},
+		})
+	})
+	mux.HandleFunc("GET /api/entrypoints", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, []map[string]string{
+			{"name": "web", "address": ":80"},
+			{"name": "websecure", "address": ":443"},
+			{"name": "traefik", "address": ":8080"},
+		})
+	})
+	mux.HandleFunc("GET /api/http/routers", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, []map[string]interface{}{
+			{"name": "app@docker", "rule": "Host(`app.example.com`)", "service": "app", "provider": "docker",
+				"status": "enabled", "entryPoints": []string{"websecure"}, "tls": map[string]string{"certResolver": "letsencrypt"}},
+			{"name": "dashboard@file", "rule": "Host(`traefik.example.com`) && PathPrefix(`/dashboard`)", "service": "api@internal",
+				"provider": "file", "status": "enabled", "entryPoints": []string{"web"}},
+		})
+	})
+	mux.HandleFunc("GET /api/http/services", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, []map[string]interface{}{
+			{"name": "app@docker", "provider": "docker", "status": "enabled",
+				"loadBalancer": map[string]interface{}{"servers": []map[string]string{{"url": "http://172.18.0.5:3000"}}}},
+			{"name": "api@internal", "provider": "internal", "status": "enabled"},
+		})
+	})
+	return httptest.NewServer(mux)
+}
+
+// NginxStubStatus serves nginx's stub_status at /nginx_status.
+func NginxStubStatus() *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /nginx_status", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		fmt.Fprint(w, "Active connections: 291 \nserver accepts handled requests\n 16630948 16630948 31070465 \nReading: 6 Writing: 179 Waiting: 106 \n")
+	})
+	return httptest.NewServer(mux)
+}
@@ -0,0 +1,275 @@
+// Package history keeps recent metric samples in memory: one-second
+// samples for the last hour and one-minute averages for the last week, so
+// clients can chart trends without the agent needing a database.
+package history
+
+import (
+	"sort"
+	"sync"
+	"time"
+	"unsafe"
+
+	"github.com/neur0map/deskmon-agent/internal/collector"
+)
+
+// Metric names recorded from system stats.
+const (
+	MetricCPU         = "cpu"         // percent
+	MetricMemory      = "memory"      // percent of total
+	MetricTemperature = "temperature" // °C, only when a sensor is available
+	MetricNetRx       = "net_rx"      // physical download, bytes/s
+	MetricNetTx       = "net_tx"      // physical upload, bytes/s
+)
+
+const (
+	DefaultRawRetention    = time.Hour
+	DefaultMinuteRetention = 7 * 24 * time.Hour
+)
+
+// Sample is one value at a point in time.
+type Sample struct {
+	At    time.Time `json:"t"`
+	Value float64   `json:"v"`
+}
+
+// Rollup aggregates the samples of one minute.
+type Rollup struct {
+	At    time.Time
+	Min   float64
+	Max   float64
+	Avg   float64
+	P95   float64
+	Count int
+}
+
+func (s Sample) when() time.Time { return s.At }
+func (r Rollup) when() time.Time { return r.At }
+
+// ring is a fixed-capacity FIFO of entries in time order.
+type ring[T interface{ when() time.Time }] struct {
+	buf   []T
+	start int
+	n     int
+}
+
+func newRing[T interface{ when() time.Time }](capacity int) ring[T] {
+	return ring[T]{buf: make([]T, capacity)}
+}
+
+func (r *ring[T]) push(v T) {
+	if r.n < len(r.buf) {
+		r.buf[(r.start+r.n)%len(r.buf)] = v
+		r.n++
+		return
+	}
+	r.buf[r.start] = v
+	r.start = (r.start + 1) % len(r.buf)
+}
+
+// resize changes the capacity, keeping the newest entries that fit.
+func (r *ring[T]) resize(capacity int) {
+	keep := min(r.n, capacity)
+	buf := make([]T, capacity)
+	for i := 0; i < keep; i++ {
+		buf[i] = r.at(r.n - keep + i)
+	}
+	r.buf, r.start, r.n = buf, 0, keep
+}
+
+func (r *ring[T]) at(i int) T {
+	return r.buf[(r.start+i)%len(r.buf)]
+}
+
+// between returns entries with from <= when < to.
+func (r *ring[T]) between(from, to time.Time) []T {
+	lo := sort.Search(r.n, func(i int) bool { return !r.at(i).when().Before(from) })
+	var out []T
+	for i := lo; i < r.n; i++ {
+		v := r.at(i)
+		if !v.when().Before(to) {
+			break
+		}
+		out = append(out, v)
+	}
+	return out
+}
+
+// covers reports whether the ring still holds everything since from: it
+// has never wrapped, or its oldest entry is no later than from.
+func (r *ring[T]) covers(from time.Time) bool {
+	return r.n < len(r.buf) || !from.Before(r.at(0).when())
+}
+
+// series holds both resolutions of one metric. Values of the current
+// minute are kept until it closes and is rolled up.
+type series struct {
+	raw     ring[Sample]
+	minutes ring[Rollup]
+	minute  time.Time
+	pending []float64
+}
+
+func (ser *series) closeMinute() {
+	if len(ser.pending) == 0 {
+		return
+	}
+	b := summarize(ser.pending)
+	ser.minutes.push(Rollup{At: ser.minute, Min: b.Min, Max: b.Max, Avg: b.Avg, P95: b.P95, Count: b.Count})
+	ser.pending = ser.pending[:0]
+}
+
+// Store is the in-memory history of all metrics.
+type Store struct {
+	mu     sync.RWMutex
+	series map[string]*series
+	stopCh chan struct{}
+
+	rawRetention    time.Duration
+	minuteRetention time.Duration
+}
+
+func NewStore() *Store {
+	return NewStoreWithRetention(DefaultRawRetention, DefaultMinuteRetention)
+}
+
+// NewStoreWithRetention creates a store keeping one-second samples for raw
+// and one-minute averages for minutes. Buffers are allocated up front, so
+// shorter retention directly lowers memory use.
+func NewStoreWithRetention(raw, minutes time.Duration) *Store {
+	return &Store{
+		series:          make(map[string]*series),
+		stopCh:          make(chan struct{}),
+		rawRetention:    raw,
+		minuteRetention: minutes,
+	}
+}
+
+func (s *Store) Stop() {
+	close(s.stopCh)
+}
+
+// SetRetention changes how far back each resolution reaches. Existing
+// series are resized right away, keeping their newest entries, so
+// shortening retention frees memory immediately.
+func (s *Store) SetRetention(raw, minutes time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rawRetention, s.minuteRetention = raw, minutes
+	for _, ser := range s.series {
+		ser.raw.resize(rawCapacity(raw))
+		ser.minutes.resize(minuteCapacity(minutes))
+	}
+}
+
+// Retention returns the current retention of both resolutions.
+func (s *Store) Retention() (raw, minutes time.Duration) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.rawRetention, s.minuteRetention
+}
+
+func rawCapacity(d time.Duration) int    { return max(1, int(d/time.Second)) }
+func minuteCapacity(d time.Duration) int { return max(1, int(d/time.Minute)) }
+
+// systemMetrics is how many series recordSystem can create.
+const systemMetrics = 5
+
+// FitRetention shortens raw and minutes by the same factor until the
+// buffers of the system metrics fit in budget bytes. Retention that
+// already fits is returned unchanged.
+func FitRetention(budget uint64, raw, minutes time.Duration) (time.Duration, time.Duration) {
+	perMetric := uint64(rawCapacity(raw))*uint64(unsafe.Sizeof(Sample{})) +
+		uint64(minuteCapacity(minutes))*uint64(unsafe.Sizeof(Rollup{}))
+	need := perMetric * systemMetrics
+	if need <= budget {
+		return raw, minutes
+	}
+	scale := float64(budget) / float64(need)
+	return max(time.Minute, time.Duration(float64(raw)*scale)),
+		max(time.Hour, time.Duration(float64(minutes)*scale))
+}
+
+// Record adds a sample for metric at t. Samples must arrive in time order.
+func (s *Store) Record(metric string, t time.Time, v float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ser, ok := s.series[metric]
+	if !ok {
+		ser = &series{
+			raw:     newRing[Sample](rawCapacity(s.rawRetention)),
+			minutes: newRing[Rollup](minuteCapacity(s.minuteRetention)),
+			pending: make([]float64, 0, 60), // reused every minute
+		}
+		s.series[metric] = ser
+	}
+	ser.raw.push(Sample{At: t, Value: v})
+
+	if minute := t.Truncate(time.Minute); !minute.Equal(ser.minute) {
+		ser.closeMinute()
+		ser.minute = minute
+	}
+	ser.pending = append(ser.pending, v)
+}
+
+// Query returns samples of metric in [from, to), at one-second resolution
+// when the raw buffer still covers from, otherwise as one-minute averages.
+func (s *Store) Query(metric string, from, to time.Time) []Sample {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	ser, ok := s.series[metric]
+	if !ok {
+		return nil
+	}
+	if ser.raw.covers(from) {
+		return ser.raw.between(from, to)
+	}
+	rollups := ser.minutes.between(from, to)
+	samples := make([]Sample, len(rollups))
+	for i, r := range rollups {
+		samples[i] = Sample{At: r.At, Value: r.Avg}
+	}
+	return samples
+}
+
+// Metrics lists the recorded metric names.
+func (s *Store) Metrics() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	names := make([]string, 0, len(s.series))
+	for name := range s.series {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// WatchSystem records system metrics on every sample until Stop is called.
+func (s *Store) WatchSystem(b *collector.Broadcaster[collector.SystemEvent]) {
+	ch, cleanup := b.Subscribe(2)
+	go func() {
+		defer cleanup()
+		for {
+			select {
+			case ev := <-ch:
+				s.recordSystem(time.Now(), ev.System)
+			case <-s.stopCh:
+				return
+			}
+		}
+	}()
+}
+
+func (s *Store) recordSystem(now time.Time, sys collector.SystemStats) {
+	s.Record(MetricCPU, now, sys.CPU.UsagePercent)
+	if sys.Memory.TotalBytes > 0 {
+		s.Record(MetricMemory, now, float64(sys.Memory.UsedBytes)/float64(sys.Memory.TotalBytes)*100)
+	}
+	if sys.CPU.TemperatureAvailable {
+		s.Record(MetricTemperature, now, sys.CPU.Temperature)
+	}
+	s.Record(MetricNetRx, now, sys.Network.Physical.DownloadBytesPerSec)
+	s.Record(MetricNetTx, now, sys.Network.Physical.UploadBytesPerSec)
+}
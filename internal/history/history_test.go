@@ -0,0 +1,78 @@
+package history
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestRingWraparound(t *testing.T) {
+	t0 := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		capacity int
+		pushes   int
+		want     []float64 // values kept, oldest first
+	}{
+		{"empty", 3, 0, nil},
+		{"partial", 3, 2, []float64{0, 1}},
+		{"exactly full", 3, 3, []float64{0, 1, 2}},
+		{"wrapped", 3, 4, []float64{1, 2, 3}},
+		{"wrapped twice", 3, 7, []float64{4, 5, 6}},
+		{"capacity one", 1, 3, []float64{2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newRing[Sample](tt.capacity)
+			for i := range tt.pushes {
+				r.push(Sample{At: t0.Add(time.Duration(i) * time.Second), Value: float64(i)})
+			}
+			var got []float64
+			for _, s := range r.between(t0, t0.Add(time.Hour)) {
+				got = append(got, s.Value)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("between = %v, want %v", got, tt.want)
+			}
+			if wrapped := tt.pushes > tt.capacity; r.covers(t0) == wrapped {
+				t.Errorf("covers(start) = %v after %d pushes into %d", r.covers(t0), tt.pushes, tt.capacity)
+			}
+		})
+	}
+}
+
+func TestRingResizeKeepsNewest(t *testing.T) {
+	t0 := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	r := newRing[Sample](4)
+	for i := range 6 {
+		r.push(Sample{At: t0.Add(time.Duration(i) * time.Second), Value: float64(i)})
+	}
+	r.resize(2)
+	r.push(Sample{At: t0.Add(6 * time.Second), Value: 6})
+
+	var got []float64
+	for _, s := range r.between(t0, t0.Add(time.Hour)) {
+		got = append(got, s.Value)
+	}
+	if want := []float64{5, 6}; !slices.Equal(got, want) {
+		t.Errorf("after resize = %v, want %v", got, want)
+	}
+}
+
+func TestQueryFallsBackToMinutes(t *testing.T) {
+	s := NewStoreWithRetention(time.Minute, time.Hour)
+	t0 := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := range 3 * 60 { // three minutes of one-second samples
+		s.Record(MetricCPU, t0.Add(time.Duration(i)*time.Second), float64(i/60))
+	}
+
+	// The raw ring holds only the last minute, so a query from t0 gets the
+	// closed minutes' averages.
+	got := s.Query(MetricCPU, t0, t0.Add(time.Hour))
+	if len(got) != 2 || got[0].Value != 0 || got[1].Value != 1 {
+		t.Errorf("Query from t0 = %+v, want averages 0 and 1", got)
+	}
+	if raw := s.Query(MetricCPU, t0.Add(2*time.Minute), t0.Add(time.Hour)); len(raw) != 60 {
+		t.Errorf("Query of the last minute = %d samples, want 60 raw", len(raw))
+	}
+}
@@ -0,0 +1,125 @@
+package history
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// Bucket summarizes the samples in [Start, Start+resolution).
+type Bucket struct {
+	Start time.Time `json:"start"`
+	Min   float64   `json:"min"`
+	Max   float64   `json:"max"`
+	Avg   float64   `json:"avg"`
+	P95   float64   `json:"p95"`
+	Count int       `json:"count"`
+}
+
+// Summary rolls samples of metric in [from, to) up into buckets of the
+// given resolution, aligned to multiples of it. Empty buckets are omitted.
+//
+// Within the last hour the rollups are exact. Further back they are built
+// from per-minute rollups: min, max and avg stay exact, p95 is the 95th
+// percentile of the per-minute p95 values.
+func (s *Store) Summary(metric string, from, to time.Time, resolution time.Duration) []Bucket {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	ser, ok := s.series[metric]
+	if !ok {
+		return nil
+	}
+
+	buckets := []Bucket{}
+	if ser.raw.covers(from) {
+		var start time.Time
+		var values []float64
+		flush := func() {
+			if len(values) > 0 {
+				b := summarize(values)
+				b.Start = start
+				buckets = append(buckets, b)
+			}
+			values = values[:0]
+		}
+		for _, sample := range ser.raw.between(from, to) {
+			if bs := sample.At.Truncate(resolution); !bs.Equal(start) {
+				flush()
+				start = bs
+			}
+			values = append(values, sample.Value)
+		}
+		flush()
+		return buckets
+	}
+
+	var start time.Time
+	var group []Rollup
+	flush := func() {
+		if len(group) > 0 {
+			b := mergeRollups(group)
+			b.Start = start
+			buckets = append(buckets, b)
+		}
+		group = group[:0]
+	}
+	for _, r := range ser.minutes.between(from, to) {
+		if bs := r.At.Truncate(resolution); !bs.Equal(start) {
+			flush()
+			start = bs
+		}
+		group = append(group, r)
+	}
+	flush()
+	return buckets
+}
+
+// summarize computes min/max/avg/p95 of values (nearest-rank p95).
+func summarize(values []float64) Bucket {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	var sum float64
+	for _, v := range sorted {
+		sum += v
+	}
+	return Bucket{
+		Min:   sorted[0],
+		Max:   sorted[len(sorted)-1],
+		Avg:   round2(sum / float64(len(sorted))),
+		P95:   percentile(sorted, 95),
+		Count: len(sorted),
+	}
+}
+
+func mergeRollups(group []Rollup) Bucket {
+	b := Bucket{Min: group[0].Min, Max: group[0].Max}
+	var weighted float64
+	p95s := make([]float64, 0, len(group))
+	for _, r := range group {
+		b.Min = math.Min(b.Min, r.Min)
+		b.Max = math.Max(b.Max, r.Max)
+		weighted += r.Avg * float64(r.Count)
+		b.Count += r.Count
+		p95s = append(p95s, r.P95)
+	}
+	if b.Count > 0 {
+		b.Avg = round2(weighted / float64(b.Count))
+	}
+	sort.Float64s(p95s)
+	b.P95 = percentile(p95s, 95)
+	return b
+}
+
+// percentile returns the nearest-rank percentile of sorted values.
+func percentile(sorted []float64, p float64) float64 {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+func round2(v float64) float64 {
+	return math.Round(v*100) / 100
+}
@@ -0,0 +1,92 @@
+// Package hostfs resolves paths on the monitored host. A systemd install
+// reads /proc, /sys and /etc directly. The containerized deployment mounts
+// the host's filesystem inside the agent's container and points these
+// environment variables at it, so collectors report the host, not the
+// container:
+//
+//	DESKMON_HOST_ROOT  host's / (e.g. /hostfs)
+//	DESKMON_HOST_PROC  host's /proc (default: $DESKMON_HOST_ROOT/proc, else /proc)
+//	DESKMON_HOST_SYS   host's /sys  (default: $DESKMON_HOST_ROOT/sys, else /sys)
+//	DESKMON_HOST_ETC   host's /etc  (default: $DESKMON_HOST_ROOT/etc, else /etc)
+//	DESKMON_HOST_NETNS "true" to dial local services from the host's network
+//	                   namespace (needs CAP_SYS_ADMIN, Linux only)
+//
+// Paths are resolved once, at first use.
+package hostfs
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+type paths struct {
+	root string // "" when the agent runs on the host itself
+	proc string
+	sys  string
+	etc  string
+}
+
+var resolved = sync.OnceValue(func() paths {
+	p := paths{root: os.Getenv("DESKMON_HOST_ROOT")}
+	p.proc = resolve("DESKMON_HOST_PROC", p.root, "proc", "stat")
+	p.sys = resolve("DESKMON_HOST_SYS", p.root, "sys", "class")
+	p.etc = resolve("DESKMON_HOST_ETC", p.root, "etc", "")
+	return p
+})
+
+// resolve picks the explicit variable, else dir under root when root has
+// it (probe is a file that must exist there), else the agent's own /dir.
+func resolve(env, root, dir, probe string) string {
+	if v := os.Getenv(env); v != "" {
+		return v
+	}
+	if root != "" {
+		candidate := filepath.Join(root, dir)
+		if _, err := os.Stat(filepath.Join(candidate, probe)); err == nil {
+			return candidate
+		}
+	}
+	return "/" + dir
+}
+
+// Containerized reports whether the host is mounted into the agent's
+// container (DESKMON_HOST_ROOT is set).
+func Containerized() bool {
+	return resolved().root != ""
+}
+
+// Path maps an absolute host path into the agent's view of the host
+// filesystem.
+func Path(path string) string {
+	if root := resolved().root; root != "" {
+		return filepath.Join(root, path)
+	}
+	return path
+}
+
+// Proc joins elem onto the host's /proc.
+func Proc(elem ...string) string {
+	return filepath.Join(append([]string{resolved().proc}, elem...)...)
+}
+
+// Sys joins elem onto the host's /sys.
+func Sys(elem ...string) string {
+	return filepath.Join(append([]string{resolved().sys}, elem...)...)
+}
+
+// Etc joins elem onto the host's /etc.
+func Etc(elem ...string) string {
+	return filepath.Join(append([]string{resolved().etc}, elem...)...)
+}
+
+// Net joins elem onto /proc/net of the host's network namespace. /proc/net
+// follows the reading process, so in Docker mode PID 1's view is used: the
+// counters and listening sockets are the host's even without
+// --network=host.
+func Net(elem ...string) string {
+	if Containerized() {
+		return Proc(append([]string{"1", "net"}, elem...)...)
+	}
+	return Proc(append([]string{"net"}, elem...)...)
+}
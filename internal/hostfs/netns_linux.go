@@ -0,0 +1,79 @@
+package hostfs
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"runtime"
+	"strconv"
+	"sync"
+
+	"golang.org/x/sys/unix"
+)
+
+// hostNetNS opens the host's network namespace when DESKMON_HOST_NETNS is
+// set and the agent is not already in it. nil means dial normally.
+var hostNetNS = sync.OnceValue(func() *os.File {
+	if on, _ := strconv.ParseBool(os.Getenv("DESKMON_HOST_NETNS")); !on {
+		return nil
+	}
+	f, err := os.Open(Proc("1/ns/net"))
+	if err != nil {
+		log.Printf("hostfs: host network namespace unavailable, dialing from the agent's: %v", err)
+		return nil
+	}
+	var host, self unix.Stat_t
+	if unix.Fstat(int(f.Fd()), &host) != nil || unix.Stat("/proc/self/ns/net", &self) != nil ||
+		(host.Dev == self.Dev && host.Ino == self.Ino) {
+		f.Close()
+		return nil
+	}
+	log.Printf("hostfs: dialing local services from the host network namespace")
+	return f
+})
+
+// HostNetwork reports whether local connections are made from the host's
+// network namespace rather than the agent's own.
+func HostNetwork() bool {
+	return hostNetNS() != nil
+}
+
+// DialContext connects like net.Dialer.DialContext, but from the host's
+// network namespace when DESKMON_HOST_NETNS is enabled, so 127.0.0.1
+// reaches services on the host even when the agent has its own network.
+// Use it as http.Transport.DialContext for local probes.
+func DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	ns := hostNetNS()
+
+	// A negative FallbackDelay keeps the dial on this goroutine (and so on
+	// the locked thread below) instead of racing IPv4 and IPv6.
+	d := net.Dialer{FallbackDelay: -1}
+	if ns == nil {
+		return d.DialContext(ctx, network, addr)
+	}
+
+	// Namespaces are per thread: a socket belongs to the namespace of the
+	// thread that created it, and keeps it after the thread switches back.
+	runtime.LockOSThread()
+	self, err := os.Open("/proc/thread-self/ns/net")
+	if err != nil {
+		runtime.UnlockOSThread()
+		return nil, fmt.Errorf("host network namespace: %w", err)
+	}
+	defer self.Close()
+	if err := unix.Setns(int(ns.Fd()), unix.CLONE_NEWNET); err != nil {
+		runtime.UnlockOSThread()
+		return nil, fmt.Errorf("entering host network namespace: %w", err)
+	}
+	conn, err := d.DialContext(ctx, network, addr)
+	if restoreErr := unix.Setns(int(self.Fd()), unix.CLONE_NEWNET); restoreErr != nil {
+		// Leave the thread locked: the runtime discards it when this
+		// goroutine exits instead of reusing it in the wrong namespace.
+		log.Printf("hostfs: could not leave host network namespace: %v", restoreErr)
+		return conn, err
+	}
+	runtime.UnlockOSThread()
+	return conn, err
+}
@@ -0,0 +1,20 @@
+//go:build !linux
+
+package hostfs
+
+import (
+	"context"
+	"net"
+)
+
+// HostNetwork reports whether local connections are made from the host's
+// network namespace. Network namespaces are Linux-only.
+func HostNetwork() bool {
+	return false
+}
+
+// DialContext connects like net.Dialer.DialContext.
+func DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	var d net.Dialer
+	return d.DialContext(ctx, network, addr)
+}
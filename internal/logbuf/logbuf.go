@@ -0,0 +1,57 @@
+// Package logbuf keeps the most recent agent log lines in memory so they
+// can be included in diagnostics without access to journald or docker logs.
+package logbuf
+
+import (
+	"bytes"
+	"sync"
+)
+
+// Buffer is an io.Writer that retains the last Capacity lines written.
+type Buffer struct {
+	mu      sync.Mutex
+	lines   []string
+	next    int
+	full    bool
+	partial []byte
+}
+
+func New(capacity int) *Buffer {
+	return &Buffer{lines: make([]string, capacity)}
+}
+
+// Write splits p into lines; a trailing partial line is kept until the
+// rest arrives. log.Logger always writes whole lines.
+func (b *Buffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	data := append(b.partial, p...)
+	for {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			break
+		}
+		b.lines[b.next] = string(data[:i])
+		b.next = (b.next + 1) % len(b.lines)
+		if b.next == 0 {
+			b.full = true
+		}
+		data = data[i+1:]
+	}
+	b.partial = append(b.partial[:0], data...)
+	return len(p), nil
+}
+
+// Lines returns the retained lines, oldest first.
+func (b *Buffer) Lines() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.full {
+		return append([]string(nil), b.lines[:b.next]...)
+	}
+	out := make([]string, 0, len(b.lines))
+	out = append(out, b.lines[b.next:]...)
+	return append(out, b.lines[:b.next]...)
+}
@@ -0,0 +1,148 @@
+// Package memguard keeps the agent within max_memory_mb. It sets the Go
+// runtime's soft memory limit below the budget and, when resident memory
+// still approaches it, sheds optional work one step at a time (pausing
+// collectors, shortening history) until usage drops, then restores it.
+package memguard
+
+import (
+	"log"
+	"math"
+	"os"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+const (
+	checkInterval = 10 * time.Second
+
+	// Fractions of the limit. Shedding starts above shedAt and is undone
+	// below restoreAt; the gap keeps the guard from flapping.
+	shedAt    = 0.85
+	restoreAt = 0.65
+
+	// heapShare is the part of the budget given to the Go heap as its soft
+	// limit; the rest covers stacks, runtime metadata and fragmentation.
+	heapShare = 0.7
+)
+
+// Action is one step of load the guard can shed under memory pressure.
+type Action struct {
+	Name    string
+	Shed    func()
+	Restore func()
+}
+
+// Status is the guard's state for /agent/status.
+type Status struct {
+	LimitMB  int      `json:"limitMB"`
+	RSSMB    float64  `json:"rssMB"`
+	Shedding bool     `json:"shedding"`
+	Shed     []string `json:"shed"` // actions currently in effect, in the order they were taken
+	Episodes int      `json:"episodes"`
+}
+
+// Guard watches the agent's resident memory against a limit.
+type Guard struct {
+	limit uint64 // bytes
+
+	mu       sync.Mutex
+	actions  []Action
+	shed     int // actions[:shed] are in effect
+	rss      uint64
+	episodes int
+	stopCh   chan struct{}
+	stopOnce sync.Once
+}
+
+// New creates a guard for a limit in megabytes.
+func New(limitMB int) *Guard {
+	return &Guard{
+		limit:  uint64(limitMB) << 20,
+		stopCh: make(chan struct{}),
+	}
+}
+
+// Add appends an action. Actions are shed in the order added and restored
+// in reverse, so add the cheapest to lose first.
+func (g *Guard) Add(a Action) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.actions = append(g.actions, a)
+}
+
+// Start applies the soft heap limit and checks memory every 10 seconds
+// until Stop. GOMEMLIMIT in the environment takes precedence, and a lower
+// limit already set (e.g. by the embedded build) is kept.
+func (g *Guard) Start() {
+	if os.Getenv("GOMEMLIMIT") == "" {
+		heap := int64(float64(g.limit) * heapShare)
+		if current := debug.SetMemoryLimit(-1); current > heap {
+			debug.SetMemoryLimit(heap)
+		}
+	}
+	log.Printf("memguard: limit %d MiB", g.limit>>20)
+
+	go func() {
+		ticker := time.NewTicker(checkInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				g.check(readRSS())
+			case <-g.stopCh:
+				return
+			}
+		}
+	}()
+}
+
+func (g *Guard) Stop() {
+	g.stopOnce.Do(func() { close(g.stopCh) })
+}
+
+// check sheds the next action while over shedAt, or restores the last one
+// while under restoreAt. One step per check gives each a chance to work.
+func (g *Guard) check(rss uint64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.rss = rss
+	if rss == 0 {
+		return
+	}
+	used := float64(rss) / float64(g.limit)
+
+	switch {
+	case used >= shedAt && g.shed < len(g.actions):
+		if g.shed == 0 {
+			g.episodes++
+		}
+		a := g.actions[g.shed]
+		g.shed++
+		log.Printf("memguard: RSS %d MiB is %.0f%% of the limit, shedding %s", rss>>20, used*100, a.Name)
+		a.Shed()
+		debug.FreeOSMemory()
+	case used < restoreAt && g.shed > 0:
+		g.shed--
+		a := g.actions[g.shed]
+		log.Printf("memguard: RSS %d MiB is %.0f%% of the limit, restoring %s", rss>>20, used*100, a.Name)
+		a.Restore()
+	}
+}
+
+// Status returns the latest reading and the actions in effect.
+func (g *Guard) Status() Status {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	st := Status{
+		LimitMB:  int(g.limit >> 20),
+		RSSMB:    math.Round(float64(g.rss)/(1<<20)*10) / 10,
+		Shedding: g.shed > 0,
+		Shed:     []string{},
+		Episodes: g.episodes,
+	}
+	for _, a := range g.actions[:g.shed] {
+		st.Shed = append(st.Shed, a.Name)
+	}
+	return st
+}
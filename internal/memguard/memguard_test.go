@@ -0,0 +1,37 @@
+package memguard
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGuardShedsAndRestoresInOrder(t *testing.T) {
+	g := New(100)
+	var log []string
+	for _, name := range []string{"a", "b"} {
+		g.Add(Action{
+			Name:    name,
+			Shed:    func() { log = append(log, "shed "+name) },
+			Restore: func() { log = append(log, "restore "+name) },
+		})
+	}
+
+	const mb = 1 << 20
+	g.check(90 * mb) // over shedAt: one step per check
+	g.check(90 * mb)
+	g.check(90 * mb) // nothing left to shed
+	if st := g.Status(); !st.Shedding || !reflect.DeepEqual(st.Shed, []string{"a", "b"}) {
+		t.Fatalf("status after pressure = %+v", st)
+	}
+	g.check(75 * mb) // between thresholds: hold
+	g.check(50 * mb)
+	g.check(50 * mb)
+
+	want := []string{"shed a", "shed b", "restore b", "restore a"}
+	if !reflect.DeepEqual(log, want) {
+		t.Errorf("actions = %v, want %v", log, want)
+	}
+	if st := g.Status(); st.Shedding || st.Episodes != 1 || st.RSSMB != 50 {
+		t.Errorf("status after recovery = %+v", st)
+	}
+}
@@ -0,0 +1,26 @@
+package memguard
+
+import (
+	"os"
+	"strconv"
+	"strings"
+)
+
+// readRSS returns the agent's resident set size from /proc/self/statm, or
+// 0 when it can't be read. This is the agent's own /proc, also in Docker
+// mode.
+func readRSS() uint64 {
+	data, err := os.ReadFile("/proc/self/statm")
+	if err != nil {
+		return 0
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) < 2 {
+		return 0
+	}
+	pages, err := strconv.ParseUint(fields[1], 10, 64)
+	if err != nil {
+		return 0
+	}
+	return pages * uint64(os.Getpagesize())
+}
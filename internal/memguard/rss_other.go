@@ -0,0 +1,13 @@
+//go:build !linux
+
+package memguard
+
+import "runtime"
+
+// readRSS approximates resident memory with what the Go runtime holds from
+// the OS and hasn't returned.
+func readRSS() uint64 {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	return m.Sys - m.HeapReleased
+}
@@ -0,0 +1,337 @@
+// Package notify POSTs JSON notifications to webhook URLs when alerts
+// fire or resolve and when containers turn unhealthy or start restarting,
+// so the agent can page someone without a client app open.
+package notify
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"time"
+
+	"github.com/neur0map/deskmon-agent/internal/alerts"
+	"github.com/neur0map/deskmon-agent/internal/collector"
+	"github.com/neur0map/deskmon-agent/internal/config"
+)
+
+// Notification kinds.
+const (
+	KindAlertFired          = "alert.fired"
+	KindAlertResolved       = "alert.resolved"
+	KindContainerUnhealthy  = "container.unhealthy"
+	KindContainerRestarting = "container.restarting"
+)
+
+const (
+	queueSize       = 64
+	deliveryTimeout = 10 * time.Second
+	maxAttempts     = 3
+)
+
+// retryDelay is the wait before the second and later attempts.
+var retryDelay = 2 * time.Second
+
+// Notification is the JSON body posted to webhooks. Text is a one-line
+// summary, so Slack-style incoming webhooks show something readable
+// without a template.
+type Notification struct {
+	Kind      string          `json:"kind"`
+	At        time.Time       `json:"at"`
+	Host      string          `json:"host"`
+	Severity  string          `json:"severity"`
+	Source    string          `json:"source"`
+	Message   string          `json:"message"`
+	Text      string          `json:"text"`
+	Alert     *alerts.Alert   `json:"alert,omitempty"`
+	Container *ContainerState `json:"container,omitempty"`
+}
+
+// ContainerState is the container a container.* notification is about.
+type ContainerState struct {
+	ID           string `json:"id"`
+	Name         string `json:"name"`
+	Image        string `json:"image"`
+	Status       string `json:"status"`
+	HealthStatus string `json:"healthStatus"`
+	RestartCount int    `json:"restartCount"`
+}
+
+// Dispatcher queues notifications and delivers them to every matching
+// webhook in the background. Each webhook has its own queue and goroutine,
+// so a slow or failing endpoint only delays its own notifications. A full
+// queue drops new notifications rather than blocking the collectors.
+type Dispatcher struct {
+	hooks  []webhook
+	host   string
+	client *http.Client
+	stopCh chan struct{}
+}
+
+// webhook is a configured webhook and its pending deliveries.
+type webhook struct {
+	config.WebhookConfig
+	queue chan delivery
+}
+
+// delivery is an encoded notification waiting for one webhook.
+type delivery struct {
+	kind string
+	body []byte
+}
+
+func NewDispatcher(hooks []config.WebhookConfig) *Dispatcher {
+	host, _ := os.Hostname()
+	d := &Dispatcher{
+		host:   host,
+		client: &http.Client{Timeout: deliveryTimeout},
+		stopCh: make(chan struct{}),
+	}
+	for _, hook := range hooks {
+		d.hooks = append(d.hooks, webhook{WebhookConfig: hook, queue: make(chan delivery, queueSize)})
+	}
+	return d
+}
+
+// Start delivers queued notifications until Stop, one goroutine per
+// webhook.
+func (d *Dispatcher) Start() {
+	for i := range d.hooks {
+		hook := &d.hooks[i]
+		go func() {
+			for {
+				select {
+				case job := <-hook.queue:
+					if err := d.post(hook.WebhookConfig, job.body); err != nil {
+						log.Printf("notify: %s to %s failed: %v", job.kind, redact(hook.URL), err)
+					}
+				case <-d.stopCh:
+					return
+				}
+			}
+		}()
+	}
+}
+
+// Stop ends delivery and the watchers. Queued notifications are dropped.
+func (d *Dispatcher) Stop() {
+	close(d.stopCh)
+}
+
+// Notify queues n for every webhook that wants it.
+func (d *Dispatcher) Notify(n Notification) {
+	if n.At.IsZero() {
+		n.At = time.Now().UTC()
+	}
+	if n.Host == "" {
+		n.Host = d.host
+	}
+	if n.Text == "" {
+		n.Text = fmt.Sprintf("[%s] %s: %s", n.Host, n.Severity, n.Message)
+	}
+	body, err := json.Marshal(n)
+	if err != nil {
+		log.Printf("notify: encoding %s: %v", n.Kind, err)
+		return
+	}
+	for i := range d.hooks {
+		hook := &d.hooks[i]
+		if !wants(hook.WebhookConfig, n) {
+			continue
+		}
+		select {
+		case hook.queue <- delivery{kind: n.Kind, body: body}:
+		default:
+			log.Printf("notify: queue for %s full, dropped %s for %s", redact(hook.URL), n.Kind, n.Source)
+		}
+	}
+}
+
+// WatchAlerts notifies when an alert first fires and when it resolves.
+// Refreshes of an active alert are not sent again.
+func (d *Dispatcher) WatchAlerts(b *collector.Broadcaster[alerts.Alert]) {
+	ch, cleanup := b.Subscribe(16)
+	go func() {
+		defer cleanup()
+		for {
+			select {
+			case a := <-ch:
+				kind := KindAlertFired
+				switch {
+				case a.ResolvedAt != nil:
+					kind = KindAlertResolved
+				case !a.StartedAt.Equal(a.UpdatedAt):
+					continue
+				}
+				d.Notify(Notification{
+					Kind:     kind,
+					Severity: a.Severity,
+					Source:   a.Source,
+					Message:  alertMessage(kind, a),
+					Alert:    &a,
+				})
+			case <-d.stopCh:
+				return
+			}
+		}
+	}()
+}
+
+func alertMessage(kind string, a alerts.Alert) string {
+	if kind == KindAlertResolved {
+		return "Resolved: " + a.Message
+	}
+	return a.Message
+}
+
+// WatchContainers notifies when a container's health check starts failing
+// or it enters the restarting state. The first refresh is the baseline.
+func (d *Dispatcher) WatchContainers(b *collector.Broadcaster[[]collector.ContainerStats]) {
+	ch, cleanup := b.Subscribe(2)
+	go func() {
+		defer cleanup()
+		var prev map[string]collector.ContainerStats
+		for {
+			select {
+			case containers := <-ch:
+				cur := make(map[string]collector.ContainerStats, len(containers))
+				for _, c := range containers {
+					cur[c.Name] = c
+				}
+				if prev != nil {
+					for _, n := range containerTransitions(prev, cur) {
+						d.Notify(n)
+					}
+				}
+				prev = cur
+			case <-d.stopCh:
+				return
+			}
+		}
+	}()
+}
+
+func containerTransitions(prev, cur map[string]collector.ContainerStats) []Notification {
+	var out []Notification
+	for name, c := range cur {
+		old, seen := prev[name]
+		if !seen {
+			old = collector.ContainerStats{Status: c.Status, HealthStatus: c.HealthStatus}
+		}
+		state := &ContainerState{
+			ID:           c.ID,
+			Name:         c.Name,
+			Image:        c.Image,
+			Status:       c.Status,
+			HealthStatus: c.HealthStatus,
+			RestartCount: c.RestartCount,
+		}
+		if c.HealthStatus == "unhealthy" && old.HealthStatus != "unhealthy" {
+			out = append(out, Notification{
+				Kind:      KindContainerUnhealthy,
+				Severity:  alerts.SeverityWarning,
+				Source:    "container:" + name,
+				Message:   name + " is unhealthy",
+				Container: state,
+			})
+		}
+		if c.Status == "restarting" && old.Status != "restarting" {
+			out = append(out, Notification{
+				Kind:      KindContainerRestarting,
+				Severity:  alerts.SeverityWarning,
+				Source:    "container:" + name,
+				Message:   fmt.Sprintf("%s is restarting (%d restarts)", name, c.RestartCount),
+				Container: state,
+			})
+		}
+	}
+	return out
+}
+
+// wants reports whether the webhook subscribes to n's kind and severity.
+func wants(hook config.WebhookConfig, n Notification) bool {
+	if severityRank(n.Severity) < severityRank(hook.MinSeverity) {
+		return false
+	}
+	if len(hook.Events) == 0 {
+		return true
+	}
+	for _, pattern := range hook.Events {
+		if ok, _ := path.Match(pattern, n.Kind); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func severityRank(s string) int {
+	switch s {
+	case alerts.SeverityCritical:
+		return 2
+	case alerts.SeverityWarning:
+		return 1
+	}
+	return 0
+}
+
+// post sends body to the webhook, retrying network errors, 429 and 5xx
+// responses. Other 4xx responses are a configuration problem and aren't
+// retried.
+func (d *Dispatcher) post(hook config.WebhookConfig, body []byte) error {
+	var lastErr error
+	for attempt := 0; attempt < maxAttempts; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-time.After(retryDelay * time.Duration(attempt)):
+			case <-d.stopCh:
+				return lastErr
+			}
+		}
+		req, err := http.NewRequest(http.MethodPost, hook.URL, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("User-Agent", "deskmon-agent")
+		for k, v := range hook.Headers {
+			req.Header.Set(k, v)
+		}
+		if hook.Secret != "" {
+			mac := hmac.New(sha256.New, []byte(hook.Secret))
+			mac.Write(body)
+			req.Header.Set("X-Deskmon-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+		}
+
+		resp, err := d.client.Do(req)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		resp.Body.Close()
+		switch {
+		case resp.StatusCode < 300:
+			return nil
+		case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+			lastErr = fmt.Errorf("HTTP %d", resp.StatusCode)
+		default:
+			return fmt.Errorf("HTTP %d", resp.StatusCode)
+		}
+	}
+	return lastErr
+}
+
+// redact keeps a webhook URL's host for logs; the path often holds a token.
+func redact(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "webhook"
+	}
+	return u.Scheme + "://" + u.Host + "/…"
+}
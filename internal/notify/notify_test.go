@@ -0,0 +1,93 @@
+package notify
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/neur0map/deskmon-agent/internal/alerts"
+	"github.com/neur0map/deskmon-agent/internal/collector"
+	"github.com/neur0map/deskmon-agent/internal/config"
+)
+
+func TestDispatcherDeliversSignedMatchingNotifications(t *testing.T) {
+	received := make(chan Notification, 4)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mac := hmac.New(sha256.New, []byte("s3cret"))
+		mac.Write(body)
+		if got, want := r.Header.Get("X-Deskmon-Signature"), "sha256="+hex.EncodeToString(mac.Sum(nil)); got != want {
+			t.Errorf("signature = %q, want %q", got, want)
+		}
+		var n Notification
+		if err := json.Unmarshal(body, &n); err != nil {
+			t.Errorf("decoding body: %v", err)
+		}
+		received <- n
+	}))
+	defer srv.Close()
+
+	d := NewDispatcher([]config.WebhookConfig{{
+		URL:         srv.URL,
+		Secret:      "s3cret",
+		Events:      []string{"container.*"},
+		MinSeverity: "warning",
+	}})
+	containers := collector.NewBroadcaster[[]collector.ContainerStats]()
+	alertsB := collector.NewBroadcaster[alerts.Alert]()
+	d.WatchContainers(containers)
+	d.WatchAlerts(alertsB)
+	d.Start()
+	defer d.Stop()
+
+	containers.Send([]collector.ContainerStats{{Name: "web", Status: "running", HealthStatus: "healthy"}})
+	containers.Send([]collector.ContainerStats{{Name: "web", Status: "running", HealthStatus: "unhealthy"}})
+	now := time.Now()
+	alertsB.Send(alerts.Alert{ID: "x", Severity: "critical", StartedAt: now, UpdatedAt: now}) // filtered by events
+
+	select {
+	case n := <-received:
+		if n.Kind != KindContainerUnhealthy || n.Container == nil || n.Container.Name != "web" {
+			t.Errorf("notification = %+v", n)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no notification delivered")
+	}
+	select {
+	case n := <-received:
+		t.Errorf("unexpected second notification %+v", n)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestSlowWebhookDoesNotDelayOthers(t *testing.T) {
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer slow.Close()
+	defer close(release)
+
+	received := make(chan struct{}, 1)
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- struct{}{}
+	}))
+	defer fast.Close()
+
+	d := NewDispatcher([]config.WebhookConfig{{URL: slow.URL}, {URL: fast.URL}})
+	d.Start()
+	defer d.Stop()
+
+	d.Notify(Notification{Kind: KindAlertFired, Severity: "warning", Message: "disk full"})
+	select {
+	case <-received:
+	case <-time.After(2 * time.Second):
+		t.Fatal("second webhook waited for the first")
+	}
+}
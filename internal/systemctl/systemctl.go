@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+
+	"github.com/neur0map/deskmon-agent/internal/hostfs"
 )
 
 const serviceName = "deskmon-agent"
@@ -14,7 +16,7 @@ var ErrDockerMode = errors.New("agent control not available in Docker mode — u
 
 // isDockerMode returns true when running inside a Docker container.
 func isDockerMode() bool {
-	if os.Getenv("DESKMON_HOST_ROOT") != "" {
+	if hostfs.Containerized() {
 		return true
 	}
 	if _, err := os.Stat("/.dockerenv"); err == nil {
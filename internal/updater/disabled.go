@@ -0,0 +1,20 @@
+//go:build nodocker
+
+package updater
+
+import "time"
+
+// Supported is false in builds without the Docker client (nodocker tag).
+const Supported = false
+
+func (u *Updater) tick() {}
+
+// Update always fails: there is no Docker client to pull or recreate with.
+func (u *Updater) Update(name string) Result {
+	return Result{
+		Container: name,
+		Status:    StatusFailed,
+		Error:     "agent built without Docker support",
+		At:        time.Now(),
+	}
+}
@@ -0,0 +1,313 @@
+//go:build !nodocker
+
+package updater
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/client"
+	"github.com/docker/go-connections/nat"
+
+	"github.com/neur0map/deskmon-agent/internal/collector"
+)
+
+// Supported is false in builds without the Docker client (nodocker tag).
+const Supported = true
+
+func (u *Updater) tick() {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	cli, err := collector.NewDockerClient(u.host)
+	if err != nil {
+		cancel()
+		return
+	}
+	defer cli.Close()
+
+	containers, err := cli.ContainerList(ctx, container.ListOptions{})
+	cancel()
+	if err != nil {
+		return
+	}
+
+	now := time.Now()
+	var due []string
+	seen := make(map[string]bool)
+
+	u.mu.Lock()
+	for _, c := range containers {
+		if len(c.Names) == 0 {
+			continue
+		}
+		name := strings.TrimPrefix(c.Names[0], "/")
+		sc, ok := u.policyFor(name, c.Labels)
+		if !ok {
+			continue
+		}
+		seen[name] = true
+		next, scheduled := u.nextRun[name]
+		if !scheduled {
+			u.nextRun[name] = sc.next(now)
+			continue
+		}
+		if !now.Before(next) {
+			due = append(due, name)
+			u.nextRun[name] = sc.next(now)
+		}
+	}
+	for name := range u.nextRun {
+		if !seen[name] {
+			delete(u.nextRun, name)
+		}
+	}
+	u.mu.Unlock()
+
+	// Sequential: updates pull images and restart services, so running
+	// them one at a time keeps load and blast radius small.
+	for _, name := range due {
+		result := u.Update(name)
+		u.Broadcast.Send(result)
+	}
+}
+
+// Update pulls the container's image and recreates it if the image changed.
+func (u *Updater) Update(name string) Result {
+	ctx, cancel := context.WithTimeout(context.Background(), updateTimeout)
+	defer cancel()
+
+	result := Result{Container: name, At: time.Now()}
+	fail := func(status string, err error) Result {
+		result.Status = status
+		result.Error = err.Error()
+		log.Printf("auto-update: %s: %s: %v", name, status, err)
+		return result
+	}
+
+	cli, err := collector.NewDockerClient(u.host)
+	if err != nil {
+		return fail(StatusFailed, err)
+	}
+	defer cli.Close()
+
+	info, err := cli.ContainerInspect(ctx, name)
+	if err != nil {
+		return fail(StatusFailed, err)
+	}
+	ref := info.Config.Image
+	result.Image = ref
+	result.OldImageID = info.Image
+
+	if strings.Contains(ref, "@") || strings.HasPrefix(ref, "sha256:") {
+		result.Status = StatusSkipped
+		result.Error = "image is pinned by digest"
+		return result
+	}
+
+	// Inspected before the pull, which may untag it.
+	oldImage, err := cli.ImageInspect(ctx, info.Image)
+	if err != nil {
+		log.Printf("auto-update: %s: could not inspect old image %s, keeping the whole config: %v", name, shortImageID(info.Image), err)
+	}
+
+	log.Printf("auto-update: %s: pulling %s", name, ref)
+	rc, err := cli.ImagePull(ctx, ref, image.PullOptions{})
+	if err != nil {
+		return fail(StatusFailed, fmt.Errorf("pull %s: %w", ref, err))
+	}
+	_, err = io.Copy(io.Discard, rc)
+	rc.Close()
+	if err != nil {
+		return fail(StatusFailed, fmt.Errorf("pull %s: %w", ref, err))
+	}
+
+	img, err := cli.ImageInspect(ctx, ref)
+	if err != nil {
+		return fail(StatusFailed, err)
+	}
+	result.NewImageID = img.ID
+	if img.ID == info.Image {
+		result.Status = StatusUpToDate
+		log.Printf("auto-update: %s: %s is up to date", name, ref)
+		return result
+	}
+
+	// Recreating gets its own deadlines: a pull that used up ctx must not
+	// leave the container stopped.
+	if err := recreate(cli, info, newConfig(info, oldImage, ref)); err != nil {
+		status := StatusFailed
+		if rbErr, ok := err.(*rolledBackError); ok {
+			status = StatusRolledBack
+			err = rbErr.err
+		}
+		return fail(status, err)
+	}
+
+	if u.cfg.Cleanup {
+		ctx, cancel := context.WithTimeout(context.Background(), recreateTimeout)
+		defer cancel()
+		if _, err := cli.ImageRemove(ctx, info.Image, image.RemoveOptions{PruneChildren: true}); err != nil {
+			log.Printf("auto-update: %s: could not remove old image %s: %v", name, shortImageID(info.Image), err)
+		}
+	}
+
+	result.Status = StatusUpdated
+	log.Printf("auto-update: %s: updated %s (%s → %s)", name, ref, shortImageID(info.Image), shortImageID(img.ID))
+	return result
+}
+
+// rolledBackError means the new container failed and the old one was
+// restored.
+type rolledBackError struct{ err error }
+
+func (e *rolledBackError) Error() string { return e.err.Error() }
+
+// newConfig is the config for the container described by info recreated
+// on ref. Like Watchtower, it keeps only what the container set over its
+// old image, so the new image's own env, command, entrypoint, labels and
+// the like take effect instead of the old image's.
+func newConfig(info container.InspectResponse, oldImage image.InspectResponse, ref string) container.Config {
+	cfg := *info.Config
+	cfg.Image = ref
+	if cfg.Hostname == info.ID[:12] {
+		cfg.Hostname = "" // default hostname is the container ID; let Docker assign the new one
+	}
+	img := oldImage.Config
+	if img == nil {
+		return cfg
+	}
+
+	cfg.Env = slices.DeleteFunc(slices.Clone(cfg.Env), func(kv string) bool { return slices.Contains(img.Env, kv) })
+	cfg.Labels = maps.Clone(cfg.Labels)
+	maps.DeleteFunc(cfg.Labels, func(k, v string) bool {
+		iv, ok := img.Labels[k]
+		return ok && iv == v
+	})
+	cfg.ExposedPorts = maps.Clone(cfg.ExposedPorts)
+	for p := range img.ExposedPorts {
+		delete(cfg.ExposedPorts, nat.Port(p))
+	}
+	cfg.Volumes = maps.Clone(cfg.Volumes)
+	for v := range img.Volumes {
+		delete(cfg.Volumes, v)
+	}
+	// A container's own entrypoint resets the image's command, so the
+	// command is only the image's when the entrypoint is too.
+	if slices.Equal([]string(cfg.Entrypoint), img.Entrypoint) {
+		cfg.Entrypoint = nil
+		if slices.Equal([]string(cfg.Cmd), img.Cmd) {
+			cfg.Cmd = nil
+		}
+	}
+	if cfg.Healthcheck != nil && img.Healthcheck != nil && reflect.DeepEqual(*cfg.Healthcheck, *img.Healthcheck) {
+		cfg.Healthcheck = nil
+	}
+	if cfg.WorkingDir == img.WorkingDir {
+		cfg.WorkingDir = ""
+	}
+	if cfg.User == img.User {
+		cfg.User = ""
+	}
+	if cfg.StopSignal == img.StopSignal {
+		cfg.StopSignal = ""
+	}
+	return cfg
+}
+
+// recreate replaces the container described by info with one created from
+// cfg, keeping its host config and networks. The old container is renamed
+// aside until the new one has started, then removed.
+func recreate(cli *client.Client, info container.InspectResponse, cfg container.Config) error {
+	name := strings.TrimPrefix(info.Name, "/")
+	oldName := name + "-deskmon-old"
+	stopTimeout := 10
+
+	ctx, cancel := context.WithTimeout(context.Background(), recreateTimeout)
+	defer cancel()
+
+	// Networks: the first is attached at create, the rest connected after,
+	// which works on every API version.
+	var netNames []string
+	endpoints := map[string]*network.EndpointSettings{}
+	if info.NetworkSettings != nil {
+		for netName, ep := range info.NetworkSettings.Networks {
+			if ep == nil {
+				continue
+			}
+			netNames = append(netNames, netName)
+			var aliases []string
+			for _, a := range ep.Aliases {
+				if a != info.ID[:12] {
+					aliases = append(aliases, a)
+				}
+			}
+			endpoints[netName] = &network.EndpointSettings{
+				IPAMConfig: ep.IPAMConfig,
+				Links:      ep.Links,
+				Aliases:    aliases,
+				DriverOpts: ep.DriverOpts,
+			}
+		}
+	}
+	netCfg := &network.NetworkingConfig{EndpointsConfig: map[string]*network.EndpointSettings{}}
+	if len(netNames) > 0 {
+		netCfg.EndpointsConfig[netNames[0]] = endpoints[netNames[0]]
+	}
+
+	if err := cli.ContainerStop(ctx, info.ID, container.StopOptions{Timeout: &stopTimeout}); err != nil {
+		return fmt.Errorf("stop: %w", err)
+	}
+
+	rollback := func(newID string, cause error) error {
+		// ctx may be what ran out.
+		ctx, cancel := context.WithTimeout(context.Background(), recreateTimeout)
+		defer cancel()
+		if newID != "" {
+			_ = cli.ContainerRemove(ctx, newID, container.RemoveOptions{Force: true})
+		}
+		_ = cli.ContainerRename(ctx, info.ID, name)
+		if err := cli.ContainerStart(ctx, info.ID, container.StartOptions{}); err != nil {
+			return fmt.Errorf("%v; restoring old container also failed: %w", cause, err)
+		}
+		return &rolledBackError{cause}
+	}
+
+	if err := cli.ContainerRename(ctx, info.ID, oldName); err != nil {
+		return rollback("", fmt.Errorf("rename: %w", err))
+	}
+
+	created, err := cli.ContainerCreate(ctx, &cfg, info.HostConfig, netCfg, nil, name)
+	if err != nil {
+		return rollback("", fmt.Errorf("create: %w", err))
+	}
+	for _, netName := range netNames[min(1, len(netNames)):] {
+		if err := cli.NetworkConnect(ctx, netName, created.ID, endpoints[netName]); err != nil {
+			return rollback(created.ID, fmt.Errorf("connect network %s: %w", netName, err))
+		}
+	}
+	if err := cli.ContainerStart(ctx, created.ID, container.StartOptions{}); err != nil {
+		return rollback(created.ID, fmt.Errorf("start: %w", err))
+	}
+
+	if err := cli.ContainerRemove(ctx, info.ID, container.RemoveOptions{}); err != nil {
+		log.Printf("auto-update: %s: could not remove old container %s: %v", name, oldName, err)
+	}
+	return nil
+}
+
+func shortImageID(id string) string {
+	id = strings.TrimPrefix(id, "sha256:")
+	if len(id) > 12 {
+		return id[:12]
+	}
+	return id
+}
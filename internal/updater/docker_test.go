@@ -0,0 +1,66 @@
+//go:build !nodocker
+
+package updater
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/go-connections/nat"
+)
+
+func TestNewConfigKeepsOnlyContainerSettings(t *testing.T) {
+	info := container.InspectResponse{
+		ContainerJSONBase: &container.ContainerJSONBase{ID: "0123456789abcdef"},
+		Config: &container.Config{
+			Hostname:     "0123456789ab",
+			Image:        "app:1",
+			Env:          []string{"PATH=/usr/bin", "APP_VERSION=1", "TZ=Europe/Berlin"},
+			Cmd:          []string{"serve"},
+			Entrypoint:   []string{"/entrypoint.sh"},
+			Labels:       map[string]string{"org.opencontainers.image.version": "1", "com.docker.compose.service": "app"},
+			ExposedPorts: nat.PortSet{"8080/tcp": {}, "9090/tcp": {}},
+			WorkingDir:   "/app",
+		},
+	}
+	var old image.InspectResponse
+	if err := json.Unmarshal([]byte(`{"Config": {
+		"Env": ["PATH=/usr/bin", "APP_VERSION=1"],
+		"Cmd": ["serve"],
+		"Entrypoint": ["/entrypoint.sh"],
+		"Labels": {"org.opencontainers.image.version": "1"},
+		"ExposedPorts": {"8080/tcp": {}},
+		"WorkingDir": "/app"
+	}}`), &old); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := newConfig(info, old, "app:2")
+	if cfg.Image != "app:2" || cfg.Hostname != "" {
+		t.Errorf("image %q, hostname %q; want app:2 and a new hostname", cfg.Image, cfg.Hostname)
+	}
+	if !slices.Equal(cfg.Env, []string{"TZ=Europe/Berlin"}) {
+		t.Errorf("Env = %v, want only TZ", cfg.Env)
+	}
+	if cfg.Cmd != nil || cfg.Entrypoint != nil || cfg.WorkingDir != "" {
+		t.Errorf("cmd %v, entrypoint %v, workdir %q; want the new image's", cfg.Cmd, cfg.Entrypoint, cfg.WorkingDir)
+	}
+	if len(cfg.Labels) != 1 || cfg.Labels["com.docker.compose.service"] != "app" {
+		t.Errorf("Labels = %v, want only the compose label", cfg.Labels)
+	}
+	if _, ok := cfg.ExposedPorts["9090/tcp"]; !ok || len(cfg.ExposedPorts) != 1 {
+		t.Errorf("ExposedPorts = %v, want only 9090/tcp", cfg.ExposedPorts)
+	}
+	if len(info.Config.Env) != 3 || len(info.Config.Labels) != 2 {
+		t.Error("newConfig modified the old container's config")
+	}
+
+	// A custom entrypoint keeps the command too.
+	info.Config.Entrypoint = []string{"/custom.sh"}
+	if cfg := newConfig(info, old, "app:2"); !slices.Equal([]string(cfg.Cmd), []string{"serve"}) {
+		t.Errorf("with a custom entrypoint Cmd = %v, want serve", cfg.Cmd)
+	}
+}
@@ -0,0 +1,49 @@
+package updater
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// schedule is either a daily wall-clock time ("04:00") or a fixed interval
+// ("12h").
+type schedule struct {
+	daily        bool
+	hour, minute int
+	every        time.Duration
+}
+
+func parseSchedule(s string) (schedule, error) {
+	s = strings.TrimSpace(s)
+	if strings.Contains(s, ":") {
+		var sc schedule
+		if _, err := fmt.Sscanf(s, "%d:%d", &sc.hour, &sc.minute); err != nil ||
+			sc.hour < 0 || sc.hour > 23 || sc.minute < 0 || sc.minute > 59 {
+			return schedule{}, fmt.Errorf("invalid daily time %q, want HH:MM", s)
+		}
+		sc.daily = true
+		return sc, nil
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return schedule{}, fmt.Errorf("invalid schedule %q, want HH:MM or a duration like 12h", s)
+	}
+	if d < time.Hour {
+		return schedule{}, fmt.Errorf("schedule interval %s is below the 1h minimum", d)
+	}
+	return schedule{every: d}, nil
+}
+
+// next returns the first run time strictly after t.
+func (sc schedule) next(t time.Time) time.Time {
+	if !sc.daily {
+		return t.Add(sc.every)
+	}
+	run := time.Date(t.Year(), t.Month(), t.Day(), sc.hour, sc.minute, 0, 0, t.Location())
+	if !run.After(t) {
+		run = run.AddDate(0, 0, 1)
+	}
+	return run
+}
@@ -0,0 +1,131 @@
+// Package updater implements scheduled, Watchtower-style container updates:
+// pull the image, and if it changed, recreate the container with the
+// settings it made over its old image, rolling back when the new container
+// fails to start.
+package updater
+
+import (
+	"log"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/neur0map/deskmon-agent/internal/collector"
+	"github.com/neur0map/deskmon-agent/internal/config"
+)
+
+// Labels for per-container policy. "deskmon.auto-update=true" opts a
+// container in, "false" opts it out even if listed in the config.
+const (
+	LabelEnabled  = "deskmon.auto-update"
+	LabelSchedule = "deskmon.auto-update.schedule"
+)
+
+const (
+	defaultSchedule = "04:00"
+	checkInterval   = time.Minute
+	updateTimeout   = 10 * time.Minute // inspect and pull
+	recreateTimeout = 2 * time.Minute  // stop, create and start; a rollback gets as long again
+)
+
+// Result statuses.
+const (
+	StatusUpdated    = "updated"
+	StatusUpToDate   = "up_to_date"
+	StatusRolledBack = "rolled_back"
+	StatusFailed     = "failed"
+	StatusSkipped    = "skipped"
+)
+
+// Result describes one update attempt. Broadcast after every attempt.
+type Result struct {
+	Container  string    `json:"container"`
+	Image      string    `json:"image"`
+	Status     string    `json:"status"`
+	OldImageID string    `json:"oldImageId,omitempty"`
+	NewImageID string    `json:"newImageId,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	At         time.Time `json:"at"`
+}
+
+// Updater runs update policies on a schedule.
+type Updater struct {
+	host     string
+	cfg      config.AutoUpdateConfig
+	schedule schedule
+
+	mu      sync.Mutex
+	nextRun map[string]time.Time // container name → next scheduled update
+	stopCh  chan struct{}
+
+	Broadcast *collector.Broadcaster[Result]
+}
+
+// New creates an updater for the Docker endpoint at host. An invalid default
+// schedule falls back to daily at 04:00.
+func New(host string, cfg config.AutoUpdateConfig) *Updater {
+	if cfg.Schedule == "" {
+		cfg.Schedule = defaultSchedule
+	}
+	sc, err := parseSchedule(cfg.Schedule)
+	if err != nil {
+		log.Printf("auto-update: %v, using %s", err, defaultSchedule)
+		sc, _ = parseSchedule(defaultSchedule)
+	}
+	return &Updater{
+		host:      host,
+		cfg:       cfg,
+		schedule:  sc,
+		nextRun:   make(map[string]time.Time),
+		stopCh:    make(chan struct{}),
+		Broadcast: collector.NewBroadcaster[Result](),
+	}
+}
+
+// Start begins checking policies once a minute.
+func (u *Updater) Start() {
+	log.Printf("auto-update: enabled (default schedule %s)", u.cfg.Schedule)
+	go func() {
+		ticker := time.NewTicker(checkInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				u.tick()
+			case <-u.stopCh:
+				return
+			}
+		}
+	}()
+}
+
+func (u *Updater) Stop() {
+	close(u.stopCh)
+}
+
+// policyFor returns the schedule for a container, or false when it is not
+// opted in.
+func (u *Updater) policyFor(name string, labels map[string]string) (schedule, bool) {
+	switch strings.ToLower(labels[LabelEnabled]) {
+	case "false", "0", "no":
+		return schedule{}, false
+	case "true", "1", "yes":
+		if custom := labels[LabelSchedule]; custom != "" {
+			sc, err := parseSchedule(custom)
+			if err != nil {
+				log.Printf("auto-update: %s: %v, using default schedule", name, err)
+				return u.schedule, true
+			}
+			return sc, true
+		}
+		return u.schedule, true
+	}
+
+	for _, pattern := range u.cfg.Containers {
+		if ok, err := path.Match(pattern, name); err == nil && ok {
+			return u.schedule, true
+		}
+	}
+	return schedule{}, false
+}